@@ -0,0 +1,507 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"namedot/internal/config"
+	"namedot/internal/db"
+	"namedot/internal/migrate"
+	"namedot/internal/replication"
+	"namedot/internal/selftest"
+	"namedot/pkg/store"
+)
+
+// subcommands maps "namedot <command>" names to their handlers.
+// Each handler receives the arguments following the command name.
+var subcommands = map[string]func(args []string){
+	"import-bind":     runImportBind,
+	"import-powerdns": runImportPowerDNS,
+	"db":              runDB,
+	"hosts":           runHosts,
+	"sync":            runSync,
+	"selftest":        runSelftest,
+	"token":           runRotate(db.CredentialAPIToken),
+	"password":        runRotate(db.CredentialAdminPassword),
+}
+
+// resolveConfigPath applies the -c/--config > SGDNS_CONFIG > config.yaml precedence.
+func resolveConfigPath(cfgPath string) string {
+	if cfgPath == "" {
+		cfgPath = os.Getenv("SGDNS_CONFIG")
+	}
+	if cfgPath == "" {
+		cfgPath = "config.yaml"
+	}
+	return cfgPath
+}
+
+// openConfiguredDB loads config, opens the database and runs migrations.
+func openConfiguredDB(cfgPath string) (*config.Config, *gorm.DB) {
+	cfg, err := config.Load(resolveConfigPath(cfgPath))
+	if err != nil {
+		log.Fatalf("load config: %v", err)
+	}
+	gormDB, err := db.OpenWithDebug(cfg.DB, cfg.Log.SQLDebug)
+	if err != nil {
+		log.Fatalf("open db: %v", err)
+	}
+	if err := db.AutoMigrate(gormDB); err != nil {
+		log.Fatalf("migrate db: %v", err)
+	}
+	return cfg, gormDB
+}
+
+// runImportBind imports every primary zone referenced by a BIND named.conf.
+func runImportBind(args []string) {
+	fs := flag.NewFlagSet("import-bind", flag.ExitOnError)
+	var cfgPath, namedConf, mode string
+	var dryRun bool
+	fs.StringVar(&cfgPath, "c", "", "")
+	fs.StringVar(&cfgPath, "config", "", "")
+	fs.StringVar(&namedConf, "named-conf", "/etc/bind/named.conf", "")
+	fs.StringVar(&mode, "mode", "upsert", "")
+	fs.BoolVar(&dryRun, "dry-run", false, "")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: namedot import-bind [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Imports all primary zones declared in a BIND named.conf.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fmt.Fprintf(os.Stderr, "  -c, -config <file>        Path to config file (default: config.yaml)\n")
+		fmt.Fprintf(os.Stderr, "  -named-conf <file>        Path to named.conf (default: /etc/bind/named.conf)\n")
+		fmt.Fprintf(os.Stderr, "  -mode <mode>              Import mode: upsert (default) or replace\n")
+		fmt.Fprintf(os.Stderr, "  -dry-run                  List zones that would be imported and exit\n")
+	}
+	_ = fs.Parse(args)
+
+	if mode != "upsert" && mode != "replace" {
+		log.Fatalf("invalid import mode: %s (must be 'upsert' or 'replace')", mode)
+	}
+
+	decls, err := migrate.ParseNamedConf(namedConf)
+	if err != nil {
+		log.Fatalf("parse named.conf: %v", err)
+	}
+	fmt.Printf("Found %d zone declarations in %s\n", len(decls), namedConf)
+
+	if dryRun {
+		for _, d := range decls {
+			action := "import"
+			if !d.IsPrimary() {
+				action = "skip (type " + d.Type + ")"
+			}
+			fmt.Printf("  %-40s %-20s %s\n", d.Name, action, d.File)
+		}
+		return
+	}
+
+	cfg, gormDB := openConfiguredDB(cfgPath)
+	results := migrate.ImportNamedConfZones(gormDB, decls, mode, cfg.DefaultTTL, cfg.RecordTTL)
+
+	var created, updated, skipped, failed int
+	for _, r := range results {
+		switch {
+		case r.Err != nil:
+			failed++
+			fmt.Printf("  FAIL    %-40s %s: %v\n", r.Zone, r.File, r.Err)
+		case r.Skipped != "":
+			skipped++
+			fmt.Printf("  SKIP    %-40s %s\n", r.Zone, r.Skipped)
+		case r.Created:
+			created++
+			fmt.Printf("  CREATE  %-40s %s\n", r.Zone, r.File)
+		default:
+			updated++
+			fmt.Printf("  UPDATE  %-40s %s\n", r.Zone, r.File)
+		}
+	}
+	store.EnsureSOA(gormDB, cfg)
+
+	fmt.Printf("Done: %d created, %d updated, %d skipped, %d failed\n", created, updated, skipped, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// runImportPowerDNS converts a PowerDNS generic SQL backend into namedot zones.
+func runImportPowerDNS(args []string) {
+	fs := flag.NewFlagSet("import-powerdns", flag.ExitOnError)
+	var cfgPath, driver, dsn, mode string
+	var includeSlaves, dryRun bool
+	fs.StringVar(&cfgPath, "c", "", "")
+	fs.StringVar(&cfgPath, "config", "", "")
+	fs.StringVar(&driver, "driver", "mysql", "")
+	fs.StringVar(&dsn, "dsn", "", "")
+	fs.StringVar(&mode, "mode", "upsert", "")
+	fs.BoolVar(&includeSlaves, "include-slaves", false, "")
+	fs.BoolVar(&dryRun, "dry-run", false, "")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: namedot import-powerdns [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Imports zones from a PowerDNS gmysql/gpgsql/gsqlite3 database.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fmt.Fprintf(os.Stderr, "  -c, -config <file>        Path to config file (default: config.yaml)\n")
+		fmt.Fprintf(os.Stderr, "  -driver <name>            PowerDNS database driver: mysql (default), postgres, sqlite\n")
+		fmt.Fprintf(os.Stderr, "  -dsn <dsn>                PowerDNS database DSN (required)\n")
+		fmt.Fprintf(os.Stderr, "  -mode <mode>              Import mode: upsert (default) or replace\n")
+		fmt.Fprintf(os.Stderr, "  -include-slaves           Also import SLAVE zones\n")
+		fmt.Fprintf(os.Stderr, "  -dry-run                  Convert and report without writing\n")
+	}
+	_ = fs.Parse(args)
+
+	if dsn == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if mode != "upsert" && mode != "replace" {
+		log.Fatalf("invalid import mode: %s (must be 'upsert' or 'replace')", mode)
+	}
+
+	srcDB, err := db.Open(config.DBConfig{Driver: driver, DSN: dsn})
+	if err != nil {
+		log.Fatalf("open powerdns db: %v", err)
+	}
+
+	var dstDB *gorm.DB
+	var cfg *config.Config
+	opts := migrate.PowerDNSOptions{Mode: mode, IncludeSlaves: includeSlaves, DryRun: dryRun}
+	if !dryRun {
+		cfg, dstDB = openConfiguredDB(cfgPath)
+		dstDB = db.WithSource(dstDB, db.SourceImport("powerdns"))
+		opts.DefaultTTL = cfg.DefaultTTL
+		opts.RecordTTL = cfg.RecordTTL
+	}
+
+	results, err := migrate.ImportPowerDNS(srcDB, dstDB, opts)
+	if err != nil {
+		log.Fatalf("import failed: %v", err)
+	}
+
+	var imported, skipped, failed int
+	for _, r := range results {
+		switch {
+		case r.Err != nil:
+			failed++
+			fmt.Printf("  FAIL    %-40s %v\n", r.Zone, r.Err)
+		case r.Skipped != "":
+			skipped++
+			fmt.Printf("  SKIP    %-40s %s\n", r.Zone, r.Skipped)
+		default:
+			imported++
+			fmt.Printf("  OK      %-40s %d rrsets, %d records, %d comments\n", r.Zone, r.RRSets, r.Records, r.Comments)
+		}
+		for _, w := range r.Warnings {
+			fmt.Printf("          warning: %s\n", w)
+		}
+	}
+	if dstDB != nil {
+		store.EnsureSOA(dstDB, cfg)
+	}
+
+	fmt.Printf("Done: %d imported, %d skipped, %d failed\n", imported, skipped, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// runDB dispatches "namedot db <action>" maintenance commands.
+func runDB(args []string) {
+	if len(args) == 0 || args[0] != "vacuum" {
+		fmt.Fprintf(os.Stderr, "Usage: namedot db vacuum [options]\n")
+		os.Exit(2)
+	}
+	fs := flag.NewFlagSet("db vacuum", flag.ExitOnError)
+	var cfgPath string
+	var skipVacuum bool
+	fs.StringVar(&cfgPath, "c", "", "")
+	fs.StringVar(&cfgPath, "config", "", "")
+	fs.BoolVar(&skipVacuum, "orphans-only", false, "")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: namedot db vacuum [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Removes orphaned/soft-deleted rows that cannot be restored and runs\n")
+		fmt.Fprintf(os.Stderr, "VACUUM/ANALYZE (SQLite), VACUUM ANALYZE (Postgres) or OPTIMIZE TABLE (MySQL).\n")
+		fmt.Fprintf(os.Stderr, "Zones in the trash are kept.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fmt.Fprintf(os.Stderr, "  -c, -config <file>        Path to config file (default: config.yaml)\n")
+		fmt.Fprintf(os.Stderr, "  -orphans-only             Only remove orphaned rows, skip VACUUM\n")
+	}
+	_ = fs.Parse(args[1:])
+
+	_, gormDB := openConfiguredDB(cfgPath)
+	st, err := db.CleanupOrphans(gormDB)
+	if err != nil {
+		log.Fatalf("cleanup failed: %v", err)
+	}
+	fmt.Printf("Removed orphaned rows: %d rdata, %d rrsets, %d template records\n", st.RData, st.RRSets, st.TemplateRecords)
+	if skipVacuum {
+		return
+	}
+	if err := db.Vacuum(gormDB); err != nil {
+		log.Fatalf("vacuum failed: %v", err)
+	}
+	fmt.Printf("Vacuum completed (%s)\n", gormDB.Dialector.Name())
+}
+
+// runSync pulls zones from a master into the running server on demand, the
+// way a slave does, without changing its config or restarting it.
+func runSync(args []string) {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	var cfgPath, master, token, localToken string
+	var dryRun bool
+	fs.StringVar(&cfgPath, "c", "", "")
+	fs.StringVar(&cfgPath, "config", "", "")
+	fs.StringVar(&master, "master", "", "")
+	fs.StringVar(&token, "token", "", "")
+	fs.StringVar(&localToken, "local-token", "", "")
+	fs.Bool("once", true, "") // the default; kept for scripts
+	fs.BoolVar(&dryRun, "dry-run", false, "")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: namedot sync [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Pulls zones and templates from a master once into the namedot server\n")
+		fmt.Fprintf(os.Stderr, "running with this config, through its POST /sync/import (over HTTPS\n")
+		fmt.Fprintf(os.Stderr, "when tls_cert_file is set). The server must be running.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fmt.Fprintf(os.Stderr, "  -c, -config <file>        Path to config file (default: config.yaml)\n")
+		fmt.Fprintf(os.Stderr, "  -master <url>             Master URL (default: replication.master_url)\n")
+		fmt.Fprintf(os.Stderr, "  -token <token>            Master API token (default: replication.api_token)\n")
+		fmt.Fprintf(os.Stderr, "  -local-token <token>      API token of the local server (default: api_token)\n")
+		fmt.Fprintf(os.Stderr, "  -dry-run                  Fetch from the master and report without applying\n")
+	}
+	_ = fs.Parse(args)
+
+	cfg, err := config.Load(resolveConfigPath(cfgPath))
+	if err != nil {
+		log.Fatalf("load config: %v", err)
+	}
+	if master != "" {
+		cfg.Replication.MasterURL = master
+	}
+	if cfg.Replication.MasterURL == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if token != "" {
+		cfg.Replication.APIToken = token
+	}
+	if localToken != "" {
+		cfg.APIToken = localToken
+	}
+	client := replication.NewSyncClient(cfg, nil)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if dryRun {
+		data, err := client.FetchFromMaster(ctx)
+		if err != nil {
+			log.Fatalf("fetch from master: %v", err)
+		}
+		for _, z := range data.Zones {
+			fmt.Printf("  %-40s %d rrsets\n", z.Name, len(z.RRSets))
+		}
+		fmt.Printf("Master %s has %d zones and %d templates\n", cfg.Replication.MasterURL, len(data.Zones), len(data.Templates))
+		return
+	}
+	if err := client.SyncOnce(ctx); err != nil {
+		log.Fatalf("sync: %v", err)
+	}
+	st := client.Status()
+	fmt.Printf("Synced %d zones and %d templates from %s\n", st.Zones, st.Templates, cfg.Replication.MasterURL)
+}
+
+// runHosts dispatches "namedot hosts <action>" to manage static host overrides.
+func runHosts(args []string) {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "Usage: namedot hosts <action> [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Manages static host overrides, answered before any zone.\n\n")
+		fmt.Fprintf(os.Stderr, "Actions:\n")
+		fmt.Fprintf(os.Stderr, "  list                      List all entries\n")
+		fmt.Fprintf(os.Stderr, "  add <name> <address> [ttl]\n")
+		fmt.Fprintf(os.Stderr, "                            Add an A/AAAA entry (ttl 0 = default_ttl)\n")
+		fmt.Fprintf(os.Stderr, "  rm <name>                 Remove all entries for a name\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fmt.Fprintf(os.Stderr, "  -c, -config <file>        Path to config file (default: config.yaml)\n")
+		fmt.Fprintf(os.Stderr, "\nA running server picks up changes within 5 minutes.\n")
+	}
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+	fs := flag.NewFlagSet("hosts "+args[0], flag.ExitOnError)
+	var cfgPath string
+	fs.StringVar(&cfgPath, "c", "", "")
+	fs.StringVar(&cfgPath, "config", "", "")
+	fs.Usage = usage
+	_ = fs.Parse(args[1:])
+	rest := fs.Args()
+
+	switch {
+	case args[0] == "list" && len(rest) == 0:
+		_, gormDB := openConfiguredDB(cfgPath)
+		hosts, err := db.ListHosts(gormDB)
+		if err != nil {
+			log.Fatalf("list hosts: %v", err)
+		}
+		for _, h := range hosts {
+			fmt.Printf("%-40s %-5s %-40s %d\n", h.Name, h.Type(), h.Address, h.TTL)
+		}
+	case args[0] == "add" && (len(rest) == 2 || len(rest) == 3):
+		h := db.Host{Name: rest[0], Address: rest[1]}
+		if len(rest) == 3 {
+			ttl, err := strconv.ParseUint(rest[2], 10, 32)
+			if err != nil {
+				log.Fatalf("invalid ttl: %s", rest[2])
+			}
+			h.TTL = uint32(ttl)
+		}
+		_, gormDB := openConfiguredDB(cfgPath)
+		h, err := db.AddHost(gormDB, h)
+		if err != nil {
+			log.Fatalf("add host: %v", err)
+		}
+		recordHostAudit(gormDB, db.AuditHostCreate, h)
+		fmt.Printf("Added %s %s %s\n", h.Name, h.Type(), h.Address)
+	case args[0] == "rm" && len(rest) == 1:
+		_, gormDB := openConfiguredDB(cfgPath)
+		n, err := db.DeleteHostsByName(gormDB, rest[0])
+		if err != nil {
+			log.Fatalf("remove host: %v", err)
+		}
+		if n > 0 {
+			recordHostAudit(gormDB, db.AuditHostDelete, db.Host{Name: rest[0]})
+		}
+		fmt.Printf("Removed %d entries\n", n)
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+// recordHostAudit logs a hosts change made from the command line.
+func recordHostAudit(gormDB *gorm.DB, action string, h db.Host) {
+	summary := h.Name
+	if h.Address != "" {
+		summary = fmt.Sprintf("%s %s %s", h.Name, h.Type(), h.Address)
+	}
+	if err := db.RecordAudit(gormDB, db.AuditEntry{Actor: db.AuditActorCLI, Action: action, Summary: summary}); err != nil {
+		log.Printf("audit %s: %v", action, err)
+	}
+}
+
+// runSelftest boots a throwaway instance and checks it end to end, to verify
+// an install without touching its config or database.
+func runSelftest(args []string) {
+	fs := flag.NewFlagSet("selftest", flag.ExitOnError)
+	var verbose bool
+	fs.BoolVar(&verbose, "v", false, "")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: namedot selftest [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Boots a throwaway instance (in-memory database, DNS and REST API on\n")
+		fmt.Fprintf(os.Stderr, "loopback ports), creates a zone and records through the API, queries\n")
+		fmt.Fprintf(os.Stderr, "them over UDP and TCP, checks subnet geo selection via ECS and exits\n")
+		fmt.Fprintf(os.Stderr, "non-zero unless every check passes.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fmt.Fprintf(os.Stderr, "  -v                        Show the server log\n")
+	}
+	_ = fs.Parse(args)
+
+	if !verbose {
+		log.SetOutput(io.Discard)
+		gin.DefaultWriter = io.Discard
+	}
+	report := selftest.Run()
+	_, _ = report.WriteTo(os.Stdout)
+	if !report.OK() {
+		os.Exit(1)
+	}
+}
+
+// runRotate returns the handler of "namedot token rotate" or "namedot
+// password rotate", which replace the main API token or an admin password
+// with a random one, printed once. The old secret keeps working for the
+// grace period.
+func runRotate(kind string) func(args []string) {
+	cmd, what := "token", "the main REST API token"
+	if kind == db.CredentialAdminPassword {
+		cmd, what = "password", "an admin user's password"
+	}
+	return func(args []string) {
+		fs := flag.NewFlagSet(cmd+" rotate", flag.ExitOnError)
+		var cfgPath, user string
+		var grace time.Duration
+		fs.StringVar(&cfgPath, "c", "", "")
+		fs.StringVar(&cfgPath, "config", "", "")
+		fs.DurationVar(&grace, "grace", db.DefaultCredentialGrace, "")
+		if kind == db.CredentialAdminPassword {
+			fs.StringVar(&user, "user", "", "")
+		}
+		fs.Usage = func() {
+			fmt.Fprintf(os.Stderr, "Usage: namedot %s rotate [options]\n\n", cmd)
+			fmt.Fprintf(os.Stderr, "Replaces %s with a new random one, stored as a\n", what)
+			fmt.Fprintf(os.Stderr, "bcrypt hash in the database and printed once. The old one keeps\n")
+			fmt.Fprintf(os.Stderr, "working for the grace period. A running server accepts the new one\n")
+			fmt.Fprintf(os.Stderr, "within 30 seconds.\n\n")
+			fmt.Fprintf(os.Stderr, "Options:\n")
+			fmt.Fprintf(os.Stderr, "  -c, -config <file>        Path to config file (default: config.yaml)\n")
+			if kind == db.CredentialAdminPassword {
+				fmt.Fprintf(os.Stderr, "  -user <name>              Admin user (default: admin.username)\n")
+			}
+			fmt.Fprintf(os.Stderr, "  -grace <duration>         How long the old one keeps working (default: 24h, 0 = not at all)\n")
+		}
+		if len(args) == 0 || args[0] != "rotate" {
+			fs.Usage()
+			os.Exit(2)
+		}
+		_ = fs.Parse(args[1:])
+		if grace < 0 || fs.NArg() > 0 {
+			fs.Usage()
+			os.Exit(2)
+		}
+
+		cfg, gormDB := openConfiguredDB(cfgPath)
+		var configHash, summary string
+		var err error
+		if kind == db.CredentialAdminPassword {
+			if user == "" {
+				user = cfg.Admin.Username
+			}
+			u, ok := cfg.Admin.User(user)
+			if !ok {
+				log.Fatalf("no admin user %q in the config", user)
+			}
+			configHash, summary = u.PasswordHash, "admin password of "+user
+		} else {
+			if configHash, err = db.APITokenHash(cfg); err != nil {
+				log.Fatalf("hash api_token: %v", err)
+			}
+			summary = "api token"
+		}
+		size := 32
+		if kind == db.CredentialAdminPassword {
+			size = 18 // 24 characters, to be typed
+		}
+		secret, err := db.NewSecret(size)
+		if err != nil {
+			log.Fatalf("generate %s: %v", cmd, err)
+		}
+		cred, err := db.RotateCredential(gormDB, kind, user, secret, configHash, grace)
+		if err != nil {
+			log.Fatalf("rotate %s: %v", cmd, err)
+		}
+		until := cred.CreatedAt.Add(grace)
+		summary = fmt.Sprintf("%s; old valid until %s", summary, until.UTC().Format(time.RFC3339))
+		if err := db.RecordAudit(gormDB, db.AuditEntry{Actor: db.AuditActorCLI, Action: db.AuditCredentialRotate, Summary: summary}); err != nil {
+			log.Printf("audit %s: %v", db.AuditCredentialRotate, err)
+		}
+		fmt.Println(secret)
+		fmt.Fprintf(os.Stderr, "New %s stored; the old one is valid until %s\n", cmd, until.Local().Format(time.RFC3339))
+	}
+}
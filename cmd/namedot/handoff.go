@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"namedot/internal/config"
+	"namedot/internal/handoff"
+	dnssrv "namedot/internal/server/dns"
+	restsrv "namedot/internal/server/rest"
+	"namedot/internal/systemd"
+)
+
+// handoffTimeout bounds how long the new process may take to start serving.
+const handoffTimeout = 30 * time.Second
+
+// handOver starts the namedot binary again with the DNS and REST sockets and
+// reports whether the new process took them over; the caller then drains
+// its in-flight requests and exits. On failure the old process keeps
+// serving.
+func handOver(cfg *config.Config, dnsServer *dnssrv.Server, restServer *restsrv.Server) bool {
+	if cfg.RunAs.Chroot != "" {
+		log.Printf("Handoff: not supported with run_as.chroot, restart instead")
+		return false
+	}
+	socks, err := serverSockets(dnsServer, restServer)
+	defer func() {
+		for _, s := range socks {
+			s.File.Close()
+		}
+	}()
+	if err != nil {
+		log.Printf("Handoff: %v", err)
+		return false
+	}
+	// The new process loads the cache file while starting
+	if cfg.Performance.CacheFile != "" {
+		if _, err := dnsServer.SaveCache(cfg.Performance.CacheFile); err != nil {
+			log.Printf("answer cache: save: %v", err)
+		}
+	}
+	log.Printf("Handoff: starting new process")
+	p, err := handoff.Start(socks, handoffTimeout)
+	if err != nil {
+		log.Printf("Handoff: %v, keeping the current process", err)
+		return false
+	}
+	if err := systemd.Notify(fmt.Sprintf("MAINPID=%d", p.Pid)); err != nil {
+		log.Printf("systemd notify: %v", err)
+	}
+	log.Printf("Handoff: pid %d took over the listeners", p.Pid)
+	_ = p.Release()
+	return true
+}
+
+type fileConn interface {
+	File() (*os.File, error)
+}
+
+// serverSockets duplicates the listening sockets of the servers, named the
+// way useActivatedSockets expects them.
+func serverSockets(dnsServer *dnssrv.Server, restServer *restsrv.Server) ([]systemd.Socket, error) {
+	pc, ln := dnsServer.Sockets()
+	var out []systemd.Socket
+	for _, c := range []struct {
+		name string
+		conn any
+	}{{"dns", pc}, {"dns", ln}, {"rest", restServer.Listener()}} {
+		if c.conn == nil {
+			continue
+		}
+		fc, ok := c.conn.(fileConn)
+		if !ok {
+			return out, fmt.Errorf("%s socket cannot be passed on", c.name)
+		}
+		f, err := fc.File()
+		if err != nil {
+			return out, fmt.Errorf("%s socket: %w", c.name, err)
+		}
+		out = append(out, systemd.Socket{Name: c.name, File: f})
+	}
+	return out, nil
+}
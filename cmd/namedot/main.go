@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
@@ -13,13 +15,15 @@ import (
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
-	"gorm.io/gorm"
 
 	"namedot/internal/config"
 	"namedot/internal/db"
-	"namedot/internal/replication"
-	dnssrv "namedot/internal/server/dns"
-	restsrv "namedot/internal/server/rest"
+	"namedot/internal/handoff"
+	"namedot/internal/metrics"
+	"namedot/internal/privdrop"
+	"namedot/internal/systemd"
+	"namedot/pkg/namedot"
+	"namedot/pkg/store"
 )
 
 // Build information set via -ldflags during build.
@@ -48,6 +52,14 @@ func main() {
 		os.Args = norm
 	}
 
+	// Dispatch subcommands ("namedot <command> [options]")
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			run(os.Args[2:])
+			return
+		}
+	}
+
 	var (
 		cfgPath    string
 		testOnly   bool
@@ -61,7 +73,17 @@ func main() {
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "namedot - GeoDNS server with master-slave replication\n\n")
-		fmt.Fprintf(os.Stderr, "Usage: namedot [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Usage: namedot [options]\n")
+		fmt.Fprintf(os.Stderr, "       namedot <command> [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Commands:\n")
+		fmt.Fprintf(os.Stderr, "  import-bind               Import all zones from a BIND named.conf\n")
+		fmt.Fprintf(os.Stderr, "  import-powerdns           Import zones from a PowerDNS SQL database\n")
+		fmt.Fprintf(os.Stderr, "  db vacuum                 Remove orphaned rows and vacuum the database\n")
+		fmt.Fprintf(os.Stderr, "  hosts list|add|rm         Manage static host overrides\n")
+		fmt.Fprintf(os.Stderr, "  sync                      Pull zones from a master into the running server\n")
+		fmt.Fprintf(os.Stderr, "  selftest                  Boot a throwaway instance and check it end to end\n")
+		fmt.Fprintf(os.Stderr, "  token rotate              Replace the API token, keeping the old one for a while\n")
+		fmt.Fprintf(os.Stderr, "  password rotate           Replace an admin password, keeping the old one for a while\n\n")
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		fmt.Fprintf(os.Stderr, "  -c, -config <file>        Path to config file (default: config.yaml)\n")
 		fmt.Fprintf(os.Stderr, "  -t, -test                 Validate config and exit\n")
@@ -84,6 +106,10 @@ func main() {
 		fmt.Fprintf(os.Stderr, "  namedot -import backup.json      Import zones from file (merge)\n")
 		fmt.Fprintf(os.Stderr, "  namedot -import backup.json -import-mode replace\n")
 		fmt.Fprintf(os.Stderr, "                                   Import zones (replace all)\n")
+		fmt.Fprintf(os.Stderr, "  namedot import-bind -named-conf /etc/bind/named.conf\n")
+		fmt.Fprintf(os.Stderr, "                                   Migrate zones from BIND\n")
+		fmt.Fprintf(os.Stderr, "  namedot sync -master https://ns1:8080 -once\n")
+		fmt.Fprintf(os.Stderr, "                                   Pull zones from a master now\n")
 		fmt.Fprintf(os.Stderr, "\nDocumentation: https://github.com/foxzi/namedot\n")
 	}
 
@@ -144,12 +170,7 @@ func main() {
 	}
 
 	// Determine config path precedence: -c/--config > env > default
-	if cfgPath == "" {
-		cfgPath = os.Getenv("SGDNS_CONFIG")
-	}
-	if cfgPath == "" {
-		cfgPath = "config.yaml"
-	}
+	cfgPath = resolveConfigPath(cfgPath)
 
 	cfg, err := config.Load(cfgPath)
 	if err != nil {
@@ -161,6 +182,12 @@ func main() {
 		return
 	}
 
+	if cfg.NodeID != "" {
+		log.SetPrefix("node=" + cfg.NodeID + " ")
+		log.SetFlags(log.Flags() | log.Lmsgprefix)
+		metrics.SetNode(cfg.NodeID)
+	}
+
 	gormDB, err := db.OpenWithDebug(cfg.DB, cfg.Log.SQLDebug)
 	if err != nil {
 		log.Fatalf("open db: %v", err)
@@ -169,10 +196,20 @@ func main() {
 		log.Fatalf("migrate db: %v", err)
 	}
 
+	// Reads for DNS lookups and exports go to the replica when configured
+	readDB := gormDB
+	if cfg.DB.HasReplica() {
+		readDB, err = db.OpenWithDebug(cfg.DB.Replica(), cfg.Log.SQLDebug)
+		if err != nil {
+			log.Fatalf("open replica db: %v", err)
+		}
+		log.Printf("Using read replica for DNS lookups and exports")
+	}
+
 	// Handle export command
 	if exportFile != "" {
 		fmt.Printf("Exporting zones to %s...\n", exportFile)
-		if err := db.ExportZones(gormDB, exportFile); err != nil {
+		if err := db.ExportZones(readDB, exportFile); err != nil {
 			log.Fatalf("export failed: %v", err)
 		}
 		var count int64
@@ -190,76 +227,86 @@ func main() {
 		if err := db.ImportZones(gormDB, importFile, importMode); err != nil {
 			log.Fatalf("import failed: %v", err)
 		}
-		ensureAllSOA(gormDB, cfg)
+		store.EnsureSOA(gormDB, cfg)
 		var count int64
 		gormDB.Model(&db.Zone{}).Count(&count)
 		fmt.Printf("Successfully imported zones. Total zones in database: %d\n", count)
 		return
 	}
 
-	// Ensure SOA exists/updated on startup when auto is enabled
-	ensureAllSOA(gormDB, cfg)
+	srv, err := namedot.New(cfg, namedot.WithDB(gormDB), namedot.WithReadDB(readDB), namedot.WithVersion(Version))
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	dnsServer, restServer := srv.DNS(), srv.REST()
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	dnsServer, err := dnssrv.NewServer(cfg, gormDB)
-	if err != nil {
-		log.Fatalf("dns server: %v", err)
+	useActivatedSockets(dnsServer, restServer)
+	if err := srv.Listen(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	// Everything that needs root is bound now
+	if err := privdrop.Drop(cfg.RunAs); err != nil {
+		log.Fatalf("run_as: %v", err)
+	}
+	if cfg.RunAs.User != "" || cfg.RunAs.Chroot != "" {
+		log.Printf("Running as uid %d gid %d%s", os.Getuid(), os.Getgid(), chrootNote(cfg.RunAs.Chroot))
 	}
-
-	restServer := restsrv.NewServer(cfg, gormDB, dnsServer)
-
-	go func() {
-		if err := dnsServer.Start(); err != nil {
-			log.Fatalf("dns start: %v", err)
-		}
-	}()
 
 	go func() {
-		if err := restServer.Start(); err != nil {
+		if err := srv.Serve(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Fatalf("rest start: %v", err)
 		}
 	}()
 
-	// Start replication sync worker for slave mode
-	if cfg.Replication.Mode == "slave" {
-		syncClient := replication.NewSyncClient(cfg, gormDB)
-		go func() {
-			// Wait a bit for REST server to start
-			time.Sleep(2 * time.Second)
-			syncClient.StartPeriodicSync(ctx)
-		}()
-		log.Printf("Slave mode enabled: syncing from %s every %d seconds",
-			cfg.Replication.MasterURL, cfg.Replication.SyncIntervalSec)
-	} else if cfg.Replication.Mode == "master" {
-		log.Println("Master mode enabled: ready to serve replication data")
+	// Under Type=notify, tell systemd DNS is serving and keep its watchdog fed
+	if err := systemd.Notify("READY=1"); err != nil {
+		log.Printf("systemd notify: %v", err)
+	}
+	// When started by handOver, let the previous process go
+	if err := handoff.Ready(); err != nil {
+		log.Printf("handoff: %v", err)
+	}
+	if wd := systemd.WatchdogInterval(); wd > 0 {
+		go systemd.RunWatchdog(ctx, wd, dnsServer.Ping)
+		log.Printf("systemd watchdog enabled: %s", wd)
 	}
 
-	// Graceful shutdown
+	// SIGUSR1 puts the API and admin panel into read-only mode, SIGUSR2
+	// leaves it; SIGHUP hands the sockets to a freshly started binary;
+	// SIGINT/SIGTERM shut down gracefully
 	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-	<-sigCh
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGHUP)
+	for sig := range sigCh {
+		if sig == syscall.SIGHUP {
+			if handOver(cfg, dnsServer, restServer) {
+				break
+			}
+			continue
+		}
+		if sig == syscall.SIGUSR1 {
+			restServer.SetReadOnly(true, "SIGUSR1")
+			continue
+		}
+		if sig == syscall.SIGUSR2 {
+			restServer.SetReadOnly(false, "")
+			continue
+		}
+		break
+	}
 	log.Println("Shutting down...")
+	_ = systemd.Notify("STOPPING=1")
 
 	shutdownCtx, shutdownCancel := context.WithTimeout(ctx, 5*time.Second)
 	defer shutdownCancel()
-
-	_ = restServer.Shutdown(shutdownCtx)
-	_ = dnsServer.Shutdown()
+	_ = srv.Shutdown(shutdownCtx)
 }
 
-// ensureAllSOA creates/updates SOA for all zones if auto is enabled.
-func ensureAllSOA(gormDB *gorm.DB, cfg *config.Config) {
-	if !(cfg.SOA.AutoOnMissing || cfg.AutoSOAOnMissing) {
-		return
-	}
-	var zones []db.Zone
-	if err := gormDB.Find(&zones).Error; err != nil {
-		log.Printf("SOA ensure: failed to load zones: %v", err)
-		return
-	}
-	for _, z := range zones {
-		db.BumpSOASerialAuto(gormDB, z, true, cfg.SOA.Primary, cfg.SOA.Hostmaster)
+func chrootNote(dir string) string {
+	if dir == "" {
+		return ""
 	}
+	return " in chroot " + dir
 }
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"log"
+	"net"
+
+	"namedot/internal/handoff"
+	dnssrv "namedot/internal/server/dns"
+	restsrv "namedot/internal/server/rest"
+	"namedot/internal/systemd"
+)
+
+// useActivatedSockets hands sockets passed by systemd, or by the process this
+// one replaces (see handOver), to the servers: the one named "rest"
+// (FileDescriptorName=rest) serves the API, the others serve DNS over UDP or
+// TCP. It reports whether any were passed.
+func useActivatedSockets(dnsServer *dnssrv.Server, restServer *restsrv.Server) bool {
+	from := "systemd"
+	socks := systemd.Listeners()
+	if len(socks) == 0 {
+		from = "previous process"
+		socks = handoff.Listeners()
+	}
+	if len(socks) == 0 {
+		return false
+	}
+	var (
+		pc     net.PacketConn
+		dnsTCP net.Listener
+	)
+	for _, s := range socks {
+		if s.Name == "rest" {
+			ln, err := net.FileListener(s.File)
+			if err != nil {
+				log.Fatalf("%s socket %s: %v", from, s.Name, err)
+			}
+			restServer.SetListener(ln)
+			log.Printf("REST API using socket from %s: %s", from, ln.Addr())
+			continue
+		}
+		if ln, err := net.FileListener(s.File); err == nil {
+			dnsTCP = ln
+			log.Printf("DNS TCP using socket from %s: %s", from, ln.Addr())
+			continue
+		}
+		c, err := net.FilePacketConn(s.File)
+		if err != nil {
+			log.Fatalf("%s socket %s: neither stream nor datagram: %v", from, s.Name, err)
+		}
+		pc = c
+		log.Printf("DNS UDP using socket from %s: %s", from, c.LocalAddr())
+	}
+	dnsServer.SetListeners(pc, dnsTCP)
+	return true
+}
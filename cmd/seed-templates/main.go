@@ -52,7 +52,7 @@ func seedMailServerTemplate(database *gorm.DB) {
 	}
 
 	// Clear existing records
-	database.Where("template_id = ?", template.ID).Delete(&db.TemplateRecord{})
+	database.Unscoped().Where("template_id = ?", template.ID).Delete(&db.TemplateRecord{})
 
 	records := []db.TemplateRecord{
 		{
@@ -113,7 +113,7 @@ func seedWebServerTemplate(database *gorm.DB) {
 	}
 
 	// Clear existing records
-	database.Where("template_id = ?", template.ID).Delete(&db.TemplateRecord{})
+	database.Unscoped().Where("template_id = ?", template.ID).Delete(&db.TemplateRecord{})
 
 	records := []db.TemplateRecord{
 		{
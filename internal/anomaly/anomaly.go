@@ -0,0 +1,182 @@
+// Package anomaly counts NXDOMAIN and SERVFAIL answers per zone and per
+// client and raises an alert when a count passes its threshold within a
+// window, to catch typo floods and random-subdomain attacks early.
+package anomaly
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"namedot/internal/config"
+	"namedot/internal/metrics"
+)
+
+// maxKeys bounds the zones and clients counted per window; further keys are
+// ignored until the window ends.
+const maxKeys = 100000
+
+const (
+	ScopeZone   = "zone"
+	ScopeClient = "client"
+)
+
+var alertsTotal = metrics.NewCounter("namedot_anomaly_alerts_total",
+	"NXDOMAIN/SERVFAIL alerts raised.", "scope", "rcode")
+
+// Alert describes one threshold crossing; it is logged and sent to
+// anomaly.webhook_url.
+type Alert struct {
+	Event     string    `json:"event"`
+	Scope     string    `json:"scope"` // zone | client
+	Key       string    `json:"key"`   // zone name or client address
+	RCode     string    `json:"rcode"`
+	Count     int       `json:"count"`
+	Threshold int       `json:"threshold"`
+	WindowSec int       `json:"window_sec"`
+	At        time.Time `json:"at"`
+}
+
+type counterKey struct {
+	scope string
+	key   string
+	rcode int
+}
+
+// Detector keeps the counters of the current window.
+type Detector struct {
+	cfg    config.AnomalyConfig
+	client *http.Client
+	now    func() time.Time
+
+	mu     sync.Mutex
+	start  time.Time
+	counts map[counterKey]int
+	last   map[counterKey]time.Time // last alert per key, for the cooldown
+}
+
+func New(cfg config.AnomalyConfig) *Detector {
+	return &Detector{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+		now:    time.Now,
+		counts: make(map[counterKey]int),
+		last:   make(map[counterKey]time.Time),
+	}
+}
+
+func (d *Detector) threshold(scope string, rcode int) int {
+	switch {
+	case scope == ScopeZone && rcode == dns.RcodeNameError:
+		return d.cfg.ZoneNXDOMAIN
+	case scope == ScopeZone && rcode == dns.RcodeServerFailure:
+		return d.cfg.ZoneSERVFAIL
+	case scope == ScopeClient && rcode == dns.RcodeNameError:
+		return d.cfg.ClientNXDOMAIN
+	case scope == ScopeClient && rcode == dns.RcodeServerFailure:
+		return d.cfg.ClientSERVFAIL
+	}
+	return 0
+}
+
+// Observe counts one answer for zone and client. Answers other than
+// NXDOMAIN and SERVFAIL are ignored. Safe for concurrent use.
+func (d *Detector) Observe(zone string, client netip.Addr, rcode int) {
+	if d == nil || (rcode != dns.RcodeNameError && rcode != dns.RcodeServerFailure) {
+		return
+	}
+	now := d.now()
+	var alerts []Alert
+	d.mu.Lock()
+	d.rotate(now)
+	if zone != "" {
+		if a, ok := d.count(counterKey{ScopeZone, zone, rcode}, now); ok {
+			alerts = append(alerts, a)
+		}
+	}
+	if client.IsValid() {
+		if a, ok := d.count(counterKey{ScopeClient, client.Unmap().String(), rcode}, now); ok {
+			alerts = append(alerts, a)
+		}
+	}
+	d.mu.Unlock()
+	for _, a := range alerts {
+		d.fire(a)
+	}
+}
+
+// rotate starts a new window once the current one is over. Cooldowns that
+// ran out are forgotten.
+func (d *Detector) rotate(now time.Time) {
+	window := time.Duration(d.cfg.WindowSec) * time.Second
+	if now.Sub(d.start) < window {
+		return
+	}
+	d.start = now
+	d.counts = make(map[counterKey]int, len(d.counts))
+	cooldown := time.Duration(d.cfg.CooldownSec) * time.Second
+	for k, t := range d.last {
+		if now.Sub(t) >= cooldown {
+			delete(d.last, k)
+		}
+	}
+}
+
+// count adds one to k and reports an alert when the count reaches the
+// threshold outside the cooldown of an earlier alert.
+func (d *Detector) count(k counterKey, now time.Time) (Alert, bool) {
+	limit := d.threshold(k.scope, k.rcode)
+	if limit <= 0 {
+		return Alert{}, false
+	}
+	n, ok := d.counts[k]
+	if !ok && len(d.counts) >= maxKeys {
+		return Alert{}, false
+	}
+	n++
+	d.counts[k] = n
+	if n != limit {
+		return Alert{}, false
+	}
+	if t, ok := d.last[k]; ok && now.Sub(t) < time.Duration(d.cfg.CooldownSec)*time.Second {
+		return Alert{}, false
+	}
+	d.last[k] = now
+	return Alert{
+		Event:     "dns_anomaly",
+		Scope:     k.scope,
+		Key:       k.key,
+		RCode:     dns.RcodeToString[k.rcode],
+		Count:     n,
+		Threshold: limit,
+		WindowSec: d.cfg.WindowSec,
+		At:        now,
+	}, true
+}
+
+func (d *Detector) fire(a Alert) {
+	log.Printf("DNS ANOMALY scope=%s key=%s rcode=%s count=%d window=%ds", a.Scope, a.Key, a.RCode, a.Count, a.WindowSec)
+	alertsTotal.Inc(a.Scope, a.RCode)
+	if d.cfg.WebhookURL != "" {
+		go d.notify(a)
+	}
+}
+
+func (d *Detector) notify(a Alert) {
+	body, _ := json.Marshal(a)
+	resp, err := d.client.Post(d.cfg.WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("anomaly: webhook: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("anomaly: webhook: %s returned %s", d.cfg.WebhookURL, resp.Status)
+	}
+}
@@ -0,0 +1,84 @@
+package anomaly
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"namedot/internal/config"
+)
+
+func TestDetector_ThresholdWindowCooldown(t *testing.T) {
+	got := make(chan Alert, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a Alert
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+			t.Errorf("decode webhook body: %v", err)
+		}
+		got <- a
+	}))
+	defer srv.Close()
+
+	d := New(config.AnomalyConfig{Enabled: true, WindowSec: 60, CooldownSec: 300, ZoneNXDOMAIN: 3, ClientSERVFAIL: 2, WebhookURL: srv.URL})
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+	client := netip.MustParseAddr("192.0.2.7")
+
+	// Other rcodes and thresholds that are off are ignored
+	d.Observe("example.com.", client, dns.RcodeSuccess)
+	d.Observe("example.com.", client, dns.RcodeNameError)
+	d.Observe("example.com.", client, dns.RcodeNameError)
+	select {
+	case a := <-got:
+		t.Fatalf("alert below threshold: %+v", a)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	d.Observe("example.com.", client, dns.RcodeNameError)
+	a := wait(t, got)
+	if a.Scope != ScopeZone || a.Key != "example.com." || a.RCode != "NXDOMAIN" || a.Count != 3 || a.Event != "dns_anomaly" {
+		t.Fatalf("unexpected alert: %+v", a)
+	}
+
+	d.Observe("", client, dns.RcodeServerFailure)
+	d.Observe("", client, dns.RcodeServerFailure)
+	if a := wait(t, got); a.Scope != ScopeClient || a.Key != "192.0.2.7" || a.RCode != "SERVFAIL" {
+		t.Fatalf("unexpected client alert: %+v", a)
+	}
+
+	// A new window inside the cooldown counts again but stays quiet
+	now = now.Add(2 * time.Minute)
+	for i := 0; i < 3; i++ {
+		d.Observe("example.com.", netip.Addr{}, dns.RcodeNameError)
+	}
+	select {
+	case a := <-got:
+		t.Fatalf("alert during cooldown: %+v", a)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// After the cooldown the zone alerts again
+	now = now.Add(10 * time.Minute)
+	for i := 0; i < 3; i++ {
+		d.Observe("example.com.", netip.Addr{}, dns.RcodeNameError)
+	}
+	if a := wait(t, got); a.Key != "example.com." {
+		t.Fatalf("unexpected alert after cooldown: %+v", a)
+	}
+}
+
+func wait(t *testing.T, ch <-chan Alert) Alert {
+	t.Helper()
+	select {
+	case a := <-ch:
+		return a
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook was not called")
+	}
+	return Alert{}
+}
@@ -0,0 +1,247 @@
+// Package blocklist rewrites queries for listed names before they are
+// forwarded: plain domain lists and Response Policy Zones (RPZ), read from
+// files or URLs and reloaded periodically.
+package blocklist
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"namedot/internal/config"
+	"namedot/internal/metrics"
+)
+
+// maxListSize caps a downloaded or read list.
+const maxListSize = 64 << 20
+
+var (
+	blockedTotal = metrics.NewCounter("namedot_blocklist_blocked_total",
+		"Queries rewritten by a blocklist rule.", "list", "action")
+	rulesGauge = metrics.NewGauge("namedot_blocklist_rules",
+		"Rules loaded per blocklist.", "list")
+	loadErrors = metrics.NewCounter("namedot_blocklist_load_errors_total",
+		"Failed blocklist loads; the previous rules are kept.", "list")
+)
+
+// Blocklist holds the rules of all configured lists.
+type Blocklist struct {
+	cfg    config.BlocklistConfig
+	exempt []netip.Prefix
+	sink4  netip.Addr
+	sink6  netip.Addr
+	client *http.Client
+
+	mu     sync.RWMutex
+	sets   map[string]*Set // by source name
+	merged *Set
+}
+
+// New prepares the lists of cfg; call Load to read them.
+func New(cfg config.BlocklistConfig) (*Blocklist, error) {
+	b := &Blocklist{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 60 * time.Second},
+		sets:   make(map[string]*Set),
+		merged: newSet(),
+	}
+	for _, c := range cfg.ExemptCIDRs {
+		p, err := netip.ParsePrefix(c)
+		if err != nil {
+			return nil, fmt.Errorf("exempt_cidrs: %w", err)
+		}
+		b.exempt = append(b.exempt, p.Masked())
+	}
+	var err error
+	if b.sink4, err = netip.ParseAddr(cfg.SinkholeIPv4); err != nil {
+		return nil, fmt.Errorf("sinkhole_ipv4: %w", err)
+	}
+	if b.sink6, err = netip.ParseAddr(cfg.SinkholeIPv6); err != nil {
+		return nil, fmt.Errorf("sinkhole_ipv6: %w", err)
+	}
+	return b, nil
+}
+
+// Load reads every list once. Lists that fail to load are logged and left
+// empty (or at their previous rules).
+func (b *Blocklist) Load() {
+	for _, src := range b.cfg.Sources {
+		b.loadSource(src)
+	}
+}
+
+// Run reloads each list every refresh_sec until ctx is done.
+func (b *Blocklist) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, src := range b.cfg.Sources {
+		if src.RefreshSec <= 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(src config.BlocklistSource) {
+			defer wg.Done()
+			ticker := time.NewTicker(time.Duration(src.RefreshSec) * time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					b.loadSource(src)
+				}
+			}
+		}(src)
+	}
+	wg.Wait()
+}
+
+func (b *Blocklist) loadSource(src config.BlocklistSource) {
+	set, err := b.fetch(src)
+	if err != nil {
+		loadErrors.Inc(src.Name)
+		log.Printf("blocklist %s: %v", src.Name, err)
+		return
+	}
+	rulesGauge.Set(float64(set.Len()), src.Name)
+	log.Printf("blocklist %s: %d rules loaded", src.Name, set.Len())
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sets[src.Name] = set
+	merged := newSet()
+	for _, s := range b.cfg.Sources {
+		if set := b.sets[s.Name]; set != nil {
+			merged.merge(set)
+		}
+	}
+	b.merged = merged
+}
+
+func (b *Blocklist) fetch(src config.BlocklistSource) (*Set, error) {
+	var data []byte
+	if src.URL != "" {
+		resp, err := b.client.Get(src.URL)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("download: %s", resp.Status)
+		}
+		if data, err = io.ReadAll(io.LimitReader(resp.Body, maxListSize+1)); err != nil {
+			return nil, err
+		}
+	} else {
+		f, err := os.Open(src.Path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if data, err = io.ReadAll(io.LimitReader(f, maxListSize+1)); err != nil {
+			return nil, err
+		}
+	}
+	if len(data) > maxListSize {
+		return nil, fmt.Errorf("list is larger than %d MiB", maxListSize>>20)
+	}
+	if src.Format == "rpz" {
+		return ParseRPZ(bytes.NewReader(data), "rpz.", src.Name)
+	}
+	return ParseDomains(bytes.NewReader(data), src.Name)
+}
+
+// Len returns the number of loaded rules over all lists.
+func (b *Blocklist) Len() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.merged.Len()
+}
+
+// Match returns the rule that applies to name for a client at ip. Exempt
+// clients and passthru rules never match.
+func (b *Blocklist) Match(name string, ip netip.Addr) (Rule, bool) {
+	if b == nil {
+		return Rule{}, false
+	}
+	if ip.IsValid() {
+		ip = ip.Unmap()
+		for _, p := range b.exempt {
+			if p.Contains(ip) {
+				return Rule{}, false
+			}
+		}
+	}
+	b.mu.RLock()
+	r, ok := b.merged.Match(name)
+	b.mu.RUnlock()
+	if !ok || r.Action == ActionPassthru {
+		return Rule{}, false
+	}
+	return r, true
+}
+
+// Respond fills m, a reply to q, according to r and returns the action
+// taken (nxdomain, nodata, sinkhole, local, refused or drop). A drop is
+// answered like refused; the caller is the one that sends nothing.
+func (b *Blocklist) Respond(m *dns.Msg, q dns.Question, r Rule) string {
+	action := r.Action
+	if action == ActionBlock {
+		action = b.cfg.Action
+	}
+
+	m.Authoritative = true
+	m.Answer = nil
+	switch action {
+	case ActionNXDomain:
+		m.Rcode = dns.RcodeNameError
+	case ActionNoData:
+	case "sinkhole":
+		m.Answer = b.answer(q, []netip.Addr{b.sink4, b.sink6})
+	case ActionLocal:
+		m.Answer = b.answer(q, r.Addrs)
+	case "refused", "drop":
+		m.Authoritative = false
+		m.Rcode = dns.RcodeRefused
+	}
+	return action
+}
+
+// Count adds a rewritten query to the metrics.
+func Count(source, action string) {
+	blockedTotal.Inc(source, action)
+}
+
+// answer returns the addresses of the queried family as records; other
+// query types get an empty answer.
+func (b *Blocklist) answer(q dns.Question, addrs []netip.Addr) []dns.RR {
+	var out []dns.RR
+	hdr := dns.RR_Header{Name: q.Name, Rrtype: q.Qtype, Class: dns.ClassINET, Ttl: b.cfg.TTL}
+	for _, a := range addrs {
+		switch {
+		case q.Qtype == dns.TypeA && a.Is4():
+			out = append(out, &dns.A{Hdr: hdr, A: a.AsSlice()})
+		case q.Qtype == dns.TypeAAAA && a.Is6():
+			out = append(out, &dns.AAAA{Hdr: hdr, AAAA: a.AsSlice()})
+		}
+	}
+	return out
+}
+
+// Describe summarizes the configured action for logs.
+func (b *Blocklist) Describe() string {
+	names := make([]string, 0, len(b.cfg.Sources))
+	for _, s := range b.cfg.Sources {
+		names = append(names, s.Name)
+	}
+	return fmt.Sprintf("%s (%s)", strings.Join(names, ", "), b.cfg.Action)
+}
@@ -0,0 +1,160 @@
+package blocklist
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	"namedot/internal/config"
+)
+
+func TestParseDomains(t *testing.T) {
+	list := `# comment
+ads.example.com
+0.0.0.0 tracker.example.net other.example.org # inline comment
+127.0.0.1 localhost
+! adblock-style comment
+not a domain!
+*.wild.example
+`
+	set, err := ParseDomains(strings.NewReader(list), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"ads.example.com", "x.ads.example.com.", "tracker.example.net.", "other.example.org.", "wild.example.", "a.b.wild.example."} {
+		if r, ok := set.Match(name); !ok || r.Action != ActionBlock || r.Source != "test" {
+			t.Errorf("%s: want block, got %+v %v", name, r, ok)
+		}
+	}
+	for _, name := range []string{"example.com.", "localhost.", "notads.example.com."} {
+		if _, ok := set.Match(name); ok {
+			t.Errorf("%s should not match", name)
+		}
+	}
+}
+
+func TestParseRPZ(t *testing.T) {
+	zone := `$TTL 300
+@ IN SOA localhost. root.localhost. 1 3600 600 86400 300
+  IN NS localhost.
+bad.example.com      CNAME .
+*.bad.example.com    CNAME .
+empty.example.com    CNAME *.
+ok.bad.example.com   CNAME rpz-passthru.
+drop.example.com     CNAME rpz-drop.
+local.example.com    A 10.0.0.1
+local.example.com    AAAA fd00::1
+redirect.example.com CNAME walled.garden.example.
+32.1.0.0.10.rpz-ip   CNAME .
+`
+	set, err := ParseRPZ(strings.NewReader(zone), "rpz.local.", "policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"bad.example.com.":     ActionNXDomain,
+		"x.bad.example.com.":   ActionNXDomain,
+		"empty.example.com.":   ActionNoData,
+		"ok.bad.example.com.":  ActionPassthru,
+		"drop.example.com.":    ActionBlock,
+		"local.example.com.":   ActionLocal,
+		"redirect.example.com": "",
+		"x.empty.example.com.": "",
+	}
+	for name, want := range tests {
+		r, ok := set.Match(name)
+		if want == "" {
+			if ok {
+				t.Errorf("%s: want no match, got %+v", name, r)
+			}
+			continue
+		}
+		if !ok || r.Action != want {
+			t.Errorf("%s: want %s, got %+v", name, want, r)
+		}
+	}
+	if r, _ := set.Match("local.example.com."); len(r.Addrs) != 2 {
+		t.Errorf("local data: %+v", r.Addrs)
+	}
+	if set.Len() != 6 {
+		t.Errorf("want 6 rules, got %d", set.Len())
+	}
+}
+
+func TestBlocklist_MatchAndRespond(t *testing.T) {
+	dir := t.TempDir()
+	allow := filepath.Join(dir, "allow.rpz")
+	os.WriteFile(allow, []byte("$ORIGIN allow.rpz.\n@ SOA a. b. 1 1 1 1 1\nok.ads.example CNAME rpz-passthru.\n"), 0o644)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ads.example\n"))
+	}))
+	defer srv.Close()
+
+	cfg := config.BlocklistConfig{
+		Action: "sinkhole", SinkholeIPv4: "0.0.0.0", SinkholeIPv6: "::", TTL: 60,
+		ExemptCIDRs: []string{"10.0.0.0/8"},
+		Sources: []config.BlocklistSource{
+			{Name: "allow", Path: allow, Format: "rpz"},
+			{Name: "ads", URL: srv.URL, Format: "domains"},
+			{Name: "missing", Path: filepath.Join(dir, "nope")},
+		},
+	}
+	b, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Load()
+	if b.Len() != 3 {
+		t.Fatalf("want 3 rules, got %d", b.Len())
+	}
+
+	client := netip.MustParseAddr("192.0.2.1")
+	if _, ok := b.Match("ok.ads.example.", client); ok {
+		t.Error("passthru in an earlier list must win")
+	}
+	if _, ok := b.Match("x.ads.example.", netip.MustParseAddr("10.1.2.3")); ok {
+		t.Error("exempt client was blocked")
+	}
+	r, ok := b.Match("x.ads.example.", client)
+	if !ok || r.Source != "ads" {
+		t.Fatalf("want block by ads, got %+v %v", r, ok)
+	}
+
+	for qtype, want := range map[uint16]string{dns.TypeA: "0.0.0.0", dns.TypeAAAA: "::", dns.TypeMX: ""} {
+		q := dns.Question{Name: "x.ads.example.", Qtype: qtype, Qclass: dns.ClassINET}
+		m := new(dns.Msg)
+		if action := b.Respond(m, q, r); action != "sinkhole" || m.Rcode != dns.RcodeSuccess {
+			t.Fatalf("action %s rcode %d", action, m.Rcode)
+		}
+		if want == "" {
+			if len(m.Answer) != 0 {
+				t.Errorf("MX: want empty answer, got %v", m.Answer)
+			}
+			continue
+		}
+		if len(m.Answer) != 1 || !strings.HasSuffix(m.Answer[0].String(), want) || m.Answer[0].Header().Ttl != 60 {
+			t.Errorf("%s: got %v", dns.TypeToString[qtype], m.Answer)
+		}
+	}
+
+	for _, action := range []string{"refused", "drop"} {
+		b.cfg.Action = action
+		m := new(dns.Msg)
+		if got := b.Respond(m, dns.Question{Name: "x.ads.example.", Qtype: dns.TypeA, Qclass: dns.ClassINET}, r); got != action || m.Rcode != dns.RcodeRefused || len(m.Answer) != 0 {
+			t.Errorf("%s: action %s rcode %d answers %v", action, got, m.Rcode, m.Answer)
+		}
+	}
+
+	before := blockedTotal.Value("ads", "sinkhole")
+	Count("ads", "sinkhole")
+	if blockedTotal.Value("ads", "sinkhole") != before+1 || loadErrors.Value("missing") == 0 || rulesGauge.Value("ads") != 2 {
+		t.Error("metrics not updated")
+	}
+}
@@ -0,0 +1,200 @@
+package blocklist
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Actions of a rule.
+const (
+	ActionBlock    = "block"    // the configured blocklist.action (nxdomain or sinkhole)
+	ActionNXDomain = "nxdomain" // RPZ "CNAME ."
+	ActionNoData   = "nodata"   // RPZ "CNAME *."
+	ActionPassthru = "passthru" // RPZ "CNAME rpz-passthru.": never blocked
+	ActionLocal    = "local"    // RPZ A/AAAA data: answer with these addresses
+)
+
+// Rule says what to do with a matching name.
+type Rule struct {
+	Source string // name of the list the rule came from
+	Action string
+	Addrs  []netip.Addr // ActionLocal only
+}
+
+// Set is a parsed blocklist. Exact rules match one name; wildcard rules
+// match every name below theirs.
+type Set struct {
+	exact    map[string]Rule
+	wildcard map[string]Rule
+}
+
+func newSet() *Set {
+	return &Set{exact: make(map[string]Rule), wildcard: make(map[string]Rule)}
+}
+
+// Len returns the number of rules.
+func (s *Set) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.exact) + len(s.wildcard)
+}
+
+// Match returns the rule for name (an FQDN): an exact rule if there is one,
+// otherwise the wildcard rule of the closest enclosing name.
+func (s *Set) Match(name string) (Rule, bool) {
+	if s == nil {
+		return Rule{}, false
+	}
+	name = strings.ToLower(dns.Fqdn(name))
+	if r, ok := s.exact[name]; ok {
+		return r, true
+	}
+	for off, end := dns.NextLabel(name, 0); !end; off, end = dns.NextLabel(name, off) {
+		if r, ok := s.wildcard[name[off:]]; ok {
+			return r, true
+		}
+	}
+	return Rule{}, false
+}
+
+// merge adds the rules of o that s does not have yet, so earlier lists win.
+func (s *Set) merge(o *Set) {
+	for k, r := range o.exact {
+		if _, ok := s.exact[k]; !ok {
+			s.exact[k] = r
+		}
+	}
+	for k, r := range o.wildcard {
+		if _, ok := s.wildcard[k]; !ok {
+			s.wildcard[k] = r
+		}
+	}
+}
+
+// ParseDomains reads a plain list: one domain per line, or hosts-file lines
+// ("0.0.0.0 ads.example.com"). A domain blocks itself and all names below
+// it. Blank lines and lines starting with '#' or '!' are skipped, as are
+// entries that are not valid domain names.
+func ParseDomains(r io.Reader, source string) (*Set, error) {
+	set := newSet()
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := sc.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "!") {
+			continue
+		}
+		name := fields[0]
+		if _, err := netip.ParseAddr(name); err == nil {
+			// hosts-file format; "0.0.0.0 a.example b.example" lists several
+			for _, n := range fields[1:] {
+				set.addDomain(n, source)
+			}
+			continue
+		}
+		set.addDomain(name, source)
+	}
+	return set, sc.Err()
+}
+
+func (s *Set) addDomain(name, source string) {
+	name = strings.ToLower(strings.TrimPrefix(name, "*."))
+	switch name {
+	case "", "localhost", "localhost.localdomain", "local", "broadcasthost", "0.0.0.0":
+		return
+	}
+	name = dns.Fqdn(name)
+	if _, ok := dns.IsDomainName(name); !ok {
+		return
+	}
+	r := Rule{Source: source, Action: ActionBlock}
+	s.exact[name] = r
+	s.wildcard[name] = r
+}
+
+// ParseRPZ reads a Response Policy Zone in zone-file format. Only QNAME
+// triggers are supported; owner names are taken relative to the zone origin
+// ($ORIGIN, or origin when the file has none). Records with other triggers
+// (rpz-ip, rpz-nsdname, ...) and policies other than NXDOMAIN, NODATA,
+// PASSTHRU, DROP (treated as a block) and local A/AAAA data are skipped.
+func ParseRPZ(r io.Reader, origin, source string) (*Set, error) {
+	set := newSet()
+	origin = dns.Fqdn(strings.ToLower(origin))
+	zp := dns.NewZoneParser(r, origin, source)
+	zp.SetIncludeAllowed(false)
+	// The TTL of policy records does not matter; do not fail on a missing $TTL
+	zp.SetDefaultTTL(3600)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		owner := strings.ToLower(rr.Header().Name)
+		// $ORIGIN may differ from origin; find the policy zone suffix by its SOA
+		if soa, isSOA := rr.(*dns.SOA); isSOA {
+			origin = strings.ToLower(soa.Hdr.Name)
+			continue
+		}
+		if owner == origin || !dns.IsSubDomain(origin, owner) {
+			continue
+		}
+		name := strings.TrimSuffix(owner, origin)
+		if strings.Contains(name, ".rpz-") || strings.HasPrefix(name, "rpz-") {
+			continue
+		}
+		var rule Rule
+		switch v := rr.(type) {
+		case *dns.CNAME:
+			switch strings.ToLower(v.Target) {
+			case ".":
+				rule.Action = ActionNXDomain
+			case "*.":
+				rule.Action = ActionNoData
+			case "rpz-passthru.":
+				rule.Action = ActionPassthru
+			case "rpz-drop.", "rpz-tcp-only.":
+				rule.Action = ActionBlock
+			default:
+				continue
+			}
+		case *dns.A:
+			rule.Action = ActionLocal
+			rule.Addrs = []netip.Addr{addrOf(v.A.String())}
+		case *dns.AAAA:
+			rule.Action = ActionLocal
+			rule.Addrs = []netip.Addr{addrOf(v.AAAA.String())}
+		default:
+			continue
+		}
+		rule.Source = source
+
+		target := set.exact
+		if strings.HasPrefix(name, "*.") {
+			target, name = set.wildcard, name[2:]
+		}
+		name = dns.Fqdn(name)
+		if cur, ok := target[name]; ok && cur.Action == ActionLocal && rule.Action == ActionLocal {
+			cur.Addrs = append(cur.Addrs, rule.Addrs...)
+			target[name] = cur
+			continue
+		}
+		if _, ok := target[name]; !ok {
+			target[name] = rule
+		}
+	}
+	if err := zp.Err(); err != nil {
+		return nil, fmt.Errorf("rpz: %w", err)
+	}
+	return set, nil
+}
+
+func addrOf(s string) netip.Addr {
+	a, _ := netip.ParseAddr(s)
+	return a.Unmap()
+}
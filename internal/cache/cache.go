@@ -7,6 +7,7 @@ import (
 
 type item struct {
     value      any
+    storedAt   time.Time
     expiresAt  time.Time
 }
 
@@ -21,6 +22,12 @@ func New(size int) *Cache {
 }
 
 func (c *Cache) Set(key string, value any, ttl time.Duration) {
+    now := time.Now()
+    c.SetAt(key, value, now, now.Add(ttl))
+}
+
+// SetAt stores value as if it had been stored at storedAt, until expiresAt.
+func (c *Cache) SetAt(key string, value any, storedAt, expiresAt time.Time) {
     c.mu.Lock()
     defer c.mu.Unlock()
     if len(c.data) >= c.size {
@@ -30,22 +37,55 @@ func (c *Cache) Set(key string, value any, ttl time.Duration) {
             break
         }
     }
-    c.data[key] = item{value: value, expiresAt: time.Now().Add(ttl)}
+    c.data[key] = item{value: value, storedAt: storedAt, expiresAt: expiresAt}
 }
 
 func (c *Cache) Get(key string) (any, bool) {
+    v, _, ok := c.GetWithAge(key)
+    return v, ok
+}
+
+// GetWithAge is Get that also returns how long ago the value was stored.
+func (c *Cache) GetWithAge(key string) (any, time.Duration, bool) {
     c.mu.RLock()
     it, ok := c.data[key]
     c.mu.RUnlock()
     if !ok {
-        return nil, false
+        return nil, 0, false
     }
-    if time.Now().After(it.expiresAt) {
+    now := time.Now()
+    if now.After(it.expiresAt) {
         c.mu.Lock()
         delete(c.data, key)
         c.mu.Unlock()
-        return nil, false
+        return nil, 0, false
+    }
+    return it.value, now.Sub(it.storedAt), true
+}
+
+
+// SetUntil stores value until expiresAt; used to restore entries with the
+// lifetime they had.
+func (c *Cache) SetUntil(key string, value any, expiresAt time.Time) {
+    if !time.Now().Before(expiresAt) {
+        return
     }
-    return it.value, true
+    c.SetAt(key, value, time.Now(), expiresAt)
+}
+
+// Range calls fn for every entry that has not expired yet.
+func (c *Cache) Range(fn func(key string, value any, expiresAt time.Time)) {
+    c.RangeEntries(func(key string, value any, _, expiresAt time.Time) { fn(key, value, expiresAt) })
 }
 
+// RangeEntries is Range that also passes when each entry was stored.
+func (c *Cache) RangeEntries(fn func(key string, value any, storedAt, expiresAt time.Time)) {
+    now := time.Now()
+    c.mu.RLock()
+    defer c.mu.RUnlock()
+    for k, it := range c.data {
+        if now.Before(it.expiresAt) {
+            fn(k, it.value, it.storedAt, it.expiresAt)
+        }
+    }
+}
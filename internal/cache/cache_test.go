@@ -392,3 +392,27 @@ func BenchmarkCache_GetParallel(b *testing.B) {
 		}
 	})
 }
+
+func TestCache_RangeAndSetUntil(t *testing.T) {
+	c := New(10)
+	c.Set("live", "a", time.Hour)
+	c.Set("gone", "b", -time.Second)
+
+	seen := map[string]time.Time{}
+	c.Range(func(key string, value any, expiresAt time.Time) {
+		seen[key] = expiresAt
+	})
+	if len(seen) != 1 || seen["live"].IsZero() {
+		t.Fatalf("expected only the live entry, got %v", seen)
+	}
+
+	r := New(10)
+	r.SetUntil("live", "a", seen["live"])
+	r.SetUntil("old", "c", time.Now().Add(-time.Minute))
+	if v, ok := r.Get("live"); !ok || v != "a" {
+		t.Errorf("expected restored entry, got %v %v", v, ok)
+	}
+	if _, ok := r.Get("old"); ok {
+		t.Error("expired entry should not be restored")
+	}
+}
@@ -1,18 +1,43 @@
 package config
 
 import (
+	"encoding/base64"
 	"fmt"
 	"net"
+	"net/netip"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 type DBConfig struct {
-	Driver string `yaml:"driver"`
-	DSN    string `yaml:"dsn"`
+	Driver             string `yaml:"driver"`
+	DSN                string `yaml:"dsn"`
+	MaxOpenConns       int    `yaml:"max_open_conns"`        // 0 = unlimited
+	MaxIdleConns       int    `yaml:"max_idle_conns"`        // 0 = database/sql default (2)
+	ConnMaxLifetimeSec int    `yaml:"conn_max_lifetime_sec"` // 0 = connections are reused forever
+	ConnectRetrySec    int    `yaml:"connect_retry_sec"`     // Keep retrying the initial connection for this long (default: 30; -1 = fail immediately)
+	ReplicaDSN         string `yaml:"replica_dsn"`           // Optional read-only replica (same driver) for DNS lookups and exports
+	MaintenanceSec     int    `yaml:"maintenance_sec"`       // Run orphan cleanup and vacuum every N seconds (0 = disabled)
+}
+
+// HasReplica returns true if a read replica is configured
+func (c DBConfig) HasReplica() bool {
+	return c.ReplicaDSN != ""
+}
+
+// Replica returns the connection settings for the read replica.
+func (c DBConfig) Replica() DBConfig {
+	r := c
+	r.DSN = c.ReplicaDSN
+	r.ReplicaDSN = ""
+	return r
 }
 
 type GeoIPConfig struct {
@@ -25,20 +50,87 @@ type GeoIPConfig struct {
 }
 
 type LogConfig struct {
-	DNSVerbose bool `yaml:"dns_verbose"`
-	SQLDebug   bool `yaml:"sql_debug"`
+	DNSVerbose bool         `yaml:"dns_verbose"`
+	SQLDebug   bool         `yaml:"sql_debug"`
+	Dnstap     DnstapConfig `yaml:"dnstap"`
+}
+
+// DnstapConfig sends every DNS query and response as a dnstap frame to a
+// collector on a unix socket.
+type DnstapConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	Socket   string `yaml:"socket"`   // Unix socket the collector listens on
+	Identity string `yaml:"identity"` // Server name in the frames (default: node_id, else the host name)
 }
 
 type PerformanceConfig struct {
 	CacheSize           int `yaml:"cache_size"`
 	DNSTimeoutSec       int `yaml:"dns_timeout_sec"`
 	ForwarderTimeoutSec int `yaml:"forwarder_timeout_sec"`
+	// TTL floor and cap for forwarded answers (0 = no bound); ClampLocal
+	// applies them to answers from local zones and the hosts table too.
+	MinTTL     uint32 `yaml:"min_ttl"`
+	MaxTTL     uint32 `yaml:"max_ttl"`
+	ClampLocal bool   `yaml:"clamp_local"`
+	// Forwarder0x20 sends forwarded query names in random case and drops
+	// replies that do not echo it.
+	Forwarder0x20 bool `yaml:"forwarder_0x20"`
+	// CacheFile keeps the answer cache across restarts: it is written on
+	// shutdown and loaded at startup (empty = off).
+	CacheFile string `yaml:"cache_file"`
+	// CacheTTLJitter lowers the TTLs of cached answers by up to this
+	// percentage at random, on top of their age in the cache (0-50, 0 = off)
+	CacheTTLJitter int `yaml:"cache_ttl_jitter"`
+	// NoCache lists names whose answers are never cached, each with
+	// everything below it, e.g. very dynamic or health-checked records
+	NoCache []string `yaml:"no_cache"`
+}
+
+// EDNSConfig is the EDNS(0) policy for DNS responses.
+type EDNSConfig struct {
+	UDPSize      int  `yaml:"udp_size"`      // Largest UDP response, advertised in the OPT record (default: 1232)
+	Padding      bool `yaml:"padding"`       // Pad TCP responses to queries that carry the padding option (RFC 7830)
+	PaddingBlock int  `yaml:"padding_block"` // Padded responses are a multiple of this many bytes (default: 468, RFC 8467)
 }
 
 type AdminConfig struct {
-	Enabled      bool   `yaml:"enabled"`
+	Enabled      bool        `yaml:"enabled"`
+	Username     string      `yaml:"username"`
+	PasswordHash string      `yaml:"password_hash"` // bcrypt hash
+	Users        []AdminUser `yaml:"users"`         // additional users, e.g. read-only viewers
+}
+
+// Admin user roles. Viewers see every page of the admin but cannot change
+// anything.
+const (
+	RoleAdmin  = "admin"
+	RoleViewer = "viewer"
+)
+
+type AdminUser struct {
 	Username     string `yaml:"username"`
 	PasswordHash string `yaml:"password_hash"` // bcrypt hash
+	Role         string `yaml:"role"`          // "admin" (default) or "viewer"
+}
+
+// User returns the admin user called username. The user from username and
+// password_hash always has the admin role.
+func (a AdminConfig) User(username string) (AdminUser, bool) {
+	if username == "" {
+		return AdminUser{}, false
+	}
+	if username == a.Username {
+		return AdminUser{Username: a.Username, PasswordHash: a.PasswordHash, Role: RoleAdmin}, true
+	}
+	for _, u := range a.Users {
+		if u.Username == username {
+			if u.Role == "" {
+				u.Role = RoleAdmin
+			}
+			return u, true
+		}
+	}
+	return AdminUser{}, false
 }
 
 type ReplicationConfig struct {
@@ -46,6 +138,120 @@ type ReplicationConfig struct {
 	MasterURL       string `yaml:"master_url"`        // URL of master server (for slave mode)
 	SyncIntervalSec int    `yaml:"sync_interval_sec"` // Sync interval in seconds (for slave mode)
 	APIToken        string `yaml:"api_token"`         // API token for master authentication
+
+	BandwidthKbit int      `yaml:"bandwidth_kbit"` // Cap on the download from the master in kilobits per second (0 = unlimited)
+	SyncWindows   []string `yaml:"sync_windows"`   // Local time windows for scheduled syncs, e.g. "mon-fri 19:00-07:00" (empty = any time)
+
+	Notify     []string `yaml:"notify"`      // DNS addresses (IP or IP:port) of slaves sent a NOTIFY when a zone changes
+	NotifyFrom []string `yaml:"notify_from"` // Slave: CIDRs whose NOTIFY starts a sync (empty = the master_url host)
+}
+
+// SyncAllowed reports whether a scheduled sync may run at t: always without
+// sync_windows, else when t falls in one of them.
+func (r ReplicationConfig) SyncAllowed(t time.Time) bool {
+	if len(r.SyncWindows) == 0 {
+		return true
+	}
+	for _, s := range r.SyncWindows {
+		if w, err := ParseSyncWindow(s); err == nil && w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// NotifyAddr returns a NOTIFY target, an IP or IP:port, as IP:port with
+// port 53 by default.
+func NotifyAddr(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if a, err := netip.ParseAddr(s); err == nil {
+		return netip.AddrPortFrom(a.Unmap(), 53).String(), nil
+	}
+	ap, err := netip.ParseAddrPort(s)
+	if err != nil || ap.Port() == 0 {
+		return "", fmt.Errorf("%q must be an IP or IP:port", s)
+	}
+	return netip.AddrPortFrom(ap.Addr().Unmap(), ap.Port()).String(), nil
+}
+
+// SyncWindow is a daily time range, optionally limited to some weekdays. A
+// range ending before it starts runs past midnight into the next day.
+type SyncWindow struct {
+	Days       [7]bool // by time.Weekday the window starts on; none set = every day
+	Start, End int     // minutes since midnight, End up to 24:00
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseSyncWindow reads "[days ]HH:MM-HH:MM", where days is a comma list of
+// weekdays or ranges such as "mon-fri" or "sat,sun".
+func ParseSyncWindow(s string) (SyncWindow, error) {
+	var w SyncWindow
+	fields := strings.Fields(strings.ToLower(s))
+	if len(fields) == 0 || len(fields) > 2 {
+		return w, fmt.Errorf("%q: want \"[days ]HH:MM-HH:MM\"", s)
+	}
+	if len(fields) == 2 {
+		for _, part := range strings.Split(fields[0], ",") {
+			from, to, isRange := strings.Cut(part, "-")
+			first, ok1 := weekdays[from]
+			last, ok2 := weekdays[to]
+			if !isRange {
+				last, ok2 = first, ok1
+			}
+			if !ok1 || !ok2 {
+				return w, fmt.Errorf("%q: unknown weekday in %q", s, part)
+			}
+			for d := first; ; d = (d + 1) % 7 {
+				w.Days[d] = true
+				if d == last {
+					break
+				}
+			}
+		}
+	}
+	from, to, ok := strings.Cut(fields[len(fields)-1], "-")
+	if !ok {
+		return w, fmt.Errorf("%q: want \"[days ]HH:MM-HH:MM\"", s)
+	}
+	var err error
+	if w.Start, err = parseClock(from); err != nil || w.Start == 24*60 {
+		return w, fmt.Errorf("%q: bad start time %q", s, from)
+	}
+	if w.End, err = parseClock(to); err != nil {
+		return w, fmt.Errorf("%q: bad end time %q", s, to)
+	}
+	if w.Start == w.End {
+		return w, fmt.Errorf("%q: window is empty", s)
+	}
+	return w, nil
+}
+
+// parseClock reads HH:MM as minutes since midnight, allowing 24:00.
+func parseClock(s string) (int, error) {
+	h, m, ok := strings.Cut(s, ":")
+	hh, err1 := strconv.Atoi(h)
+	mm, err2 := strconv.Atoi(m)
+	if !ok || err1 != nil || err2 != nil || hh < 0 || mm < 0 || mm > 59 || hh*60+mm > 24*60 {
+		return 0, fmt.Errorf("bad time %q", s)
+	}
+	return hh*60 + mm, nil
+}
+
+// Contains reports whether t, in its own location, falls in the window.
+func (w SyncWindow) Contains(t time.Time) bool {
+	on := func(d time.Weekday) bool {
+		return w.Days == [7]bool{} || w.Days[d]
+	}
+	m := t.Hour()*60 + t.Minute()
+	if w.Start < w.End {
+		return on(t.Weekday()) && m >= w.Start && m < w.End
+	}
+	// Past midnight: the early part belongs to the previous day's window
+	return (m >= w.Start && on(t.Weekday())) || (m < w.End && on((t.Weekday()+6)%7))
 }
 
 type SOAConfig struct {
@@ -54,19 +260,469 @@ type SOAConfig struct {
 	AutoOnMissing bool   `yaml:"auto_on_missing"` // Auto-create SOA when missing
 }
 
+type NSConfig struct {
+	AutoOnMissing bool     `yaml:"auto_on_missing"` // Auto-create apex NS records when the zone has none
+	Servers       []string `yaml:"servers"`         // Name server names, may contain {zone} (default: soa.primary)
+	TTL           uint32   `yaml:"ttl"`             // TTL of created NS records (default: 3600)
+}
+
+type ZoneDirConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	Path       string `yaml:"path"`        // Directory with BIND zone files (one zone per file)
+	Prune      bool   `yaml:"prune"`       // Delete zones whose file was removed
+	RescanSec  int    `yaml:"rescan_sec"`  // Periodic full rescan in addition to file watching (0 = watch only)
+	DebounceMs int    `yaml:"debounce_ms"` // Delay before syncing after a change event
+}
+
+type StatsConfig struct {
+	Enabled       bool `yaml:"enabled"`
+	FlushSec      int  `yaml:"flush_sec"`      // How often in-memory query counters are written to the database (default: 10)
+	RetentionDays int  `yaml:"retention_days"` // Hourly counters older than this are deleted (default: 90)
+	// Daily per-zone counters, for usage reports, older than this are
+	// deleted (default: 400, at least retention_days)
+	DailyRetentionDays int `yaml:"daily_retention_days"`
+}
+
+type ExpiryConfig struct {
+	CheckSec      int    `yaml:"check_sec"`      // How often zones with expire_at/inactive_days are checked (default: 3600)
+	DefaultAction string `yaml:"default_action"` // disable | trash, for zones without expire_action (default: disable)
+	WebhookURL    string `yaml:"webhook_url"`    // Optional URL that receives a JSON POST for each expired zone
+}
+
+// AnomalyConfig raises alerts when NXDOMAIN or SERVFAIL answers for one zone
+// or one client pass a threshold within a window.
+type AnomalyConfig struct {
+	Enabled        bool   `yaml:"enabled"`
+	WindowSec      int    `yaml:"window_sec"`      // Length of the counting window (default: 60)
+	ZoneNXDOMAIN   int    `yaml:"zone_nxdomain"`   // NXDOMAIN answers per zone and window that raise an alert (0 = off)
+	ZoneSERVFAIL   int    `yaml:"zone_servfail"`   // SERVFAIL answers per zone and window (0 = off)
+	ClientNXDOMAIN int    `yaml:"client_nxdomain"` // NXDOMAIN answers per client address and window (0 = off)
+	ClientSERVFAIL int    `yaml:"client_servfail"` // SERVFAIL answers per client address and window (0 = off)
+	CooldownSec    int    `yaml:"cooldown_sec"`    // Minimum time between two alerts for the same zone or client (default: 600)
+	WebhookURL     string `yaml:"webhook_url"`     // Optional URL that receives a JSON POST for each alert
+}
+
+// NotificationsConfig mails or posts to Slack a summary of the audited
+// changes to the zones each subscription covers.
+type NotificationsConfig struct {
+	Enabled       bool                       `yaml:"enabled"`
+	IntervalSec   int                        `yaml:"interval_sec"` // Changes are collected into one summary per interval (default: 300)
+	SMTP          SMTPConfig                 `yaml:"smtp"`
+	Subscriptions []NotificationSubscription `yaml:"subscriptions"`
+}
+
+// SMTPConfig is the mail server notifications are sent through.
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`     // default: 587; STARTTLS is used when the server offers it
+	Username string `yaml:"username"` // PLAIN auth when set
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+}
+
+// NotificationSubscription sends the changes to some zones to its recipients.
+type NotificationSubscription struct {
+	Zones           []string `yaml:"zones"`             // Zone names, "*.suffix" for zones below suffix, or "*" for all
+	Emails          []string `yaml:"emails"`            // Needs smtp
+	SlackWebhookURL string   `yaml:"slack_webhook_url"` // Slack incoming webhook
+}
+
+// DHCPConfig registers the hostnames of DHCP leases in a dynamic zone. The
+// records are removed when the lease is released or runs out.
+type DHCPConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	Zone        string `yaml:"zone"`         // Existing zone hostnames are registered in
+	ReverseZone string `yaml:"reverse_zone"` // Optional in-addr.arpa or ip6.arpa zone that gets PTR records
+	TTL         uint32 `yaml:"ttl"`          // Record TTL, capped at the remaining lease time (default: 300)
+	CheckSec    int    `yaml:"check_sec"`    // How often expired leases are removed (default: 60)
+}
+
+// DiscoveryConfig publishes A/AAAA and SRV records for Docker containers or
+// Kubernetes services that carry namedot labels or annotations.
+type DiscoveryConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	Provider      string `yaml:"provider"`        // docker | kubernetes
+	Zone          string `yaml:"zone"`            // Existing zone whose A, AAAA and SRV records discovery owns
+	TTL           uint32 `yaml:"ttl"`             // TTL of published records (default: 60)
+	IntervalSec   int    `yaml:"interval_sec"`    // How often containers/services are listed (default: 30)
+	DockerHost    string `yaml:"docker_host"`     // unix:// socket or tcp:// address (default: unix:///var/run/docker.sock)
+	KubeAPI       string `yaml:"kube_api"`        // API server URL (default: in-cluster from KUBERNETES_SERVICE_HOST)
+	KubeTokenFile string `yaml:"kube_token_file"` // Bearer token (default: the pod's service account token)
+	KubeCAFile    string `yaml:"kube_ca_file"`    // CA of the API server (default: the pod's service account CA)
+	Namespace     string `yaml:"namespace"`       // Only services in this namespace (default: all)
+}
+
+// PublishConfig mirrors zones to cloud DNS providers whenever their serial
+// changes, so namedot stays the source of truth while the provider answers
+// public queries.
+type PublishConfig struct {
+	Enabled     bool            `yaml:"enabled"`
+	IntervalSec int             `yaml:"interval_sec"` // How often zone serials are checked for changes (default: 60)
+	Targets     []PublishTarget `yaml:"targets"`
+}
+
+// PublishTarget is a provider account and the zones pushed to it. The zones
+// must already exist at the provider.
+type PublishTarget struct {
+	Name            string   `yaml:"name"`              // Used in logs (default: the provider)
+	Provider        string   `yaml:"provider"`          // route53 | cloudflare
+	Zones           []string `yaml:"zones"`             // Zone names or *.suffix patterns
+	Endpoint        string   `yaml:"endpoint"`          // API base URL (default: the provider's public API)
+	APIToken        string   `yaml:"api_token"`         // Cloudflare: token with Zone:Read and DNS:Edit
+	AccessKeyID     string   `yaml:"access_key_id"`     // Route53
+	SecretAccessKey string   `yaml:"secret_access_key"` // Route53
+}
+
+// RunAsConfig drops root privileges once the listeners are bound.
+type RunAsConfig struct {
+	User   string `yaml:"user"`   // User name or uid to switch to
+	Group  string `yaml:"group"`  // Group name or gid (default: the user's primary group)
+	Chroot string `yaml:"chroot"` // Optional directory to chroot into before switching; paths opened later must exist inside it
+}
+
+type MetricsConfig struct {
+	Enabled bool `yaml:"enabled"` // Serve Prometheus metrics at /metrics on rest_listen (no token; allowed_cidrs applies)
+}
+
+// SlowQueriesConfig keeps the slowest recent DNS lookups, with where their
+// time went, for GET /debug/slow-queries.
+type SlowQueriesConfig struct {
+	Enabled     bool `yaml:"enabled"`
+	Size        int  `yaml:"size"`         // Lookups kept; the oldest is dropped first (default: 100)
+	ThresholdMs int  `yaml:"threshold_ms"` // Only lookups taking at least this long are kept (default: 50)
+}
+
+// QueryLogConfig writes every DNS query to a file as JSON lines, for
+// GET /debug/query-log and for export.
+type QueryLogConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	Path        string `yaml:"path"`          // Log file; rotated files get a timestamp suffix
+	MaxSizeMB   int    `yaml:"max_size_mb"`   // Rotate once the file is this large (default: 100)
+	MaxAgeHours int    `yaml:"max_age_hours"` // Rotate once the file is this old (default: 24)
+	MaxFiles    int    `yaml:"max_files"`     // Rotated files kept; older ones are deleted (default: 7)
+	Answers     *bool  `yaml:"answers"`       // Log the answer records (default: true)
+}
+
+// LogAnswers reports whether query log entries include the answer records.
+func (q QueryLogConfig) LogAnswers() bool {
+	return q.Answers == nil || *q.Answers
+}
+
+// HealthChecksConfig probes the records that have a health check and leaves
+// the unhealthy ones out of DNS answers.
+type HealthChecksConfig struct {
+	Enabled     bool `yaml:"enabled"`
+	IntervalSec int  `yaml:"interval_sec"` // Time between two probes of a record (default: 10)
+	TimeoutMs   int  `yaml:"timeout_ms"`   // Time a probe may take (default: 2000)
+	Fall        int  `yaml:"fall"`         // Failed probes in a row that mark a record unhealthy (default: 3)
+	Rise        int  `yaml:"rise"`         // Passed probes in a row that mark it healthy again (default: 2)
+}
+
+// DynamicRecordsConfig controls how the records of RRSets with a dynamic
+// URL are fetched from their endpoint.
+type DynamicRecordsConfig struct {
+	TimeoutMs   int `yaml:"timeout_ms"`    // Time a fetch may take (default: 2000)
+	CacheSec    int `yaml:"cache_sec"`     // How long fetched records are used (default: 0 = the RRSet TTL)
+	MaxStaleSec int `yaml:"max_stale_sec"` // How long the last fetched records are served while the endpoint fails (default: 300; -1 = not at all)
+}
+
+// WatchdogConfig checks the goroutine count and heap size of the process
+// and acts when one passes its limit, to catch leaks early.
+type WatchdogConfig struct {
+	Enabled          bool `yaml:"enabled"`
+	IntervalSec      int  `yaml:"interval_sec"`      // Time between checks (default: 10)
+	MaxGoroutines    int  `yaml:"max_goroutines"`    // Goroutines above which the watchdog acts (0 = no limit)
+	MaxHeapMB        int  `yaml:"max_heap_mb"`       // Heap in use above which the watchdog acts (0 = no limit)
+	RestartListeners bool `yaml:"restart_listeners"` // Also restart the DNS listeners, ending open TCP connections (default: only log)
+	CooldownSec      int  `yaml:"cooldown_sec"`      // Minimum time between two actions (default: 300)
+}
+
+// BlocklistSource is one blocklist, read from a local file or downloaded.
+type BlocklistSource struct {
+	Name       string `yaml:"name"`        // Label in logs and metrics (default: path or url)
+	Path       string `yaml:"path"`        // Local file
+	URL        string `yaml:"url"`         // http(s) URL, alternative to path
+	Format     string `yaml:"format"`      // domains (default: one domain or hosts-file line per entry) | rpz
+	RefreshSec int    `yaml:"refresh_sec"` // Reload interval (default: 3600)
+}
+
+type BlocklistConfig struct {
+	Enabled      bool              `yaml:"enabled"`
+	Sources      []BlocklistSource `yaml:"sources"`
+	Action       string            `yaml:"action"`        // nxdomain (default) | sinkhole | refused | drop
+	SinkholeIPv4 string            `yaml:"sinkhole_ipv4"` // A answer for sinkholed names (default: 0.0.0.0)
+	SinkholeIPv6 string            `yaml:"sinkhole_ipv6"` // AAAA answer for sinkholed names (default: ::)
+	TTL          uint32            `yaml:"ttl"`           // TTL of rewritten answers (default: 60)
+	ExemptCIDRs  []string          `yaml:"exempt_cidrs"`  // Clients that are never blocked
+}
+
+// RecordTTLConfig bounds the TTLs of records written through the REST API,
+// the web UI and imports, so a slip like a 1-second or 30-day TTL is
+// refused instead of reaching clients. Zero leaves that side open.
+type RecordTTLConfig struct {
+	Min uint32 `yaml:"min"`
+	Max uint32 `yaml:"max"`
+}
+
+// Check returns an error saying which limit ttl breaks, or nil.
+func (r RecordTTLConfig) Check(ttl uint32) error {
+	if ttl < r.Min {
+		return fmt.Errorf("ttl %d is below record_ttl.min (%d)", ttl, r.Min)
+	}
+	if r.Max > 0 && ttl > r.Max {
+		return fmt.Errorf("ttl %d is above record_ttl.max (%d)", ttl, r.Max)
+	}
+	return nil
+}
+
+// DenyConfig is how queries namedot turns away are answered: refused,
+// nxdomain, or drop to send no reply at all.
+type DenyConfig struct {
+	Recursion     string `yaml:"recursion"`      // Clients outside recursion.allowed_cidrs (default: refused)
+	Transfer      string `yaml:"transfer"`       // AXFR/IXFR the zone settings do not allow (default: refused)
+	DisabledZones string `yaml:"disabled_zones"` // Names in disabled zones (default: none, answered as if the zone did not exist)
+}
+
+// Deny policies.
+const (
+	DenyRefused  = "refused"
+	DenyNXDomain = "nxdomain"
+	DenyDrop     = "drop"
+)
+
+// RecursionConfig turns namedot into a recursive resolver for names outside
+// local zones, as an alternative to forwarder.
+type RecursionConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	RootHints    string   `yaml:"root_hints"`    // named.root file (default: built-in root servers)
+	DNSSEC       bool     `yaml:"dnssec"`        // Validate answers against the root trust anchor
+	AllowedCIDRs []string `yaml:"allowed_cidrs"` // Clients that may recurse (default: loopback and private ranges)
+	MaxDepth     int      `yaml:"max_depth"`     // Limit on referrals, CNAMEs and glue lookups per query (default: 30)
+}
+
+// DNS64Config synthesizes AAAA answers from A records (RFC 6147).
+type DNS64Config struct {
+	Enabled      bool     `yaml:"enabled"`
+	Prefix       string   `yaml:"prefix"`        // NAT64 prefix, /32, /40, /48, /56, /64 or /96 (default: 64:ff9b::/96)
+	ClientCIDRs  []string `yaml:"client_cidrs"`  // Clients that get synthesized answers (empty = all)
+	ExcludeIPv4  []string `yaml:"exclude_ipv4"`  // A records in these ranges are not synthesized
+	ExcludeIPv6  []string `yaml:"exclude_ipv6"`  // AAAA records in these ranges count as absent (default: ::ffff:0:0/96)
+	ExcludeNames []string `yaml:"exclude_names"` // Names (and their subdomains) never synthesized
+}
+
+// ScopedToken is an API token that may only manage some zones.
+type ScopedToken struct {
+	Name      string   `yaml:"name"`       // Shown in the audit log as "api:<name>"
+	TokenHash string   `yaml:"token_hash"` // bcrypt hash of the token
+	Zones     []string `yaml:"zones"`      // Zone names, or "*.suffix" for zones below suffix
+}
+
+// AllowsZone reports whether the token may manage the zone name.
+func (t ScopedToken) AllowsZone(name string) bool {
+	return MatchZone(t.Zones, name)
+}
+
+// Minimal reports whether local answers are sent without the zone NS
+// records and glue, as set by minimal_responses.
+func (c *Config) Minimal() bool {
+	return c.MinimalResponses == nil || *c.MinimalResponses
+}
+
+// DefaultNegativeTTL is how long negative answers without an SOA (forwarded
+// ones, and local NXDOMAIN) stay in the cache unless overridden.
+const DefaultNegativeTTL = 300
+
+// maxNegativeTTL bounds the negative_ttl override.
+const maxNegativeTTL = 86400
+
+// Overrides are runtime settings kept in the database (PUT /settings or the
+// admin Settings tab). A set field takes precedence over the config file and
+// is applied without a restart; a nil one leaves the file value in place.
+type Overrides struct {
+	DefaultTTL  *uint32 `json:"default_ttl,omitempty"`  // TTL of records written without one
+	NegativeTTL *uint32 `json:"negative_ttl,omitempty"` // Cache time of negative answers without an SOA
+	DNSVerbose  *bool   `json:"dns_verbose,omitempty"`  // log.dns_verbose
+	Forwarder   *string `json:"forwarder,omitempty"`    // Upstream resolver, "" to stop forwarding
+}
+
+// String lists the set fields, e.g. for the audit log.
+func (o Overrides) String() string {
+	var parts []string
+	if o.DefaultTTL != nil {
+		parts = append(parts, fmt.Sprintf("default_ttl=%d", *o.DefaultTTL))
+	}
+	if o.NegativeTTL != nil {
+		parts = append(parts, fmt.Sprintf("negative_ttl=%d", *o.NegativeTTL))
+	}
+	if o.DNSVerbose != nil {
+		parts = append(parts, fmt.Sprintf("dns_verbose=%t", *o.DNSVerbose))
+	}
+	if o.Forwarder != nil {
+		parts = append(parts, fmt.Sprintf("forwarder=%q", *o.Forwarder))
+	}
+	if len(parts) == 0 {
+		return "no overrides"
+	}
+	return strings.Join(parts, " ")
+}
+
+// SetOverrides replaces the runtime settings.
+func (c *Config) SetOverrides(o Overrides) {
+	c.overrides.Store(&o)
+}
+
+// Overrides returns the runtime settings in effect.
+func (c *Config) Overrides() Overrides {
+	if o := c.overrides.Load(); o != nil {
+		return *o
+	}
+	return Overrides{}
+}
+
+// CheckOverrides validates o against the rest of the config.
+func (c *Config) CheckOverrides(o Overrides) error {
+	if o.DefaultTTL != nil {
+		if *o.DefaultTTL == 0 {
+			return fmt.Errorf("default_ttl must be positive")
+		}
+		if err := c.RecordTTL.Check(*o.DefaultTTL); err != nil {
+			return fmt.Errorf("default_ttl: %w", err)
+		}
+	}
+	if o.NegativeTTL != nil && *o.NegativeTTL > maxNegativeTTL {
+		return fmt.Errorf("negative_ttl must be at most %d", maxNegativeTTL)
+	}
+	if o.Forwarder != nil && *o.Forwarder != "" {
+		if err := validateHost(*o.Forwarder); err != nil {
+			return fmt.Errorf("invalid forwarder address: %w", err)
+		}
+		if c.Recursion.Enabled {
+			return fmt.Errorf("recursion.enabled and forwarder cannot be used together")
+		}
+	}
+	return nil
+}
+
+// RecordDefaultTTL is default_ttl, or its runtime override.
+func (c *Config) RecordDefaultTTL() uint32 {
+	if o := c.overrides.Load(); o != nil && o.DefaultTTL != nil {
+		return *o.DefaultTTL
+	}
+	return c.DefaultTTL
+}
+
+// NegativeCacheTTL is the cache time of negative answers without an SOA.
+func (c *Config) NegativeCacheTTL() uint32 {
+	if o := c.overrides.Load(); o != nil && o.NegativeTTL != nil {
+		return *o.NegativeTTL
+	}
+	return DefaultNegativeTTL
+}
+
+// DNSVerbose is log.dns_verbose, or its runtime override.
+func (c *Config) DNSVerbose() bool {
+	if o := c.overrides.Load(); o != nil && o.DNSVerbose != nil {
+		return *o.DNSVerbose
+	}
+	return c.Log.DNSVerbose
+}
+
+// ForwarderHost is forwarder, or its runtime override.
+func (c *Config) ForwarderHost() string {
+	if o := c.overrides.Load(); o != nil && o.Forwarder != nil {
+		return *o.Forwarder
+	}
+	return c.Forwarder
+}
+
+// MatchZone reports whether the zone name is one of patterns: zone names,
+// "*.suffix" for every zone below suffix, or "*" for any zone.
+func MatchZone(patterns []string, name string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	for _, z := range patterns {
+		z = strings.ToLower(strings.TrimSuffix(z, "."))
+		if z == "*" {
+			return true
+		}
+		if rest, ok := strings.CutPrefix(z, "*."); ok {
+			if strings.HasSuffix(name, "."+rest) {
+				return true
+			}
+			continue
+		}
+		if name == z {
+			return true
+		}
+	}
+	return false
+}
+
+// RewriteRule answers queries for matching names from another name, like
+// an alias the client does not see. Set either Match or Regex.
+type RewriteRule struct {
+	Match string `yaml:"match"` // exact name, or "*.suffix" for every name below suffix
+	Regex string `yaml:"regex"` // regular expression on the query name without the trailing dot
+	To    string `yaml:"to"`    // name looked up instead; "*.suffix" keeps the labels matched by "*", regex groups are $1, $2...
+}
+
+// StubZone sends queries for a zone straight to its authoritative servers
+// instead of the forwarder or recursion.
+type StubZone struct {
+	Zone    string    `yaml:"zone"`
+	Servers []string  `yaml:"servers"` // IP or IP:port (default port 53)
+	ECS     ECSConfig `yaml:"ecs"`     // EDNS Client Subnet sent to the servers
+}
+
+// ECSConfig is the EDNS Client Subnet (RFC 7871) policy toward an upstream:
+// strip sends no client information, forward passes on the ECS option of
+// the query, inject also adds one built from the client address when the
+// query has none.
+type ECSConfig struct {
+	Mode     string `yaml:"mode"`      // strip (default) | forward | inject
+	SourceV4 int    `yaml:"source_v4"` // Longest IPv4 prefix sent (default: 24)
+	SourceV6 int    `yaml:"source_v6"` // Longest IPv6 prefix sent (default: 56)
+}
+
+// ECS modes.
+const (
+	ECSStrip   = "strip"
+	ECSForward = "forward"
+	ECSInject  = "inject"
+)
+
+// TSIGKey is a shared secret for signed zone transfers, referenced by name
+// from the zone settings (PUT /zones/{id}/settings).
+type TSIGKey struct {
+	Name      string `yaml:"name"`
+	Algorithm string `yaml:"algorithm"` // hmac-sha256 (default), hmac-sha1, hmac-sha224, hmac-sha384 or hmac-sha512
+	Secret    string `yaml:"secret"`    // base64, e.g. from tsig-keygen
+}
+
 type Config struct {
 	Listen           string    `yaml:"listen"`
+	// Name of this instance among several behind one anycast address, shown
+	// in logs, metrics, NSID and a TXT record at node_id_name (default: none)
+	NodeID           string    `yaml:"node_id"`
+	NodeIDName       string    `yaml:"node_id_name"` // default: id.server.
 	Forwarder        string    `yaml:"forwarder"`
+	ForwarderECS     ECSConfig `yaml:"forwarder_ecs"` // EDNS Client Subnet sent to the forwarder
 	EnableDNSSEC     bool      `yaml:"enable_dnssec"`
 	APIToken         string    `yaml:"api_token"`      // Plain text token (deprecated, use api_token_hash)
 	APITokenHash     string    `yaml:"api_token_hash"` // bcrypt hash of token (recommended)
+	APITokens        []ScopedToken `yaml:"api_tokens"`  // Extra tokens limited to some zones
 	RESTListen       string    `yaml:"rest_listen"`
 	TLSCertFile      string    `yaml:"tls_cert_file"`  // Path to TLS certificate file for HTTPS
 	TLSKeyFile       string    `yaml:"tls_key_file"`   // Path to TLS private key file for HTTPS
 	TLSReloadSec     int       `yaml:"tls_reload_sec"` // Certificate reload interval in seconds (0 = no reload)
 	AllowedCIDRs     []string  `yaml:"allowed_cidrs"`  // List of allowed CIDR blocks for REST API access (empty = allow all)
 	DefaultTTL       uint32    `yaml:"default_ttl"`
+	RecordTTL        RecordTTLConfig `yaml:"record_ttl"` // Bounds on TTLs written through the API, web UI and imports
+	// Local answers leave AUTHORITY and ADDITIONAL empty unless this is
+	// false; zones can override it (default: true)
+	MinimalResponses *bool `yaml:"minimal_responses"`
+	TrashRetentionDays int     `yaml:"trash_retention_days"` // Deleted zones are kept this long before purge (default: 30)
 	SOA              SOAConfig `yaml:"soa"`
+	NS               NSConfig  `yaml:"ns"`
 	// Deprecated: use soa.auto_on_missing instead
 	AutoSOAOnMissing bool `yaml:"auto_soa_on_missing"`
 
@@ -74,8 +730,33 @@ type Config struct {
 	GeoIP       GeoIPConfig       `yaml:"geoip"`
 	Log         LogConfig         `yaml:"log"`
 	Performance PerformanceConfig `yaml:"performance"`
+	EDNS        EDNSConfig        `yaml:"edns"`
 	Admin       AdminConfig       `yaml:"admin"`
 	Replication ReplicationConfig `yaml:"replication"`
+	ZoneDir     ZoneDirConfig     `yaml:"zone_dir"`
+	Stats       StatsConfig       `yaml:"stats"`
+	Expiry      ExpiryConfig      `yaml:"expiry"`
+	Anomaly     AnomalyConfig     `yaml:"anomaly"`
+	Notifications NotificationsConfig `yaml:"notifications"`
+	DHCP        DHCPConfig        `yaml:"dhcp"`
+	Discovery   DiscoveryConfig   `yaml:"discovery"`
+	Publish     PublishConfig     `yaml:"publish"`
+	Metrics     MetricsConfig     `yaml:"metrics"`
+	SlowQueries SlowQueriesConfig `yaml:"slow_queries"`
+	QueryLog    QueryLogConfig    `yaml:"query_log"`
+	Watchdog    WatchdogConfig    `yaml:"watchdog"`
+	HealthChecks HealthChecksConfig `yaml:"health_checks"`
+	DynamicRecords DynamicRecordsConfig `yaml:"dynamic_records"`
+	Blocklist   BlocklistConfig   `yaml:"blocklist"`
+	Deny        DenyConfig        `yaml:"deny"`
+	Recursion   RecursionConfig   `yaml:"recursion"`
+	DNS64       DNS64Config       `yaml:"dns64"`
+	StubZones   []StubZone        `yaml:"stub_zones"`
+	Rewrite     []RewriteRule     `yaml:"rewrite"`
+	TSIGKeys    []TSIGKey         `yaml:"tsig_keys"`
+	RunAs       RunAsConfig       `yaml:"run_as"`
+
+	overrides atomic.Pointer[Overrides] // runtime settings from the database
 }
 
 func Load(path string) (*Config, error) {
@@ -83,6 +764,12 @@ func Load(path string) (*Config, error) {
 	if err != nil {
 		return nil, fmt.Errorf("read config: %w", err)
 	}
+	return Parse(b)
+}
+
+// Parse reads a config from YAML, applying defaults and validating it the
+// way Load does.
+func Parse(b []byte) (*Config, error) {
 	var cfg Config
 	if err := yaml.Unmarshal(b, &cfg); err != nil {
 		return nil, fmt.Errorf("parse yaml: %w", err)
@@ -104,12 +791,168 @@ func Load(path string) (*Config, error) {
 	if cfg.Performance.ForwarderTimeoutSec == 0 {
 		cfg.Performance.ForwarderTimeoutSec = 2
 	}
+	if cfg.TrashRetentionDays == 0 {
+		cfg.TrashRetentionDays = 30
+	}
+	if cfg.DB.ConnectRetrySec == 0 {
+		cfg.DB.ConnectRetrySec = 30
+	}
 	if cfg.Replication.SyncIntervalSec == 0 && cfg.Replication.Mode == "slave" {
 		cfg.Replication.SyncIntervalSec = 60 // Default: 60 seconds
 	}
 	if cfg.TLSReloadSec == 0 && cfg.IsTLSEnabled() {
 		cfg.TLSReloadSec = 3600 // Default: 3600 seconds (1 hour)
 	}
+	if cfg.ZoneDir.Enabled && cfg.ZoneDir.DebounceMs == 0 {
+		cfg.ZoneDir.DebounceMs = 500
+	}
+	if cfg.Stats.Enabled && cfg.Stats.FlushSec == 0 {
+		cfg.Stats.FlushSec = 10
+	}
+	if cfg.Stats.Enabled && cfg.Stats.RetentionDays == 0 {
+		cfg.Stats.RetentionDays = 90
+	}
+	if cfg.Stats.Enabled && cfg.Stats.DailyRetentionDays == 0 {
+		cfg.Stats.DailyRetentionDays = max(400, cfg.Stats.RetentionDays)
+	}
+	if cfg.Expiry.CheckSec == 0 {
+		cfg.Expiry.CheckSec = 3600
+	}
+	if cfg.Expiry.DefaultAction == "" {
+		cfg.Expiry.DefaultAction = "disable"
+	}
+	if cfg.Anomaly.WindowSec == 0 {
+		cfg.Anomaly.WindowSec = 60
+	}
+	if cfg.Anomaly.CooldownSec == 0 {
+		cfg.Anomaly.CooldownSec = 600
+	}
+	if cfg.NodeIDName == "" {
+		cfg.NodeIDName = "id.server."
+	}
+	cfg.NodeIDName = strings.ToLower(cfg.NodeIDName)
+	if !strings.HasSuffix(cfg.NodeIDName, ".") {
+		cfg.NodeIDName += "."
+	}
+	if cfg.SlowQueries.Size == 0 {
+		cfg.SlowQueries.Size = 100
+	}
+	if cfg.SlowQueries.ThresholdMs == 0 {
+		cfg.SlowQueries.ThresholdMs = 50
+	}
+	if cfg.QueryLog.MaxSizeMB == 0 {
+		cfg.QueryLog.MaxSizeMB = 100
+	}
+	if cfg.QueryLog.MaxAgeHours == 0 {
+		cfg.QueryLog.MaxAgeHours = 24
+	}
+	if cfg.QueryLog.MaxFiles == 0 {
+		cfg.QueryLog.MaxFiles = 7
+	}
+	if cfg.HealthChecks.IntervalSec == 0 {
+		cfg.HealthChecks.IntervalSec = 10
+	}
+	if cfg.HealthChecks.TimeoutMs == 0 {
+		cfg.HealthChecks.TimeoutMs = 2000
+	}
+	if cfg.HealthChecks.Fall == 0 {
+		cfg.HealthChecks.Fall = 3
+	}
+	if cfg.HealthChecks.Rise == 0 {
+		cfg.HealthChecks.Rise = 2
+	}
+	if cfg.DynamicRecords.TimeoutMs == 0 {
+		cfg.DynamicRecords.TimeoutMs = 2000
+	}
+	if cfg.DynamicRecords.MaxStaleSec == 0 {
+		cfg.DynamicRecords.MaxStaleSec = 300
+	}
+	if cfg.Watchdog.IntervalSec == 0 {
+		cfg.Watchdog.IntervalSec = 10
+	}
+	if cfg.Watchdog.CooldownSec == 0 {
+		cfg.Watchdog.CooldownSec = 300
+	}
+	if cfg.Notifications.IntervalSec == 0 {
+		cfg.Notifications.IntervalSec = 300
+	}
+	if cfg.Notifications.SMTP.Port == 0 {
+		cfg.Notifications.SMTP.Port = 587
+	}
+	if cfg.DHCP.TTL == 0 {
+		cfg.DHCP.TTL = 300
+	}
+	if cfg.DHCP.CheckSec == 0 {
+		cfg.DHCP.CheckSec = 60
+	}
+	if cfg.Discovery.TTL == 0 {
+		cfg.Discovery.TTL = 60
+	}
+	if cfg.Discovery.IntervalSec == 0 {
+		cfg.Discovery.IntervalSec = 30
+	}
+	if cfg.Discovery.DockerHost == "" {
+		cfg.Discovery.DockerHost = "unix:///var/run/docker.sock"
+	}
+	if cfg.EDNS.UDPSize == 0 {
+		cfg.EDNS.UDPSize = 1232
+	}
+	if cfg.EDNS.PaddingBlock == 0 {
+		cfg.EDNS.PaddingBlock = 468
+	}
+	if cfg.Publish.IntervalSec == 0 {
+		cfg.Publish.IntervalSec = 60
+	}
+	if cfg.Blocklist.Action == "" {
+		cfg.Blocklist.Action = "nxdomain"
+	}
+	if cfg.Deny.Recursion == "" {
+		cfg.Deny.Recursion = DenyRefused
+	}
+	if cfg.Deny.Transfer == "" {
+		cfg.Deny.Transfer = DenyRefused
+	}
+	if cfg.Blocklist.SinkholeIPv4 == "" {
+		cfg.Blocklist.SinkholeIPv4 = "0.0.0.0"
+	}
+	if cfg.Blocklist.SinkholeIPv6 == "" {
+		cfg.Blocklist.SinkholeIPv6 = "::"
+	}
+	if cfg.Blocklist.TTL == 0 {
+		cfg.Blocklist.TTL = 60
+	}
+	for i := range cfg.Blocklist.Sources {
+		src := &cfg.Blocklist.Sources[i]
+		if src.Format == "" {
+			src.Format = "domains"
+		}
+		if src.RefreshSec == 0 {
+			src.RefreshSec = 3600
+		}
+		if src.Name == "" {
+			src.Name = src.Path + src.URL
+		}
+	}
+	if cfg.Recursion.Enabled && len(cfg.Recursion.AllowedCIDRs) == 0 {
+		cfg.Recursion.AllowedCIDRs = []string{"127.0.0.0/8", "::1/128", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"}
+	}
+	if cfg.DNS64.Prefix == "" {
+		cfg.DNS64.Prefix = "64:ff9b::/96"
+	}
+	if cfg.DNS64.Enabled && cfg.DNS64.ExcludeIPv6 == nil {
+		cfg.DNS64.ExcludeIPv6 = []string{"::ffff:0:0/96"}
+	}
+	if cfg.Recursion.MaxDepth == 0 {
+		cfg.Recursion.MaxDepth = 30
+	}
+	if cfg.NS.TTL == 0 {
+		cfg.NS.TTL = 3600
+	}
+	for i := range cfg.TSIGKeys {
+		if cfg.TSIGKeys[i].Algorithm == "" {
+			cfg.TSIGKeys[i].Algorithm = "hmac-sha256"
+		}
+	}
 	if !cfg.SOA.AutoOnMissing && cfg.AutoSOAOnMissing {
 		cfg.SOA.AutoOnMissing = true // backward compatibility for deprecated root field
 	}
@@ -148,6 +991,9 @@ func (c *Config) Validate() error {
 			return fmt.Errorf("invalid forwarder address: %w", err)
 		}
 	}
+	if err := c.ForwarderECS.validate("forwarder_ecs"); err != nil {
+		return err
+	}
 
 	// Validate DB config
 	if c.DB.Driver == "" {
@@ -156,6 +1002,28 @@ func (c *Config) Validate() error {
 	if c.DB.DSN == "" {
 		return fmt.Errorf("db.dsn is required")
 	}
+	switch c.DB.Driver {
+	case "sqlite", "sqlite3", "postgres", "postgresql", "mysql", "mariadb":
+	default:
+		return fmt.Errorf("db.driver must be 'sqlite', 'postgres', 'mysql' or 'mariadb' (got '%s')", c.DB.Driver)
+	}
+	if c.DB.HasReplica() && (c.DB.Driver == "sqlite" || c.DB.Driver == "sqlite3") {
+		return fmt.Errorf("db.replica_dsn is not supported with sqlite")
+	}
+
+	if c.DB.MaxOpenConns < 0 || c.DB.MaxIdleConns < 0 || c.DB.ConnMaxLifetimeSec < 0 || c.DB.MaintenanceSec < 0 {
+		return fmt.Errorf("db pool and maintenance settings must be >= 0")
+	}
+	if c.DB.ConnectRetrySec < -1 {
+		return fmt.Errorf("db.connect_retry_sec must be >= 0, or -1 to fail immediately")
+	}
+	if c.DB.MaxOpenConns > 0 && c.DB.MaxIdleConns > c.DB.MaxOpenConns {
+		return fmt.Errorf("db.max_idle_conns (%d) must not exceed db.max_open_conns (%d)", c.DB.MaxIdleConns, c.DB.MaxOpenConns)
+	}
+
+	if c.TrashRetentionDays < 0 {
+		return fmt.Errorf("trash_retention_days must be >= 0")
+	}
 
 	// Validate GeoIP config
 	if c.GeoIP.Enabled && c.GeoIP.MMDBPath == "" {
@@ -179,18 +1047,42 @@ func (c *Config) Validate() error {
 	if c.Performance.CacheSize < 0 {
 		return fmt.Errorf("performance.cache_size must be >= 0")
 	}
+	if c.Performance.CacheTTLJitter < 0 || c.Performance.CacheTTLJitter > 50 {
+		return fmt.Errorf("performance.cache_ttl_jitter must be between 0 and 50")
+	}
+	for i, name := range c.Performance.NoCache {
+		if name == "" || name == "." || strings.ContainsAny(name, " \t") || strings.Contains(name, "..") {
+			return fmt.Errorf("performance.no_cache[%d]: invalid name %q", i, name)
+		}
+	}
 	if c.Performance.DNSTimeoutSec <= 0 {
 		return fmt.Errorf("performance.dns_timeout_sec must be > 0")
 	}
 	if c.Performance.ForwarderTimeoutSec <= 0 {
 		return fmt.Errorf("performance.forwarder_timeout_sec must be > 0")
 	}
+	if c.Performance.MaxTTL > 0 && c.Performance.MinTTL > c.Performance.MaxTTL {
+		return fmt.Errorf("performance.min_ttl must not be greater than performance.max_ttl")
+	}
+
+	if c.RecordTTL.Max > 0 && c.RecordTTL.Min > c.RecordTTL.Max {
+		return fmt.Errorf("record_ttl.min must not be greater than record_ttl.max")
+	}
+	if c.DefaultTTL > 0 {
+		if err := c.RecordTTL.Check(c.DefaultTTL); err != nil {
+			return fmt.Errorf("default_ttl: %w", err)
+		}
+	}
 
 	// Validate API token configuration
 	if c.APIToken != "" && c.APITokenHash != "" {
 		return fmt.Errorf("cannot specify both api_token and api_token_hash, use only api_token_hash (recommended)")
 	}
 
+	if err := validateScopedTokens(c.APITokens); err != nil {
+		return err
+	}
+
 	// Warn if using plain text token (deprecated)
 	if c.APIToken != "" {
 		fmt.Fprintf(os.Stderr, "WARNING: api_token (plain text) is deprecated, consider using api_token_hash instead\n")
@@ -211,6 +1103,166 @@ func (c *Config) Validate() error {
 			return fmt.Errorf("replication.sync_interval_sec must be > 0 when replication.mode is 'slave'")
 		}
 	}
+	if c.Replication.BandwidthKbit < 0 {
+		return fmt.Errorf("replication.bandwidth_kbit must be >= 0")
+	}
+	for _, w := range c.Replication.SyncWindows {
+		if _, err := ParseSyncWindow(w); err != nil {
+			return fmt.Errorf("replication.sync_windows: %w", err)
+		}
+	}
+	for _, t := range c.Replication.Notify {
+		if _, err := NotifyAddr(t); err != nil {
+			return fmt.Errorf("replication.notify: %w", err)
+		}
+	}
+	for _, n := range c.Replication.NotifyFrom {
+		if _, _, err := net.ParseCIDR(n); err != nil {
+			return fmt.Errorf("replication.notify_from: %w", err)
+		}
+	}
+
+	// Validate zone directory config
+	if c.ZoneDir.Enabled {
+		if c.ZoneDir.Path == "" {
+			return fmt.Errorf("zone_dir.path is required when zone_dir is enabled")
+		}
+		if fi, err := os.Stat(c.ZoneDir.Path); err != nil {
+			return fmt.Errorf("zone_dir.path: %w", err)
+		} else if !fi.IsDir() {
+			return fmt.Errorf("zone_dir.path: %s is not a directory", c.ZoneDir.Path)
+		}
+		if c.ZoneDir.RescanSec < 0 || c.ZoneDir.DebounceMs < 0 {
+			return fmt.Errorf("zone_dir.rescan_sec and zone_dir.debounce_ms must be >= 0")
+		}
+		if c.Replication.Mode == "slave" {
+			return fmt.Errorf("zone_dir cannot be used when replication.mode is 'slave'")
+		}
+	}
+
+	seen := map[string]bool{c.Admin.Username: true}
+	for _, u := range c.Admin.Users {
+		if u.Username == "" || u.PasswordHash == "" {
+			return fmt.Errorf("admin.users: username and password_hash are required")
+		}
+		if seen[u.Username] {
+			return fmt.Errorf("admin.users: duplicate username '%s'", u.Username)
+		}
+		seen[u.Username] = true
+		switch u.Role {
+		case "", RoleAdmin, RoleViewer:
+		default:
+			return fmt.Errorf("admin.users: role must be 'admin' or 'viewer' (got '%s')", u.Role)
+		}
+	}
+
+	if c.Stats.FlushSec < 0 || c.Stats.RetentionDays < 0 || c.Stats.DailyRetentionDays < 0 {
+		return fmt.Errorf("stats.flush_sec, stats.retention_days and stats.daily_retention_days must be >= 0")
+	}
+
+	if c.Expiry.CheckSec < 0 {
+		return fmt.Errorf("expiry.check_sec must be >= 0")
+	}
+	switch c.Expiry.DefaultAction {
+	case "", "disable", "trash":
+	default:
+		return fmt.Errorf("expiry.default_action must be 'disable' or 'trash' (got '%s')", c.Expiry.DefaultAction)
+	}
+	if c.Expiry.WebhookURL != "" && !strings.HasPrefix(c.Expiry.WebhookURL, "http://") && !strings.HasPrefix(c.Expiry.WebhookURL, "https://") {
+		return fmt.Errorf("expiry.webhook_url must be an http(s) URL")
+	}
+
+	if c.RunAs.Chroot != "" {
+		if !filepath.IsAbs(c.RunAs.Chroot) {
+			return fmt.Errorf("run_as.chroot must be an absolute path")
+		}
+		if fi, err := os.Stat(c.RunAs.Chroot); err != nil {
+			return fmt.Errorf("run_as.chroot: %w", err)
+		} else if !fi.IsDir() {
+			return fmt.Errorf("run_as.chroot: %s is not a directory", c.RunAs.Chroot)
+		}
+	}
+
+	if err := c.Anomaly.validate(); err != nil {
+		return err
+	}
+	if len(c.NodeID) > 255 || strings.ContainsAny(c.NodeID, " \t\n\"") {
+		return fmt.Errorf("node_id: at most 255 characters without spaces or quotes")
+	}
+	if strings.ContainsAny(c.NodeIDName, " \t") || strings.Contains(c.NodeIDName, "..") || c.NodeIDName == "." {
+		return fmt.Errorf("node_id_name: invalid name %q", c.NodeIDName)
+	}
+	if c.SlowQueries.Size < 0 || c.SlowQueries.ThresholdMs < 0 {
+		return fmt.Errorf("slow_queries: size and threshold_ms must be >= 0")
+	}
+	if c.Log.Dnstap.Enabled && c.Log.Dnstap.Socket == "" {
+		return fmt.Errorf("log.dnstap.socket is required when log.dnstap is enabled")
+	}
+	if c.QueryLog.Enabled && c.QueryLog.Path == "" {
+		return fmt.Errorf("query_log.path is required when query_log is enabled")
+	}
+	if c.QueryLog.MaxSizeMB < 0 || c.QueryLog.MaxAgeHours < 0 || c.QueryLog.MaxFiles < 0 {
+		return fmt.Errorf("query_log: max_size_mb, max_age_hours and max_files must be >= 0")
+	}
+	if h := c.HealthChecks; h.IntervalSec < 0 || h.TimeoutMs < 0 || h.Fall < 0 || h.Rise < 0 {
+		return fmt.Errorf("health_checks: interval_sec, timeout_ms, fall and rise must be >= 0")
+	}
+	if h := c.HealthChecks; h.TimeoutMs > h.IntervalSec*1000 {
+		return fmt.Errorf("health_checks.timeout_ms must not exceed interval_sec")
+	}
+	if d := c.DynamicRecords; d.TimeoutMs < 0 || d.CacheSec < 0 {
+		return fmt.Errorf("dynamic_records: timeout_ms and cache_sec must be >= 0")
+	}
+	if c.DynamicRecords.MaxStaleSec < -1 {
+		return fmt.Errorf("dynamic_records.max_stale_sec must be >= 0, or -1 to serve the stored records as soon as the endpoint fails")
+	}
+	if w := c.Watchdog; w.IntervalSec < 0 || w.MaxGoroutines < 0 || w.MaxHeapMB < 0 || w.CooldownSec < 0 {
+		return fmt.Errorf("watchdog: interval_sec, max_goroutines, max_heap_mb and cooldown_sec must be >= 0")
+	}
+	if w := c.Watchdog; w.Enabled && w.MaxGoroutines == 0 && w.MaxHeapMB == 0 {
+		return fmt.Errorf("watchdog: max_goroutines or max_heap_mb is required when watchdog is enabled")
+	}
+	if err := c.Notifications.validate(); err != nil {
+		return err
+	}
+	if err := c.DHCP.validate(); err != nil {
+		return err
+	}
+	if err := c.Discovery.validate(); err != nil {
+		return err
+	}
+	if err := c.Publish.validate(); err != nil {
+		return err
+	}
+	if err := c.EDNS.validate(); err != nil {
+		return err
+	}
+	if err := c.Blocklist.validate(); err != nil {
+		return err
+	}
+	if err := c.Deny.validate(); err != nil {
+		return err
+	}
+	if err := c.Recursion.validate(c.Forwarder); err != nil {
+		return err
+	}
+	if err := c.DNS64.validate(); err != nil {
+		return err
+	}
+	if err := validateStubZones(c.StubZones); err != nil {
+		return err
+	}
+	if err := validateRewriteRules(c.Rewrite); err != nil {
+		return err
+	}
+	if err := validateTSIGKeys(c.TSIGKeys); err != nil {
+		return err
+	}
+	for i, n := range c.NS.Servers {
+		if strings.TrimSpace(n) == "" || strings.ContainsAny(n, " \t") {
+			return fmt.Errorf("ns.servers[%d]: invalid name %q", i, n)
+		}
+	}
 
 	// Validate TLS config
 	if (c.TLSCertFile != "" && c.TLSKeyFile == "") || (c.TLSCertFile == "" && c.TLSKeyFile != "") {
@@ -288,3 +1340,367 @@ func validateHost(addr string) error {
 
 	return nil
 }
+
+func (r *RecursionConfig) validate(forwarder string) error {
+	if !r.Enabled {
+		return nil
+	}
+	if forwarder != "" {
+		return fmt.Errorf("recursion.enabled and forwarder cannot be used together")
+	}
+	if r.MaxDepth < 0 {
+		return fmt.Errorf("recursion.max_depth must be >= 0")
+	}
+	if r.RootHints != "" {
+		if _, err := os.Stat(r.RootHints); err != nil {
+			return fmt.Errorf("recursion.root_hints: %w", err)
+		}
+	}
+	for i, cidr := range r.AllowedCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("recursion.allowed_cidrs[%d]: invalid CIDR %q: %w", i, cidr, err)
+		}
+	}
+	return nil
+}
+
+func validateStubZones(zones []StubZone) error {
+	seen := map[string]bool{}
+	for i, z := range zones {
+		name := strings.ToLower(strings.TrimSuffix(z.Zone, "."))
+		if name == "" {
+			return fmt.Errorf("stub_zones[%d]: zone is required", i)
+		}
+		if seen[name] {
+			return fmt.Errorf("stub_zones[%d]: duplicate zone '%s'", i, z.Zone)
+		}
+		seen[name] = true
+		if len(z.Servers) == 0 {
+			return fmt.Errorf("stub_zones[%d]: servers is required", i)
+		}
+		for _, srv := range z.Servers {
+			if net.ParseIP(srv) != nil {
+				continue
+			}
+			host, _, err := net.SplitHostPort(srv)
+			if err != nil || net.ParseIP(host) == nil || validateAddr(srv) != nil {
+				return fmt.Errorf("stub_zones[%d]: server %q must be an IP or IP:port", i, srv)
+			}
+		}
+		if err := z.ECS.validate(fmt.Sprintf("stub_zones[%d].ecs", i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *ECSConfig) validate(field string) error {
+	switch e.Mode {
+	case "", ECSStrip, ECSForward, ECSInject:
+	default:
+		return fmt.Errorf("%s.mode must be strip, forward or inject (got %q)", field, e.Mode)
+	}
+	if e.SourceV4 < 0 || e.SourceV4 > 32 {
+		return fmt.Errorf("%s.source_v4 must be between 0 and 32 (got %d)", field, e.SourceV4)
+	}
+	if e.SourceV6 < 0 || e.SourceV6 > 128 {
+		return fmt.Errorf("%s.source_v6 must be between 0 and 128 (got %d)", field, e.SourceV6)
+	}
+	return nil
+}
+
+func validateScopedTokens(tokens []ScopedToken) error {
+	seen := map[string]bool{}
+	for i, t := range tokens {
+		if t.Name == "" {
+			return fmt.Errorf("api_tokens[%d]: name is required", i)
+		}
+		if seen[t.Name] {
+			return fmt.Errorf("api_tokens[%d]: duplicate name '%s'", i, t.Name)
+		}
+		seen[t.Name] = true
+		if !strings.HasPrefix(t.TokenHash, "$2") {
+			return fmt.Errorf("api_tokens[%d]: token_hash must be a bcrypt hash", i)
+		}
+		if len(t.Zones) == 0 {
+			return fmt.Errorf("api_tokens[%d]: zones is required", i)
+		}
+		for _, z := range t.Zones {
+			if strings.TrimSuffix(strings.TrimPrefix(z, "*."), ".") == "" {
+				return fmt.Errorf("api_tokens[%d]: invalid zone %q", i, z)
+			}
+		}
+	}
+	return nil
+}
+
+func validateRewriteRules(rules []RewriteRule) error {
+	for i, r := range rules {
+		if (r.Match == "") == (r.Regex == "") {
+			return fmt.Errorf("rewrite[%d]: set either match or regex", i)
+		}
+		if strings.TrimSpace(r.To) == "" {
+			return fmt.Errorf("rewrite[%d]: to is required", i)
+		}
+		if r.Regex != "" {
+			if _, err := regexp.Compile(r.Regex); err != nil {
+				return fmt.Errorf("rewrite[%d]: invalid regex: %w", i, err)
+			}
+			continue
+		}
+		if strings.HasPrefix(r.To, "*.") && !strings.HasPrefix(r.Match, "*.") {
+			return fmt.Errorf("rewrite[%d]: to %q needs a \"*.\" match", i, r.To)
+		}
+	}
+	return nil
+}
+
+var tsigAlgorithms = map[string]bool{
+	"hmac-sha1": true, "hmac-sha224": true, "hmac-sha256": true, "hmac-sha384": true, "hmac-sha512": true,
+}
+
+func validateTSIGKeys(keys []TSIGKey) error {
+	seen := map[string]bool{}
+	for i, k := range keys {
+		name := strings.ToLower(strings.TrimSuffix(k.Name, "."))
+		if name == "" {
+			return fmt.Errorf("tsig_keys[%d]: name is required", i)
+		}
+		if seen[name] {
+			return fmt.Errorf("tsig_keys[%d]: duplicate name '%s'", i, k.Name)
+		}
+		seen[name] = true
+		if !tsigAlgorithms[strings.ToLower(k.Algorithm)] {
+			return fmt.Errorf("tsig_keys[%d]: unsupported algorithm '%s'", i, k.Algorithm)
+		}
+		if b, err := base64.StdEncoding.DecodeString(k.Secret); err != nil || len(b) == 0 {
+			return fmt.Errorf("tsig_keys[%d]: secret must be base64", i)
+		}
+	}
+	return nil
+}
+
+// FindTSIGKey returns the tsig_keys entry with the given name.
+func (c *Config) FindTSIGKey(name string) (TSIGKey, bool) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	for _, k := range c.TSIGKeys {
+		if strings.ToLower(strings.TrimSuffix(k.Name, ".")) == name {
+			return k, true
+		}
+	}
+	return TSIGKey{}, false
+}
+
+func (d *DNS64Config) validate() error {
+	if !d.Enabled {
+		return nil
+	}
+	ip, n, err := net.ParseCIDR(d.Prefix)
+	if err != nil || ip.To4() != nil {
+		return fmt.Errorf("dns64.prefix: invalid IPv6 prefix %q", d.Prefix)
+	}
+	switch bits, _ := n.Mask.Size(); bits {
+	case 32, 40, 48, 56, 64, 96:
+	default:
+		return fmt.Errorf("dns64.prefix: length must be 32, 40, 48, 56, 64 or 96 (got %d)", bits)
+	}
+	if bits, _ := n.Mask.Size(); bits >= 64 && n.IP[8] != 0 {
+		return fmt.Errorf("dns64.prefix: bits 64-71 must be zero")
+	}
+	for _, set := range []struct {
+		key   string
+		cidrs []string
+	}{{"client_cidrs", d.ClientCIDRs}, {"exclude_ipv4", d.ExcludeIPv4}, {"exclude_ipv6", d.ExcludeIPv6}} {
+		for i, cidr := range set.cidrs {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				return fmt.Errorf("dns64.%s[%d]: invalid CIDR %q: %w", set.key, i, cidr, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (n *NotificationsConfig) validate() error {
+	if !n.Enabled {
+		return nil
+	}
+	if n.IntervalSec < 0 {
+		return fmt.Errorf("notifications.interval_sec must be >= 0")
+	}
+	if len(n.Subscriptions) == 0 {
+		return fmt.Errorf("notifications: at least one subscription is required when notifications are enabled")
+	}
+	for i, sub := range n.Subscriptions {
+		if len(sub.Zones) == 0 {
+			return fmt.Errorf("notifications.subscriptions[%d]: zones is required", i)
+		}
+		if len(sub.Emails) == 0 && sub.SlackWebhookURL == "" {
+			return fmt.Errorf("notifications.subscriptions[%d]: set emails or slack_webhook_url", i)
+		}
+		if len(sub.Emails) > 0 && (n.SMTP.Host == "" || n.SMTP.From == "") {
+			return fmt.Errorf("notifications.subscriptions[%d]: emails need smtp.host and smtp.from", i)
+		}
+		if sub.SlackWebhookURL != "" && !strings.HasPrefix(sub.SlackWebhookURL, "http://") && !strings.HasPrefix(sub.SlackWebhookURL, "https://") {
+			return fmt.Errorf("notifications.subscriptions[%d]: slack_webhook_url must be an http(s) URL", i)
+		}
+	}
+	return nil
+}
+
+func (d *DHCPConfig) validate() error {
+	if !d.Enabled {
+		return nil
+	}
+	if strings.Trim(d.Zone, ". ") == "" {
+		return fmt.Errorf("dhcp.zone is required when dhcp is enabled")
+	}
+	if r := strings.ToLower(strings.TrimSuffix(d.ReverseZone, ".")); r != "" && !strings.HasSuffix(r, ".in-addr.arpa") && !strings.HasSuffix(r, ".ip6.arpa") {
+		return fmt.Errorf("dhcp.reverse_zone must be an in-addr.arpa or ip6.arpa zone (got '%s')", d.ReverseZone)
+	}
+	if d.CheckSec < 0 {
+		return fmt.Errorf("dhcp.check_sec must be >= 0")
+	}
+	return nil
+}
+
+func (d *DiscoveryConfig) validate() error {
+	if !d.Enabled {
+		return nil
+	}
+	switch d.Provider {
+	case "docker", "kubernetes":
+	default:
+		return fmt.Errorf("discovery.provider must be 'docker' or 'kubernetes' (got '%s')", d.Provider)
+	}
+	if strings.Trim(d.Zone, ". ") == "" {
+		return fmt.Errorf("discovery.zone is required when discovery is enabled")
+	}
+	if d.IntervalSec < 0 {
+		return fmt.Errorf("discovery.interval_sec must be >= 0")
+	}
+	if d.Provider == "docker" && d.DockerHost != "" && !strings.HasPrefix(d.DockerHost, "unix://") && !strings.HasPrefix(d.DockerHost, "tcp://") {
+		return fmt.Errorf("discovery.docker_host must be a unix:// or tcp:// address")
+	}
+	return nil
+}
+
+func (e *EDNSConfig) validate() error {
+	if e.UDPSize != 0 && (e.UDPSize < 512 || e.UDPSize > 65535) {
+		return fmt.Errorf("edns.udp_size must be between 512 and 65535 (got %d)", e.UDPSize)
+	}
+	if e.PaddingBlock < 0 || e.PaddingBlock > 4096 {
+		return fmt.Errorf("edns.padding_block must be between 0 and 4096 (got %d)", e.PaddingBlock)
+	}
+	return nil
+}
+
+func (p *PublishConfig) validate() error {
+	if !p.Enabled {
+		return nil
+	}
+	if p.IntervalSec < 0 {
+		return fmt.Errorf("publish.interval_sec must be >= 0")
+	}
+	if len(p.Targets) == 0 {
+		return fmt.Errorf("publish: at least one target is required when publishing is enabled")
+	}
+	for i, t := range p.Targets {
+		if len(t.Zones) == 0 {
+			return fmt.Errorf("publish.targets[%d]: zones is required", i)
+		}
+		switch t.Provider {
+		case "route53":
+			if t.AccessKeyID == "" || t.SecretAccessKey == "" {
+				return fmt.Errorf("publish.targets[%d]: route53 needs access_key_id and secret_access_key", i)
+			}
+		case "cloudflare":
+			if t.APIToken == "" {
+				return fmt.Errorf("publish.targets[%d]: cloudflare needs api_token", i)
+			}
+		default:
+			return fmt.Errorf("publish.targets[%d]: provider must be 'route53' or 'cloudflare' (got '%s')", i, t.Provider)
+		}
+		if t.Endpoint != "" && !strings.HasPrefix(t.Endpoint, "http://") && !strings.HasPrefix(t.Endpoint, "https://") {
+			return fmt.Errorf("publish.targets[%d]: endpoint must be an http(s) URL", i)
+		}
+	}
+	return nil
+}
+
+func (a *AnomalyConfig) validate() error {
+	if !a.Enabled {
+		return nil
+	}
+	if a.WindowSec < 0 || a.CooldownSec < 0 || a.ZoneNXDOMAIN < 0 || a.ZoneSERVFAIL < 0 || a.ClientNXDOMAIN < 0 || a.ClientSERVFAIL < 0 {
+		return fmt.Errorf("anomaly: window_sec, cooldown_sec and thresholds must be >= 0")
+	}
+	if a.ZoneNXDOMAIN == 0 && a.ZoneSERVFAIL == 0 && a.ClientNXDOMAIN == 0 && a.ClientSERVFAIL == 0 {
+		return fmt.Errorf("anomaly: at least one threshold is required when anomaly is enabled")
+	}
+	if a.WebhookURL != "" && !strings.HasPrefix(a.WebhookURL, "http://") && !strings.HasPrefix(a.WebhookURL, "https://") {
+		return fmt.Errorf("anomaly.webhook_url must be an http(s) URL")
+	}
+	return nil
+}
+
+func (d *DenyConfig) validate() error {
+	for _, f := range []struct{ name, value string }{
+		{"deny.recursion", d.Recursion},
+		{"deny.transfer", d.Transfer},
+		{"deny.disabled_zones", d.DisabledZones},
+	} {
+		switch f.value {
+		case "", DenyRefused, DenyNXDomain, DenyDrop:
+		default:
+			return fmt.Errorf("%s must be 'refused', 'nxdomain' or 'drop' (got '%s')", f.name, f.value)
+		}
+	}
+	return nil
+}
+
+func (b *BlocklistConfig) validate() error {
+	if !b.Enabled {
+		return nil
+	}
+	if len(b.Sources) == 0 {
+		return fmt.Errorf("blocklist.sources is required when blocklist is enabled")
+	}
+	switch b.Action {
+	case "", "nxdomain", "sinkhole", DenyRefused, DenyDrop:
+	default:
+		return fmt.Errorf("blocklist.action must be 'nxdomain', 'sinkhole', 'refused' or 'drop' (got '%s')", b.Action)
+	}
+	if ip := net.ParseIP(b.SinkholeIPv4); b.SinkholeIPv4 != "" && (ip == nil || ip.To4() == nil) {
+		return fmt.Errorf("blocklist.sinkhole_ipv4: invalid IPv4 address %q", b.SinkholeIPv4)
+	}
+	if ip := net.ParseIP(b.SinkholeIPv6); b.SinkholeIPv6 != "" && (ip == nil || ip.To4() != nil) {
+		return fmt.Errorf("blocklist.sinkhole_ipv6: invalid IPv6 address %q", b.SinkholeIPv6)
+	}
+	for i, cidr := range b.ExemptCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("blocklist.exempt_cidrs[%d]: invalid CIDR %q: %w", i, cidr, err)
+		}
+	}
+	names := map[string]bool{}
+	for i, src := range b.Sources {
+		if (src.Path == "") == (src.URL == "") {
+			return fmt.Errorf("blocklist.sources[%d]: exactly one of path and url is required", i)
+		}
+		if src.URL != "" && !strings.HasPrefix(src.URL, "http://") && !strings.HasPrefix(src.URL, "https://") {
+			return fmt.Errorf("blocklist.sources[%d]: url must be http(s)", i)
+		}
+		switch src.Format {
+		case "", "domains", "rpz":
+		default:
+			return fmt.Errorf("blocklist.sources[%d]: format must be 'domains' or 'rpz' (got '%s')", i, src.Format)
+		}
+		if src.RefreshSec < 0 {
+			return fmt.Errorf("blocklist.sources[%d]: refresh_sec must be >= 0", i)
+		}
+		if names[src.Name] {
+			return fmt.Errorf("blocklist.sources[%d]: duplicate name '%s'", i, src.Name)
+		}
+		names[src.Name] = true
+	}
+	return nil
+}
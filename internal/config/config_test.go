@@ -1,10 +1,12 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestConfigValidation(t *testing.T) {
@@ -337,6 +339,467 @@ func TestConfigValidation(t *testing.T) {
 			expectedError: "",
 			description:   "Should accept valid IPv4 and IPv6 CIDRs",
 		},
+		{
+			name: "unsupported db driver",
+			config: &Config{
+				Listen:     "0.0.0.0:53",
+				RESTListen: "0.0.0.0:8080",
+				DB: DBConfig{
+					Driver: "oracle",
+					DSN:    "user/pass@db",
+				},
+			},
+			expectedError: "db.driver must be",
+			description:   "Should reject unknown database drivers",
+		},
+		{
+			name: "replica with sqlite",
+			config: &Config{
+				Listen:     "0.0.0.0:53",
+				RESTListen: "0.0.0.0:8080",
+				DB: DBConfig{
+					Driver:     "sqlite",
+					DSN:        ":memory:",
+					ReplicaDSN: "replica.db",
+				},
+			},
+			expectedError: "db.replica_dsn is not supported",
+			description:   "Should reject read replicas for sqlite",
+		},
+		{
+			name: "mariadb driver",
+			config: &Config{
+				Listen:     "0.0.0.0:53",
+				RESTListen: "0.0.0.0:8080",
+				DB: DBConfig{
+					Driver: "mariadb",
+					DSN:    "namedot:secret@tcp(db:3306)/namedot",
+				},
+			},
+			expectedError: "",
+			description:   "Should accept mariadb as a mysql alias",
+		},
+		{
+			name: "zone_dir enabled without path",
+			config: &Config{
+				Listen:     "0.0.0.0:53",
+				RESTListen: "0.0.0.0:8080",
+				ZoneDir:    ZoneDirConfig{Enabled: true},
+				DB: DBConfig{
+					Driver: "sqlite",
+					DSN:    ":memory:",
+				},
+			},
+			expectedError: "zone_dir.path is required",
+			description:   "Should require a directory when zone_dir is enabled",
+		},
+		{
+			name: "zone_dir with missing directory",
+			config: &Config{
+				Listen:     "0.0.0.0:53",
+				RESTListen: "0.0.0.0:8080",
+				ZoneDir:    ZoneDirConfig{Enabled: true, Path: "/nonexistent/zones"},
+				DB: DBConfig{
+					Driver: "sqlite",
+					DSN:    ":memory:",
+				},
+			},
+			expectedError: "zone_dir.path",
+			description:   "Should reject a zone directory that does not exist",
+		},
+		{
+			name: "zone_dir in slave mode",
+			config: &Config{
+				Listen:      "0.0.0.0:53",
+				RESTListen:  "0.0.0.0:8080",
+				ZoneDir:     ZoneDirConfig{Enabled: true, Path: os.TempDir()},
+				Replication: ReplicationConfig{Mode: "slave", MasterURL: "http://master:8080", SyncIntervalSec: 60},
+				DB: DBConfig{
+					Driver: "sqlite",
+					DSN:    ":memory:",
+				},
+			},
+			expectedError: "zone_dir cannot be used",
+			description:   "Should reject zone_dir on replication slaves",
+		},
+		{
+			name: "negative stats flush interval",
+			config: &Config{
+				Listen:     "0.0.0.0:53",
+				RESTListen: "0.0.0.0:8080",
+				Stats:      StatsConfig{Enabled: true, FlushSec: -1},
+				DB: DBConfig{
+					Driver: "sqlite",
+					DSN:    ":memory:",
+				},
+			},
+			expectedError: "stats.flush_sec",
+			description:   "Should reject negative stats settings",
+		},
+		{
+			name: "invalid expiry action",
+			config: &Config{
+				Listen:     "0.0.0.0:53",
+				RESTListen: "0.0.0.0:8080",
+				Expiry:     ExpiryConfig{DefaultAction: "delete"},
+				DB: DBConfig{
+					Driver: "sqlite",
+					DSN:    ":memory:",
+				},
+			},
+			expectedError: "expiry.default_action",
+			description:   "Should only allow disable or trash as expiry action",
+		},
+		{
+			name: "admin viewer user",
+			config: &Config{
+				Listen:     "0.0.0.0:53",
+				RESTListen: "0.0.0.0:8080",
+				Admin: AdminConfig{Username: "admin", PasswordHash: "x", Users: []AdminUser{
+					{Username: "noc", PasswordHash: "y", Role: RoleViewer},
+				}},
+				DB: DBConfig{
+					Driver: "sqlite",
+					DSN:    ":memory:",
+				},
+			},
+			expectedError: "",
+			description:   "Should accept additional admin users with a role",
+		},
+		{
+			name: "admin user with unknown role",
+			config: &Config{
+				Listen:     "0.0.0.0:53",
+				RESTListen: "0.0.0.0:8080",
+				Admin: AdminConfig{Username: "admin", PasswordHash: "x", Users: []AdminUser{
+					{Username: "noc", PasswordHash: "y", Role: "operator"},
+				}},
+				DB: DBConfig{
+					Driver: "sqlite",
+					DSN:    ":memory:",
+				},
+			},
+			expectedError: "role must be",
+			description:   "Should only allow admin or viewer roles",
+		},
+		{
+			name: "admin user duplicating the main user",
+			config: &Config{
+				Listen:     "0.0.0.0:53",
+				RESTListen: "0.0.0.0:8080",
+				Admin: AdminConfig{Username: "admin", PasswordHash: "x", Users: []AdminUser{
+					{Username: "admin", PasswordHash: "y", Role: RoleViewer},
+				}},
+				DB: DBConfig{
+					Driver: "sqlite",
+					DSN:    ":memory:",
+				},
+			},
+			expectedError: "duplicate username",
+			description:   "Should reject a username used twice",
+		},
+		{
+			name: "valid blocklist",
+			config: &Config{
+				Listen:     "0.0.0.0:53",
+				RESTListen: "0.0.0.0:8080",
+				Blocklist: BlocklistConfig{Enabled: true, Action: "sinkhole", SinkholeIPv4: "10.0.0.1", ExemptCIDRs: []string{"10.0.0.0/8"},
+					Sources: []BlocklistSource{{Name: "ads", URL: "https://example.com/ads.txt"}, {Name: "local", Path: "/etc/namedot/local.rpz", Format: "rpz"}}},
+				DB: DBConfig{
+					Driver: "sqlite",
+					DSN:    ":memory:",
+				},
+			},
+			expectedError: "",
+			description:   "Should accept file and URL blocklist sources",
+		},
+		{
+			name: "blocklist source with path and url",
+			config: &Config{
+				Listen:     "0.0.0.0:53",
+				RESTListen: "0.0.0.0:8080",
+				Blocklist: BlocklistConfig{Enabled: true, Sources: []BlocklistSource{{Name: "x", Path: "/tmp/x", URL: "https://example.com/x"}}},
+				DB: DBConfig{
+					Driver: "sqlite",
+					DSN:    ":memory:",
+				},
+			},
+			expectedError: "exactly one of path and url",
+			description:   "Should require either a path or a url",
+		},
+		{
+			name: "blocklist with bad sinkhole address",
+			config: &Config{
+				Listen:     "0.0.0.0:53",
+				RESTListen: "0.0.0.0:8080",
+				Blocklist: BlocklistConfig{Enabled: true, Action: "sinkhole", SinkholeIPv4: "::1", Sources: []BlocklistSource{{Name: "x", Path: "/tmp/x"}}},
+				DB: DBConfig{
+					Driver: "sqlite",
+					DSN:    ":memory:",
+				},
+			},
+			expectedError: "blocklist.sinkhole_ipv4",
+			description:   "Should require an IPv4 sinkhole for A answers",
+		},
+		{
+			name: "min_ttl above max_ttl",
+			config: &Config{
+				Listen:      "0.0.0.0:53",
+				RESTListen:  "0.0.0.0:8080",
+				Performance: PerformanceConfig{MinTTL: 600, MaxTTL: 300},
+				DB: DBConfig{
+					Driver: "sqlite",
+					DSN:    ":memory:",
+				},
+			},
+			expectedError: "performance.min_ttl",
+			description:   "Should reject a TTL floor above the cap",
+		},
+		{
+			name: "recursion with forwarder",
+			config: &Config{
+				Listen:     "0.0.0.0:53",
+				RESTListen: "0.0.0.0:8080",
+				Forwarder:  "8.8.8.8",
+				Recursion:  RecursionConfig{Enabled: true},
+				DB: DBConfig{
+					Driver: "sqlite",
+					DSN:    ":memory:",
+				},
+			},
+			expectedError: "recursion.enabled and forwarder",
+			description:   "Should reject recursion combined with a forwarder",
+		},
+		{
+			name: "dns64 with bad prefix length",
+			config: &Config{
+				Listen:     "0.0.0.0:53",
+				RESTListen: "0.0.0.0:8080",
+				DNS64:      DNS64Config{Enabled: true, Prefix: "2001:db8::/80"},
+				DB: DBConfig{
+					Driver: "sqlite",
+					DSN:    ":memory:",
+				},
+			},
+			expectedError: "dns64.prefix",
+			description:   "Should reject NAT64 prefixes RFC 6052 does not define",
+		},
+		{
+			name: "stub zone with hostname server",
+			config: &Config{
+				Listen:     "0.0.0.0:53",
+				RESTListen: "0.0.0.0:8080",
+				StubZones:  []StubZone{{Zone: "corp.example", Servers: []string{"10.0.0.53", "ns1.corp.example"}}},
+				DB: DBConfig{
+					Driver: "sqlite",
+					DSN:    ":memory:",
+				},
+			},
+			expectedError: "must be an IP or IP:port",
+			description:   "Should require stub zone servers as addresses",
+		},
+		{
+			name: "tsig key with unsupported algorithm",
+			config: &Config{
+				Listen:     "0.0.0.0:53",
+				RESTListen: "0.0.0.0:8080",
+				TSIGKeys:   []TSIGKey{{Name: "xfr", Algorithm: "hmac-md5", Secret: "c2VjcmV0"}},
+				DB: DBConfig{
+					Driver: "sqlite",
+					DSN:    ":memory:",
+				},
+			},
+			expectedError: "unsupported algorithm",
+			description:   "Should reject TSIG algorithms other than HMAC-SHA",
+		},
+		{
+			name: "tsig key with bad secret",
+			config: &Config{
+				Listen:     "0.0.0.0:53",
+				RESTListen: "0.0.0.0:8080",
+				TSIGKeys:   []TSIGKey{{Name: "xfr", Algorithm: "hmac-sha256", Secret: "not base64!"}},
+				DB: DBConfig{
+					Driver: "sqlite",
+					DSN:    ":memory:",
+				},
+			},
+			expectedError: "secret must be base64",
+			description:   "Should require base64 TSIG secrets",
+		},
+		{
+			name: "anomaly without thresholds",
+			config: &Config{
+				Listen:     "0.0.0.0:53",
+				RESTListen: "0.0.0.0:8080",
+				Anomaly:    AnomalyConfig{Enabled: true, WindowSec: 60},
+				DB: DBConfig{
+					Driver: "sqlite",
+					DSN:    ":memory:",
+				},
+			},
+			expectedError: "at least one threshold",
+			description:   "Should require a threshold when anomaly alerting is enabled",
+		},
+		{
+			name: "relative chroot",
+			config: &Config{
+				Listen:     "0.0.0.0:53",
+				RESTListen: "0.0.0.0:8080",
+				RunAs:      RunAsConfig{User: "namedot", Chroot: "var/lib/namedot"},
+				DB: DBConfig{
+					Driver: "sqlite",
+					DSN:    ":memory:",
+				},
+			},
+			expectedError: "run_as.chroot must be an absolute path",
+			description:   "Should require an absolute chroot directory",
+		},
+		{
+			name: "rewrite with match and regex",
+			config: &Config{
+				Listen:     "0.0.0.0:53",
+				RESTListen: "0.0.0.0:8080",
+				Rewrite:    []RewriteRule{{Match: "*.dev.example.com", Regex: "^dev$", To: "staging.example.com"}},
+				DB: DBConfig{
+					Driver: "sqlite",
+					DSN:    ":memory:",
+				},
+			},
+			expectedError: "rewrite[0]: set either match or regex",
+			description:   "Should require exactly one of match and regex",
+		},
+		{
+			name: "dhcp reverse zone outside arpa",
+			config: &Config{
+				Listen:     "0.0.0.0:53",
+				RESTListen: "0.0.0.0:8080",
+				DHCP:       DHCPConfig{Enabled: true, Zone: "lan.example.com", ReverseZone: "example.com"},
+				DB: DBConfig{
+					Driver: "sqlite",
+					DSN:    ":memory:",
+				},
+			},
+			expectedError: "dhcp.reverse_zone must be an in-addr.arpa or ip6.arpa zone",
+			description:   "Should only accept reverse zones for PTR records",
+		},
+		{
+			name: "discovery with unknown provider",
+			config: &Config{
+				Listen:     "0.0.0.0:53",
+				RESTListen: "0.0.0.0:8080",
+				Discovery:  DiscoveryConfig{Enabled: true, Provider: "nomad", Zone: "svc.example.com"},
+				DB: DBConfig{
+					Driver: "sqlite",
+					DSN:    ":memory:",
+				},
+			},
+			expectedError: "discovery.provider must be 'docker' or 'kubernetes'",
+			description:   "Should reject unsupported discovery providers",
+		},
+		{
+			name: "publish target without credentials",
+			config: &Config{
+				Listen:     "0.0.0.0:53",
+				RESTListen: "0.0.0.0:8080",
+				Publish: PublishConfig{Enabled: true, Targets: []PublishTarget{
+					{Provider: "route53", Zones: []string{"example.com"}, AccessKeyID: "AKID"},
+				}},
+				DB: DBConfig{
+					Driver: "sqlite",
+					DSN:    ":memory:",
+				},
+			},
+			expectedError: "route53 needs access_key_id and secret_access_key",
+			description:   "Should reject route53 targets without both keys",
+		},
+		{
+			name: "stub zone with unknown ecs mode",
+			config: &Config{
+				Listen:     "0.0.0.0:53",
+				RESTListen: "0.0.0.0:8080",
+				StubZones: []StubZone{
+					{Zone: "corp.example", Servers: []string{"10.0.0.53"}, ECS: ECSConfig{Mode: "always"}},
+				},
+				DB: DBConfig{
+					Driver: "sqlite",
+					DSN:    ":memory:",
+				},
+			},
+			expectedError: "stub_zones[0].ecs.mode must be strip, forward or inject",
+			description:   "Should reject unknown ECS modes",
+		},
+		{
+			name: "forwarder ecs prefix too long",
+			config: &Config{
+				Listen:       "0.0.0.0:53",
+				RESTListen:   "0.0.0.0:8080",
+				Forwarder:    "8.8.8.8",
+				ForwarderECS: ECSConfig{Mode: ECSInject, SourceV4: 33},
+				DB: DBConfig{
+					Driver: "sqlite",
+					DSN:    ":memory:",
+				},
+			},
+			expectedError: "forwarder_ecs.source_v4 must be between 0 and 32",
+			description:   "Should reject IPv4 ECS prefixes longer than 32 bits",
+		},
+		{
+			name: "unknown deny policy",
+			config: &Config{
+				Listen:     "0.0.0.0:53",
+				RESTListen: "0.0.0.0:8080",
+				Deny:       DenyConfig{Recursion: DenyDrop, DisabledZones: "servfail"},
+				DB: DBConfig{
+					Driver: "sqlite",
+					DSN:    ":memory:",
+				},
+			},
+			expectedError: "deny.disabled_zones must be 'refused', 'nxdomain' or 'drop'",
+			description:   "Should reject deny policies other than refused, nxdomain and drop",
+		},
+		{
+			name: "blocklist drop action",
+			config: &Config{
+				Listen:     "0.0.0.0:53",
+				RESTListen: "0.0.0.0:8080",
+				Blocklist:  BlocklistConfig{Action: DenyDrop},
+				DB: DBConfig{
+					Driver: "sqlite",
+					DSN:    ":memory:",
+				},
+			},
+			expectedError: "",
+			description:   "Should accept drop as a blocklist action",
+		},
+		{
+			name: "record ttl min above max",
+			config: &Config{
+				Listen:     "0.0.0.0:53",
+				RESTListen: "0.0.0.0:8080",
+				RecordTTL:  RecordTTLConfig{Min: 3600, Max: 60},
+				DB: DBConfig{
+					Driver: "sqlite",
+					DSN:    ":memory:",
+				},
+			},
+			expectedError: "record_ttl.min must not be greater than record_ttl.max",
+			description:   "Should reject inverted record TTL limits",
+		},
+		{
+			name: "default ttl outside record ttl",
+			config: &Config{
+				Listen:     "0.0.0.0:53",
+				RESTListen: "0.0.0.0:8080",
+				DefaultTTL: 30,
+				RecordTTL:  RecordTTLConfig{Min: 60},
+				DB: DBConfig{
+					Driver: "sqlite",
+					DSN:    ":memory:",
+				},
+			},
+			expectedError: "default_ttl: ttl 30 is below record_ttl.min (60)",
+			description:   "Should reject a default TTL the limits would refuse",
+		},
 	}
 
 	for _, tt := range tests {
@@ -619,3 +1082,179 @@ replication:
 		t.Error("Expected admin to be auto-disabled in slave mode, but it's still enabled")
 	}
 }
+
+func TestSyncWindows(t *testing.T) {
+	// 2026-10-16 is a Friday
+	at := func(day int, clock string) time.Time {
+		tm, err := time.ParseInLocation("2006-01-02 15:04", fmt.Sprintf("2026-10-%02d %s", day, clock), time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	r := ReplicationConfig{SyncWindows: []string{"mon-fri 19:00-07:00", "sat,sun 00:00-24:00"}}
+	tests := []struct {
+		when time.Time
+		want bool
+	}{
+		{at(16, "12:00"), false}, // Friday business hours
+		{at(16, "19:00"), true},
+		{at(16, "06:59"), true},  // Thursday's window runs into Friday
+		{at(17, "03:00"), true},  // Friday's window runs into Saturday, also a weekend day
+		{at(19, "06:00"), false}, // Monday morning: Sunday has no night window
+		{at(19, "20:00"), true},
+	}
+	for _, tt := range tests {
+		if got := r.SyncAllowed(tt.when); got != tt.want {
+			t.Errorf("SyncAllowed(%s) = %v, want %v", tt.when.Format("Mon 15:04"), got, tt.want)
+		}
+	}
+	if !(ReplicationConfig{}).SyncAllowed(at(16, "12:00")) {
+		t.Error("no windows should allow any time")
+	}
+
+	for _, bad := range []string{"", "19:00", "mon-xyz 01:00-02:00", "25:00-02:00", "10:00-10:00", "a b c"} {
+		if _, err := ParseSyncWindow(bad); err == nil {
+			t.Errorf("ParseSyncWindow(%q) should fail", bad)
+		}
+	}
+	_, err := Parse([]byte("db:\n  driver: sqlite\n  dsn: \":memory:\"\nreplication:\n  sync_windows: [\"19:00\"]\n"))
+	if err == nil || !strings.Contains(err.Error(), "sync_windows") {
+		t.Errorf("Parse: %v", err)
+	}
+}
+
+func TestNotifyAddr(t *testing.T) {
+	for in, want := range map[string]string{
+		"192.0.2.53":        "192.0.2.53:53",
+		" 192.0.2.53:5353 ": "192.0.2.53:5353",
+		"2001:db8::53":      "[2001:db8::53]:53",
+		"[2001:db8::53]:54": "[2001:db8::53]:54",
+	} {
+		if got, err := NotifyAddr(in); err != nil || got != want {
+			t.Errorf("NotifyAddr(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"", "ns1.example.com", "192.0.2.53:0"} {
+		if _, err := NotifyAddr(bad); err == nil {
+			t.Errorf("NotifyAddr(%q) should fail", bad)
+		}
+	}
+	_, err := Parse([]byte("db:\n  driver: sqlite\n  dsn: \":memory:\"\nreplication:\n  notify_from: [\"192.0.2.1\"]\n"))
+	if err == nil || !strings.Contains(err.Error(), "notify_from") {
+		t.Errorf("Parse: %v", err)
+	}
+}
+
+func TestNodeID(t *testing.T) {
+	base := "db:\n  driver: sqlite\n  dsn: \":memory:\"\n"
+	cfg, err := Parse([]byte(base + "node_id: fra-1\n"))
+	if err != nil || cfg.NodeIDName != "id.server." {
+		t.Fatalf("default name %q: %v", cfg.NodeIDName, err)
+	}
+	cfg, err = Parse([]byte(base + "node_id: fra-1\nnode_id_name: Node.Example\n"))
+	if err != nil || cfg.NodeIDName != "node.example." {
+		t.Fatalf("name %q: %v", cfg.NodeIDName, err)
+	}
+	if _, err := Parse([]byte(base + "node_id: \"fra 1\"\n")); err == nil || !strings.Contains(err.Error(), "node_id") {
+		t.Errorf("node_id with a space: %v", err)
+	}
+}
+
+func TestQueryLog(t *testing.T) {
+	base := "db:\n  driver: sqlite\n  dsn: \":memory:\"\n"
+	cfg, err := Parse([]byte(base + "query_log:\n  enabled: true\n  path: /var/log/namedot/queries.log\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if q := cfg.QueryLog; q.MaxSizeMB != 100 || q.MaxAgeHours != 24 || q.MaxFiles != 7 || !q.LogAnswers() {
+		t.Fatalf("defaults: %+v", q)
+	}
+	if _, err := Parse([]byte(base + "query_log:\n  enabled: true\n")); err == nil || !strings.Contains(err.Error(), "query_log.path") {
+		t.Errorf("missing path: %v", err)
+	}
+}
+
+func TestDnstap(t *testing.T) {
+	base := "db:\n  driver: sqlite\n  dsn: \":memory:\"\n"
+	cfg, err := Parse([]byte(base + "log:\n  dnstap:\n    enabled: true\n    socket: /run/dnstap.sock\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if d := cfg.Log.Dnstap; !d.Enabled || d.Socket != "/run/dnstap.sock" {
+		t.Fatalf("dnstap: %+v", d)
+	}
+	if _, err := Parse([]byte(base + "log:\n  dnstap:\n    enabled: true\n")); err == nil || !strings.Contains(err.Error(), "log.dnstap.socket") {
+		t.Errorf("missing socket: %v", err)
+	}
+}
+
+func TestWatchdog(t *testing.T) {
+	base := "db:\n  driver: sqlite\n  dsn: \":memory:\"\n"
+	cfg, err := Parse([]byte(base + "watchdog:\n  enabled: true\n  max_goroutines: 10000\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if w := cfg.Watchdog; w.IntervalSec != 10 || w.CooldownSec != 300 || w.RestartListeners {
+		t.Fatalf("defaults: %+v", w)
+	}
+	if _, err := Parse([]byte(base + "watchdog:\n  enabled: true\n")); err == nil || !strings.Contains(err.Error(), "watchdog") {
+		t.Errorf("no limit: %v", err)
+	}
+	if _, err := Parse([]byte(base + "watchdog:\n  max_heap_mb: -1\n")); err == nil {
+		t.Error("negative max_heap_mb accepted")
+	}
+}
+
+func TestHealthChecks(t *testing.T) {
+	base := "db:\n  driver: sqlite\n  dsn: \":memory:\"\n"
+	cfg, err := Parse([]byte(base + "health_checks:\n  enabled: true\n"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if h := cfg.HealthChecks; h.IntervalSec != 10 || h.TimeoutMs != 2000 || h.Fall != 3 || h.Rise != 2 {
+		t.Fatalf("defaults: %+v", h)
+	}
+	if _, err := Parse([]byte(base + "health_checks:\n  interval_sec: 1\n  timeout_ms: 1500\n")); err == nil || !strings.Contains(err.Error(), "health_checks.timeout_ms") {
+		t.Errorf("timeout above interval: %v", err)
+	}
+	if _, err := Parse([]byte(base + "health_checks:\n  fall: -1\n")); err == nil {
+		t.Error("negative fall accepted")
+	}
+}
+
+func TestConnectRetry(t *testing.T) {
+	base := "db:\n  driver: sqlite\n  dsn: \":memory:\"\n"
+	for in, want := range map[string]int{"": 30, "  connect_retry_sec: 5\n": 5, "  connect_retry_sec: -1\n": -1} {
+		cfg, err := Parse([]byte(base + in))
+		if err != nil {
+			t.Fatalf("parse %q: %v", in, err)
+		}
+		if cfg.DB.ConnectRetrySec != want {
+			t.Errorf("%q: connect_retry_sec %d, want %d", in, cfg.DB.ConnectRetrySec, want)
+		}
+	}
+	if _, err := Parse([]byte(base + "  connect_retry_sec: -2\n")); err == nil || !strings.Contains(err.Error(), "db.connect_retry_sec") {
+		t.Errorf("connect_retry_sec -2: %v", err)
+	}
+}
+
+func TestDynamicRecords(t *testing.T) {
+	base := "db:\n  driver: sqlite\n  dsn: \":memory:\"\n"
+	cfg, err := Parse([]byte(base))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if d := cfg.DynamicRecords; d.TimeoutMs != 2000 || d.CacheSec != 0 || d.MaxStaleSec != 300 {
+		t.Fatalf("defaults: %+v", d)
+	}
+	if cfg, err = Parse([]byte(base + "dynamic_records:\n  max_stale_sec: -1\n")); err != nil || cfg.DynamicRecords.MaxStaleSec != -1 {
+		t.Fatalf("max_stale_sec -1: %v", err)
+	}
+	if _, err := Parse([]byte(base + "dynamic_records:\n  max_stale_sec: -2\n")); err == nil || !strings.Contains(err.Error(), "dynamic_records.max_stale_sec") {
+		t.Errorf("max_stale_sec -2: %v", err)
+	}
+	if _, err := Parse([]byte(base + "dynamic_records:\n  timeout_ms: -1\n")); err == nil {
+		t.Error("negative timeout_ms accepted")
+	}
+}
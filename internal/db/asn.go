@@ -0,0 +1,112 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxASN is the largest 4-byte AS number.
+const maxASN = 1<<32 - 1
+
+// asnRange is an inclusive range of AS numbers.
+type asnRange struct{ from, to uint64 }
+
+// NormalizeASNs parses an ASN list selector, AS numbers and ranges separated
+// by commas or spaces such as "3320, AS8881 64512-65534", and returns it in
+// canonical form: sorted, overlapping and adjacent ranges merged, "3320,
+// 8881,64512-65534" without the spaces. An empty list is an error.
+func NormalizeASNs(s string) (string, error) {
+	var ranges []asnRange
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+		from, to, isRange := strings.Cut(f, "-")
+		a, err := parseASN(from)
+		if err != nil {
+			return "", err
+		}
+		b := a
+		if isRange {
+			if b, err = parseASN(to); err != nil {
+				return "", err
+			}
+			if b < a {
+				return "", fmt.Errorf("ASN range %s is reversed", f)
+			}
+		}
+		ranges = append(ranges, asnRange{a, b})
+	}
+	if len(ranges) == 0 {
+		return "", fmt.Errorf("ASN list is empty")
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].from < ranges[j].from })
+	merged := ranges[:1]
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r.from <= last.to+1 {
+			last.to = max(last.to, r.to)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	parts := make([]string, len(merged))
+	for i, r := range merged {
+		parts[i] = strconv.FormatUint(r.from, 10)
+		if r.to != r.from {
+			parts[i] += "-" + strconv.FormatUint(r.to, 10)
+		}
+	}
+	return strings.Join(parts, ","), nil
+}
+
+func parseASN(s string) (uint64, error) {
+	n, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(s), "AS"), 10, 32)
+	if err != nil || n == 0 || n > maxASN {
+		return 0, fmt.Errorf("invalid ASN %q", s)
+	}
+	return n, nil
+}
+
+// asnListContains reports whether asn is in the ASN list s, as returned by
+// NormalizeASNs, without allocating as it runs for each geo query.
+func asnListContains(s string, asn int) bool {
+	if asn <= 0 {
+		return false
+	}
+	want := uint64(asn)
+	for s != "" {
+		item := s
+		if i := strings.IndexByte(s, ','); i >= 0 {
+			item, s = s[:i], s[i+1:]
+		} else {
+			s = ""
+		}
+		from, to, isRange := strings.Cut(item, "-")
+		a, err := strconv.ParseUint(from, 10, 64)
+		if err != nil {
+			continue
+		}
+		b := a
+		if isRange {
+			if b, err = strconv.ParseUint(to, 10, 64); err != nil {
+				continue
+			}
+		}
+		if a <= want && want <= b {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesASN reports whether the ASN selectors of r, the single ASN or the
+// ASN list, include asn.
+func (r RData) MatchesASN(asn int) bool {
+	if asn == 0 {
+		return false
+	}
+	if r.ASN != nil && *r.ASN == asn {
+		return true
+	}
+	return r.ASNs != nil && asnListContains(*r.ASNs, asn)
+}
@@ -0,0 +1,50 @@
+package db
+
+import "testing"
+
+func TestNormalizeASNs(t *testing.T) {
+	for in, want := range map[string]string{
+		"3320":                         "3320",
+		"AS3320, as8881":               "3320,8881",
+		"64512-65534 3320 64600-65535": "3320,64512-65535",
+		"100-199,200,201-300":          "100-300",
+		"4294967295":                   "4294967295",
+	} {
+		got, err := NormalizeASNs(in)
+		if err != nil || got != want {
+			t.Errorf("NormalizeASNs(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", " , ", "0", "abc", "65534-64512", "4294967296", "1-"} {
+		if got, err := NormalizeASNs(in); err == nil {
+			t.Errorf("NormalizeASNs(%q) = %q, want an error", in, got)
+		}
+	}
+}
+
+func TestRData_MatchesASN(t *testing.T) {
+	one, list := 3320, "100-200,64512-65534"
+	r := RData{ASN: &one, ASNs: &list}
+	for asn, want := range map[int]bool{3320: true, 100: true, 150: true, 200: true, 201: false, 65534: true, 65535: false, 0: false} {
+		if got := r.MatchesASN(asn); got != want {
+			t.Errorf("MatchesASN(%d) = %v, want %v", asn, got, want)
+		}
+	}
+}
+
+func TestRData_ASNListIsNormalizedOnSave(t *testing.T) {
+	db := newIsolatedDB(t)
+	z := createZoneWithSets(t, db, "asn.example.", "www.asn.example.")
+	list := "AS65000-65010, 3320"
+	rec := RData{RRSetID: z.RRSets[0].ID, Data: "192.0.2.7", ASNs: &list}
+	if err := db.Create(&rec).Error; err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if *rec.ASNs != "3320,65000-65010" {
+		t.Fatalf("stored %q", *rec.ASNs)
+	}
+	bad := "65010-65000"
+	if err := db.Create(&RData{RRSetID: z.RRSets[0].ID, Data: "192.0.2.8", ASNs: &bad}).Error; err == nil {
+		t.Fatal("a reversed range was saved")
+	}
+}
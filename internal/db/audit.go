@@ -0,0 +1,132 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AuditEntry records one change made through the web admin or the REST API.
+// Zone and RRSet are kept by ID and name, so entries outlive what they refer to.
+type AuditEntry struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	Actor     string    `gorm:"size:128;index" json:"actor"` // admin user name, or AuditActorAPI
+	Action    string    `gorm:"size:32;index" json:"action"`
+	ZoneID    uint      `gorm:"index" json:"zone_id,omitempty"`
+	ZoneName  string    `gorm:"size:255" json:"zone_name,omitempty"`
+	RRSetID   uint      `gorm:"index" json:"rrset_id,omitempty"`
+	Summary   string    `gorm:"type:text" json:"summary"`
+}
+
+// AuditActorAPI is the actor of changes made with the REST API token.
+const AuditActorAPI = "api"
+
+// AuditActorCLI is the actor of changes made with namedot subcommands.
+const AuditActorCLI = "cli"
+
+// Audit actions.
+const (
+	AuditZoneCreate       = "zone.create"
+	AuditZoneUpdate       = "zone.update"
+	AuditZoneDelete       = "zone.delete"
+	AuditZoneRestore      = "zone.restore"
+	AuditZonePurge        = "zone.purge"
+	AuditZoneImport       = "zone.import"
+	AuditZoneClone        = "zone.clone"
+	AuditZoneLock         = "zone.lock"
+	AuditZoneUnlock       = "zone.unlock"
+	AuditSOAUpdate        = "soa.update"
+	AuditSettingsUpdate   = "settings.update"
+	AuditMailAuth         = "mailauth.apply"
+	AuditCanaryStage      = "canary.stage"
+	AuditCanaryPromote    = "canary.promote"
+	AuditCanaryRevert     = "canary.revert"
+	AuditRRSetCreate      = "rrset.create"
+	AuditRRSetUpdate      = "rrset.update"
+	AuditRRSetDelete      = "rrset.delete"
+	AuditRecordCreate     = "record.create"
+	AuditRecordUpdate     = "record.update"
+	AuditRecordDelete     = "record.delete"
+	AuditTemplateCreate   = "template.create"
+	AuditTemplateUpdate   = "template.update"
+	AuditTemplateDelete   = "template.delete"
+	AuditTemplateApply    = "template.apply"
+	AuditHostCreate       = "host.create"
+	AuditHostUpdate       = "host.update"
+	AuditHostDelete       = "host.delete"
+	AuditConfigUpdate     = "config.update"
+	AuditCredentialRotate = "credential.rotate"
+)
+
+// AuditActions lists the actions in the order of the filter select.
+var AuditActions = []string{
+	AuditZoneCreate, AuditZoneUpdate, AuditZoneDelete, AuditZoneRestore, AuditZonePurge,
+	AuditZoneImport, AuditZoneClone, AuditZoneLock, AuditZoneUnlock, AuditSOAUpdate, AuditSettingsUpdate, AuditMailAuth,
+	AuditCanaryStage, AuditCanaryPromote, AuditCanaryRevert,
+	AuditRRSetCreate, AuditRRSetUpdate, AuditRRSetDelete,
+	AuditRecordCreate, AuditRecordUpdate, AuditRecordDelete,
+	AuditTemplateCreate, AuditTemplateUpdate, AuditTemplateDelete, AuditTemplateApply,
+	AuditHostCreate, AuditHostUpdate, AuditHostDelete, AuditConfigUpdate, AuditCredentialRotate,
+}
+
+// RecordAudit stores e, stamped with the current time.
+func RecordAudit(db *gorm.DB, e AuditEntry) error {
+	e.ID = 0
+	e.CreatedAt = time.Now().UTC()
+	return db.Create(&e).Error
+}
+
+// AuditFilter selects entries for AuditLog. Zero fields match everything.
+type AuditFilter struct {
+	ZoneID   uint
+	ZoneName string // also finds entries of purged zones
+	RRSetID  uint
+	Actor    string
+	Action   string
+	From     time.Time // inclusive
+	To       time.Time // exclusive
+}
+
+// AuditLog returns one page of the entries matching f, newest first, and the
+// total number of matching entries.
+func AuditLog(db *gorm.DB, f AuditFilter, offset, limit int) ([]AuditEntry, int64, error) {
+	q := db.Model(&AuditEntry{})
+	if f.ZoneID != 0 {
+		q = q.Where("zone_id = ?", f.ZoneID)
+	}
+	if f.ZoneName != "" {
+		q = q.Where("zone_name = ?", f.ZoneName)
+	}
+	if f.RRSetID != 0 {
+		q = q.Where("rr_set_id = ?", f.RRSetID)
+	}
+	if f.Actor != "" {
+		q = q.Where("actor = ?", f.Actor)
+	}
+	if f.Action != "" {
+		q = q.Where("action = ?", f.Action)
+	}
+	if !f.From.IsZero() {
+		q = q.Where("created_at >= ?", f.From.UTC())
+	}
+	if !f.To.IsZero() {
+		q = q.Where("created_at < ?", f.To.UTC())
+	}
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var out []AuditEntry
+	if err := q.Order("created_at desc, id desc").Offset(offset).Limit(limit).Find(&out).Error; err != nil {
+		return nil, 0, err
+	}
+	return out, total, nil
+}
+
+// AuditActors returns the distinct actors in the log, for the filter select.
+func AuditActors(db *gorm.DB) ([]string, error) {
+	var out []string
+	err := db.Model(&AuditEntry{}).Distinct("actor").Order("actor").Pluck("actor", &out).Error
+	return out, err
+}
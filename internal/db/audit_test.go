@@ -0,0 +1,63 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAuditLog(t *testing.T) {
+	db := newIsolatedDB(t)
+
+	entries := []AuditEntry{
+		{Actor: "admin", Action: AuditZoneCreate, ZoneID: 1, ZoneName: "a.test.", Summary: "a.test."},
+		{Actor: "admin", Action: AuditRecordCreate, ZoneID: 1, ZoneName: "a.test.", RRSetID: 7, Summary: "www.a.test. A 192.0.2.1"},
+		{Actor: AuditActorAPI, Action: AuditRRSetUpdate, ZoneID: 1, ZoneName: "a.test.", RRSetID: 7, Summary: "www.a.test. A 300 [192.0.2.2]"},
+		{Actor: AuditActorAPI, Action: AuditZoneCreate, ZoneID: 2, ZoneName: "b.test.", Summary: "b.test."},
+	}
+	for _, e := range entries {
+		if err := RecordAudit(db, e); err != nil {
+			t.Fatalf("record: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter AuditFilter
+		want   int
+	}{
+		{"all", AuditFilter{}, 4},
+		{"zone id", AuditFilter{ZoneID: 1}, 3},
+		{"zone name", AuditFilter{ZoneName: "b.test."}, 1},
+		{"rrset", AuditFilter{RRSetID: 7}, 2},
+		{"actor", AuditFilter{Actor: AuditActorAPI}, 2},
+		{"action", AuditFilter{Action: AuditZoneCreate}, 2},
+		{"combined", AuditFilter{Actor: "admin", RRSetID: 7}, 1},
+		{"date range", AuditFilter{From: time.Now().Add(-time.Hour), To: time.Now().Add(time.Hour)}, 4},
+		{"future", AuditFilter{From: time.Now().Add(time.Hour)}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, total, err := AuditLog(db, tt.filter, 0, 10)
+			if err != nil {
+				t.Fatalf("audit log: %v", err)
+			}
+			if int(total) != tt.want || len(got) != tt.want {
+				t.Fatalf("got %d entries (total %d), want %d", len(got), total, tt.want)
+			}
+		})
+	}
+
+	// Newest first, paged
+	got, total, err := AuditLog(db, AuditFilter{}, 1, 2)
+	if err != nil || total != 4 || len(got) != 2 {
+		t.Fatalf("page: %d entries, total %d, %v", len(got), total, err)
+	}
+	if got[0].Action != AuditRRSetUpdate || got[1].Action != AuditRecordCreate {
+		t.Fatalf("unexpected order: %s, %s", got[0].Action, got[1].Action)
+	}
+
+	actors, err := AuditActors(db)
+	if err != nil || len(actors) != 2 || actors[0] != "admin" || actors[1] != AuditActorAPI {
+		t.Fatalf("actors = %v, %v", actors, err)
+	}
+}
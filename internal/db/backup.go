@@ -76,9 +76,8 @@ func ImportZones(db *gorm.DB, filename string, mode string) error {
 		}
 
 		// Import zones
-		for _, zone := range backup.Zones {
-			// Normalize zone name
-			zoneName := normalizeFQDN(zone.Name)
+		for _, zone := range mergeBackupZones(backup.Zones) {
+			zoneName := zone.Name
 
 			var existingZone Zone
 			err := tx.Where("name = ?", zoneName).First(&existingZone).Error
@@ -101,23 +100,26 @@ func ImportZones(db *gorm.DB, filename string, mode string) error {
 					return fmt.Errorf("failed to get rrset ids: %w", err)
 				}
 				if len(rrsetIDs) > 0 {
-					if err := tx.Where("rr_set_id IN ?", rrsetIDs).Delete(&RData{}).Error; err != nil {
+					if err := tx.Unscoped().Where("rr_set_id IN ?", rrsetIDs).Delete(&RData{}).Error; err != nil {
 						return fmt.Errorf("failed to delete records: %w", err)
 					}
 				}
-				if err := tx.Where("zone_id = ?", existingZone.ID).Delete(&RRSet{}).Error; err != nil {
+				if err := tx.Unscoped().Where("zone_id = ?", existingZone.ID).Delete(&RRSet{}).Error; err != nil {
 					return fmt.Errorf("failed to delete rrsets: %w", err)
 				}
 			}
 
 			// Import RRSets
-			for _, rrset := range zone.RRSets {
+			rrsets, _ := NormalizeRRSets(zone.RRSets)
+			for _, rrset := range rrsets {
 				newRRSet := RRSet{
-					ZoneID:  existingZone.ID,
-					Name:    normalizeFQDN(rrset.Name),
-					Type:    strings.ToUpper(rrset.Type),
-					TTL:     rrset.TTL,
-					Records: rrset.Records,
+					ZoneID:     existingZone.ID,
+					Name:       rrset.Name,
+					Type:       rrset.Type,
+					TTL:        rrset.TTL,
+					Comment:    rrset.Comment,
+					DynamicURL: rrset.DynamicURL,
+					Records:    rrset.Records,
 				}
 
 				// Clear IDs from imported records
@@ -130,8 +132,26 @@ func ImportZones(db *gorm.DB, filename string, mode string) error {
 					return fmt.Errorf("failed to create rrset %s/%s: %w", rrset.Name, rrset.Type, err)
 				}
 			}
+			SyncZoneSerial(tx, existingZone.ID)
 		}
 
 		return nil
 	})
 }
+
+// mergeBackupZones normalizes zone names and merges the zones of a backup
+// that differ only by case or trailing dot, in first-seen order.
+func mergeBackupZones(zones []Zone) []Zone {
+	index := make(map[string]int, len(zones))
+	out := make([]Zone, 0, len(zones))
+	for _, z := range zones {
+		z.Name = normalizeFQDN(z.Name)
+		if i, ok := index[z.Name]; ok {
+			out[i].RRSets = append(out[i].RRSets, z.RRSets...)
+			continue
+		}
+		index[z.Name] = len(out)
+		out = append(out, z)
+	}
+	return out
+}
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ZoneCanary is a staged version of a zone. Clients in CIDRs are answered
+// from RRSets, everyone else from the active zone, until the canary is
+// promoted (its rrsets replace the zone's) or reverted (deleted).
+type ZoneCanary struct {
+	ZoneID     uint      `gorm:"primaryKey;autoIncrement:false" json:"zone_id"`
+	CIDRs      []string  `gorm:"serializer:json;type:text" json:"cidrs"`  // Clients (transport address or ECS) served the canary
+	BaseSerial uint32    `json:"base_serial"`                             // Zone serial the canary was staged against
+	RRSets     []RRSet   `gorm:"serializer:json;type:text" json:"rrsets"` // Desired zone contents, without the SOA
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// ErrInvalidCanary is returned for a canary without CIDRs or with a bad one.
+var ErrInvalidCanary = errors.New("invalid canary")
+
+// NormalizeCanaryCIDRs validates cidrs and puts them in canonical form; a
+// bare address stands for itself.
+func NormalizeCanaryCIDRs(cidrs []string) ([]string, error) {
+	out := make([]string, 0, len(cidrs))
+	for _, c := range cidrs {
+		c = strings.TrimSpace(c)
+		p, err := netip.ParsePrefix(c)
+		if err != nil {
+			a, aerr := netip.ParseAddr(c)
+			if aerr != nil {
+				return nil, fmt.Errorf("%w: cidr %q", ErrInvalidCanary, c)
+			}
+			p = netip.PrefixFrom(a.Unmap(), a.Unmap().BitLen())
+		}
+		out = append(out, p.Masked().String())
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%w: at least one cidr is required", ErrInvalidCanary)
+	}
+	return out, nil
+}
+
+// GetZoneCanary returns the canary of a zone, or nil when none is staged.
+func GetZoneCanary(db *gorm.DB, zoneID uint) (*ZoneCanary, error) {
+	var c ZoneCanary
+	if err := db.Where("zone_id = ?", zoneID).Limit(1).Find(&c).Error; err != nil {
+		return nil, err
+	}
+	if c.ZoneID == 0 {
+		return nil, nil
+	}
+	return &c, nil
+}
+
+// ListZoneCanaries returns all staged canaries.
+func ListZoneCanaries(db *gorm.DB) ([]ZoneCanary, error) {
+	var out []ZoneCanary
+	err := db.Order("zone_id").Find(&out).Error
+	return out, err
+}
+
+// SaveZoneCanary stores c, replacing an earlier canary of the zone.
+func SaveZoneCanary(db *gorm.DB, c ZoneCanary) error {
+	return db.Save(&c).Error
+}
+
+// DeleteZoneCanary removes the canary of a zone, if any.
+func DeleteZoneCanary(db *gorm.DB, zoneID uint) error {
+	return db.Where("zone_id = ?", zoneID).Delete(&ZoneCanary{}).Error
+}
+
+// Serves reports whether a client at addr is in the canary CIDRs.
+func (c ZoneCanary) Serves(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, s := range c.CIDRs {
+		if p, err := netip.ParsePrefix(s); err == nil && p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ClientStat counts DNS queries from one client subnet (/24 or /48) within
+// one hour.
+type ClientStat struct {
+	ID      uint      `gorm:"primaryKey" json:"-"`
+	Subnet  string    `gorm:"size:64;uniqueIndex:idx_client_stat" json:"subnet"`
+	Hour    time.Time `gorm:"uniqueIndex:idx_client_stat;index" json:"-"`
+	Queries int64     `json:"queries"`
+}
+
+// ClientCount is one in-memory subnet counter to be added to the stats table.
+type ClientCount struct {
+	Subnet  string
+	Queries int64
+}
+
+// AddClientCounts adds counters to the hourly rows for hour, creating rows as needed.
+func AddClientCounts(db *gorm.DB, hour time.Time, counts []ClientCount) error {
+	hour = hour.UTC().Truncate(time.Hour)
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, c := range counts {
+			res := tx.Model(&ClientStat{}).
+				Where("subnet = ? AND hour = ?", c.Subnet, hour).
+				UpdateColumn("queries", gorm.Expr("queries + ?", c.Queries))
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected > 0 {
+				continue
+			}
+			if err := tx.Create(&ClientStat{Subnet: c.Subnet, Hour: hour, Queries: c.Queries}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ClientStats returns the query counts per subnet in [from, to), busiest
+// first, at most limit rows (0 = all).
+func ClientStats(db *gorm.DB, from, to time.Time, limit int) ([]ClientStat, error) {
+	q := db.Model(&ClientStat{}).
+		Select("subnet, SUM(queries) AS queries").
+		Where("hour >= ? AND hour < ?", from.UTC(), to.UTC()).
+		Group("subnet").
+		Order("queries desc, subnet")
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+	var out []ClientStat
+	if err := q.Scan(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ClientStatsTotal returns the number of queries counted in [from, to).
+func ClientStatsTotal(db *gorm.DB, from, to time.Time) (int64, error) {
+	var total int64
+	err := db.Model(&ClientStat{}).
+		Select("COALESCE(SUM(queries), 0)").
+		Where("hour >= ? AND hour < ?", from.UTC(), to.UTC()).
+		Scan(&total).Error
+	return total, err
+}
+
+// PurgeClientStats deletes hourly subnet counters older than before.
+func PurgeClientStats(db *gorm.DB, before time.Time) (int64, error) {
+	res := db.Where("hour < ?", before.UTC()).Delete(&ClientStat{})
+	return res.RowsAffected, res.Error
+}
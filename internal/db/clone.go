@@ -0,0 +1,168 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+	"gorm.io/gorm"
+)
+
+// TemplateDomain is the placeholder for the zone origin in template records.
+const TemplateDomain = "{domain}"
+
+// ReplaceOrigin replaces the zone origin (with or without trailing dot) in a
+// record name or data by with. Only whole names match: "example.com" is found
+// in "www.example.com." but not in "myexample.com" or "example.com.au".
+func ReplaceOrigin(s, origin, with string) string {
+	origin = strings.TrimSuffix(origin, ".")
+	if origin == "" {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		end := i + len(origin)
+		if end <= len(s) && strings.EqualFold(s[i:end], origin) && originBoundary(s, i, end) {
+			b.WriteString(with)
+			i = end
+			continue
+		}
+		b.WriteByte(s[i])
+		i++
+	}
+	return b.String()
+}
+
+func originBoundary(s string, start, end int) bool {
+	if start > 0 && isNameChar(s[start-1]) {
+		return false
+	}
+	if end == len(s) {
+		return true
+	}
+	if s[end] == '.' {
+		// A trailing dot ends the name, a dot before another label extends it
+		return end+1 == len(s) || !isNameChar(s[end+1])
+	}
+	return !isNameChar(s[end])
+}
+
+func isNameChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_'
+}
+
+// CloneZone creates a zone called name with copies of all RRSets of the zone
+// srcID. The origin is rewritten in owner names and record data; the SOA is
+// rewritten the same way and starts with a fresh serial.
+func CloneZone(db *gorm.DB, srcID uint, name string) (*Zone, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	if _, ok := dns.IsDomainName(name); !ok || name == "." {
+		return nil, fmt.Errorf("invalid zone name %q", name)
+	}
+	if ZoneNameInTrash(db, name) {
+		return nil, ErrZoneNameInTrash
+	}
+	var exists int64
+	if err := db.Model(&Zone{}).Where("name = ?", name).Count(&exists).Error; err != nil {
+		return nil, err
+	}
+	if exists > 0 {
+		return nil, fmt.Errorf("zone %s already exists", name)
+	}
+
+	var src Zone
+	if err := db.Preload("RRSets.Records").First(&src, srcID).Error; err != nil {
+		return nil, err
+	}
+	from, to := strings.TrimSuffix(src.Name, "."), strings.TrimSuffix(name, ".")
+
+	clone := Zone{Name: name}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, rr := range src.RRSets {
+			if rr.Type == "SOA" {
+				continue
+			}
+			set := RRSet{Name: ReplaceOrigin(rr.Name, from, to), Type: rr.Type, TTL: rr.TTL, Comment: rr.Comment, DynamicURL: rr.DynamicURL}
+			for _, rec := range rr.Records {
+				set.Records = append(set.Records, RData{
+					Data:        ReplaceOrigin(rec.Data, from, to),
+					Country:     rec.Country,
+					Continent:   rec.Continent,
+					ASN:         rec.ASN,
+					ASNs:        rec.ASNs,
+					Subnet:      rec.Subnet,
+					TTL:         rec.TTL,
+					Weight:      rec.Weight,
+					HealthCheck: rec.HealthCheck,
+					Backup:      rec.Backup,
+					Disabled:    rec.Disabled,
+				})
+			}
+			clone.RRSets = append(clone.RRSets, set)
+		}
+		if err := tx.Create(&clone).Error; err != nil {
+			return err
+		}
+
+		soa, err := GetSOA(tx, src.ID)
+		if errors.Is(err, ErrNoSOA) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		soa.Primary = ReplaceOrigin(soa.Primary, from, to)
+		soa.Hostmaster = ReplaceOrigin(soa.Hostmaster, from, to)
+		_, err = SetSOA(tx, clone, soa)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &clone, nil
+}
+
+// ZoneToTemplate saves the records of a zone as a new template, with the
+// origin replaced by {domain} so the template can be applied to other zones.
+// The SOA is left out: it belongs to the zone, not to its contents.
+func ZoneToTemplate(db *gorm.DB, zoneID uint, name, description string) (*Template, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("template name is required")
+	}
+	var zone Zone
+	if err := db.Preload("RRSets.Records").First(&zone, zoneID).Error; err != nil {
+		return nil, err
+	}
+	origin := strings.TrimSuffix(zone.Name, ".")
+
+	tpl := Template{Name: name, Description: description}
+	for _, rr := range zone.RRSets {
+		if rr.Type == "SOA" {
+			continue
+		}
+		// Template names have no trailing dot (e.g. "mail.{domain}")
+		recName := strings.TrimSuffix(ReplaceOrigin(rr.Name, origin, TemplateDomain), ".")
+		for _, rec := range rr.Records {
+			tpl.Records = append(tpl.Records, TemplateRecord{
+				Name:      recName,
+				Type:      rr.Type,
+				TTL:       rec.AnswerTTL(rr.TTL),
+				Data:      ReplaceOrigin(rec.Data, origin, TemplateDomain),
+				Country:   rec.Country,
+				Continent: rec.Continent,
+				ASN:       rec.ASN,
+				ASNs:      rec.ASNs,
+				Subnet:    rec.Subnet,
+			})
+		}
+	}
+	if err := db.Create(&tpl).Error; err != nil {
+		return nil, err
+	}
+	return &tpl, nil
+}
@@ -0,0 +1,92 @@
+package db
+
+import "testing"
+
+func TestReplaceOrigin(t *testing.T) {
+	cases := []struct{ in, want string }{
+		{"example.com.", "{domain}."},
+		{"www.example.com.", "www.{domain}."},
+		{"10 mail.Example.com", "10 mail.{domain}"},
+		{`"v=spf1 include:example.com -all"`, `"v=spf1 include:{domain} -all"`},
+		{"myexample.com.", "myexample.com."},
+		{"example.com.au.", "example.com.au."},
+		{"example.community", "example.community"},
+	}
+	for _, tc := range cases {
+		if got := ReplaceOrigin(tc.in, "example.com.", TemplateDomain); got != tc.want {
+			t.Errorf("ReplaceOrigin(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestCloneZone(t *testing.T) {
+	db := newIsolatedDB(t)
+	de := "DE"
+	src := Zone{Name: "example.com.", RRSets: []RRSet{
+		{Name: "www.example.com.", Type: "A", TTL: 300, Records: []RData{{Data: "192.0.2.1"}, {Data: "192.0.2.2", Country: &de}}},
+		{Name: "example.com.", Type: "MX", TTL: 3600, Records: []RData{{Data: "10 mail.example.com."}}},
+	}}
+	if err := db.Create(&src).Error; err != nil {
+		t.Fatalf("create zone: %v", err)
+	}
+	if _, err := SetSOA(db, src, DefaultSOA(src.Name, "ns1.{zone}.", "hostmaster.{zone}.")); err != nil {
+		t.Fatalf("set SOA: %v", err)
+	}
+
+	clone, err := CloneZone(db, src.ID, "Example.ORG")
+	if err != nil {
+		t.Fatalf("clone: %v", err)
+	}
+	if clone.Name != "example.org." {
+		t.Fatalf("clone name = %q", clone.Name)
+	}
+	var sets []RRSet
+	db.Preload("Records").Where("zone_id = ?", clone.ID).Order("name, type").Find(&sets)
+	if len(sets) != 3 {
+		t.Fatalf("clone has %d RRSets, want 3 (A, MX, SOA)", len(sets))
+	}
+	if sets[0].Name != "example.org." || sets[0].Type != "MX" || sets[0].Records[0].Data != "10 mail.example.org." {
+		t.Fatalf("MX not rewritten: %+v", sets[0])
+	}
+	if sets[2].Name != "www.example.org." || len(sets[2].Records) != 2 {
+		t.Fatalf("A set not copied with geo variants: %+v", sets[2])
+	}
+	soa, err := GetSOA(db, clone.ID)
+	if err != nil || soa.Primary != "ns1.example.org." || soa.Hostmaster != "hostmaster.example.org." {
+		t.Fatalf("clone SOA = %+v, %v", soa, err)
+	}
+
+	if _, err := CloneZone(db, src.ID, "example.org"); err == nil {
+		t.Fatalf("cloning onto an existing zone should fail")
+	}
+}
+
+func TestZoneToTemplate(t *testing.T) {
+	db := newIsolatedDB(t)
+	src := Zone{Name: "example.com.", RRSets: []RRSet{
+		{Name: "example.com.", Type: "MX", TTL: 3600, Records: []RData{{Data: "10 mail.example.com."}}},
+		{Name: "mail.example.com.", Type: "A", TTL: 300, Records: []RData{{Data: "192.0.2.10"}}},
+	}}
+	if err := db.Create(&src).Error; err != nil {
+		t.Fatalf("create zone: %v", err)
+	}
+	if _, err := SetSOA(db, src, DefaultSOA(src.Name, "ns1.{zone}.", "hostmaster.{zone}.")); err != nil {
+		t.Fatalf("set SOA: %v", err)
+	}
+
+	tpl, err := ZoneToTemplate(db, src.ID, "Mail", "")
+	if err != nil {
+		t.Fatalf("to template: %v", err)
+	}
+	var recs []TemplateRecord
+	db.Where("template_id = ?", tpl.ID).Order("name").Find(&recs)
+	if len(recs) != 2 {
+		t.Fatalf("template has %d records, want 2 (SOA skipped)", len(recs))
+	}
+	if recs[0].Name != "mail.{domain}" || recs[1].Name != "{domain}" || recs[1].Data != "10 mail.{domain}." {
+		t.Fatalf("origin not replaced: %+v", recs)
+	}
+	if _, err := ZoneToTemplate(db, src.ID, " ", ""); err == nil {
+		t.Fatalf("empty template name should be rejected")
+	}
+}
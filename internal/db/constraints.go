@@ -0,0 +1,132 @@
+package db
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// cascadeFK is a foreign key that must remove child rows together with their parent.
+type cascadeFK struct {
+	model  interface{} // table holding the foreign key
+	name   string
+	column string
+}
+
+var cascadeFKs = []cascadeFK{
+	{&RRSet{}, "fk_zones_rr_sets", "zone_id"},
+	{&RData{}, "fk_rr_sets_records", "rr_set_id"},
+	{&TemplateRecord{}, "fk_templates_records", "template_id"},
+}
+
+// upgradeForeignKeys is a one-time migration for databases created before the
+// foreign keys cascaded: it drops the old constraints and removes orphaned rows
+// so AutoMigrate can recreate them with ON DELETE CASCADE.
+func upgradeForeignKeys(db *gorm.DB) error {
+	m := db.Migrator()
+	var stale []cascadeFK
+	for _, fk := range cascadeFKs {
+		if !m.HasTable(fk.model) {
+			continue
+		}
+		if m.HasConstraint(fk.model, fk.name) {
+			ok, err := fkCascades(db, fk)
+			if err != nil {
+				return fmt.Errorf("inspect %s: %w", fk.name, err)
+			}
+			if ok {
+				continue
+			}
+			if err := m.DropConstraint(fk.model, fk.name); err != nil {
+				return fmt.Errorf("drop %s: %w", fk.name, err)
+			}
+		}
+		stale = append(stale, fk)
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+	st, err := CleanupOrphans(db)
+	if err != nil {
+		return fmt.Errorf("remove orphaned rows: %w", err)
+	}
+	log.Printf("db: switching %d foreign keys to ON DELETE CASCADE, removed %d orphaned rows", len(stale), st.Total())
+	return nil
+}
+
+// fkCascades reports whether an existing foreign key already uses ON DELETE CASCADE.
+func fkCascades(db *gorm.DB, fk cascadeFK) (bool, error) {
+	var rule string
+	switch db.Dialector.Name() {
+	case "sqlite":
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(fk.model); err != nil {
+			return false, err
+		}
+		var keys []struct {
+			From     string
+			OnDelete string
+		}
+		if err := db.Raw("PRAGMA foreign_key_list(`" + stmt.Schema.Table + "`)").Scan(&keys).Error; err != nil {
+			return false, err
+		}
+		for _, k := range keys {
+			if k.From == fk.column {
+				rule = k.OnDelete
+			}
+		}
+	case "postgres":
+		if err := db.Raw(`SELECT delete_rule FROM information_schema.referential_constraints
+			WHERE constraint_schema = current_schema() AND constraint_name = ?`, fk.name).Scan(&rule).Error; err != nil {
+			return false, err
+		}
+	case "mysql":
+		if err := db.Raw(`SELECT delete_rule FROM information_schema.referential_constraints
+			WHERE constraint_schema = DATABASE() AND constraint_name = ?`, fk.name).Scan(&rule).Error; err != nil {
+			return false, err
+		}
+	default:
+		return true, nil
+	}
+	return strings.EqualFold(rule, "CASCADE"), nil
+}
+
+// withoutForeignKeys runs fn with SQLite foreign key enforcement switched off.
+// SQLite changes constraints by rebuilding tables, and dropping the old copy
+// of a parent table would otherwise cascade into its children.
+func withoutForeignKeys(db *gorm.DB, fn func(*gorm.DB) error) error {
+	if db.Dialector.Name() != "sqlite" {
+		return fn(db)
+	}
+	// The pragma is per connection, so pin one for the whole migration
+	return db.Connection(func(conn *gorm.DB) error {
+		var enabled int
+		if err := conn.Raw("PRAGMA foreign_keys").Scan(&enabled).Error; err != nil {
+			return err
+		}
+		if err := conn.Exec("PRAGMA foreign_keys = OFF").Error; err != nil {
+			return err
+		}
+		err := fn(conn.Session(&gorm.Session{NewDB: true}))
+		if enabled == 1 {
+			if rerr := conn.Exec("PRAGMA foreign_keys = ON").Error; err == nil {
+				err = rerr
+			}
+		}
+		return err
+	})
+}
+
+// normalizeSQLiteDSN turns on foreign key enforcement, which SQLite leaves off
+// by default, so ON DELETE CASCADE applies to custom DSNs as well.
+func normalizeSQLiteDSN(dsn string) string {
+	if strings.Contains(dsn, "_foreign_keys=") || strings.Contains(dsn, "_fk=") {
+		return dsn
+	}
+	if strings.Contains(dsn, "?") {
+		return dsn + "&_foreign_keys=on"
+	}
+	return dsn + "?_foreign_keys=on"
+}
@@ -0,0 +1,134 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// Schema as created before the foreign keys cascaded.
+type legacyZone struct {
+	ID        uint
+	Name      string
+	DeletedAt gorm.DeletedAt
+	RRSets    []legacyRRSet `gorm:"foreignKey:ZoneID"`
+}
+
+func (legacyZone) TableName() string { return "zones" }
+
+type legacyRRSet struct {
+	ID        uint
+	ZoneID    uint
+	Name      string
+	Type      string
+	DeletedAt gorm.DeletedAt
+	Records   []legacyRData `gorm:"foreignKey:RRSetID"`
+}
+
+func (legacyRRSet) TableName() string { return "rr_sets" }
+
+type legacyRData struct {
+	ID        uint
+	RRSetID   uint
+	Data      string
+	DeletedAt gorm.DeletedAt
+}
+
+func (legacyRData) TableName() string { return "r_data" }
+
+type legacyTemplate struct {
+	ID        uint
+	Name      string
+	DeletedAt gorm.DeletedAt
+	Records   []legacyTemplateRecord `gorm:"foreignKey:TemplateID"`
+}
+
+func (legacyTemplate) TableName() string { return "templates" }
+
+type legacyTemplateRecord struct {
+	ID         uint
+	TemplateID uint
+	Data       string
+	DeletedAt  gorm.DeletedAt
+}
+
+func (legacyTemplateRecord) TableName() string { return "template_records" }
+
+func TestAutoMigrate_UpgradesForeignKeysToCascade(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:"+filepath.Join(t.TempDir(), "legacy.db")+"?_foreign_keys=on"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+
+	if err := db.AutoMigrate(&legacyZone{}, &legacyRRSet{}, &legacyRData{}, &legacyTemplate{}, &legacyTemplateRecord{}); err != nil {
+		t.Fatalf("legacy migrate: %v", err)
+	}
+	zone := legacyZone{Name: "example.com.", RRSets: []legacyRRSet{
+		{Name: "www.example.com.", Type: "A", Records: []legacyRData{{Data: "192.0.2.1"}, {Data: "192.0.2.2"}}},
+	}}
+	if err := db.Create(&zone).Error; err != nil {
+		t.Fatalf("create zone: %v", err)
+	}
+	// An orphan left behind while enforcement was off
+	db.Exec("PRAGMA foreign_keys = OFF")
+	if err := db.Create(&legacyRData{RRSetID: 999, Data: "192.0.2.9"}).Error; err != nil {
+		t.Fatalf("create orphan: %v", err)
+	}
+	db.Exec("PRAGMA foreign_keys = ON")
+
+	if err := AutoMigrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	for _, fk := range cascadeFKs {
+		ok, err := fkCascades(db, fk)
+		if err != nil || !ok {
+			t.Errorf("%s: expected ON DELETE CASCADE (err=%v)", fk.name, err)
+		}
+	}
+
+	var n int64
+	db.Model(&RData{}).Count(&n)
+	if n != 2 {
+		t.Fatalf("expected 2 records after migration (orphan removed, zone data kept), got %d", n)
+	}
+	var enabled int
+	db.Raw("PRAGMA foreign_keys").Scan(&enabled)
+	if enabled != 1 {
+		t.Fatal("foreign key enforcement should be restored after migration")
+	}
+
+	// Running again is a no-op
+	if err := AutoMigrate(db); err != nil {
+		t.Fatalf("second migrate: %v", err)
+	}
+
+	if err := db.Unscoped().Delete(&Zone{}, zone.ID).Error; err != nil {
+		t.Fatalf("delete zone: %v", err)
+	}
+	db.Model(&RRSet{}).Count(&n)
+	if n != 0 {
+		t.Errorf("expected rrsets to cascade, got %d", n)
+	}
+	db.Model(&RData{}).Count(&n)
+	if n != 0 {
+		t.Errorf("expected records to cascade, got %d", n)
+	}
+}
+
+func TestNormalizeSQLiteDSN(t *testing.T) {
+	tests := map[string]string{
+		"namedot.db":                       "namedot.db?_foreign_keys=on",
+		"file:namedot.db?cache=shared":     "file:namedot.db?cache=shared&_foreign_keys=on",
+		"file:namedot.db?_foreign_keys=on": "file:namedot.db?_foreign_keys=on",
+		"namedot.db?_fk=0":                 "namedot.db?_fk=0",
+	}
+	for in, want := range tests {
+		if got := normalizeSQLiteDSN(in); got != want {
+			t.Errorf("normalizeSQLiteDSN(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package db
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"namedot/internal/config"
+)
+
+// Credential kinds.
+const (
+	CredentialAPIToken      = "api_token"      // the main REST API token
+	CredentialAdminPassword = "admin_password" // an admin user's password, by user name
+)
+
+// DefaultCredentialGrace is how long a rotated-out secret keeps working
+// unless the rotation asks otherwise.
+const DefaultCredentialGrace = 24 * time.Hour
+
+// Credential is the bcrypt hash of a secret set by rotation. Once a secret
+// has been rotated, its credentials replace the hash in the config file. A
+// rotation gives the credentials it replaces an expiry instead of deleting
+// them, so clients can move to the new secret during a grace period.
+type Credential struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	Kind      string     `gorm:"size:32;index:idx_credentials_subject" json:"kind"`
+	Subject   string     `gorm:"size:128;index:idx_credentials_subject" json:"subject,omitempty"` // admin user name; empty for the API token
+	Hash      string     `gorm:"size:255" json:"-"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // nil for the current secret
+}
+
+// valid reports whether the credential is still accepted at now.
+func (c Credential) valid(now time.Time) bool {
+	return c.ExpiresAt == nil || now.Before(*c.ExpiresAt)
+}
+
+// NewSecret returns a random URL-safe secret of n bytes of entropy.
+func NewSecret(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// APITokenHash returns the bcrypt hash of the main API token in cfg, hashing
+// the deprecated plain api_token; empty when neither is set.
+func APITokenHash(cfg *config.Config) (string, error) {
+	if cfg.APITokenHash != "" || cfg.APIToken == "" {
+		return cfg.APITokenHash, nil
+	}
+	h, err := bcrypt.GenerateFromPassword([]byte(cfg.APIToken), bcrypt.DefaultCost)
+	return string(h), err
+}
+
+// RotateCredential makes secret the current secret of kind and subject. The
+// secrets valid so far keep working until grace has passed: the rotated
+// credentials, or configHash, the hash from the config file, on the first
+// rotation, until the returned credential's CreatedAt plus grace.
+// Credentials that have run out are removed.
+func RotateCredential(db *gorm.DB, kind, subject, secret, configHash string, grace time.Duration) (Credential, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return Credential{}, err
+	}
+	now := time.Now().UTC()
+	until := now.Add(grace)
+	cred := Credential{Kind: kind, Subject: subject, Hash: string(hash), CreatedAt: now}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		mine := func() *gorm.DB {
+			return tx.Model(&Credential{}).Where("kind = ? AND subject = ?", kind, subject)
+		}
+		var n int64
+		if err := mine().Count(&n).Error; err != nil {
+			return err
+		}
+		if n == 0 && configHash != "" {
+			first := Credential{Kind: kind, Subject: subject, Hash: configHash, ExpiresAt: &until}
+			if err := tx.Create(&first).Error; err != nil {
+				return err
+			}
+		}
+		if err := mine().Where("expires_at IS NULL OR expires_at > ?", until).Update("expires_at", until).Error; err != nil {
+			return err
+		}
+		if err := mine().Where("expires_at <= ?", now).Delete(&Credential{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&cred).Error
+	})
+	return cred, err
+}
+
+// CredentialCache checks secrets against the rotated credentials, reading
+// them from the database at most once per ttl. When the database cannot be
+// read the credentials read last are used, so an outage does not bring back
+// a secret from the config file that was rotated out.
+type CredentialCache struct {
+	db  *gorm.DB
+	ttl time.Duration
+
+	mu     sync.Mutex
+	creds  []Credential
+	loaded time.Time
+}
+
+// NewCredentialCache creates a cache over db.
+func NewCredentialCache(db *gorm.DB, ttl time.Duration) *CredentialCache {
+	return &CredentialCache{db: db, ttl: ttl}
+}
+
+// Check reports whether secret is a valid secret of kind and subject, and
+// whether the two have been rotated at all. Until they have, callers check
+// the config file instead.
+func (c *CredentialCache) Check(kind, subject, secret string) (ok, rotated bool) {
+	if c == nil {
+		return false, false
+	}
+	now := time.Now()
+	var hashes []string
+	for _, cr := range c.load(now) {
+		if cr.Kind != kind || cr.Subject != subject {
+			continue
+		}
+		rotated = true
+		if cr.valid(now) {
+			hashes = append(hashes, cr.Hash)
+		}
+	}
+	for _, h := range hashes {
+		if bcrypt.CompareHashAndPassword([]byte(h), []byte(secret)) == nil {
+			return true, true
+		}
+	}
+	return false, rotated
+}
+
+// Invalidate makes the next Check read the database, e.g. after a rotation.
+func (c *CredentialCache) Invalidate() {
+	c.mu.Lock()
+	c.loaded = time.Time{}
+	c.mu.Unlock()
+}
+
+func (c *CredentialCache) load(now time.Time) []Credential {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.loaded.IsZero() && now.Sub(c.loaded) < c.ttl {
+		return c.creds
+	}
+	var creds []Credential
+	if err := c.db.Find(&creds).Error; err == nil {
+		c.creds = creds
+		c.loaded = now
+	}
+	return c.creds
+}
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestRotateCredential(t *testing.T) {
+	db := newIsolatedDB(t)
+	cache := NewCredentialCache(db, time.Minute)
+	configHash, _ := bcrypt.GenerateFromPassword([]byte("from-config"), bcrypt.MinCost)
+
+	if ok, rotated := cache.Check(CredentialAPIToken, "", "from-config"); ok || rotated {
+		t.Fatal("nothing rotated yet, the config applies")
+	}
+
+	// The config secret is kept for the grace period
+	if _, err := RotateCredential(db, CredentialAPIToken, "", "second", string(configHash), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	cache.Invalidate()
+	for _, secret := range []string{"from-config", "second"} {
+		if ok, rotated := cache.Check(CredentialAPIToken, "", secret); !ok || !rotated {
+			t.Fatalf("%s should be valid", secret)
+		}
+	}
+	if ok, rotated := cache.Check(CredentialAPIToken, "", "wrong"); ok || !rotated {
+		t.Fatal("wrong token accepted")
+	}
+	// Other kinds and subjects are not affected
+	if _, rotated := cache.Check(CredentialAdminPassword, "admin", "second"); rotated {
+		t.Fatal("admin password should not count as rotated")
+	}
+
+	// Without a grace period the old secrets stop working at once
+	if _, err := RotateCredential(db, CredentialAPIToken, "", "third", string(configHash), 0); err != nil {
+		t.Fatal(err)
+	}
+	cache.Invalidate()
+	for secret, want := range map[string]bool{"from-config": false, "second": false, "third": true} {
+		if ok, _ := cache.Check(CredentialAPIToken, "", secret); ok != want {
+			t.Fatalf("%s: valid %v, want %v", secret, ok, want)
+		}
+	}
+	// Expired credentials are cleared by the next rotation
+	if _, err := RotateCredential(db, CredentialAPIToken, "", "fourth", "", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	var n int64
+	db.Model(&Credential{}).Count(&n)
+	if n != 2 {
+		t.Fatalf("expected the third and fourth tokens to be kept, got %d rows", n)
+	}
+}
@@ -0,0 +1,179 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Identity returns the value that makes a record unique within its RRSet:
+// the answer data plus the geo selectors it is served for.
+func (r RData) Identity() string {
+	parts := []string{
+		strings.TrimSpace(r.Data),
+		selector(r.Country),
+		selector(r.Continent),
+		"",
+		selector(r.Subnet),
+	}
+	if r.ASN != nil {
+		parts[3] = strconv.Itoa(*r.ASN)
+	}
+	if r.ASNs != nil {
+		// Only when set, so the keys of records without a list stay the same
+		asns, err := NormalizeASNs(*r.ASNs)
+		if err != nil {
+			asns = *r.ASNs
+		}
+		parts = append(parts, asns)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+func selector(p *string) string {
+	if p == nil {
+		return ""
+	}
+	return strings.ToUpper(strings.TrimSpace(*p))
+}
+
+// BeforeSave normalizes the ASN list, keeps DedupeKey in sync for Create
+// and Save, and stamps the source of the change. Column updates
+// (Model(...).Update) must set dedupe_key themselves.
+func (r *RData) BeforeSave(tx *gorm.DB) error {
+	if r.ASNs != nil {
+		asns, err := NormalizeASNs(*r.ASNs)
+		if err != nil {
+			return err
+		}
+		r.ASNs = &asns
+	}
+	r.DedupeKey = r.Identity()
+	stampSource(tx, &r.Source)
+	return nil
+}
+
+// DedupeRecords drops records identical to an earlier one, keeping the first.
+func DedupeRecords(recs []RData) []RData {
+	seen := make(map[string]bool, len(recs))
+	out := make([]RData, 0, len(recs))
+	for _, r := range recs {
+		id := r.Identity()
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		out = append(out, r)
+	}
+	return out
+}
+
+// nameDataTypes hold a single domain name as data, which imports compare
+// without case.
+var nameDataTypes = map[string]bool{"CNAME": true, "DNAME": true, "NS": true, "PTR": true}
+
+// NormalizeRRSets prepares imported RRSets for storing: names become
+// lowercase FQDNs and types uppercase, RRSets that then share a name and type
+// are merged into the first one (whose TTL and comment win unless unset), and
+// identical records are collapsed. Without it, case variants of one name
+// reach the database as separate rows and the unique index rejects the import
+// half-way. It returns the RRSets in first-seen order and the number of
+// records dropped as duplicates.
+func NormalizeRRSets(sets []RRSet) ([]RRSet, int) {
+	index := make(map[string]int, len(sets))
+	out := make([]RRSet, 0, len(sets))
+	in := 0
+	for _, rs := range sets {
+		rs.Name = normalizeFQDN(rs.Name)
+		rs.Type = strings.ToUpper(strings.TrimSpace(rs.Type))
+		rs.Records = append([]RData(nil), rs.Records...)
+		for i := range rs.Records {
+			rec := &rs.Records[i]
+			rec.Data = strings.TrimSpace(rec.Data)
+			if nameDataTypes[rs.Type] {
+				rec.Data = strings.ToLower(rec.Data)
+			}
+		}
+		in += len(rs.Records)
+		key := rs.Name + " " + rs.Type
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(out)
+			out = append(out, rs)
+			continue
+		}
+		first := &out[i]
+		if first.TTL == 0 {
+			first.TTL = rs.TTL
+		}
+		if first.Comment == "" {
+			first.Comment = rs.Comment
+		}
+		first.Records = append(first.Records, rs.Records...)
+	}
+	kept := 0
+	for i := range out {
+		out[i].Records = DedupeRecords(out[i].Records)
+		kept += len(out[i].Records)
+	}
+	return out, in - kept
+}
+
+// HasDuplicateRecord reports whether r's RRSet already holds another record
+// identical to r.
+func HasDuplicateRecord(db *gorm.DB, r RData) bool {
+	var n int64
+	db.Model(&RData{}).Where("rr_set_id = ? AND dedupe_key = ? AND id <> ?", r.RRSetID, r.Identity(), r.ID).Count(&n)
+	return n > 0
+}
+
+// backfillDedupeKeys is a one-time migration for databases created before
+// records had a dedupe key: it fills the key and removes duplicate records
+// (keeping the oldest) so the unique index can be created.
+func backfillDedupeKeys(db *gorm.DB) error {
+	m := db.Migrator()
+	if !m.HasTable(&RData{}) || m.HasColumn(&RData{}, "DedupeKey") {
+		return nil
+	}
+	if err := m.AddColumn(&RData{}, "DedupeKey"); err != nil {
+		return fmt.Errorf("add dedupe_key: %w", err)
+	}
+	// Soft-deleted records are unreachable and would collide with live ones
+	res := db.Unscoped().Where("deleted_at IS NOT NULL").Delete(&RData{})
+	if res.Error != nil {
+		return res.Error
+	}
+	removed := res.RowsAffected
+
+	seen := map[string]bool{}
+	var batch []RData
+	err := db.Unscoped().Order("id").FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		for _, r := range batch {
+			key := r.Identity()
+			id := fmt.Sprintf("%d/%s", r.RRSetID, key)
+			if seen[id] {
+				if err := db.Unscoped().Delete(&RData{}, r.ID).Error; err != nil {
+					return err
+				}
+				removed++
+				continue
+			}
+			seen[id] = true
+			if err := db.Model(&RData{}).Where("id = ?", r.ID).UpdateColumn("dedupe_key", key).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return fmt.Errorf("backfill dedupe_key: %w", err)
+	}
+	log.Printf("db: added record dedupe keys, removed %d duplicate or deleted records", removed)
+	return nil
+}
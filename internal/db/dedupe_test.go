@@ -0,0 +1,126 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestRData_UniqueWithinRRSet(t *testing.T) {
+	db := newIsolatedDB(t)
+	zone := createZoneWithSets(t, db, "dedupe.example.", "www.dedupe.example.")
+	var set RRSet
+	if err := db.Preload("Records").Where("zone_id = ?", zone.ID).First(&set).Error; err != nil {
+		t.Fatalf("load rrset: %v", err)
+	}
+	existing := set.Records[0]
+
+	dup := RData{RRSetID: set.ID, Data: " " + existing.Data}
+	if !HasDuplicateRecord(db, dup) {
+		t.Error("expected duplicate to be detected")
+	}
+	if err := db.Create(&dup).Error; err == nil {
+		t.Fatal("expected unique index to reject identical record")
+	}
+
+	country := "de"
+	geo := RData{RRSetID: set.ID, Data: existing.Data, Country: &country}
+	if HasDuplicateRecord(db, geo) {
+		t.Error("record with different geo selector is not a duplicate")
+	}
+	if err := db.Create(&geo).Error; err != nil {
+		t.Fatalf("create geo variant: %v", err)
+	}
+	// Saving a record unchanged is not a conflict with itself
+	if HasDuplicateRecord(db, geo) {
+		t.Error("record should not count as its own duplicate")
+	}
+}
+
+func TestDedupeRecords(t *testing.T) {
+	de, DE := "de", "DE"
+	asn := 64500
+	recs := []RData{
+		{Data: "192.0.2.1"},
+		{Data: "192.0.2.1 "},
+		{Data: "192.0.2.1", Country: &de},
+		{Data: "192.0.2.1", Country: &DE},
+		{Data: "192.0.2.1", ASN: &asn},
+		{Data: "192.0.2.2"},
+	}
+	got := DedupeRecords(recs)
+	if len(got) != 4 {
+		t.Fatalf("expected 4 unique records, got %d: %+v", len(got), got)
+	}
+	if got[0].Data != "192.0.2.1" || got[3].Data != "192.0.2.2" {
+		t.Errorf("expected first occurrences in order, got %+v", got)
+	}
+}
+
+func TestAutoMigrate_BackfillsDedupeKeys(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:"+filepath.Join(t.TempDir(), "legacy.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if err := db.AutoMigrate(&legacyZone{}, &legacyRRSet{}, &legacyRData{}, &legacyTemplate{}, &legacyTemplateRecord{}); err != nil {
+		t.Fatalf("legacy migrate: %v", err)
+	}
+	zone := legacyZone{Name: "example.com.", RRSets: []legacyRRSet{
+		{Name: "www.example.com.", Type: "A", Records: []legacyRData{{Data: "192.0.2.1"}, {Data: "192.0.2.1"}, {Data: "192.0.2.2"}}},
+		{Name: "mail.example.com.", Type: "A", Records: []legacyRData{{Data: "192.0.2.1"}}},
+	}}
+	if err := db.Create(&zone).Error; err != nil {
+		t.Fatalf("create zone: %v", err)
+	}
+
+	if err := AutoMigrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	var recs []RData
+	db.Order("id").Find(&recs)
+	if len(recs) != 3 {
+		t.Fatalf("expected duplicate removed (3 records left), got %d", len(recs))
+	}
+	for _, r := range recs {
+		if r.DedupeKey != r.Identity() {
+			t.Errorf("record %d: dedupe key not backfilled", r.ID)
+		}
+	}
+	if err := db.Create(&RData{RRSetID: recs[0].RRSetID, Data: recs[0].Data}).Error; err == nil {
+		t.Error("expected unique index after migration")
+	}
+}
+
+func TestImportZones_MergesCaseDuplicates(t *testing.T) {
+	db := newIsolatedDB(t)
+	backup := `{"version":"1","zones":[
+		{"name":"Case.Example","rrsets":[
+			{"name":"WWW.case.example.","type":"a","ttl":300,"records":[{"data":"192.0.2.1"}]},
+			{"name":"www.case.example","type":"A","ttl":300,"records":[{"data":"192.0.2.1"},{"data":"192.0.2.2"}]}]},
+		{"name":"case.example.","rrsets":[
+			{"name":"mail.case.example.","type":"CNAME","ttl":300,"records":[{"data":"WWW.case.example."}]}]}]}`
+	path := filepath.Join(t.TempDir(), "backup.json")
+	if err := os.WriteFile(path, []byte(backup), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ImportZones(db, path, "replace"); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	var zones []Zone
+	db.Preload("RRSets.Records").Find(&zones)
+	if len(zones) != 1 || zones[0].Name != "case.example." || len(zones[0].RRSets) != 2 {
+		t.Fatalf("zones: %+v", zones)
+	}
+	for _, rs := range zones[0].RRSets {
+		if rs.Type == "A" && len(rs.Records) != 2 {
+			t.Fatalf("A records: %+v", rs.Records)
+		}
+		if rs.Type == "CNAME" && rs.Records[0].Data != "www.case.example." {
+			t.Fatalf("CNAME target: %s", rs.Records[0].Data)
+		}
+	}
+}
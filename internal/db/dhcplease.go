@@ -0,0 +1,17 @@
+package db
+
+import "time"
+
+// DHCPLease is an address handed out by a DHCP server whose hostname is
+// registered in the dhcp zone. The A/AAAA record (and PTR, with a reverse
+// zone) is removed when the lease is released or expires.
+type DHCPLease struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ZoneID    uint      `gorm:"index" json:"zone_id"`
+	IP        string    `gorm:"size:64;uniqueIndex" json:"ip"`
+	Hostname  string    `gorm:"size:255;index" json:"hostname"` // FQDN in the dhcp zone
+	MAC       string    `gorm:"size:64" json:"mac,omitempty"`
+	ExpiresAt time.Time `gorm:"index" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
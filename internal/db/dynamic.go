@@ -0,0 +1,28 @@
+package db
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// CheckDynamicURL returns an error when set has a dynamic URL that is not an
+// http(s) URL, or has one while being a SOA set.
+//
+// The DNS server GETs the URL of a dynamic set and serves the records of
+// the JSON answer, {"records": [{"data": "192.0.2.1", ...}]}, with the same
+// fields as stored records. The stored records of the set are served while
+// the endpoint has never answered.
+func CheckDynamicURL(set RRSet) error {
+	if set.DynamicURL == nil {
+		return nil
+	}
+	if strings.EqualFold(set.Type, "SOA") {
+		return fmt.Errorf("SOA records cannot be dynamic")
+	}
+	u, err := url.Parse(*set.DynamicURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid dynamic URL %q: use http(s)://host/path", *set.DynamicURL)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package db
+
+import "testing"
+
+func TestCheckDynamicURL(t *testing.T) {
+	url := func(s string) *string { return &s }
+	for _, set := range []RRSet{
+		{Type: "A"},
+		{Type: "A", DynamicURL: url("http://lb.internal:8080/pool/web")},
+		{Type: "AAAA", DynamicURL: url("https://lb.example.com/v6?pool=web")},
+	} {
+		if err := CheckDynamicURL(set); err != nil {
+			t.Errorf("CheckDynamicURL(%v) = %v", set.DynamicURL, err)
+		}
+	}
+	for _, set := range []RRSet{
+		{Type: "A", DynamicURL: url("")},
+		{Type: "A", DynamicURL: url("lb.internal/pool")},
+		{Type: "A", DynamicURL: url("ftp://lb.internal/pool")},
+		{Type: "A", DynamicURL: url("http:///pool")},
+		{Type: "SOA", DynamicURL: url("http://lb.internal/soa")},
+	} {
+		if err := CheckDynamicURL(set); err == nil {
+			t.Errorf("CheckDynamicURL(%q, %s): want an error", *set.DynamicURL, set.Type)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package db
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+	"gorm.io/gorm"
+)
+
+// ZoneForName returns the most specific zone that contains name, or nil
+// when no zone does. Disabled zones count; zones in the trash do not.
+func ZoneForName(db *gorm.DB, name string) (*Zone, error) {
+	name = dns.Fqdn(strings.ToLower(strings.TrimSpace(name)))
+	var candidates []string
+	for off, end := 0, false; !end; off, end = dns.NextLabel(name, off) {
+		candidates = append(candidates, name[off:])
+	}
+	var zones []Zone
+	if err := db.Where("name IN ?", candidates).Find(&zones).Error; err != nil {
+		return nil, err
+	}
+	var best *Zone
+	for i := range zones {
+		if best == nil || len(zones[i].Name) > len(best.Name) {
+			best = &zones[i]
+		}
+	}
+	return best, nil
+}
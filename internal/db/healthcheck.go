@@ -0,0 +1,90 @@
+package db
+
+import (
+	"fmt"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Health check kinds.
+const (
+	CheckTCP   = "tcp"
+	CheckHTTP  = "http"
+	CheckHTTPS = "https"
+	CheckICMP  = "icmp"
+)
+
+// HealthCheck is the parsed health check of a record.
+type HealthCheck struct {
+	Kind string // tcp, http, https or icmp
+	Host string // host to probe; "" for the address in the record
+	Port string // tcp, http and https; defaults to 80 and 443 for http(s)
+	Path string // http and https, with the query
+}
+
+// ParseHealthCheck parses the health check of a record, written as a URL
+// whose host may be left out to probe the address of an A or AAAA record:
+//
+//	tcp://:443                 connect to port 443
+//	http://:8080/healthz       GET, a 2xx or 3xx status passes
+//	https://api.example.com/up with an explicit host
+//	icmp                       ping (icmp://host for another host)
+func ParseHealthCheck(spec string) (HealthCheck, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.EqualFold(spec, CheckICMP) {
+		return HealthCheck{Kind: CheckICMP}, nil
+	}
+	u, err := url.Parse(spec)
+	if err != nil || u.Scheme == "" {
+		return HealthCheck{}, fmt.Errorf("invalid health check %q: use tcp://:port, http(s)://[host][:port]/path or icmp", spec)
+	}
+	hc := HealthCheck{Kind: strings.ToLower(u.Scheme), Host: u.Hostname(), Port: u.Port()}
+	if u.User != nil || u.Fragment != "" {
+		return HealthCheck{}, fmt.Errorf("invalid health check %q: credentials and fragments are not supported", spec)
+	}
+	switch hc.Kind {
+	case CheckTCP:
+		if hc.Port == "" || (u.Path != "" && u.Path != "/") {
+			return HealthCheck{}, fmt.Errorf("invalid health check %q: tcp needs a port and no path, e.g. tcp://:443", spec)
+		}
+	case CheckHTTP, CheckHTTPS:
+		if hc.Port == "" {
+			hc.Port = map[string]string{CheckHTTP: "80", CheckHTTPS: "443"}[hc.Kind]
+		}
+		hc.Path = u.EscapedPath()
+		if hc.Path == "" {
+			hc.Path = "/"
+		}
+		if u.RawQuery != "" {
+			hc.Path += "?" + u.RawQuery
+		}
+	case CheckICMP:
+		if hc.Port != "" || (u.Path != "" && u.Path != "/") {
+			return HealthCheck{}, fmt.Errorf("invalid health check %q: icmp takes only a host", spec)
+		}
+	default:
+		return HealthCheck{}, fmt.Errorf("invalid health check %q: unknown kind %q (tcp, http, https or icmp)", spec, u.Scheme)
+	}
+	if hc.Port != "" {
+		if p, err := strconv.Atoi(hc.Port); err != nil || p < 1 || p > 65535 {
+			return HealthCheck{}, fmt.Errorf("invalid health check %q: bad port", spec)
+		}
+	}
+	return hc, nil
+}
+
+// Target returns the host to probe for a record of type rtype with data:
+// the host of the check, or the address of an A or AAAA record.
+func (hc HealthCheck) Target(rtype, data string) (string, error) {
+	if hc.Host != "" {
+		return hc.Host, nil
+	}
+	if t := strings.ToUpper(rtype); t == "A" || t == "AAAA" {
+		if a, err := netip.ParseAddr(strings.TrimSpace(data)); err == nil {
+			return a.String(), nil
+		}
+	}
+	return "", fmt.Errorf("health check without a host needs an A or AAAA record")
+}
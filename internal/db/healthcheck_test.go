@@ -0,0 +1,38 @@
+package db
+
+import "testing"
+
+func TestParseHealthCheck(t *testing.T) {
+	for in, want := range map[string]HealthCheck{
+		"tcp://:443":                     {Kind: CheckTCP, Port: "443"},
+		"http://:8080/healthz":           {Kind: CheckHTTP, Port: "8080", Path: "/healthz"},
+		"HTTPS://api.example.com/up?x=1": {Kind: CheckHTTPS, Host: "api.example.com", Port: "443", Path: "/up?x=1"},
+		"http://":                        {Kind: CheckHTTP, Port: "80", Path: "/"},
+		"icmp":                           {Kind: CheckICMP},
+		"icmp://192.0.2.1":               {Kind: CheckICMP, Host: "192.0.2.1"},
+	} {
+		got, err := ParseHealthCheck(in)
+		if err != nil || got != want {
+			t.Errorf("ParseHealthCheck(%q) = %+v, %v; want %+v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "443", "tcp://host", "tcp://:443/path", "tcp://:0", "tcp://:70000", "udp://:53", "http://u:p@host/", "icmp://host:7"} {
+		if got, err := ParseHealthCheck(in); err == nil {
+			t.Errorf("ParseHealthCheck(%q) = %+v, want an error", in, got)
+		}
+	}
+}
+
+func TestHealthCheck_Target(t *testing.T) {
+	hc := HealthCheck{Kind: CheckTCP, Port: "443"}
+	if got, err := hc.Target("AAAA", "2001:db8::1"); err != nil || got != "2001:db8::1" {
+		t.Errorf("Target(AAAA) = %q, %v", got, err)
+	}
+	if _, err := hc.Target("CNAME", "lb.example.com."); err == nil {
+		t.Error("Target(CNAME) without a host: want an error")
+	}
+	hc.Host = "lb.example.com"
+	if got, err := hc.Target("CNAME", "lb.example.com."); err != nil || got != "lb.example.com" {
+		t.Errorf("Target(CNAME) with a host = %q, %v", got, err)
+	}
+}
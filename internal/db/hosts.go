@@ -0,0 +1,100 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Host is a static name → address override. A and AAAA queries for Name are
+// answered from the hosts table before any zone is looked at, so it works for
+// names without a local zone too.
+type Host struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"uniqueIndex:idx_host_unique;size:255" json:"name"`
+	Address   string    `gorm:"uniqueIndex:idx_host_unique;size:64" json:"address"`
+	TTL       uint32    `json:"ttl,omitempty"` // 0 = default_ttl
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ErrInvalidHost is returned for a host entry with a bad name or address.
+var ErrInvalidHost = errors.New("invalid host")
+
+// Type returns the record type the host answers: A or AAAA.
+func (h Host) Type() string {
+	if a, err := netip.ParseAddr(h.Address); err == nil && a.Is6() && !a.Is4In6() {
+		return "AAAA"
+	}
+	return "A"
+}
+
+// NormalizeHost lowercases the name to an FQDN and the address to its
+// canonical form.
+func NormalizeHost(h Host) (Host, error) {
+	name := strings.ToLower(strings.TrimSpace(h.Name))
+	if name != "" && !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	if name == "" || name == "." || strings.ContainsAny(name, " \t*") {
+		return h, fmt.Errorf("%w: name %q", ErrInvalidHost, h.Name)
+	}
+	a, err := netip.ParseAddr(strings.TrimSpace(h.Address))
+	if err != nil || a.Zone() != "" {
+		return h, fmt.Errorf("%w: address %q", ErrInvalidHost, h.Address)
+	}
+	h.Name = name
+	h.Address = a.Unmap().String()
+	return h, nil
+}
+
+// ListHosts returns all host entries ordered by name.
+func ListHosts(db *gorm.DB) ([]Host, error) {
+	var out []Host
+	err := db.Order("name, address").Find(&out).Error
+	return out, err
+}
+
+// AddHost validates and stores h. Adding a name/address pair that already
+// exists updates its TTL.
+func AddHost(db *gorm.DB, h Host) (Host, error) {
+	h, err := NormalizeHost(h)
+	if err != nil {
+		return h, err
+	}
+	var cur Host
+	if err := db.Where("name = ? AND address = ?", h.Name, h.Address).First(&cur).Error; err == nil {
+		cur.TTL = h.TTL
+		return cur, db.Save(&cur).Error
+	}
+	h.ID = 0
+	return h, db.Create(&h).Error
+}
+
+// UpdateHost replaces the name, address and TTL of the entry with h.ID.
+func UpdateHost(db *gorm.DB, h Host) (Host, error) {
+	var cur Host
+	if err := db.First(&cur, h.ID).Error; err != nil {
+		return cur, err
+	}
+	h, err := NormalizeHost(h)
+	if err != nil {
+		return h, err
+	}
+	cur.Name, cur.Address, cur.TTL = h.Name, h.Address, h.TTL
+	return cur, db.Save(&cur).Error
+}
+
+// DeleteHostsByName removes all entries for name and returns how many there were.
+func DeleteHostsByName(db *gorm.DB, name string) (int64, error) {
+	h, err := NormalizeHost(Host{Name: name, Address: "0.0.0.0"})
+	if err != nil {
+		return 0, err
+	}
+	res := db.Where("name = ?", h.Name).Delete(&Host{})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,39 @@
+package db
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeHost(t *testing.T) {
+	h, err := NormalizeHost(Host{Name: " Lab.Example.com ", Address: "::ffff:192.0.2.1"})
+	if err != nil || h.Name != "lab.example.com." || h.Address != "192.0.2.1" || h.Type() != "A" {
+		t.Fatalf("got %+v, %v", h, err)
+	}
+	if h, _ := NormalizeHost(Host{Name: "v6.test", Address: "2001:DB8::1"}); h.Address != "2001:db8::1" || h.Type() != "AAAA" {
+		t.Fatalf("got %+v", h)
+	}
+	for _, h := range []Host{{Name: "", Address: "192.0.2.1"}, {Name: "*.test", Address: "192.0.2.1"}, {Name: "a.test", Address: "example.com"}, {Name: "a.test", Address: "fe80::1%eth0"}} {
+		if _, err := NormalizeHost(h); !errors.Is(err, ErrInvalidHost) {
+			t.Errorf("%+v: want ErrInvalidHost, got %v", h, err)
+		}
+	}
+}
+
+func TestAddHost_UpdatesExistingPair(t *testing.T) {
+	db := newIsolatedDB(t)
+	a, err := AddHost(db, Host{Name: "a.test", Address: "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := AddHost(db, Host{Name: "A.test.", Address: "192.0.2.1", TTL: 60})
+	if err != nil || b.ID != a.ID || b.TTL != 60 {
+		t.Fatalf("got %+v, %v", b, err)
+	}
+	if _, err := AddHost(db, Host{Name: "a.test", Address: "192.0.2.2"}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := DeleteHostsByName(db, "a.test"); err != nil || n != 2 {
+		t.Fatalf("deleted %d, %v", n, err)
+	}
+}
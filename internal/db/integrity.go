@@ -0,0 +1,175 @@
+package db
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+	"gorm.io/gorm"
+)
+
+// IntegrityLimit caps the entries of each list of an IntegrityReport.
+const IntegrityLimit = 1000
+
+// IntegrityReport lists the inconsistencies found by CheckIntegrity. Zones
+// in the trash, with their RRSets, are not checked.
+type IntegrityReport struct {
+	Problems       int               `json:"problems"`
+	OrphanRData    []OrphanRData     `json:"orphan_rdata"`    // records whose RRSet is gone or deleted
+	OrphanRRSets   []IntegrityRRSet  `json:"orphan_rrsets"`   // RRSets whose zone is gone
+	OutOfZone      []IntegrityRRSet  `json:"out_of_zone"`     // RRSets named outside their zone
+	CNAMEConflicts []CNAMEConflict   `json:"cname_conflicts"` // names with a CNAME and other data
+	MissingApex    []ZoneApexProblem `json:"missing_apex"`    // zones without an apex SOA or NS
+	Truncated      bool              `json:"truncated,omitempty"`
+}
+
+// OrphanRData is a record that can no longer be reached.
+type OrphanRData struct {
+	ID      uint   `json:"id"`
+	RRSetID uint   `json:"rrset_id"`
+	Data    string `json:"data"`
+}
+
+// IntegrityRRSet is an RRSet of an IntegrityReport.
+type IntegrityRRSet struct {
+	ID     uint   `json:"id"`
+	ZoneID uint   `json:"zone_id"`
+	Zone   string `json:"zone,omitempty"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+}
+
+// CNAMEConflict is a name that has a CNAME next to other types.
+type CNAMEConflict struct {
+	ZoneID uint     `json:"zone_id"`
+	Zone   string   `json:"zone"`
+	Name   string   `json:"name"`
+	Types  []string `json:"types"`
+}
+
+// ZoneApexProblem is a zone missing apex record types.
+type ZoneApexProblem struct {
+	ZoneID  uint     `json:"zone_id"`
+	Zone    string   `json:"zone"`
+	Missing []string `json:"missing"`
+}
+
+// cnameSiblings are the types that may share a name with a CNAME (RFC 4035).
+var cnameSiblings = map[string]bool{"CNAME": true, "RRSIG": true, "NSEC": true}
+
+// integrityAdd appends item to a list of r unless the list is full,
+// counting the problem either way.
+func integrityAdd[T any](r *IntegrityReport, list *[]T, item T) {
+	r.Problems++
+	if len(*list) >= IntegrityLimit {
+		r.Truncated = true
+		return
+	}
+	*list = append(*list, item)
+}
+
+// CheckIntegrity reports orphaned records and RRSets, RRSets outside their
+// zone, CNAMEs sharing a name with other types and zones lacking an apex SOA
+// or NS. It only reads; orphans are removed by CleanupOrphans.
+func CheckIntegrity(db *gorm.DB) (IntegrityReport, error) {
+	r := IntegrityReport{
+		OrphanRData:    []OrphanRData{},
+		OrphanRRSets:   []IntegrityRRSet{},
+		OutOfZone:      []IntegrityRRSet{},
+		CNAMEConflicts: []CNAMEConflict{},
+		MissingApex:    []ZoneApexProblem{},
+	}
+
+	var orphanRData []OrphanRData
+	err := db.Model(&RData{}).Select("id, rr_set_id, data").
+		Where("rr_set_id NOT IN (?)", db.Unscoped().Model(&RRSet{}).Select("id")).
+		Or("rr_set_id IN (?)", db.Unscoped().Model(&RRSet{}).Select("id").
+			Where("deleted_at IS NOT NULL AND zone_id IN (?)", db.Model(&Zone{}).Select("id"))).
+		Order("id").Find(&orphanRData).Error
+	if err != nil {
+		return r, err
+	}
+	for _, o := range orphanRData {
+		integrityAdd(&r, &r.OrphanRData, o)
+	}
+
+	var orphanSets []IntegrityRRSet
+	err = db.Model(&RRSet{}).Select("id, zone_id, name, type").
+		Where("zone_id NOT IN (?)", db.Unscoped().Model(&Zone{}).Select("id")).
+		Order("id").Find(&orphanSets).Error
+	if err != nil {
+		return r, err
+	}
+	for _, o := range orphanSets {
+		integrityAdd(&r, &r.OrphanRRSets, o)
+	}
+
+	var zones []Zone
+	if err := db.Select("id, name").Order("name").Find(&zones).Error; err != nil {
+		return r, err
+	}
+	apex := make(map[uint]map[string]bool, len(zones))
+	for _, z := range zones {
+		apex[z.ID] = map[string]bool{}
+	}
+
+	// RRSets come ordered by zone and name so the types of a name are seen together
+	rows, err := db.Model(&RRSet{}).
+		Select("rr_sets.id, rr_sets.zone_id, zones.name, rr_sets.name, rr_sets.type").
+		Joins("JOIN zones ON zones.id = rr_sets.zone_id AND zones.deleted_at IS NULL").
+		Order("rr_sets.zone_id, rr_sets.name, rr_sets.type").Rows()
+	if err != nil {
+		return r, err
+	}
+	defer rows.Close()
+	var group []IntegrityRRSet
+	flush := func() {
+		if len(group) < 2 {
+			return
+		}
+		hasCNAME, other := false, false
+		types := make([]string, 0, len(group))
+		for _, s := range group {
+			hasCNAME = hasCNAME || s.Type == "CNAME"
+			other = other || !cnameSiblings[s.Type]
+			types = append(types, s.Type)
+		}
+		if hasCNAME && other {
+			integrityAdd(&r, &r.CNAMEConflicts, CNAMEConflict{ZoneID: group[0].ZoneID, Zone: group[0].Zone, Name: group[0].Name, Types: types})
+		}
+	}
+	for rows.Next() {
+		var s IntegrityRRSet
+		if err := rows.Scan(&s.ID, &s.ZoneID, &s.Zone, &s.Name, &s.Type); err != nil {
+			return r, err
+		}
+		s.Type = strings.ToUpper(s.Type)
+		zone, name := dns.Fqdn(strings.ToLower(s.Zone)), dns.Fqdn(strings.ToLower(s.Name))
+		if !dns.IsSubDomain(zone, name) {
+			integrityAdd(&r, &r.OutOfZone, s)
+		} else if name == zone && apex[s.ZoneID] != nil {
+			apex[s.ZoneID][s.Type] = true
+		}
+		if len(group) > 0 && (group[0].ZoneID != s.ZoneID || !strings.EqualFold(group[0].Name, s.Name)) {
+			flush()
+			group = group[:0]
+		}
+		group = append(group, s)
+	}
+	if err := rows.Err(); err != nil {
+		return r, err
+	}
+	flush()
+
+	for _, z := range zones {
+		var missing []string
+		for _, t := range []string{"SOA", "NS"} {
+			if !apex[z.ID][t] {
+				missing = append(missing, t)
+			}
+		}
+		if len(missing) > 0 {
+			integrityAdd(&r, &r.MissingApex, ZoneApexProblem{ZoneID: z.ID, Zone: z.Name, Missing: missing})
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckIntegrity(t *testing.T) {
+	db := newIsolatedDB(t)
+	good := Zone{Name: "good.example.", RRSets: []RRSet{
+		{Name: "good.example.", Type: "SOA", TTL: 300, Records: []RData{{Data: "ns1.good.example. hostmaster.good.example. 1 3600 600 604800 300"}}},
+		{Name: "good.example.", Type: "NS", TTL: 300, Records: []RData{{Data: "ns1.good.example."}}},
+		{Name: "www.good.example.", Type: "A", TTL: 300, Records: []RData{{Data: "192.0.2.1"}}},
+	}}
+	bad := Zone{Name: "bad.example", RRSets: []RRSet{
+		{Name: "bad.example.", Type: "NS", TTL: 300, Records: []RData{{Data: "ns1.bad.example."}}},
+		{Name: "www.bad.example.", Type: "CNAME", TTL: 300, Records: []RData{{Data: "good.example."}}},
+		{Name: "www.bad.example.", Type: "TXT", TTL: 300, Records: []RData{{Data: `"x"`}}},
+		{Name: "www.other.example.", Type: "A", TTL: 300, Records: []RData{{Data: "192.0.2.2"}}},
+	}}
+	trashed := Zone{Name: "trashed.example."}
+	for _, z := range []*Zone{&good, &bad, &trashed} {
+		if err := db.Create(z).Error; err != nil {
+			t.Fatalf("create zone: %v", err)
+		}
+	}
+	if err := db.Delete(&trashed).Error; err != nil {
+		t.Fatalf("trash zone: %v", err)
+	}
+	// Rows left behind by hard deletes that skipped their children
+	lost := RRSet{ZoneID: 9999, Name: "lost.example.", Type: "A", TTL: 300}
+	if err := db.Create(&lost).Error; err != nil {
+		t.Fatalf("create orphan rrset: %v", err)
+	}
+	orphan := RData{RRSetID: 9999, Data: "192.0.2.9"}
+	if err := db.Create(&orphan).Error; err != nil {
+		t.Fatalf("create orphan rdata: %v", err)
+	}
+
+	r, err := CheckIntegrity(db)
+	if err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if len(r.OrphanRData) != 1 || r.OrphanRData[0].ID != orphan.ID || r.OrphanRData[0].RRSetID != 9999 {
+		t.Errorf("orphan rdata: %+v", r.OrphanRData)
+	}
+	if len(r.OrphanRRSets) != 1 || r.OrphanRRSets[0].ID != lost.ID {
+		t.Errorf("orphan rrsets: %+v", r.OrphanRRSets)
+	}
+	if len(r.OutOfZone) != 1 || r.OutOfZone[0].Name != "www.other.example." || r.OutOfZone[0].Zone != "bad.example" {
+		t.Errorf("out of zone: %+v", r.OutOfZone)
+	}
+	if len(r.CNAMEConflicts) != 1 || r.CNAMEConflicts[0].Name != "www.bad.example." || !reflect.DeepEqual(r.CNAMEConflicts[0].Types, []string{"CNAME", "TXT"}) {
+		t.Errorf("cname conflicts: %+v", r.CNAMEConflicts)
+	}
+	if len(r.MissingApex) != 1 || r.MissingApex[0].Zone != "bad.example" || !reflect.DeepEqual(r.MissingApex[0].Missing, []string{"SOA"}) {
+		t.Errorf("missing apex: %+v", r.MissingApex)
+	}
+	if r.Problems != 5 || r.Truncated {
+		t.Errorf("problems %d truncated %v, want 5", r.Problems, r.Truncated)
+	}
+}
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// CleanupStats counts rows removed by CleanupOrphans.
+type CleanupStats struct {
+	RData           int64 `json:"rdata"`
+	RRSets          int64 `json:"rrsets"`
+	TemplateRecords int64 `json:"template_records"`
+}
+
+// Total returns the number of removed rows.
+func (s CleanupStats) Total() int64 {
+	return s.RData + s.RRSets + s.TemplateRecords
+}
+
+// CleanupOrphans permanently removes rows that can no longer be reached:
+//   - RRSets whose zone is gone, and soft-deleted RRSets of active zones
+//     (RRSets of zones in the trash are kept so the zone can be restored)
+//   - RData whose RRSet is gone or soft-deleted outside the trash, and soft-deleted RData
+//   - TemplateRecords whose template is gone or soft-deleted
+//   - TemplateApplications whose template or zone is gone
+//   - DHCPLeases whose zone is gone
+func CleanupOrphans(db *gorm.DB) (CleanupStats, error) {
+	var st CleanupStats
+	err := db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Unscoped().
+			Where("zone_id NOT IN (?)", tx.Unscoped().Model(&Zone{}).Select("id")).
+			Or("deleted_at IS NOT NULL AND zone_id IN (?)", tx.Model(&Zone{}).Select("id")).
+			Delete(&RRSet{})
+		if res.Error != nil {
+			return fmt.Errorf("rrsets: %w", res.Error)
+		}
+		st.RRSets = res.RowsAffected
+
+		res = tx.Unscoped().
+			Where("deleted_at IS NOT NULL").
+			Or("rr_set_id NOT IN (?)", tx.Unscoped().Model(&RRSet{}).Select("id")).
+			Delete(&RData{})
+		if res.Error != nil {
+			return fmt.Errorf("rdata: %w", res.Error)
+		}
+		st.RData = res.RowsAffected
+
+		res = tx.Unscoped().
+			Where("deleted_at IS NOT NULL").
+			Or("template_id NOT IN (?)", tx.Model(&Template{}).Select("id")).
+			Delete(&TemplateRecord{})
+		if res.Error != nil {
+			return fmt.Errorf("template records: %w", res.Error)
+		}
+		st.TemplateRecords = res.RowsAffected
+
+		// Soft-deleted templates have no restore path; drop them with their records gone
+		if err := tx.Unscoped().Where("deleted_at IS NOT NULL").Delete(&Template{}).Error; err != nil {
+			return fmt.Errorf("templates: %w", err)
+		}
+		// Databases being upgraded may not have the table yet
+		if !tx.Migrator().HasTable(&TemplateApplication{}) {
+			return nil
+		}
+		if err := tx.Where("template_id NOT IN (?)", tx.Unscoped().Model(&Template{}).Select("id")).
+			Or("zone_id NOT IN (?)", tx.Unscoped().Model(&Zone{}).Select("id")).
+			Delete(&TemplateApplication{}).Error; err != nil {
+			return fmt.Errorf("template applications: %w", err)
+		}
+		if !tx.Migrator().HasTable(&DHCPLease{}) {
+			return nil
+		}
+		if err := tx.Where("zone_id NOT IN (?)", tx.Unscoped().Model(&Zone{}).Select("id")).
+			Delete(&DHCPLease{}).Error; err != nil {
+			return fmt.Errorf("dhcp leases: %w", err)
+		}
+		return nil
+	})
+	return st, err
+}
+
+// Vacuum reclaims space and refreshes planner statistics using the
+// database-specific command (VACUUM/ANALYZE, VACUUM ANALYZE, OPTIMIZE TABLE).
+func Vacuum(db *gorm.DB) error {
+	switch db.Dialector.Name() {
+	case "sqlite":
+		if err := db.Exec("VACUUM").Error; err != nil {
+			return err
+		}
+		return db.Exec("ANALYZE").Error
+	case "postgres":
+		return db.Exec("VACUUM ANALYZE").Error
+	case "mysql":
+		tables, err := tableNames(db)
+		if err != nil {
+			return err
+		}
+		// OPTIMIZE returns a result set; Raw+Rows drains it instead of failing on Exec
+		rows, err := db.Raw("OPTIMIZE TABLE " + strings.Join(tables, ", ")).Rows()
+		if err != nil {
+			return err
+		}
+		return rows.Close()
+	default:
+		return fmt.Errorf("vacuum not supported for %s", db.Dialector.Name())
+	}
+}
+
+// Size returns the on-disk size of the database in bytes.
+func Size(db *gorm.DB) (int64, error) {
+	var size int64
+	var err error
+	switch db.Dialector.Name() {
+	case "sqlite":
+		err = db.Raw("SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size()").Scan(&size).Error
+	case "postgres":
+		err = db.Raw("SELECT pg_database_size(current_database())").Scan(&size).Error
+	case "mysql":
+		err = db.Raw("SELECT COALESCE(SUM(data_length + index_length), 0) FROM information_schema.tables WHERE table_schema = DATABASE()").Scan(&size).Error
+	default:
+		err = fmt.Errorf("size not supported for %s", db.Dialector.Name())
+	}
+	return size, err
+}
+
+func tableNames(db *gorm.DB) ([]string, error) {
+	var out []string
+	for _, m := range []interface{}{&Zone{}, &RRSet{}, &RData{}, &Template{}, &TemplateRecord{}, &TemplateApplication{}, &QueryStat{}, &ClientStat{}, &AuditEntry{}, &Host{}, &DHCPLease{}} {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(m); err != nil {
+			return nil, err
+		}
+		out = append(out, stmt.Schema.Table)
+	}
+	return out, nil
+}
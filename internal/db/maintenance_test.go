@@ -0,0 +1,69 @@
+package db
+
+import "testing"
+
+func TestCleanupOrphans(t *testing.T) {
+	db := newIsolatedDB(t)
+
+	active := createZoneWithSets(t, db, "active.example.", "www.active.example.", "gone.active.example.")
+	trashed := createZoneWithSets(t, db, "trashed.example.", "www.trashed.example.")
+
+	// Individually deleted RRSet in an active zone: unreachable, must go
+	if err := db.Where("name = ?", "gone.active.example.").Delete(&RRSet{}).Error; err != nil {
+		t.Fatalf("delete rrset: %v", err)
+	}
+	// Zone in trash: its RRSets must survive
+	if err := TrashZone(db, trashed.ID); err != nil {
+		t.Fatalf("trash: %v", err)
+	}
+	// RRSet and RData whose parents were hard-deleted
+	orphanSet := RRSet{ZoneID: 9999, Name: "x.", Type: "A", Records: []RData{{Data: "192.0.2.9"}}}
+	if err := db.Create(&orphanSet).Error; err != nil {
+		t.Fatalf("create orphan: %v", err)
+	}
+	if err := db.Create(&RData{RRSetID: 8888, Data: "192.0.2.8"}).Error; err != nil {
+		t.Fatalf("create orphan rdata: %v", err)
+	}
+	// Template record without template
+	if err := db.Create(&TemplateRecord{TemplateID: 7777, Name: "@", Type: "A", Data: "192.0.2.7"}).Error; err != nil {
+		t.Fatalf("create orphan template record: %v", err)
+	}
+
+	st, err := CleanupOrphans(db)
+	if err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+	// RRSets: gone.active + orphanSet; RData: gone.active's, orphanSet's, stray one
+	if st.RRSets != 2 || st.RData != 3 || st.TemplateRecords != 1 {
+		t.Fatalf("unexpected stats: %+v", st)
+	}
+
+	var sets int64
+	db.Unscoped().Model(&RRSet{}).Count(&sets)
+	if sets != 2 {
+		t.Fatalf("expected www.active and www.trashed rrsets to remain, got %d", sets)
+	}
+	if _, err := RestoreZone(db, trashed.ID); err != nil {
+		t.Fatalf("trashed zone should still be restorable: %v", err)
+	}
+	var rd int64
+	db.Model(&RData{}).Where("rr_set_id IN (?)", db.Model(&RRSet{}).Select("id").Where("zone_id IN ?", []uint{active.ID, trashed.ID})).Count(&rd)
+	if rd != 2 {
+		t.Fatalf("expected live records to remain, got %d", rd)
+	}
+
+	if err := Vacuum(db); err != nil {
+		t.Fatalf("vacuum: %v", err)
+	}
+}
+
+func TestSize(t *testing.T) {
+	db := newIsolatedDB(t)
+	size, err := Size(db)
+	if err != nil {
+		t.Fatalf("size: %v", err)
+	}
+	if size <= 0 {
+		t.Fatalf("expected positive size, got %d", size)
+	}
+}
@@ -7,12 +7,30 @@ import (
 )
 
 type Zone struct {
-    ID        uint           `gorm:"primaryKey" json:"id"`
-    Name      string         `gorm:"uniqueIndex;size:255" json:"name"`
-    CreatedAt time.Time      `json:"created_at"`
-    UpdatedAt time.Time      `json:"updated_at"`
-    DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
-    RRSets    []RRSet        `json:"rrsets"`
+    ID           uint           `gorm:"primaryKey" json:"id"`
+    Name         string         `gorm:"uniqueIndex;size:255" json:"name"`
+    ManagedBy    string         `gorm:"size:32" json:"managed_by,omitempty"` // Set when an external source (e.g. zone_dir) owns the zone
+    Serial       uint32         `json:"serial"`                              // Copy of the SOA serial, kept in sync by the SOA helpers
+    Disabled     bool           `gorm:"not null;default:false" json:"disabled"` // Disabled zones are kept but not served
+    // Overrides the minimal_responses config for this zone (nil = use the config)
+    MinimalResponses *bool      `json:"minimal_responses,omitempty"`
+    // Answers from the zone are never cached, e.g. for health-checked
+    // records that must fail over at once
+    NoCache      bool           `gorm:"not null;default:false" json:"no_cache,omitempty"`
+    // Optional expiry: the zone is disabled or trashed at ExpireAt, or after
+    // InactiveDays without queries or changes.
+    ExpireAt     *time.Time     `json:"expire_at,omitempty"`
+    InactiveDays int            `json:"inactive_days,omitempty"`
+    ExpireAction string         `gorm:"size:16" json:"expire_action,omitempty"` // disable | trash (empty = expiry.default_action)
+    // Set while the zone is locked for maintenance; changes are refused
+    // until it is unlocked.
+    LockedBy     string         `gorm:"size:128" json:"locked_by,omitempty"`
+    LockReason   string         `gorm:"type:text" json:"lock_reason,omitempty"`
+    LockedAt     *time.Time     `json:"locked_at,omitempty"`
+    CreatedAt    time.Time      `json:"created_at"`
+    UpdatedAt    time.Time      `json:"updated_at"`
+    DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+    RRSets       []RRSet        `gorm:"constraint:OnDelete:CASCADE" json:"rrsets"`
 }
 
 type RRSet struct {
@@ -21,23 +39,54 @@ type RRSet struct {
     Name      string         `gorm:"uniqueIndex:idx_rrset_unique;index:idx_rrset_lookup;size:255" json:"name"`
     Type      string         `gorm:"uniqueIndex:idx_rrset_unique;index:idx_rrset_lookup;size:20" json:"type"`
     TTL       uint32         `json:"ttl"`
+    Comment   string         `gorm:"type:text" json:"comment,omitempty"` // Free-form operator note
+    Source    string         `gorm:"size:128" json:"source,omitempty"`  // Who last created or saved the set, see WithSource
+    DynamicURL *string       `gorm:"size:512" json:"dynamic_url,omitempty"` // Endpoint the DNS server fetches the records from, see CheckDynamicURL (nil = the stored records)
     CreatedAt time.Time      `json:"created_at"`
     UpdatedAt time.Time      `json:"updated_at"`
     DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
-    Records   []RData        `gorm:"foreignKey:RRSetID" json:"records"`
+    Records   []RData        `gorm:"foreignKey:RRSetID;constraint:OnDelete:CASCADE" json:"records"`
 }
 
 type RData struct {
-    ID        uint           `gorm:"primaryKey" json:"id"`
-    RRSetID   uint           `gorm:"index" json:"rrset_id"`
-    Data      string         `gorm:"type:text" json:"data"`
-    Country   *string        `gorm:"size:2" json:"country,omitempty"`
-    Continent *string        `gorm:"size:2" json:"continent,omitempty"`
-    ASN       *int           `json:"asn,omitempty"`
-    Subnet    *string        `gorm:"size:64" json:"subnet,omitempty"`
-    CreatedAt time.Time      `json:"created_at"`
-    UpdatedAt time.Time      `json:"updated_at"`
-    DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+    ID          uint           `gorm:"primaryKey" json:"id"`
+    RRSetID     uint           `gorm:"index;uniqueIndex:idx_rdata_unique" json:"rrset_id"`
+    Data        string         `gorm:"type:text" json:"data"`
+    Country     *string        `gorm:"size:2" json:"country,omitempty"`
+    Continent   *string        `gorm:"size:2" json:"continent,omitempty"`
+    ASN         *int           `json:"asn,omitempty"`
+    ASNs        *string        `gorm:"size:1024" json:"asns,omitempty"` // ASNs and ranges, e.g. "3320,64512-65534", see NormalizeASNs
+    Subnet      *string        `gorm:"size:64" json:"subnet,omitempty"`
+    TTL         *uint32        `json:"ttl,omitempty"` // Overrides the RRSet TTL for this record (nil = RRSet TTL)
+    Weight      *uint32        `json:"weight,omitempty"` // Share of answers among the records of the same geo match (nil = not weighted)
+    HealthCheck *string        `gorm:"size:512" json:"health_check,omitempty"` // Probe that must pass for the record to be served, see ParseHealthCheck (nil = always served)
+    Backup      bool           `gorm:"not null;default:false" json:"backup,omitempty"` // Served only when no healthy primary record matches the client
+    Disabled    bool           `gorm:"not null;default:false" json:"disabled,omitempty"` // Disabled records are kept but not served, transferred or published
+    DedupeKey   string         `gorm:"size:64;uniqueIndex:idx_rdata_unique" json:"-"` // Hash of Data + geo selectors, set by BeforeSave
+    Source      string         `gorm:"size:128" json:"source,omitempty"` // Who last created or saved the record, see WithSource
+    CreatedAt   time.Time      `json:"created_at"`
+    UpdatedAt   time.Time      `json:"updated_at"`
+    DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// AnswerTTL is the TTL the record is served with: its own override, or the
+// TTL of its RRSet.
+func (r RData) AnswerTTL(setTTL uint32) uint32 {
+    if r.TTL != nil {
+        return *r.TTL
+    }
+    return setTTL
+}
+
+// EnabledRecords returns the records of recs that are not disabled.
+func EnabledRecords(recs []RData) []RData {
+    out := make([]RData, 0, len(recs))
+    for _, r := range recs {
+        if !r.Disabled {
+            out = append(out, r)
+        }
+    }
+    return out
 }
 
 // Template represents a DNS record template
@@ -45,10 +94,11 @@ type Template struct {
     ID          uint             `gorm:"primaryKey" json:"id"`
     Name        string           `gorm:"size:100;not null" json:"name"`
     Description string           `gorm:"type:text" json:"description"`
+    Version     uint             `gorm:"not null;default:1" json:"version"` // Raised by every change to the template or its records
     CreatedAt   time.Time        `json:"created_at"`
     UpdatedAt   time.Time        `json:"updated_at"`
     DeletedAt   gorm.DeletedAt   `gorm:"index" json:"-"`
-    Records     []TemplateRecord `json:"records"`
+    Records     []TemplateRecord `gorm:"constraint:OnDelete:CASCADE" json:"records"`
 }
 
 // TemplateRecord represents a DNS record within a template
@@ -62,6 +112,7 @@ type TemplateRecord struct {
     Country     *string        `gorm:"size:2" json:"country,omitempty"`
     Continent   *string        `gorm:"size:2" json:"continent,omitempty"`
     ASN         *int           `json:"asn,omitempty"`
+    ASNs        *string        `gorm:"size:1024" json:"asns,omitempty"`
     Subnet      *string        `gorm:"size:64" json:"subnet,omitempty"`
     CreatedAt   time.Time      `json:"created_at"`
     UpdatedAt   time.Time      `json:"updated_at"`
@@ -2,7 +2,10 @@ package db
 
 import (
     "fmt"
+    "log"
+    "time"
 
+    mysqldrv "github.com/go-sql-driver/mysql"
     "gorm.io/driver/mysql"
     "gorm.io/driver/postgres"
     "gorm.io/driver/sqlite"
@@ -29,23 +32,141 @@ func OpenWithDebug(cfg config.DBConfig, debug bool) (*gorm.DB, error) {
         Logger: logger.Default.LogMode(logLevel),
     }
 
+    // Configuration errors are not worth retrying
+    if _, err := newDialector(cfg); err != nil {
+        return nil, err
+    }
+
+    retryFor := time.Duration(cfg.ConnectRetrySec) * time.Second
+    if isSQLite(cfg.Driver) || cfg.ConnectRetrySec < 0 {
+        retryFor = 0 // local file, nothing to wait for, or retrying is off
+    }
+    deadline := time.Now().Add(retryFor)
+    backoff := 500 * time.Millisecond
+    for attempt := 1; ; attempt++ {
+        dialector, _ := newDialector(cfg)
+        gdb, err := gorm.Open(dialector, gormCfg)
+        if err == nil {
+            if err = configurePool(gdb, cfg); err == nil {
+                return gdb, nil
+            }
+        }
+        closeQuietly(gdb)
+        if time.Now().Add(backoff).After(deadline) {
+            if attempt > 1 {
+                return nil, fmt.Errorf("database unavailable after %d attempts: %w", attempt, err)
+            }
+            return nil, err
+        }
+        log.Printf("db: connection attempt %d failed: %v (retrying in %s)", attempt, err, backoff)
+        time.Sleep(backoff)
+        backoff *= 2
+        if backoff > maxConnectBackoff {
+            backoff = maxConnectBackoff
+        }
+    }
+}
+
+const maxConnectBackoff = 10 * time.Second
+
+func isSQLite(driver string) bool {
+    return driver == "sqlite" || driver == "sqlite3" || driver == ""
+}
+
+func newDialector(cfg config.DBConfig) (gorm.Dialector, error) {
     switch cfg.Driver {
     case "postgres", "postgresql":
-        return gorm.Open(postgres.Open(cfg.DSN), gormCfg)
-    case "mysql":
-        return gorm.Open(mysql.Open(cfg.DSN), gormCfg)
+        return postgres.Open(cfg.DSN), nil
+    case "mysql", "mariadb":
+        dsn, err := normalizeMySQLDSN(cfg.DSN)
+        if err != nil {
+            return nil, err
+        }
+        return mysql.New(mysql.Config{
+            DSN: dsn,
+            // 191 chars * 4 bytes fits the 767-byte index prefix limit of older InnoDB row formats
+            DefaultStringSize: 191,
+        }), nil
     case "sqlite", "sqlite3", "":
         dsn := cfg.DSN
         if dsn == "" {
             dsn = "file:namedot.db?_foreign_keys=on"
         }
-        return gorm.Open(sqlite.Open(dsn), gormCfg)
+        return sqlite.Open(normalizeSQLiteDSN(dsn)), nil
     default:
         return nil, fmt.Errorf("unsupported db driver: %s", cfg.Driver)
     }
 }
 
+// configurePool applies connection pool limits and verifies the connection.
+func configurePool(gdb *gorm.DB, cfg config.DBConfig) error {
+    sqlDB, err := gdb.DB()
+    if err != nil {
+        return err
+    }
+    if cfg.MaxOpenConns > 0 {
+        sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+    }
+    if cfg.MaxIdleConns > 0 {
+        sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+    }
+    if cfg.ConnMaxLifetimeSec > 0 {
+        sqlDB.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetimeSec) * time.Second)
+    }
+    return sqlDB.Ping()
+}
+
+func closeQuietly(gdb *gorm.DB) {
+    if gdb == nil {
+        return
+    }
+    if sqlDB, err := gdb.DB(); err == nil {
+        _ = sqlDB.Close()
+    }
+}
+
+// normalizeMySQLDSN makes sure timestamps are parsed into time.Time and the
+// connection uses utf8mb4, so IDN/TXT data round-trips without mangling.
+func normalizeMySQLDSN(dsn string) (string, error) {
+    mc, err := mysqldrv.ParseDSN(dsn)
+    if err != nil {
+        return "", fmt.Errorf("invalid mysql dsn: %w", err)
+    }
+    mc.ParseTime = true
+    if mc.Params == nil {
+        mc.Params = map[string]string{}
+    }
+    if _, ok := mc.Params["charset"]; !ok {
+        mc.Params["charset"] = "utf8mb4"
+    }
+    return mc.FormatDSN(), nil
+}
+
 func AutoMigrate(db *gorm.DB) error {
-    return db.AutoMigrate(&Zone{}, &RRSet{}, &RData{}, &Template{}, &TemplateRecord{})
+    if db.Dialector.Name() == "mysql" {
+        db = db.Set("gorm:table_options", "ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci")
+    }
+    return withoutForeignKeys(db, func(db *gorm.DB) error {
+        if err := upgradeForeignKeys(db); err != nil {
+            return err
+        }
+        if err := backfillDedupeKeys(db); err != nil {
+            return err
+        }
+        needSerials := db.Migrator().HasTable(&Zone{}) && !db.Migrator().HasColumn(&Zone{}, "Serial")
+        needDaily := db.Migrator().HasTable(&QueryStat{}) && !db.Migrator().HasTable(&DailyQueryStat{})
+        if err := db.AutoMigrate(&Zone{}, &RRSet{}, &RData{}, &Template{}, &TemplateRecord{}, &TemplateApplication{}, &QueryStat{}, &DailyQueryStat{}, &ClientStat{}, &AuditEntry{}, &Host{}, &ZoneSettings{}, &ZoneCanary{}, &DHCPLease{}, &Setting{}, &Credential{}); err != nil {
+            return err
+        }
+        if needDaily {
+            if err := backfillDailyQueryStats(db); err != nil {
+                return err
+            }
+        }
+        if needSerials {
+            return backfillZoneSerials(db)
+        }
+        return nil
+    })
 }
 
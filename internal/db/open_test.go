@@ -0,0 +1,109 @@
+package db
+
+import (
+    "strings"
+    "testing"
+    "time"
+
+    "namedot/internal/config"
+)
+
+func TestNormalizeMySQLDSN(t *testing.T) {
+    tests := []struct {
+        name    string
+        dsn     string
+        want    []string
+        notWant []string
+    }{
+        {
+            name: "adds parseTime and utf8mb4",
+            dsn:  "namedot:secret@tcp(db:3306)/namedot",
+            want: []string{"parseTime=true", "charset=utf8mb4"},
+        },
+        {
+            name:    "keeps explicit charset",
+            dsn:     "namedot:secret@tcp(db:3306)/namedot?charset=utf8&parseTime=false",
+            want:    []string{"parseTime=true", "charset=utf8"},
+            notWant: []string{"utf8mb4"},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := normalizeMySQLDSN(tt.dsn)
+            if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+            }
+            for _, w := range tt.want {
+                if !strings.Contains(got, w) {
+                    t.Errorf("dsn %q missing %q", got, w)
+                }
+            }
+            for _, w := range tt.notWant {
+                if strings.Contains(got, w) {
+                    t.Errorf("dsn %q should not contain %q", got, w)
+                }
+            }
+        })
+    }
+
+    if _, err := normalizeMySQLDSN("not a dsn"); err == nil {
+        t.Error("expected error for invalid dsn")
+    }
+}
+
+func TestOpen_AppliesPoolSettings(t *testing.T) {
+    gdb, err := Open(config.DBConfig{Driver: "sqlite", DSN: ":memory:", MaxOpenConns: 3, MaxIdleConns: 2})
+    if err != nil {
+        t.Fatalf("open: %v", err)
+    }
+    sqlDB, err := gdb.DB()
+    if err != nil {
+        t.Fatalf("db: %v", err)
+    }
+    defer sqlDB.Close()
+    if got := sqlDB.Stats().MaxOpenConnections; got != 3 {
+        t.Fatalf("MaxOpenConnections = %d, want 3", got)
+    }
+}
+
+func TestOpen_RetriesUnavailableDatabase(t *testing.T) {
+    start := time.Now()
+    _, err := Open(config.DBConfig{
+        Driver:          "postgres",
+        DSN:             "host=127.0.0.1 port=1 user=x dbname=x sslmode=disable connect_timeout=1",
+        ConnectRetrySec: 1,
+    })
+    if err == nil {
+        t.Fatal("expected connection error")
+    }
+    if !strings.Contains(err.Error(), "attempts") {
+        t.Fatalf("expected retry error, got: %v", err)
+    }
+    if time.Since(start) < 400*time.Millisecond {
+        t.Fatalf("expected to wait between attempts, returned after %s", time.Since(start))
+    }
+}
+
+func TestOpen_RetryOff(t *testing.T) {
+    _, err := Open(config.DBConfig{
+        Driver:          "postgres",
+        DSN:             "host=127.0.0.1 port=1 user=x dbname=x sslmode=disable connect_timeout=1",
+        ConnectRetrySec: -1,
+    })
+    if err == nil {
+        t.Fatal("expected connection error")
+    }
+    if strings.Contains(err.Error(), "attempts") {
+        t.Fatalf("expected a single attempt, got: %v", err)
+    }
+}
+
+func TestOpen_UnsupportedDriverFailsFast(t *testing.T) {
+    start := time.Now()
+    if _, err := Open(config.DBConfig{Driver: "oracle", DSN: "x", ConnectRetrySec: 30}); err == nil {
+        t.Fatal("expected error")
+    }
+    if time.Since(start) > time.Second {
+        t.Fatal("configuration errors should not be retried")
+    }
+}
@@ -0,0 +1,154 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// QueryStat counts DNS queries for one zone and type within one hour.
+type QueryStat struct {
+	ID      uint      `gorm:"primaryKey" json:"-"`
+	Zone    string    `gorm:"size:255;uniqueIndex:idx_query_stat" json:"zone"`
+	QType   string    `gorm:"size:20;uniqueIndex:idx_query_stat" json:"qtype"`
+	Hour    time.Time `gorm:"uniqueIndex:idx_query_stat;index" json:"hour"`
+	Queries int64     `json:"queries"`
+}
+
+// DailyQueryStat is the daily sum of the QueryStat rows of a zone and type.
+// It is kept longer than the hourly rows, for usage reports.
+type DailyQueryStat struct {
+	ID      uint      `gorm:"primaryKey" json:"-"`
+	Zone    string    `gorm:"size:255;uniqueIndex:idx_daily_query_stat" json:"zone"`
+	QType   string    `gorm:"size:20;uniqueIndex:idx_daily_query_stat" json:"qtype"`
+	Day     time.Time `gorm:"uniqueIndex:idx_daily_query_stat;index" json:"day"`
+	Queries int64     `json:"queries"`
+}
+
+// QueryCount is one in-memory counter to be added to the stats table.
+type QueryCount struct {
+	Zone    string
+	QType   string
+	Queries int64
+}
+
+// AddQueryCounts adds counters to the hourly rows for hour and the daily
+// rows of its UTC day, creating rows as needed.
+func AddQueryCounts(db *gorm.DB, hour time.Time, counts []QueryCount) error {
+	hour = hour.UTC().Truncate(time.Hour)
+	day := hour.Truncate(24 * time.Hour)
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, c := range counts {
+			res := tx.Model(&QueryStat{}).
+				Where("zone = ? AND q_type = ? AND hour = ?", c.Zone, c.QType, hour).
+				UpdateColumn("queries", gorm.Expr("queries + ?", c.Queries))
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				if err := tx.Create(&QueryStat{Zone: c.Zone, QType: c.QType, Hour: hour, Queries: c.Queries}).Error; err != nil {
+					return err
+				}
+			}
+			if err := addDailyQueryCount(tx, day, c); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func addDailyQueryCount(tx *gorm.DB, day time.Time, c QueryCount) error {
+	res := tx.Model(&DailyQueryStat{}).
+		Where("zone = ? AND q_type = ? AND day = ?", c.Zone, c.QType, day).
+		UpdateColumn("queries", gorm.Expr("queries + ?", c.Queries))
+	if res.Error != nil || res.RowsAffected > 0 {
+		return res.Error
+	}
+	return tx.Create(&DailyQueryStat{Zone: c.Zone, QType: c.QType, Day: day, Queries: c.Queries}).Error
+}
+
+// QueryStatsFilter selects and groups rows for QueryStats.
+type QueryStatsFilter struct {
+	Zone   string // exact zone name, empty = all
+	QType  string // empty = all
+	From   time.Time
+	To     time.Time
+	ByHour bool // keep hourly buckets instead of summing over the range
+}
+
+// QueryStats returns query counts per zone and type in [From, To), busiest first
+// (or in time order when grouped by hour).
+func QueryStats(db *gorm.DB, f QueryStatsFilter) ([]QueryStat, error) {
+	cols := "zone, q_type"
+	if f.ByHour {
+		cols += ", hour"
+	}
+	q := db.Model(&QueryStat{}).
+		Select(cols+", SUM(queries) AS queries").
+		Where("hour >= ? AND hour < ?", f.From.UTC(), f.To.UTC()).
+		Group(cols)
+	if f.Zone != "" {
+		q = q.Where("zone = ?", f.Zone)
+	}
+	if f.QType != "" {
+		q = q.Where("q_type = ?", f.QType)
+	}
+	if f.ByHour {
+		q = q.Order("hour, zone, q_type")
+	} else {
+		q = q.Order("queries desc, zone, q_type")
+	}
+	var out []QueryStat
+	if err := q.Scan(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PurgeQueryStats deletes hourly counters older than before.
+func PurgeQueryStats(db *gorm.DB, before time.Time) (int64, error) {
+	res := db.Where("hour < ?", before.UTC()).Delete(&QueryStat{})
+	return res.RowsAffected, res.Error
+}
+
+// DailyQueryStats returns the daily counters of zone in [from, to), by day
+// and type.
+func DailyQueryStats(db *gorm.DB, zone string, from, to time.Time) ([]DailyQueryStat, error) {
+	var out []DailyQueryStat
+	err := db.Where("zone = ? AND day >= ? AND day < ?", zone, from.UTC(), to.UTC()).
+		Order("day, q_type").Find(&out).Error
+	return out, err
+}
+
+// PurgeDailyQueryStats deletes daily counters older than before.
+func PurgeDailyQueryStats(db *gorm.DB, before time.Time) (int64, error) {
+	res := db.Where("day < ?", before.UTC()).Delete(&DailyQueryStat{})
+	return res.RowsAffected, res.Error
+}
+
+// backfillDailyQueryStats sums the hourly counters into daily ones, for
+// databases created before the daily counters existed.
+func backfillDailyQueryStats(db *gorm.DB) error {
+	var first QueryStat
+	if err := db.Order("hour").Limit(1).Find(&first).Error; err != nil || first.ID == 0 {
+		return err
+	}
+	now := time.Now().UTC()
+	for day := first.Hour.UTC().Truncate(24 * time.Hour); day.Before(now); day = day.Add(24 * time.Hour) {
+		sums, err := QueryStats(db, QueryStatsFilter{From: day, To: day.Add(24 * time.Hour)})
+		if err != nil {
+			return err
+		}
+		rows := make([]DailyQueryStat, 0, len(sums))
+		for _, q := range sums {
+			rows = append(rows, DailyQueryStat{Zone: q.Zone, QType: q.QType, Day: day, Queries: q.Queries})
+		}
+		if len(rows) > 0 {
+			if err := db.CreateInBatches(rows, 500).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
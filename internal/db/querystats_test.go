@@ -0,0 +1,38 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackfillDailyQueryStats(t *testing.T) {
+	db := newIsolatedDB(t)
+	day := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -2)
+	for _, h := range []time.Time{day.Add(time.Hour), day.Add(5 * time.Hour), day.Add(25 * time.Hour)} {
+		if err := db.Create(&QueryStat{Zone: "example.com.", QType: "A", Hour: h, Queries: 4}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := backfillDailyQueryStats(db); err != nil {
+		t.Fatalf("backfill: %v", err)
+	}
+	got, err := DailyQueryStats(db, "example.com.", day, day.AddDate(0, 0, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Queries != 8 || !got[0].Day.Equal(day) || got[1].Queries != 4 {
+		t.Fatalf("daily rows: %+v", got)
+	}
+
+	// New counters go to both tables
+	if err := AddQueryCounts(db, day.Add(26*time.Hour), []QueryCount{{Zone: "example.com.", QType: "A", Queries: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = DailyQueryStats(db, "example.com.", day.Add(24*time.Hour), day.AddDate(0, 0, 2))
+	if len(got) != 1 || got[0].Queries != 5 {
+		t.Fatalf("after add: %+v", got)
+	}
+	if n, err := PurgeDailyQueryStats(db, day.Add(time.Hour)); err != nil || n != 1 {
+		t.Fatalf("purge: %d %v", n, err)
+	}
+}
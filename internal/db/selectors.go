@@ -0,0 +1,39 @@
+package db
+
+import (
+	"fmt"
+
+	"namedot/internal/geoip"
+)
+
+// CheckRecordSelectors returns an error when a geo selector or the health
+// check of one of the records of set is invalid: an unknown country or
+// continent code, a bad ASN list, or a check that cannot be run. The
+// dynamic URL of the set is checked too.
+func CheckRecordSelectors(set RRSet) error {
+	if err := CheckDynamicURL(set); err != nil {
+		return fmt.Errorf("%s %s: %w", set.Name, set.Type, err)
+	}
+	for _, r := range set.Records {
+		var err error
+		if r.Country != nil && *r.Country != "" {
+			err = geoip.CheckCountry(*r.Country)
+		}
+		if err == nil && r.Continent != nil && *r.Continent != "" {
+			err = geoip.CheckContinent(*r.Continent)
+		}
+		if err == nil && r.ASNs != nil {
+			_, err = NormalizeASNs(*r.ASNs)
+		}
+		if err == nil && r.HealthCheck != nil {
+			var hc HealthCheck
+			if hc, err = ParseHealthCheck(*r.HealthCheck); err == nil {
+				_, err = hc.Target(set.Type, r.Data)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s %s %s: %w", set.Name, set.Type, r.Data, err)
+		}
+	}
+	return nil
+}
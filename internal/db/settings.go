@@ -0,0 +1,63 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"namedot/internal/config"
+)
+
+// Setting is one runtime setting override, its value JSON encoded. Keys are
+// the JSON names of config.Overrides.
+type Setting struct {
+	Key       string    `gorm:"primaryKey;size:64" json:"key"`
+	Value     string    `gorm:"type:text" json:"value"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// LoadOverrides reads the runtime settings; unknown keys are ignored.
+func LoadOverrides(db *gorm.DB) (config.Overrides, error) {
+	var o config.Overrides
+	var rows []Setting
+	if err := db.Find(&rows).Error; err != nil {
+		return o, err
+	}
+	m := make(map[string]json.RawMessage, len(rows))
+	for _, r := range rows {
+		m[r.Key] = json.RawMessage(r.Value)
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return o, err
+	}
+	if err := json.Unmarshal(b, &o); err != nil {
+		return o, fmt.Errorf("settings: %w", err)
+	}
+	return o, nil
+}
+
+// SaveOverrides replaces the runtime settings with o.
+func SaveOverrides(db *gorm.DB, o config.Overrides) error {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&Setting{}).Error; err != nil {
+			return err
+		}
+		for k, v := range m {
+			if err := tx.Create(&Setting{Key: k, Value: string(v)}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
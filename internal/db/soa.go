@@ -1,13 +1,152 @@
 package db
 
 import (
+	"errors"
+	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/miekg/dns"
 	"gorm.io/gorm"
+
+	"namedot/internal/config"
+)
+
+// Defaults for SOA records created automatically or reset from config.
+const (
+	DefaultSOATTL     = 3600
+	DefaultSOARefresh = 7200
+	DefaultSOARetry   = 3600
+	DefaultSOAExpire  = 1209600
+	DefaultSOAMinimum = 300
+)
+
+var (
+	// ErrNoSOA is returned by GetSOA when the zone has no SOA record.
+	ErrNoSOA = errors.New("zone has no SOA record")
+	// ErrInvalidSOA wraps validation errors of SetSOA.
+	ErrInvalidSOA = errors.New("invalid SOA")
 )
 
+// SOA is a zone's SOA record split into its fields.
+type SOA struct {
+	Primary    string `json:"primary"`
+	Hostmaster string `json:"hostmaster"`
+	Serial     uint32 `json:"serial"`
+	Refresh    uint32 `json:"refresh"`
+	Retry      uint32 `json:"retry"`
+	Expire     uint32 `json:"expire"`
+	Minimum    uint32 `json:"minimum"`
+	TTL        uint32 `json:"ttl"`
+}
+
+// ParseSOA parses SOA record data ("mname rname serial refresh retry expire minimum").
+func ParseSOA(data string) (SOA, error) {
+	parts := strings.Fields(data)
+	if len(parts) != 7 {
+		return SOA{}, fmt.Errorf("SOA data needs 7 fields, got %d", len(parts))
+	}
+	soa := SOA{Primary: parts[0], Hostmaster: parts[1]}
+	for i, dst := range []*uint32{&soa.Serial, &soa.Refresh, &soa.Retry, &soa.Expire, &soa.Minimum} {
+		n, err := strconv.ParseUint(parts[i+2], 10, 32)
+		if err != nil {
+			return SOA{}, fmt.Errorf("invalid SOA field %q", parts[i+2])
+		}
+		*dst = uint32(n)
+	}
+	return soa, nil
+}
+
+// Data formats the SOA as record data.
+func (s SOA) Data() string {
+	return fmt.Sprintf("%s %s %d %d %d %d %d", s.Primary, s.Hostmaster, s.Serial, s.Refresh, s.Retry, s.Expire, s.Minimum)
+}
+
+// DefaultSOA returns the SOA a zone gets from config. primary/hostmaster may
+// contain {zone} and default to ns1.{zone} and hostmaster.{zone}.
+func DefaultSOA(zoneName, primary, hostmaster string) SOA {
+	return SOA{
+		Primary:    resolveSOAName(primary, zoneName, "ns1.{zone}"),
+		Hostmaster: resolveSOAName(hostmaster, zoneName, "hostmaster.{zone}"),
+		Refresh:    DefaultSOARefresh,
+		Retry:      DefaultSOARetry,
+		Expire:     DefaultSOAExpire,
+		Minimum:    DefaultSOAMinimum,
+		TTL:        DefaultSOATTL,
+	}
+}
+
+// GetSOA returns the SOA of a zone, or ErrNoSOA.
+func GetSOA(db *gorm.DB, zoneID uint) (SOA, error) {
+	var rs RRSet
+	if err := db.Preload("Records").Where("zone_id = ? AND type = ?", zoneID, "SOA").Limit(1).Find(&rs).Error; err != nil {
+		return SOA{}, err
+	}
+	if rs.ID == 0 || len(rs.Records) == 0 {
+		return SOA{}, ErrNoSOA
+	}
+	soa, err := ParseSOA(rs.Records[0].Data)
+	if err != nil {
+		return SOA{}, err
+	}
+	soa.TTL = rs.TTL
+	return soa, nil
+}
+
+// SetSOA validates and stores the SOA of a zone, creating it if missing.
+// Names are resolved like the config values ({zone}, relative names get a
+// trailing dot). The serial is not taken from soa: it is incremented from the
+// stored one (or set to the current time for a new SOA).
+func SetSOA(db *gorm.DB, zone Zone, soa SOA) (SOA, error) {
+	zname := strings.TrimSuffix(strings.ToLower(zone.Name), ".")
+	if strings.TrimSpace(soa.Primary) == "" || strings.TrimSpace(soa.Hostmaster) == "" {
+		return SOA{}, fmt.Errorf("%w: primary and hostmaster are required", ErrInvalidSOA)
+	}
+	soa.Primary = resolveSOAName(soa.Primary, zname, "")
+	soa.Hostmaster = resolveSOAName(soa.Hostmaster, zname, "")
+	for _, n := range []string{soa.Primary, soa.Hostmaster} {
+		if _, ok := dns.IsDomainName(n); !ok {
+			return SOA{}, fmt.Errorf("%w: invalid name %q", ErrInvalidSOA, n)
+		}
+	}
+	if soa.Refresh == 0 || soa.Retry == 0 || soa.Expire == 0 || soa.Minimum == 0 || soa.TTL == 0 {
+		return SOA{}, fmt.Errorf("%w: refresh, retry, expire, minimum and TTL must be positive", ErrInvalidSOA)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var rs RRSet
+		if err := tx.Preload("Records").Where("zone_id = ? AND type = ?", zone.ID, "SOA").Limit(1).Find(&rs).Error; err != nil {
+			return err
+		}
+		soa.Serial = uint32(time.Now().Unix())
+		if len(rs.Records) > 0 {
+			if old, err := ParseSOA(rs.Records[0].Data); err == nil {
+				soa.Serial = old.Serial + 1
+			}
+		}
+		if rs.ID == 0 {
+			rs = RRSet{ZoneID: zone.ID, Name: zname + ".", Type: "SOA", TTL: soa.TTL, Records: []RData{{Data: soa.Data()}}}
+			return tx.Create(&rs).Error
+		}
+		if err := tx.Model(&RRSet{}).Where("id = ?", rs.ID).Update("ttl", soa.TTL).Error; err != nil {
+			return err
+		}
+		if len(rs.Records) == 0 {
+			return tx.Create(&RData{RRSetID: rs.ID, Data: soa.Data()}).Error
+		}
+		return tx.Model(&RData{}).Where("id = ?", rs.Records[0].ID).Updates(map[string]interface{}{
+			"data":       soa.Data(),
+			"dedupe_key": RData{Data: soa.Data()}.Identity(),
+		}).Error
+	})
+	if err != nil {
+		return SOA{}, err
+	}
+	setZoneSerial(db, zone.ID, soa.Data())
+	return soa, nil
+}
+
 // BumpSOASerial finds SOA for zone and increments its serial.
 // Uses a non-erroring Find to avoid noisy "record not found" logs.
 func BumpSOASerial(db *gorm.DB, zoneID uint) {
@@ -30,7 +169,8 @@ func BumpSOASerial(db *gorm.DB, zoneID uint) {
 		parts[2] = strconv.FormatInt(time.Now().Unix(), 10)
 	}
 	newData := strings.Join(parts, " ")
-	_ = db.Model(&RData{}).Where("id = ?", soa.Records[0].ID).Update("data", newData).Error
+	setRecordData(db, soa.Records[0].ID, newData)
+	setZoneSerial(db, soa.ZoneID, newData)
 }
 
 func resolveSOAName(input, zone, fallback string) string {
@@ -61,25 +201,24 @@ func BumpSOASerialAuto(db *gorm.DB, zone Zone, auto bool, primary, hostmaster st
 			return
 		}
 		origin := zname + "."
-		primary = resolveSOAName(primary, zname, "ns1.{zone}")
-		hostmaster = resolveSOAName(hostmaster, zname, "hostmaster.{zone}")
-		serial := strconv.FormatInt(time.Now().Unix(), 10)
-		// Defaults: refresh 7200, retry 3600, expire 1209600, minimum 300, TTL 3600
-		data := strings.Join([]string{primary, hostmaster, serial, "7200", "3600", "1209600", "300"}, " ")
+		def := DefaultSOA(zname, primary, hostmaster)
+		def.Serial = uint32(time.Now().Unix())
+		data := def.Data()
 		if soa.ID == 0 {
-			rs := RRSet{ZoneID: zone.ID, Name: origin, Type: "SOA", TTL: 3600,
+			rs := RRSet{ZoneID: zone.ID, Name: origin, Type: "SOA", TTL: DefaultSOATTL,
 				Records: []RData{{Data: data}}}
 			_ = db.Create(&rs).Error
 		} else {
 			// RRSet exists but has no records; populate it with defaults.
 			if soa.TTL == 0 {
-				soa.TTL = 3600
+				soa.TTL = DefaultSOATTL
 			}
 			_ = db.Model(&RRSet{}).Where("id = ?", soa.ID).Update("ttl", soa.TTL).Error
 			_ = db.Unscoped().Where("rr_set_id = ?", soa.ID).Delete(&RData{}).Error
 			r := RData{RRSetID: soa.ID, Data: data}
 			_ = db.Create(&r).Error
 		}
+		setZoneSerial(db, zone.ID, data)
 		return
 	}
 	// bump existing
@@ -100,5 +239,104 @@ func BumpSOASerialAuto(db *gorm.DB, zone Zone, auto bool, primary, hostmaster st
 		parts[2] = strconv.FormatInt(time.Now().Unix(), 10)
 	}
 	newData := strings.Join(parts, " ")
-	_ = db.Model(&RData{}).Where("id = ?", soa.Records[0].ID).Update("data", newData).Error
+	setRecordData(db, soa.Records[0].ID, newData)
+	setZoneSerial(db, soa.ZoneID, newData)
+}
+
+// EnsureNS creates apex NS records for zone when it has none. names may
+// contain {zone}; relative names get a trailing dot. It reports whether
+// records were created.
+func EnsureNS(db *gorm.DB, zone Zone, names []string, ttl uint32) (bool, error) {
+	zname := strings.TrimSuffix(strings.ToLower(zone.Name), ".")
+	var existing RRSet
+	if err := db.Preload("Records").Where("zone_id = ? AND type = ? AND name = ?", zone.ID, "NS", zname+".").Limit(1).Find(&existing).Error; err != nil {
+		return false, err
+	}
+	if existing.ID != 0 && len(existing.Records) > 0 {
+		return false, nil
+	}
+	var recs []RData
+	seen := map[string]bool{}
+	for _, n := range names {
+		n = resolveSOAName(n, zname, "")
+		if _, ok := dns.IsDomainName(n); !ok || n == "." {
+			return false, fmt.Errorf("invalid name server name %q", n)
+		}
+		if !seen[n] {
+			seen[n] = true
+			recs = append(recs, RData{Data: n})
+		}
+	}
+	if len(recs) == 0 {
+		return false, nil
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if existing.ID == 0 {
+			return tx.Create(&RRSet{ZoneID: zone.ID, Name: zname + ".", Type: "NS", TTL: ttl, Records: recs}).Error
+		}
+		for i := range recs {
+			recs[i].RRSetID = existing.ID
+		}
+		return tx.Create(&recs).Error
+	})
+	return err == nil, err
+}
+
+// TouchZone runs after a zone changed: it creates the apex NS records
+// (ns.auto_on_missing) and the SOA (soa.auto_on_missing) the zone lacks and
+// bumps the SOA serial.
+func TouchZone(db *gorm.DB, zone Zone, cfg *config.Config) {
+	if cfg.NS.AutoOnMissing {
+		names := cfg.NS.Servers
+		if len(names) == 0 {
+			names = []string{resolveSOAName(cfg.SOA.Primary, zone.Name, "ns1.{zone}")}
+		}
+		_, _ = EnsureNS(db, zone, names, cfg.NS.TTL)
+	}
+	BumpSOASerialAuto(db, zone, cfg.SOA.AutoOnMissing, cfg.SOA.Primary, cfg.SOA.Hostmaster)
+}
+
+// setRecordData rewrites a record's data together with its dedupe key.
+func setRecordData(db *gorm.DB, id uint, data string) {
+	_ = db.Model(&RData{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"data":       data,
+		"dedupe_key": RData{Data: data}.Identity(),
+	}).Error
+}
+
+// SyncZoneSerial copies the serial of the zone's SOA record into Zone.Serial.
+// Call it after writing SOA data directly (imports, replication).
+func SyncZoneSerial(db *gorm.DB, zoneID uint) {
+	var soa RRSet
+	if err := db.Preload("Records").Where("zone_id = ? AND type = ?", zoneID, "SOA").Limit(1).Find(&soa).Error; err != nil {
+		return
+	}
+	if soa.ID == 0 || len(soa.Records) == 0 {
+		return
+	}
+	setZoneSerial(db, zoneID, soa.Records[0].Data)
+}
+
+func setZoneSerial(db *gorm.DB, zoneID uint, soaData string) {
+	parts := strings.Fields(soaData)
+	if len(parts) < 7 {
+		return
+	}
+	serial, err := strconv.ParseUint(parts[2], 10, 32)
+	if err != nil {
+		return
+	}
+	_ = db.Model(&Zone{}).Where("id = ?", zoneID).UpdateColumn("serial", uint32(serial)).Error
+}
+
+// backfillZoneSerials fills Zone.Serial for zones created before the column existed.
+func backfillZoneSerials(db *gorm.DB) error {
+	var ids []uint
+	if err := db.Model(&Zone{}).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	for _, id := range ids {
+		SyncZoneSerial(db, id)
+	}
+	return nil
 }
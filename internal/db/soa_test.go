@@ -7,6 +7,8 @@ import (
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+
+	"namedot/internal/config"
 )
 
 func newMemDB(t *testing.T) *gorm.DB {
@@ -82,3 +84,137 @@ func TestBumpSOASerialAuto_CreatesDefaultSOA(t *testing.T) {
 		t.Fatalf("serial did not increase: %d -> %d", n1, n2)
 	}
 }
+
+func TestZoneSerial_TracksSOA(t *testing.T) {
+	db := newIsolatedDB(t)
+	z := Zone{Name: "serial.example."}
+	if err := db.Create(&z).Error; err != nil {
+		t.Fatalf("create zone: %v", err)
+	}
+	BumpSOASerialAuto(db, z, true, "", "")
+
+	var got Zone
+	db.First(&got, z.ID)
+	if got.Serial == 0 {
+		t.Fatal("expected serial to be set when SOA is created")
+	}
+	created := got.Serial
+
+	BumpSOASerial(db, z.ID)
+	db.First(&got, z.ID)
+	if got.Serial != created+1 {
+		t.Fatalf("expected serial %d after bump, got %d", created+1, got.Serial)
+	}
+
+	// Direct SOA writes are picked up by SyncZoneSerial
+	db.Model(&RData{}).Where("rr_set_id IN (?)", db.Model(&RRSet{}).Select("id").Where("zone_id = ? AND type = ?", z.ID, "SOA")).
+		Update("data", "ns1.serial.example. hostmaster.serial.example. 2024010101 7200 3600 1209600 300")
+	SyncZoneSerial(db, z.ID)
+	db.First(&got, z.ID)
+	if got.Serial != 2024010101 {
+		t.Fatalf("expected synced serial 2024010101, got %d", got.Serial)
+	}
+}
+
+func TestSetSOA(t *testing.T) {
+	db := newIsolatedDB(t)
+	z := Zone{Name: "soa-edit.example."}
+	if err := db.Create(&z).Error; err != nil {
+		t.Fatalf("create zone: %v", err)
+	}
+	if _, err := GetSOA(db, z.ID); err != ErrNoSOA {
+		t.Fatalf("expected ErrNoSOA, got %v", err)
+	}
+
+	in := SOA{Primary: "ns.{zone}", Hostmaster: "admin.{zone}", Refresh: 3600, Retry: 600, Expire: 86400, Minimum: 60, TTL: 1800}
+	created, err := SetSOA(db, z, in)
+	if err != nil {
+		t.Fatalf("SetSOA: %v", err)
+	}
+	got, err := GetSOA(db, z.ID)
+	if err != nil {
+		t.Fatalf("GetSOA: %v", err)
+	}
+	if got != created || got.Primary != "ns.soa-edit.example." || got.Hostmaster != "admin.soa-edit.example." || got.TTL != 1800 || got.Minimum != 60 {
+		t.Fatalf("unexpected SOA: %+v", got)
+	}
+
+	in.Refresh = 7200
+	in.Serial = 1 // ignored, the stored serial is incremented
+	updated, err := SetSOA(db, z, in)
+	if err != nil {
+		t.Fatalf("SetSOA update: %v", err)
+	}
+	if updated.Serial != created.Serial+1 || updated.Refresh != 7200 {
+		t.Fatalf("unexpected update: %+v (was %+v)", updated, created)
+	}
+	var zone Zone
+	db.First(&zone, z.ID)
+	if zone.Serial != updated.Serial {
+		t.Fatalf("zone serial %d, want %d", zone.Serial, updated.Serial)
+	}
+	var sets int64
+	db.Model(&RRSet{}).Where("zone_id = ? AND type = ?", z.ID, "SOA").Count(&sets)
+	if sets != 1 {
+		t.Fatalf("expected one SOA RRSet, got %d", sets)
+	}
+
+	for _, bad := range []SOA{
+		{Hostmaster: "admin.{zone}", Refresh: 1, Retry: 1, Expire: 1, Minimum: 1, TTL: 1},
+		{Primary: "ns..bad", Hostmaster: "admin.{zone}", Refresh: 1, Retry: 1, Expire: 1, Minimum: 1, TTL: 1},
+		{Primary: "ns.{zone}", Hostmaster: "admin.{zone}", Refresh: 1, Retry: 1, Expire: 1, TTL: 1},
+	} {
+		if _, err := SetSOA(db, z, bad); err == nil {
+			t.Fatalf("expected error for %+v", bad)
+		}
+	}
+}
+
+func TestDefaultSOA(t *testing.T) {
+	d := DefaultSOA("example.com", "", "dns-admin.{zone}")
+	if d.Primary != "ns1.example.com." || d.Hostmaster != "dns-admin.example.com." || d.Refresh != DefaultSOARefresh || d.TTL != DefaultSOATTL {
+		t.Fatalf("unexpected default SOA: %+v", d)
+	}
+	p, err := ParseSOA(d.Data())
+	if err != nil || p.Primary != d.Primary || p.Minimum != d.Minimum {
+		t.Fatalf("round trip: %+v %v", p, err)
+	}
+}
+
+func TestTouchZone_CreatesNS(t *testing.T) {
+	db := newMemDB(t)
+	z := Zone{Name: "ns-auto.example"}
+	if err := db.Create(&z).Error; err != nil {
+		t.Fatalf("create zone: %v", err)
+	}
+	cfg := &config.Config{
+		SOA: config.SOAConfig{AutoOnMissing: true},
+		NS:  config.NSConfig{AutoOnMissing: true, Servers: []string{"ns1.{zone}", "ns.provider.net", "ns1.{zone}."}, TTL: 7200},
+	}
+	TouchZone(db, z, cfg)
+
+	var ns RRSet
+	if err := db.Preload("Records").Where("zone_id = ? AND type = ?", z.ID, "NS").First(&ns).Error; err != nil {
+		t.Fatalf("NS not created: %v", err)
+	}
+	if ns.Name != "ns-auto.example." || ns.TTL != 7200 || len(ns.Records) != 2 ||
+		ns.Records[0].Data != "ns1.ns-auto.example." || ns.Records[1].Data != "ns.provider.net." {
+		t.Fatalf("unexpected NS RRSet: %+v", ns)
+	}
+	soa, err := GetSOA(db, z.ID)
+	if err != nil {
+		t.Fatalf("SOA not created: %v", err)
+	}
+
+	// Existing NS records are left alone; only the serial moves
+	cfg.NS.Servers = []string{"other.example."}
+	TouchZone(db, z, cfg)
+	var n int64
+	db.Model(&RData{}).Where("rr_set_id = ?", ns.ID).Count(&n)
+	if n != 2 {
+		t.Fatalf("NS records changed: %d", n)
+	}
+	if after, _ := GetSOA(db, z.ID); after.Serial != soa.Serial+1 {
+		t.Fatalf("serial %d, want %d", after.Serial, soa.Serial+1)
+	}
+}
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// Record sources. The others are built by the Source* functions; changes
+// made with the REST API have the audit actor as their source ("api",
+// "api:<token name>").
+const (
+	SourceReplication = "replication" // synced from the master without a source of its own
+	SourceDHCP        = "dhcp"
+)
+
+// SourceWeb is the source of records changed by an admin panel user.
+func SourceWeb(user string) string { return "web:" + user }
+
+// SourceTemplate is the source of records added by applying a template.
+func SourceTemplate(name string) string { return "template:" + name }
+
+// SourceImport is the source of records from an imported zone file, named
+// after the file or, for pasted or API imports, after who imported it.
+func SourceImport(file string) string { return "import:" + file }
+
+// SourceZoneDir is the source of records read from a zone_dir file.
+func SourceZoneDir(file string) string { return "zone_dir:" + file }
+
+// SourceDiscovery is the source of records published by service discovery.
+func SourceDiscovery(provider string) string { return "discovery:" + provider }
+
+type sourceKey struct{}
+
+// WithSource returns db with source stamped on the RRSets and records it
+// creates or saves, replacing the source they had. Column updates
+// (Model(...).Update) leave the source alone.
+func WithSource(db *gorm.DB, source string) *gorm.DB {
+	return db.WithContext(context.WithValue(db.Statement.Context, sourceKey{}, source))
+}
+
+// maxSourceLen is the size of the source columns.
+const maxSourceLen = 128
+
+// stampSource sets *dst to the source of tx, if it has one.
+func stampSource(tx *gorm.DB, dst *string) {
+	if src, _ := tx.Statement.Context.Value(sourceKey{}).(string); src != "" {
+		if len(src) > maxSourceLen {
+			src = src[:maxSourceLen]
+		}
+		*dst = src
+	}
+}
+
+// BeforeSave stamps the source of the change.
+func (s *RRSet) BeforeSave(tx *gorm.DB) error {
+	stampSource(tx, &s.Source)
+	return nil
+}
@@ -0,0 +1,56 @@
+package db
+
+import "testing"
+
+func TestWithSource_StampsRRSetsAndRecords(t *testing.T) {
+	db := newIsolatedDB(t)
+	z := Zone{Name: "src.example.", RRSets: []RRSet{{Name: "www.src.example.", Type: "A", TTL: 300, Records: []RData{{Data: "192.0.2.1"}}}}}
+	if err := WithSource(db, SourceWeb("alice")).Create(&z).Error; err != nil {
+		t.Fatalf("create zone: %v", err)
+	}
+	var set RRSet
+	if err := db.Preload("Records").First(&set, z.RRSets[0].ID).Error; err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if set.Source != "web:alice" || set.Records[0].Source != "web:alice" {
+		t.Fatalf("sources %q/%q, want web:alice", set.Source, set.Records[0].Source)
+	}
+
+	// A save through another source takes over the set
+	set.TTL = 600
+	if err := WithSource(db, "api").Save(&set).Error; err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	// Without a source, the last one is kept
+	if err := db.Model(&RData{}).Where("id = ?", set.Records[0].ID).Update("data", "192.0.2.2").Error; err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := db.Save(&set).Error; err != nil {
+		t.Fatalf("save without source: %v", err)
+	}
+	if err := db.Preload("Records").First(&set, set.ID).Error; err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if set.Source != "api" || set.Records[0].Source != "web:alice" {
+		t.Fatalf("sources %q/%q, want api/web:alice", set.Source, set.Records[0].Source)
+	}
+}
+
+func TestApplyTemplate_StampsTemplateSource(t *testing.T) {
+	db := newIsolatedDB(t)
+	zone := createZoneWithSets(t, db, "tplsrc.example.")
+	tpl := Template{Name: "mail", Version: 1, Records: []TemplateRecord{{Name: "@", Type: "MX", TTL: 300, Data: "10 mail.{domain}."}}}
+	if err := db.Create(&tpl).Error; err != nil {
+		t.Fatalf("create template: %v", err)
+	}
+	if _, err := ApplyTemplate(db, tpl, zone); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	var set RRSet
+	if err := db.Preload("Records").Where("zone_id = ? AND type = ?", zone.ID, "MX").First(&set).Error; err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if set.Source != "template:mail" || len(set.Records) != 1 || set.Records[0].Source != "template:mail" {
+		t.Fatalf("source %q, records %+v", set.Source, set.Records)
+	}
+}
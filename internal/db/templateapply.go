@@ -0,0 +1,244 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TemplateApplication remembers that a template was applied to a zone, at
+// which version and which records it added, so a later version can be rolled
+// out and the records it no longer has removed.
+type TemplateApplication struct {
+	ID         uint            `gorm:"primaryKey" json:"id"`
+	TemplateID uint            `gorm:"uniqueIndex:idx_template_zone;not null" json:"template_id"`
+	ZoneID     uint            `gorm:"uniqueIndex:idx_template_zone;not null" json:"zone_id"`
+	Version    uint            `json:"version"`
+	Records    []AppliedRecord `gorm:"serializer:json;type:text" json:"records"`
+	AppliedAt  time.Time       `json:"applied_at"`
+}
+
+// AppliedRecord is a template record with its placeholders filled in for a
+// zone.
+type AppliedRecord struct {
+	Name      string  `json:"name"`
+	Type      string  `json:"type"`
+	TTL       uint32  `json:"ttl"`
+	Data      string  `json:"data"`
+	Country   *string `json:"country,omitempty"`
+	Continent *string `json:"continent,omitempty"`
+	ASN       *int    `json:"asn,omitempty"`
+	ASNs      *string `json:"asns,omitempty"`
+	Subnet    *string `json:"subnet,omitempty"`
+}
+
+func (r AppliedRecord) rdata(rrsetID uint) RData {
+	return RData{RRSetID: rrsetID, Data: r.Data, Country: r.Country, Continent: r.Continent, ASN: r.ASN, ASNs: r.ASNs, Subnet: r.Subnet}
+}
+
+func (r AppliedRecord) key() string {
+	return r.Name + " " + r.Type + " " + r.rdata(0).Identity()
+}
+
+// Template change operations.
+const (
+	TemplateAdd    = "add"    // the zone lacks the record
+	TemplateRemove = "remove" // an earlier version added the record, the current one lacks it
+	TemplateKeep   = "keep"   // the zone already has the record
+)
+
+// TemplateChange is what applying a template does to one record.
+type TemplateChange struct {
+	Op string `json:"op"`
+	AppliedRecord
+}
+
+// RenderTemplate fills in the {domain} placeholder of t's records for zone.
+// A name of "@" or "{domain}" is the zone apex.
+func RenderTemplate(t Template, zone Zone) []AppliedRecord {
+	domain := strings.TrimSuffix(zone.Name, ".")
+	out := make([]AppliedRecord, 0, len(t.Records))
+	for _, rec := range t.Records {
+		name := strings.ToLower(strings.TrimSpace(strings.ReplaceAll(rec.Name, "{domain}", domain)))
+		if name == "@" {
+			name = zone.Name
+		}
+		if !strings.HasSuffix(name, ".") {
+			name += "."
+		}
+		out = append(out, AppliedRecord{
+			Name:      name,
+			Type:      strings.ToUpper(rec.Type),
+			TTL:       rec.TTL,
+			Data:      strings.ReplaceAll(rec.Data, "{domain}", domain),
+			Country:   rec.Country,
+			Continent: rec.Continent,
+			ASN:       rec.ASN,
+			ASNs:      rec.ASNs,
+			Subnet:    rec.Subnet,
+		})
+	}
+	return out
+}
+
+// GetTemplateApplication returns the last application of a template to a
+// zone, or nil when it was never applied.
+func GetTemplateApplication(db *gorm.DB, templateID, zoneID uint) (*TemplateApplication, error) {
+	var a TemplateApplication
+	if err := db.Where("template_id = ? AND zone_id = ?", templateID, zoneID).Limit(1).Find(&a).Error; err != nil {
+		return nil, err
+	}
+	if a.ID == 0 {
+		return nil, nil
+	}
+	return &a, nil
+}
+
+// TemplateZone is a zone a template was applied to.
+type TemplateZone struct {
+	ZoneID    uint      `json:"zone_id"`
+	ZoneName  string    `json:"zone_name"`
+	Version   uint      `json:"version"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// TemplateZones lists the live zones a template was applied to, by name.
+func TemplateZones(db *gorm.DB, templateID uint) ([]TemplateZone, error) {
+	var out []TemplateZone
+	err := db.Model(&TemplateApplication{}).
+		Select("template_applications.zone_id, zones.name AS zone_name, template_applications.version, template_applications.applied_at").
+		Joins("JOIN zones ON zones.id = template_applications.zone_id AND zones.deleted_at IS NULL").
+		Where("template_applications.template_id = ?", templateID).
+		Order("zones.name").
+		Scan(&out).Error
+	return out, err
+}
+
+// PlanTemplate returns what applying t to zone would change: records to
+// add, records of earlier versions to remove, and records already present.
+func PlanTemplate(db *gorm.DB, t Template, zone Zone) ([]TemplateChange, error) {
+	prev, err := GetTemplateApplication(db, t.ID, zone.ID)
+	if err != nil {
+		return nil, err
+	}
+	current := RenderTemplate(t, zone)
+	inCurrent := make(map[string]bool, len(current))
+	var out []TemplateChange
+	for _, r := range current {
+		inCurrent[r.key()] = true
+		has, err := zoneHasRecord(db, zone.ID, r)
+		if err != nil {
+			return nil, err
+		}
+		op := TemplateAdd
+		if has {
+			op = TemplateKeep
+		}
+		out = append(out, TemplateChange{Op: op, AppliedRecord: r})
+	}
+	if prev != nil {
+		for _, r := range prev.Records {
+			if inCurrent[r.key()] {
+				continue
+			}
+			if has, err := zoneHasRecord(db, zone.ID, r); err != nil {
+				return nil, err
+			} else if has {
+				out = append(out, TemplateChange{Op: TemplateRemove, AppliedRecord: r})
+			}
+		}
+	}
+	return out, nil
+}
+
+func zoneHasRecord(db *gorm.DB, zoneID uint, r AppliedRecord) (bool, error) {
+	var n int64
+	err := db.Model(&RData{}).
+		Joins("JOIN rr_sets ON rr_sets.id = r_data.rr_set_id AND rr_sets.deleted_at IS NULL").
+		Where("rr_sets.zone_id = ? AND rr_sets.name = ? AND rr_sets.type = ? AND r_data.dedupe_key = ?", zoneID, r.Name, r.Type, r.rdata(0).Identity()).
+		Count(&n).Error
+	return n > 0, err
+}
+
+// ApplyTemplate brings zone in line with the current version of t: missing
+// records are added, with the template as their source, records an earlier
+// version added and the current one lacks are removed (RRSets left empty go
+// with them), and the application is remembered. It returns the changes
+// made, keeps included.
+func ApplyTemplate(db *gorm.DB, t Template, zone Zone) ([]TemplateChange, error) {
+	var changes []TemplateChange
+	err := WithSource(db, SourceTemplate(t.Name)).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if changes, err = PlanTemplate(tx, t, zone); err != nil {
+			return err
+		}
+		for _, c := range changes {
+			switch c.Op {
+			case TemplateAdd:
+				var set RRSet
+				if err := tx.Where("zone_id = ? AND name = ? AND type = ?", zone.ID, c.Name, c.Type).Limit(1).Find(&set).Error; err != nil {
+					return err
+				}
+				if set.ID == 0 {
+					set = RRSet{ZoneID: zone.ID, Name: c.Name, Type: c.Type, TTL: c.TTL}
+					if err := tx.Create(&set).Error; err != nil {
+						return fmt.Errorf("%s %s: %w", c.Name, c.Type, err)
+					}
+				}
+				rec := c.rdata(set.ID)
+				if err := tx.Create(&rec).Error; err != nil {
+					return fmt.Errorf("%s %s %s: %w", c.Name, c.Type, c.Data, err)
+				}
+			case TemplateRemove:
+				var set RRSet
+				if err := tx.Where("zone_id = ? AND name = ? AND type = ?", zone.ID, c.Name, c.Type).Limit(1).Find(&set).Error; err != nil {
+					return err
+				}
+				if err := tx.Unscoped().Where("rr_set_id = ? AND dedupe_key = ?", set.ID, c.rdata(0).Identity()).Delete(&RData{}).Error; err != nil {
+					return err
+				}
+				var left int64
+				if err := tx.Model(&RData{}).Where("rr_set_id = ?", set.ID).Count(&left).Error; err != nil {
+					return err
+				}
+				if left == 0 {
+					if err := tx.Unscoped().Delete(&RRSet{}, set.ID).Error; err != nil {
+						return err
+					}
+				}
+			}
+		}
+		prev, err := GetTemplateApplication(tx, t.ID, zone.ID)
+		if err != nil {
+			return err
+		}
+		owned := map[string]bool{}
+		if prev != nil {
+			for _, r := range prev.Records {
+				owned[r.key()] = true
+			}
+		}
+		// Only records the template added are its to remove later; ones the
+		// zone had before stay when a later version drops them
+		records := []AppliedRecord{}
+		for _, c := range changes {
+			if c.Op == TemplateAdd || c.Op == TemplateKeep && owned[c.key()] {
+				records = append(records, c.AppliedRecord)
+			}
+		}
+		app := TemplateApplication{TemplateID: t.ID, ZoneID: zone.ID, Version: t.Version, Records: records, AppliedAt: time.Now().UTC()}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "template_id"}, {Name: "zone_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"version", "records", "applied_at"}),
+		}).Create(&app).Error
+	})
+	return changes, err
+}
+
+// BumpTemplateVersion records a change to template id.
+func BumpTemplateVersion(db *gorm.DB, id uint) error {
+	return db.Model(&Template{}).Where("id = ?", id).UpdateColumn("version", gorm.Expr("version + 1")).Error
+}
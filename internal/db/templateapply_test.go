@@ -0,0 +1,119 @@
+package db
+
+import (
+	"testing"
+)
+
+func TestApplyTemplate_RollsOutNewVersion(t *testing.T) {
+	db := newIsolatedDB(t)
+	zone := createZoneWithSets(t, db, "tpl.example.", "www.tpl.example.")
+	tpl := Template{Name: "mail", Version: 1, Records: []TemplateRecord{
+		{Name: "@", Type: "MX", TTL: 300, Data: "10 mail.{domain}."},
+		{Name: "{domain}", Type: "TXT", TTL: 300, Data: `"v=spf1 mx -all"`},
+	}}
+	if err := db.Create(&tpl).Error; err != nil {
+		t.Fatalf("create template: %v", err)
+	}
+
+	changes, err := ApplyTemplate(db, tpl, zone)
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if len(changes) != 2 || changes[0].Op != TemplateAdd || changes[0].Name != "tpl.example." || changes[0].Data != "10 mail.tpl.example." {
+		t.Fatalf("first apply: %+v", changes)
+	}
+
+	// A new SPF include replaces the old record
+	if err := db.Model(&TemplateRecord{}).Where("template_id = ? AND type = ?", tpl.ID, "TXT").Update("data", `"v=spf1 mx include:_spf.example.net -all"`).Error; err != nil {
+		t.Fatalf("update record: %v", err)
+	}
+	if err := BumpTemplateVersion(db, tpl.ID); err != nil {
+		t.Fatalf("bump: %v", err)
+	}
+	if err := db.Preload("Records").First(&tpl, tpl.ID).Error; err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if tpl.Version != 2 {
+		t.Fatalf("version %d, want 2", tpl.Version)
+	}
+
+	zones, err := TemplateZones(db, tpl.ID)
+	if err != nil || len(zones) != 1 || zones[0].ZoneName != "tpl.example." || zones[0].Version != 1 {
+		t.Fatalf("template zones: %+v, %v", zones, err)
+	}
+
+	plan, err := PlanTemplate(db, tpl, zone)
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	ops := map[string]string{}
+	for _, c := range plan {
+		ops[c.Type+" "+c.Data] = c.Op
+	}
+	want := map[string]string{
+		"MX 10 mail.tpl.example.":                       TemplateKeep,
+		`TXT "v=spf1 mx include:_spf.example.net -all"`: TemplateAdd,
+		`TXT "v=spf1 mx -all"`:                          TemplateRemove,
+	}
+	if len(ops) != len(want) {
+		t.Fatalf("plan: %+v", plan)
+	}
+	for k, op := range want {
+		if ops[k] != op {
+			t.Errorf("%s: op %q, want %q", k, ops[k], op)
+		}
+	}
+
+	if _, err := ApplyTemplate(db, tpl, zone); err != nil {
+		t.Fatalf("re-apply: %v", err)
+	}
+	var txt RRSet
+	if err := db.Preload("Records").Where("zone_id = ? AND type = ?", zone.ID, "TXT").First(&txt).Error; err != nil {
+		t.Fatalf("load TXT: %v", err)
+	}
+	if len(txt.Records) != 1 || txt.Records[0].Data != `"v=spf1 mx include:_spf.example.net -all"` {
+		t.Errorf("TXT after re-apply: %+v", txt.Records)
+	}
+	if zones, _ := TemplateZones(db, tpl.ID); len(zones) != 1 || zones[0].Version != 2 {
+		t.Errorf("application not updated: %+v", zones)
+	}
+
+	// Removing a record the template added drops its RRSet once empty
+	if err := db.Where("template_id = ? AND type = ?", tpl.ID, "MX").Delete(&TemplateRecord{}).Error; err != nil {
+		t.Fatalf("delete record: %v", err)
+	}
+	db.Preload("Records").First(&tpl, tpl.ID)
+	if _, err := ApplyTemplate(db, tpl, zone); err != nil {
+		t.Fatalf("apply without MX: %v", err)
+	}
+	var n int64
+	db.Model(&RRSet{}).Where("zone_id = ? AND type = ?", zone.ID, "MX").Count(&n)
+	if n != 0 {
+		t.Errorf("MX rrset left behind")
+	}
+}
+
+func TestApplyTemplate_KeepsRecordsItDidNotAdd(t *testing.T) {
+	db := newIsolatedDB(t)
+	zone := createZoneWithSets(t, db, "keep.example.", "www.keep.example.")
+	tpl := Template{Name: "web", Version: 1, Records: []TemplateRecord{{Name: "www.{domain}", Type: "A", TTL: 300, Data: "192.0.2.1"}}}
+	if err := db.Create(&tpl).Error; err != nil {
+		t.Fatalf("create template: %v", err)
+	}
+	changes, err := ApplyTemplate(db, tpl, zone)
+	if err != nil || len(changes) != 1 || changes[0].Op != TemplateKeep {
+		t.Fatalf("apply: %+v, %v", changes, err)
+	}
+	// The record was in the zone before the template; a later version
+	// without it must not remove it
+	db.Where("template_id = ?", tpl.ID).Delete(&TemplateRecord{})
+	db.Preload("Records").First(&tpl, tpl.ID)
+	if _, err := ApplyTemplate(db, tpl, zone); err != nil {
+		t.Fatalf("re-apply: %v", err)
+	}
+	var n int64
+	db.Model(&RRSet{}).Where("zone_id = ? AND name = ?", zone.ID, "www.keep.example.").Count(&n)
+	if n != 1 {
+		t.Errorf("pre-existing record removed")
+	}
+}
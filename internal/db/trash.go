@@ -0,0 +1,150 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrZoneNameInTrash is returned when a zone name is still held by a deleted zone.
+var ErrZoneNameInTrash = errors.New("a deleted zone with this name is in the trash; restore or purge it first")
+
+// TrashEntry describes a deleted zone waiting in the trash.
+type TrashEntry struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	DeletedAt time.Time `json:"deleted_at"`
+	RRSets    int64     `json:"rrsets"`
+}
+
+// TrashZone soft-deletes a zone together with its RRSets so it can be restored later.
+// Zone and RRSets share one deletion timestamp, which RestoreZone uses to tell
+// them apart from RRSets that were deleted individually before.
+func TrashZone(db *gorm.DB, zoneID uint) error {
+	now := time.Now()
+	return db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&Zone{}).Where("id = ?", zoneID).Update("deleted_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Model(&RRSet{}).Where("zone_id = ?", zoneID).Update("deleted_at", now).Error
+	})
+}
+
+// ListTrash returns deleted zones, most recently deleted first.
+func ListTrash(db *gorm.DB) ([]TrashEntry, error) {
+	var zones []Zone
+	if err := db.Unscoped().Where("deleted_at IS NOT NULL").Order("deleted_at desc").Find(&zones).Error; err != nil {
+		return nil, err
+	}
+	out := make([]TrashEntry, 0, len(zones))
+	for _, z := range zones {
+		e := TrashEntry{ID: z.ID, Name: z.Name, DeletedAt: z.DeletedAt.Time}
+		if err := db.Unscoped().Model(&RRSet{}).Where("zone_id = ? AND deleted_at >= ?", z.ID, trashCutoff(z)).Count(&e.RRSets).Error; err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// trashCutoff allows for timestamp precision loss in the database round trip.
+func trashCutoff(z Zone) time.Time {
+	return z.DeletedAt.Time.Add(-time.Second)
+}
+
+func findTrashed(db *gorm.DB, zoneID uint) (Zone, error) {
+	var z Zone
+	if err := db.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", zoneID).First(&z).Error; err != nil {
+		return z, err
+	}
+	return z, nil
+}
+
+// RestoreZone brings a zone and the RRSets deleted with it back from the trash.
+func RestoreZone(db *gorm.DB, zoneID uint) (*Zone, error) {
+	z, err := findTrashed(db, zoneID)
+	if err != nil {
+		return nil, err
+	}
+	var active int64
+	if err := db.Model(&Zone{}).Where("name = ?", z.Name).Count(&active).Error; err != nil {
+		return nil, err
+	}
+	if active > 0 {
+		return nil, fmt.Errorf("zone %s already exists", z.Name)
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&RRSet{}).
+			Where("zone_id = ? AND deleted_at >= ?", z.ID, trashCutoff(z)).
+			Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(&Zone{}).Where("id = ?", z.ID).Update("deleted_at", nil).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	z.DeletedAt = gorm.DeletedAt{}
+	return &z, nil
+}
+
+// PurgeZone permanently removes a trashed zone, its RRSets and records.
+func PurgeZone(db *gorm.DB, zoneID uint) error {
+	if _, err := findTrashed(db, zoneID); err != nil {
+		return err
+	}
+	return purgeZone(db, zoneID)
+}
+
+func purgeZone(db *gorm.DB, zoneID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var ids []uint
+		if err := tx.Unscoped().Model(&RRSet{}).Where("zone_id = ?", zoneID).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) > 0 {
+			if err := tx.Unscoped().Where("rr_set_id IN ?", ids).Delete(&RData{}).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Unscoped().Where("zone_id = ?", zoneID).Delete(&RRSet{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("zone_id = ?", zoneID).Delete(&ZoneSettings{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("zone_id = ?", zoneID).Delete(&ZoneCanary{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("id = ?", zoneID).Delete(&Zone{}).Error
+	})
+}
+
+// PurgeExpiredTrash permanently removes zones deleted more than retention ago.
+func PurgeExpiredTrash(db *gorm.DB, retention time.Duration) (int, error) {
+	var ids []uint
+	if err := db.Unscoped().Model(&Zone{}).
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", time.Now().Add(-retention)).
+		Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	for i, id := range ids {
+		if err := purgeZone(db, id); err != nil {
+			return i, err
+		}
+	}
+	return len(ids), nil
+}
+
+// ZoneNameInTrash reports whether name is held by a deleted zone.
+func ZoneNameInTrash(db *gorm.DB, name string) bool {
+	var n int64
+	db.Unscoped().Model(&Zone{}).Where("name = ? AND deleted_at IS NOT NULL", name).Count(&n)
+	return n > 0
+}
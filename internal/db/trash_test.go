@@ -0,0 +1,114 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newIsolatedDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := AutoMigrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+func createZoneWithSets(t *testing.T, db *gorm.DB, name string, sets ...string) Zone {
+	t.Helper()
+	z := Zone{Name: name}
+	for _, n := range sets {
+		z.RRSets = append(z.RRSets, RRSet{Name: n, Type: "A", TTL: 300, Records: []RData{{Data: "192.0.2.1"}}})
+	}
+	if err := db.Create(&z).Error; err != nil {
+		t.Fatalf("create zone: %v", err)
+	}
+	return z
+}
+
+func TestTrashZone_RestoreBringsBackRRSets(t *testing.T) {
+	db := newIsolatedDB(t)
+	z := createZoneWithSets(t, db, "example.com.", "www.example.com.", "old.example.com.")
+
+	// An RRSet deleted before the zone must stay deleted after restore
+	if err := db.Where("zone_id = ? AND name = ?", z.ID, "old.example.com.").Delete(&RRSet{}).Error; err != nil {
+		t.Fatalf("delete rrset: %v", err)
+	}
+	db.Unscoped().Model(&RRSet{}).Where("name = ?", "old.example.com.").Update("deleted_at", time.Now().Add(-time.Hour))
+
+	if err := TrashZone(db, z.ID); err != nil {
+		t.Fatalf("trash: %v", err)
+	}
+	var active int64
+	db.Model(&Zone{}).Count(&active)
+	if active != 0 {
+		t.Fatalf("zone should be hidden after trash")
+	}
+	if !ZoneNameInTrash(db, "example.com.") {
+		t.Fatalf("zone name should be reported as in trash")
+	}
+
+	entries, err := ListTrash(db)
+	if err != nil {
+		t.Fatalf("list trash: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name != "example.com." || entries[0].RRSets != 1 {
+		t.Fatalf("unexpected trash entries: %+v", entries)
+	}
+
+	restored, err := RestoreZone(db, z.ID)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if restored.Name != "example.com." {
+		t.Fatalf("unexpected restored zone: %+v", restored)
+	}
+	var names []string
+	db.Model(&RRSet{}).Where("zone_id = ?", z.ID).Pluck("name", &names)
+	if len(names) != 1 || names[0] != "www.example.com." {
+		t.Fatalf("expected only www to be restored, got %v", names)
+	}
+
+	if _, err := RestoreZone(db, z.ID); err == nil {
+		t.Fatalf("restoring an active zone should fail")
+	}
+}
+
+func TestPurgeExpiredTrash(t *testing.T) {
+	db := newIsolatedDB(t)
+	oldZone := createZoneWithSets(t, db, "old.example.", "www.old.example.")
+	newZone := createZoneWithSets(t, db, "new.example.", "www.new.example.")
+	if err := TrashZone(db, oldZone.ID); err != nil {
+		t.Fatalf("trash: %v", err)
+	}
+	if err := TrashZone(db, newZone.ID); err != nil {
+		t.Fatalf("trash: %v", err)
+	}
+	db.Unscoped().Model(&Zone{}).Where("id = ?", oldZone.ID).Update("deleted_at", time.Now().Add(-48*time.Hour))
+
+	n, err := PurgeExpiredTrash(db, 24*time.Hour)
+	if err != nil || n != 1 {
+		t.Fatalf("purge: n=%d err=%v", n, err)
+	}
+	var zones, rdata int64
+	db.Unscoped().Model(&Zone{}).Count(&zones)
+	db.Unscoped().Model(&RData{}).Count(&rdata)
+	if zones != 1 || rdata != 1 {
+		t.Fatalf("expected only the recent zone to remain, got zones=%d rdata=%d", zones, rdata)
+	}
+
+	if err := PurgeZone(db, newZone.ID); err != nil {
+		t.Fatalf("purge zone: %v", err)
+	}
+	if ZoneNameInTrash(db, "new.example.") {
+		t.Fatalf("purged zone name should be free")
+	}
+}
@@ -0,0 +1,24 @@
+package db
+
+import (
+	"fmt"
+
+	"namedot/internal/config"
+)
+
+// CheckRRSetTTL returns an error when the TTL of set, or the TTL override of
+// one of its records, is outside limits.
+func CheckRRSetTTL(limits config.RecordTTLConfig, set RRSet) error {
+	if err := limits.Check(set.TTL); err != nil {
+		return fmt.Errorf("%s %s: %w", set.Name, set.Type, err)
+	}
+	for _, r := range set.Records {
+		if r.TTL == nil {
+			continue
+		}
+		if err := limits.Check(*r.TTL); err != nil {
+			return fmt.Errorf("%s %s %s: %w", set.Name, set.Type, r.Data, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrZoneLocked is returned for changes to a zone locked for maintenance.
+var ErrZoneLocked = errors.New("zone is locked")
+
+// Locked reports whether the zone is locked for maintenance.
+func (z Zone) Locked() bool {
+	return z.LockedAt != nil
+}
+
+// LockError describes the lock of z, wrapping ErrZoneLocked.
+func (z Zone) LockError() error {
+	if z.LockReason == "" {
+		return fmt.Errorf("%w by %s", ErrZoneLocked, z.LockedBy)
+	}
+	return fmt.Errorf("%w by %s: %s", ErrZoneLocked, z.LockedBy, z.LockReason)
+}
+
+// LockZone locks a zone for holder. A zone locked by another holder is not
+// taken over; the holder may lock again to change the reason.
+func LockZone(db *gorm.DB, zoneID uint, holder, reason string) (Zone, error) {
+	var z Zone
+	if err := db.First(&z, zoneID).Error; err != nil {
+		return z, err
+	}
+	holder = strings.TrimSpace(holder)
+	if z.Locked() && z.LockedBy != holder {
+		return z, z.LockError()
+	}
+	now := time.Now()
+	z.LockedBy, z.LockReason, z.LockedAt = holder, strings.TrimSpace(reason), &now
+	err := db.Model(&Zone{}).Where("id = ?", z.ID).Updates(map[string]interface{}{
+		"locked_by": z.LockedBy, "lock_reason": z.LockReason, "locked_at": now,
+	}).Error
+	return z, err
+}
+
+// UnlockZone removes the lock of a zone, if any.
+func UnlockZone(db *gorm.DB, zoneID uint) (Zone, error) {
+	var z Zone
+	if err := db.First(&z, zoneID).Error; err != nil {
+		return z, err
+	}
+	err := db.Model(&Zone{}).Where("id = ?", z.ID).Updates(map[string]interface{}{
+		"locked_by": "", "lock_reason": "", "locked_at": nil,
+	}).Error
+	return z, err
+}
+
+// CheckZoneUnlocked returns the lock error of a locked zone, and nil for
+// unlocked or missing zones (the caller reports those).
+func CheckZoneUnlocked(db *gorm.DB, zoneID uint) error {
+	var z Zone
+	if err := db.Select("id", "locked_by", "lock_reason", "locked_at").Where("id = ?", zoneID).Limit(1).Find(&z).Error; err != nil {
+		return err
+	}
+	if z.Locked() {
+		return z.LockError()
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ZoneSettings is the transfer policy of a zone. Zones without settings
+// cannot be transferred.
+type ZoneSettings struct {
+	ZoneID        uint      `gorm:"primaryKey;autoIncrement:false" json:"zone_id"`
+	AllowTransfer []string  `gorm:"serializer:json;type:text" json:"allow_transfer"` // CIDRs that may AXFR the zone
+	AlsoNotify    []string  `gorm:"serializer:json;type:text" json:"also_notify"`    // Secondaries (IP or IP:port) notified of changes
+	TSIGKey       string    `gorm:"size:255" json:"tsig_key"`                        // tsig_keys entry transfers must be signed with (empty = unsigned)
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// ErrInvalidSettings is returned for zone settings with a bad CIDR or
+// notify target.
+var ErrInvalidSettings = errors.New("invalid zone settings")
+
+// NormalizeZoneSettings validates the lists and puts addresses in canonical
+// form; nil lists become empty.
+func NormalizeZoneSettings(s ZoneSettings) (ZoneSettings, error) {
+	acl := make([]string, 0, len(s.AllowTransfer))
+	for _, c := range s.AllowTransfer {
+		c = strings.TrimSpace(c)
+		p, err := netip.ParsePrefix(c)
+		if err != nil {
+			a, aerr := netip.ParseAddr(c)
+			if aerr != nil {
+				return s, fmt.Errorf("%w: allow_transfer %q", ErrInvalidSettings, c)
+			}
+			p = netip.PrefixFrom(a.Unmap(), a.Unmap().BitLen())
+		}
+		acl = append(acl, p.Masked().String())
+	}
+	notify := make([]string, 0, len(s.AlsoNotify))
+	for _, t := range s.AlsoNotify {
+		t = strings.TrimSpace(t)
+		if a, err := netip.ParseAddr(t); err == nil {
+			notify = append(notify, net.JoinHostPort(a.Unmap().String(), "53"))
+			continue
+		}
+		ap, err := netip.ParseAddrPort(t)
+		if err != nil || ap.Port() == 0 {
+			return s, fmt.Errorf("%w: also_notify %q must be an IP or IP:port", ErrInvalidSettings, t)
+		}
+		notify = append(notify, ap.String())
+	}
+	s.AllowTransfer = acl
+	s.AlsoNotify = notify
+	s.TSIGKey = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(s.TSIGKey), "."))
+	return s, nil
+}
+
+// GetZoneSettings returns the settings of a zone, or empty settings when none
+// were stored.
+func GetZoneSettings(db *gorm.DB, zoneID uint) (ZoneSettings, error) {
+	var s ZoneSettings
+	if err := db.Where("zone_id = ?", zoneID).Limit(1).Find(&s).Error; err != nil {
+		return s, err
+	}
+	if s.ZoneID == 0 {
+		s.ZoneID = zoneID
+	}
+	if s.AllowTransfer == nil {
+		s.AllowTransfer = []string{}
+	}
+	if s.AlsoNotify == nil {
+		s.AlsoNotify = []string{}
+	}
+	return s, nil
+}
+
+// SaveZoneSettings stores s, replacing earlier settings of the zone.
+func SaveZoneSettings(db *gorm.DB, s ZoneSettings) error {
+	return db.Save(&s).Error
+}
+
+// AllowsTransfer reports whether a client at addr is in allow_transfer.
+func (s ZoneSettings) AllowsTransfer(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, c := range s.AllowTransfer {
+		if p, err := netip.ParsePrefix(c); err == nil && p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
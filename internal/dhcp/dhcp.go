@@ -0,0 +1,451 @@
+// Package dhcp registers the hostnames of DHCP leases in a dynamic zone,
+// replacing nsupdate scripts run from the DHCP server's hooks. A lease adds
+// an A or AAAA record (and a PTR record with a reverse zone) that is removed
+// again when the lease is released or runs out.
+package dhcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"gorm.io/gorm"
+
+	"namedot/internal/config"
+	dbm "namedot/internal/db"
+)
+
+var (
+	// ErrInvalid is returned for leases without a usable address, hostname
+	// or lease time.
+	ErrInvalid = errors.New("invalid lease")
+	// ErrConflict is returned when the hostname or the PTR name already has
+	// records that no lease owns.
+	ErrConflict = errors.New("name has records not managed by dhcp")
+	// ErrNoZone is returned when dhcp.zone or dhcp.reverse_zone does not exist.
+	ErrNoZone = errors.New("dhcp zone not found")
+)
+
+// Lease is a lease reported by a DHCP server. Besides its own field names it
+// accepts those of Kea's lease commands, so lease JSON from Kea can be posted
+// as is.
+type Lease struct {
+	Hostname  string `json:"hostname"`
+	IP        string `json:"ip"`
+	MAC       string `json:"mac"`
+	LeaseTime int64  `json:"lease_time"` // Seconds from now
+	// Kea names
+	IPAddress string `json:"ip-address"`
+	HWAddress string `json:"hw-address"`
+	ValidLft  int64  `json:"valid-lft"`
+	CLTT      int64  `json:"cltt"` // Unix time the lease was last renewed; it runs valid-lft from then
+}
+
+// CacheInvalidator is implemented by the DNS server.
+type CacheInvalidator interface {
+	InvalidateZoneCache()
+}
+
+// Registrar keeps the lease records in the dhcp zone.
+type Registrar struct {
+	cfg   *config.Config
+	db    *gorm.DB
+	cache CacheInvalidator
+	now   func() time.Time
+}
+
+// New creates a registrar for cfg.DHCP. cache may be nil.
+func New(cfg *config.Config, db *gorm.DB, cache CacheInvalidator) *Registrar {
+	return &Registrar{cfg: cfg, db: db, cache: cache, now: time.Now}
+}
+
+// Leases returns the current leases ordered by hostname.
+func (r *Registrar) Leases() ([]dbm.DHCPLease, error) {
+	var out []dbm.DHCPLease
+	err := r.db.Order("hostname, ip").Find(&out).Error
+	return out, err
+}
+
+// Register adds or renews a lease. A new lease for an address replaces the
+// one before it, so a hostname follows its client to a new address.
+func (r *Registrar) Register(l Lease) (dbm.DHCPLease, error) {
+	var lease dbm.DHCPLease
+	ip, expires, err := r.parse(l)
+	if err != nil {
+		return lease, err
+	}
+	zone, err := r.zone(r.cfg.DHCP.Zone)
+	if err != nil {
+		return lease, err
+	}
+	name, err := hostname(l.Hostname, zone.Name)
+	if err != nil {
+		return lease, err
+	}
+	if err := dbm.CheckZoneUnlocked(r.db, zone.ID); err != nil {
+		return lease, err
+	}
+	rev, revName, err := r.reverse(ip)
+	if err != nil {
+		return lease, err
+	}
+	rtype := "A"
+	if ip.Is6() {
+		rtype = "AAAA"
+	}
+	ttl := r.cfg.DHCP.TTL
+	if left := uint32(expires.Sub(r.now()).Seconds()); left < ttl {
+		ttl = max(left, 1)
+	}
+	mac := strings.ToLower(strings.TrimSpace(l.MAC + l.HWAddress))
+
+	changed := map[uint]bool{}
+	err = dbm.WithSource(r.db, dbm.SourceDHCP).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("ip = ?", ip.String()).Limit(1).Find(&lease).Error; err != nil {
+			return err
+		}
+		if err := checkOwned(tx, zone.ID, name, rtype, ip.String()); err != nil {
+			return err
+		}
+		if rev != nil && lease.ID == 0 {
+			var n int64
+			if err := tx.Model(&dbm.RRSet{}).Where("zone_id = ? AND name = ? AND type = ?", rev.ID, revName, "PTR").Count(&n).Error; err != nil {
+				return err
+			}
+			if n > 0 {
+				return fmt.Errorf("%w: %s PTR", ErrConflict, revName)
+			}
+		}
+		if lease.ID != 0 && lease.Hostname != name {
+			moved, err := removeRecord(tx, lease.ZoneID, lease.Hostname, rtype, lease.IP)
+			if err != nil {
+				return err
+			}
+			if moved {
+				changed[lease.ZoneID] = true
+			}
+		}
+		lease.ZoneID, lease.IP, lease.Hostname, lease.MAC, lease.ExpiresAt = zone.ID, ip.String(), name, mac, expires.UTC()
+		if err := tx.Save(&lease).Error; err != nil {
+			return err
+		}
+		added, err := setRecord(tx, zone.ID, name, rtype, ip.String(), ttl, false)
+		if err != nil {
+			return err
+		}
+		if added {
+			changed[zone.ID] = true
+		}
+		if rev != nil {
+			added, err := setRecord(tx, rev.ID, revName, "PTR", name, ttl, true)
+			if err != nil {
+				return err
+			}
+			if added {
+				changed[rev.ID] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return lease, err
+	}
+	r.touch(changed)
+	return lease, nil
+}
+
+// Release removes the lease of an address and its records. Releasing an
+// address without a lease does nothing.
+func (r *Registrar) Release(ip string) error {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return fmt.Errorf("%w: address %q", ErrInvalid, ip)
+	}
+	var lease dbm.DHCPLease
+	if err := r.db.Where("ip = ?", addr.Unmap().String()).Limit(1).Find(&lease).Error; err != nil || lease.ID == 0 {
+		return err
+	}
+	if err := dbm.CheckZoneUnlocked(r.db, lease.ZoneID); err != nil {
+		return err
+	}
+	return r.remove([]dbm.DHCPLease{lease})
+}
+
+// Expire removes the leases that ran out and returns how many there were.
+// Leases in locked zones are left for a later run.
+func (r *Registrar) Expire() (int, error) {
+	var due []dbm.DHCPLease
+	if err := r.db.Where("expires_at <= ?", r.now().UTC()).Find(&due).Error; err != nil {
+		return 0, err
+	}
+	out := due[:0]
+	for _, l := range due {
+		if dbm.CheckZoneUnlocked(r.db, l.ZoneID) == nil {
+			out = append(out, l)
+		}
+	}
+	if len(out) == 0 {
+		return 0, nil
+	}
+	return len(out), r.remove(out)
+}
+
+// Run removes expired leases every dhcp.check_sec until ctx is done.
+func (r *Registrar) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(r.cfg.DHCP.CheckSec) * time.Second)
+	defer ticker.Stop()
+	for {
+		if n, err := r.Expire(); err != nil {
+			log.Printf("dhcp: expire leases: %v", err)
+		} else if n > 0 {
+			log.Printf("dhcp: removed %d expired lease(s)", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// remove deletes leases with their forward and PTR records.
+func (r *Registrar) remove(leases []dbm.DHCPLease) error {
+	rev, _ := r.zone(r.cfg.DHCP.ReverseZone)
+	changed := map[uint]bool{}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		for _, l := range leases {
+			addr, err := netip.ParseAddr(l.IP)
+			if err != nil {
+				continue
+			}
+			rtype := "A"
+			if addr.Is6() {
+				rtype = "AAAA"
+			}
+			removed, err := removeRecord(tx, l.ZoneID, l.Hostname, rtype, l.IP)
+			if err != nil {
+				return err
+			}
+			if removed {
+				changed[l.ZoneID] = true
+			}
+			if rev != nil {
+				revName, _ := dns.ReverseAddr(l.IP)
+				removed, err := removeRecord(tx, rev.ID, revName, "PTR", l.Hostname)
+				if err != nil {
+					return err
+				}
+				if removed {
+					changed[rev.ID] = true
+				}
+			}
+			if err := tx.Delete(&dbm.DHCPLease{}, l.ID).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	r.touch(changed)
+	return nil
+}
+
+// touch bumps the serials of changed zones and drops cached answers.
+func (r *Registrar) touch(zones map[uint]bool) {
+	if len(zones) == 0 {
+		return
+	}
+	for id := range zones {
+		var z dbm.Zone
+		if err := r.db.First(&z, id).Error; err == nil {
+			dbm.TouchZone(r.db, z, r.cfg)
+		}
+	}
+	if r.cache != nil {
+		r.cache.InvalidateZoneCache()
+	}
+}
+
+// parse returns the address of l and when the lease runs out.
+func (r *Registrar) parse(l Lease) (netip.Addr, time.Time, error) {
+	raw := strings.TrimSpace(l.IP)
+	if raw == "" {
+		raw = strings.TrimSpace(l.IPAddress)
+	}
+	ip, err := netip.ParseAddr(raw)
+	if err != nil {
+		return ip, time.Time{}, fmt.Errorf("%w: address %q", ErrInvalid, raw)
+	}
+	ip = ip.Unmap()
+	now := r.now()
+	var expires time.Time
+	switch {
+	case l.CLTT > 0 && l.ValidLft > 0:
+		expires = time.Unix(l.CLTT+l.ValidLft, 0)
+	case l.ValidLft > 0:
+		expires = now.Add(time.Duration(l.ValidLft) * time.Second)
+	case l.LeaseTime > 0:
+		expires = now.Add(time.Duration(l.LeaseTime) * time.Second)
+	default:
+		return ip, expires, fmt.Errorf("%w: lease_time is required", ErrInvalid)
+	}
+	if !expires.After(now) {
+		return ip, expires, fmt.Errorf("%w: lease has already expired", ErrInvalid)
+	}
+	return ip, expires, nil
+}
+
+// zone loads a configured zone by name; an empty name gives nil.
+func (r *Registrar) zone(name string) (*dbm.Zone, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, nil
+	}
+	fq := dns.Fqdn(strings.ToLower(strings.TrimSpace(name)))
+	var z dbm.Zone
+	if err := r.db.Where("name = ?", fq).Limit(1).Find(&z).Error; err != nil {
+		return nil, err
+	}
+	if z.ID == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoZone, fq)
+	}
+	return &z, nil
+}
+
+// reverse returns the reverse zone and PTR name of ip, or a nil zone when
+// there is no reverse zone or ip is outside it.
+func (r *Registrar) reverse(ip netip.Addr) (*dbm.Zone, string, error) {
+	rev, err := r.zone(r.cfg.DHCP.ReverseZone)
+	if err != nil || rev == nil {
+		return nil, "", err
+	}
+	name, err := dns.ReverseAddr(ip.String())
+	if err != nil || !dns.IsSubDomain(rev.Name, name) {
+		return nil, "", nil
+	}
+	if err := dbm.CheckZoneUnlocked(r.db, rev.ID); err != nil {
+		return nil, "", err
+	}
+	return rev, name, nil
+}
+
+// hostname turns the hostname a client sent into a name in zone: a name
+// already in the zone is kept, anything else is reduced to its first label.
+// Characters not allowed in hostnames become dashes.
+func hostname(raw, zone string) (string, error) {
+	h := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(raw), "."))
+	if h+"." != zone && dns.IsSubDomain(zone, h+".") {
+		h = strings.TrimSuffix(h+".", "."+zone)
+	}
+	h, _, _ = strings.Cut(h, ".")
+	h = strings.Trim(strings.Map(func(c rune) rune {
+		if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' {
+			return c
+		}
+		return '-'
+	}, h), "-")
+	if h == "" || len(h) > 63 {
+		return "", fmt.Errorf("%w: hostname %q", ErrInvalid, raw)
+	}
+	return h + "." + zone, nil
+}
+
+// checkOwned returns ErrConflict if name has a CNAME, or rtype records other
+// than ip that no lease of name accounts for.
+func checkOwned(tx *gorm.DB, zoneID uint, name, rtype, ip string) error {
+	var sets []dbm.RRSet
+	if err := tx.Preload("Records").Where("zone_id = ? AND name = ? AND type IN ?", zoneID, name, []string{rtype, "CNAME"}).Find(&sets).Error; err != nil {
+		return err
+	}
+	for _, set := range sets {
+		if set.Type == "CNAME" {
+			return fmt.Errorf("%w: %s has a CNAME", ErrConflict, name)
+		}
+		for _, rec := range set.Records {
+			if rec.Data == ip {
+				continue
+			}
+			var n int64
+			if err := tx.Model(&dbm.DHCPLease{}).Where("ip = ? AND hostname = ?", rec.Data, name).Count(&n).Error; err != nil {
+				return err
+			}
+			if n == 0 {
+				return fmt.Errorf("%w: %s %s %s", ErrConflict, name, rtype, rec.Data)
+			}
+		}
+	}
+	return nil
+}
+
+// setRecord makes the rrset hold data with the given TTL, creating it as
+// needed; with only, other records of the rrset are removed. It reports
+// whether anything changed.
+func setRecord(tx *gorm.DB, zoneID uint, name, rtype, data string, ttl uint32, only bool) (bool, error) {
+	var set dbm.RRSet
+	if err := tx.Preload("Records").Where("zone_id = ? AND name = ? AND type = ?", zoneID, name, rtype).Limit(1).Find(&set).Error; err != nil {
+		return false, err
+	}
+	if set.ID == 0 {
+		set = dbm.RRSet{ZoneID: zoneID, Name: name, Type: rtype, TTL: ttl, Records: []dbm.RData{{Data: data}}}
+		return true, tx.Create(&set).Error
+	}
+	changed := false
+	if set.TTL != ttl {
+		if err := tx.Model(&dbm.RRSet{}).Where("id = ?", set.ID).Update("ttl", ttl).Error; err != nil {
+			return false, err
+		}
+		changed = true
+	}
+	found := false
+	for _, rec := range set.Records {
+		if rec.Data == data {
+			found = true
+			continue
+		}
+		if only {
+			if err := tx.Unscoped().Delete(&dbm.RData{}, rec.ID).Error; err != nil {
+				return false, err
+			}
+			changed = true
+		}
+	}
+	if !found {
+		if err := tx.Create(&dbm.RData{RRSetID: set.ID, Data: data}).Error; err != nil {
+			return false, err
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// removeRecord deletes the data record from an rrset, and the rrset once it
+// is empty. It reports whether anything was deleted.
+func removeRecord(tx *gorm.DB, zoneID uint, name, rtype, data string) (bool, error) {
+	var set dbm.RRSet
+	if err := tx.Preload("Records").Where("zone_id = ? AND name = ? AND type = ?", zoneID, name, rtype).Limit(1).Find(&set).Error; err != nil || set.ID == 0 {
+		return false, err
+	}
+	left, removed := 0, false
+	for _, rec := range set.Records {
+		if rec.Data != data {
+			left++
+			continue
+		}
+		if err := tx.Unscoped().Delete(&dbm.RData{}, rec.ID).Error; err != nil {
+			return false, err
+		}
+		removed = true
+	}
+	if left == 0 {
+		if err := tx.Unscoped().Delete(&dbm.RRSet{}, set.ID).Error; err != nil {
+			return false, err
+		}
+	}
+	return removed, nil
+}
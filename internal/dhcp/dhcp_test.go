@@ -0,0 +1,121 @@
+package dhcp
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"namedot/internal/config"
+	dbm "namedot/internal/db"
+)
+
+func newTestRegistrar(t *testing.T) (*Registrar, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := dbm.AutoMigrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	for _, name := range []string{"lan.test.", "2.0.192.in-addr.arpa."} {
+		if err := db.Create(&dbm.Zone{Name: name}).Error; err != nil {
+			t.Fatalf("create zone: %v", err)
+		}
+	}
+	cfg := &config.Config{DHCP: config.DHCPConfig{Enabled: true, Zone: "lan.test", ReverseZone: "2.0.192.in-addr.arpa", TTL: 300, CheckSec: 60}}
+	return New(cfg, db, nil), db
+}
+
+func records(t *testing.T, db *gorm.DB, name, rtype string) []string {
+	t.Helper()
+	var set dbm.RRSet
+	db.Preload("Records").Where("name = ? AND type = ?", name, rtype).Limit(1).Find(&set)
+	var out []string
+	for _, r := range set.Records {
+		out = append(out, r.Data)
+	}
+	return out
+}
+
+func TestRegisterAndExpire(t *testing.T) {
+	r, db := newTestRegistrar(t)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+
+	lease, err := r.Register(Lease{Hostname: "Laptop_01.home", IP: "192.0.2.10", MAC: "AA:BB:CC:00:11:22", LeaseTime: 3600})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if lease.Hostname != "laptop-01.lan.test." || lease.MAC != "aa:bb:cc:00:11:22" || !lease.ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Fatalf("lease: %+v", lease)
+	}
+	if got := records(t, db, "laptop-01.lan.test.", "A"); len(got) != 1 || got[0] != "192.0.2.10" {
+		t.Fatalf("A: %v", got)
+	}
+	if got := records(t, db, "10.2.0.192.in-addr.arpa.", "PTR"); len(got) != 1 || got[0] != "laptop-01.lan.test." {
+		t.Fatalf("PTR: %v", got)
+	}
+
+	// Kea lease JSON: the address moves to another host
+	if _, err := r.Register(Lease{Hostname: "printer.lan.test.", IPAddress: "192.0.2.10", HWAddress: "aa:bb:cc:00:11:33", ValidLft: 600, CLTT: now.Unix()}); err != nil {
+		t.Fatalf("register kea lease: %v", err)
+	}
+	if got := records(t, db, "laptop-01.lan.test.", "A"); len(got) != 0 {
+		t.Fatalf("old host keeps the address: %v", got)
+	}
+	var set dbm.RRSet
+	db.Where("name = ? AND type = ?", "printer.lan.test.", "A").First(&set)
+	if set.TTL != 300 {
+		t.Fatalf("TTL: %d", set.TTL)
+	}
+	if got := records(t, db, "10.2.0.192.in-addr.arpa.", "PTR"); len(got) != 1 || got[0] != "printer.lan.test." {
+		t.Fatalf("PTR after move: %v", got)
+	}
+
+	now = now.Add(11 * time.Minute)
+	if n, err := r.Expire(); err != nil || n != 1 {
+		t.Fatalf("expire: %d %v", n, err)
+	}
+	if got := records(t, db, "printer.lan.test.", "A"); len(got) != 0 {
+		t.Fatalf("expired lease kept its record: %v", got)
+	}
+	if got := records(t, db, "10.2.0.192.in-addr.arpa.", "PTR"); len(got) != 0 {
+		t.Fatalf("expired lease kept its PTR: %v", got)
+	}
+}
+
+func TestRegister_StaticRecordsAreKept(t *testing.T) {
+	r, db := newTestRegistrar(t)
+	var zone dbm.Zone
+	db.Where("name = ?", "lan.test.").First(&zone)
+	db.Create(&dbm.RRSet{ZoneID: zone.ID, Name: "nas.lan.test.", Type: "A", TTL: 3600, Records: []dbm.RData{{Data: "192.0.2.5"}}})
+
+	_, err := r.Register(Lease{Hostname: "nas", IP: "192.0.2.20", LeaseTime: 3600})
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected conflict, got %v", err)
+	}
+	if got := records(t, db, "nas.lan.test.", "A"); len(got) != 1 || got[0] != "192.0.2.5" {
+		t.Fatalf("static record changed: %v", got)
+	}
+	for _, l := range []Lease{{Hostname: "x", IP: "bogus", LeaseTime: 60}, {Hostname: "...", IP: "192.0.2.30", LeaseTime: 60}, {Hostname: "x", IP: "192.0.2.30"}} {
+		if _, err := r.Register(l); !errors.Is(err, ErrInvalid) {
+			t.Fatalf("%+v: expected invalid, got %v", l, err)
+		}
+	}
+
+	if _, err := r.Register(Lease{Hostname: "phone", IP: "2001:db8::10", LeaseTime: 60}); err != nil {
+		t.Fatalf("register v6: %v", err)
+	}
+	if err := r.Release("2001:db8::10"); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if got := records(t, db, "phone.lan.test.", "AAAA"); len(got) != 0 {
+		t.Fatalf("released lease kept its record: %v", got)
+	}
+}
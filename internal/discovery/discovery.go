@@ -0,0 +1,321 @@
+// Package discovery publishes DNS records for Docker containers and
+// Kubernetes services, turning labels on them into A/AAAA and SRV records
+// in a zone the syncer owns:
+//
+//	namedot.name: api                 -> api.<zone> A/AAAA <container or cluster IPs>
+//	namedot.srv:  _http._tcp:8080     -> _http._tcp.api.<zone> SRV 0 0 8080 api.<zone>
+//
+// Containers and services are listed every interval; records for ones that
+// are gone are removed.
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"gorm.io/gorm"
+
+	"namedot/internal/config"
+	dbm "namedot/internal/db"
+)
+
+// Labels (Docker) and annotations (Kubernetes) read by the sources.
+const (
+	LabelName    = "namedot.name"    // Name relative to the zone
+	LabelSRV     = "namedot.srv"     // Comma-separated _service._proto:port entries
+	LabelNetwork = "namedot.network" // Docker only: network whose address is published
+)
+
+// managedTypes are the record types discovery owns in its zone.
+var managedTypes = []string{"A", "AAAA", "SRV"}
+
+// Service is a container or service to publish.
+type Service struct {
+	Source string       // container or namespace/service, for logs
+	Name   string       // namedot.name
+	SRV    string       // namedot.srv
+	IPs    []netip.Addr // addresses of the A/AAAA records
+}
+
+// Source lists the services to publish.
+type Source interface {
+	Services(ctx context.Context) ([]Service, error)
+}
+
+// CacheInvalidator is implemented by the DNS server.
+type CacheInvalidator interface {
+	InvalidateZoneCache()
+}
+
+// Syncer makes the zone's A, AAAA and SRV records match the services.
+type Syncer struct {
+	cfg   *config.Config
+	db    *gorm.DB
+	src   Source
+	cache CacheInvalidator
+}
+
+// New creates a syncer for cfg.Discovery with the configured provider.
+// cache may be nil.
+func New(cfg *config.Config, db *gorm.DB, cache CacheInvalidator) (*Syncer, error) {
+	var src Source
+	var err error
+	switch cfg.Discovery.Provider {
+	case "docker":
+		src, err = NewDocker(cfg.Discovery.DockerHost)
+	case "kubernetes":
+		src, err = NewKubernetes(cfg.Discovery)
+	default:
+		err = fmt.Errorf("unknown provider %q", cfg.Discovery.Provider)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Syncer{cfg: cfg, db: db, src: src, cache: cache}, nil
+}
+
+// Result counts the rrsets a sync created, updated and deleted.
+type Result struct {
+	Created, Updated, Deleted int
+}
+
+// Changed reports whether the sync changed the zone.
+func (r Result) Changed() bool {
+	return r.Created+r.Updated+r.Deleted > 0
+}
+
+// Sync lists the services once and updates the zone. A locked zone is left
+// alone until it is unlocked.
+func (s *Syncer) Sync(ctx context.Context) (Result, error) {
+	var res Result
+	services, err := s.src.Services(ctx)
+	if err != nil {
+		return res, err
+	}
+	name := dns.Fqdn(strings.ToLower(strings.TrimSpace(s.cfg.Discovery.Zone)))
+	var zone dbm.Zone
+	if err := s.db.Where("name = ?", name).Limit(1).Find(&zone).Error; err != nil {
+		return res, err
+	}
+	if zone.ID == 0 {
+		return res, fmt.Errorf("zone %s not found", name)
+	}
+	if err := dbm.CheckZoneUnlocked(s.db, zone.ID); err != nil {
+		return res, err
+	}
+	err = dbm.WithSource(s.db, dbm.SourceDiscovery(s.cfg.Discovery.Provider)).Transaction(func(tx *gorm.DB) error {
+		var cnames []string
+		if err := tx.Model(&dbm.RRSet{}).Where("zone_id = ? AND type = ?", zone.ID, "CNAME").Pluck("name", &cnames).Error; err != nil {
+			return err
+		}
+		want := Desired(zone.Name, services, s.cfg.Discovery.TTL, cnames)
+		var have []dbm.RRSet
+		if err := tx.Preload("Records").Where("zone_id = ? AND type IN ?", zone.ID, managedTypes).Find(&have).Error; err != nil {
+			return err
+		}
+		res, err = reconcile(tx, zone.ID, have, want)
+		return err
+	})
+	if err != nil || !res.Changed() {
+		return res, err
+	}
+	dbm.TouchZone(s.db, zone, s.cfg)
+	if s.cache != nil {
+		s.cache.InvalidateZoneCache()
+	}
+	return res, nil
+}
+
+// Run syncs every discovery.interval_sec until ctx is done.
+func (s *Syncer) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(s.cfg.Discovery.IntervalSec) * time.Second)
+	defer ticker.Stop()
+	for {
+		if res, err := s.Sync(ctx); err != nil {
+			log.Printf("discovery: %v", err)
+		} else if res.Changed() {
+			log.Printf("discovery: %s: %d created, %d updated, %d deleted", s.cfg.Discovery.Zone, res.Created, res.Updated, res.Deleted)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Desired returns the rrsets the services should have in zone, sorted by
+// name and type. Services with bad labels, and names that already have one
+// of the CNAMEs, are skipped with a log line.
+func Desired(zone string, services []Service, ttl uint32, cnames []string) []dbm.RRSet {
+	blocked := map[string]bool{}
+	for _, n := range cnames {
+		blocked[n] = true
+	}
+	sets := map[string]*dbm.RRSet{}
+	add := func(name, rtype, data string) {
+		key := name + " " + rtype
+		set := sets[key]
+		if set == nil {
+			set = &dbm.RRSet{Name: name, Type: rtype, TTL: ttl}
+			sets[key] = set
+		}
+		for _, r := range set.Records {
+			if r.Data == data {
+				return
+			}
+		}
+		set.Records = append(set.Records, dbm.RData{Data: data})
+	}
+	for _, svc := range services {
+		owner, err := ownerName(svc.Name, zone)
+		if err != nil {
+			log.Printf("discovery: %s: %v", svc.Source, err)
+			continue
+		}
+		if blocked[owner] {
+			log.Printf("discovery: %s: %s has a CNAME", svc.Source, owner)
+			continue
+		}
+		srv, err := parseSRV(svc.SRV)
+		if err != nil {
+			log.Printf("discovery: %s: %v", svc.Source, err)
+			continue
+		}
+		for _, ip := range svc.IPs {
+			rtype := "A"
+			if ip.Is6() {
+				rtype = "AAAA"
+			}
+			add(owner, rtype, ip.String())
+		}
+		if len(svc.IPs) == 0 {
+			continue
+		}
+		for _, e := range srv {
+			add(e.prefix+"."+owner, "SRV", fmt.Sprintf("0 0 %d %s", e.port, owner))
+		}
+	}
+	out := make([]dbm.RRSet, 0, len(sets))
+	for _, set := range sets {
+		sort.Slice(set.Records, func(i, j int) bool { return set.Records[i].Data < set.Records[j].Data })
+		out = append(out, *set)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Name != out[j].Name {
+			return out[i].Name < out[j].Name
+		}
+		return out[i].Type < out[j].Type
+	})
+	return out
+}
+
+// ownerName turns a namedot.name label into an FQDN inside zone.
+func ownerName(label, zone string) (string, error) {
+	n := strings.Trim(strings.ToLower(strings.TrimSpace(label)), ".")
+	if n == "" {
+		return "", fmt.Errorf("empty %s", LabelName)
+	}
+	name := n + "." + zone
+	if _, ok := dns.IsDomainName(name); !ok || strings.ContainsAny(n, " _*@") {
+		return "", fmt.Errorf("invalid %s %q", LabelName, label)
+	}
+	return name, nil
+}
+
+type srvEntry struct {
+	prefix string // _service._proto
+	port   int
+}
+
+// parseSRV reads a namedot.srv label such as "_http._tcp:80,_grpc._tcp:9090".
+func parseSRV(label string) ([]srvEntry, error) {
+	var out []srvEntry
+	for _, part := range strings.Split(label, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part == "" {
+			continue
+		}
+		prefix, port, ok := strings.Cut(part, ":")
+		p, err := strconv.Atoi(port)
+		labels := strings.Split(prefix, ".")
+		if !ok || err != nil || p < 1 || p > 65535 || len(labels) != 2 ||
+			!strings.HasPrefix(labels[0], "_") || (labels[1] != "_tcp" && labels[1] != "_udp") || len(labels[0]) < 2 {
+			return nil, fmt.Errorf("invalid %s entry %q (want _service._tcp:port)", LabelSRV, part)
+		}
+		out = append(out, srvEntry{prefix: prefix, port: p})
+	}
+	return out, nil
+}
+
+// reconcile makes the managed rrsets of a zone equal want.
+func reconcile(tx *gorm.DB, zoneID uint, have, want []dbm.RRSet) (Result, error) {
+	var res Result
+	current := make(map[string]dbm.RRSet, len(have))
+	for _, set := range have {
+		current[set.Name+" "+set.Type] = set
+	}
+	for _, set := range want {
+		key := set.Name + " " + set.Type
+		old, ok := current[key]
+		delete(current, key)
+		if !ok {
+			set.ZoneID = zoneID
+			if err := tx.Create(&set).Error; err != nil {
+				return res, err
+			}
+			res.Created++
+			continue
+		}
+		if old.TTL == set.TTL && sameData(old.Records, set.Records) {
+			continue
+		}
+		if err := tx.Unscoped().Where("rr_set_id = ?", old.ID).Delete(&dbm.RData{}).Error; err != nil {
+			return res, err
+		}
+		if err := tx.Model(&dbm.RRSet{}).Where("id = ?", old.ID).Update("ttl", set.TTL).Error; err != nil {
+			return res, err
+		}
+		for _, r := range set.Records {
+			r.RRSetID = old.ID
+			if err := tx.Create(&r).Error; err != nil {
+				return res, err
+			}
+		}
+		res.Updated++
+	}
+	for _, old := range current {
+		if err := tx.Unscoped().Where("rr_set_id = ?", old.ID).Delete(&dbm.RData{}).Error; err != nil {
+			return res, err
+		}
+		if err := tx.Unscoped().Delete(&dbm.RRSet{}, old.ID).Error; err != nil {
+			return res, err
+		}
+		res.Deleted++
+	}
+	return res, nil
+}
+
+// sameData reports whether a and b hold the same plain records.
+func sameData(a, b []dbm.RData) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := make(map[string]bool, len(a))
+	for _, r := range a {
+		seen[r.Identity()] = true
+	}
+	for _, r := range b {
+		if !seen[r.Identity()] {
+			return false
+		}
+	}
+	return true
+}
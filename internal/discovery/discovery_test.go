@@ -0,0 +1,175 @@
+package discovery
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"namedot/internal/config"
+	dbm "namedot/internal/db"
+)
+
+type fakeSource []Service
+
+func (f *fakeSource) Services(context.Context) ([]Service, error) { return *f, nil }
+
+func records(t *testing.T, db *gorm.DB, name, rtype string) []string {
+	t.Helper()
+	var set dbm.RRSet
+	db.Preload("Records").Where("name = ? AND type = ?", name, rtype).Limit(1).Find(&set)
+	var out []string
+	for _, r := range set.Records {
+		out = append(out, r.Data)
+	}
+	return out
+}
+
+func TestSync(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := dbm.AutoMigrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	zone := dbm.Zone{Name: "svc.test.", RRSets: []dbm.RRSet{
+		{Name: "legacy.svc.test.", Type: "CNAME", TTL: 300, Records: []dbm.RData{{Data: "old.example."}}},
+		{Name: "svc.test.", Type: "TXT", TTL: 300, Records: []dbm.RData{{Data: "\"keep\""}}},
+	}}
+	if err := db.Create(&zone).Error; err != nil {
+		t.Fatalf("create zone: %v", err)
+	}
+	src := &fakeSource{
+		{Source: "api-1", Name: "api", SRV: "_http._tcp:8080", IPs: []netip.Addr{netip.MustParseAddr("10.0.0.2")}},
+		{Source: "api-2", Name: "API.", IPs: []netip.Addr{netip.MustParseAddr("10.0.0.3"), netip.MustParseAddr("fd00::3")}},
+		{Source: "legacy", Name: "legacy", IPs: []netip.Addr{netip.MustParseAddr("10.0.0.4")}},
+		{Source: "bad", Name: "web", SRV: "http:80", IPs: []netip.Addr{netip.MustParseAddr("10.0.0.5")}},
+	}
+	cfg := &config.Config{Discovery: config.DiscoveryConfig{Enabled: true, Zone: "svc.test", TTL: 60}}
+	s := &Syncer{cfg: cfg, db: db, src: src}
+
+	res, err := s.Sync(context.Background())
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if res != (Result{Created: 3}) {
+		t.Fatalf("result: %+v", res)
+	}
+	if got := records(t, db, "api.svc.test.", "A"); len(got) != 2 || got[0] != "10.0.0.2" || got[1] != "10.0.0.3" {
+		t.Fatalf("A: %v", got)
+	}
+	if got := records(t, db, "api.svc.test.", "AAAA"); len(got) != 1 || got[0] != "fd00::3" {
+		t.Fatalf("AAAA: %v", got)
+	}
+	if got := records(t, db, "_http._tcp.api.svc.test.", "SRV"); len(got) != 1 || got[0] != "0 0 8080 api.svc.test." {
+		t.Fatalf("SRV: %v", got)
+	}
+	if got := records(t, db, "legacy.svc.test.", "A"); got != nil {
+		t.Fatalf("name with a CNAME got A: %v", got)
+	}
+	if got := records(t, db, "web.svc.test.", "A"); got != nil {
+		t.Fatalf("bad srv label published: %v", got)
+	}
+
+	if res, _ := s.Sync(context.Background()); res.Changed() {
+		t.Fatalf("second sync changed the zone: %+v", res)
+	}
+
+	*src = (*src)[:1]
+	res, err = s.Sync(context.Background())
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if res != (Result{Updated: 1, Deleted: 1}) {
+		t.Fatalf("result: %+v", res)
+	}
+	if got := records(t, db, "api.svc.test.", "A"); len(got) != 1 || got[0] != "10.0.0.2" {
+		t.Fatalf("A after update: %v", got)
+	}
+	if got := records(t, db, "svc.test.", "TXT"); len(got) != 1 {
+		t.Fatalf("unmanaged TXT touched: %v", got)
+	}
+
+	if _, err := dbm.LockZone(db, zone.ID, "ops", "freeze"); err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	*src = nil
+	if _, err := s.Sync(context.Background()); err == nil {
+		t.Fatal("sync of a locked zone succeeded")
+	}
+	if got := records(t, db, "api.svc.test.", "A"); len(got) != 1 {
+		t.Fatalf("locked zone changed: %v", got)
+	}
+}
+
+func TestDockerServices(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/containers/json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`[
+			{"Id":"abc","Names":["/api"],"Labels":{"namedot.name":"api","namedot.srv":"_http._tcp:80","namedot.network":"front"},
+			 "NetworkSettings":{"Networks":{"back":{"IPAddress":"172.18.0.2"},"front":{"IPAddress":"172.19.0.2","GlobalIPv6Address":"fd00::2"}}}},
+			{"Id":"def","Names":["/db"],"Labels":{},"NetworkSettings":{"Networks":{"bridge":{"IPAddress":"172.17.0.3"}}}}
+		]`))
+	}))
+	defer srv.Close()
+
+	d, err := NewDocker("tcp://" + srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	services, err := d.Services(context.Background())
+	if err != nil {
+		t.Fatalf("services: %v", err)
+	}
+	if len(services) != 1 {
+		t.Fatalf("services: %+v", services)
+	}
+	svc := services[0]
+	if svc.Source != "api" || svc.Name != "api" || svc.SRV != "_http._tcp:80" || len(svc.IPs) != 2 ||
+		svc.IPs[0].String() != "172.19.0.2" || svc.IPs[1].String() != "fd00::2" {
+		t.Fatalf("service: %+v", svc)
+	}
+}
+
+func TestKubernetesServices(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/prod/services" || r.Header.Get("Authorization") != "Bearer s3cret" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"items":[
+			{"metadata":{"name":"api","namespace":"prod","annotations":{"namedot.name":"api"}},"spec":{"clusterIP":"10.96.0.10","clusterIPs":["10.96.0.10","fd00::a"]}},
+			{"metadata":{"name":"headless","namespace":"prod","annotations":{"namedot.name":"h"}},"spec":{"clusterIP":"None"}},
+			{"metadata":{"name":"plain","namespace":"prod"},"spec":{"clusterIP":"10.96.0.11"}}
+		]}`))
+	}))
+	defer srv.Close()
+
+	token := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(token, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	k, err := NewKubernetes(config.DiscoveryConfig{KubeAPI: srv.URL, KubeTokenFile: token, Namespace: "prod"})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	services, err := k.Services(context.Background())
+	if err != nil {
+		t.Fatalf("services: %v", err)
+	}
+	if len(services) != 1 || services[0].Source != "prod/api" || len(services[0].IPs) != 2 {
+		t.Fatalf("services: %+v", services)
+	}
+}
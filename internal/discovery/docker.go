@@ -0,0 +1,110 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Docker lists running containers through the Docker Engine API.
+type Docker struct {
+	client *http.Client
+	base   string
+}
+
+// NewDocker creates a source for a Docker host such as
+// unix:///var/run/docker.sock or tcp://10.0.0.5:2375.
+func NewDocker(host string) (*Docker, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("docker_host: %w", err)
+	}
+	d := &Docker{client: &http.Client{Timeout: 10 * time.Second}}
+	switch u.Scheme {
+	case "unix":
+		sock := u.Path
+		d.client.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", sock)
+			},
+		}
+		d.base = "http://docker"
+	case "tcp":
+		d.base = "http://" + u.Host
+	default:
+		return nil, fmt.Errorf("docker_host: unsupported scheme %q", u.Scheme)
+	}
+	return d, nil
+}
+
+type dockerContainer struct {
+	ID              string            `json:"Id"`
+	Names           []string          `json:"Names"`
+	Labels          map[string]string `json:"Labels"`
+	NetworkSettings struct {
+		Networks map[string]struct {
+			IPAddress         string `json:"IPAddress"`
+			GlobalIPv6Address string `json:"GlobalIPv6Address"`
+		} `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+// Services returns the running containers labelled namedot.name. Their
+// addresses come from every network they are attached to, or only the one
+// named by namedot.network.
+func (d *Docker) Services(ctx context.Context) ([]Service, error) {
+	filters := url.QueryEscape(`{"label":["` + LabelName + `"],"status":["running"]}`)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.base+"/containers/json?filters="+filters, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("docker: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("docker: list containers: %s", resp.Status)
+	}
+	var containers []dockerContainer
+	if err := json.NewDecoder(resp.Body).Decode(&containers); err != nil {
+		return nil, fmt.Errorf("docker: %w", err)
+	}
+	var out []Service
+	for _, c := range containers {
+		if c.Labels[LabelName] == "" {
+			continue
+		}
+		svc := Service{Source: c.ID, Name: c.Labels[LabelName], SRV: c.Labels[LabelSRV]}
+		if len(c.Names) > 0 {
+			svc.Source = strings.TrimPrefix(c.Names[0], "/")
+		}
+		network := c.Labels[LabelNetwork]
+		names := make([]string, 0, len(c.NetworkSettings.Networks))
+		for name := range c.NetworkSettings.Networks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if network != "" && name != network {
+				continue
+			}
+			n := c.NetworkSettings.Networks[name]
+			for _, s := range []string{n.IPAddress, n.GlobalIPv6Address} {
+				if ip, err := netip.ParseAddr(s); err == nil {
+					svc.IPs = append(svc.IPs, ip.Unmap())
+				}
+			}
+		}
+		out = append(out, svc)
+	}
+	return out, nil
+}
@@ -0,0 +1,135 @@
+package discovery
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"namedot/internal/config"
+)
+
+// In-cluster service account files.
+const (
+	kubeTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	kubeCAFile    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+)
+
+// Kubernetes lists services through the Kubernetes API. The token file is
+// re-read on every request since projected service account tokens rotate.
+type Kubernetes struct {
+	client    *http.Client
+	base      string
+	tokenFile string
+	namespace string
+}
+
+// NewKubernetes creates a source for cfg. Without kube_api it uses the
+// in-cluster API server and service account.
+func NewKubernetes(cfg config.DiscoveryConfig) (*Kubernetes, error) {
+	k := &Kubernetes{base: strings.TrimRight(cfg.KubeAPI, "/"), tokenFile: cfg.KubeTokenFile, namespace: cfg.Namespace}
+	if k.base == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, errors.New("kube_api is not set and not running in a cluster")
+		}
+		k.base = "https://" + net.JoinHostPort(host, port)
+	}
+	if k.tokenFile == "" {
+		k.tokenFile = kubeTokenFile
+	}
+	caFile := cfg.KubeCAFile
+	if caFile == "" && cfg.KubeAPI == "" {
+		caFile = kubeCAFile
+	}
+	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("kube_ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("kube_ca_file: no certificates in %s", caFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+	k.client = &http.Client{Timeout: 10 * time.Second, Transport: &http.Transport{TLSClientConfig: tlsCfg}}
+	return k, nil
+}
+
+type kubeServiceList struct {
+	Items []struct {
+		Metadata struct {
+			Name        string            `json:"name"`
+			Namespace   string            `json:"namespace"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+		Spec struct {
+			ClusterIP  string   `json:"clusterIP"`
+			ClusterIPs []string `json:"clusterIPs"`
+		} `json:"spec"`
+	} `json:"items"`
+}
+
+// Services returns the services annotated with namedot.name and their
+// cluster IPs. Headless services have none and are skipped.
+func (k *Kubernetes) Services(ctx context.Context) ([]Service, error) {
+	path := "/api/v1/services"
+	if k.namespace != "" {
+		path = "/api/v1/namespaces/" + url.PathEscape(k.namespace) + "/services"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.base+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token, err := os.ReadFile(k.tokenFile); err == nil {
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	} else if !os.IsNotExist(err) || k.tokenFile != kubeTokenFile {
+		return nil, fmt.Errorf("kubernetes: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("kubernetes: list services: %s", resp.Status)
+	}
+	var list kubeServiceList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("kubernetes: %w", err)
+	}
+	var out []Service
+	for _, item := range list.Items {
+		ann := item.Metadata.Annotations
+		if ann[LabelName] == "" {
+			continue
+		}
+		svc := Service{Source: item.Metadata.Namespace + "/" + item.Metadata.Name, Name: ann[LabelName], SRV: ann[LabelSRV]}
+		ips := item.Spec.ClusterIPs
+		if len(ips) == 0 && item.Spec.ClusterIP != "" {
+			ips = []string{item.Spec.ClusterIP}
+		}
+		for _, s := range ips {
+			if ip, err := netip.ParseAddr(s); err == nil {
+				svc.IPs = append(svc.IPs, ip.Unmap())
+			}
+		}
+		if len(svc.IPs) == 0 {
+			continue
+		}
+		out = append(out, svc)
+	}
+	return out, nil
+}
@@ -0,0 +1,151 @@
+package dnstap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fields decodes a protobuf message into its fields: varints as uint64,
+// length-delimited ones as []byte and fixed32 as uint32.
+func fields(t *testing.T, b []byte) map[uint64]any {
+	t.Helper()
+	out := map[uint64]any{}
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatalf("bad tag in %x", b)
+		}
+		b = b[n:]
+		switch tag & 7 {
+		case wireVarint:
+			v, n := binary.Uvarint(b)
+			out[tag>>3], b = v, b[n:]
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			out[tag>>3], b = b[n:n+int(l)], b[n+int(l):]
+		case wireFixed32:
+			out[tag>>3], b = binary.LittleEndian.Uint32(b), b[4:]
+		default:
+			t.Fatalf("unexpected wire type %d", tag&7)
+		}
+	}
+	return out
+}
+
+func TestEncode(t *testing.T) {
+	at := time.Unix(1760659200, 123)
+	b := encode("fra-1", "namedot dev", Message{
+		Type:         ClientResponse,
+		QueryAddr:    &net.UDPAddr{IP: net.ParseIP("192.0.2.7"), Port: 40000},
+		ResponseAddr: &net.UDPAddr{IP: net.ParseIP("198.51.100.1"), Port: 53},
+		QueryTime:    at,
+		ResponseTime: at,
+		Response:     []byte{1, 2, 3},
+	})
+	top := fields(t, b)
+	if string(top[fieldIdentity].([]byte)) != "fra-1" || string(top[fieldVersion].([]byte)) != "namedot dev" || top[fieldType] != uint64(dnstapMessage) {
+		t.Fatalf("dnstap fields: %v", top)
+	}
+	m := fields(t, top[fieldMessage].([]byte))
+	if m[fieldMsgType] != uint64(ClientResponse) || m[fieldSocketFamily] != uint64(familyINET) || m[fieldSocketProtocol] != uint64(protoUDP) {
+		t.Fatalf("message type/family/protocol: %v", m)
+	}
+	if !bytes.Equal(m[fieldQueryAddress].([]byte), []byte{192, 0, 2, 7}) || m[fieldQueryPort] != uint64(40000) || m[fieldResponsePort] != uint64(53) {
+		t.Fatalf("addresses: %v", m)
+	}
+	if m[fieldResponseTimeSec] != uint64(1760659200) || m[fieldResponseTimeNsec] != uint32(123) || !bytes.Equal(m[fieldResponseMessage].([]byte), []byte{1, 2, 3}) {
+		t.Fatalf("response: %v", m)
+	}
+	if _, ok := m[fieldQueryMessage]; ok {
+		t.Fatalf("query message without a query: %v", m)
+	}
+}
+
+// collector accepts one Frame Streams connection on socket and passes on
+// the data frames it gets; it answers STOP with FINISH.
+func collector(t *testing.T, socket string) <-chan []byte {
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	frames := make(chan []byte, 10)
+	go func() {
+		defer close(frames)
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if typ, err := readControl(conn); err != nil || typ != controlReady {
+			t.Errorf("want READY, got %d %v", typ, err)
+			return
+		}
+		if err := writeControl(conn, controlAccept); err != nil {
+			return
+		}
+		if typ, err := readControl(conn); err != nil || typ != controlStart {
+			t.Errorf("want START, got %d %v", typ, err)
+			return
+		}
+		for {
+			var hdr [4]byte
+			if _, err := io.ReadFull(conn, hdr[:]); err != nil {
+				return
+			}
+			n := binary.BigEndian.Uint32(hdr[:])
+			if n == 0 {
+				var l [4]byte
+				_, _ = io.ReadFull(conn, l[:])
+				body := make([]byte, binary.BigEndian.Uint32(l[:]))
+				_, _ = io.ReadFull(conn, body)
+				if binary.BigEndian.Uint32(body) == controlStop {
+					_ = writeControl(conn, controlFinish)
+				}
+				return
+			}
+			frame := make([]byte, n)
+			if _, err := io.ReadFull(conn, frame); err != nil {
+				return
+			}
+			frames <- frame
+		}
+	}()
+	return frames
+}
+
+func TestWriter(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "dnstap.sock")
+	frames := collector(t, socket)
+	w := New(socket, "fra-1", "namedot dev")
+	w.Send(Message{Type: ClientQuery, TCP: true, QueryAddr: &net.TCPAddr{IP: net.ParseIP("2001:db8::7"), Port: 40000}, QueryTime: time.Now(), Query: []byte{9}})
+
+	select {
+	case f := <-frames:
+		m := fields(t, fields(t, f)[fieldMessage].([]byte))
+		if m[fieldMsgType] != uint64(ClientQuery) || m[fieldSocketFamily] != uint64(familyINET6) || m[fieldSocketProtocol] != uint64(protoTCP) {
+			t.Fatalf("frame: %v", m)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no frame")
+	}
+	w.Close()
+	if _, ok := <-frames; ok {
+		t.Fatal("unexpected frame after close")
+	}
+}
+
+func TestWriter_NoCollector(t *testing.T) {
+	before := droppedTotal.Value()
+	w := New(filepath.Join(t.TempDir(), "missing.sock"), "", "")
+	w.Send(Message{Type: ClientQuery})
+	w.Close()
+	if droppedTotal.Value() != before+1 {
+		t.Fatalf("dropped %v, want %v", droppedTotal.Value(), before+1)
+	}
+}
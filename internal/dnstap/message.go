@@ -0,0 +1,168 @@
+// Package dnstap sends DNS messages as dnstap protobuf frames
+// (https://dnstap.info) over a Frame Streams unix socket, for collectors
+// such as the dnstap tool, Vector or fluent-bit.
+package dnstap
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"time"
+)
+
+// MessageType is the dnstap Message.Type.
+type MessageType uint64
+
+// The message types sent by a server to its clients.
+const (
+	ClientQuery    MessageType = 5
+	ClientResponse MessageType = 6
+)
+
+// Message is a dnstap Message: a query or response with its addresses.
+type Message struct {
+	Type         MessageType
+	TCP          bool
+	QueryAddr    net.Addr // the client
+	ResponseAddr net.Addr // this server
+	QueryTime    time.Time
+	Query        []byte // wire format
+	ResponseTime time.Time
+	Response     []byte // wire format
+}
+
+// Protobuf field numbers of dnstap.proto.
+const (
+	fieldIdentity = 1
+	fieldVersion  = 2
+	fieldMessage  = 14
+	fieldType     = 15
+
+	fieldMsgType          = 1
+	fieldSocketFamily     = 2
+	fieldSocketProtocol   = 3
+	fieldQueryAddress     = 4
+	fieldResponseAddress  = 5
+	fieldQueryPort        = 6
+	fieldResponsePort     = 7
+	fieldQueryTimeSec     = 8
+	fieldQueryTimeNsec    = 9
+	fieldQueryMessage     = 10
+	fieldResponseTimeSec  = 12
+	fieldResponseTimeNsec = 13
+	fieldResponseMessage  = 14
+)
+
+// dnstapMessage is Dnstap.Type MESSAGE, the only one there is.
+const dnstapMessage = 1
+
+// Socket families and protocols of dnstap.proto.
+const (
+	familyINET  = 1
+	familyINET6 = 2
+	protoUDP    = 1
+	protoTCP    = 2
+)
+
+// encode returns m as a Dnstap protobuf message.
+func encode(identity, version string, m Message) []byte {
+	var msg []byte
+	msg = appendVarintField(msg, fieldMsgType, uint64(m.Type))
+	qa, qport := addrPort(m.QueryAddr)
+	ra, rport := addrPort(m.ResponseAddr)
+	if family := familyOf(qa, ra); family != 0 {
+		msg = appendVarintField(msg, fieldSocketFamily, family)
+	}
+	proto := uint64(protoUDP)
+	if m.TCP {
+		proto = protoTCP
+	}
+	msg = appendVarintField(msg, fieldSocketProtocol, proto)
+	if qa.IsValid() {
+		msg = appendBytesField(msg, fieldQueryAddress, qa.AsSlice())
+		msg = appendVarintField(msg, fieldQueryPort, uint64(qport))
+	}
+	if ra.IsValid() {
+		msg = appendBytesField(msg, fieldResponseAddress, ra.AsSlice())
+		msg = appendVarintField(msg, fieldResponsePort, uint64(rport))
+	}
+	if !m.QueryTime.IsZero() {
+		msg = appendVarintField(msg, fieldQueryTimeSec, uint64(m.QueryTime.Unix()))
+		msg = appendFixed32Field(msg, fieldQueryTimeNsec, uint32(m.QueryTime.Nanosecond()))
+	}
+	if m.Query != nil {
+		msg = appendBytesField(msg, fieldQueryMessage, m.Query)
+	}
+	if !m.ResponseTime.IsZero() {
+		msg = appendVarintField(msg, fieldResponseTimeSec, uint64(m.ResponseTime.Unix()))
+		msg = appendFixed32Field(msg, fieldResponseTimeNsec, uint32(m.ResponseTime.Nanosecond()))
+	}
+	if m.Response != nil {
+		msg = appendBytesField(msg, fieldResponseMessage, m.Response)
+	}
+
+	var b []byte
+	if identity != "" {
+		b = appendBytesField(b, fieldIdentity, []byte(identity))
+	}
+	if version != "" {
+		b = appendBytesField(b, fieldVersion, []byte(version))
+	}
+	b = appendBytesField(b, fieldMessage, msg)
+	return appendVarintField(b, fieldType, dnstapMessage)
+}
+
+// addrPort returns the address and port of a UDP or TCP address.
+func addrPort(a net.Addr) (netip.Addr, uint16) {
+	var ip net.IP
+	var port int
+	switch v := a.(type) {
+	case *net.UDPAddr:
+		ip, port = v.IP, v.Port
+	case *net.TCPAddr:
+		ip, port = v.IP, v.Port
+	}
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return netip.Addr{}, 0
+	}
+	return addr.Unmap(), uint16(port)
+}
+
+// familyOf returns the socket family of the first valid address, 0 if none
+// is.
+func familyOf(addrs ...netip.Addr) uint64 {
+	for _, a := range addrs {
+		if a.Is4() {
+			return familyINET
+		}
+		if a.Is6() {
+			return familyINET6
+		}
+	}
+	return 0
+}
+
+// Protobuf wire types.
+const (
+	wireVarint  = 0
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+func appendTag(b []byte, field, wire uint64) []byte {
+	return binary.AppendUvarint(b, field<<3|wire)
+}
+
+func appendVarintField(b []byte, field, v uint64) []byte {
+	return binary.AppendUvarint(appendTag(b, field, wireVarint), v)
+}
+
+func appendBytesField(b []byte, field uint64, v []byte) []byte {
+	b = binary.AppendUvarint(appendTag(b, field, wireBytes), uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendFixed32Field(b []byte, field uint64, v uint32) []byte {
+	return binary.LittleEndian.AppendUint32(appendTag(b, field, wireFixed32), v)
+}
@@ -0,0 +1,253 @@
+package dnstap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"namedot/internal/metrics"
+)
+
+// contentType names the payload of the frame stream.
+const contentType = "protobuf:dnstap.Dnstap"
+
+// Frame Streams control frame types and fields.
+const (
+	controlAccept    = 0x01
+	controlStart     = 0x02
+	controlStop      = 0x03
+	controlReady     = 0x04
+	controlFinish    = 0x05
+	fieldContentType = 0x01
+)
+
+// maxControlFrame bounds control frames read from the collector.
+const maxControlFrame = 512
+
+// queueSize bounds the frames waiting to be sent; more are dropped so a slow
+// or missing collector never holds up DNS answers.
+const queueSize = 10000
+
+// Timeouts of the collector connection.
+const (
+	dialTimeout      = 2 * time.Second
+	handshakeTimeout = 5 * time.Second
+	writeTimeout     = 5 * time.Second
+	maxRetryDelay    = 30 * time.Second
+)
+
+var droppedTotal = metrics.NewCounter("namedot_dnstap_dropped_total",
+	"dnstap frames not sent because the queue was full or the collector was unreachable.")
+
+// Writer sends messages to a dnstap collector listening on a unix socket,
+// reconnecting when the connection is lost.
+type Writer struct {
+	socket   string
+	identity string
+	version  string
+	queue    chan []byte
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// New starts sending the messages passed to Send to the collector at
+// socket. identity and version name this server in every frame.
+func New(socket, identity, version string) *Writer {
+	w := &Writer{
+		socket: socket, identity: identity, version: version,
+		queue: make(chan []byte, queueSize),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Send queues m. It never blocks: when the queue is full m is dropped and
+// counted.
+func (w *Writer) Send(m Message) {
+	select {
+	case w.queue <- encode(w.identity, w.version, m):
+	default:
+		droppedTotal.Inc()
+	}
+}
+
+// Close sends the queued frames, if connected, and ends the stream.
+func (w *Writer) Close() {
+	w.stopOnce.Do(func() { close(w.stop) })
+	<-w.done
+}
+
+// run connects to the collector and sends frames until Close, waiting
+// longer after each failed attempt.
+func (w *Writer) run() {
+	defer close(w.done)
+	delay := time.Second
+	connected := true // so the first failure is logged
+	for {
+		conn, err := w.connect()
+		if err == nil {
+			log.Printf("dnstap: connected to %s", w.socket)
+			connected, delay = true, time.Second
+			err = w.stream(conn)
+			if err == nil {
+				return
+			}
+		}
+		if connected {
+			log.Printf("dnstap: %s: %v; retrying", w.socket, err)
+			connected = false
+		}
+		timer := time.NewTimer(delay)
+		for waiting := true; waiting; {
+			select {
+			case <-w.stop:
+				timer.Stop()
+				w.dropQueued()
+				return
+			case <-w.queue:
+				// Nothing to send it to
+				droppedTotal.Inc()
+			case <-timer.C:
+				waiting = false
+			}
+		}
+		delay = min(delay*2, maxRetryDelay)
+	}
+}
+
+// dropQueued counts the frames still queued as dropped.
+func (w *Writer) dropQueued() {
+	for {
+		select {
+		case <-w.queue:
+			droppedTotal.Inc()
+		default:
+			return
+		}
+	}
+}
+
+// connect opens the socket and does the bidirectional Frame Streams
+// handshake: READY, ACCEPT from the collector, then START.
+func (w *Writer) connect() (net.Conn, error) {
+	conn, err := net.DialTimeout("unix", w.socket, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	if err := writeControl(conn, controlReady); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	typ, err := readControl(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if typ != controlAccept {
+		conn.Close()
+		return nil, fmt.Errorf("expected ACCEPT from the collector, got control frame %d", typ)
+	}
+	if err := writeControl(conn, controlStart); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// stream sends queued frames on conn until Close, when it ends the stream
+// with STOP and waits for FINISH, and returns nil; or until a write fails.
+func (w *Writer) stream(conn net.Conn) error {
+	defer conn.Close()
+	bw := bufio.NewWriter(conn)
+	send := func(frame []byte) error {
+		_ = conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if err := writeFrame(bw, frame); err != nil {
+			return err
+		}
+		if len(w.queue) == 0 {
+			return bw.Flush()
+		}
+		return nil
+	}
+	for {
+		select {
+		case frame := <-w.queue:
+			if err := send(frame); err != nil {
+				droppedTotal.Inc()
+				return err
+			}
+		case <-w.stop:
+			for len(w.queue) > 0 {
+				if err := send(<-w.queue); err != nil {
+					w.dropQueued()
+					return nil
+				}
+			}
+			_ = conn.SetDeadline(time.Now().Add(time.Second))
+			if bw.Flush() == nil && writeControl(conn, controlStop) == nil {
+				if typ, err := readControl(conn); err != nil || typ != controlFinish {
+					log.Printf("dnstap: %s: no FINISH after STOP", w.socket)
+				}
+			}
+			return nil
+		}
+	}
+}
+
+// writeFrame writes a data frame: its length, then the payload.
+func writeFrame(wr io.Writer, frame []byte) error {
+	var hdr [4]byte
+	binary.BigEndian.PutUint32(hdr[:], uint32(len(frame)))
+	if _, err := wr.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := wr.Write(frame)
+	return err
+}
+
+// writeControl writes a control frame of type typ; all but STOP carry the
+// content type.
+func writeControl(wr io.Writer, typ uint32) error {
+	body := binary.BigEndian.AppendUint32(nil, typ)
+	if typ != controlStop {
+		body = binary.BigEndian.AppendUint32(body, fieldContentType)
+		body = binary.BigEndian.AppendUint32(body, uint32(len(contentType)))
+		body = append(body, contentType...)
+	}
+	b := binary.BigEndian.AppendUint32(nil, 0) // escape: a zero-length data frame
+	b = binary.BigEndian.AppendUint32(b, uint32(len(body)))
+	_, err := wr.Write(append(b, body...))
+	return err
+}
+
+// readControl reads a control frame and returns its type; its fields are
+// not needed.
+func readControl(r io.Reader) (uint32, error) {
+	var hdr [8]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, err
+	}
+	if binary.BigEndian.Uint32(hdr[:4]) != 0 {
+		return 0, errors.New("expected a control frame")
+	}
+	n := binary.BigEndian.Uint32(hdr[4:])
+	if n < 4 || n > maxControlFrame {
+		return 0, fmt.Errorf("invalid control frame length %d", n)
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(body[:4]), nil
+}
@@ -0,0 +1,39 @@
+package geoip
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCodeTablesSorted(t *testing.T) {
+	for name, list := range map[string][]Code{"countries": Countries, "continents": Continents} {
+		if !sort.SliceIsSorted(list, func(i, j int) bool { return list[i].Code < list[j].Code }) {
+			t.Errorf("%s are not sorted by code", name)
+		}
+	}
+}
+
+func TestCheckCountry(t *testing.T) {
+	for _, code := range []string{"GB", "gb", "XK", "US"} {
+		if err := CheckCountry(code); err != nil {
+			t.Errorf("CheckCountry(%q): %v", code, err)
+		}
+	}
+	err := CheckCountry("uk")
+	if err == nil || !strings.Contains(err.Error(), `use "GB"`) {
+		t.Errorf("CheckCountry(uk) = %v, want a hint to GB", err)
+	}
+	if err := CheckCountry("ZZ"); err == nil {
+		t.Error("CheckCountry(ZZ) succeeded")
+	}
+}
+
+func TestCheckContinent(t *testing.T) {
+	if err := CheckContinent("eu"); err != nil {
+		t.Errorf("CheckContinent(eu): %v", err)
+	}
+	if err := CheckContinent("EUR"); err == nil {
+		t.Error("CheckContinent(EUR) succeeded")
+	}
+}
@@ -10,6 +10,7 @@ import (
     "os"
     "path/filepath"
     "strings"
+    "sync"
     "sync/atomic"
     "time"
 
@@ -33,6 +34,19 @@ func (noop) Lookup(ip netip.Addr) Info { return Info{} }
 
 func NewNoop() Provider { return noop{} }
 
+// ReloadResult is the outcome of a Reload.
+type ReloadResult struct {
+    Downloaded    bool                 `json:"downloaded"`
+    DownloadError string               `json:"download_error,omitempty"`
+    Databases     map[string]time.Time `json:"databases"` // build time by slot
+}
+
+// Reloader is implemented by providers that can reload their databases on
+// demand.
+type Reloader interface {
+    Reload(download bool) (ReloadResult, error)
+}
+
 // dbReader wraps both geoip2 and maxminddb readers
 type dbReader struct {
     geoip2Reader *geoip2.Reader
@@ -91,6 +105,11 @@ type maxmind struct {
     country6 atomic.Value // *dbReader
     asn4     atomic.Value // *dbReader
     asn6     atomic.Value // *dbReader
+
+    mu           sync.Mutex   // serializes loads
+    dlMu         sync.Mutex   // serializes downloads
+    load         func() error // reopens the databases at path
+    downloadURLs []string     // set when periodic downloads are enabled
 }
 
 // NewFromPath loads GeoIP databases. If path is a directory, loads all .mmdb files inside.
@@ -100,12 +119,12 @@ type maxmind struct {
 func NewFromPath(path string, reload time.Duration, downloadURLs []string, downloadInterval time.Duration) (Provider, func(), error) {
     m := &maxmind{path: path}
     load := func() error {
-        // Close previous
-        for _, v := range []atomic.Value{m.country4, m.country6, m.asn4, m.asn6} {
-            if r, ok := v.Load().(*dbReader); ok && r != nil {
-                _ = r.Close()
-            }
-        }
+        m.mu.Lock()
+        defer m.mu.Unlock()
+        // The previous databases are closed once the new ones are in place,
+        // so a failed load keeps serving them
+        old := m.slots()
+        var c4, c6, a4, a6 *dbReader
 
         fi, err := os.Stat(path)
         if err != nil {
@@ -157,18 +176,18 @@ func NewFromPath(path string, reload time.Duration, downloadURLs []string, downl
 
                 if isASN {
                     if is6Hint {
-                        m.asn6.Store(reader)
+                        a6 = reader
                         log.Printf("GeoIP: loaded ASN IPv6 DB %s", full)
                     } else {
-                        m.asn4.Store(reader)
+                        a4 = reader
                         log.Printf("GeoIP: loaded ASN IPv4 DB %s", full)
                     }
                 } else if isCountry {
                     if is6Hint {
-                        m.country6.Store(reader)
+                        c6 = reader
                         log.Printf("GeoIP: loaded Country IPv6 DB %s", full)
                     } else {
-                        m.country4.Store(reader)
+                        c4 = reader
                         log.Printf("GeoIP: loaded Country IPv4 DB %s", full)
                     }
                 } else {
@@ -177,24 +196,24 @@ func NewFromPath(path string, reload time.Duration, downloadURLs []string, downl
             }
             // Universal MMDB (IPVersion=6) supports both IPv4+IPv6
             // Use loaded DBs as fallback for missing IP version
-            if m.country4.Load() == nil && m.country6.Load() != nil {
-                m.country4.Store(m.country6.Load())
+            if c4 == nil && c6 != nil {
+                c4 = c6
                 log.Printf("GeoIP: using IPv6 Country DB as fallback for IPv4")
             }
-            if m.country6.Load() == nil && m.country4.Load() != nil {
-                m.country6.Store(m.country4.Load())
+            if c6 == nil && c4 != nil {
+                c6 = c4
                 log.Printf("GeoIP: using IPv4 Country DB as fallback for IPv6")
             }
-            if m.asn4.Load() == nil && m.asn6.Load() != nil {
-                m.asn4.Store(m.asn6.Load())
+            if a4 == nil && a6 != nil {
+                a4 = a6
                 log.Printf("GeoIP: using IPv6 ASN DB as fallback for IPv4")
             }
-            if m.asn6.Load() == nil && m.asn4.Load() != nil {
-                m.asn6.Store(m.asn4.Load())
+            if a6 == nil && a4 != nil {
+                a6 = a4
                 log.Printf("GeoIP: using IPv4 ASN DB as fallback for IPv6")
             }
             // if none loaded, error
-            if m.country4.Load() == nil && m.country6.Load() == nil && m.asn4.Load() == nil && m.asn6.Load() == nil {
+            if c4 == nil && a4 == nil {
                 return errors.New("no geoip databases loaded")
             }
         } else {
@@ -213,14 +232,32 @@ func NewFromPath(path string, reload time.Duration, downloadURLs []string, downl
                 return fmt.Errorf("open %s: %w", path, err)
             }
             // Use as both country4 and country6
-            m.country4.Store(reader)
-            m.country6.Store(reader)
+            c4 = reader
+            c6 = reader
         }
+        m.country4.Store(c4)
+        m.country6.Store(c6)
+        m.asn4.Store(a4)
+        m.asn6.Store(a6)
+        inUse := map[*dbReader]bool{}
+        for _, r := range m.slots() {
+            inUse[r] = true
+        }
+        for _, r := range old {
+            if !inUse[r] {
+                inUse[r] = true // fallbacks share a reader between slots
+                _ = r.Close()
+            }
+        }
+        m.exportBuildTimes()
         return nil
     }
 
+    m.load = load
+
     // Initial download if configured
     if downloadInterval > 0 && len(downloadURLs) > 0 {
+        m.downloadURLs = downloadURLs
         log.Printf("GeoIP: auto-download enabled (interval: %v)", downloadInterval)
         // Check if mmdb files exist, if not - download immediately
         if _, err := os.Stat(path); os.IsNotExist(err) {
@@ -282,7 +319,7 @@ func NewFromPath(path string, reload time.Duration, downloadURLs []string, downl
             select {
             case <-ticker.C:
                 log.Printf("GeoIP: periodic download triggered")
-                if err := downloadMMDB(downloadURLs, path); err != nil {
+                if err := m.download(); err != nil {
                     log.Printf("GeoIP: download error: %v", err)
                 }
                 // Trigger reload after download
@@ -298,6 +335,37 @@ func NewFromPath(path string, reload time.Duration, downloadURLs []string, downl
     return m, func() { close(stop) }, nil
 }
 
+func (m *maxmind) download() error {
+    m.dlMu.Lock()
+    defer m.dlMu.Unlock()
+    return downloadMMDB(m.downloadURLs, m.path)
+}
+
+// Reload reopens the databases at once, without waiting for the reload or
+// download interval. When download is set and periodic downloads are
+// configured, the databases are downloaded first; a failed download is
+// reported in the result and whatever is on disk is loaded anyway.
+func (m *maxmind) Reload(download bool) (ReloadResult, error) {
+    var res ReloadResult
+    if download && len(m.downloadURLs) > 0 {
+        log.Printf("GeoIP: download requested")
+        if err := m.download(); err != nil {
+            res.DownloadError = err.Error()
+        } else {
+            res.Downloaded = true
+        }
+    }
+    log.Printf("GeoIP: reload requested")
+    if err := m.load(); err != nil {
+        return res, err
+    }
+    res.Databases = map[string]time.Time{}
+    for slot, r := range m.slots() {
+        res.Databases[slot] = time.Unix(int64(r.buildEpoch()), 0).UTC()
+    }
+    return res, nil
+}
+
 func (m *maxmind) readerFor(ip netip.Addr, which string) *dbReader {
     v6 := ip.Is6()
     switch which {
@@ -465,5 +533,41 @@ func downloadMMDB(urls []string, targetDir string) error {
     }
 
     log.Printf("GeoIP: download completed: %d successful, %d failed", downloaded, failed)
+    if failed > 0 {
+        return fmt.Errorf("%d of %d downloads failed", failed, len(urls))
+    }
     return nil
 }
+
+// ModTime returns the modification time of the newest .mmdb file at path,
+// which may be a single database file or a directory as in NewFromPath.
+func ModTime(path string) (time.Time, error) {
+    fi, err := os.Stat(path)
+    if err != nil {
+        return time.Time{}, err
+    }
+    if !fi.IsDir() {
+        return fi.ModTime(), nil
+    }
+    entries, err := os.ReadDir(path)
+    if err != nil {
+        return time.Time{}, err
+    }
+    var newest time.Time
+    for _, e := range entries {
+        if e.IsDir() || !strings.HasSuffix(strings.ToLower(e.Name()), ".mmdb") {
+            continue
+        }
+        info, err := e.Info()
+        if err != nil {
+            continue
+        }
+        if info.ModTime().After(newest) {
+            newest = info.ModTime()
+        }
+    }
+    if newest.IsZero() {
+        return time.Time{}, fmt.Errorf("no .mmdb files in %s", path)
+    }
+    return newest, nil
+}
@@ -2,7 +2,10 @@ package geoip
 
 import (
 	"net/netip"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestNewNoop(t *testing.T) {
@@ -237,3 +240,90 @@ func BenchmarkContinentFromCountry_Fallback(b *testing.B) {
 		continentFromCountry(countryCode)
 	}
 }
+
+func TestModTime(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := ModTime(dir); err == nil {
+		t.Fatal("expected error for directory without .mmdb files")
+	}
+
+	older := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	newer := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for name, mt := range map[string]time.Time{"country.mmdb": older, "asn.mmdb": newer, "notes.txt": time.Now()} {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, mt, mt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := ModTime(dir)
+	if err != nil {
+		t.Fatalf("ModTime: %v", err)
+	}
+	if !got.Equal(newer) {
+		t.Fatalf("expected newest .mmdb time %v, got %v", newer, got)
+	}
+	got, err = ModTime(filepath.Join(dir, "country.mmdb"))
+	if err != nil || !got.Equal(older) {
+		t.Fatalf("single file: %v %v", got, err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"city-localhost.mmdb", "asn-localhost.mmdb"} {
+		data, err := os.ReadFile(filepath.Join("..", "..", "geoipdb", name))
+		if err != nil {
+			t.Skipf("test database %s: %v", name, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	provider, cleanup, err := NewFromPath(dir, 0, nil, 0)
+	defer cleanup()
+	if err != nil {
+		t.Fatalf("NewFromPath: %v", err)
+	}
+	r, ok := provider.(Reloader)
+	if !ok {
+		t.Fatal("MaxMind provider does not implement Reloader")
+	}
+	ip := netip.MustParseAddr("127.0.1.10")
+	want := provider.Lookup(ip)
+	if want.Country != "RU" || want.ASN != 65001 {
+		t.Fatalf("lookup before reload: %+v", want)
+	}
+
+	res, err := r.Reload(true)
+	if err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if res.Downloaded || len(res.Databases) != 4 || res.Databases["asn_v6"].IsZero() {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if got := provider.Lookup(ip); got != want {
+		t.Fatalf("lookup after reload: %+v", got)
+	}
+
+	// A failed reload keeps the loaded databases. Files are replaced by
+	// rename, as downloads do, since the loaded ones are mapped.
+	for _, name := range []string{"city-localhost.mmdb", "asn-localhost.mmdb"} {
+		tmp := filepath.Join(dir, name+".tmp")
+		if err := os.WriteFile(tmp, []byte("broken"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := r.Reload(false); err == nil {
+		t.Fatal("Reload of broken databases succeeded")
+	}
+	if got := provider.Lookup(ip); got != want {
+		t.Fatalf("lookup after failed reload: %+v", got)
+	}
+}
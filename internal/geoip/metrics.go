@@ -0,0 +1,61 @@
+package geoip
+
+import (
+	"fmt"
+	"time"
+
+	"namedot/internal/metrics"
+)
+
+// maxDBAge is how old a loaded database may get before the bundled alert
+// fires. MaxMind and DB-IP publish updates at least monthly.
+const maxDBAge = 30 * 24 * time.Hour
+
+var buildGauge = metrics.NewGauge("namedot_geoip_build_timestamp_seconds",
+	"Unix build time of the loaded GeoIP database, by slot (country_v4, country_v6, asn_v4, asn_v6).", "db")
+
+func init() {
+	metrics.AddAlert(metrics.Alert{
+		Name:     "NamedotGeoIPDatabaseOld",
+		Expr:     fmt.Sprintf("time() - %s > %d", buildGauge.Name(), int(maxDBAge.Seconds())),
+		For:      time.Hour,
+		Severity: "warning",
+		Summary:  "GeoIP database {{ $labels.db }} on {{ $labels.instance }} was built over 30 days ago",
+		Metrics:  []string{buildGauge.Name()},
+	})
+}
+
+// buildEpoch returns the Unix build time from the database metadata.
+func (r *dbReader) buildEpoch() uint {
+	switch {
+	case r.geoip2Reader != nil:
+		return r.geoip2Reader.Metadata().BuildEpoch
+	case r.rawReader != nil:
+		return r.rawReader.Metadata.BuildEpoch
+	}
+	return 0
+}
+
+// slots returns the loaded database of each slot (country_v4, country_v6,
+// asn_v4, asn_v6).
+func (m *maxmind) slots() map[string]*dbReader {
+	out := map[string]*dbReader{}
+	for db, v := range map[string]any{
+		"country_v4": m.country4.Load(),
+		"country_v6": m.country6.Load(),
+		"asn_v4":     m.asn4.Load(),
+		"asn_v6":     m.asn6.Load(),
+	} {
+		if r, ok := v.(*dbReader); ok && r != nil {
+			out[db] = r
+		}
+	}
+	return out
+}
+
+// exportBuildTimes sets the build time gauge for each loaded slot.
+func (m *maxmind) exportBuildTimes() {
+	for db, r := range m.slots() {
+		buildGauge.Set(float64(r.buildEpoch()), db)
+	}
+}
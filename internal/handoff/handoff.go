@@ -0,0 +1,118 @@
+// Package handoff lets a new namedot process take over the listening sockets
+// of a running one, so upgrades do not drop queries: the old process starts
+// the binary again with the sockets as extra files, waits until the new
+// process reports ready, then drains its own requests and exits.
+package handoff
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"namedot/internal/systemd"
+)
+
+const (
+	envNames = "NAMEDOT_LISTEN_FDNAMES" // names of the sockets passed from fd 3 on
+	envReady = "NAMEDOT_READY_FD"       // pipe the new process reports readiness on
+)
+
+// firstFD is the descriptor of the first passed socket, after stdio.
+const firstFD = 3
+
+// Listeners returns the sockets inherited from the previous process, or nil
+// when this process was not started by Start.
+func Listeners() []systemd.Socket {
+	v := os.Getenv(envNames)
+	os.Unsetenv(envNames)
+	if v == "" {
+		return nil
+	}
+	names := strings.Split(v, ":")
+	out := make([]systemd.Socket, 0, len(names))
+	for i, name := range names {
+		out = append(out, systemd.Socket{Name: name, File: os.NewFile(uintptr(firstFD+i), name)})
+	}
+	return out
+}
+
+// Ready tells the previous process that this one serves on the inherited
+// sockets, so it can shut down. It does nothing when there is no previous
+// process.
+func Ready() error {
+	v := os.Getenv(envReady)
+	os.Unsetenv(envReady)
+	if v == "" {
+		return nil
+	}
+	fd, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("%s=%q: %w", envReady, v, err)
+	}
+	f := os.NewFile(uintptr(fd), "handoff-ready")
+	defer f.Close()
+	_, err = f.Write([]byte{1})
+	return err
+}
+
+// Start runs the current executable (after an upgrade, the new binary) with
+// the same arguments, passing socks on, and waits up to timeout for it to
+// call Ready. On failure the new process is killed and the caller keeps
+// serving.
+func Start(socks []systemd.Socket, timeout time.Duration) (*os.Process, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	files := []*os.File{os.Stdin, os.Stdout, os.Stderr}
+	names := make([]string, 0, len(socks))
+	for _, s := range socks {
+		files = append(files, s.File)
+		names = append(names, s.Name)
+	}
+	files = append(files, w)
+	env := make([]string, 0, len(os.Environ())+2)
+	for _, kv := range os.Environ() {
+		// Socket activation and the watchdog belong to this process
+		if strings.HasPrefix(kv, "LISTEN_") || strings.HasPrefix(kv, "WATCHDOG_PID=") || strings.HasPrefix(kv, "NAMEDOT_") {
+			continue
+		}
+		env = append(env, kv)
+	}
+	env = append(env, envNames+"="+strings.Join(names, ":"), envReady+"="+strconv.Itoa(len(files)-1))
+
+	p, err := os.StartProcess(exe, os.Args, &os.ProcAttr{Env: env, Files: files})
+	w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1)
+		_, err := r.Read(buf)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			return p, nil
+		}
+		_ = p.Kill()
+		_, _ = p.Wait()
+		return nil, errors.New("new process exited before it was ready")
+	case <-time.After(timeout):
+		_ = p.Kill()
+		_, _ = p.Wait()
+		return nil, fmt.Errorf("new process not ready after %s", timeout)
+	}
+}
@@ -0,0 +1,60 @@
+package handoff
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"namedot/internal/systemd"
+)
+
+// TestMain doubles as the new process started by Start: it checks the
+// inherited socket and reports ready unless told to fail.
+func TestMain(m *testing.M) {
+	switch os.Getenv("HANDOFF_TEST_CHILD") {
+	case "ok":
+		socks := Listeners()
+		if len(socks) != 1 || socks[0].Name != "rest" {
+			os.Exit(2)
+		}
+		if _, err := net.FileListener(socks[0].File); err != nil {
+			os.Exit(3)
+		}
+		if err := Ready(); err != nil {
+			os.Exit(4)
+		}
+		os.Exit(0)
+	case "fail":
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+func TestStart(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("listen: %v", err)
+	}
+	defer ln.Close()
+	f, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("file: %v", err)
+	}
+	defer f.Close()
+	socks := []systemd.Socket{{Name: "rest", File: f}}
+
+	t.Setenv("HANDOFF_TEST_CHILD", "ok")
+	p, err := Start(socks, 10*time.Second)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if st, _ := p.Wait(); !st.Success() {
+		t.Fatalf("new process failed: %v", st)
+	}
+
+	t.Setenv("HANDOFF_TEST_CHILD", "fail")
+	if _, err := Start(socks, 10*time.Second); err == nil {
+		t.Fatal("expected an error when the new process exits without Ready")
+	}
+}
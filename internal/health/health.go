@@ -0,0 +1,247 @@
+// Package health probes the records that have a health check and tracks
+// which of them are healthy, so DNS answers can leave the others out.
+package health
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"namedot/internal/config"
+	dbm "namedot/internal/db"
+	"namedot/internal/metrics"
+)
+
+// maxParallel bounds the probes running at once.
+const maxParallel = 32
+
+var (
+	checksGauge = metrics.NewGauge("namedot_health_checks",
+		"Records with a health check, by state (healthy, unhealthy).", "state")
+	transitionsTotal = metrics.NewCounter("namedot_health_check_transitions_total",
+		"Records that changed health state, by new state.", "state")
+)
+
+// Status is the health of one record.
+type Status struct {
+	RecordID  uint      `json:"record_id"`
+	Zone      string    `json:"zone"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Data      string    `json:"data"`
+	Check     string    `json:"check"`
+	Healthy   bool      `json:"healthy"`
+	Since     time.Time `json:"since"`                // when the record got its current state
+	LastCheck time.Time `json:"last_check,omitempty"` // zero until the first probe
+	LatencyMs float64   `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"` // of the last probe
+}
+
+// target is a record to probe.
+type target struct {
+	ID          uint
+	Data        string
+	HealthCheck string
+	Name        string
+	Type        string
+	Zone        string
+}
+
+type state struct {
+	Status
+	fails, passes int // probes in a row with the other outcome than Healthy
+}
+
+// Checker probes the records and keeps their state. Records start healthy
+// and are only left out after health_checks.fall failed probes in a row.
+type Checker struct {
+	cfg   config.HealthChecksConfig
+	db    *gorm.DB
+	probe func(ctx context.Context, t target) error
+	now   func() time.Time
+
+	mu     sync.RWMutex
+	states map[uint]*state
+}
+
+// New returns a checker of the records in db.
+func New(cfg config.HealthChecksConfig, db *gorm.DB) *Checker {
+	c := &Checker{cfg: cfg, db: db, now: time.Now, states: make(map[uint]*state)}
+	c.probe = c.run
+	return c
+}
+
+// Run probes every interval_sec until ctx is done.
+func (c *Checker) Run(ctx context.Context) {
+	t := time.NewTicker(time.Duration(c.cfg.IntervalSec) * time.Second)
+	defer t.Stop()
+	for {
+		if err := c.CheckAll(ctx); err != nil {
+			log.Printf("health: load records: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Healthy reports whether the record with id may be served: it has no
+// check, has not been probed yet, or passes its check.
+func (c *Checker) Healthy(id uint) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	st, ok := c.states[id]
+	return !ok || st.Healthy
+}
+
+// Statuses returns the state of every checked record, by zone and name.
+func (c *Checker) Statuses() []Status {
+	c.mu.RLock()
+	out := make([]Status, 0, len(c.states))
+	for _, st := range c.states {
+		out = append(out, st.Status)
+	}
+	c.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Zone != b.Zone {
+			return a.Zone < b.Zone
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.RecordID < b.RecordID
+	})
+	return out
+}
+
+// CheckAll probes every record with a health check once. Records whose
+// check was removed or changed start over.
+func (c *Checker) CheckAll(ctx context.Context) error {
+	targets, err := c.load()
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	seen := make(map[uint]bool, len(targets))
+	for _, t := range targets {
+		seen[t.ID] = true
+		st, ok := c.states[t.ID]
+		if !ok || st.Check != t.HealthCheck || st.Data != t.Data {
+			c.states[t.ID] = &state{Status: Status{RecordID: t.ID, Check: t.HealthCheck, Healthy: true, Since: c.now()}}
+			st = c.states[t.ID]
+		}
+		st.Zone, st.Name, st.Type, st.Data = t.Zone, t.Name, t.Type, t.Data
+	}
+	for id := range c.states {
+		if !seen[id] {
+			delete(c.states, id)
+		}
+	}
+	c.mu.Unlock()
+
+	timeout := time.Duration(c.cfg.TimeoutMs) * time.Millisecond
+	sem := make(chan struct{}, maxParallel)
+	var wg sync.WaitGroup
+	for _, t := range targets {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(t target) {
+			defer func() { <-sem; wg.Done() }()
+			pctx, cancel := context.WithTimeout(ctx, timeout)
+			start := time.Now()
+			err := c.probe(pctx, t)
+			cancel()
+			c.record(t, err, time.Since(start))
+		}(t)
+	}
+	wg.Wait()
+	c.updateGauge()
+	return nil
+}
+
+// record applies the outcome of one probe of t.
+func (c *Checker) record(t target, err error, took time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st, ok := c.states[t.ID]
+	if !ok {
+		return
+	}
+	st.LastCheck = c.now()
+	st.LatencyMs = float64(took.Microseconds()) / 1000
+	st.Error = ""
+	if err != nil {
+		st.Error = err.Error()
+	}
+	switch {
+	case err != nil && st.Healthy:
+		st.passes = 0
+		if st.fails++; st.fails >= c.cfg.Fall {
+			c.transition(st, false)
+		}
+	case err == nil && !st.Healthy:
+		st.fails = 0
+		if st.passes++; st.passes >= c.cfg.Rise {
+			c.transition(st, true)
+		}
+	default:
+		st.fails, st.passes = 0, 0
+	}
+}
+
+func (c *Checker) transition(st *state, healthy bool) {
+	st.Healthy, st.Since = healthy, c.now()
+	st.fails, st.passes = 0, 0
+	name := stateName(healthy)
+	transitionsTotal.Inc(name)
+	if healthy {
+		log.Printf("health: %s %s %s (%s) is healthy again", st.Name, st.Type, st.Data, st.Check)
+	} else {
+		log.Printf("health: %s %s %s (%s) is unhealthy: %s", st.Name, st.Type, st.Data, st.Check, st.Error)
+	}
+}
+
+func (c *Checker) updateGauge() {
+	c.mu.RLock()
+	var up, down int
+	for _, st := range c.states {
+		if st.Healthy {
+			up++
+		} else {
+			down++
+		}
+	}
+	c.mu.RUnlock()
+	checksGauge.Set(float64(up), stateName(true))
+	checksGauge.Set(float64(down), stateName(false))
+}
+
+func stateName(healthy bool) string {
+	if healthy {
+		return "healthy"
+	}
+	return "unhealthy"
+}
+
+// load returns the enabled records with a health check in zones that are
+// served.
+func (c *Checker) load() ([]target, error) {
+	var targets []target
+	err := c.db.Model(&dbm.RData{}).
+		Select("r_data.id, r_data.data, r_data.health_check, rr_sets.name, rr_sets.type, zones.name AS zone").
+		Joins("JOIN rr_sets ON rr_sets.id = r_data.rr_set_id AND rr_sets.deleted_at IS NULL").
+		Joins("JOIN zones ON zones.id = rr_sets.zone_id AND zones.deleted_at IS NULL AND zones.disabled = ?", false).
+		Where("r_data.health_check IS NOT NULL AND r_data.health_check <> '' AND r_data.disabled = ?", false).
+		Scan(&targets).Error
+	return targets, err
+}
@@ -0,0 +1,153 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"namedot/internal/config"
+	dbm "namedot/internal/db"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err := dbm.AutoMigrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+func strPtr(s string) *string { return &s }
+
+// addRecords creates zone example.com. with an A RRSet holding ips, each
+// with the health check of the same index ("" for none).
+func addRecords(t *testing.T, db *gorm.DB, ips, checks []string) []dbm.RData {
+	t.Helper()
+	zone := dbm.Zone{Name: "example.com."}
+	if err := db.Create(&zone).Error; err != nil {
+		t.Fatalf("create zone: %v", err)
+	}
+	rr := dbm.RRSet{ZoneID: zone.ID, Name: "www.example.com.", Type: "A", TTL: 60}
+	for i, ip := range ips {
+		rec := dbm.RData{Data: ip}
+		if checks[i] != "" {
+			rec.HealthCheck = strPtr(checks[i])
+		}
+		rr.Records = append(rr.Records, rec)
+	}
+	if err := db.Create(&rr).Error; err != nil {
+		t.Fatalf("create rrset: %v", err)
+	}
+	return rr.Records
+}
+
+func TestChecker_FallRise(t *testing.T) {
+	db := newTestDB(t)
+	recs := addRecords(t, db, []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"}, []string{"tcp://:443", "icmp", ""})
+	c := New(config.HealthChecksConfig{Enabled: true, TimeoutMs: 100, Fall: 2, Rise: 2}, db)
+	down := map[string]bool{"192.0.2.1": true}
+	c.probe = func(_ context.Context, tg target) error {
+		if down[tg.Data] {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+	check := func() {
+		t.Helper()
+		if err := c.CheckAll(context.Background()); err != nil {
+			t.Fatalf("check: %v", err)
+		}
+	}
+
+	check()
+	if !c.Healthy(recs[0].ID) {
+		t.Fatal("unhealthy after one failure with fall 2")
+	}
+	check()
+	if c.Healthy(recs[0].ID) || !c.Healthy(recs[1].ID) || !c.Healthy(recs[2].ID) {
+		t.Fatalf("states after two failures: %+v", c.Statuses())
+	}
+	if st := c.Statuses(); len(st) != 2 || st[0].Error != "connection refused" || st[0].Check != "tcp://:443" || st[0].Zone != "example.com." {
+		t.Fatalf("statuses: %+v", st)
+	}
+
+	down["192.0.2.1"] = false
+	check()
+	if c.Healthy(recs[0].ID) {
+		t.Fatal("healthy after one pass with rise 2")
+	}
+	check()
+	if !c.Healthy(recs[0].ID) {
+		t.Fatal("still unhealthy after two passes")
+	}
+
+	// A removed check forgets the record
+	if err := db.Model(&dbm.RData{}).Where("id = ?", recs[1].ID).Update("health_check", nil).Error; err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	check()
+	if st := c.Statuses(); len(st) != 1 || st[0].RecordID != recs[0].ID {
+		t.Fatalf("statuses after removing a check: %+v", st)
+	}
+}
+
+func TestChecker_SkipsDisabledZones(t *testing.T) {
+	db := newTestDB(t)
+	addRecords(t, db, []string{"192.0.2.1"}, []string{"icmp"})
+	if err := db.Model(&dbm.Zone{}).Where("name = ?", "example.com.").Update("disabled", true).Error; err != nil {
+		t.Fatalf("disable zone: %v", err)
+	}
+	c := New(config.HealthChecksConfig{Enabled: true, TimeoutMs: 100, Fall: 1, Rise: 1}, db)
+	c.probe = func(context.Context, target) error { return errors.New("down") }
+	if err := c.CheckAll(context.Background()); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if st := c.Statuses(); len(st) != 0 {
+		t.Fatalf("checked a record of a disabled zone: %+v", st)
+	}
+}
+
+func TestProbe_TCPAndHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if host, _, _ := net.SplitHostPort(r.Host); host != "www.example.com" {
+			t.Errorf("Host %q, want the owner name", r.Host)
+		}
+	}))
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+
+	c := New(config.HealthChecksConfig{}, nil)
+	for _, tc := range []struct {
+		check string
+		ok    bool
+	}{
+		{"tcp://:" + port, true},
+		{"http://:" + port + "/healthz", true},
+		{"http://:" + port + "/other", false},
+	} {
+		err := c.run(context.Background(), target{Data: "127.0.0.1", Type: "A", Name: "www.example.com.", HealthCheck: tc.check})
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: err %v, want ok %v", tc.check, err, tc.ok)
+		}
+	}
+
+	// Nothing listens on the port once the server is closed
+	srv.Close()
+	if err := c.run(context.Background(), target{Data: "127.0.0.1", Type: "A", HealthCheck: "tcp://:" + port}); err == nil {
+		t.Error("tcp check passed against a closed port")
+	}
+}
@@ -0,0 +1,172 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+
+	dbm "namedot/internal/db"
+)
+
+// run probes t with its check.
+func (c *Checker) run(ctx context.Context, t target) error {
+	hc, err := dbm.ParseHealthCheck(t.HealthCheck)
+	if err != nil {
+		return err
+	}
+	host, err := hc.Target(t.Type, t.Data)
+	if err != nil {
+		return err
+	}
+	switch hc.Kind {
+	case dbm.CheckTCP:
+		return probeTCP(ctx, net.JoinHostPort(host, hc.Port))
+	case dbm.CheckHTTP, dbm.CheckHTTPS:
+		return probeHTTP(ctx, hc, host, strings.TrimSuffix(t.Name, "."))
+	default:
+		return probeICMP(ctx, host)
+	}
+}
+
+func probeTCP(ctx context.Context, addr string) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// probeHTTP sends a GET to host; a 2xx or 3xx status passes. Without a host
+// in the check, the record's address is dialed with the owner name as Host
+// and TLS server name, as a client of the name would.
+func probeHTTP(ctx context.Context, hc dbm.HealthCheck, host, owner string) error {
+	name := hc.Host
+	if name == "" {
+		name = owner
+	}
+	dial := net.JoinHostPort(host, hc.Port)
+	var d net.Dialer
+	tr := &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return d.DialContext(ctx, network, dial)
+		},
+		TLSClientConfig:   &tls.Config{ServerName: name},
+		DisableKeepAlives: true,
+	}
+	defer tr.CloseIdleConnections()
+	client := &http.Client{
+		Transport:     tr,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, hc.Kind+"://"+net.JoinHostPort(name, hc.Port)+hc.Path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "namedot-health-check")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// probeICMP sends an echo request to host and waits for the reply. It uses
+// an unprivileged ping socket, which Linux allows to the groups in
+// net.ipv4.ping_group_range, and falls back to a raw socket as root.
+func probeICMP(ctx context.Context, host string) error {
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return err
+	}
+	if len(addrs) == 0 {
+		return fmt.Errorf("%s has no address", host)
+	}
+	ip := addrs[0].Unmap()
+	network, raw, proto := "udp4", "ip4:icmp", 1
+	var echo, reply icmp.Type = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	if ip.Is6() {
+		network, raw, proto = "udp6", "ip6:ipv6-icmp", 58
+		echo, reply = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+	}
+	var dst net.Addr = &net.UDPAddr{IP: ip.AsSlice(), Zone: ip.Zone()}
+	conn, err := icmp.ListenPacket(network, "")
+	if err != nil {
+		if conn, err = icmp.ListenPacket(raw, ""); err != nil {
+			return fmt.Errorf("icmp: %w (allow unprivileged ping with net.ipv4.ping_group_range)", err)
+		}
+		dst = &net.IPAddr{IP: ip.AsSlice(), Zone: ip.Zone()}
+	}
+	defer conn.Close()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(2 * time.Second)
+	}
+	_ = conn.SetDeadline(deadline)
+
+	token := make([]byte, 16)
+	_, _ = rand.Read(token)
+	seq := int(token[0])<<8 | int(token[1])
+	msg := icmp.Message{Type: echo, Body: &icmp.Echo{ID: int(token[2])<<8 | int(token[3]), Seq: seq, Data: token}}
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.WriteTo(b, dst); err != nil {
+		return err
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) || isTimeout(err) {
+				return fmt.Errorf("no echo reply from %s", ip)
+			}
+			return err
+		}
+		if !sameIP(from, ip) {
+			continue
+		}
+		m, err := icmp.ParseMessage(proto, buf[:n])
+		if err != nil || m.Type != reply {
+			continue
+		}
+		// The kernel sets the ID of unprivileged pings; the data identifies ours
+		if e, ok := m.Body.(*icmp.Echo); ok && e.Seq == seq && bytes.Equal(e.Data, token) {
+			return nil
+		}
+	}
+}
+
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+func sameIP(a net.Addr, ip netip.Addr) bool {
+	var got net.IP
+	switch v := a.(type) {
+	case *net.UDPAddr:
+		got = v.IP
+	case *net.IPAddr:
+		got = v.IP
+	}
+	addr, ok := netip.AddrFromSlice(got)
+	return ok && addr.Unmap() == ip.WithZone("")
+}
@@ -0,0 +1,63 @@
+package mailauth
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+
+	dbm "namedot/internal/db"
+)
+
+// Apply stores recs in zone, each replacing the TXT records it supersedes,
+// and reports whether anything changed. New TXT RRSets get ttl.
+func Apply(db *gorm.DB, zone dbm.Zone, recs []Record, ttl uint32) (bool, error) {
+	changed := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, rec := range recs {
+			var set dbm.RRSet
+			if err := tx.Preload("Records").Where("zone_id = ? AND name = ? AND type = ?", zone.ID, rec.Name, "TXT").Limit(1).Find(&set).Error; err != nil {
+				return err
+			}
+			if set.ID == 0 {
+				set = dbm.RRSet{ZoneID: zone.ID, Name: rec.Name, Type: "TXT", TTL: ttl}
+				if err := tx.Create(&set).Error; err != nil {
+					return err
+				}
+			}
+			keep := false
+			for _, old := range set.Records {
+				if old.Data == rec.Data && old.Country == nil && old.Continent == nil && old.ASN == nil && old.ASNs == nil && old.Subnet == nil {
+					keep = true
+					continue
+				}
+				if !supersedes(rec.Replaces, old.Data) {
+					continue
+				}
+				if err := tx.Unscoped().Delete(&dbm.RData{}, old.ID).Error; err != nil {
+					return err
+				}
+				changed = true
+			}
+			if keep {
+				continue
+			}
+			if err := tx.Create(&dbm.RData{RRSetID: set.ID, Data: rec.Data}).Error; err != nil {
+				return err
+			}
+			changed = true
+		}
+		return nil
+	})
+	return changed, err
+}
+
+// supersedes reports whether a record tagged replaces takes the place of
+// the stored TXT data.
+func supersedes(replaces, data string) bool {
+	if replaces == "" {
+		return true
+	}
+	txt := strings.ToLower(Unquote(data))
+	tag := strings.ToLower(replaces)
+	return txt == tag || strings.HasPrefix(txt, tag+" ")
+}
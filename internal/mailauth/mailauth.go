@@ -0,0 +1,378 @@
+// Package mailauth builds SPF, DKIM and DMARC TXT records from structured
+// input and checks them against the limits receivers enforce.
+package mailauth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Limits from RFC 7208 and common resolver behaviour.
+const (
+	MaxSPFLookups = 10  // DNS-querying SPF terms, includes followed
+	maxString     = 255 // bytes per TXT character-string
+	maxUDPRecord  = 450 // TXT data that still fits a plain 512-byte response
+)
+
+// ErrInvalid wraps every input error.
+var ErrInvalid = errors.New("invalid mail auth input")
+
+// SPF describes the senders of a domain.
+type SPF struct {
+	MX      bool     `json:"mx"`      // the domain's MX hosts
+	A       bool     `json:"a"`       // the domain's A/AAAA addresses
+	IP4     []string `json:"ip4"`     // addresses or CIDRs
+	IP6     []string `json:"ip6"`     // addresses or CIDRs
+	Include []string `json:"include"` // domains whose SPF is included, e.g. _spf.google.com
+	All     string   `json:"all"`     // -all (default), ~all, ?all
+}
+
+// DKIM is the public key of a signing selector.
+type DKIM struct {
+	Selector  string `json:"selector"`
+	KeyType   string `json:"key_type"`   // rsa (default) or ed25519
+	PublicKey string `json:"public_key"` // base64 or PEM
+	Testing   bool   `json:"testing"`    // t=y
+}
+
+// DMARC is the policy published for a domain.
+type DMARC struct {
+	Policy          string   `json:"policy"`           // none, quarantine or reject
+	SubdomainPolicy string   `json:"subdomain_policy"` // empty = same as policy
+	Percent         *int     `json:"percent"`          // 0-100, nil = 100
+	RUA             []string `json:"rua"`              // aggregate report addresses
+	RUF             []string `json:"ruf"`              // failure report addresses
+	ADKIM           string   `json:"adkim"`            // r or s, empty = r
+	ASPF            string   `json:"aspf"`             // r or s, empty = r
+}
+
+// Request selects the records to build; nil parts are skipped.
+type Request struct {
+	SPF   *SPF   `json:"spf"`
+	DKIM  *DKIM  `json:"dkim"`
+	DMARC *DMARC `json:"dmarc"`
+}
+
+// Record is a built TXT record. Replaces is the "v=" tag of the TXT
+// records at Name it supersedes; empty means all TXT records at Name.
+type Record struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Data     string `json:"data"`
+	Replaces string `json:"-"`
+}
+
+// Result is the built records with warnings that do not stop them from
+// being published.
+type Result struct {
+	Records  []Record `json:"records"`
+	Lookups  int      `json:"spf_lookups,omitempty"`
+	Warnings []string `json:"warnings"`
+}
+
+// Resolver looks up the TXT records of included SPF domains to count their
+// DNS lookups. net.DefaultResolver satisfies it.
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// Build returns the records for zone. With a nil resolver, lookups inside
+// included records are not counted.
+func Build(ctx context.Context, zone string, req Request, res Resolver) (Result, error) {
+	zone = dns.Fqdn(strings.ToLower(zone))
+	out := Result{Records: []Record{}, Warnings: []string{}}
+	if req.SPF == nil && req.DKIM == nil && req.DMARC == nil {
+		return out, fmt.Errorf("%w: nothing to build", ErrInvalid)
+	}
+	if req.SPF != nil {
+		txt, err := buildSPF(*req.SPF, &out.Warnings)
+		if err != nil {
+			return out, err
+		}
+		out.Lookups = countLookups(ctx, req.SPF, res, &out.Warnings)
+		if out.Lookups > MaxSPFLookups {
+			return out, fmt.Errorf("%w: spf needs %d DNS lookups, receivers allow %d", ErrInvalid, out.Lookups, MaxSPFLookups)
+		}
+		out.add(zone, txt, "v=spf1")
+	}
+	if req.DKIM != nil {
+		txt, name, err := buildDKIM(*req.DKIM, &out.Warnings)
+		if err != nil {
+			return out, err
+		}
+		out.add(name+"._domainkey."+zone, txt, "")
+	}
+	if req.DMARC != nil {
+		txt, err := buildDMARC(*req.DMARC, zone, &out.Warnings)
+		if err != nil {
+			return out, err
+		}
+		out.add("_dmarc."+zone, txt, "")
+	}
+	return out, nil
+}
+
+func (r *Result) add(name, txt, replaces string) {
+	if len(txt) > maxUDPRecord {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("%s: %d bytes of TXT data may not fit a UDP response without EDNS", name, len(txt)))
+	}
+	r.Records = append(r.Records, Record{Name: name, Type: "TXT", Data: Quote(txt), Replaces: replaces})
+}
+
+// Quote splits txt into quoted character-strings of at most 255 bytes, the
+// form TXT data is stored in.
+func Quote(txt string) string {
+	var parts []string
+	for len(txt) > maxString {
+		parts = append(parts, `"`+txt[:maxString]+`"`)
+		txt = txt[maxString:]
+	}
+	return strings.Join(append(parts, `"`+txt+`"`), " ")
+}
+
+// Unquote joins the character-strings of stored TXT data.
+func Unquote(data string) string {
+	rr, err := dns.NewRR(". 0 IN TXT " + data)
+	if err != nil {
+		return strings.Trim(data, `"`)
+	}
+	return strings.Join(rr.(*dns.TXT).Txt, "")
+}
+
+func buildSPF(s SPF, warnings *[]string) (string, error) {
+	terms := []string{"v=spf1"}
+	if s.A {
+		terms = append(terms, "a")
+	}
+	if s.MX {
+		terms = append(terms, "mx")
+	}
+	for _, list := range []struct {
+		tag string
+		in  []string
+		v6  bool
+	}{{"ip4", s.IP4, false}, {"ip6", s.IP6, true}} {
+		for _, v := range list.in {
+			v = strings.TrimSpace(v)
+			p, err := netip.ParsePrefix(v)
+			if err != nil {
+				a, aerr := netip.ParseAddr(v)
+				if aerr != nil {
+					return "", fmt.Errorf("%w: spf %s %q", ErrInvalid, list.tag, v)
+				}
+				p = netip.PrefixFrom(a, a.BitLen())
+			}
+			if p.Addr().Is6() != list.v6 || p.Addr().Is4In6() {
+				return "", fmt.Errorf("%w: spf %s %q is the wrong address family", ErrInvalid, list.tag, v)
+			}
+			term := list.tag + ":" + p.Masked().Addr().String()
+			if p.Bits() != p.Addr().BitLen() {
+				term += fmt.Sprintf("/%d", p.Bits())
+			}
+			terms = append(terms, term)
+		}
+	}
+	for _, d := range s.Include {
+		d = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(d)), ".")
+		if _, ok := dns.IsDomainName(d); !ok || d == "" {
+			return "", fmt.Errorf("%w: spf include %q", ErrInvalid, d)
+		}
+		terms = append(terms, "include:"+d)
+	}
+	switch all := strings.TrimSpace(s.All); all {
+	case "":
+		terms = append(terms, "-all")
+	case "-all", "~all", "?all":
+		terms = append(terms, all)
+	default:
+		return "", fmt.Errorf("%w: spf all must be -all, ~all or ?all", ErrInvalid)
+	}
+	if len(terms) == 2 {
+		*warnings = append(*warnings, "spf lists no senders; all mail from the domain fails")
+	}
+	return strings.Join(terms, " "), nil
+}
+
+// countLookups counts the SPF terms that make receivers query DNS,
+// following includes through res.
+func countLookups(ctx context.Context, s *SPF, res Resolver, warnings *[]string) int {
+	n := 0
+	if s.A {
+		n++
+	}
+	if s.MX {
+		n++
+	}
+	seen := map[string]bool{}
+	for _, d := range s.Include {
+		n += 1 + includeLookups(ctx, strings.TrimSuffix(strings.ToLower(strings.TrimSpace(d)), "."), res, seen, warnings, 1)
+	}
+	return n
+}
+
+func includeLookups(ctx context.Context, domain string, res Resolver, seen map[string]bool, warnings *[]string, depth int) int {
+	if res == nil || seen[domain] || depth > MaxSPFLookups {
+		return 0
+	}
+	seen[domain] = true
+	lctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	txts, err := res.LookupTXT(lctx, domain)
+	if err != nil {
+		*warnings = append(*warnings, fmt.Sprintf("include:%s could not be resolved (%v); its lookups are not counted", domain, err))
+		return 0
+	}
+	var spf string
+	for _, t := range txts {
+		if t == "v=spf1" || strings.HasPrefix(strings.ToLower(t), "v=spf1 ") {
+			spf = t
+			break
+		}
+	}
+	if spf == "" {
+		*warnings = append(*warnings, fmt.Sprintf("include:%s has no SPF record", domain))
+		return 0
+	}
+	n := 0
+	for _, term := range strings.Fields(spf)[1:] {
+		term = strings.ToLower(strings.TrimLeft(term, "+-~?"))
+		name, arg, _ := strings.Cut(term, ":")
+		if name == term {
+			name, arg, _ = strings.Cut(term, "=")
+		}
+		switch name {
+		case "a", "mx", "ptr", "exists":
+			n++
+		case "include", "redirect":
+			n += 1 + includeLookups(ctx, arg, res, seen, warnings, depth+1)
+		}
+	}
+	return n
+}
+
+func buildDKIM(d DKIM, warnings *[]string) (txt, selector string, err error) {
+	selector = strings.Trim(strings.ToLower(strings.TrimSpace(d.Selector)), ".")
+	if _, ok := dns.IsDomainName(selector); !ok || selector == "" || strings.Contains(selector, "_domainkey") {
+		return "", "", fmt.Errorf("%w: dkim selector %q", ErrInvalid, d.Selector)
+	}
+	key := d.PublicKey
+	var lines []string
+	for _, l := range strings.Split(key, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(l), "-----") {
+			lines = append(lines, l)
+		}
+	}
+	key = strings.Join(strings.Fields(strings.Join(lines, "")), "")
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(raw) == 0 {
+		return "", "", fmt.Errorf("%w: dkim public key is not base64", ErrInvalid)
+	}
+	kt := strings.ToLower(strings.TrimSpace(d.KeyType))
+	switch kt {
+	case "", "rsa":
+		kt = "rsa"
+		pub, err := x509.ParsePKIXPublicKey(raw)
+		if err != nil {
+			if pub, err = x509.ParsePKCS1PublicKey(raw); err != nil {
+				return "", "", fmt.Errorf("%w: dkim public key is not an RSA key", ErrInvalid)
+			}
+		}
+		rk, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return "", "", fmt.Errorf("%w: dkim public key is not an RSA key", ErrInvalid)
+		}
+		if bits := rk.N.BitLen(); bits < 1024 {
+			return "", "", fmt.Errorf("%w: dkim RSA key has %d bits, receivers require at least 1024", ErrInvalid, bits)
+		} else if bits < 2048 {
+			*warnings = append(*warnings, fmt.Sprintf("dkim RSA key has %d bits; 2048 is recommended", bits))
+		}
+	case "ed25519":
+		if len(raw) != ed25519.PublicKeySize {
+			return "", "", fmt.Errorf("%w: dkim ed25519 key must be %d bytes", ErrInvalid, ed25519.PublicKeySize)
+		}
+		*warnings = append(*warnings, "many receivers do not verify ed25519 DKIM signatures yet; publish an RSA selector too")
+	default:
+		return "", "", fmt.Errorf("%w: dkim key_type must be rsa or ed25519", ErrInvalid)
+	}
+	txt = "v=DKIM1; k=" + kt + "; p=" + key
+	if d.Testing {
+		txt = "v=DKIM1; k=" + kt + "; t=y; p=" + key
+	}
+	return txt, selector, nil
+}
+
+func buildDMARC(d DMARC, zone string, warnings *[]string) (string, error) {
+	policy := func(key, v string) error {
+		switch v {
+		case "none", "quarantine", "reject":
+			return nil
+		}
+		return fmt.Errorf("%w: dmarc %s must be none, quarantine or reject", ErrInvalid, key)
+	}
+	p := strings.ToLower(strings.TrimSpace(d.Policy))
+	if err := policy("policy", p); err != nil {
+		return "", err
+	}
+	tags := []string{"v=DMARC1", "p=" + p}
+	if sp := strings.ToLower(strings.TrimSpace(d.SubdomainPolicy)); sp != "" {
+		if err := policy("subdomain_policy", sp); err != nil {
+			return "", err
+		}
+		tags = append(tags, "sp="+sp)
+	}
+	if d.Percent != nil {
+		if *d.Percent < 0 || *d.Percent > 100 {
+			return "", fmt.Errorf("%w: dmarc percent must be 0-100", ErrInvalid)
+		}
+		if *d.Percent != 100 {
+			tags = append(tags, fmt.Sprintf("pct=%d", *d.Percent))
+		}
+	}
+	for _, list := range []struct {
+		tag string
+		in  []string
+	}{{"rua", d.RUA}, {"ruf", d.RUF}} {
+		var uris []string
+		for _, a := range list.in {
+			addr := strings.TrimPrefix(strings.TrimSpace(a), "mailto:")
+			at := strings.LastIndex(addr, "@")
+			if at <= 0 || at == len(addr)-1 || strings.ContainsAny(addr, " ,;!\"\\") {
+				return "", fmt.Errorf("%w: dmarc %s address %q", ErrInvalid, list.tag, a)
+			}
+			domain := dns.Fqdn(strings.ToLower(addr[at+1:]))
+			if !dns.IsSubDomain(zone, domain) {
+				*warnings = append(*warnings, fmt.Sprintf("%s goes to another domain; %s_report._dmarc.%s must authorize it", addr, zone, domain))
+			}
+			uris = append(uris, "mailto:"+addr)
+		}
+		if len(uris) > 0 {
+			tags = append(tags, list.tag+"="+strings.Join(uris, ","))
+		}
+	}
+	for _, align := range []struct{ tag, v string }{{"adkim", d.ADKIM}, {"aspf", d.ASPF}} {
+		switch v := strings.ToLower(strings.TrimSpace(align.v)); v {
+		case "", "r":
+		case "s":
+			tags = append(tags, align.tag+"=s")
+		default:
+			return "", fmt.Errorf("%w: dmarc %s must be r or s", ErrInvalid, align.tag)
+		}
+	}
+	if len(d.RUA) == 0 {
+		*warnings = append(*warnings, "dmarc has no rua address; you will get no reports")
+	}
+	if p == "none" {
+		*warnings = append(*warnings, "dmarc policy none only monitors; move to quarantine or reject once reports are clean")
+	}
+	return strings.Join(tags, "; "), nil
+}
@@ -0,0 +1,176 @@
+package mailauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	dbm "namedot/internal/db"
+)
+
+type fakeResolver map[string][]string
+
+func (f fakeResolver) LookupTXT(_ context.Context, name string) ([]string, error) {
+	if txt, ok := f[name]; ok {
+		return txt, nil
+	}
+	return nil, fmt.Errorf("no such host")
+}
+
+func TestBuild_SPF(t *testing.T) {
+	res := fakeResolver{
+		"_spf.mail.example": {"v=spf1 include:_a.mail.example include:_b.mail.example ~all"},
+		"_a.mail.example":   {"v=spf1 ip4:192.0.2.0/24 ~all"},
+		"_b.mail.example":   {"google-site-verification=x", "v=spf1 a mx ~all"},
+	}
+	out, err := Build(context.Background(), "example.com", Request{SPF: &SPF{
+		MX:      true,
+		IP4:     []string{"198.51.100.7", "203.0.113.0/24"},
+		IP6:     []string{"2001:db8::/32"},
+		Include: []string{"_spf.mail.example."},
+	}}, res)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	want := `"v=spf1 mx ip4:198.51.100.7 ip4:203.0.113.0/24 ip6:2001:db8::/32 include:_spf.mail.example -all"`
+	if len(out.Records) != 1 || out.Records[0].Name != "example.com." || out.Records[0].Data != want {
+		t.Fatalf("records: %+v", out.Records)
+	}
+	// mx, include, and inside it two includes with a and mx
+	if out.Lookups != 6 {
+		t.Errorf("lookups %d, want 6", out.Lookups)
+	}
+
+	var many []string
+	for i := 0; i < 11; i++ {
+		many = append(many, fmt.Sprintf("_spf%d.example.net", i))
+	}
+	if _, err := Build(context.Background(), "example.com", Request{SPF: &SPF{Include: many}}, nil); !errors.Is(err, ErrInvalid) || !strings.Contains(err.Error(), "11 DNS lookups") {
+		t.Errorf("too many lookups: %v", err)
+	}
+	for _, bad := range []SPF{
+		{IP4: []string{"2001:db8::1"}},
+		{IP6: []string{"192.0.2.1"}},
+		{IP4: []string{"192.0.2.300"}},
+		{Include: []string{"bad..name"}},
+		{MX: true, All: "+all"},
+	} {
+		if _, err := Build(context.Background(), "example.com", Request{SPF: &bad}, nil); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%+v: expected invalid, got %v", bad, err)
+		}
+	}
+}
+
+func TestBuild_DKIM(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	b64 := base64.StdEncoding.EncodeToString(der)
+	pemKey := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	out, err := Build(context.Background(), "example.com.", Request{DKIM: &DKIM{Selector: "S1", PublicKey: pemKey}}, nil)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	rec := out.Records[0]
+	if rec.Name != "s1._domainkey.example.com." || Unquote(rec.Data) != "v=DKIM1; k=rsa; p="+b64 {
+		t.Fatalf("record: %+v", rec)
+	}
+	// A 2048-bit key does not fit one character-string
+	if !strings.Contains(rec.Data, `" "`) {
+		t.Errorf("long key not split: %s", rec.Data)
+	}
+	for _, part := range strings.Split(rec.Data, `" "`) {
+		if len(strings.Trim(part, `"`)) > 255 {
+			t.Errorf("character-string longer than 255 bytes")
+		}
+	}
+
+	if _, err := Build(context.Background(), "example.com.", Request{DKIM: &DKIM{Selector: "s1", PublicKey: "not a key"}}, nil); !errors.Is(err, ErrInvalid) {
+		t.Errorf("bad key: %v", err)
+	}
+	if _, err := Build(context.Background(), "example.com.", Request{DKIM: &DKIM{Selector: "s1", KeyType: "ed25519", PublicKey: b64}}, nil); !errors.Is(err, ErrInvalid) {
+		t.Errorf("RSA key as ed25519: %v", err)
+	}
+}
+
+func TestBuild_DMARC(t *testing.T) {
+	pct := 50
+	out, err := Build(context.Background(), "example.com.", Request{DMARC: &DMARC{
+		Policy:  "Quarantine",
+		Percent: &pct,
+		RUA:     []string{"dmarc@example.com", "mailto:reports@dmarc.example.net"},
+		ADKIM:   "s",
+	}}, nil)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	want := `"v=DMARC1; p=quarantine; pct=50; rua=mailto:dmarc@example.com,mailto:reports@dmarc.example.net; adkim=s"`
+	if out.Records[0].Name != "_dmarc.example.com." || out.Records[0].Data != want {
+		t.Fatalf("record: %+v", out.Records[0])
+	}
+	if len(out.Warnings) != 1 || !strings.Contains(out.Warnings[0], "example.com._report._dmarc.dmarc.example.net.") {
+		t.Errorf("warnings: %v", out.Warnings)
+	}
+	for _, bad := range []DMARC{{Policy: "block"}, {Policy: "none", ASPF: "x"}, {Policy: "none", RUA: []string{"nobody"}}} {
+		if _, err := Build(context.Background(), "example.com.", Request{DMARC: &bad}, nil); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%+v: expected invalid, got %v", bad, err)
+		}
+	}
+}
+
+func TestApply_ReplacesOnlySupersededTXT(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err := dbm.AutoMigrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	zone := dbm.Zone{Name: "example.com.", RRSets: []dbm.RRSet{{Name: "example.com.", Type: "TXT", TTL: 300, Records: []dbm.RData{
+		{Data: `"v=spf1 a -all"`},
+		{Data: `"google-site-verification=abc"`},
+	}}}}
+	if err := db.Create(&zone).Error; err != nil {
+		t.Fatalf("create zone: %v", err)
+	}
+	out, err := Build(context.Background(), zone.Name, Request{
+		SPF:   &SPF{MX: true},
+		DMARC: &DMARC{Policy: "reject", RUA: []string{"dmarc@example.com"}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	changed, err := Apply(db, zone, out.Records, 3600)
+	if err != nil || !changed {
+		t.Fatalf("apply: %v %v", changed, err)
+	}
+	var apex dbm.RRSet
+	db.Preload("Records").Where("zone_id = ? AND name = ? AND type = ?", zone.ID, "example.com.", "TXT").First(&apex)
+	got := map[string]bool{}
+	for _, r := range apex.Records {
+		got[r.Data] = true
+	}
+	if len(got) != 2 || !got[`"v=spf1 mx -all"`] || !got[`"google-site-verification=abc"`] {
+		t.Errorf("apex TXT: %v", got)
+	}
+	var dmarc dbm.RRSet
+	if err := db.Preload("Records").Where("zone_id = ? AND name = ?", zone.ID, "_dmarc.example.com.").First(&dmarc).Error; err != nil || dmarc.TTL != 3600 || len(dmarc.Records) != 1 {
+		t.Errorf("dmarc rrset: %+v %v", dmarc, err)
+	}
+	if changed, err := Apply(db, zone, out.Records, 3600); err != nil || changed {
+		t.Errorf("second apply: changed=%v err=%v", changed, err)
+	}
+}
@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Alert is a Prometheus alerting rule shipped with the metrics it reads.
+// Packages add their alerts next to their metric definitions and build Expr
+// from the metrics' Name, so the rules follow renames.
+type Alert struct {
+	Name     string        // alert name, e.g. NamedotReplicationStale
+	Expr     string        // PromQL condition
+	For      time.Duration // how long Expr must hold before the alert fires
+	Severity string        // severity label: warning or critical
+	Summary  string
+	Metrics  []string // metrics Expr reads; each must be registered
+}
+
+// AddAlert adds a with the Default registry.
+func AddAlert(a Alert) { Default.AddAlert(a) }
+
+// AddAlert adds an alerting rule. Like a duplicate metric, a duplicate alert
+// or one reading a metric the registry does not have is a programming error
+// and panics, so a rule cannot drift from the code it watches.
+func (r *Registry) AddAlert(a Alert) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, name := range a.Metrics {
+		if _, ok := r.metrics[name]; !ok {
+			panic(fmt.Sprintf("metrics: alert %s reads unknown metric %s", a.Name, name))
+		}
+	}
+	for _, old := range r.alerts {
+		if old.Name == a.Name {
+			panic("metrics: duplicate alert " + a.Name)
+		}
+	}
+	r.alerts = append(r.alerts, a)
+}
+
+// Alerts returns the alerting rules sorted by name.
+func (r *Registry) Alerts() []Alert {
+	r.mu.Lock()
+	out := append([]Alert(nil), r.alerts...)
+	r.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+type ruleFile struct {
+	Groups []ruleGroup `yaml:"groups"`
+}
+
+type ruleGroup struct {
+	Name  string `yaml:"name"`
+	Rules []rule `yaml:"rules"`
+}
+
+type rule struct {
+	Alert       string            `yaml:"alert"`
+	Expr        string            `yaml:"expr"`
+	For         string            `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// WriteRules writes the alerting rules as a Prometheus rule file with one
+// group named namedot, ready for rule_files.
+func (r *Registry) WriteRules(w io.Writer) error {
+	g := ruleGroup{Name: "namedot", Rules: []rule{}}
+	for _, a := range r.Alerts() {
+		ru := rule{Alert: a.Name, Expr: a.Expr, For: promDuration(a.For)}
+		if a.Severity != "" {
+			ru.Labels = map[string]string{"severity": a.Severity}
+		}
+		if a.Summary != "" {
+			ru.Annotations = map[string]string{"summary": a.Summary}
+		}
+		g.Rules = append(g.Rules, ru)
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(ruleFile{Groups: []ruleGroup{g}}); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// promDuration renders d in the largest whole Prometheus unit, empty for 0.
+func promDuration(d time.Duration) string {
+	switch {
+	case d <= 0:
+		return ""
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	case d%time.Second == 0:
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+	return fmt.Sprintf("%dms", d/time.Millisecond)
+}
@@ -0,0 +1,270 @@
+// Package metrics keeps process-wide counters and gauges and writes them in
+// the Prometheus text exposition format. Code counts unconditionally; whether
+// anything scrapes the numbers is decided by metrics.enabled.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Registry holds the metrics written by WriteText and the alerting rules
+// written by WriteRules.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]metric
+	alerts  []Alert
+	node    string // rendered node="..." label added to every sample
+}
+
+// Default is the registry the New* helpers register with.
+var Default = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+type metric interface {
+	describe() (name, help, kind string)
+	samples() []sample
+}
+
+type sample struct {
+	labels string // rendered {k="v",...}, empty without labels
+	value  float64
+}
+
+// register adds m; registering two metrics under one name is a programming
+// error and panics.
+func (r *Registry) register(m metric) {
+	name, _, _ := m.describe()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, dup := r.metrics[name]; dup {
+		panic("metrics: duplicate metric " + name)
+	}
+	r.metrics[name] = m
+}
+
+// SetNode labels every sample of the Default registry with node="id".
+func SetNode(id string) { Default.SetNode(id) }
+
+// SetNode labels every sample with node="id", so the instances behind one
+// anycast address can be told apart; an empty id removes the label.
+func (r *Registry) SetNode(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.node = ""
+	if id != "" {
+		r.node = `node="` + escapeLabel(id) + `"`
+	}
+}
+
+// WriteText writes all metrics, sorted by name, in the text exposition format.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	node := r.node
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ms := make([]metric, len(names))
+	for i, name := range names {
+		ms[i] = r.metrics[name]
+	}
+	r.mu.Unlock()
+
+	for _, m := range ms {
+		name, help, kind := m.describe()
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind); err != nil {
+			return err
+		}
+		for _, s := range m.samples() {
+			labels := s.labels
+			switch {
+			case node == "":
+			case labels == "":
+				labels = "{" + node + "}"
+			default:
+				labels = "{" + node + "," + labels[1:]
+			}
+			if _, err := fmt.Fprintf(w, "%s%s %s\n", name, labels, formatValue(s.value)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// vec stores values by label values.
+type vec struct {
+	name, help string
+	labels     []string
+	mu         sync.Mutex
+	values     map[string]*labeled
+}
+
+type labeled struct {
+	values []string
+	v      float64
+}
+
+func newVec(name, help string, labels []string) *vec {
+	return &vec{name: name, help: help, labels: labels, values: make(map[string]*labeled)}
+}
+
+func (v *vec) add(n float64, set bool, lv []string) {
+	if len(lv) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s wants %d label values, got %d", v.name, len(v.labels), len(lv)))
+	}
+	key := strings.Join(lv, "\xff")
+	v.mu.Lock()
+	l := v.values[key]
+	if l == nil {
+		l = &labeled{values: append([]string(nil), lv...)}
+		v.values[key] = l
+	}
+	if set {
+		l.v = n
+	} else {
+		l.v += n
+	}
+	v.mu.Unlock()
+}
+
+func (v *vec) get(lv []string) float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if l := v.values[strings.Join(lv, "\xff")]; l != nil {
+		return l.v
+	}
+	return 0
+}
+
+func (v *vec) samples() []sample {
+	v.mu.Lock()
+	out := make([]sample, 0, len(v.values))
+	for _, l := range v.values {
+		out = append(out, sample{labels: renderLabels(v.labels, l.values), value: l.v})
+	}
+	v.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].labels < out[j].labels })
+	return out
+}
+
+func renderLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, n := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(n)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+// Counter is a monotonically increasing value, optionally split by labels.
+type Counter struct{ v *vec }
+
+// NewCounter registers a counter with the Default registry.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return Default.NewCounter(name, help, labels...)
+}
+
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{v: newVec(name, help, labels)}
+	r.register(c)
+	return c
+}
+
+// Inc adds one for the given label values.
+func (c *Counter) Inc(labelValues ...string) { c.v.add(1, false, labelValues) }
+
+// Add adds n (which must not be negative) for the given label values.
+func (c *Counter) Add(n float64, labelValues ...string) {
+	if n < 0 {
+		panic("metrics: counter " + c.v.name + " cannot decrease")
+	}
+	c.v.add(n, false, labelValues)
+}
+
+// Value returns the current value for the given label values.
+func (c *Counter) Value(labelValues ...string) float64 { return c.v.get(labelValues) }
+
+// Name returns the metric name, for use in alert expressions.
+func (c *Counter) Name() string { return c.v.name }
+
+func (c *Counter) describe() (string, string, string) { return c.v.name, c.v.help, "counter" }
+func (c *Counter) samples() []sample                  { return c.v.samples() }
+
+// Gauge is a value that can go up and down, optionally split by labels.
+type Gauge struct{ v *vec }
+
+// NewGauge registers a gauge with the Default registry.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return Default.NewGauge(name, help, labels...)
+}
+
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{v: newVec(name, help, labels)}
+	r.register(g)
+	return g
+}
+
+// Set sets the value for the given label values.
+func (g *Gauge) Set(n float64, labelValues ...string) { g.v.add(n, true, labelValues) }
+
+// Value returns the current value for the given label values.
+func (g *Gauge) Value(labelValues ...string) float64 { return g.v.get(labelValues) }
+
+// Name returns the metric name, for use in alert expressions.
+func (g *Gauge) Name() string { return g.v.name }
+
+func (g *Gauge) describe() (string, string, string) { return g.v.name, g.v.help, "gauge" }
+func (g *Gauge) samples() []sample                  { return g.v.samples() }
+
+// gaugeFunc is a gauge read from a callback at scrape time.
+type gaugeFunc struct {
+	name, help string
+	f          func() float64
+}
+
+// NewGaugeFunc registers a gauge whose value is f() at scrape time.
+func NewGaugeFunc(name, help string, f func() float64) {
+	Default.NewGaugeFunc(name, help, f)
+}
+
+func (r *Registry) NewGaugeFunc(name, help string, f func() float64) {
+	r.register(&gaugeFunc{name: name, help: help, f: f})
+}
+
+func (g *gaugeFunc) describe() (string, string, string) { return g.name, g.help, "gauge" }
+func (g *gaugeFunc) samples() []sample                  { return []sample{{value: g.f()}} }
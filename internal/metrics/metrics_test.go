@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("test_requests_total", "Requests served.", "code")
+	g := r.NewGauge("test_temperature", "Current temperature.")
+	r.NewGaugeFunc("test_answer", "The answer.", func() float64 { return 42 })
+
+	c.Inc("200")
+	c.Add(2, "200")
+	c.Inc(`5"00`)
+	g.Set(-1.5)
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP test_answer The answer.
+# TYPE test_answer gauge
+test_answer 42
+# HELP test_requests_total Requests served.
+# TYPE test_requests_total counter
+test_requests_total{code="200"} 3
+test_requests_total{code="5\"00"} 1
+# HELP test_temperature Current temperature.
+# TYPE test_temperature gauge
+test_temperature -1.5
+`
+	if b.String() != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", b.String(), want)
+	}
+	if c.Value("200") != 3 || c.Value("404") != 0 {
+		t.Fatalf("unexpected values %v %v", c.Value("200"), c.Value("404"))
+	}
+}
+
+func TestWriteText_Node(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("test_requests_total", "Requests served.", "code").Inc("200")
+	r.NewGauge("test_temperature", "Current temperature.").Set(20)
+	r.SetNode("fra-1")
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{`test_requests_total{node="fra-1",code="200"} 1`, `test_temperature{node="fra-1"} 20`} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Errorf("missing %s in:\n%s", line, b.String())
+		}
+	}
+}
+
+func TestRegister_DuplicatePanics(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("dup_total", "x")
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic")
+		}
+	}()
+	r.NewGauge("dup_total", "x")
+}
+
+func TestWriteRules(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("test_errors_total", "Errors.")
+	r.AddAlert(Alert{
+		Name:     "TestErrors",
+		Expr:     "rate(" + c.Name() + "[5m]) > 1",
+		For:      10 * time.Minute,
+		Severity: "warning",
+		Summary:  "Too many errors",
+		Metrics:  []string{c.Name()},
+	})
+	r.AddAlert(Alert{Name: "TestAlways", Expr: "vector(1)"})
+
+	var b strings.Builder
+	if err := r.WriteRules(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `groups:
+  - name: namedot
+    rules:
+      - alert: TestAlways
+        expr: vector(1)
+      - alert: TestErrors
+        expr: rate(test_errors_total[5m]) > 1
+        for: 10m
+        labels:
+          severity: warning
+        annotations:
+          summary: Too many errors
+`
+	if b.String() != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestAddAlert_UnknownMetricPanics(t *testing.T) {
+	r := NewRegistry()
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic")
+		}
+	}()
+	r.AddAlert(Alert{Name: "TestMissing", Expr: "missing_total > 0", Metrics: []string{"missing_total"}})
+}
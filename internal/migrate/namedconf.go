@@ -0,0 +1,357 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"namedot/internal/config"
+	dbm "namedot/internal/db"
+	"namedot/internal/server/rest/zoneio"
+)
+
+// ZoneDecl describes a zone statement found in named.conf.
+type ZoneDecl struct {
+	Name string // zone name as FQDN (lowercase, trailing dot)
+	Type string // master, primary, slave, forward, hint, ...
+	File string // resolved path to the zone file (empty if not set)
+	View string // enclosing view name, if any
+}
+
+// IsPrimary reports whether the zone holds authoritative data that can be imported.
+func (z ZoneDecl) IsPrimary() bool {
+	return z.Type == "master" || z.Type == "primary"
+}
+
+// stmt is a parsed named.conf statement: leading words plus an optional block.
+type stmt struct {
+	Args  []string
+	Block []stmt
+}
+
+// ParseNamedConf parses a BIND named.conf file (following include statements)
+// and returns all zone declarations in the order they appear.
+// Relative zone file paths are resolved against the "directory" option,
+// falling back to the directory containing named.conf.
+func ParseNamedConf(path string) ([]ZoneDecl, error) {
+	p := &confParser{baseDir: filepath.Dir(path), seen: map[string]bool{}}
+	stmts, err := p.parseFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var out []ZoneDecl
+	p.collectZones(stmts, "", &out)
+	return out, nil
+}
+
+type confParser struct {
+	baseDir   string
+	directory string
+	seen      map[string]bool
+}
+
+func (p *confParser) resolve(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	if p.directory != "" {
+		return filepath.Join(p.directory, name)
+	}
+	return filepath.Join(p.baseDir, name)
+}
+
+// resolveInclude prefers the "directory" option like BIND does, but falls back
+// to the including file's directory so relocated config trees still parse.
+func (p *confParser) resolveInclude(name string) string {
+	path := p.resolve(name)
+	if _, err := os.Stat(path); err != nil && !filepath.IsAbs(name) {
+		if alt := filepath.Join(p.baseDir, name); alt != path {
+			if _, err := os.Stat(alt); err == nil {
+				return alt
+			}
+		}
+	}
+	return path
+}
+
+func (p *confParser) parseFile(path string) ([]stmt, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if p.seen[abs] {
+		return nil, fmt.Errorf("include loop detected at %s", path)
+	}
+	p.seen[abs] = true
+	defer delete(p.seen, abs)
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	toks, err := tokenizeConf(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	stmts, rest, err := parseStmts(toks, false)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%s: unexpected %q", path, rest[0])
+	}
+	return p.expand(stmts)
+}
+
+// expand inlines include statements and records the options directory.
+func (p *confParser) expand(in []stmt) ([]stmt, error) {
+	out := make([]stmt, 0, len(in))
+	for _, s := range in {
+		if len(s.Args) == 0 {
+			continue
+		}
+		switch strings.ToLower(s.Args[0]) {
+		case "include":
+			if len(s.Args) < 2 {
+				return nil, fmt.Errorf("include without file name")
+			}
+			inc, err := p.parseFile(p.resolveInclude(s.Args[1]))
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, inc...)
+			continue
+		case "options":
+			for _, o := range s.Block {
+				if len(o.Args) >= 2 && strings.EqualFold(o.Args[0], "directory") {
+					dir := o.Args[1]
+					if !filepath.IsAbs(dir) {
+						dir = filepath.Join(p.baseDir, dir)
+					}
+					p.directory = dir
+				}
+			}
+		}
+		if len(s.Block) > 0 {
+			blk, err := p.expand(s.Block)
+			if err != nil {
+				return nil, err
+			}
+			s.Block = blk
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+func (p *confParser) collectZones(stmts []stmt, view string, out *[]ZoneDecl) {
+	for _, s := range stmts {
+		if len(s.Args) == 0 {
+			continue
+		}
+		switch strings.ToLower(s.Args[0]) {
+		case "view":
+			name := ""
+			if len(s.Args) > 1 {
+				name = s.Args[1]
+			}
+			p.collectZones(s.Block, name, out)
+		case "zone":
+			if len(s.Args) < 2 {
+				continue
+			}
+			z := ZoneDecl{Name: zoneio.NormalizeFQDN(s.Args[1]), View: view}
+			for _, o := range s.Block {
+				if len(o.Args) < 2 {
+					continue
+				}
+				switch strings.ToLower(o.Args[0]) {
+				case "type":
+					z.Type = strings.ToLower(o.Args[1])
+				case "file":
+					z.File = p.resolve(o.Args[1])
+				}
+			}
+			*out = append(*out, z)
+		}
+	}
+}
+
+// tokenizeConf splits named.conf text into words, quoted strings and punctuation,
+// dropping //, # and /* */ comments.
+func tokenizeConf(src string) ([]string, error) {
+	var toks []string
+	i := 0
+	for i < len(src) {
+		ch := src[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			i++
+		case ch == '#' || (ch == '/' && i+1 < len(src) && src[i+1] == '/'):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case ch == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			i += end + 4
+		case ch == '"':
+			end := strings.IndexByte(src[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			// Keep quotes so the parser can tell a quoted "{" from a real brace.
+			toks = append(toks, src[i:i+end+2])
+			i += end + 2
+		case ch == '{' || ch == '}' || ch == ';':
+			toks = append(toks, string(ch))
+			i++
+		default:
+			j := i
+			for j < len(src) && !strings.ContainsRune(" \t\r\n{};\"#", rune(src[j])) {
+				if src[j] == '/' && j+1 < len(src) && (src[j+1] == '/' || src[j+1] == '*') {
+					break
+				}
+				j++
+			}
+			toks = append(toks, src[i:j])
+			i = j
+		}
+	}
+	return toks, nil
+}
+
+// parseStmts builds the statement tree. When nested is true it stops at the closing brace.
+func parseStmts(toks []string, nested bool) ([]stmt, []string, error) {
+	var out []stmt
+	cur := stmt{}
+	for len(toks) > 0 {
+		t := toks[0]
+		toks = toks[1:]
+		switch t {
+		case ";":
+			if len(cur.Args) > 0 || cur.Block != nil {
+				out = append(out, cur)
+			}
+			cur = stmt{}
+		case "{":
+			blk, rest, err := parseStmts(toks, true)
+			if err != nil {
+				return nil, nil, err
+			}
+			toks = rest
+			if len(cur.Args) == 0 {
+				// Anonymous list such as "allow-transfer { ... }" value continuation; keep as block.
+				cur.Block = append(cur.Block, blk...)
+			} else {
+				cur.Block = blk
+				if cur.Block == nil {
+					cur.Block = []stmt{}
+				}
+			}
+		case "}":
+			if !nested {
+				return nil, nil, fmt.Errorf("unexpected '}'")
+			}
+			if len(cur.Args) > 0 {
+				out = append(out, cur)
+			}
+			return out, toks, nil
+		default:
+			cur.Args = append(cur.Args, unquote(t))
+		}
+	}
+	if nested {
+		return nil, nil, fmt.Errorf("missing '}'")
+	}
+	if len(cur.Args) > 0 {
+		out = append(out, cur)
+	}
+	return out, nil, nil
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// ZoneResult reports the outcome of importing a single zone declaration.
+type ZoneResult struct {
+	Zone    string
+	File    string
+	Created bool
+	Skipped string // reason when the zone was not imported
+	Err     error
+}
+
+// ImportNamedConfZones imports every primary zone in decls via the BIND import pipeline.
+// Each zone is imported in its own transaction so one broken file does not abort the run.
+// mode: upsert | replace
+func ImportNamedConfZones(db *gorm.DB, decls []ZoneDecl, mode string, defaultTTL uint32, limits config.RecordTTLConfig) []ZoneResult {
+	results := make([]ZoneResult, 0, len(decls))
+	seen := map[string]bool{}
+	for _, d := range decls {
+		res := ZoneResult{Zone: d.Name, File: d.File}
+		switch {
+		case !d.IsPrimary():
+			res.Skipped = fmt.Sprintf("type %s", d.Type)
+		case d.File == "":
+			res.Skipped = "no file"
+		case d.Name == ".":
+			res.Skipped = "root zone"
+		case seen[d.Name]:
+			res.Skipped = "duplicate (another view)"
+		}
+		if res.Skipped != "" {
+			results = append(results, res)
+			continue
+		}
+		seen[d.Name] = true
+		res.Created, res.Err = importZoneFile(db, d, mode, defaultTTL, limits)
+		results = append(results, res)
+	}
+	return results
+}
+
+func importZoneFile(db *gorm.DB, d ZoneDecl, mode string, defaultTTL uint32, limits config.RecordTTLConfig) (bool, error) {
+	f, err := os.Open(d.File)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	created := false
+	var z dbm.Zone
+	if err := db.Where("name = ?", d.Name).Limit(1).Find(&z).Error; err != nil {
+		return false, err
+	}
+	if z.ID == 0 {
+		z = dbm.Zone{Name: d.Name}
+		if err := db.Create(&z).Error; err != nil {
+			return false, fmt.Errorf("create zone: %w", err)
+		}
+		created = true
+	}
+	err = dbm.WithSource(db, dbm.SourceImport(filepath.Base(d.File))).Transaction(func(tx *gorm.DB) error {
+		rep, err := zoneio.ImportBIND(tx, &z, f, mode, defaultTTL, limits)
+		if err != nil {
+			return err
+		}
+		return rep.Err()
+	})
+	if err != nil {
+		if created {
+			// Do not leave an empty zone behind when its file fails to parse.
+			_ = db.Unscoped().Delete(&z).Error
+		}
+		return false, err
+	}
+	return created, nil
+}
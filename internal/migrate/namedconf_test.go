@@ -0,0 +1,142 @@
+package migrate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"namedot/internal/config"
+	dbm "namedot/internal/db"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err := dbm.AutoMigrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+func TestParseNamedConf(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "named.conf"), `
+// main config
+options {
+    directory "`+filepath.Join(dir, "zones")+`";
+    allow-transfer { 10.0.0.1; };
+};
+include "named.conf.local";
+/* block
+   comment */
+zone "." { type hint; file "db.root"; };
+`)
+	writeFile(t, filepath.Join(dir, "named.conf.local"), `
+zone "Example.COM" IN {
+    type master;
+    file "db.example.com"; # trailing comment
+};
+view "internal" {
+    zone "corp.example" { type primary; file "/abs/db.corp"; };
+    zone "partner.example" { type slave; masters { 192.0.2.1; }; };
+};
+`)
+
+	decls, err := ParseNamedConf(filepath.Join(dir, "named.conf"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(decls) != 4 {
+		t.Fatalf("expected 4 zones, got %d: %+v", len(decls), decls)
+	}
+	ex := decls[0]
+	if ex.Name != "example.com." || ex.Type != "master" || ex.File != filepath.Join(dir, "zones", "db.example.com") {
+		t.Fatalf("unexpected example.com decl: %+v", ex)
+	}
+	corp := decls[1]
+	if corp.Name != "corp.example." || corp.View != "internal" || corp.File != "/abs/db.corp" || !corp.IsPrimary() {
+		t.Fatalf("unexpected corp decl: %+v", corp)
+	}
+	if decls[2].IsPrimary() || decls[2].Type != "slave" {
+		t.Fatalf("slave zone should not be primary: %+v", decls[2])
+	}
+	if decls[3].Name != "." || decls[3].Type != "hint" {
+		t.Fatalf("unexpected root decl: %+v", decls[3])
+	}
+}
+
+func TestParseNamedConf_IncludeLoop(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.conf"), `include "b.conf";`)
+	writeFile(t, filepath.Join(dir, "b.conf"), `include "a.conf";`)
+	if _, err := ParseNamedConf(filepath.Join(dir, "a.conf")); err == nil {
+		t.Fatal("expected include loop error")
+	}
+}
+
+func TestImportNamedConfZones(t *testing.T) {
+	db := newTestDB(t)
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "db.example.com"), `$TTL 600
+@ IN SOA ns1.example.com. hostmaster.example.com. 2025010101 7200 3600 1209600 300
+@ IN NS ns1.example.com.
+www 300 IN A 192.0.2.1
+`)
+	writeFile(t, filepath.Join(dir, "db.broken"), "www IN A not-an-ip\n")
+
+	decls := []ZoneDecl{
+		{Name: "example.com.", Type: "master", File: filepath.Join(dir, "db.example.com")},
+		{Name: "broken.example.", Type: "master", File: filepath.Join(dir, "db.broken")},
+		{Name: "secondary.example.", Type: "slave"},
+	}
+	results := ImportNamedConfZones(db, decls, "upsert", 300, config.RecordTTLConfig{})
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+	if results[0].Err != nil || !results[0].Created {
+		t.Fatalf("example.com import: %+v", results[0])
+	}
+	if results[1].Err == nil {
+		t.Fatalf("expected broken zone to fail")
+	}
+	if results[2].Skipped == "" {
+		t.Fatalf("expected slave zone to be skipped")
+	}
+
+	var zones []dbm.Zone
+	if err := db.Find(&zones).Error; err != nil {
+		t.Fatalf("load zones: %v", err)
+	}
+	if len(zones) != 1 || zones[0].Name != "example.com." {
+		t.Fatalf("expected only example.com to remain, got %+v", zones)
+	}
+	var set dbm.RRSet
+	if err := db.Preload("Records").Where("zone_id = ? AND name = ? AND type = ?", zones[0].ID, "www.example.com.", "A").First(&set).Error; err != nil {
+		t.Fatalf("www A not imported: %v", err)
+	}
+	if set.TTL != 300 || len(set.Records) != 1 || set.Records[0].Data != "192.0.2.1" {
+		t.Fatalf("unexpected rrset: %+v", set)
+	}
+
+	// Second run updates instead of creating
+	results = ImportNamedConfZones(db, decls[:1], "upsert", 300, config.RecordTTLConfig{})
+	if results[0].Err != nil || results[0].Created {
+		t.Fatalf("re-import should update existing zone: %+v", results[0])
+	}
+}
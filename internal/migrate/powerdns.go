@@ -0,0 +1,223 @@
+package migrate
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+	"gorm.io/gorm"
+
+	"namedot/internal/config"
+	dbm "namedot/internal/db"
+	"namedot/internal/server/rest/zoneio"
+)
+
+// PowerDNSOptions controls how a PowerDNS generic SQL backend is converted.
+type PowerDNSOptions struct {
+	Mode          string // upsert | replace (per zone)
+	DefaultTTL    uint32
+	RecordTTL     config.RecordTTLConfig // TTL limits; rrsets outside them are skipped
+	IncludeSlaves bool                   // also import zones of type SLAVE/CONSUMER
+	DryRun        bool                   // convert and report without writing
+}
+
+// PowerDNSZoneResult reports the conversion outcome for a single PowerDNS domain.
+type PowerDNSZoneResult struct {
+	Zone     string
+	Type     string
+	RRSets   int
+	Records  int
+	Comments int
+	Skipped  string
+	Warnings []string
+	Err      error
+}
+
+type pdnsDomain struct {
+	ID   int64
+	Name string
+	Type string
+}
+
+type pdnsRecord struct {
+	DomainID int64
+	Name     string
+	Type     string
+	Content  string
+	TTL      *int64
+	Prio     *int64
+	Disabled bool
+}
+
+type pdnsComment struct {
+	DomainID int64
+	Name     string
+	Type     string
+	Comment  string
+}
+
+// ImportPowerDNS reads domains/records/comments from a PowerDNS gmysql, gpgsql or
+// gsqlite3 schema in src and writes them as namedot zones into dst through the
+// JSON import pipeline. Each domain is imported in its own transaction.
+func ImportPowerDNS(src, dst *gorm.DB, opts PowerDNSOptions) ([]PowerDNSZoneResult, error) {
+	var domains []pdnsDomain
+	if err := src.Raw("SELECT id, name, type FROM domains ORDER BY name").Scan(&domains).Error; err != nil {
+		return nil, fmt.Errorf("read domains: %w", err)
+	}
+
+	recordsSQL := "SELECT domain_id, name, type, content, ttl, disabled FROM records WHERE type IS NOT NULL AND type <> ''"
+	if src.Migrator().HasColumn("records", "prio") {
+		recordsSQL = "SELECT domain_id, name, type, content, ttl, prio, disabled FROM records WHERE type IS NOT NULL AND type <> ''"
+	}
+	var records []pdnsRecord
+	if err := src.Raw(recordsSQL + " ORDER BY domain_id, name, type").Scan(&records).Error; err != nil {
+		return nil, fmt.Errorf("read records: %w", err)
+	}
+	byDomain := map[int64][]pdnsRecord{}
+	for _, r := range records {
+		byDomain[r.DomainID] = append(byDomain[r.DomainID], r)
+	}
+
+	// Comments are optional: older schemas do not have the table.
+	commentsByKey := map[string][]string{}
+	if src.Migrator().HasTable("comments") {
+		var comments []pdnsComment
+		if err := src.Raw("SELECT domain_id, name, type, comment FROM comments ORDER BY id").Scan(&comments).Error; err != nil {
+			return nil, fmt.Errorf("read comments: %w", err)
+		}
+		for _, c := range comments {
+			k := commentKey(c.DomainID, c.Name, c.Type)
+			commentsByKey[k] = append(commentsByKey[k], strings.TrimSpace(c.Comment))
+		}
+	}
+
+	results := make([]PowerDNSZoneResult, 0, len(domains))
+	for _, d := range domains {
+		res := PowerDNSZoneResult{Zone: zoneio.NormalizeFQDN(d.Name), Type: strings.ToUpper(d.Type)}
+		if (res.Type == "SLAVE" || res.Type == "CONSUMER") && !opts.IncludeSlaves {
+			res.Skipped = "type " + res.Type
+			results = append(results, res)
+			continue
+		}
+
+		zone := convertPowerDNSDomain(d, byDomain[d.ID], commentsByKey, &res)
+		if opts.DryRun {
+			results = append(results, res)
+			continue
+		}
+		res.Err = importConvertedZone(dst, zone, opts)
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+func commentKey(domainID int64, name, typ string) string {
+	return fmt.Sprintf("%d|%s|%s", domainID, strings.ToLower(strings.TrimSuffix(name, ".")), strings.ToUpper(typ))
+}
+
+// convertPowerDNSDomain groups PowerDNS rows into RRSets with normalized RDATA.
+func convertPowerDNSDomain(d pdnsDomain, rows []pdnsRecord, comments map[string][]string, res *PowerDNSZoneResult) *dbm.Zone {
+	type key struct{ name, typ string }
+	sets := map[key]*dbm.RRSet{}
+	var order []key
+
+	for _, r := range rows {
+		typ := strings.ToUpper(r.Type)
+		name := zoneio.NormalizeFQDN(r.Name)
+		if r.Disabled {
+			res.Warnings = append(res.Warnings, fmt.Sprintf("%s %s %q: disabled record skipped", name, typ, r.Content))
+			continue
+		}
+		content := r.Content
+		// Pre-4.0 schemas keep MX/SRV priority in a separate column.
+		if r.Prio != nil {
+			n := len(strings.Fields(content))
+			if (typ == "MX" && n == 1) || (typ == "SRV" && n == 3) {
+				content = strconv.FormatInt(*r.Prio, 10) + " " + content
+			}
+		}
+		ttl := uint32(0)
+		if r.TTL != nil && *r.TTL > 0 {
+			ttl = uint32(*r.TTL)
+		}
+		data, err := normalizeRData(name, ttl, typ, content)
+		if err != nil {
+			res.Warnings = append(res.Warnings, fmt.Sprintf("%s %s %q: %v", name, typ, r.Content, err))
+			continue
+		}
+
+		k := key{name, typ}
+		rs := sets[k]
+		if rs == nil {
+			rs = &dbm.RRSet{Name: name, Type: typ, TTL: ttl}
+			sets[k] = rs
+			order = append(order, k)
+		} else if ttl > 0 && (rs.TTL == 0 || ttl < rs.TTL) {
+			// PowerDNS stores TTL per record; an RRSet carries one, keep the lowest.
+			rs.TTL = ttl
+		}
+		rs.Records = append(rs.Records, dbm.RData{Data: data})
+		res.Records++
+	}
+
+	zone := &dbm.Zone{Name: zoneio.NormalizeFQDN(d.Name)}
+	for _, k := range order {
+		rs := sets[k]
+		if cs := comments[commentKey(d.ID, k.name, k.typ)]; len(cs) > 0 {
+			rs.Comment = strings.Join(cs, "\n")
+			res.Comments += len(cs)
+		}
+		zone.RRSets = append(zone.RRSets, *rs)
+	}
+	sort.SliceStable(zone.RRSets, func(i, j int) bool {
+		// Keep SOA first so the zone is complete even if later sets fail validation.
+		return zone.RRSets[i].Type == "SOA" && zone.RRSets[j].Type != "SOA"
+	})
+	res.RRSets = len(zone.RRSets)
+	return zone
+}
+
+// normalizeRData parses content as presentation-format RDATA and returns it in
+// canonical form (e.g. absolute target names with trailing dots).
+func normalizeRData(name string, ttl uint32, typ, content string) (string, error) {
+	if _, ok := dns.StringToType[typ]; !ok {
+		return "", fmt.Errorf("unsupported type")
+	}
+	rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", name, ttl, typ, content))
+	if err != nil {
+		return "", err
+	}
+	if rr == nil {
+		return "", fmt.Errorf("empty record")
+	}
+	return strings.TrimSpace(strings.TrimPrefix(rr.String(), rr.Header().String())), nil
+}
+
+func importConvertedZone(db *gorm.DB, src *dbm.Zone, opts PowerDNSOptions) error {
+	var z dbm.Zone
+	if err := db.Where("name = ?", src.Name).Limit(1).Find(&z).Error; err != nil {
+		return err
+	}
+	created := false
+	if z.ID == 0 {
+		z = dbm.Zone{Name: src.Name}
+		if err := db.Create(&z).Error; err != nil {
+			return fmt.Errorf("create zone: %w", err)
+		}
+		created = true
+	}
+	mode := opts.Mode
+	if mode == "" {
+		mode = "upsert"
+	}
+	if _, err := zoneio.ImportJSON(db, &z, src, mode, opts.DefaultTTL, opts.RecordTTL); err != nil {
+		if created {
+			// Do not leave an empty zone behind, so a retry can create it.
+			_ = db.Unscoped().Delete(&z).Error
+		}
+		return err
+	}
+	return nil
+}
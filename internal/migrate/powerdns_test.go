@@ -0,0 +1,146 @@
+package migrate
+
+import (
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	dbm "namedot/internal/db"
+)
+
+func newPowerDNSSource(t *testing.T) *gorm.DB {
+	t.Helper()
+	src, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open src: %v", err)
+	}
+	stmts := []string{
+		`CREATE TABLE domains (id INTEGER PRIMARY KEY, name VARCHAR(255) NOT NULL, master VARCHAR(128), last_check INTEGER, type VARCHAR(8) NOT NULL, notified_serial INTEGER, account VARCHAR(40))`,
+		`CREATE TABLE records (id INTEGER PRIMARY KEY, domain_id INTEGER, name VARCHAR(255), type VARCHAR(10), content VARCHAR(65535), ttl INTEGER, prio INTEGER, disabled BOOLEAN DEFAULT 0, ordername VARCHAR(255), auth BOOL DEFAULT 1)`,
+		`CREATE TABLE comments (id INTEGER PRIMARY KEY, domain_id INTEGER NOT NULL, name VARCHAR(255) NOT NULL, type VARCHAR(10) NOT NULL, modified_at INT NOT NULL, account VARCHAR(40), comment VARCHAR(65535) NOT NULL)`,
+		`INSERT INTO domains (id, name, type) VALUES (1, 'example.com', 'NATIVE'), (2, 'secondary.example', 'SLAVE')`,
+		`INSERT INTO records (domain_id, name, type, content, ttl, prio, disabled) VALUES
+			(1, 'example.com', 'SOA', 'ns1.example.com hostmaster.example.com 2024010101 10800 3600 604800 3600', 3600, 0, 0),
+			(1, 'example.com', 'NS', 'ns1.example.com', 3600, 0, 0),
+			(1, 'example.com', 'MX', 'mail.example.com', 3600, 10, 0),
+			(1, 'example.com', 'MX', '20 backup.example.com', 3600, 0, 0),
+			(1, 'www.example.com', 'A', '192.0.2.1', 600, 0, 0),
+			(1, 'www.example.com', 'A', '192.0.2.2', 300, 0, 0),
+			(1, 'old.example.com', 'A', '192.0.2.9', 300, 0, 1),
+			(1, 'bad.example.com', 'A', 'not-an-ip', 300, 0, 0),
+			(1, 'ent.example.com', NULL, NULL, NULL, 0, 0),
+			(1, '_sip._tcp.example.com', 'SRV', '5 5060 sip.example.com', 300, 10, 0),
+			(2, 'secondary.example', 'SOA', 'ns1.other hostmaster.other 1 10800 3600 604800 3600', 3600, 0, 0)`,
+		`INSERT INTO comments (domain_id, name, type, modified_at, comment) VALUES
+			(1, 'www.example.com', 'A', 0, 'web frontends'),
+			(1, 'www.example.com', 'A', 0, 'managed by ops')`,
+	}
+	for _, s := range stmts {
+		if err := src.Exec(s).Error; err != nil {
+			t.Fatalf("exec %q: %v", s, err)
+		}
+	}
+	return src
+}
+
+func TestImportPowerDNS(t *testing.T) {
+	src := newPowerDNSSource(t)
+	dst := newTestDB(t)
+
+	results, err := ImportPowerDNS(src, dst, PowerDNSOptions{Mode: "upsert", DefaultTTL: 300})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d: %+v", len(results), results)
+	}
+	ex := results[0]
+	if ex.Zone != "example.com." || ex.Err != nil || ex.Skipped != "" {
+		t.Fatalf("unexpected example.com result: %+v", ex)
+	}
+	if ex.RRSets != 5 || ex.Records != 7 || ex.Comments != 2 {
+		t.Fatalf("unexpected counts: %+v", ex)
+	}
+	if len(ex.Warnings) != 2 {
+		t.Fatalf("expected warnings for disabled and invalid records, got %v", ex.Warnings)
+	}
+	if results[1].Skipped == "" {
+		t.Fatalf("expected slave zone to be skipped: %+v", results[1])
+	}
+
+	var z dbm.Zone
+	if err := dst.Where("name = ?", "example.com.").First(&z).Error; err != nil {
+		t.Fatalf("zone not created: %v", err)
+	}
+	load := func(name, typ string) dbm.RRSet {
+		t.Helper()
+		var rs dbm.RRSet
+		if err := dst.Preload("Records").Where("zone_id = ? AND name = ? AND type = ?", z.ID, name, typ).First(&rs).Error; err != nil {
+			t.Fatalf("%s %s not imported: %v", name, typ, err)
+		}
+		return rs
+	}
+
+	www := load("www.example.com.", "A")
+	if www.TTL != 300 || len(www.Records) != 2 {
+		t.Fatalf("unexpected www rrset: %+v", www)
+	}
+	if www.Comment != "web frontends\nmanaged by ops" {
+		t.Fatalf("unexpected comment: %q", www.Comment)
+	}
+
+	mx := load("example.com.", "MX")
+	got := map[string]bool{}
+	for _, r := range mx.Records {
+		got[r.Data] = true
+	}
+	if !got["10 mail.example.com."] || !got["20 backup.example.com."] {
+		t.Fatalf("unexpected MX data: %+v", mx.Records)
+	}
+
+	srv := load("_sip._tcp.example.com.", "SRV")
+	if len(srv.Records) != 1 || srv.Records[0].Data != "10 5 5060 sip.example.com." {
+		t.Fatalf("unexpected SRV data: %+v", srv.Records)
+	}
+
+	var n int64
+	dst.Model(&dbm.RRSet{}).Where("name = ?", "old.example.com.").Count(&n)
+	if n != 0 {
+		t.Fatalf("disabled record should not be imported")
+	}
+}
+
+func TestImportPowerDNS_DryRun(t *testing.T) {
+	src := newPowerDNSSource(t)
+
+	results, err := ImportPowerDNS(src, nil, PowerDNSOptions{DryRun: true, IncludeSlaves: true})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if len(results) != 2 || results[1].Skipped != "" || results[1].RRSets != 1 {
+		t.Fatalf("expected slave zone to be converted with -include-slaves: %+v", results)
+	}
+}
+
+func TestImportPowerDNS_FailedZoneIsRemoved(t *testing.T) {
+	src := newPowerDNSSource(t)
+	dst := newTestDB(t)
+	// Records cannot be stored, so the import of example.com fails
+	if err := dst.Exec("DROP TABLE r_data").Error; err != nil {
+		t.Fatalf("drop r_data: %v", err)
+	}
+
+	results, err := ImportPowerDNS(src, dst, PowerDNSOptions{Mode: "upsert", DefaultTTL: 300})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if len(results) == 0 || results[0].Err == nil {
+		t.Fatalf("expected example.com to fail: %+v", results)
+	}
+	var n int64
+	dst.Unscoped().Model(&dbm.Zone{}).Where("name = ?", "example.com.").Count(&n)
+	if n != 0 {
+		t.Fatal("empty zone left behind after a failed import")
+	}
+}
@@ -0,0 +1,172 @@
+// Package notify sends subscribers a summary of the changes made to their
+// zones, read from the audit log, by email and Slack.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"namedot/internal/config"
+	dbm "namedot/internal/db"
+)
+
+// maxEntries bounds the audit entries read per interval; the rest follow in
+// the next summaries.
+const maxEntries = 1000
+
+// Notifier sends the summaries.
+type Notifier struct {
+	cfg      config.NotificationsConfig
+	db       *gorm.DB
+	client   *http.Client
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+	lastID   uint
+}
+
+// New creates a notifier for the changes audited from now on.
+func New(cfg config.NotificationsConfig, db *gorm.DB) *Notifier {
+	n := &Notifier{
+		cfg:      cfg,
+		db:       db,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		sendMail: smtp.SendMail,
+	}
+	var last dbm.AuditEntry
+	if err := db.Order("id desc").Limit(1).Find(&last).Error; err != nil {
+		log.Printf("notifications: %v", err)
+	}
+	n.lastID = last.ID
+	return n
+}
+
+// Run sends a summary every interval until ctx is done.
+func (n *Notifier) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(n.cfg.IntervalSec) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := n.Check(); err != nil {
+			log.Printf("notifications: %v", err)
+		}
+	}
+}
+
+// Check sends the changes audited since the previous call to the
+// subscriptions covering their zones. Changes without a zone (hosts,
+// templates) are not sent.
+func (n *Notifier) Check() error {
+	var entries []dbm.AuditEntry
+	if err := n.db.Where("id > ?", n.lastID).Order("id").Limit(maxEntries).Find(&entries).Error; err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	n.lastID = entries[len(entries)-1].ID
+	for _, sub := range n.cfg.Subscriptions {
+		var matched []dbm.AuditEntry
+		for _, e := range entries {
+			if e.ZoneName != "" && config.MatchZone(sub.Zones, e.ZoneName) {
+				matched = append(matched, e)
+			}
+		}
+		if len(matched) == 0 {
+			continue
+		}
+		subject, body := Summary(matched)
+		if len(sub.Emails) > 0 {
+			if err := n.mail(sub.Emails, subject, body); err != nil {
+				log.Printf("notifications: mail to %s: %v", strings.Join(sub.Emails, ", "), err)
+			}
+		}
+		if sub.SlackWebhookURL != "" {
+			if err := n.slack(sub.SlackWebhookURL, subject, body); err != nil {
+				log.Printf("notifications: slack: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Summary renders entries as a subject line and a plain text body, grouped
+// by zone.
+func Summary(entries []dbm.AuditEntry) (subject, body string) {
+	byZone := map[string][]dbm.AuditEntry{}
+	var zones []string
+	for _, e := range entries {
+		if _, ok := byZone[e.ZoneName]; !ok {
+			zones = append(zones, e.ZoneName)
+		}
+		byZone[e.ZoneName] = append(byZone[e.ZoneName], e)
+	}
+	sort.Strings(zones)
+	changes := "changes"
+	if len(entries) == 1 {
+		changes = "change"
+	}
+	subject = fmt.Sprintf("namedot: %d %s in %s", len(entries), changes, strings.Join(zones, ", "))
+
+	var b strings.Builder
+	for i, z := range zones {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%s\n", z)
+		for _, e := range byZone[z] {
+			fmt.Fprintf(&b, "  %s  %-12s %-16s %s\n", e.CreatedAt.UTC().Format("2006-01-02 15:04:05"), e.Actor, e.Action, e.Summary)
+		}
+	}
+	return subject, b.String()
+}
+
+func (n *Notifier) mail(to []string, subject, body string) error {
+	c := n.cfg.SMTP
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", c.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if c.Username != "" {
+		auth = smtp.PlainAuth("", c.Username, c.Password, c.Host)
+	}
+	// The envelope sender is the bare address of "Name <addr>"
+	from := c.From
+	if a, err := mail.ParseAddress(c.From); err == nil {
+		from = a.Address
+	}
+	return n.sendMail(net.JoinHostPort(c.Host, strconv.Itoa(c.Port)), auth, from, to, msg.Bytes())
+}
+
+func (n *Notifier) slack(url, subject, body string) error {
+	payload, _ := json.Marshal(map[string]string{"text": "*" + subject + "*\n```\n" + body + "```"})
+	resp, err := n.client.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return nil
+}
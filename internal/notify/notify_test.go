@@ -0,0 +1,78 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"namedot/internal/config"
+	dbm "namedot/internal/db"
+)
+
+func TestCheck_SendsSubscribedZones(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err := dbm.AutoMigrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	audit := func(zone, action, summary string) {
+		if err := dbm.RecordAudit(db, dbm.AuditEntry{Actor: "alice", Action: action, ZoneName: zone, Summary: summary}); err != nil {
+			t.Fatalf("audit: %v", err)
+		}
+	}
+	audit("app.test.", dbm.AuditRRSetCreate, "before the notifier started")
+
+	var slackText string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&p)
+		slackText = p["text"]
+	}))
+	defer srv.Close()
+
+	n := New(config.NotificationsConfig{
+		SMTP: config.SMTPConfig{Host: "mail.test", Port: 587, From: "namedot <dns@test>"},
+		Subscriptions: []config.NotificationSubscription{
+			{Zones: []string{"*.apps.test"}, SlackWebhookURL: srv.URL},
+			{Zones: []string{"app.test"}, Emails: []string{"team@test"}},
+		},
+	}, db)
+	var mailTo []string
+	var mailMsg string
+	n.sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		if addr != "mail.test:587" || from != "dns@test" {
+			t.Errorf("sendMail addr=%s from=%s", addr, from)
+		}
+		mailTo, mailMsg = to, string(msg)
+		return nil
+	}
+
+	audit("x.apps.test.", dbm.AuditRRSetUpdate, "www.x.apps.test. A")
+	audit("app.test.", dbm.AuditRRSetDelete, "old.app.test. CNAME")
+	audit("", dbm.AuditHostCreate, "lab.test. -> 10.0.0.5")
+	if err := n.Check(); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+
+	if !strings.Contains(slackText, "1 change in x.apps.test.") || strings.Contains(slackText, "app.test. CNAME") {
+		t.Fatalf("unexpected slack text: %q", slackText)
+	}
+	if len(mailTo) != 1 || mailTo[0] != "team@test" || !strings.Contains(mailMsg, "Subject: namedot: 1 change in app.test.") ||
+		!strings.Contains(mailMsg, "old.app.test. CNAME") || strings.Contains(mailMsg, "before the notifier") {
+		t.Fatalf("unexpected mail to %v: %q", mailTo, mailMsg)
+	}
+
+	// Nothing new, nothing sent
+	slackText, mailTo = "", nil
+	if err := n.Check(); err != nil || slackText != "" || mailTo != nil {
+		t.Fatalf("second check sent again: %q %v %v", slackText, mailTo, err)
+	}
+}
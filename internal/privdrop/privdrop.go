@@ -0,0 +1,86 @@
+// Package privdrop switches a process started as root to an unprivileged
+// user, optionally inside a chroot, once its privileged ports are bound.
+package privdrop
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+
+	"namedot/internal/config"
+)
+
+// ids resolves run_as.user and run_as.group, which may be names or numeric
+// IDs. Without a group the user's primary group is used.
+func ids(cfg config.RunAsConfig) (uid, gid int, err error) {
+	uid, gid = os.Getuid(), os.Getgid()
+	if cfg.User != "" {
+		u, err := user.Lookup(cfg.User)
+		if err != nil {
+			if u, err = user.LookupId(cfg.User); err != nil {
+				return 0, 0, fmt.Errorf("run_as.user %q: %w", cfg.User, err)
+			}
+		}
+		if uid, err = strconv.Atoi(u.Uid); err != nil {
+			return 0, 0, fmt.Errorf("run_as.user %q: uid %q", cfg.User, u.Uid)
+		}
+		if gid, err = strconv.Atoi(u.Gid); err != nil {
+			return 0, 0, fmt.Errorf("run_as.user %q: gid %q", cfg.User, u.Gid)
+		}
+	}
+	if cfg.Group != "" {
+		g, err := user.LookupGroup(cfg.Group)
+		if err != nil {
+			if g, err = user.LookupGroupId(cfg.Group); err != nil {
+				return 0, 0, fmt.Errorf("run_as.group %q: %w", cfg.Group, err)
+			}
+		}
+		if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return 0, 0, fmt.Errorf("run_as.group %q: gid %q", cfg.Group, g.Gid)
+		}
+	}
+	return uid, gid, nil
+}
+
+// Drop enters run_as.chroot and switches to run_as.user and run_as.group.
+// It does nothing when run_as is empty and fails when the process cannot
+// make the switch, so namedot never keeps running as root by accident.
+// Users and groups are looked up before the chroot is entered.
+func Drop(cfg config.RunAsConfig) error {
+	if cfg.User == "" && cfg.Group == "" && cfg.Chroot == "" {
+		return nil
+	}
+	uid, gid, err := ids(cfg)
+	if err != nil {
+		return err
+	}
+	if os.Geteuid() != 0 {
+		if uid == os.Getuid() && gid == os.Getgid() && cfg.Chroot == "" {
+			return nil
+		}
+		return fmt.Errorf("run_as requires starting as root (running as uid %d)", os.Geteuid())
+	}
+	if cfg.Chroot != "" {
+		if err := syscall.Chroot(cfg.Chroot); err != nil {
+			return fmt.Errorf("chroot %s: %w", cfg.Chroot, err)
+		}
+		if err := os.Chdir("/"); err != nil {
+			return fmt.Errorf("chdir after chroot: %w", err)
+		}
+	}
+	if err := syscall.Setgroups([]int{gid}); err != nil {
+		return fmt.Errorf("setgroups: %w", err)
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("setgid %d: %w", gid, err)
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("setuid %d: %w", uid, err)
+	}
+	if uid != 0 && syscall.Setuid(0) == nil {
+		return fmt.Errorf("privileges could not be dropped: setuid(0) still succeeds")
+	}
+	return nil
+}
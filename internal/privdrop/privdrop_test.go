@@ -0,0 +1,32 @@
+package privdrop
+
+import (
+	"os"
+	"strconv"
+	"testing"
+
+	"namedot/internal/config"
+)
+
+func TestIDs(t *testing.T) {
+	me := strconv.Itoa(os.Getuid())
+	uid, _, err := ids(config.RunAsConfig{User: me})
+	if err != nil {
+		t.Skipf("current user not in the user database: %v", err)
+	}
+	if uid != os.Getuid() {
+		t.Fatalf("numeric user: got uid %d", uid)
+	}
+	if _, gid, err := ids(config.RunAsConfig{Group: strconv.Itoa(os.Getgid())}); err != nil || gid != os.Getgid() {
+		t.Fatalf("numeric group: got gid %d (%v)", gid, err)
+	}
+	if _, _, err := ids(config.RunAsConfig{User: "no-such-user-namedot"}); err == nil {
+		t.Fatal("expected an error for an unknown user")
+	}
+}
+
+func TestDrop_Empty(t *testing.T) {
+	if err := Drop(config.RunAsConfig{}); err != nil {
+		t.Fatalf("empty run_as should be a no-op: %v", err)
+	}
+}
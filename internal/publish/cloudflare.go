@@ -0,0 +1,309 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+const cloudflareEndpoint = "https://api.cloudflare.com/client/v4"
+
+var cloudflareTypes = map[string]bool{
+	"A": true, "AAAA": true, "CAA": true, "CNAME": true, "MX": true, "NS": true, "PTR": true, "SRV": true, "TXT": true,
+}
+
+// Cloudflare publishes to Cloudflare DNS zones. Cloudflare holds single
+// records rather than sets, so sets are compared as a whole and then written
+// record by record. Published records are not proxied; records that already
+// are keep their proxy setting as long as their data is unchanged.
+type Cloudflare struct {
+	client   *http.Client
+	endpoint string
+	token    string
+	zoneIDs  map[string]string // zone name -> Cloudflare zone ID
+}
+
+// NewCloudflare creates a Cloudflare provider. An empty endpoint means the
+// Cloudflare API.
+func NewCloudflare(client *http.Client, endpoint, token string) *Cloudflare {
+	if endpoint == "" {
+		endpoint = cloudflareEndpoint
+	}
+	return &Cloudflare{client: client, endpoint: strings.TrimRight(endpoint, "/"), token: token, zoneIDs: map[string]string{}}
+}
+
+func (c *Cloudflare) Supports(rtype string) bool { return cloudflareTypes[rtype] }
+
+// MinTTL is the lowest TTL outside the Enterprise plan.
+func (c *Cloudflare) MinTTL() uint32 { return 60 }
+
+type cfRecord struct {
+	ID       string  `json:"id,omitempty"`
+	Type     string  `json:"type"`
+	Name     string  `json:"name"`
+	Content  string  `json:"content,omitempty"`
+	TTL      uint32  `json:"ttl"`
+	Priority *uint16 `json:"priority,omitempty"`
+	Data     *cfData `json:"data,omitempty"`
+}
+
+// cfData holds the fields of SRV and CAA records.
+type cfData struct {
+	Priority *uint16 `json:"priority,omitempty"`
+	Weight   *uint16 `json:"weight,omitempty"`
+	Port     *uint16 `json:"port,omitempty"`
+	Target   string  `json:"target,omitempty"`
+	Flags    *uint8  `json:"flags,omitempty"`
+	Tag      string  `json:"tag,omitempty"`
+	Value    string  `json:"value,omitempty"`
+}
+
+// Load returns the records of zone grouped into sets. TTL 1 ("automatic")
+// reads as 300, the value Cloudflare serves.
+func (c *Cloudflare) Load(ctx context.Context, zone string) ([]RRSet, error) {
+	id, err := c.zoneID(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	apex := strings.ToLower(zone)
+	sets := map[string]*RRSet{}
+	for page := 1; ; page++ {
+		var recs []cfRecord
+		q := url.Values{"per_page": {"500"}, "page": {strconv.Itoa(page)}}
+		info, err := c.do(ctx, http.MethodGet, "/zones/"+id+"/dns_records?"+q.Encode(), nil, &recs)
+		if err != nil {
+			return nil, err
+		}
+		for _, rec := range recs {
+			name := dns.Fqdn(strings.ToLower(rec.Name))
+			if !cloudflareTypes[rec.Type] || (name == apex && rec.Type == "NS") {
+				continue
+			}
+			data, err := Canonical(name, rec.Type, cfPresentation(rec))
+			if err != nil {
+				return nil, fmt.Errorf("cloudflare: %s %s: %w", name, rec.Type, err)
+			}
+			ttl := rec.TTL
+			if ttl == 1 {
+				ttl = 300
+			}
+			key := name + " " + rec.Type
+			set := sets[key]
+			if set == nil {
+				set = &RRSet{Name: name, Type: rec.Type, TTL: ttl, ref: map[string]cfRecord{}}
+				sets[key] = set
+			}
+			// Records of a set may differ in TTL at Cloudflare; any
+			// difference makes the set be rewritten
+			if ttl != set.TTL {
+				set.TTL = 0
+			}
+			set.Data = append(set.Data, data)
+			set.ref.(map[string]cfRecord)[data] = rec
+		}
+		if info.TotalPages <= page {
+			break
+		}
+	}
+	out := make([]RRSet, 0, len(sets))
+	for _, set := range sets {
+		sort.Strings(set.Data)
+		out = append(out, *set)
+	}
+	return out, nil
+}
+
+// Apply deletes the records that go away first, so a name can change from
+// a CNAME to other records, then creates and updates the rest.
+func (c *Cloudflare) Apply(ctx context.Context, zone string, changes []Change) error {
+	id, err := c.zoneID(ctx, zone)
+	if err != nil {
+		return err
+	}
+	base := "/zones/" + id + "/dns_records"
+	for _, ch := range changes {
+		if ch.Before == nil {
+			continue
+		}
+		keep := map[string]bool{}
+		if ch.After != nil {
+			for _, d := range ch.After.Data {
+				keep[d] = true
+			}
+		}
+		for data, rec := range ch.Before.ref.(map[string]cfRecord) {
+			if !keep[data] {
+				if _, err := c.do(ctx, http.MethodDelete, base+"/"+rec.ID, nil, nil); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, ch := range changes {
+		if ch.After == nil {
+			continue
+		}
+		var existing map[string]cfRecord
+		if ch.Before != nil {
+			existing = ch.Before.ref.(map[string]cfRecord)
+		}
+		for _, data := range ch.After.Data {
+			old, ok := existing[data]
+			if ok && old.TTL == ch.After.TTL {
+				continue
+			}
+			rec, err := cfRecordFor(ch.After.Name, ch.After.Type, ch.After.TTL, data)
+			if err != nil {
+				return fmt.Errorf("cloudflare: %s %s: %w", ch.After.Name, ch.After.Type, err)
+			}
+			if ok {
+				_, err = c.do(ctx, http.MethodPatch, base+"/"+old.ID, map[string]uint32{"ttl": rec.TTL}, nil)
+			} else {
+				_, err = c.do(ctx, http.MethodPost, base, rec, nil)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// cfPresentation returns the record data of rec in zone file format.
+func cfPresentation(rec cfRecord) string {
+	u16 := func(p *uint16) uint16 {
+		if p == nil {
+			return 0
+		}
+		return *p
+	}
+	switch rec.Type {
+	case "MX":
+		return fmt.Sprintf("%d %s", u16(rec.Priority), dns.Fqdn(rec.Content))
+	case "SRV":
+		if rec.Data != nil {
+			return fmt.Sprintf("%d %d %d %s", u16(rec.Data.Priority), u16(rec.Data.Weight), u16(rec.Data.Port), dns.Fqdn(rec.Data.Target))
+		}
+	case "CAA":
+		if rec.Data != nil {
+			var flags uint8
+			if rec.Data.Flags != nil {
+				flags = *rec.Data.Flags
+			}
+			return fmt.Sprintf("%d %s %s", flags, rec.Data.Tag, strconv.Quote(rec.Data.Value))
+		}
+	case "TXT":
+		if !strings.HasPrefix(rec.Content, `"`) {
+			return strconv.Quote(rec.Content)
+		}
+	case "CNAME", "NS", "PTR":
+		return dns.Fqdn(rec.Content)
+	}
+	return rec.Content
+}
+
+// cfRecordFor builds the Cloudflare record for canonical record data.
+func cfRecordFor(name, rtype string, ttl uint32, data string) (cfRecord, error) {
+	rec := cfRecord{Type: rtype, Name: strings.TrimSuffix(name, "."), TTL: ttl}
+	rr, err := dns.NewRR(fmt.Sprintf("%s 0 IN %s %s", name, rtype, data))
+	if err != nil || rr == nil {
+		return rec, fmt.Errorf("invalid record data %q", data)
+	}
+	switch v := rr.(type) {
+	case *dns.MX:
+		rec.Content, rec.Priority = strings.TrimSuffix(v.Mx, "."), &v.Preference
+	case *dns.SRV:
+		rec.Data = &cfData{Priority: &v.Priority, Weight: &v.Weight, Port: &v.Port, Target: strings.TrimSuffix(v.Target, ".")}
+	case *dns.CAA:
+		rec.Data = &cfData{Flags: &v.Flag, Tag: v.Tag, Value: v.Value}
+	case *dns.CNAME:
+		rec.Content = strings.TrimSuffix(v.Target, ".")
+	case *dns.NS:
+		rec.Content = strings.TrimSuffix(v.Ns, ".")
+	case *dns.PTR:
+		rec.Content = strings.TrimSuffix(v.Ptr, ".")
+	default:
+		rec.Content = data
+	}
+	return rec, nil
+}
+
+func (c *Cloudflare) zoneID(ctx context.Context, zone string) (string, error) {
+	zone = strings.ToLower(zone)
+	if id, ok := c.zoneIDs[zone]; ok {
+		return id, nil
+	}
+	var zones []struct {
+		ID string `json:"id"`
+	}
+	if _, err := c.do(ctx, http.MethodGet, "/zones?"+url.Values{"name": {strings.TrimSuffix(zone, ".")}}.Encode(), nil, &zones); err != nil {
+		return "", err
+	}
+	if len(zones) == 0 {
+		return "", fmt.Errorf("cloudflare: no zone %s", zone)
+	}
+	c.zoneIDs[zone] = zones[0].ID
+	return zones[0].ID, nil
+}
+
+type cfResultInfo struct {
+	TotalPages int `json:"total_pages"`
+}
+
+// do calls the API and decodes the result of its response envelope into out.
+func (c *Cloudflare) do(ctx context.Context, method, path string, in, out interface{}) (cfResultInfo, error) {
+	var info cfResultInfo
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return info, err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.endpoint+path, body)
+	if err != nil {
+		return info, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return info, fmt.Errorf("cloudflare: %w", err)
+	}
+	defer resp.Body.Close()
+	var env struct {
+		Success bool `json:"success"`
+		Errors  []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+		Result     json.RawMessage `json:"result"`
+		ResultInfo cfResultInfo    `json:"result_info"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 16<<20)).Decode(&env); err != nil {
+		return info, fmt.Errorf("cloudflare: %s: %w", resp.Status, err)
+	}
+	if !env.Success || resp.StatusCode >= 300 {
+		if len(env.Errors) > 0 {
+			return info, fmt.Errorf("cloudflare: %s %s: %s", method, path, env.Errors[0].Message)
+		}
+		return info, fmt.Errorf("cloudflare: %s %s: %s", method, path, resp.Status)
+	}
+	if out != nil {
+		if err := json.Unmarshal(env.Result, out); err != nil {
+			return info, fmt.Errorf("cloudflare: %w", err)
+		}
+	}
+	return env.ResultInfo, nil
+}
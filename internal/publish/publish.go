@@ -0,0 +1,258 @@
+// Package publish mirrors namedot zones to cloud DNS providers. A zone is
+// pushed when its serial changes: the provider's records are read, compared
+// with the zone and only the differences are written, so a push repeated
+// after an error or a restart is harmless.
+package publish
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"gorm.io/gorm"
+
+	"namedot/internal/config"
+	dbm "namedot/internal/db"
+)
+
+// skipTypes are never published: the provider keeps its own SOA and signs
+// the zone itself if it does DNSSEC.
+var skipTypes = map[string]bool{"SOA": true, "RRSIG": true, "NSEC": true, "NSEC3": true, "NSEC3PARAM": true, "DNSKEY": true}
+
+// RRSet is a record set in provider-neutral form. Data holds the record data
+// in presentation format, canonicalized and sorted so sets compare equal.
+type RRSet struct {
+	Name string // FQDN, lower case
+	Type string
+	TTL  uint32
+	Data []string
+	ref  interface{} // provider state of a loaded set (record IDs, raw values)
+}
+
+// Change turns Before (nil when the set is new) into After (nil when the set
+// is removed).
+type Change struct {
+	Before *RRSet
+	After  *RRSet
+}
+
+// Provider is a cloud DNS API.
+type Provider interface {
+	// Supports reports whether the provider can hold records of rtype.
+	Supports(rtype string) bool
+	// MinTTL is the lowest TTL the provider accepts.
+	MinTTL() uint32
+	// Load returns the record sets of zone, except the apex SOA and NS
+	// which the provider manages.
+	Load(ctx context.Context, zone string) ([]RRSet, error)
+	// Apply makes the changes, which come from comparing with Load.
+	Apply(ctx context.Context, zone string, changes []Change) error
+}
+
+type target struct {
+	name     string
+	zones    []string
+	provider Provider
+	pushed   map[string]uint32 // zone name -> serial last pushed
+}
+
+// Publisher pushes changed zones to the configured targets.
+type Publisher struct {
+	cfg     config.PublishConfig
+	db      *gorm.DB
+	targets []*target
+}
+
+// New creates a publisher for cfg. Every matching zone is pushed once on
+// the first check.
+func New(cfg config.PublishConfig, db *gorm.DB) *Publisher {
+	p := &Publisher{cfg: cfg, db: db}
+	client := &http.Client{Timeout: 30 * time.Second}
+	for _, t := range cfg.Targets {
+		var prov Provider
+		switch t.Provider {
+		case "route53":
+			prov = NewRoute53(client, t.Endpoint, t.AccessKeyID, t.SecretAccessKey)
+		case "cloudflare":
+			prov = NewCloudflare(client, t.Endpoint, t.APIToken)
+		default:
+			continue
+		}
+		name := t.Name
+		if name == "" {
+			name = t.Provider
+		}
+		p.targets = append(p.targets, &target{name: name, zones: t.Zones, provider: prov, pushed: map[string]uint32{}})
+	}
+	return p
+}
+
+// Run checks for changed zones every interval until ctx is done.
+func (p *Publisher) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(p.cfg.IntervalSec) * time.Second)
+	defer ticker.Stop()
+	for {
+		if err := p.Check(ctx); err != nil {
+			log.Printf("publish: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check pushes each zone whose serial differs from the one last pushed to a
+// target. Failed pushes are retried on the next check. Disabled and deleted
+// zones are left as they are at the provider.
+func (p *Publisher) Check(ctx context.Context) error {
+	var zones []dbm.Zone
+	if err := p.db.Where("disabled = ?", false).Find(&zones).Error; err != nil {
+		return err
+	}
+	for _, t := range p.targets {
+		for _, z := range zones {
+			if !config.MatchZone(t.zones, z.Name) {
+				continue
+			}
+			if serial, ok := t.pushed[z.Name]; ok && serial == z.Serial {
+				continue
+			}
+			n, err := p.Push(ctx, t.provider, z)
+			if err != nil {
+				log.Printf("publish: %s to %s: %v", z.Name, t.name, err)
+				continue
+			}
+			t.pushed[z.Name] = z.Serial
+			if n > 0 {
+				log.Printf("publish: %s to %s: %d rrset(s) changed (serial %d)", z.Name, t.name, n, z.Serial)
+			}
+		}
+	}
+	return nil
+}
+
+// Push makes the provider's copy of zone match the enabled records in the
+// database and returns the number of record sets changed.
+func (p *Publisher) Push(ctx context.Context, prov Provider, zone dbm.Zone) (int, error) {
+	var sets []dbm.RRSet
+	if err := p.db.Preload("Records", "disabled = ?", false).Where("zone_id = ?", zone.ID).Find(&sets).Error; err != nil {
+		return 0, err
+	}
+	want := Desired(zone.Name, sets, prov)
+	have, err := prov.Load(ctx, zone.Name)
+	if err != nil {
+		return 0, err
+	}
+	changes := Diff(have, want)
+	if len(changes) == 0 {
+		return 0, nil
+	}
+	return len(changes), prov.Apply(ctx, zone.Name, changes)
+}
+
+// Desired converts the zone's record sets for prov. Geo variants of a record
+// are published once, as in zone transfers, and TTLs are raised to the
+// provider minimum. Records the provider cannot hold are skipped with a log
+// line.
+func Desired(zone string, sets []dbm.RRSet, prov Provider) []RRSet {
+	apex := dns.Fqdn(strings.ToLower(zone))
+	var out []RRSet
+	for _, set := range sets {
+		name := strings.ToLower(set.Name)
+		if skipTypes[set.Type] || (set.Type == "NS" && name == apex) {
+			continue
+		}
+		if !prov.Supports(set.Type) {
+			log.Printf("publish: %s %s: type not supported by the provider", name, set.Type)
+			continue
+		}
+		rs := RRSet{Name: name, Type: set.Type, TTL: set.TTL}
+		if min := prov.MinTTL(); rs.TTL < min {
+			rs.TTL = min
+		}
+		seen := map[string]bool{}
+		for _, rec := range set.Records {
+			data := strings.TrimSpace(rec.Data)
+			if set.Type == "CNAME" && data == "@" {
+				data = apex
+			}
+			c, err := Canonical(name, set.Type, data)
+			if err != nil {
+				log.Printf("publish: %s %s: %v", name, set.Type, err)
+				continue
+			}
+			if !seen[c] {
+				seen[c] = true
+				rs.Data = append(rs.Data, c)
+			}
+		}
+		if len(rs.Data) > 0 {
+			sort.Strings(rs.Data)
+			out = append(out, rs)
+		}
+	}
+	return out
+}
+
+// Diff returns the changes that turn have into want.
+func Diff(have, want []RRSet) []Change {
+	current := make(map[string]*RRSet, len(have))
+	for i := range have {
+		current[have[i].Name+" "+have[i].Type] = &have[i]
+	}
+	var out []Change
+	for i := range want {
+		w := &want[i]
+		key := w.Name + " " + w.Type
+		h := current[key]
+		delete(current, key)
+		if h != nil && h.TTL == w.TTL && equal(h.Data, w.Data) {
+			continue
+		}
+		out = append(out, Change{Before: h, After: w})
+	}
+	for _, h := range current {
+		out = append(out, Change{Before: h})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].key() < out[j].key() })
+	return out
+}
+
+func (c Change) key() string {
+	if c.After != nil {
+		return c.After.Name + " " + c.After.Type
+	}
+	return c.Before.Name + " " + c.Before.Type
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Canonical parses the record data of a name and type and returns it in
+// presentation format, so equal records from either side compare equal.
+func Canonical(name, rtype, data string) (string, error) {
+	rr, err := dns.NewRR(fmt.Sprintf("%s 0 IN %s %s", dns.Fqdn(name), rtype, data))
+	if err != nil {
+		return "", err
+	}
+	if rr == nil {
+		return "", fmt.Errorf("empty record data")
+	}
+	return strings.TrimPrefix(rr.String(), rr.Header().String()), nil
+}
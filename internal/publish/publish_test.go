@@ -0,0 +1,219 @@
+package publish
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"namedot/internal/config"
+	dbm "namedot/internal/db"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := dbm.AutoMigrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+// fakeCloudflare keeps the records of one zone in memory.
+type fakeCloudflare struct {
+	records map[string]cfRecord
+	nextID  int
+	calls   []string
+}
+
+func (f *fakeCloudflare) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reply := func(result interface{}) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "result": result, "result_info": map[string]int{"total_pages": 1}})
+	}
+	if r.Header.Get("Authorization") != "Bearer cf-token" {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "errors": []map[string]string{{"message": "bad token"}}})
+		return
+	}
+	if r.Method != http.MethodGet {
+		f.calls = append(f.calls, r.Method)
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/zones/z1/dns_records/")
+	switch {
+	case r.URL.Path == "/zones" && r.URL.Query().Get("name") == "app.test":
+		reply([]map[string]string{{"id": "z1"}})
+	case r.URL.Path == "/zones/z1/dns_records" && r.Method == http.MethodGet:
+		out := []cfRecord{}
+		for _, rec := range f.records {
+			out = append(out, rec)
+		}
+		reply(out)
+	case r.URL.Path == "/zones/z1/dns_records" && r.Method == http.MethodPost:
+		var rec cfRecord
+		json.NewDecoder(r.Body).Decode(&rec)
+		f.nextID++
+		rec.ID = fmt.Sprint(f.nextID)
+		f.records[rec.ID] = rec
+		reply(rec)
+	case r.Method == http.MethodPatch:
+		rec := f.records[id]
+		json.NewDecoder(r.Body).Decode(&rec)
+		f.records[id] = rec
+		reply(rec)
+	case r.Method == http.MethodDelete:
+		delete(f.records, id)
+		reply(map[string]string{"id": id})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestCheck_Cloudflare(t *testing.T) {
+	db := newTestDB(t)
+	zone := dbm.Zone{Name: "app.test.", Serial: 1, RRSets: []dbm.RRSet{
+		{Name: "app.test.", Type: "SOA", TTL: 3600, Records: []dbm.RData{{Data: "ns1.app.test. hostmaster.app.test. 1 7200 3600 1209600 300"}}},
+		{Name: "app.test.", Type: "NS", TTL: 3600, Records: []dbm.RData{{Data: "ns1.app.test."}}},
+		{Name: "www.app.test.", Type: "A", TTL: 300, Records: []dbm.RData{{Data: "192.0.2.1"}, {Data: "192.0.2.1", Country: strPtr("DE")}, {Data: "192.0.2.2"}}},
+		{Name: "app.test.", Type: "MX", TTL: 30, Records: []dbm.RData{{Data: "10 mail.app.test."}}},
+		{Name: "app.test.", Type: "TXT", TTL: 300, Records: []dbm.RData{{Data: `"v=spf1 -all"`}}},
+		{Name: "_sip._tcp.app.test.", Type: "SRV", TTL: 300, Records: []dbm.RData{{Data: "0 5 5060 sip.app.test."}}},
+	}}
+	if err := db.Create(&zone).Error; err != nil {
+		t.Fatalf("create zone: %v", err)
+	}
+	fake := &fakeCloudflare{records: map[string]cfRecord{
+		"old": {ID: "old", Type: "A", Name: "gone.app.test", Content: "192.0.2.9", TTL: 1},
+		"ns":  {ID: "ns", Type: "NS", Name: "app.test", Content: "ada.ns.cloudflare.com", TTL: 86400},
+	}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	p := New(config.PublishConfig{IntervalSec: 60, Targets: []config.PublishTarget{
+		{Provider: "cloudflare", Zones: []string{"*.test"}, Endpoint: srv.URL, APIToken: "cf-token"},
+	}}, db)
+	if err := p.Check(context.Background()); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	got := map[string]string{}
+	for _, rec := range fake.records {
+		got[rec.Type+" "+rec.Name+" "+cfPresentation(rec)] = fmt.Sprint(rec.TTL)
+	}
+	want := map[string]string{
+		"NS app.test ada.ns.cloudflare.com.":            "86400",
+		"A www.app.test 192.0.2.1":                      "300",
+		"A www.app.test 192.0.2.2":                      "300",
+		"MX app.test 10 mail.app.test.":                 "60",
+		`TXT app.test "v=spf1 -all"`:                    "300",
+		"SRV _sip._tcp.app.test 0 5 5060 sip.app.test.": "300",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("records: %v", got)
+	}
+	for k, ttl := range want {
+		if got[k] != ttl {
+			t.Fatalf("record %q: ttl %q, have %v", k, got[k], got)
+		}
+	}
+
+	// Same serial: nothing is read or written
+	fake.calls = nil
+	if err := p.Check(context.Background()); err != nil || len(fake.calls) != 0 {
+		t.Fatalf("unchanged zone pushed: %v %v", err, fake.calls)
+	}
+
+	// A new serial pushes only the difference
+	db.Model(&dbm.RRSet{}).Where("name = ? AND type = ?", "www.app.test.", "A").Update("ttl", 600)
+	db.Model(&dbm.Zone{}).Where("id = ?", zone.ID).Update("serial", 2)
+	if err := p.Check(context.Background()); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if strings.Join(fake.calls, ",") != "PATCH,PATCH" {
+		t.Fatalf("calls: %v", fake.calls)
+	}
+}
+
+func TestRoute53_LoadAndApply(t *testing.T) {
+	var changes []r53Change
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			http.Error(w, "unsigned", http.StatusForbidden)
+			return
+		}
+		switch {
+		case r.URL.Path == "/2013-04-01/hostedzonesbyname":
+			io.WriteString(w, `<ListHostedZonesByNameResponse><HostedZones>
+				<HostedZone><Id>/hostedzone/ZPRIV</Id><Name>app.test.</Name><Config><PrivateZone>true</PrivateZone></Config></HostedZone>
+				<HostedZone><Id>/hostedzone/Z1</Id><Name>app.test.</Name><Config><PrivateZone>false</PrivateZone></Config></HostedZone>
+			</HostedZones></ListHostedZonesByNameResponse>`)
+		case r.URL.Path == "/2013-04-01/hostedzone/Z1/rrset" && r.Method == http.MethodGet && r.URL.Query().Get("name") == "":
+			io.WriteString(w, `<ListResourceRecordSetsResponse><ResourceRecordSets>
+				<ResourceRecordSet><Name>app.test.</Name><Type>NS</Type><TTL>172800</TTL><ResourceRecords><ResourceRecord><Value>ns-1.awsdns-00.com.</Value></ResourceRecord></ResourceRecords></ResourceRecordSet>
+				<ResourceRecordSet><Name>\052.app.test.</Name><Type>A</Type><TTL>300</TTL><ResourceRecords><ResourceRecord><Value>192.0.2.1</Value></ResourceRecord></ResourceRecords></ResourceRecordSet>
+			</ResourceRecordSets><IsTruncated>true</IsTruncated><NextRecordName>old.app.test.</NextRecordName><NextRecordType>TXT</NextRecordType></ListResourceRecordSetsResponse>`)
+		case r.URL.Path == "/2013-04-01/hostedzone/Z1/rrset" && r.Method == http.MethodGet:
+			io.WriteString(w, `<ListResourceRecordSetsResponse><ResourceRecordSets>
+				<ResourceRecordSet><Name>old.app.test.</Name><Type>TXT</Type><TTL>60</TTL><ResourceRecords><ResourceRecord><Value>"bye"</Value></ResourceRecord></ResourceRecords></ResourceRecordSet>
+				<ResourceRecordSet><Name>lb.app.test.</Name><Type>A</Type><AliasTarget><HostedZoneId>Z2</HostedZoneId><DNSName>lb.example.</DNSName></AliasTarget></ResourceRecordSet>
+			</ResourceRecordSets><IsTruncated>false</IsTruncated></ListResourceRecordSetsResponse>`)
+		case r.URL.Path == "/2013-04-01/hostedzone/Z1/rrset" && r.Method == http.MethodPost:
+			var req r53ChangeRequest
+			if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			changes = append(changes, req.Changes...)
+			io.WriteString(w, `<ChangeResourceRecordSetsResponse/>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	r53 := NewRoute53(srv.Client(), srv.URL, "AKID", "secret")
+	have, err := r53.Load(context.Background(), "app.test.")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(have) != 2 || have[0].Name != "*.app.test." || have[1].Name != "old.app.test." {
+		t.Fatalf("load: %+v", have)
+	}
+	want := Desired("app.test.", []dbm.RRSet{
+		{Name: "*.app.test.", Type: "A", TTL: 300, Records: []dbm.RData{{Data: "192.0.2.1"}}},
+		{Name: "www.app.test.", Type: "CNAME", TTL: 300, Records: []dbm.RData{{Data: "@"}}},
+	}, r53)
+	if err := r53.Apply(context.Background(), "app.test.", Diff(have, want)); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if len(changes) != 2 ||
+		changes[0].Action != "DELETE" || changes[0].RRSet.Name != "old.app.test." || *changes[0].RRSet.TTL != 60 ||
+		changes[1].Action != "UPSERT" || changes[1].RRSet.Name != "www.app.test." || changes[1].RRSet.ResourceRecords.Records[0].Value != "app.test." {
+		t.Fatalf("changes: %+v", changes)
+	}
+}
+
+func TestSignV4(t *testing.T) {
+	// get-vanilla from the AWS Signature Version 4 test suite
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	signV4(req, nil, "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "us-east-1", "service",
+		time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Fatalf("authorization:\n got %s\nwant %s", got, want)
+	}
+}
+
+func strPtr(s string) *string { return &s }
@@ -0,0 +1,298 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	route53Endpoint = "https://route53.amazonaws.com"
+	route53Version  = "/2013-04-01"
+	route53XMLNS    = "https://route53.amazonaws.com/doc/2013-04-01/"
+	// route53Batch bounds the changes sent in one request; AWS allows 1000.
+	route53Batch = 100
+)
+
+var route53Types = map[string]bool{
+	"A": true, "AAAA": true, "CAA": true, "CNAME": true, "DS": true, "HTTPS": true, "MX": true, "NAPTR": true,
+	"NS": true, "PTR": true, "SPF": true, "SRV": true, "SSHFP": true, "SVCB": true, "TLSA": true, "TXT": true,
+}
+
+// Route53 publishes to Amazon Route 53 hosted zones, signing requests with
+// AWS Signature Version 4.
+type Route53 struct {
+	client    *http.Client
+	endpoint  string
+	keyID     string
+	secretKey string
+	now       func() time.Time
+	zoneIDs   map[string]string // zone name -> hosted zone ID
+}
+
+// NewRoute53 creates a Route53 provider. An empty endpoint means the AWS API.
+func NewRoute53(client *http.Client, endpoint, keyID, secretKey string) *Route53 {
+	if endpoint == "" {
+		endpoint = route53Endpoint
+	}
+	return &Route53{
+		client:    client,
+		endpoint:  strings.TrimRight(endpoint, "/"),
+		keyID:     keyID,
+		secretKey: secretKey,
+		now:       time.Now,
+		zoneIDs:   map[string]string{},
+	}
+}
+
+func (r *Route53) Supports(rtype string) bool { return route53Types[rtype] }
+
+func (r *Route53) MinTTL() uint32 { return 0 }
+
+type r53RRSet struct {
+	Name            string      `xml:"Name"`
+	Type            string      `xml:"Type"`
+	SetIdentifier   string      `xml:"SetIdentifier,omitempty"`
+	TTL             *uint32     `xml:"TTL,omitempty"`
+	ResourceRecords *r53Records `xml:"ResourceRecords,omitempty"`
+	AliasTarget     *struct{}   `xml:"AliasTarget,omitempty"`
+}
+
+type r53Records struct {
+	Records []r53Record `xml:"ResourceRecord"`
+}
+
+type r53Record struct {
+	Value string `xml:"Value"`
+}
+
+type r53Change struct {
+	Action string   `xml:"Action"`
+	RRSet  r53RRSet `xml:"ResourceRecordSet"`
+}
+
+type r53ChangeRequest struct {
+	XMLName xml.Name    `xml:"ChangeResourceRecordSetsRequest"`
+	XMLNS   string      `xml:"xmlns,attr"`
+	Comment string      `xml:"ChangeBatch>Comment"`
+	Changes []r53Change `xml:"ChangeBatch>Changes>Change"`
+}
+
+// Load returns the record sets of the hosted zone for zone. Alias and
+// routing-policy sets (weighted, latency, ...) cannot be expressed in
+// namedot and are left out, so they are never changed.
+func (r *Route53) Load(ctx context.Context, zone string) ([]RRSet, error) {
+	id, err := r.hostedZone(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	apex := strings.ToLower(zone)
+	var out []RRSet
+	q := url.Values{}
+	for {
+		var resp struct {
+			Sets           []r53RRSet `xml:"ResourceRecordSets>ResourceRecordSet"`
+			IsTruncated    bool       `xml:"IsTruncated"`
+			NextRecordName string     `xml:"NextRecordName"`
+			NextRecordType string     `xml:"NextRecordType"`
+		}
+		if err := r.do(ctx, http.MethodGet, route53Version+"/hostedzone/"+id+"/rrset", q, nil, &resp); err != nil {
+			return nil, err
+		}
+		for _, s := range resp.Sets {
+			name := unescapeRoute53(strings.ToLower(s.Name))
+			if s.AliasTarget != nil || s.SetIdentifier != "" || s.ResourceRecords == nil || s.TTL == nil {
+				continue
+			}
+			if name == apex && (s.Type == "SOA" || s.Type == "NS") {
+				continue
+			}
+			rs := RRSet{Name: name, Type: s.Type, TTL: *s.TTL, ref: s}
+			for _, rec := range s.ResourceRecords.Records {
+				c, err := Canonical(name, s.Type, rec.Value)
+				if err != nil {
+					return nil, fmt.Errorf("route53: %s %s: %w", name, s.Type, err)
+				}
+				rs.Data = append(rs.Data, c)
+			}
+			sort.Strings(rs.Data)
+			out = append(out, rs)
+		}
+		if !resp.IsTruncated {
+			return out, nil
+		}
+		q = url.Values{"name": {resp.NextRecordName}, "type": {resp.NextRecordType}}
+	}
+}
+
+// Apply upserts changed sets and deletes removed ones, in batches that each
+// succeed or fail as a whole.
+func (r *Route53) Apply(ctx context.Context, zone string, changes []Change) error {
+	id, err := r.hostedZone(ctx, zone)
+	if err != nil {
+		return err
+	}
+	var batch []r53Change
+	for _, ch := range changes {
+		if ch.After == nil {
+			// A delete must repeat the set exactly as Route53 holds it
+			batch = append(batch, r53Change{Action: "DELETE", RRSet: ch.Before.ref.(r53RRSet)})
+			continue
+		}
+		ttl := ch.After.TTL
+		set := r53RRSet{Name: ch.After.Name, Type: ch.After.Type, TTL: &ttl, ResourceRecords: &r53Records{}}
+		for _, d := range ch.After.Data {
+			set.ResourceRecords.Records = append(set.ResourceRecords.Records, r53Record{Value: d})
+		}
+		batch = append(batch, r53Change{Action: "UPSERT", RRSet: set})
+	}
+	for len(batch) > 0 {
+		n := len(batch)
+		if n > route53Batch {
+			n = route53Batch
+		}
+		req := r53ChangeRequest{XMLNS: route53XMLNS, Comment: "namedot publish", Changes: batch[:n]}
+		body, err := xml.Marshal(req)
+		if err != nil {
+			return err
+		}
+		if err := r.do(ctx, http.MethodPost, route53Version+"/hostedzone/"+id+"/rrset", nil, append([]byte(xml.Header), body...), nil); err != nil {
+			return err
+		}
+		batch = batch[n:]
+	}
+	return nil
+}
+
+// hostedZone returns the ID of the public hosted zone named zone.
+func (r *Route53) hostedZone(ctx context.Context, zone string) (string, error) {
+	zone = strings.ToLower(zone)
+	if id, ok := r.zoneIDs[zone]; ok {
+		return id, nil
+	}
+	var resp struct {
+		Zones []struct {
+			ID      string `xml:"Id"`
+			Name    string `xml:"Name"`
+			Private bool   `xml:"Config>PrivateZone"`
+		} `xml:"HostedZones>HostedZone"`
+	}
+	q := url.Values{"dnsname": {zone}, "maxitems": {"10"}}
+	if err := r.do(ctx, http.MethodGet, route53Version+"/hostedzonesbyname", q, nil, &resp); err != nil {
+		return "", err
+	}
+	for _, z := range resp.Zones {
+		if strings.EqualFold(z.Name, zone) && !z.Private {
+			id := strings.TrimPrefix(z.ID, "/hostedzone/")
+			r.zoneIDs[zone] = id
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("route53: no public hosted zone %s", zone)
+}
+
+func (r *Route53) do(ctx context.Context, method, path string, q url.Values, body []byte, out interface{}) error {
+	u := r.endpoint + path
+	if len(q) > 0 {
+		u += "?" + awsQuery(q)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "text/xml")
+	}
+	signV4(req, body, r.keyID, r.secretKey, "us-east-1", "route53", r.now())
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("route53: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return fmt.Errorf("route53: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Message string `xml:"Error>Message"`
+		}
+		if xml.Unmarshal(data, &e) == nil && e.Message != "" {
+			return fmt.Errorf("route53: %s: %s", resp.Status, e.Message)
+		}
+		return fmt.Errorf("route53: %s", resp.Status)
+	}
+	if out != nil {
+		if err := xml.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("route53: %w", err)
+		}
+	}
+	return nil
+}
+
+// unescapeRoute53 turns the octal escapes Route53 uses in names, such as
+// \052 for the wildcard label, back into characters.
+func unescapeRoute53(name string) string {
+	if !strings.Contains(name, `\`) {
+		return name
+	}
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] == '\\' && i+3 < len(name) && isOctal(name[i+1]) && isOctal(name[i+2]) && isOctal(name[i+3]) {
+			b.WriteByte((name[i+1]-'0')<<6 | (name[i+2]-'0')<<3 | (name[i+3] - '0'))
+			i += 3
+			continue
+		}
+		b.WriteByte(name[i])
+	}
+	return b.String()
+}
+
+func isOctal(c byte) bool { return c >= '0' && c <= '7' }
+
+// awsQuery encodes q the way Signature Version 4 expects: sorted by key,
+// with spaces as %20.
+func awsQuery(q url.Values) string {
+	return strings.ReplaceAll(q.Encode(), "+", "%20")
+}
+
+// signV4 adds an AWS Signature Version 4 Authorization header to req.
+func signV4(req *http.Request, body []byte, keyID, secretKey, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	day := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	payload := sha256.Sum256(body)
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host + "\n" + "x-amz-date:" + amzDate + "\n",
+		"host;x-amz-date",
+		hex.EncodeToString(payload[:]),
+	}, "\n")
+	scope := day + "/" + region + "/" + service + "/aws4_request"
+	hash := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+	key := hmacSHA256([]byte("AWS4"+secretKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	sig := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+keyID+"/"+scope+", SignedHeaders=host;x-amz-date, Signature="+sig)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
@@ -0,0 +1,273 @@
+// Package querylog writes DNS queries to a file as JSON lines, one query per
+// line, rotates the file by size and age, and searches the recent queries
+// in it and in the rotated files.
+package querylog
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"namedot/internal/config"
+	"namedot/internal/metrics"
+)
+
+// queueSize bounds the entries waiting to be written; more are dropped so a
+// slow disk never holds up DNS answers.
+const queueSize = 4096
+
+// flushInterval is how long entries may sit in the write buffer.
+const flushInterval = time.Second
+
+// rotatedFormat is the timestamp suffix of rotated files; it sorts in time
+// order.
+const rotatedFormat = "20060102T150405Z"
+
+var droppedTotal = metrics.NewCounter("namedot_query_log_dropped_total",
+	"Queries not written to the query log because its queue was full.")
+
+// Entry is one logged query.
+type Entry struct {
+	Time      time.Time `json:"time"`
+	Name      string    `json:"qname"`
+	Type      string    `json:"qtype"`
+	Client    string    `json:"client"`           // address the geo decision was made for (ECS or transport)
+	Remote    string    `json:"remote,omitempty"` // transport address, when it differs from client
+	Source    string    `json:"source"`           // cache | hosts | local | blocked | ..., as in the DNS query trace
+	Zone      string    `json:"zone,omitempty"`
+	Rule      string    `json:"rule,omitempty"` // geo rule that selected the records
+	Country   string    `json:"country,omitempty"`
+	Continent string    `json:"continent,omitempty"`
+	ASN       int       `json:"asn,omitempty"`
+	Rcode     string    `json:"rcode"`
+	Answers   []string  `json:"answers,omitempty"`
+	LatencyMs float64   `json:"latency_ms"`
+}
+
+// Log is an open query log.
+type Log struct {
+	cfg   config.QueryLogConfig
+	queue chan Entry
+	stop  chan struct{}
+	done  chan struct{}
+	now   func() time.Time
+
+	mu     sync.Mutex // guards the fields below
+	f      *os.File
+	w      *bufio.Writer
+	size   int64
+	opened time.Time
+}
+
+// Open opens or creates the log file of cfg and starts writing entries
+// passed to Add.
+func Open(cfg config.QueryLogConfig) (*Log, error) {
+	l := &Log{cfg: cfg, queue: make(chan Entry, queueSize), stop: make(chan struct{}),
+		done: make(chan struct{}), now: time.Now}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	go l.run()
+	return l, nil
+}
+
+// open opens the log file for appending. An existing file counts as opened
+// at its first entry, so restarts do not put off age-based rotation.
+func (l *Log) open() error {
+	f, err := os.OpenFile(l.cfg.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("query log: %w", err)
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("query log: %w", err)
+	}
+	l.f, l.w, l.size, l.opened = f, bufio.NewWriter(f), st.Size(), l.now()
+	if l.size > 0 {
+		if t, ok := firstTime(l.cfg.Path); ok {
+			l.opened = t
+		}
+	}
+	return nil
+}
+
+// firstTime returns the time of the first entry in the file at path.
+func firstTime(path string) (time.Time, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil {
+		return time.Time{}, false
+	}
+	var e Entry
+	if json.Unmarshal(line, &e) != nil || e.Time.IsZero() {
+		return time.Time{}, false
+	}
+	return e.Time, true
+}
+
+// Add queues e for writing. It never blocks: when the queue is full the
+// entry is dropped and counted.
+func (l *Log) Add(e Entry) {
+	select {
+	case l.queue <- e:
+	default:
+		droppedTotal.Inc()
+	}
+}
+
+// run writes queued entries until Close.
+func (l *Log) run() {
+	defer close(l.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case e := <-l.queue:
+			l.mu.Lock()
+			l.write(e)
+			l.mu.Unlock()
+		case <-ticker.C:
+			l.mu.Lock()
+			l.flush()
+			l.mu.Unlock()
+		case <-l.stop:
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			for {
+				select {
+				case e := <-l.queue:
+					l.write(e)
+				default:
+					l.flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// write appends e, rotating the file first when it is too large or too old.
+// l.mu must be held.
+func (l *Log) write(e Entry) {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+	if l.size > 0 && l.due(int64(len(line))) {
+		if err := l.rotate(); err != nil {
+			log.Printf("query log: rotate: %v", err)
+		}
+	}
+	if l.w == nil {
+		return
+	}
+	n, err := l.w.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		log.Printf("query log: write: %v", err)
+	}
+}
+
+// due reports whether the file must be rotated before n more bytes.
+func (l *Log) due(n int64) bool {
+	if l.cfg.MaxSizeMB > 0 && l.size+n > int64(l.cfg.MaxSizeMB)<<20 {
+		return true
+	}
+	return l.cfg.MaxAgeHours > 0 && l.now().Sub(l.opened) >= time.Duration(l.cfg.MaxAgeHours)*time.Hour
+}
+
+// rotate renames the current file with the time it was opened as suffix,
+// opens a new one and deletes the rotated files beyond max_files. l.mu must
+// be held.
+func (l *Log) rotate() error {
+	l.flush()
+	if err := l.f.Close(); err != nil {
+		log.Printf("query log: close: %v", err)
+	}
+	l.f, l.w = nil, nil
+	name := l.cfg.Path + "." + l.opened.UTC().Format(rotatedFormat)
+	if _, err := os.Stat(name); err == nil {
+		name += "." + l.now().UTC().Format(rotatedFormat)
+	}
+	renameErr := os.Rename(l.cfg.Path, name)
+	if err := l.open(); err != nil {
+		return err
+	}
+	// Also after a failed rename, so it is not retried for every entry
+	l.opened = l.now()
+	if renameErr != nil {
+		return renameErr
+	}
+	rotated, err := l.rotated()
+	if err != nil {
+		return err
+	}
+	for i, old := range rotated {
+		if i >= l.cfg.MaxFiles {
+			if err := os.Remove(old); err != nil {
+				log.Printf("query log: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// rotated lists the rotated files, newest first.
+func (l *Log) rotated() ([]string, error) {
+	files, err := filepath.Glob(globEscape(l.cfg.Path) + ".*")
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(files)))
+	return files, nil
+}
+
+// globEscape quotes the glob metacharacters in path.
+func globEscape(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		if strings.ContainsRune(`*?[\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// flush writes out buffered entries. l.mu must be held.
+func (l *Log) flush() {
+	if l.w == nil {
+		return
+	}
+	if err := l.w.Flush(); err != nil {
+		log.Printf("query log: write: %v", err)
+	}
+}
+
+// Close writes out the queued entries and closes the file. Entries added
+// afterwards are dropped.
+func (l *Log) Close() error {
+	close(l.stop)
+	<-l.done
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f, l.w = nil, nil
+	return err
+}
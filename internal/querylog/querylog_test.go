@@ -0,0 +1,122 @@
+package querylog
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"namedot/internal/config"
+)
+
+func TestLog_WriteAndSearch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queries.log")
+	l, err := Open(config.QueryLogConfig{Path: path, MaxSizeMB: 100, MaxAgeHours: 24, MaxFiles: 7})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t0 := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	for i, e := range []Entry{
+		{Name: "www.example.com.", Type: "A", Client: "192.0.2.1", Source: "local", Zone: "example.com.", Rule: "country=DE", Rcode: "NOERROR"},
+		{Name: "example.com.", Type: "MX", Client: "192.0.2.2", Source: "local", Zone: "example.com.", Rcode: "NOERROR"},
+		{Name: "www.example.com.", Type: "AAAA", Client: "2001:db8::1", Source: "local", Zone: "example.com.", Rcode: "NOERROR"},
+		{Name: "www.other.net.", Type: "A", Client: "198.51.100.1", Source: "forward", Rcode: "NXDOMAIN"},
+	} {
+		e.Time = t0.Add(time.Duration(i) * time.Minute)
+		l.Add(e)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	l, err = Open(config.QueryLogConfig{Path: path, MaxSizeMB: 100, MaxAgeHours: 24, MaxFiles: 7})
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer l.Close()
+	if !l.opened.Equal(t0) {
+		t.Errorf("reopened log counts from %v, want its first entry %v", l.opened, t0)
+	}
+	for _, tc := range []struct {
+		name string
+		f    Filter
+		want []string // qtypes, newest first
+	}{
+		{"all", Filter{}, []string{"A", "AAAA", "MX", "A"}},
+		{"name and below", Filter{Name: "Example.com"}, []string{"AAAA", "MX", "A"}},
+		{"exact name", Filter{Name: "www.example.com."}, []string{"AAAA", "A"}},
+		{"qtype", Filter{Type: "aaaa"}, []string{"AAAA"}},
+		{"client network", Filter{Client: netip.MustParsePrefix("192.0.2.0/24")}, []string{"MX", "A"}},
+		{"source and rcode", Filter{Source: "forward", Rcode: "nxdomain"}, []string{"A"}},
+		{"zone", Filter{Zone: "example.com"}, []string{"AAAA", "MX", "A"}},
+		{"time range", Filter{Since: t0.Add(time.Minute), Until: t0.Add(3 * time.Minute)}, []string{"AAAA", "MX"}},
+		{"limit", Filter{Limit: 2}, []string{"A", "AAAA"}},
+	} {
+		got, err := l.Search(tc.f)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		var types []string
+		for _, e := range got {
+			types = append(types, e.Type)
+		}
+		if len(types) != len(tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, types, tc.want)
+			continue
+		}
+		for i := range types {
+			if types[i] != tc.want[i] {
+				t.Errorf("%s: got %v, want %v", tc.name, types, tc.want)
+				break
+			}
+		}
+	}
+}
+
+func TestLog_Rotate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "queries.log")
+	l, err := Open(config.QueryLogConfig{Path: path, MaxSizeMB: 100, MaxAgeHours: 1, MaxFiles: 2})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer l.Close()
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	l.mu.Lock()
+	l.opened = now
+	for i := 0; i < 5; i++ {
+		l.write(Entry{Time: now, Name: "www.example.com.", Type: "A", ASN: i})
+		now = now.Add(time.Hour)
+	}
+	l.mu.Unlock()
+
+	// Each hour started a new file; the oldest rotated ones are gone
+	rotated, err := l.rotated()
+	if err != nil {
+		t.Fatalf("rotated: %v", err)
+	}
+	if len(rotated) != 2 || filepath.Base(rotated[0]) != "queries.log.20261001T030000Z" {
+		t.Fatalf("rotated files: %v", rotated)
+	}
+	got, err := l.Search(Filter{})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(got) != 3 || got[0].ASN != 4 || got[2].ASN != 2 {
+		t.Fatalf("entries across files: %+v", got)
+	}
+
+	// Size: a full file is rotated before the next entry
+	l.mu.Lock()
+	l.cfg.MaxAgeHours = 0
+	l.cfg.MaxSizeMB = 1
+	l.size = 1 << 20
+	l.write(Entry{Time: now, Name: "www.example.com.", Type: "A", ASN: 5})
+	l.flush()
+	l.mu.Unlock()
+	if st, err := os.Stat(path); err != nil || st.Size() != l.size || l.size >= 1<<10 {
+		t.Fatalf("new file after size rotation: %v, size %d", err, l.size)
+	}
+}
@@ -0,0 +1,143 @@
+package querylog
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+)
+
+// maxLine bounds the length of a log line read back; longer ones are
+// skipped.
+const maxLine = 1 << 20
+
+// Filter selects entries in Search. Empty fields match everything.
+type Filter struct {
+	Name   string       // query name, matching it and every name below it
+	Type   string       // query type, e.g. AAAA
+	Client netip.Prefix // client address, or the network it is in
+	Source string
+	Zone   string
+	Rcode  string
+	Since  time.Time
+	Until  time.Time
+	Limit  int // most entries returned (default: 100)
+}
+
+// normalize lowercases the names of f and adds the trailing dots, so they
+// compare with logged entries as is.
+func (f *Filter) normalize() {
+	if f.Name != "" {
+		f.Name = strings.ToLower(strings.TrimSuffix(f.Name, ".")) + "."
+	}
+	if f.Zone != "" {
+		f.Zone = strings.ToLower(strings.TrimSuffix(f.Zone, ".")) + "."
+	}
+	f.Type = strings.ToUpper(f.Type)
+	f.Rcode = strings.ToUpper(f.Rcode)
+	if f.Limit <= 0 {
+		f.Limit = 100
+	}
+}
+
+func (f *Filter) match(e *Entry) bool {
+	if f.Name != "" && e.Name != f.Name && !strings.HasSuffix(e.Name, "."+f.Name) {
+		return false
+	}
+	if f.Type != "" && e.Type != f.Type {
+		return false
+	}
+	if f.Source != "" && e.Source != f.Source {
+		return false
+	}
+	if f.Zone != "" && !strings.EqualFold(strings.TrimSuffix(e.Zone, ".")+".", f.Zone) {
+		return false
+	}
+	if f.Rcode != "" && strings.ToUpper(e.Rcode) != f.Rcode {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.Time.Before(f.Until) {
+		return false
+	}
+	if f.Client.IsValid() {
+		a, err := netip.ParseAddr(e.Client)
+		if err != nil || !f.Client.Contains(a.Unmap()) {
+			return false
+		}
+	}
+	return true
+}
+
+// Search returns the most recent entries that match f, newest first,
+// looking through the current file and then the rotated ones. Entries still
+// queued by Add are not seen.
+func (l *Log) Search(f Filter) ([]Entry, error) {
+	f.normalize()
+	l.mu.Lock()
+	l.flush()
+	l.mu.Unlock()
+	rotated, err := l.rotated()
+	if err != nil {
+		return nil, err
+	}
+	var out []Entry
+	for _, path := range append([]string{l.cfg.Path}, rotated...) {
+		found, err := searchFile(path, &f, f.Limit-len(out))
+		if err != nil {
+			if os.IsNotExist(err) {
+				// Rotated or deleted meanwhile
+				continue
+			}
+			return nil, err
+		}
+		out = append(out, found...)
+		if len(out) >= f.Limit {
+			break
+		}
+	}
+	if out == nil {
+		out = []Entry{}
+	}
+	return out, nil
+}
+
+// searchFile returns the last limit entries of the file at path that match
+// f, newest first. Lines that do not parse, e.g. one being written, are
+// skipped.
+func searchFile(path string, f *Filter, limit int) ([]Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	// A ring of the latest matches, so a large file needs no more memory
+	ring := make([]Entry, 0, min(limit, 1024))
+	next := 0
+	sc := bufio.NewScanner(file)
+	sc.Buffer(make([]byte, 64*1024), maxLine)
+	for sc.Scan() {
+		var e Entry
+		if json.Unmarshal(sc.Bytes(), &e) != nil || !f.match(&e) {
+			continue
+		}
+		if len(ring) < limit {
+			ring = append(ring, e)
+			continue
+		}
+		ring[next] = e
+		next = (next + 1) % limit
+	}
+	if err := sc.Err(); err != nil && err != bufio.ErrTooLong {
+		return nil, err
+	}
+	out := make([]Entry, 0, len(ring))
+	for i := len(ring) - 1; i >= 0; i-- {
+		out = append(out, ring[(next+i)%len(ring)])
+	}
+	return out, nil
+}
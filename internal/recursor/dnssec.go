@@ -0,0 +1,398 @@
+package recursor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// supportedAlgorithms are the DNSKEY algorithms that can be verified. Zones
+// signed only with others are treated as unsigned (RFC 4035 section 5.2).
+var supportedAlgorithms = map[uint8]bool{
+	dns.RSASHA1:          true,
+	dns.RSASHA1NSEC3SHA1: true,
+	dns.RSASHA256:        true,
+	dns.RSASHA512:        true,
+	dns.ECDSAP256SHA256:  true,
+	dns.ECDSAP384SHA384:  true,
+	dns.ED25519:          true,
+}
+
+var supportedDigests = map[uint8]bool{dns.SHA1: true, dns.SHA256: true, dns.SHA384: true}
+
+// rrset is one owner/type group of a message section with its signatures.
+type rrset struct {
+	owner string
+	rtype uint16
+	rrs   []dns.RR
+	sigs  []*dns.RRSIG
+}
+
+// group splits a message section into RRsets, in order of appearance.
+func group(section []dns.RR) []*rrset {
+	var out []*rrset
+	index := map[string]*rrset{}
+	get := func(owner string, t uint16) *rrset {
+		owner = dns.CanonicalName(owner)
+		k := fmt.Sprintf("%s|%d", owner, t)
+		if s, ok := index[k]; ok {
+			return s
+		}
+		s := &rrset{owner: owner, rtype: t}
+		index[k] = s
+		out = append(out, s)
+		return s
+	}
+	for _, rr := range section {
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			s := get(sig.Hdr.Name, sig.TypeCovered)
+			s.sigs = append(s.sigs, sig)
+			continue
+		}
+		if rr.Header().Rrtype == dns.TypeOPT {
+			continue
+		}
+		s := get(rr.Header().Name, rr.Header().Rrtype)
+		s.rrs = append(s.rrs, rr)
+	}
+	return out
+}
+
+// verifyRRset checks that one of sigs, made by signer with one of keys and
+// valid now, covers rrs.
+func verifyRRset(rrs []dns.RR, sigs []*dns.RRSIG, signer string, keys []*dns.DNSKEY) error {
+	if len(rrs) == 0 {
+		return fmt.Errorf("empty RRset: %w", ErrBogus)
+	}
+	now := time.Now()
+	for _, sig := range sigs {
+		if !strings.EqualFold(sig.SignerName, signer) || !sig.ValidityPeriod(now) {
+			continue
+		}
+		for _, key := range keys {
+			if key.KeyTag() == sig.KeyTag && key.Algorithm == sig.Algorithm && sig.Verify(key, rrs) == nil {
+				return nil
+			}
+		}
+	}
+	h := rrs[0].Header()
+	return fmt.Errorf("%s %s: no valid signature by %s: %w", h.Name, dns.TypeToString[h.Rrtype], signer, ErrBogus)
+}
+
+// verifyKeys checks the DNSKEY RRset of zone in resp against the DS records
+// from the parent and returns the keys with how long to trust them.
+func verifyKeys(zone string, resp *dns.Msg, ds []*dns.DS) ([]*dns.DNSKEY, time.Duration, error) {
+	var keys, trusted []*dns.DNSKEY
+	var set *rrset
+	for _, s := range group(resp.Answer) {
+		if s.owner == zone && s.rtype == dns.TypeDNSKEY {
+			set = s
+		}
+	}
+	if set == nil {
+		return nil, 0, fmt.Errorf("%s: no DNSKEY: %w", zone, ErrBogus)
+	}
+	ttl := maxCacheTTL
+	for _, rr := range set.rrs {
+		key := rr.(*dns.DNSKEY)
+		keys = append(keys, key)
+		ttl = min(ttl, time.Duration(key.Hdr.Ttl)*time.Second)
+		for _, d := range ds {
+			if key.KeyTag() != d.KeyTag || key.Algorithm != d.Algorithm {
+				continue
+			}
+			if kds := key.ToDS(d.DigestType); kds != nil && strings.EqualFold(kds.Digest, d.Digest) {
+				trusted = append(trusted, key)
+				break
+			}
+		}
+	}
+	if len(trusted) == 0 {
+		return nil, 0, fmt.Errorf("%s: no DNSKEY matches the DS records: %w", zone, ErrBogus)
+	}
+	if err := verifyRRset(set.rrs, set.sigs, zone, trusted); err != nil {
+		return nil, 0, err
+	}
+	return keys, max(ttl, minCacheTTL), nil
+}
+
+// usableDS reports whether any DS record can be checked here.
+func usableDS(ds []*dns.DS) bool {
+	for _, d := range ds {
+		if supportedAlgorithms[d.Algorithm] && supportedDigests[d.DigestType] {
+			return true
+		}
+	}
+	return false
+}
+
+// rootKeys returns the root zone keys, checked against the trust anchor.
+func (r *Resolver) rootKeys(b *budget) (zoneKeys, error) {
+	if zk, ok := r.cachedKeys("."); ok {
+		return zk, nil
+	}
+	if !b.take() {
+		return zoneKeys{}, fmt.Errorf(".: %w", errDepth)
+	}
+	resp, err := r.exchange(r.roots, ".", dns.TypeDNSKEY)
+	if err != nil {
+		return zoneKeys{}, err
+	}
+	keys, ttl, err := verifyKeys(".", resp, r.anchors)
+	if err != nil {
+		return zoneKeys{}, err
+	}
+	zk := zoneKeys{keys: keys, secure: true, expires: time.Now().Add(ttl)}
+	r.storeKeys(".", zk)
+	return zk, nil
+}
+
+// childKeys establishes the keys of child, a zone below zone. The DS
+// records come from the referral in resp, or are asked of parentAddrs when
+// resp is nil. A child without DS is unsigned if the parent proves it.
+func (r *Resolver) childKeys(zone string, zk zoneKeys, child string, resp *dns.Msg, parentAddrs, childAddrs []string, b *budget) (zoneKeys, error) {
+	if ck, ok := r.cachedKeys(child); ok {
+		return ck, nil
+	}
+	insecure := zoneKeys{expires: time.Now().Add(time.Hour)}
+	if !zk.secure {
+		r.storeKeys(child, insecure)
+		return insecure, nil
+	}
+	var section []dns.RR
+	if resp != nil {
+		section = resp.Ns
+	} else {
+		if !b.take() {
+			return zoneKeys{}, fmt.Errorf("%s: %w", child, errDepth)
+		}
+		dsResp, err := r.exchange(parentAddrs, child, dns.TypeDS)
+		if err != nil {
+			return zoneKeys{}, err
+		}
+		section = append(append([]dns.RR{}, dsResp.Answer...), dsResp.Ns...)
+	}
+
+	var dsSet *rrset
+	for _, s := range group(section) {
+		if s.owner == child && s.rtype == dns.TypeDS {
+			dsSet = s
+		}
+	}
+	if dsSet == nil {
+		if err := proveNoDS(section, child, zone, zk.keys); err != nil {
+			return zoneKeys{}, err
+		}
+		r.storeKeys(child, insecure)
+		return insecure, nil
+	}
+	if err := verifyRRset(dsSet.rrs, dsSet.sigs, zone, zk.keys); err != nil {
+		return zoneKeys{}, err
+	}
+	ds := make([]*dns.DS, 0, len(dsSet.rrs))
+	for _, rr := range dsSet.rrs {
+		ds = append(ds, rr.(*dns.DS))
+	}
+	if !usableDS(ds) {
+		r.storeKeys(child, insecure)
+		return insecure, nil
+	}
+	if !b.take() {
+		return zoneKeys{}, fmt.Errorf("%s: %w", child, errDepth)
+	}
+	keyResp, err := r.exchange(childAddrs, child, dns.TypeDNSKEY)
+	if err != nil {
+		return zoneKeys{}, err
+	}
+	keys, ttl, err := verifyKeys(child, keyResp, ds)
+	if err != nil {
+		return zoneKeys{}, err
+	}
+	ck := zoneKeys{keys: keys, secure: true, expires: time.Now().Add(ttl)}
+	r.storeKeys(child, ck)
+	return ck, nil
+}
+
+// signedDenial returns the NSEC and NSEC3 records of section whose
+// signatures by zone verify.
+func signedDenial(section []dns.RR, zone string, keys []*dns.DNSKEY) ([]*dns.NSEC, []*dns.NSEC3) {
+	var nsec []*dns.NSEC
+	var nsec3 []*dns.NSEC3
+	for _, s := range group(section) {
+		if s.rtype != dns.TypeNSEC && s.rtype != dns.TypeNSEC3 {
+			continue
+		}
+		if verifyRRset(s.rrs, s.sigs, zone, keys) != nil {
+			continue
+		}
+		for _, rr := range s.rrs {
+			switch rr := rr.(type) {
+			case *dns.NSEC:
+				nsec = append(nsec, rr)
+			case *dns.NSEC3:
+				nsec3 = append(nsec3, rr)
+			}
+		}
+	}
+	return nsec, nsec3
+}
+
+// proveNoDS checks that the signed denial records of section show child has
+// no DS record, or lies in an opt-out span.
+func proveNoDS(section []dns.RR, child, zone string, keys []*dns.DNSKEY) error {
+	nsec, nsec3 := signedDenial(section, zone, keys)
+	for _, n := range nsec {
+		if strings.EqualFold(n.Hdr.Name, child) && !hasType(n.TypeBitMap, dns.TypeDS) {
+			return nil
+		}
+	}
+	for _, n := range nsec3 {
+		if n.Match(child) && !hasType(n.TypeBitMap, dns.TypeDS) {
+			return nil
+		}
+		if n.Flags&1 == 1 && n.Cover(child) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: delegation without DS or proof of its absence: %w", child, ErrBogus)
+}
+
+// verifyResponse validates an answer or negative answer from zone, whose
+// keys are zk. RRsets signed by a zone below it (served by the same
+// servers) are checked against that zone's keys. It reports whether the
+// response is secure.
+func (r *Resolver) verifyResponse(resp *dns.Msg, name string, qtype uint16, zone string, zk zoneKeys, addrs []string, b *budget) (bool, error) {
+	secure := true
+	denialKeys := zk.keys
+	denialZone := zone
+	check := func(s *rrset) error {
+		if len(s.sigs) == 0 {
+			return fmt.Errorf("%s %s: missing RRSIG: %w", s.owner, dns.TypeToString[s.rtype], ErrBogus)
+		}
+		signer := dns.CanonicalName(s.sigs[0].SignerName)
+		keys := zk
+		if signer != zone {
+			if !dns.IsSubDomain(zone, signer) || !dns.IsSubDomain(signer, s.owner) {
+				return fmt.Errorf("%s: signer %s outside %s: %w", s.owner, signer, zone, ErrBogus)
+			}
+			ck, err := r.childKeys(zone, zk, signer, nil, addrs, addrs, b)
+			if err != nil {
+				return err
+			}
+			if !ck.secure {
+				secure = false
+				return nil
+			}
+			keys = ck
+			if s.rtype == dns.TypeSOA {
+				denialKeys, denialZone = ck.keys, signer
+			}
+		}
+		return verifyRRset(s.rrs, s.sigs, signer, keys.keys)
+	}
+
+	for _, s := range group(resp.Answer) {
+		if err := check(s); err != nil {
+			return false, err
+		}
+	}
+	// A CNAME leading out of this response is followed by the caller
+	positive := cnameTarget(resp.Answer, name, qtype) != ""
+	for _, rr := range resp.Answer {
+		if rr.Header().Rrtype == qtype {
+			positive = true
+		}
+	}
+	if positive {
+		return secure, nil
+	}
+
+	for _, s := range group(resp.Ns) {
+		if s.rtype == dns.TypeNS {
+			continue
+		}
+		if err := check(s); err != nil {
+			return false, err
+		}
+	}
+	if !secure {
+		return false, nil
+	}
+	nsec, nsec3 := signedDenial(resp.Ns, denialZone, denialKeys)
+	if !provesDenial(nsec, nsec3, name, qtype, denialZone, resp.Rcode == dns.RcodeNameError) {
+		return false, fmt.Errorf("%s %s: negative answer without proof: %w", name, dns.TypeToString[qtype], ErrBogus)
+	}
+	return true, nil
+}
+
+// provesDenial reports whether the denial records show that name does not
+// exist (nxdomain) or has no qtype records.
+func provesDenial(nsec []*dns.NSEC, nsec3 []*dns.NSEC3, name string, qtype uint16, zone string, nxdomain bool) bool {
+	for _, n := range nsec {
+		owner := dns.CanonicalName(n.Hdr.Name)
+		if nxdomain {
+			if nsecCovers(owner, dns.CanonicalName(n.NextDomain), name) {
+				return true
+			}
+			continue
+		}
+		if owner == name && !hasType(n.TypeBitMap, qtype) && !hasType(n.TypeBitMap, dns.TypeCNAME) {
+			return true
+		}
+		// Empty non-terminal: nothing at name, but names below it exist
+		if next := dns.CanonicalName(n.NextDomain); nsecCovers(owner, next, name) && dns.IsSubDomain(name, next) {
+			return true
+		}
+	}
+	for _, n := range nsec3 {
+		if nxdomain {
+			// The next closer name of the closest encloser is covered
+			for x := name; x != zone && dns.IsSubDomain(zone, x); x = parent(x) {
+				if n.Cover(x) {
+					return true
+				}
+			}
+			continue
+		}
+		if n.Match(name) && !hasType(n.TypeBitMap, qtype) && !hasType(n.TypeBitMap, dns.TypeCNAME) {
+			return true
+		}
+		if qtype == dns.TypeDS && n.Flags&1 == 1 && n.Cover(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasType(bitmap []uint16, t uint16) bool {
+	for _, b := range bitmap {
+		if b == t {
+			return true
+		}
+	}
+	return false
+}
+
+// nsecCovers reports whether name falls between owner and next in canonical
+// order; the last NSEC of a zone wraps around to the apex.
+func nsecCovers(owner, next, name string) bool {
+	if canonicalCompare(owner, next) < 0 {
+		return canonicalCompare(owner, name) < 0 && canonicalCompare(name, next) < 0
+	}
+	return canonicalCompare(owner, name) < 0 && dns.IsSubDomain(next, name)
+}
+
+// canonicalCompare orders names as in RFC 4034 section 6.1: label by label
+// from the root, case-insensitively.
+func canonicalCompare(a, b string) int {
+	la := dns.SplitDomainName(strings.ToLower(a))
+	lb := dns.SplitDomainName(strings.ToLower(b))
+	for i, j := len(la)-1, len(lb)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if c := strings.Compare(la[i], lb[j]); c != 0 {
+			return c
+		}
+	}
+	return len(la) - len(lb)
+}
@@ -0,0 +1,428 @@
+// Package recursor resolves names iteratively from the root servers, so
+// namedot can answer names outside its zones without a forwarder.
+// Delegations and zone keys are cached; answers can be validated with
+// DNSSEC against the root trust anchor.
+package recursor
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"namedot/internal/config"
+)
+
+const (
+	// maxCached bounds the delegation and key caches; they are cleared when full.
+	maxCached = 10000
+	// Bounds for how long a delegation or a zone's keys are cached.
+	minCacheTTL = 5 * time.Second
+	maxCacheTTL = 24 * time.Hour
+	// serversPerQuery is how many addresses of a zone are tried per question.
+	serversPerQuery = 3
+)
+
+var (
+	// ErrBogus is returned when DNSSEC validation of an answer fails.
+	ErrBogus     = errors.New("DNSSEC validation failed")
+	errNoServers = errors.New("no name server answered")
+	errDepth     = errors.New("too many referrals or CNAMEs")
+)
+
+// Resolver is an iterative resolver. It is safe for concurrent use.
+type Resolver struct {
+	udp      *dns.Client
+	tcp      *dns.Client
+	port     string
+	roots    []string
+	anchors  []*dns.DS
+	validate bool
+	maxDepth int
+
+	mu          sync.Mutex
+	delegations map[string]delegation
+	keys        map[string]zoneKeys
+}
+
+// delegation is a cached zone cut: the addresses of the zone's servers.
+type delegation struct {
+	addrs   []string
+	expires time.Time
+}
+
+// zoneKeys are the validated DNSKEYs of a zone; secure is false for zones
+// proven unsigned.
+type zoneKeys struct {
+	keys    []*dns.DNSKEY
+	secure  bool
+	expires time.Time
+}
+
+// New creates a resolver for cfg. timeout applies to each upstream exchange.
+func New(cfg config.RecursionConfig, timeout time.Duration) (*Resolver, error) {
+	r := &Resolver{
+		udp:         &dns.Client{Timeout: timeout},
+		tcp:         &dns.Client{Net: "tcp", Timeout: timeout},
+		port:        "53",
+		roots:       rootServers,
+		anchors:     rootAnchors(),
+		validate:    cfg.DNSSEC,
+		maxDepth:    cfg.MaxDepth,
+		delegations: make(map[string]delegation),
+		keys:        make(map[string]zoneKeys),
+	}
+	if r.maxDepth <= 0 {
+		r.maxDepth = 30
+	}
+	if cfg.RootHints != "" {
+		roots, err := loadHints(cfg.RootHints)
+		if err != nil {
+			return nil, fmt.Errorf("root_hints: %w", err)
+		}
+		r.roots = roots
+	}
+	return r, nil
+}
+
+// loadHints reads the root server addresses from a named.root file. IPv4
+// addresses come first.
+func loadHints(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var v4, v6 []string
+	zp := dns.NewZoneParser(f, ".", path)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		switch rr := rr.(type) {
+		case *dns.A:
+			v4 = append(v4, rr.A.String())
+		case *dns.AAAA:
+			v6 = append(v6, rr.AAAA.String())
+		}
+	}
+	if err := zp.Err(); err != nil {
+		return nil, err
+	}
+	if len(v4)+len(v6) == 0 {
+		return nil, fmt.Errorf("%s: no root server addresses", path)
+	}
+	return append(v4, v6...), nil
+}
+
+// budget counts the upstream steps left for one client question.
+type budget struct{ left int }
+
+func (b *budget) take() bool {
+	b.left--
+	return b.left >= 0
+}
+
+// Resolve answers name/qtype, following CNAMEs across zones. The returned
+// message carries the rcode, the answer chain and the authority section of
+// the last response, without DNSSEC records; AuthenticatedData is set when
+// validation is on and every step was secure.
+func (r *Resolver) Resolve(name string, qtype uint16) (*dns.Msg, error) {
+	name = dns.CanonicalName(name)
+	b := &budget{left: r.maxDepth}
+	out := new(dns.Msg)
+	secure := r.validate
+	seen := map[string]bool{name: true}
+	for {
+		resp, sec, err := r.iterate(name, qtype, b)
+		if err != nil {
+			return nil, err
+		}
+		secure = secure && sec
+		out.Rcode = resp.Rcode
+		out.Answer = append(out.Answer, resp.Answer...)
+		out.Ns = resp.Ns
+		target := cnameTarget(resp.Answer, name, qtype)
+		if target == "" {
+			break
+		}
+		if seen[target] || !b.take() {
+			return nil, fmt.Errorf("%s: %w", name, errDepth)
+		}
+		seen[target] = true
+		name = target
+	}
+	out.Answer = stripDNSSEC(out.Answer, qtype)
+	out.Ns = stripDNSSEC(out.Ns, qtype)
+	out.AuthenticatedData = secure
+	return out, nil
+}
+
+// cnameTarget follows the CNAME chain for name in answer and returns where
+// it leaves off, or "" when the answer is complete.
+func cnameTarget(answer []dns.RR, name string, qtype uint16) string {
+	if qtype == dns.TypeCNAME {
+		return ""
+	}
+	cur := name
+	for range answer {
+		next := ""
+		for _, rr := range answer {
+			if !strings.EqualFold(rr.Header().Name, cur) {
+				continue
+			}
+			if rr.Header().Rrtype == qtype {
+				return ""
+			}
+			if c, ok := rr.(*dns.CNAME); ok {
+				next = dns.CanonicalName(c.Target)
+			}
+		}
+		if next == "" {
+			break
+		}
+		cur = next
+	}
+	if cur == name {
+		return ""
+	}
+	return cur
+}
+
+// stripDNSSEC drops signatures and denial records, which are only used for
+// validation here, unless the question asked for them.
+func stripDNSSEC(rrs []dns.RR, qtype uint16) []dns.RR {
+	out := rrs[:0:0]
+	for _, rr := range rrs {
+		switch t := rr.Header().Rrtype; t {
+		case dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3:
+			if t != qtype {
+				continue
+			}
+		}
+		out = append(out, rr)
+	}
+	return out
+}
+
+// iterate follows referrals from the closest known zone cut down to the
+// servers that answer name/qtype.
+func (r *Resolver) iterate(name string, qtype uint16, b *budget) (*dns.Msg, bool, error) {
+	zone, addrs, zk, err := r.closest(name, b)
+	if err != nil {
+		return nil, false, err
+	}
+	for {
+		if !b.take() {
+			return nil, false, fmt.Errorf("%s: %w", name, errDepth)
+		}
+		resp, err := r.exchange(addrs, name, qtype)
+		if err != nil {
+			return nil, false, err
+		}
+		child := referral(resp, zone, name)
+		if child == "" {
+			secure := zk.secure
+			if r.validate && secure {
+				if secure, err = r.verifyResponse(resp, name, qtype, zone, zk, addrs, b); err != nil {
+					return nil, false, err
+				}
+			}
+			return resp, secure, nil
+		}
+		childAddrs, ttl := r.glue(resp, child, zone, b)
+		if len(childAddrs) == 0 {
+			return nil, false, fmt.Errorf("%s: no addresses for the servers of %s: %w", name, child, errNoServers)
+		}
+		if r.validate {
+			if zk, err = r.childKeys(zone, zk, child, resp, addrs, childAddrs, b); err != nil {
+				return nil, false, err
+			}
+		}
+		r.storeDelegation(child, childAddrs, ttl)
+		zone, addrs = child, childAddrs
+	}
+}
+
+// closest returns the deepest cached zone cut above name, falling back to
+// the root. With validation only cuts whose keys are still cached count.
+func (r *Resolver) closest(name string, b *budget) (string, []string, zoneKeys, error) {
+	now := time.Now()
+	r.mu.Lock()
+	for z := name; z != "."; z = parent(z) {
+		d, ok := r.delegations[z]
+		if !ok || now.After(d.expires) {
+			continue
+		}
+		zk, ok := r.keys[z]
+		if r.validate && (!ok || now.After(zk.expires)) {
+			continue
+		}
+		r.mu.Unlock()
+		return z, d.addrs, zk, nil
+	}
+	r.mu.Unlock()
+	if !r.validate {
+		return ".", r.roots, zoneKeys{}, nil
+	}
+	zk, err := r.rootKeys(b)
+	return ".", r.roots, zk, err
+}
+
+func (r *Resolver) storeDelegation(zone string, addrs []string, ttl time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.delegations) >= maxCached {
+		clear(r.delegations)
+	}
+	r.delegations[zone] = delegation{addrs: addrs, expires: time.Now().Add(ttl)}
+}
+
+func (r *Resolver) storeKeys(zone string, zk zoneKeys) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.keys) >= maxCached {
+		clear(r.keys)
+	}
+	r.keys[zone] = zk
+}
+
+func (r *Resolver) cachedKeys(zone string) (zoneKeys, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	zk, ok := r.keys[zone]
+	if !ok || time.Now().After(zk.expires) {
+		return zoneKeys{}, false
+	}
+	return zk, true
+}
+
+// exchange asks up to serversPerQuery of addrs for name/qtype without
+// recursion, retrying truncated replies over TCP.
+func (r *Resolver) exchange(addrs []string, name string, qtype uint16) (*dns.Msg, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	m.RecursionDesired = false
+	m.SetEdns0(1232, r.validate)
+
+	order := make([]string, len(addrs))
+	copy(order, addrs)
+	rand.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+	if len(order) > serversPerQuery {
+		order = order[:serversPerQuery]
+	}
+	lastErr := errNoServers
+	for _, addr := range order {
+		hp := net.JoinHostPort(addr, r.port)
+		in, _, err := r.udp.Exchange(m, hp)
+		if err == nil && in.Truncated {
+			in, _, err = r.tcp.Exchange(m, hp)
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if len(in.Question) != 1 || !strings.EqualFold(in.Question[0].Name, name) || in.Question[0].Qtype != qtype {
+			lastErr = fmt.Errorf("%s: reply does not match the question", addr)
+			continue
+		}
+		if in.Rcode != dns.RcodeSuccess && in.Rcode != dns.RcodeNameError {
+			lastErr = fmt.Errorf("%s: %s", addr, dns.RcodeToString[in.Rcode])
+			continue
+		}
+		return in, nil
+	}
+	return nil, fmt.Errorf("%s %s: %w", name, dns.TypeToString[qtype], lastErr)
+}
+
+// referral returns the child zone a response delegates name to, or "" when
+// the response is an answer or a negative answer.
+func referral(resp *dns.Msg, zone, name string) string {
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) > 0 {
+		return ""
+	}
+	child := ""
+	for _, rr := range resp.Ns {
+		switch rr.Header().Rrtype {
+		case dns.TypeSOA:
+			return ""
+		case dns.TypeNS:
+			owner := dns.CanonicalName(rr.Header().Name)
+			if owner != zone && dns.IsSubDomain(zone, owner) && dns.IsSubDomain(owner, name) {
+				child = owner
+			}
+		}
+	}
+	return child
+}
+
+// glue returns the server addresses for a referral to child, from in-bailiwick
+// glue or by resolving the server names, and how long to cache them.
+func (r *Resolver) glue(resp *dns.Msg, child, zone string, b *budget) ([]string, time.Duration) {
+	ttl := maxCacheTTL
+	var names []string
+	for _, rr := range resp.Ns {
+		if ns, ok := rr.(*dns.NS); ok && strings.EqualFold(ns.Hdr.Name, child) {
+			names = append(names, dns.CanonicalName(ns.Ns))
+			ttl = min(ttl, time.Duration(ns.Hdr.Ttl)*time.Second)
+		}
+	}
+	ttl = max(ttl, minCacheTTL)
+	isServer := func(owner string) bool {
+		owner = dns.CanonicalName(owner)
+		for _, n := range names {
+			if n == owner {
+				return dns.IsSubDomain(zone, owner)
+			}
+		}
+		return false
+	}
+	var v4, v6 []string
+	for _, rr := range resp.Extra {
+		switch rr := rr.(type) {
+		case *dns.A:
+			if isServer(rr.Hdr.Name) {
+				v4 = append(v4, rr.A.String())
+			}
+		case *dns.AAAA:
+			if isServer(rr.Hdr.Name) {
+				v6 = append(v6, rr.AAAA.String())
+			}
+		}
+	}
+	if len(v4)+len(v6) > 0 {
+		return append(v4, v6...), ttl
+	}
+	// No usable glue: look the server names up, skipping those that would
+	// need this very delegation
+	for _, n := range names {
+		if dns.IsSubDomain(child, n) {
+			continue
+		}
+		resp, _, err := r.iterate(n, dns.TypeA, b)
+		if err != nil {
+			continue
+		}
+		for _, rr := range resp.Answer {
+			if a, ok := rr.(*dns.A); ok {
+				v4 = append(v4, a.A.String())
+			}
+		}
+		if len(v4) > 0 {
+			break
+		}
+	}
+	return v4, ttl
+}
+
+// parent returns the zone above name ("." for a top-level name).
+func parent(name string) string {
+	i, end := dns.NextLabel(name, 0)
+	if end {
+		return "."
+	}
+	return name[i:]
+}
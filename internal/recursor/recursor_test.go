@@ -0,0 +1,332 @@
+package recursor
+
+import (
+	"crypto"
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"namedot/internal/config"
+)
+
+// testZone is a small authoritative zone, optionally signed, served by a
+// fake name server for the tests.
+type testZone struct {
+	name    string
+	rrs     []dns.RR
+	key     *dns.DNSKEY
+	priv    crypto.Signer
+	queries atomic.Int32
+}
+
+func newZone(t *testing.T, name string, signed bool, records ...string) *testZone {
+	z := &testZone{name: name}
+	for _, s := range records {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+		z.rrs = append(z.rrs, rr)
+	}
+	if signed {
+		z.key = &dns.DNSKEY{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+			Flags: 257, Protocol: 3, Algorithm: dns.ECDSAP256SHA256}
+		priv, err := z.key.Generate(256)
+		if err != nil {
+			t.Fatal(err)
+		}
+		z.priv = priv.(crypto.Signer)
+		z.rrs = append(z.rrs, z.key)
+	}
+	return z
+}
+
+func (z *testZone) ds() *dns.DS { return z.key.ToDS(dns.SHA256) }
+
+// sign adds NSEC records and signatures for every authoritative RRset.
+func (z *testZone) sign(t *testing.T) {
+	byOwner := map[string][]uint16{}
+	for _, rr := range z.rrs {
+		owner := dns.CanonicalName(rr.Header().Name)
+		if z.belowCut(owner) {
+			continue
+		}
+		byOwner[owner] = append(byOwner[owner], rr.Header().Rrtype)
+	}
+	owners := make([]string, 0, len(byOwner))
+	for o := range byOwner {
+		owners = append(owners, o)
+	}
+	sort.Slice(owners, func(i, j int) bool { return canonicalCompare(owners[i], owners[j]) < 0 })
+	for i, o := range owners {
+		types := append(byOwner[o], dns.TypeRRSIG, dns.TypeNSEC)
+		sort.Slice(types, func(a, b int) bool { return types[a] < types[b] })
+		z.rrs = append(z.rrs, &dns.NSEC{Hdr: dns.RR_Header{Name: o, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: 300},
+			NextDomain: owners[(i+1)%len(owners)], TypeBitMap: dedupe(types)})
+	}
+	for _, s := range group(z.rrs) {
+		if z.belowCut(s.owner) || (s.rtype == dns.TypeNS && s.owner != z.name) {
+			continue
+		}
+		z.rrs = append(z.rrs, z.rrsig(t, s.rrs))
+	}
+}
+
+func (z *testZone) rrsig(t *testing.T, rrs []dns.RR) *dns.RRSIG {
+	h := rrs[0].Header()
+	sig := &dns.RRSIG{Hdr: dns.RR_Header{Name: h.Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: h.Ttl},
+		TypeCovered: h.Rrtype, Algorithm: z.key.Algorithm, Labels: uint8(dns.CountLabel(h.Name)), OrigTtl: h.Ttl,
+		Expiration: uint32(time.Now().Add(time.Hour).Unix()), Inception: uint32(time.Now().Add(-time.Hour).Unix()),
+		KeyTag: z.key.KeyTag(), SignerName: z.name}
+	if err := sig.Sign(z.priv, rrs); err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
+
+func dedupe(types []uint16) []uint16 {
+	out := types[:0]
+	for i, v := range types {
+		if i == 0 || v != types[i-1] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// cut returns the delegation in z that covers name, if any.
+func (z *testZone) cut(name string) string {
+	for _, rr := range z.rrs {
+		owner := dns.CanonicalName(rr.Header().Name)
+		if rr.Header().Rrtype == dns.TypeNS && owner != z.name && dns.IsSubDomain(owner, name) {
+			return owner
+		}
+	}
+	return ""
+}
+
+func (z *testZone) belowCut(name string) bool {
+	c := z.cut(name)
+	return c != "" && c != name
+}
+
+func (z *testZone) find(name string, t uint16) []dns.RR {
+	var out []dns.RR
+	for _, rr := range z.rrs {
+		if dns.CanonicalName(rr.Header().Name) != name {
+			continue
+		}
+		if rr.Header().Rrtype == t {
+			out = append(out, rr)
+		}
+		if sig, ok := rr.(*dns.RRSIG); ok && sig.TypeCovered == t {
+			out = append(out, rr)
+		}
+	}
+	return out
+}
+
+func (z *testZone) serve(w dns.ResponseWriter, r *dns.Msg) {
+	z.queries.Add(1)
+	q := r.Question[0]
+	name := dns.CanonicalName(q.Name)
+	m := new(dns.Msg)
+	m.SetReply(r)
+	if c := z.cut(name); c != "" && !(c == name && q.Qtype == dns.TypeDS) {
+		m.Ns = append(z.find(c, dns.TypeNS), z.find(c, dns.TypeDS)...)
+		if len(z.find(c, dns.TypeDS)) == 0 {
+			m.Ns = append(m.Ns, z.find(c, dns.TypeNSEC)...)
+		}
+		for _, rr := range z.find(c, dns.TypeNS) {
+			m.Extra = append(m.Extra, z.find(dns.CanonicalName(rr.(*dns.NS).Ns), dns.TypeA)...)
+		}
+		_ = w.WriteMsg(m)
+		return
+	}
+	m.Authoritative = true
+	if ans := z.find(name, q.Qtype); len(ans) > 0 {
+		m.Answer = ans
+	} else if ans := z.find(name, dns.TypeCNAME); len(ans) > 0 {
+		m.Answer = ans
+	} else {
+		m.Ns = z.find(z.name, dns.TypeSOA)
+		exists := false
+		for _, rr := range z.rrs {
+			if dns.CanonicalName(rr.Header().Name) == name {
+				exists = true
+			}
+		}
+		if !exists {
+			m.Rcode = dns.RcodeNameError
+		}
+		for _, rr := range z.rrs {
+			if n, ok := rr.(*dns.NSEC); ok && (n.Hdr.Name == name || nsecCovers(n.Hdr.Name, n.NextDomain, name)) {
+				m.Ns = append(m.Ns, z.find(n.Hdr.Name, dns.TypeNSEC)...)
+			}
+		}
+	}
+	_ = w.WriteMsg(m)
+}
+
+// startServers serves each zone on its own loopback address, all on one port.
+func startServers(t *testing.T, zones map[string]*testZone) string {
+	var port string
+	for _, ip := range []string{"127.0.0.1", "127.0.0.2"} {
+		pc, err := net.ListenPacket("udp", net.JoinHostPort(ip, port))
+		if err != nil {
+			t.Skipf("listen on %s: %v", ip, err)
+		}
+		if port == "" {
+			_, port, _ = net.SplitHostPort(pc.LocalAddr().String())
+		}
+		srv := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(zones[ip].serve)}
+		started := make(chan struct{})
+		srv.NotifyStartedFunc = func() { close(started) }
+		go func() { _ = srv.ActivateAndServe() }()
+		<-started
+		t.Cleanup(func() { _ = srv.Shutdown() })
+	}
+	return port
+}
+
+// hierarchy builds a root zone on 127.0.0.1 delegating example. to
+// 127.0.0.2; the delegation has a DS record when secure is set.
+func hierarchy(t *testing.T, signed, secure bool) (root, example *testZone) {
+	example = newZone(t, "example.", signed,
+		"example. 3600 IN SOA ns.example. hostmaster.example. 1 7200 3600 1209600 300",
+		"example. 3600 IN NS ns.example.",
+		"ns.example. 3600 IN A 127.0.0.2",
+		"www.example. 300 IN A 192.0.2.80",
+		"alias.example. 300 IN CNAME www.example.",
+	)
+	root = newZone(t, ".", signed,
+		". 3600 IN SOA a.root. hostmaster.root. 1 7200 3600 1209600 300",
+		". 3600 IN NS a.root.",
+		"a.root. 3600 IN A 127.0.0.1",
+		"example. 3600 IN NS ns.example.",
+		"ns.example. 3600 IN A 127.0.0.2",
+	)
+	if signed {
+		if secure {
+			root.rrs = append(root.rrs, example.ds())
+		}
+		root.sign(t)
+		example.sign(t)
+	}
+	return root, example
+}
+
+func newTestResolver(t *testing.T, port string, validate bool, anchor *dns.DS) *Resolver {
+	r, err := New(config.RecursionConfig{Enabled: true, DNSSEC: validate}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.port = port
+	r.roots = []string{"127.0.0.1"}
+	if anchor != nil {
+		r.anchors = []*dns.DS{anchor}
+	}
+	return r
+}
+
+func TestResolve_Iterative(t *testing.T) {
+	root, example := hierarchy(t, false, false)
+	port := startServers(t, map[string]*testZone{"127.0.0.1": root, "127.0.0.2": example})
+	r := newTestResolver(t, port, false, nil)
+
+	m, err := r.Resolve("Alias.Example.", dns.TypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Rcode != dns.RcodeSuccess || len(m.Answer) != 2 || m.Answer[1].(*dns.A).A.String() != "192.0.2.80" {
+		t.Fatalf("unexpected answer: %v", m)
+	}
+	if m.AuthenticatedData {
+		t.Fatal("AD set without validation")
+	}
+
+	// The delegation to example. is cached
+	rootQueries := root.queries.Load()
+	m, err = r.Resolve("nope.example.", dns.TypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Rcode != dns.RcodeNameError {
+		t.Fatalf("rcode = %s, want NXDOMAIN", dns.RcodeToString[m.Rcode])
+	}
+	if root.queries.Load() != rootQueries {
+		t.Fatal("root asked again despite cached delegation")
+	}
+}
+
+func TestResolve_DNSSEC(t *testing.T) {
+	root, example := hierarchy(t, true, true)
+	port := startServers(t, map[string]*testZone{"127.0.0.1": root, "127.0.0.2": example})
+	r := newTestResolver(t, port, true, root.ds())
+
+	m, err := r.Resolve("alias.example.", dns.TypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.AuthenticatedData || len(m.Answer) != 2 {
+		t.Fatalf("want secure answer, got %v", m)
+	}
+	for _, rr := range m.Answer {
+		if rr.Header().Rrtype == dns.TypeRRSIG {
+			t.Fatalf("signatures not stripped: %v", m.Answer)
+		}
+	}
+	m, err = r.Resolve("nope.example.", dns.TypeA)
+	if err != nil || m.Rcode != dns.RcodeNameError || !m.AuthenticatedData {
+		t.Fatalf("want secure NXDOMAIN, got %v %v", m, err)
+	}
+	m, err = r.Resolve("www.example.", dns.TypeMX)
+	if err != nil || m.Rcode != dns.RcodeSuccess || len(m.Answer) != 0 || !m.AuthenticatedData {
+		t.Fatalf("want secure NODATA, got %v %v", m, err)
+	}
+
+	// A record changed after signing fails validation
+	for _, rr := range example.rrs {
+		if a, ok := rr.(*dns.A); ok && a.Hdr.Name == "www.example." {
+			a.A = net.ParseIP("198.51.100.1")
+		}
+	}
+	if _, err := r.Resolve("www.example.", dns.TypeA); !errors.Is(err, ErrBogus) {
+		t.Fatalf("want ErrBogus, got %v", err)
+	}
+}
+
+func TestResolve_DNSSECInsecureDelegation(t *testing.T) {
+	root, example := hierarchy(t, true, false)
+	port := startServers(t, map[string]*testZone{"127.0.0.1": root, "127.0.0.2": example})
+	r := newTestResolver(t, port, true, root.ds())
+
+	m, err := r.Resolve("www.example.", dns.TypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.AuthenticatedData || len(m.Answer) != 1 {
+		t.Fatalf("want insecure answer, got %v", m)
+	}
+
+	// A wrong trust anchor makes everything bogus
+	bad := newTestResolver(t, port, true, example.ds())
+	if _, err := bad.Resolve("www.example.", dns.TypeA); !errors.Is(err, ErrBogus) {
+		t.Fatalf("want ErrBogus, got %v", err)
+	}
+}
+
+func TestCanonicalCompare(t *testing.T) {
+	names := []string{"z.example.", "example.", "a.example.", "yljkjljk.a.example.", "Z.a.example.", "zABC.a.EXAMPLE.", "*.z.example."}
+	sort.Slice(names, func(i, j int) bool { return canonicalCompare(names[i], names[j]) < 0 })
+	want := "example. a.example. yljkjljk.a.example. Z.a.example. zABC.a.EXAMPLE. z.example. *.z.example."
+	if got := strings.Join(names, " "); got != want {
+		t.Fatalf("got %s", got)
+	}
+}
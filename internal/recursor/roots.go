@@ -0,0 +1,35 @@
+package recursor
+
+import "github.com/miekg/dns"
+
+// rootServers are the IPv4 and then IPv6 addresses of a.root-servers.net
+// through m.root-servers.net, used unless recursion.root_hints is set.
+var rootServers = []string{
+	"198.41.0.4", "170.247.170.2", "192.33.4.12", "199.7.91.13",
+	"192.203.230.10", "192.5.5.241", "192.112.36.4", "198.97.190.53",
+	"192.36.148.17", "192.58.128.30", "193.0.14.129", "199.7.83.42",
+	"202.12.27.33",
+	"2001:503:ba3e::2:30", "2801:1b8:10::b", "2001:500:2::c", "2001:500:2d::d",
+	"2001:500:a8::e", "2001:500:2f::f", "2001:500:12::d0d", "2001:500:1::53",
+	"2001:7fe::53", "2001:503:c27::2:30", "2001:7fd::1", "2001:500:9f::42",
+	"2001:dc3::35",
+}
+
+// rootAnchorRecords are the DS records of the root key-signing keys
+// published by IANA: KSK-2017 and KSK-2024.
+var rootAnchorRecords = []string{
+	". IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D",
+	". IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16",
+}
+
+func rootAnchors() []*dns.DS {
+	out := make([]*dns.DS, 0, len(rootAnchorRecords))
+	for _, s := range rootAnchorRecords {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			panic("recursor: bad root anchor: " + err.Error())
+		}
+		out = append(out, rr.(*dns.DS))
+	}
+	return out
+}
@@ -0,0 +1,29 @@
+package replication
+
+import (
+	"fmt"
+	"time"
+
+	"namedot/internal/metrics"
+)
+
+var (
+	lastSuccessGauge = metrics.NewGauge("namedot_replication_last_success_timestamp_seconds",
+		"Unix time of the last successful sync from the master, 0 before the first one.")
+	syncIntervalGauge = metrics.NewGauge("namedot_replication_sync_interval_seconds",
+		"Configured interval between scheduled syncs from the master.")
+)
+
+// The data of a slave is stale once three scheduled syncs in a row were
+// missed. Masters export neither gauge and never match.
+func init() {
+	metrics.AddAlert(metrics.Alert{
+		Name: "NamedotReplicationStale",
+		Expr: fmt.Sprintf("time() - %s > 3 * %s",
+			lastSuccessGauge.Name(), syncIntervalGauge.Name()),
+		For:      5 * time.Minute,
+		Severity: "warning",
+		Summary:  "Slave {{ $labels.instance }} has not synced from the master in over three sync intervals",
+		Metrics:  []string{lastSuccessGauge.Name(), syncIntervalGauge.Name()},
+	})
+}
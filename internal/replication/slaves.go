@@ -0,0 +1,53 @@
+package replication
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// SlaveHeader carries the slave's hostname in /sync/export requests so the
+// master can tell slaves behind the same address apart.
+const SlaveHeader = "X-Namedot-Slave"
+
+// Slave is a replica that fetched data from this master.
+type Slave struct {
+	Addr     string
+	Name     string // from SlaveHeader, empty for older slaves
+	LastSeen time.Time
+	Zones    int // zones sent in the last export
+}
+
+// SlaveTracker remembers which slaves recently pulled /sync/export.
+type SlaveTracker struct {
+	mu     sync.Mutex
+	slaves map[string]Slave
+}
+
+// NewSlaveTracker creates an empty tracker.
+func NewSlaveTracker() *SlaveTracker {
+	return &SlaveTracker{slaves: make(map[string]Slave)}
+}
+
+// Seen records a successful export to a slave.
+func (t *SlaveTracker) Seen(addr, name string, zones int) {
+	key := addr
+	if name != "" {
+		key = name
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.slaves[key] = Slave{Addr: addr, Name: name, LastSeen: time.Now(), Zones: zones}
+}
+
+// Slaves returns the known slaves, most recently seen first.
+func (t *SlaveTracker) Slaves() []Slave {
+	t.mu.Lock()
+	out := make([]Slave, 0, len(t.slaves))
+	for _, s := range t.slaves {
+		out = append(out, s)
+	}
+	t.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].LastSeen.After(out[j].LastSeen) })
+	return out
+}
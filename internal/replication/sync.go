@@ -3,11 +3,15 @@ package replication
 import (
     "bytes"
     "context"
+    "crypto/tls"
     "encoding/json"
     "fmt"
     "io"
     "log"
+    "net"
     "net/http"
+    "os"
+    "sync"
     "time"
 
     "gorm.io/gorm"
@@ -18,8 +22,18 @@ import (
 
 // SyncData matches the structure in rest/server.go
 type SyncData struct {
-    Zones     []dbm.Zone     `json:"zones"`
-    Templates []dbm.Template `json:"templates"`
+    Zones     []dbm.Zone        `json:"zones"`
+    Templates []dbm.Template    `json:"templates"`
+    Settings  *config.Overrides `json:"settings,omitempty"`
+}
+
+// Status describes the outcome of the most recent sync attempts.
+type Status struct {
+    LastAttempt time.Time
+    LastSuccess time.Time
+    LastError   string // empty when the last attempt succeeded
+    Zones       int    // zones received in the last successful sync
+    Templates   int
 }
 
 // SyncClient handles replication from master to slave
@@ -27,16 +41,39 @@ type SyncClient struct {
     cfg    *config.Config
     db     *gorm.DB
     client *http.Client
+
+    run    sync.Mutex // serializes periodic and manual syncs
+    wake   chan struct{} // Trigger: sync now instead of at the next tick
+    mu     sync.Mutex
+    status Status
 }
 
 // NewSyncClient creates a new sync client
 func NewSyncClient(cfg *config.Config, db *gorm.DB) *SyncClient {
+    client := &http.Client{Timeout: 30 * time.Second}
+    if cfg.Replication.BandwidthKbit > 0 {
+        // A capped download of a large dataset may take far longer than a
+        // fixed timeout; only waiting for the master to answer is bounded
+        client = &http.Client{Transport: &http.Transport{
+            Proxy:                 http.ProxyFromEnvironment,
+            ResponseHeaderTimeout: 30 * time.Second,
+        }}
+    }
     return &SyncClient{
-        cfg: cfg,
-        db:  db,
-        client: &http.Client{
-            Timeout: 30 * time.Second,
-        },
+        cfg:    cfg,
+        db:     db,
+        client: client,
+        wake:   make(chan struct{}, 1),
+    }
+}
+
+// Trigger makes the periodic sync run now, e.g. on a NOTIFY from the master,
+// still within replication.sync_windows. Triggers during a sync are merged
+// into one more sync after it.
+func (s *SyncClient) Trigger() {
+    select {
+    case s.wake <- struct{}{}:
+    default:
     }
 }
 
@@ -57,6 +94,9 @@ func (s *SyncClient) FetchFromMaster(ctx context.Context) (*SyncData, error) {
     if token != "" {
         req.Header.Set("Authorization", "Bearer "+token)
     }
+    if host, err := os.Hostname(); err == nil {
+        req.Header.Set(SlaveHeader, host)
+    }
 
     resp, err := s.client.Do(req)
     if err != nil {
@@ -70,17 +110,57 @@ func (s *SyncClient) FetchFromMaster(ctx context.Context) (*SyncData, error) {
     }
 
     var data SyncData
-    if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+    body := throttle(ctx, resp.Body, s.cfg.Replication.BandwidthKbit)
+    if err := json.NewDecoder(body).Decode(&data); err != nil {
         return nil, fmt.Errorf("decode response: %w", err)
     }
 
     return &data, nil
 }
 
+// localAPI returns the base URL of the REST API of this server, from
+// rest_listen and the TLS settings, and a client for it. Over TLS the server
+// must present the certificate of tls_cert_file, whatever names it is for.
+func (s *SyncClient) localAPI() (string, *http.Client, error) {
+    host, port, err := net.SplitHostPort(s.cfg.RESTListen)
+    if err != nil {
+        return "", nil, fmt.Errorf("rest_listen: %w", err)
+    }
+    if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+        host = "localhost"
+    }
+    addr := net.JoinHostPort(host, port)
+    if !s.cfg.IsTLSEnabled() {
+        return "http://" + addr, s.client, nil
+    }
+    cert, err := tls.LoadX509KeyPair(s.cfg.TLSCertFile, s.cfg.TLSKeyFile)
+    if err != nil {
+        return "", nil, fmt.Errorf("load TLS certificate: %w", err)
+    }
+    pinned := cert.Certificate[0]
+    client := &http.Client{Timeout: s.client.Timeout, Transport: &http.Transport{
+        TLSClientConfig: &tls.Config{
+            // Checked against the configured certificate instead
+            InsecureSkipVerify: true,
+            VerifyConnection: func(cs tls.ConnectionState) error {
+                if len(cs.PeerCertificates) == 0 || !bytes.Equal(cs.PeerCertificates[0].Raw, pinned) {
+                    return fmt.Errorf("server does not present tls_cert_file")
+                }
+                return nil
+            },
+        },
+    }}
+    return "https://" + addr, client, nil
+}
+
 // ApplyData applies synced data to local database
 func (s *SyncClient) ApplyData(data *SyncData) error {
     // Use the same import logic as syncImport endpoint
-    url := "http://" + s.cfg.RESTListen + "/sync/import"
+    base, client, err := s.localAPI()
+    if err != nil {
+        return err
+    }
+    url := base + "/sync/import"
 
     jsonData, err := json.Marshal(data)
     if err != nil {
@@ -97,9 +177,9 @@ func (s *SyncClient) ApplyData(data *SyncData) error {
         req.Header.Set("Authorization", "Bearer "+s.cfg.APIToken)
     }
 
-    resp, err := s.client.Do(req)
+    resp, err := client.Do(req)
     if err != nil {
-        return fmt.Errorf("request failed: %w", err)
+        return fmt.Errorf("local server at %s unreachable, is it running? %w", base, err)
     }
     defer resp.Body.Close()
 
@@ -111,47 +191,94 @@ func (s *SyncClient) ApplyData(data *SyncData) error {
     return nil
 }
 
-// SyncOnce performs a single synchronization from master
+// Status returns the result of the most recent sync attempts.
+func (s *SyncClient) Status() Status {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.status
+}
+
+// SyncOnce performs a single synchronization from master. Concurrent
+// calls (e.g. a manual sync during a periodic one) run one after another.
 func (s *SyncClient) SyncOnce(ctx context.Context) error {
+    s.run.Lock()
+    defer s.run.Unlock()
+    data, err := s.syncOnce(ctx)
+
+    s.mu.Lock()
+    s.status.LastAttempt = time.Now()
+    if err != nil {
+        s.status.LastError = err.Error()
+    } else {
+        s.status.LastError = ""
+        s.status.LastSuccess = s.status.LastAttempt
+        s.status.Zones, s.status.Templates = len(data.Zones), len(data.Templates)
+        lastSuccessGauge.Set(float64(s.status.LastSuccess.Unix()))
+    }
+    s.mu.Unlock()
+    return err
+}
+
+func (s *SyncClient) syncOnce(ctx context.Context) (*SyncData, error) {
     log.Println("Starting sync from master...")
 
     data, err := s.FetchFromMaster(ctx)
     if err != nil {
-        return fmt.Errorf("fetch from master: %w", err)
+        return nil, fmt.Errorf("fetch from master: %w", err)
     }
 
     log.Printf("Fetched %d zones and %d templates from master", len(data.Zones), len(data.Templates))
 
     if err := s.ApplyData(data); err != nil {
-        return fmt.Errorf("apply data: %w", err)
+        return nil, fmt.Errorf("apply data: %w", err)
     }
 
     log.Println("Sync completed successfully")
-    return nil
+    return data, nil
 }
 
-// StartPeriodicSync starts periodic synchronization in background
+// StartPeriodicSync starts periodic synchronization in background. Outside
+// replication.sync_windows scheduled syncs, the initial one included, wait
+// for the next window; manual SyncOnce calls are not held back.
 func (s *SyncClient) StartPeriodicSync(ctx context.Context) {
     interval := time.Duration(s.cfg.Replication.SyncIntervalSec) * time.Second
     ticker := time.NewTicker(interval)
     defer ticker.Stop()
 
     log.Printf("Starting periodic sync every %v", interval)
+    syncIntervalGauge.Set(interval.Seconds())
+    // Exported from the start, so a slave that never syncs goes stale too
+    if s.Status().LastSuccess.IsZero() {
+        lastSuccessGauge.Set(0)
+    }
 
-    // Initial sync
-    if err := s.SyncOnce(ctx); err != nil {
-        log.Printf("Initial sync failed: %v", err)
+    waiting := false
+    scheduled := func(what string) {
+        if !s.cfg.Replication.SyncAllowed(time.Now()) {
+            if !waiting {
+                log.Printf("Outside replication.sync_windows, syncs wait for the next window")
+                waiting = true
+            }
+            return
+        }
+        waiting = false
+        if err := s.SyncOnce(ctx); err != nil {
+            log.Printf("%s sync failed: %v", what, err)
+        }
     }
 
+    // Initial sync
+    scheduled("Initial")
+
     for {
         select {
         case <-ctx.Done():
             log.Println("Stopping periodic sync")
             return
         case <-ticker.C:
-            if err := s.SyncOnce(ctx); err != nil {
-                log.Printf("Periodic sync failed: %v", err)
-            }
+            scheduled("Periodic")
+        case <-s.wake:
+            scheduled("NOTIFY")
         }
     }
 }
@@ -2,9 +2,20 @@ package replication
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -394,3 +405,194 @@ func BenchmarkFetchFromMaster(b *testing.B) {
 		client.FetchFromMaster(ctx)
 	}
 }
+
+func TestSyncOnce_RecordsStatus(t *testing.T) {
+	fail := true
+	// The test server acts as both the master and the local /sync/import
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case fail:
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		case r.URL.Path == "/sync/export":
+			json.NewEncoder(w).Encode(SyncData{Zones: []dbm.Zone{{Name: "a.test."}, {Name: "b.test."}}})
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer srv.Close()
+
+	client, _ := setupTestClient(t, srv.URL)
+	client.cfg.RESTListen = srv.Listener.Addr().String()
+
+	if st := client.Status(); !st.LastAttempt.IsZero() {
+		t.Fatalf("expected empty status before first sync, got %+v", st)
+	}
+	if err := client.SyncOnce(context.Background()); err == nil {
+		t.Fatal("expected sync error")
+	}
+	st := client.Status()
+	if st.LastAttempt.IsZero() || st.LastError == "" || !st.LastSuccess.IsZero() {
+		t.Fatalf("unexpected status after failure: %+v", st)
+	}
+
+	fail = false
+	if err := client.SyncOnce(context.Background()); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	st = client.Status()
+	if st.LastError != "" || st.LastSuccess.IsZero() || st.Zones != 2 || st.Templates != 0 {
+		t.Fatalf("unexpected status after success: %+v", st)
+	}
+}
+
+// writeTestCert writes a self-signed certificate and its key to dir and
+// returns their paths and the certificate for a server.
+func writeTestCert(t *testing.T, dir string) (string, string, tls.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour), DNSNames: []string{"namedot.example"}}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, cert
+}
+
+func TestSyncOnce_AppliesToLocalTLSServer(t *testing.T) {
+	master := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sync/export" || r.Header.Get("Authorization") != "Bearer test-token" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(SyncData{Zones: []dbm.Zone{{Name: "pulled.test.", RRSets: []dbm.RRSet{{Name: "www.pulled.test.", Type: "A", TTL: 60, Records: []dbm.RData{{Data: "192.0.2.1"}}}}}}})
+	}))
+	defer master.Close()
+
+	var imported SyncData
+	local := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/sync/import" || r.Header.Get("Authorization") != "Bearer local-token" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&imported); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	certFile, keyFile, cert := writeTestCert(t, t.TempDir())
+	local.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	local.StartTLS()
+	defer local.Close()
+
+	client, _ := setupTestClient(t, master.URL)
+	client.cfg.APIToken = "local-token"
+	client.cfg.RESTListen = local.Listener.Addr().String()
+	client.cfg.TLSCertFile, client.cfg.TLSKeyFile = certFile, keyFile
+
+	if err := client.SyncOnce(context.Background()); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if len(imported.Zones) != 1 || imported.Zones[0].Name != "pulled.test." || len(imported.Zones[0].RRSets) != 1 {
+		t.Fatalf("local server got %+v", imported)
+	}
+
+	// A server presenting another certificate is not trusted
+	otherCert, otherKey, _ := writeTestCert(t, t.TempDir())
+	client.cfg.TLSCertFile, client.cfg.TLSKeyFile = otherCert, otherKey
+	if err := client.SyncOnce(context.Background()); err == nil {
+		t.Fatal("expected an error for a server with another certificate")
+	}
+
+	// A stopped local server is reported as such
+	local.Close()
+	client.cfg.TLSCertFile, client.cfg.TLSKeyFile = certFile, keyFile
+	err := client.SyncOnce(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "is it running?") {
+		t.Fatalf("expected an unreachable local server error, got %v", err)
+	}
+}
+
+func TestLocalAPI_WildcardListen(t *testing.T) {
+	client, _ := setupTestClient(t, "http://master")
+	for listen, want := range map[string]string{
+		":8080":              "http://localhost:8080",
+		"0.0.0.0:8080":       "http://localhost:8080",
+		"[::]:8080":          "http://localhost:8080",
+		"10.0.0.5:8080":      "http://10.0.0.5:8080",
+		"[2001:db8::1]:8080": "http://[2001:db8::1]:8080",
+	} {
+		client.cfg.RESTListen = listen
+		got, _, err := client.localAPI()
+		if err != nil || got != want {
+			t.Errorf("%s: got %q, %v; want %q", listen, got, err, want)
+		}
+	}
+}
+
+func TestSlaveTracker(t *testing.T) {
+	tr := NewSlaveTracker()
+	tr.Seen("10.0.0.1", "", 3)
+	tr.Seen("10.0.0.2", "ns2", 3)
+	tr.Seen("10.0.0.3", "ns2", 4) // same slave, new address
+
+	got := tr.Slaves()
+	if len(got) != 2 {
+		t.Fatalf("expected 2 slaves, got %+v", got)
+	}
+	byAddr := map[string]Slave{}
+	for _, s := range got {
+		byAddr[s.Addr] = s
+	}
+	if s := byAddr["10.0.0.3"]; s.Name != "ns2" || s.Zones != 4 {
+		t.Fatalf("named slave should be updated in place, got %+v", got)
+	}
+	if _, ok := byAddr["10.0.0.1"]; !ok {
+		t.Fatalf("unnamed slave missing: %+v", got)
+	}
+	if got[0].LastSeen.Before(got[1].LastSeen) {
+		t.Fatalf("expected most recent slave first, got %+v", got)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	// 800 kbit/s is 100 kB/s: 20 kB take about 200ms
+	r := throttle(context.Background(), strings.NewReader(strings.Repeat("x", 20000)), 800)
+	start := time.Now()
+	n, err := io.Copy(io.Discard, r)
+	if err != nil || n != 20000 {
+		t.Fatalf("copy: %d %v", n, err)
+	}
+	if took := time.Since(start); took < 150*time.Millisecond {
+		t.Fatalf("read too fast: %v", took)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := io.Copy(io.Discard, throttle(ctx, strings.NewReader(strings.Repeat("x", 20000)), 8)); err != context.Canceled {
+		t.Fatalf("canceled read: %v", err)
+	}
+	if r := strings.NewReader("x"); throttle(context.Background(), r, 0) != io.Reader(r) {
+		t.Fatal("no limit should not wrap the reader")
+	}
+}
@@ -0,0 +1,47 @@
+package replication
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// throttledReader caps the rate at which r is read, to keep a full sync
+// from saturating the link to the master.
+type throttledReader struct {
+	ctx   context.Context
+	r     io.Reader
+	rate  float64 // bytes per second
+	chunk int     // largest read, so sleeps stay short and even
+	start time.Time
+	n     int64
+}
+
+// throttle wraps r to be read at no more than kbit kilobits per second, or
+// returns it as is for kbit <= 0.
+func throttle(ctx context.Context, r io.Reader, kbit int) io.Reader {
+	if kbit <= 0 {
+		return r
+	}
+	rate := float64(kbit) * 1000 / 8
+	return &throttledReader{ctx: ctx, r: r, rate: rate, chunk: max(int(rate/10), 512), start: time.Now()}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > t.chunk {
+		p = p[:t.chunk]
+	}
+	n, err := t.r.Read(p)
+	t.n += int64(n)
+	due := t.start.Add(time.Duration(float64(t.n) / t.rate * float64(time.Second)))
+	if wait := time.Until(due); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-t.ctx.Done():
+			return n, t.ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return n, err
+}
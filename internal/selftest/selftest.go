@@ -0,0 +1,353 @@
+// Package selftest boots a throwaway namedot instance, with an in-memory
+// database and the DNS server and REST API on loopback ports, and checks it
+// end to end. It backs "namedot selftest".
+package selftest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"namedot/internal/config"
+	"namedot/internal/db"
+	dnssrv "namedot/internal/server/dns"
+	restsrv "namedot/internal/server/rest"
+)
+
+// Names and addresses used by the test zone. The geo record answers the
+// clients of geoSubnet only, everyone else gets the generic one.
+const (
+	zoneName    = "selftest.namedot.test."
+	hostName    = "www." + zoneName
+	genericAddr = "192.0.2.10"
+	geoAddr     = "198.51.100.10"
+	geoSubnet   = "203.0.113.0/24"
+	geoClient   = "203.0.113.7"
+)
+
+// loopback is where the instance listens, on ports picked by the system.
+const loopback = "127.0.0.1:0"
+
+// baseConfig is the config of the instance. The listen addresses only have
+// to validate: the sockets are bound on loopback by Run.
+const baseConfig = `
+listen: "127.0.0.1:53"
+rest_listen: "127.0.0.1:8080"
+default_ttl: 60
+soa:
+  auto_on_missing: true
+geoip:
+  use_ecs: true
+db:
+  driver: sqlite
+`
+
+// Step is the outcome of one check.
+type Step struct {
+	Name   string
+	Detail string
+	Err    error
+	Took   time.Duration
+}
+
+// Report lists the checks in the order they ran. A failed check ends the
+// run, as the ones after it build on it.
+type Report struct {
+	Steps []Step
+}
+
+// OK reports whether every check passed.
+func (r Report) OK() bool {
+	for _, s := range r.Steps {
+		if s.Err != nil {
+			return false
+		}
+	}
+	return len(r.Steps) > 0
+}
+
+// WriteTo prints one PASS/FAIL line per check and a summary.
+func (r Report) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+	failed := 0
+	for _, s := range r.Steps {
+		if s.Err != nil {
+			failed++
+			fmt.Fprintf(&b, "  FAIL  %-22s %v\n", s.Name, s.Err)
+			continue
+		}
+		fmt.Fprintf(&b, "  PASS  %-22s %s (%s)\n", s.Name, s.Detail, s.Took.Round(time.Microsecond))
+	}
+	if failed > 0 {
+		fmt.Fprintf(&b, "Self-test FAILED: %d of %d checks failed\n", failed, len(r.Steps))
+	} else {
+		fmt.Fprintf(&b, "Self-test passed: %d checks\n", len(r.Steps))
+	}
+	n, err := w.Write(b.Bytes())
+	return int64(n), err
+}
+
+// instance is the throwaway namedot under test.
+type instance struct {
+	cfg   *config.Config
+	db    *gorm.DB
+	dns   *dnssrv.Server
+	rest  *restsrv.Server
+	token string
+	api   string // REST API base URL
+	udp   string
+	tcp   string
+	http  *http.Client
+	zone  uint
+}
+
+// Run boots the instance, runs the checks against it and tears it down.
+func Run() Report {
+	var r Report
+	in := &instance{http: &http.Client{Timeout: 5 * time.Second}}
+	defer in.close()
+	steps := []struct {
+		name string
+		run  func() (string, error)
+	}{
+		{"config", in.loadConfig},
+		{"database", in.openDB},
+		{"dns listeners", in.startDNS},
+		{"rest api", in.startREST},
+		{"create zone", in.createZone},
+		{"add records", in.addRecords},
+		{"udp query", func() (string, error) { return in.query("udp", "", genericAddr) }},
+		{"tcp query", func() (string, error) { return in.query("tcp", "", genericAddr) }},
+		{"geo selection", func() (string, error) { return in.query("udp", geoClient, geoAddr) }},
+		{"health probe", in.healthDNS},
+	}
+	for _, st := range steps {
+		start := time.Now()
+		detail, err := st.run()
+		r.Steps = append(r.Steps, Step{Name: st.name, Detail: detail, Err: err, Took: time.Since(start)})
+		if err != nil {
+			break
+		}
+	}
+	return r
+}
+
+func (in *instance) loadConfig() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	in.token = hex.EncodeToString(b)
+	hash, err := bcrypt.GenerateFromPassword([]byte(in.token), bcrypt.MinCost)
+	if err != nil {
+		return "", err
+	}
+	// A named shared-cache memory database is seen by every pool connection
+	// and is gone once the last one closes
+	yaml := baseConfig + fmt.Sprintf("  dsn: \"file:namedot-selftest-%s?mode=memory&cache=shared\"\napi_token_hash: %q\n", in.token[:8], hash)
+	cfg, err := config.Parse([]byte(yaml))
+	if err != nil {
+		return "", err
+	}
+	in.cfg = cfg
+	return "defaults applied and validated", nil
+}
+
+func (in *instance) openDB() (string, error) {
+	gdb, err := db.Open(in.cfg.DB)
+	if err != nil {
+		return "", err
+	}
+	in.db = gdb
+	if err := db.AutoMigrate(gdb); err != nil {
+		return "", err
+	}
+	return "in-memory sqlite migrated", nil
+}
+
+func (in *instance) startDNS() (string, error) {
+	pc, err := net.ListenPacket("udp", loopback)
+	if err != nil {
+		return "", err
+	}
+	ln, err := net.Listen("tcp", loopback)
+	if err != nil {
+		pc.Close()
+		return "", err
+	}
+	in.udp, in.tcp = pc.LocalAddr().String(), ln.Addr().String()
+	in.cfg.Listen = in.udp
+	srv, err := dnssrv.NewServer(in.cfg, in.db)
+	if err != nil {
+		pc.Close()
+		ln.Close()
+		return "", err
+	}
+	srv.SetListeners(pc, ln)
+	if err := srv.Start(); err != nil {
+		return "", err
+	}
+	in.dns = srv
+	return fmt.Sprintf("udp %s, tcp %s", in.udp, in.tcp), nil
+}
+
+func (in *instance) startREST() (string, error) {
+	ln, err := net.Listen("tcp", loopback)
+	if err != nil {
+		return "", err
+	}
+	in.cfg.RESTListen = ln.Addr().String()
+	in.api = "http://" + in.cfg.RESTListen
+	in.rest = restsrv.NewServer(in.cfg, in.db, in.dns)
+	in.rest.SetListener(ln)
+	go func() { _ = in.rest.Start() }()
+	var out struct {
+		Status string `json:"status"`
+	}
+	if err := in.call("GET", "/health", nil, http.StatusOK, &out); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s status %s", in.api, out.Status), nil
+}
+
+func (in *instance) createZone() (string, error) {
+	var z struct {
+		ID     uint   `json:"id"`
+		Serial uint32 `json:"serial"`
+	}
+	if err := in.call("POST", "/zones", map[string]string{"name": zoneName}, http.StatusCreated, &z); err != nil {
+		return "", err
+	}
+	in.zone = z.ID
+	return fmt.Sprintf("%s id %d", zoneName, z.ID), nil
+}
+
+func (in *instance) addRecords() (string, error) {
+	subnet := geoSubnet
+	body := map[string]any{
+		"name": "www",
+		"type": "A",
+		"ttl":  60,
+		"records": []db.RData{
+			{Data: genericAddr},
+			{Data: geoAddr, Subnet: &subnet},
+		},
+	}
+	if err := in.call("POST", fmt.Sprintf("/zones/%d/rrsets", in.zone), body, http.StatusCreated, nil); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s A %s, %s for %s", hostName, genericAddr, geoAddr, geoSubnet), nil
+}
+
+// query asks for hostName over network, as a client at ecs when it is set,
+// and expects want as the only answer.
+func (in *instance) query(network, ecs, want string) (string, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(hostName, dns.TypeA)
+	if ecs != "" {
+		m.SetEdns0(1232, false)
+		opt := m.IsEdns0()
+		opt.Option = append(opt.Option, &dns.EDNS0_SUBNET{
+			Code:          dns.EDNS0SUBNET,
+			Family:        1,
+			SourceNetmask: 32,
+			Address:       net.ParseIP(ecs).To4(),
+		})
+	}
+	addr := in.udp
+	if network == "tcp" {
+		addr = in.tcp
+	}
+	c := &dns.Client{Net: network, Timeout: 2 * time.Second}
+	resp, _, err := c.Exchange(m, addr)
+	if err != nil {
+		return "", err
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return "", fmt.Errorf("rcode %s", dns.RcodeToString[resp.Rcode])
+	}
+	var got []string
+	for _, rr := range resp.Answer {
+		if a, ok := rr.(*dns.A); ok {
+			got = append(got, a.A.String())
+		}
+	}
+	if len(got) != 1 || got[0] != want {
+		return "", fmt.Errorf("got [%s], want %s", strings.Join(got, " "), want)
+	}
+	if ecs != "" {
+		return fmt.Sprintf("%s from %s", want, ecs), nil
+	}
+	return want, nil
+}
+
+func (in *instance) healthDNS() (string, error) {
+	var out struct {
+		UDP float64 `json:"udp_ms"`
+		TCP float64 `json:"tcp_ms"`
+	}
+	if err := in.call("GET", "/health/dns", nil, http.StatusOK, &out); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("udp %.2fms, tcp %.2fms", out.UDP, out.TCP), nil
+}
+
+// call sends a REST API request and decodes the reply into out, failing
+// unless the status is want.
+func (in *instance) call(method, path string, body any, want int, out any) error {
+	var rd io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rd = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, in.api+path, rd)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+in.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := in.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != want {
+		return fmt.Errorf("%s %s: %d %s", method, path, resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	if out != nil {
+		return json.Unmarshal(b, out)
+	}
+	return nil
+}
+
+func (in *instance) close() {
+	if in.rest != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		_ = in.rest.Shutdown(ctx)
+		cancel()
+	}
+	if in.dns != nil {
+		_ = in.dns.Shutdown()
+	}
+	if in.db != nil {
+		if sqlDB, err := in.db.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	}
+}
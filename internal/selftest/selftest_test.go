@@ -0,0 +1,19 @@
+package selftest
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	report := Run()
+	var out bytes.Buffer
+	_, _ = report.WriteTo(&out)
+	if !report.OK() {
+		t.Fatalf("self-test failed:\n%s", out.String())
+	}
+	if len(report.Steps) != 10 || !strings.Contains(out.String(), "geo selection") {
+		t.Fatalf("unexpected report:\n%s", out.String())
+	}
+}
@@ -0,0 +1,37 @@
+package dns
+
+import (
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// observeAnomaly passes NXDOMAIN and SERVFAIL answers to the anomaly
+// detector. Answers rewritten by a blocklist are intended and not counted.
+// Names outside local zones are counted under their last two labels.
+func (s *Server) observeAnomaly(q dns.Question, addr net.Addr, rcode int, source string) {
+	if s.anomaly == nil || source == "blocked" {
+		return
+	}
+	if rcode != dns.RcodeNameError && rcode != dns.RcodeServerFailure {
+		return
+	}
+	name := strings.ToLower(dns.Fqdn(q.Name))
+	zone := baseDomain(name)
+	if z, err := s.findZone(name); err == nil && z != nil {
+		zone = z.Name
+	}
+	ip, _ := remoteIP(addr)
+	s.anomaly.Observe(zone, ip, rcode)
+}
+
+// baseDomain returns the last two labels of name, e.g. example.com. for
+// a.b.example.com.
+func baseDomain(name string) string {
+	labels := dns.SplitDomainName(name)
+	if len(labels) > 2 {
+		labels = labels[len(labels)-2:]
+	}
+	return dns.Fqdn(strings.Join(labels, "."))
+}
@@ -0,0 +1,63 @@
+package dns
+
+import (
+	"net/netip"
+
+	dbm "namedot/internal/db"
+	"namedot/internal/geoip"
+)
+
+// splitBackup separates the primary records of recs from the backup ones.
+func splitBackup(recs []dbm.RData) (primary, backup []dbm.RData) {
+	for _, r := range recs {
+		if r.Backup {
+			backup = append(backup, r)
+		} else {
+			primary = append(primary, r)
+		}
+	}
+	return primary, backup
+}
+
+// selectRecords picks the records to answer with from recs. Records marked
+// as backup are left out while a healthy primary record matches the client
+// in some geo tier; otherwise the healthy backup records are geo-selected
+// instead, with a "backup:" rule. When neither pool has a healthy record
+// the primaries are served anyway, as without backups.
+func (s *Server) selectRecords(recs []dbm.RData, ip netip.Addr, g geoip.Info) ([]dbm.RData, string) {
+	primary, backup := splitBackup(recs)
+	if len(backup) == 0 {
+		return selectGeoRecords(s.servable(primary), ip, g)
+	}
+	// "all" means no tier matched, which the backups are for too
+	if up := s.healthy(primary); len(up) > 0 {
+		if out, rule := selectGeoRecords(up, ip, g); rule != "all" {
+			return out, rule
+		}
+	}
+	if up := s.healthy(backup); len(up) > 0 {
+		out, rule := selectGeoRecords(up, ip, g)
+		return out, "backup:" + rule
+	}
+	if len(primary) == 0 {
+		primary = backup
+	}
+	return selectGeoRecords(s.servable(primary), ip, g)
+}
+
+// primaryOrBackup is selectRecords for answers without geo selection: the
+// healthy primary records, else the healthy backup records, else all
+// primary records.
+func (s *Server) primaryOrBackup(recs []dbm.RData) []dbm.RData {
+	primary, backup := splitBackup(recs)
+	if up := s.healthy(primary); len(up) > 0 {
+		return up
+	}
+	if up := s.healthy(backup); len(up) > 0 {
+		return up
+	}
+	if len(primary) == 0 {
+		return backup
+	}
+	return primary
+}
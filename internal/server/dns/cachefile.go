@@ -0,0 +1,103 @@
+package dns
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// cacheFileVersion changes whenever the snapshot layout does; snapshots of
+// other versions are ignored.
+const cacheFileVersion = 1
+
+type cacheSnapshot struct {
+	Version int
+	Saved   time.Time
+	Entries []cacheEntry
+}
+
+type cacheEntry struct {
+	Key     string
+	Msg     []byte // packed dns.Msg
+	Stored  time.Time
+	Expires time.Time
+}
+
+// SaveCache writes the unexpired answers of the cache to path, replacing the
+// file atomically, and returns how many were written.
+func (s *Server) SaveCache(path string) (int, error) {
+	snap := cacheSnapshot{Version: cacheFileVersion, Saved: time.Now()}
+	s.cache.RangeEntries(func(key string, value any, storedAt, expiresAt time.Time) {
+		m, ok := value.(*dns.Msg)
+		if !ok {
+			return
+		}
+		b, err := m.Pack()
+		if err != nil {
+			return
+		}
+		snap.Entries = append(snap.Entries, cacheEntry{Key: key, Msg: b, Stored: storedAt, Expires: expiresAt})
+	})
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".namedot-cache-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	if err := gob.NewEncoder(tmp).Encode(&snap); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return 0, err
+	}
+	return len(snap.Entries), nil
+}
+
+// LoadCache fills the cache from a snapshot written by SaveCache. Entries
+// that expired while the server was down are skipped; each restored answer
+// expires, and has its TTLs counted down, as it would have without the
+// restart. A missing file is not an error.
+func (s *Server) LoadCache(path string) (int, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	var snap cacheSnapshot
+	if err := gob.NewDecoder(f).Decode(&snap); err != nil {
+		return 0, fmt.Errorf("decode %s: %w", path, err)
+	}
+	if snap.Version != cacheFileVersion {
+		return 0, fmt.Errorf("%s: unsupported snapshot version %d", path, snap.Version)
+	}
+	now := time.Now()
+	n := 0
+	for _, e := range snap.Entries {
+		if !now.Before(e.Expires) {
+			continue
+		}
+		m := new(dns.Msg)
+		if err := m.Unpack(e.Msg); err != nil {
+			continue
+		}
+		stored := e.Stored
+		if stored.IsZero() {
+			// written before entries kept their insertion time
+			stored = snap.Saved
+		}
+		s.cache.SetAt(e.Key, m, stored, e.Expires)
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,115 @@
+package dns
+
+import (
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"gorm.io/gorm"
+
+	dbm "namedot/internal/db"
+)
+
+// canaryTable caches the staged zone canaries by zone ID, like hostTable
+// does for the hosts table.
+type canaryTable struct {
+	mu        sync.RWMutex
+	byZone    map[uint]*dbm.ZoneCanary
+	lastFetch time.Time
+	ttl       time.Duration
+}
+
+// get returns the canary of a zone, or nil, reloading the table when it is
+// stale.
+func (ct *canaryTable) get(db *gorm.DB, zoneID uint) (*dbm.ZoneCanary, error) {
+	ct.mu.RLock()
+	if ct.byZone != nil && time.Since(ct.lastFetch) < ct.ttl {
+		c := ct.byZone[zoneID]
+		ct.mu.RUnlock()
+		return c, nil
+	}
+	ct.mu.RUnlock()
+
+	all, err := dbm.ListZoneCanaries(db)
+	if err != nil {
+		return nil, err
+	}
+	byZone := make(map[uint]*dbm.ZoneCanary, len(all))
+	for i := range all {
+		byZone[all[i].ZoneID] = &all[i]
+	}
+	ct.mu.Lock()
+	ct.byZone, ct.lastFetch = byZone, time.Now()
+	ct.mu.Unlock()
+	return byZone[zoneID], nil
+}
+
+func (ct *canaryTable) invalidate() {
+	ct.mu.Lock()
+	ct.byZone = nil
+	ct.mu.Unlock()
+}
+
+// canaryFor returns the canary of a zone when the client at cip is one it
+// is served to. cip is the ECS address when geoip.use_ecs is on, so a test
+// client can also be picked by the subnet its resolver sends.
+func (s *Server) canaryFor(zoneID uint, cip netip.Addr) *dbm.ZoneCanary {
+	if !cip.IsValid() {
+		return nil
+	}
+	c, err := s.canaries.get(s.db, zoneID)
+	if err != nil || c == nil || !c.Serves(cip) {
+		return nil
+	}
+	return c
+}
+
+// zoneRRSet returns the rrset name/rtype of a zone with its enabled records,
+// or those of its dynamic URL, from the canary when one is given. A set
+// without records to serve is not found.
+func (s *Server) zoneRRSet(zoneID uint, c *dbm.ZoneCanary, name, rtype string) (dbm.RRSet, error) {
+	if c != nil {
+		for _, set := range c.RRSets {
+			if set.Name == name && set.Type == rtype {
+				set.Records = dbm.EnabledRecords(set.Records)
+				set.Records = s.dynamicRecords(set)
+				if len(set.Records) == 0 {
+					break
+				}
+				return set, nil
+			}
+		}
+		return dbm.RRSet{}, gorm.ErrRecordNotFound
+	}
+	var set dbm.RRSet
+	err := s.db.Preload("Records", "disabled = ?", false).
+		Where("zone_id = ? AND name = ? AND type = ?", zoneID, name, rtype).
+		First(&set).Error
+	if err == nil {
+		set.Records = s.dynamicRecords(set)
+		if len(set.Records) == 0 {
+			err = gorm.ErrRecordNotFound
+		}
+	}
+	return set, err
+}
+
+// canaryHasName reports whether the canary owns records at qname or below it.
+func canaryHasName(c *dbm.ZoneCanary, qname string) bool {
+	for _, set := range c.RRSets {
+		if dns.IsSubDomain(qname, set.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// canaryRule marks the geo rule of an answer taken from a canary, so query
+// logs and the lookup tool show which version a client got.
+func canaryRule(c *dbm.ZoneCanary, rule string) string {
+	if c == nil {
+		return rule
+	}
+	return "canary:" + rule
+}
@@ -0,0 +1,95 @@
+package dns
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"gorm.io/gorm"
+
+	"namedot/internal/config"
+	dbm "namedot/internal/db"
+)
+
+// deny turns m into the reply for a query turned away under policy, one of
+// the deny.* settings, and reports whether no reply is to be sent at all.
+func deny(m *dns.Msg, policy string) (drop bool) {
+	m.Answer, m.Ns, m.Extra = nil, nil, nil
+	switch policy {
+	case config.DenyNXDomain:
+		m.Rcode = dns.RcodeNameError
+	case config.DenyDrop:
+		m.Rcode = dns.RcodeRefused
+		return true
+	default:
+		m.Rcode = dns.RcodeRefused
+	}
+	return false
+}
+
+// disabledTable caches the names of the disabled zones, like canaryTable
+// does for the canaries; findZone never sees them.
+type disabledTable struct {
+	mu        sync.RWMutex
+	names     []string
+	loaded    bool
+	lastFetch time.Time
+	ttl       time.Duration
+}
+
+func (dt *disabledTable) get(db *gorm.DB) ([]string, error) {
+	dt.mu.RLock()
+	if dt.loaded && time.Since(dt.lastFetch) < dt.ttl {
+		names := dt.names
+		dt.mu.RUnlock()
+		return names, nil
+	}
+	dt.mu.RUnlock()
+
+	var zones []dbm.Zone
+	if err := db.Where("deleted_at IS NULL AND disabled = ?", true).Find(&zones).Error; err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(zones))
+	for _, z := range zones {
+		names = append(names, dns.Fqdn(strings.ToLower(z.Name)))
+	}
+	dt.mu.Lock()
+	dt.names, dt.loaded, dt.lastFetch = names, true, time.Now()
+	dt.mu.Unlock()
+	return names, nil
+}
+
+func (dt *disabledTable) invalidate() {
+	dt.mu.Lock()
+	dt.loaded = false
+	dt.names = nil
+	dt.mu.Unlock()
+}
+
+// disabledZone returns the disabled zone qname falls into, or "" when it is
+// in none or an enabled zone below the disabled one serves it. Only looked
+// up when deny.disabled_zones is set.
+func (s *Server) disabledZone(qname string) string {
+	if s.cfg == nil || s.cfg.Deny.DisabledZones == "" {
+		return ""
+	}
+	names, err := s.disabled.get(s.db)
+	if err != nil {
+		return ""
+	}
+	best := ""
+	for _, n := range names {
+		if dns.IsSubDomain(n, qname) && len(n) > len(best) {
+			best = n
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	if z, _ := s.findZone(qname); z != nil && len(dns.Fqdn(z.Name)) > len(best) {
+		return ""
+	}
+	return best
+}
@@ -0,0 +1,168 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"namedot/internal/config"
+)
+
+// dns64 synthesizes AAAA answers from A records (RFC 6147) for IPv6-only
+// clients behind a NAT64 gateway.
+type dns64 struct {
+	prefix  netip.Prefix
+	clients []netip.Prefix
+	excl4   []netip.Prefix
+	excl6   []netip.Prefix
+	names   []string
+}
+
+func newDNS64(cfg config.DNS64Config) (*dns64, error) {
+	d := &dns64{}
+	var err error
+	if d.prefix, err = netip.ParsePrefix(cfg.Prefix); err != nil {
+		return nil, fmt.Errorf("dns64.prefix: %w", err)
+	}
+	d.prefix = d.prefix.Masked()
+	for _, set := range []struct {
+		key  string
+		in   []string
+		into *[]netip.Prefix
+	}{
+		{"client_cidrs", cfg.ClientCIDRs, &d.clients},
+		{"exclude_ipv4", cfg.ExcludeIPv4, &d.excl4},
+		{"exclude_ipv6", cfg.ExcludeIPv6, &d.excl6},
+	} {
+		for _, c := range set.in {
+			p, err := netip.ParsePrefix(c)
+			if err != nil {
+				return nil, fmt.Errorf("dns64.%s: %w", set.key, err)
+			}
+			*set.into = append(*set.into, p.Masked())
+		}
+	}
+	for _, n := range cfg.ExcludeNames {
+		d.names = append(d.names, dns.Fqdn(strings.ToLower(n)))
+	}
+	return d, nil
+}
+
+func containsAddr(set []netip.Prefix, a netip.Addr) bool {
+	for _, p := range set {
+		if p.Contains(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// applies reports whether AAAA queries for name from cip are synthesized.
+func (d *dns64) applies(name string, cip netip.Addr) bool {
+	if len(d.clients) > 0 && !containsAddr(d.clients, cip) {
+		return false
+	}
+	for _, n := range d.names {
+		if dns.IsSubDomain(n, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasAAAA reports whether answer holds an AAAA record outside exclude_ipv6;
+// excluded addresses count as no AAAA at all.
+func (d *dns64) hasAAAA(answer []dns.RR) bool {
+	for _, rr := range answer {
+		if a, ok := rr.(*dns.AAAA); ok {
+			if addr, ok := netip.AddrFromSlice(a.AAAA); !ok || !containsAddr(d.excl6, addr) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// synthesize turns the A records of answer into AAAA records under the
+// prefix. CNAMEs are kept; A records in exclude_ipv4 are dropped.
+func (d *dns64) synthesize(answer []dns.RR) []dns.RR {
+	var out []dns.RR
+	n := 0
+	for _, rr := range answer {
+		a, ok := rr.(*dns.A)
+		if !ok {
+			if rr.Header().Rrtype == dns.TypeCNAME {
+				out = append(out, rr)
+			}
+			continue
+		}
+		v4, ok := netip.AddrFromSlice(a.A.To4())
+		if !ok || containsAddr(d.excl4, v4) {
+			continue
+		}
+		hdr := a.Hdr
+		hdr.Rrtype = dns.TypeAAAA
+		out = append(out, &dns.AAAA{Hdr: hdr, AAAA: net.IP(embed(d.prefix, v4).AsSlice())})
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	return out
+}
+
+// embed places v4 into prefix as described in RFC 6052 section 2.2: the
+// address bits skip bits 64-71, and the suffix after them is zero.
+func embed(prefix netip.Prefix, v4 netip.Addr) netip.Addr {
+	b := prefix.Addr().As16()
+	a4 := v4.As4()
+	pos := prefix.Bits() / 8
+	for _, x := range a4 {
+		if pos == 8 {
+			b[pos] = 0
+			pos++
+		}
+		b[pos] = x
+		pos++
+	}
+	return netip.AddrFrom16(b)
+}
+
+// applyDNS64 replaces an AAAA response without usable AAAA records by
+// addresses synthesized from the name's A records.
+func (s *Server) applyDNS64(r *dns.Msg, m *dns.Msg, cip netip.Addr, store, recurse bool) *dns.Msg {
+	q := r.Question[0]
+	if s.dns64 == nil || q.Qtype != dns.TypeAAAA || q.Qclass != dns.ClassINET {
+		return m
+	}
+	// A validating client that disabled checking wants the real answer
+	if opt := r.IsEdns0(); opt != nil && opt.Do() && r.CheckingDisabled {
+		return m
+	}
+	if m.Rcode != dns.RcodeSuccess {
+		return m
+	}
+	name := strings.ToLower(q.Name)
+	if s.dns64.hasAAAA(m.Answer) || !s.dns64.applies(name, cip) {
+		return m
+	}
+	ar := r.Copy()
+	ar.Question[0].Qtype = dns.TypeA
+	am, _ := s.resolve(ar, cip, store, recurse)
+	if am.Rcode != dns.RcodeSuccess {
+		return m
+	}
+	synth := s.dns64.synthesize(am.Answer)
+	if synth == nil {
+		return m
+	}
+	out := m.Copy()
+	out.Rcode = dns.RcodeSuccess
+	out.Answer = synth
+	out.Ns = nil
+	out.AuthenticatedData = false
+	return out
+}
@@ -0,0 +1,37 @@
+package dns
+
+import (
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"namedot/internal/dnstap"
+)
+
+// SetDnstap makes every query and response be sent to w.
+func (s *Server) SetDnstap(w *dnstap.Writer) {
+	s.tap = w
+}
+
+// tapMessages sends query r, received at start, and the response m written
+// to w to dnstap; m is nil when no response was sent.
+func (s *Server) tapMessages(w dns.ResponseWriter, r, m *dns.Msg, start time.Time) {
+	_, tcp := w.RemoteAddr().(*net.TCPAddr)
+	msg := dnstap.Message{
+		Type: dnstap.ClientQuery, TCP: tcp,
+		QueryAddr: w.RemoteAddr(), ResponseAddr: w.LocalAddr(), QueryTime: start,
+	}
+	if b, err := r.Pack(); err == nil {
+		msg.Query = b
+	}
+	s.tap.Send(msg)
+	if m == nil {
+		return
+	}
+	msg.Type, msg.Query, msg.ResponseTime = dnstap.ClientResponse, nil, time.Now()
+	if b, err := m.Pack(); err == nil {
+		msg.Response = b
+	}
+	s.tap.Send(msg)
+}
@@ -0,0 +1,157 @@
+package dns
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"namedot/internal/config"
+	dbm "namedot/internal/db"
+)
+
+// maxDynamicBody bounds the answer of a dynamic records endpoint.
+const maxDynamicBody = 1 << 20
+
+// dynamicTable caches the records fetched for dynamic RRSets by URL.
+// Fetches run in the background, so queries do not wait for the endpoint.
+type dynamicTable struct {
+	mu     sync.Mutex // guards byURL and the entries
+	byURL  map[string]*dynamicEntry
+	client *http.Client // nil = a client with the dynamic_records timeout
+}
+
+type dynamicEntry struct {
+	records  []dbm.RData
+	fetched  bool          // records holds the answer of a successful fetch
+	failed   bool          // the last fetch failed
+	expires  time.Time     // next fetch
+	stale    time.Time     // end of max_stale_sec after the records expired; zero for -1
+	fetching chan struct{} // closed when the running fetch ends; nil when none runs
+}
+
+// entry returns the cache entry of url, creating it. dt.mu is held.
+func (dt *dynamicTable) entry(url string) *dynamicEntry {
+	if dt.byURL == nil {
+		dt.byURL = make(map[string]*dynamicEntry)
+	}
+	e := dt.byURL[url]
+	if e == nil {
+		e = &dynamicEntry{}
+		dt.byURL[url] = e
+	}
+	return e
+}
+
+// invalidate drops the fetched records, e.g. after the URL of a set changed.
+func (dt *dynamicTable) invalidate() {
+	dt.mu.Lock()
+	dt.byURL = nil
+	dt.mu.Unlock()
+}
+
+// records returns the records to serve for set: those last fetched from its
+// dynamic URL, kept for up to max_stale_sec while the endpoint fails, and
+// else the stored ones. Expired records start a fetch in the background.
+// Only a set without stored records waits for its first fetch, for up to
+// timeout_ms, as it has nothing else to answer with.
+func (dt *dynamicTable) records(cfg config.DynamicRecordsConfig, set dbm.RRSet) []dbm.RData {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	e := dt.entry(*set.DynamicURL)
+	if e.fetching == nil && !time.Now().Before(e.expires) {
+		e.fetching = make(chan struct{})
+		go dt.refresh(cfg, set, e)
+	}
+	if wait := e.fetching; wait != nil && !e.fetched && len(set.Records) == 0 {
+		dt.mu.Unlock()
+		<-wait
+		dt.mu.Lock()
+	}
+	return e.served(set, time.Now())
+}
+
+// refresh fetches the records of e and stores them, or the failure.
+func (dt *dynamicTable) refresh(cfg config.DynamicRecordsConfig, set dbm.RRSet, e *dynamicEntry) {
+	recs, err := dt.fetch(cfg, *set.DynamicURL)
+	if err != nil {
+		log.Printf("dynamic records: %s %s: %v", set.Name, set.Type, err)
+	}
+	ttl := time.Duration(cfg.CacheSec) * time.Second
+	if ttl == 0 {
+		ttl = time.Duration(set.TTL) * time.Second
+	}
+
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	// A failing endpoint is asked again after the same time, not per query
+	e.expires = time.Now().Add(max(ttl, time.Second))
+	e.failed = err != nil
+	if err == nil {
+		e.records, e.fetched, e.stale = recs, true, time.Time{}
+		if cfg.MaxStaleSec >= 0 {
+			e.stale = e.expires.Add(time.Duration(cfg.MaxStaleSec) * time.Second)
+		}
+	}
+	close(e.fetching)
+	e.fetching = nil
+}
+
+// served returns the last fetched records unless the endpoint failed since
+// and they are stale, and else the stored records of set.
+func (e *dynamicEntry) served(set dbm.RRSet, now time.Time) []dbm.RData {
+	if e.fetched && (!e.failed || now.Before(e.stale)) {
+		return e.records
+	}
+	return set.Records
+}
+
+// dynamicRecords returns the records to serve for set: its stored records
+// unless it has a dynamic URL.
+func (s *Server) dynamicRecords(set dbm.RRSet) []dbm.RData {
+	if set.DynamicURL == nil {
+		return set.Records
+	}
+	var cfg config.DynamicRecordsConfig
+	if s.cfg != nil {
+		cfg = s.cfg.DynamicRecords
+	}
+	return s.dynamic.records(cfg, set)
+}
+
+// fetch GETs url and returns the enabled records of its answer.
+func (dt *dynamicTable) fetch(cfg config.DynamicRecordsConfig, url string) ([]dbm.RData, error) {
+	client := dt.client
+	if client == nil {
+		client = &http.Client{Timeout: time.Duration(cfg.TimeoutMs) * time.Millisecond}
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %s", resp.Status)
+	}
+	var body struct {
+		Records []dbm.RData `json:"records"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxDynamicBody)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+	recs := make([]dbm.RData, 0, len(body.Records))
+	for _, r := range dbm.EnabledRecords(body.Records) {
+		// Probes run for stored records only
+		r.ID, r.HealthCheck = 0, nil
+		recs = append(recs, r)
+	}
+	return recs, nil
+}
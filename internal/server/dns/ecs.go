@@ -0,0 +1,89 @@
+package dns
+
+import (
+	"net"
+	"net/netip"
+
+	"github.com/miekg/dns"
+
+	"namedot/internal/config"
+)
+
+// Default longest ECS source prefixes, the ones RFC 7871 recommends.
+const (
+	defaultECSv4 = 24
+	defaultECSv6 = 56
+)
+
+// upstreamECS returns the ECS option to send upstream under policy p for
+// the query r from a client at cip, or nil when none is to be sent. A
+// client's own option is passed on with its prefix cut to the configured
+// source length; a client that asks for no ECS (source prefix 0) gets none
+// added.
+func upstreamECS(p config.ECSConfig, r *dns.Msg, cip netip.Addr) *dns.EDNS0_SUBNET {
+	if p.Mode != config.ECSForward && p.Mode != config.ECSInject {
+		return nil
+	}
+	v4, v6 := p.SourceV4, p.SourceV6
+	if v4 == 0 {
+		v4 = defaultECSv4
+	}
+	if v6 == 0 {
+		v6 = defaultECSv6
+	}
+	if opt := r.IsEdns0(); opt != nil {
+		for _, o := range opt.Option {
+			ecs, ok := o.(*dns.EDNS0_SUBNET)
+			if !ok {
+				continue
+			}
+			a, ok := netip.AddrFromSlice(ecs.Address)
+			if !ok {
+				return nil
+			}
+			bits := int(ecs.SourceNetmask)
+			if ecs.Family == 1 {
+				bits = min(bits, v4)
+			} else {
+				bits = min(bits, v6)
+			}
+			return ecsOption(a.Unmap(), ecs.Family, bits)
+		}
+	}
+	if p.Mode != config.ECSInject || !cip.IsValid() {
+		return nil
+	}
+	cip = cip.Unmap()
+	if cip.Is4() {
+		return ecsOption(cip, 1, v4)
+	}
+	return ecsOption(cip, 2, v6)
+}
+
+// ecsOption builds an ECS option for the first bits of a.
+func ecsOption(a netip.Addr, family uint16, bits int) *dns.EDNS0_SUBNET {
+	p, err := a.Prefix(bits)
+	if err != nil {
+		return nil
+	}
+	return &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        family,
+		SourceNetmask: uint8(bits),
+		Address:       net.IP(p.Addr().AsSlice()),
+	}
+}
+
+// withECS adds the ECS option to the outgoing query m.
+func (s *Server) withECS(m *dns.Msg, ecs *dns.EDNS0_SUBNET) {
+	if ecs == nil {
+		return
+	}
+	size := defaultUDPSize
+	if s.cfg != nil && s.cfg.EDNS.UDPSize != 0 {
+		size = s.cfg.EDNS.UDPSize
+	}
+	m.SetEdns0(uint16(size), false)
+	opt := m.IsEdns0()
+	opt.Option = append(opt.Option, ecs)
+}
@@ -0,0 +1,85 @@
+package dns
+
+import (
+	"github.com/miekg/dns"
+
+	"namedot/internal/config"
+)
+
+// defaultUDPSize is the edns.udp_size default, the DNS Flag Day 2020 value
+// that avoids IP fragmentation on common paths.
+const defaultUDPSize = 1232
+
+// finishEDNS applies the EDNS policy to the reply m to r just before it is
+// written. Replies to EDNS queries carry one OPT record advertising
+// edns.udp_size, with node_id as NSID when asked for it; replies to other
+// queries none. UDP replies are cut to the smaller of the client's buffer
+// and edns.udp_size and flagged TC, so the client retries over TCP. With edns.padding, TCP replies to queries that
+// carry the padding option are padded to a multiple of edns.padding_block;
+// namedot has no DoT or DoH listener, so this is for a TLS terminator such
+// as dnsdist in front of it.
+func (s *Server) finishEDNS(r, m *dns.Msg, udp bool) {
+	var policy config.EDNSConfig
+	if s.cfg != nil {
+		policy = s.cfg.EDNS
+	}
+	max := policy.UDPSize
+	if max == 0 {
+		max = defaultUDPSize
+	}
+	// An upstream OPT is replaced: its size and cookie are not ours
+	extra := m.Extra[:0]
+	for _, rr := range m.Extra {
+		if rr.Header().Rrtype != dns.TypeOPT {
+			extra = append(extra, rr)
+		}
+	}
+	m.Extra = extra
+
+	opt := r.IsEdns0()
+	if opt == nil {
+		if udp {
+			m.Truncate(dns.MinMsgSize)
+		}
+		return
+	}
+	m.SetEdns0(uint16(max), opt.Do())
+	s.addNSID(opt, m.IsEdns0())
+	if udp {
+		size := int(opt.UDPSize())
+		if size < dns.MinMsgSize {
+			size = dns.MinMsgSize
+		}
+		m.Truncate(min(size, max))
+		return
+	}
+	if policy.Padding && hasPadding(opt) {
+		pad(m, policy.PaddingBlock)
+	}
+}
+
+func hasPadding(opt *dns.OPT) bool {
+	for _, o := range opt.Option {
+		if o.Option() == dns.EDNS0PADDING {
+			return true
+		}
+	}
+	return false
+}
+
+// pad adds a padding option that makes the packed reply a multiple of block
+// bytes (RFC 8467 block-length padding).
+func pad(m *dns.Msg, block int) {
+	if block <= 0 {
+		block = 468
+	}
+	opt := m.IsEdns0()
+	if opt == nil {
+		return
+	}
+	p := &dns.EDNS0_PADDING{}
+	opt.Option = append(opt.Option, p)
+	if n := m.Len() % block; n != 0 {
+		p.Padding = make([]byte, block-n)
+	}
+}
@@ -0,0 +1,114 @@
+package dns
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"namedot/internal/metrics"
+)
+
+// defaultExchangeTimeout is the reply timeout of clients without one, as in
+// the dns package.
+const defaultExchangeTimeout = 2 * time.Second
+
+// errReplyMismatch is returned for a TCP reply that does not match the
+// query; over UDP such replies are skipped.
+var errReplyMismatch = errors.New("reply does not match the query")
+
+var repliesDropped = metrics.NewCounter("namedot_forwarder_replies_dropped_total",
+	"Forwarder and stub zone replies dropped because they do not match the query, a sign of spoofing.", "reason")
+
+// exchange sends m to addr with c and returns the reply that matches it.
+//
+// Over UDP, dns.Client.Exchange skips replies with another ID but takes the
+// first one with the right ID without looking at its question, and gives up
+// on the first it cannot parse, so a single forged datagram makes the query
+// fail. Here every datagram that is unparsable, not a response, or has
+// another ID or question is dropped and counted, and the wait goes on until
+// the timeout. The socket is connected and so only receives from addr; each
+// query gets its own random source port and ID. Over TCP a mismatching reply
+// fails the query.
+func exchange(c *dns.Client, m *dns.Msg, addr string) (*dns.Msg, error) {
+	if strings.HasPrefix(c.Net, "tcp") {
+		in, _, err := c.Exchange(m, addr)
+		if err != nil {
+			if errors.Is(err, dns.ErrId) {
+				repliesDropped.Inc("id")
+			}
+			return nil, err
+		}
+		if reason := replyMismatch(m, in); reason != "" {
+			repliesDropped.Inc(reason)
+			return nil, errReplyMismatch
+		}
+		return in, nil
+	}
+
+	co, err := c.Dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	defer co.Close()
+	if opt := m.IsEdns0(); opt != nil && opt.UDPSize() >= dns.MinMsgSize {
+		co.UDPSize = opt.UDPSize()
+	} else if c.UDPSize >= dns.MinMsgSize {
+		co.UDPSize = c.UDPSize
+	}
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = defaultExchangeTimeout
+	}
+	if err := co.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	if err := co.WriteMsg(m); err != nil {
+		return nil, err
+	}
+	for {
+		p, err := co.ReadMsgHeader(nil)
+		if errors.Is(err, dns.ErrShortRead) {
+			repliesDropped.Inc("malformed")
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		in := new(dns.Msg)
+		if err := in.Unpack(p); err != nil {
+			repliesDropped.Inc("malformed")
+			continue
+		}
+		if reason := replyMismatch(m, in); reason != "" {
+			repliesDropped.Inc(reason)
+			continue
+		}
+		return in, nil
+	}
+}
+
+// replyMismatch returns why in is not the reply to q: "id", "not_response"
+// or "question"; "" when it is. The name is compared without regard to case,
+// which the 0x20 check of forward tightens. Errors such as FORMERR may come
+// without the question, as they carry no records to be trusted.
+func replyMismatch(q, in *dns.Msg) string {
+	if in.Id != q.Id {
+		return "id"
+	}
+	if !in.Response || in.Opcode != q.Opcode {
+		return "not_response"
+	}
+	if len(in.Question) == 0 && in.Rcode != dns.RcodeSuccess && in.Rcode != dns.RcodeNameError {
+		return ""
+	}
+	if len(in.Question) != 1 || len(q.Question) != 1 {
+		return "question"
+	}
+	a, b := in.Question[0], q.Question[0]
+	if !strings.EqualFold(a.Name, b.Name) || a.Qtype != b.Qtype || a.Qclass != b.Qclass {
+		return "question"
+	}
+	return ""
+}
@@ -0,0 +1,96 @@
+package dns
+
+import (
+	"errors"
+	"log"
+	"math/rand/v2"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// errQuestionMismatch is returned for a forwarder reply whose question is not
+// the one sent, which is what an off-path spoofed reply usually looks like.
+var errQuestionMismatch = errors.New("forwarder reply does not match the question")
+
+// forward asks the forwarder for q. With performance.forwarder_0x20 the
+// letters of the name are sent in random case and the reply must echo them
+// exactly (draft-vixie-dnsext-dns0x20); the returned message carries the
+// original name again. A truncated reply is retried over TCP so the answer
+// is not lost or passed on cut short. Replies that do not match the query
+// are dropped, see exchange. ecs, if not nil, is sent along as the client
+// subnet (forwarder_ecs).
+func (s *Server) forward(q dns.Question, ecs *dns.EDNS0_SUBNET) (*dns.Msg, error) {
+	name := dns.Fqdn(q.Name)
+	sent := name
+	mix := s.cfg.Performance.Forwarder0x20
+	if mix {
+		sent = randomizeCase(strings.ToLower(name))
+	}
+	fwd := new(dns.Msg)
+	fwd.SetQuestion(sent, q.Qtype)
+	s.withECS(fwd, ecs)
+	upstream := s.upstream()
+	in, err := exchange(s.resolver, fwd, upstream)
+	if err != nil {
+		return nil, err
+	}
+	if in.Truncated {
+		tcp, terr := exchange(s.tcpResolver, fwd, upstream)
+		if terr != nil {
+			log.Printf("DNS forward %s: TCP retry for truncated %s failed: %v", upstream, name, terr)
+			return nil, terr
+		}
+		in = tcp
+	}
+	if mix {
+		if len(in.Question) != 1 || in.Question[0].Name != sent || in.Question[0].Qtype != q.Qtype {
+			log.Printf("DNS forward %s: reply question does not match %s, dropped", upstream, sent)
+			repliesDropped.Inc("0x20")
+			return nil, errQuestionMismatch
+		}
+		restoreCase(in, sent, name)
+	}
+	return in, nil
+}
+
+// upstream returns the forwarder address, "" when there is none. The
+// forwarder may be changed at runtime (PUT /settings).
+func (s *Server) upstream() string {
+	if s.forwardAddr != "" {
+		return s.forwardAddr
+	}
+	if host := s.cfg.ForwarderHost(); host != "" {
+		return net.JoinHostPort(host, "53")
+	}
+	return ""
+}
+
+// randomizeCase flips the case of each letter of name at random.
+func randomizeCase(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		if ('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') && rand.IntN(2) == 0 {
+			b[i] = c ^ 0x20
+		}
+	}
+	return string(b)
+}
+
+// restoreCase replaces the randomized name with name in the question and in
+// the owner names of the records that use it.
+func restoreCase(m *dns.Msg, sent, name string) {
+	for i := range m.Question {
+		if m.Question[i].Name == sent {
+			m.Question[i].Name = name
+		}
+	}
+	for _, section := range [][]dns.RR{m.Answer, m.Ns, m.Extra} {
+		for _, rr := range section {
+			if rr.Header().Name == sent {
+				rr.Header().Name = name
+			}
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package dns
+
+import (
+	"errors"
+
+	"namedot/internal/geoip"
+)
+
+// ErrGeoIPNotLoaded is returned by ReloadGeoIP when GeoIP is disabled or its
+// databases failed to load at startup.
+var ErrGeoIPNotLoaded = errors.New("GeoIP databases are not loaded")
+
+// ReloadGeoIP reopens the GeoIP databases now, downloading them first when
+// download is set and geoip.download_urls are configured.
+func (s *Server) ReloadGeoIP(download bool) (geoip.ReloadResult, error) {
+	r, ok := s.geo.(geoip.Reloader)
+	if !ok {
+		return geoip.ReloadResult{}, ErrGeoIPNotLoaded
+	}
+	return r.Reload(download)
+}
@@ -0,0 +1,103 @@
+package dns
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// healthZone is the synthetic zone the server answers itself, for loopback
+// clients only: a TXT query for <nonce>.healthZone returns the nonce. It
+// lives under .invalid (RFC 6761) so it can never shadow a real zone.
+const healthZone = "_health.namedot.invalid."
+
+// probeTimeout bounds each loopback query of Probe.
+const probeTimeout = 2 * time.Second
+
+// healthAnswer answers r when it asks for the health zone from a loopback
+// address, and reports whether it did.
+func healthAnswer(w dns.ResponseWriter, r *dns.Msg) bool {
+	q := r.Question[0]
+	name := strings.ToLower(q.Name)
+	if q.Qtype != dns.TypeTXT || !strings.HasSuffix(name, "."+healthZone) {
+		return false
+	}
+	ip, ok := remoteIP(w.RemoteAddr())
+	if !ok || !ip.IsLoopback() {
+		return false
+	}
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+	m.Answer = []dns.RR{&dns.TXT{
+		Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET},
+		Txt: []string{strings.TrimSuffix(name, "."+healthZone)},
+	}}
+	_ = w.WriteMsg(m)
+	return true
+}
+
+// Probe queries the health zone through the UDP and the TCP listener, so a
+// wedged socket or a stuck handler shows up even while the HTTP side is
+// fine. It returns the round trip of each transport.
+func (s *Server) Probe() (map[string]time.Duration, error) {
+	pc, ln := s.Sockets()
+	if pc == nil || ln == nil {
+		return nil, fmt.Errorf("dns server not running")
+	}
+	rtts := make(map[string]time.Duration, 2)
+	for _, t := range []struct {
+		net  string
+		addr net.Addr
+	}{
+		{"udp", pc.LocalAddr()},
+		{"tcp", ln.Addr()},
+	} {
+		rtt, err := probe(t.net, loopbackAddr(t.addr))
+		if err != nil {
+			return rtts, fmt.Errorf("%s: %w", t.net, err)
+		}
+		rtts[t.net] = rtt
+	}
+	return rtts, nil
+}
+
+// probe asks the listener at addr for a random name of the health zone and
+// checks that the nonce comes back.
+func probe(network, addr string) (time.Duration, error) {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	nonce := hex.EncodeToString(b)
+	m := new(dns.Msg)
+	m.SetQuestion(nonce+"."+healthZone, dns.TypeTXT)
+	c := &dns.Client{Net: network, Timeout: probeTimeout}
+	in, rtt, err := c.Exchange(m, addr)
+	if err != nil {
+		return 0, err
+	}
+	if len(in.Answer) != 1 {
+		return rtt, fmt.Errorf("unexpected answer (rcode %s)", dns.RcodeToString[in.Rcode])
+	}
+	if txt, ok := in.Answer[0].(*dns.TXT); !ok || len(txt.Txt) != 1 || txt.Txt[0] != nonce {
+		return rtt, fmt.Errorf("answer does not echo the nonce")
+	}
+	return rtt, nil
+}
+
+// loopbackAddr turns a listener address into one to dial: a wildcard
+// listener (dual-stack for "[::]") is reached through 127.0.0.1.
+func loopbackAddr(a net.Addr) string {
+	host, port, err := net.SplitHostPort(a.String())
+	if err != nil {
+		return a.String()
+	}
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port)
+}
@@ -0,0 +1,45 @@
+package dns
+
+import (
+	dbm "namedot/internal/db"
+	"namedot/internal/health"
+)
+
+// SetHealth makes answers leave out the records that fail their health
+// check in h.
+func (s *Server) SetHealth(h *health.Checker) {
+	s.health = h
+}
+
+// HealthStatuses returns the health of the checked records, or nil when
+// health checks are off.
+func (s *Server) HealthStatuses() []health.Status {
+	if s.health == nil {
+		return nil
+	}
+	return s.health.Statuses()
+}
+
+// servable drops the unhealthy records from recs, so geo selection falls
+// over to the next records that match. When none is healthy all are kept:
+// an answer that may work beats no answer.
+func (s *Server) servable(recs []dbm.RData) []dbm.RData {
+	if out := s.healthy(recs); len(out) > 0 {
+		return out
+	}
+	return recs
+}
+
+// healthy returns the records of recs that pass their health check.
+func (s *Server) healthy(recs []dbm.RData) []dbm.RData {
+	if s.health == nil {
+		return recs
+	}
+	out := make([]dbm.RData, 0, len(recs))
+	for _, r := range recs {
+		if s.health.Healthy(r.ID) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
@@ -0,0 +1,83 @@
+package dns
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"gorm.io/gorm"
+
+	dbm "namedot/internal/db"
+)
+
+// hostTable caches the hosts table by name, like ZoneCache does for zones.
+type hostTable struct {
+	mu        sync.RWMutex
+	byName    map[string][]dbm.Host
+	lastFetch time.Time
+	ttl       time.Duration
+}
+
+// get returns the entries for name, reloading the table when it is stale.
+func (ht *hostTable) get(db *gorm.DB, name string) ([]dbm.Host, error) {
+	ht.mu.RLock()
+	if ht.byName != nil && time.Since(ht.lastFetch) < ht.ttl {
+		hosts := ht.byName[name]
+		ht.mu.RUnlock()
+		return hosts, nil
+	}
+	ht.mu.RUnlock()
+
+	all, err := dbm.ListHosts(db)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string][]dbm.Host, len(all))
+	for _, h := range all {
+		byName[h.Name] = append(byName[h.Name], h)
+	}
+	ht.mu.Lock()
+	ht.byName, ht.lastFetch = byName, time.Now()
+	ht.mu.Unlock()
+	return byName[name], nil
+}
+
+func (ht *hostTable) invalidate() {
+	ht.mu.Lock()
+	ht.byName = nil
+	ht.mu.Unlock()
+}
+
+// lookupHost answers A and AAAA queries from the hosts table. A name listed
+// there is owned by it for both types: asking for AAAA when only an A entry
+// exists gives an empty answer instead of the zone's or upstream's AAAA, so
+// the override cannot be bypassed over the other address family.
+func (s *Server) lookupHost(q dns.Question) (answers []dns.RR, ttl uint32, ok bool) {
+	if q.Qtype != dns.TypeA && q.Qtype != dns.TypeAAAA {
+		return nil, 0, false
+	}
+	hosts, err := s.hosts.get(s.db, dns.Fqdn(q.Name))
+	if err != nil || len(hosts) == 0 {
+		return nil, 0, false
+	}
+	qtype := dns.TypeToString[q.Qtype]
+	for _, h := range hosts {
+		if h.Type() != qtype {
+			continue
+		}
+		t := h.TTL
+		if t == 0 {
+			t = s.cfg.RecordDefaultTTL()
+		}
+		rr, err := dns.NewRR(fmt.Sprintf("%s %d %s %s", q.Name, t, qtype, h.Address))
+		if err != nil {
+			continue
+		}
+		answers = append(answers, rr)
+		if ttl == 0 || t < ttl {
+			ttl = t
+		}
+	}
+	return answers, ttl, true
+}
@@ -0,0 +1,34 @@
+package dns
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"namedot/internal/metrics"
+)
+
+var responsesTotal = metrics.NewCounter("namedot_dns_responses_total",
+	"DNS responses sent, by rcode. Dropped queries are not counted.", "rcode")
+
+func init() {
+	metrics.AddAlert(metrics.Alert{
+		Name: "NamedotHighServfailRate",
+		Expr: fmt.Sprintf(`sum by (instance) (rate(%s{rcode="SERVFAIL"}[5m])) / sum by (instance) (rate(%s[5m])) > 0.05`,
+			responsesTotal.Name(), responsesTotal.Name()),
+		For:      10 * time.Minute,
+		Severity: "critical",
+		Summary:  "Over 5% of the answers of {{ $labels.instance }} are SERVFAIL",
+		Metrics:  []string{responsesTotal.Name()},
+	})
+}
+
+// countResponse adds an answer to the responses metric.
+func countResponse(rcode int) {
+	name, ok := dns.RcodeToString[rcode]
+	if !ok {
+		name = fmt.Sprint(rcode)
+	}
+	responsesTotal.Inc(name)
+}
@@ -0,0 +1,82 @@
+package dns
+
+import (
+	"net/netip"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// minimal reports whether local answers from zone leave AUTHORITY and
+// ADDITIONAL empty: the zone's own setting, else minimal_responses.
+func (s *Server) minimal(zone string) bool {
+	if z, err := s.findZone(zone); err == nil && z != nil && z.MinimalResponses != nil {
+		return *z.MinimalResponses
+	}
+	return s.cfg.Minimal()
+}
+
+// fillSections adds the apex NS records of zone to the AUTHORITY section of
+// a positive local answer, and to ADDITIONAL the A and AAAA records of the
+// NS, MX and SRV targets inside the zone, so resolvers need no further
+// queries for them. Geo selection applies as for the answer itself.
+func (s *Server) fillSections(m *dns.Msg, zone string, cip netip.Addr) {
+	apex := dns.Fqdn(strings.ToLower(zone))
+	apexNS := false
+	for _, rr := range m.Answer {
+		if rr.Header().Rrtype == dns.TypeNS && strings.EqualFold(rr.Header().Name, apex) {
+			apexNS = true
+		}
+	}
+	if !apexNS {
+		ns, _, _, _, err := s.lookupTrace(dns.Question{Name: apex, Qtype: dns.TypeNS, Qclass: dns.ClassINET}, cip)
+		if err == nil {
+			for _, rr := range ns {
+				if rr.Header().Rrtype == dns.TypeNS {
+					m.Ns = append(m.Ns, rr)
+				}
+			}
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, rr := range m.Answer {
+		seen[strings.ToLower(rr.Header().Name)] = true
+	}
+	var targets []string
+	for _, rr := range append(append([]dns.RR{}, m.Answer...), m.Ns...) {
+		var t string
+		switch v := rr.(type) {
+		case *dns.NS:
+			t = v.Ns
+		case *dns.MX:
+			t = v.Mx
+		case *dns.SRV:
+			t = v.Target
+		default:
+			continue
+		}
+		t = strings.ToLower(dns.Fqdn(t))
+		if !seen[t] && dns.IsSubDomain(apex, t) {
+			seen[t] = true
+			targets = append(targets, t)
+		}
+	}
+	for _, t := range targets {
+		for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+			rrs, _, _, _, err := s.lookupTrace(dns.Question{Name: t, Qtype: qtype, Qclass: dns.ClassINET}, cip)
+			if err != nil {
+				continue
+			}
+			for _, rr := range rrs {
+				if rr.Header().Rrtype == qtype {
+					m.Extra = append(m.Extra, rr)
+				}
+			}
+		}
+	}
+	if s.cfg.Performance.ClampLocal {
+		s.clampRRs(m.Ns)
+		s.clampRRs(m.Extra)
+	}
+}
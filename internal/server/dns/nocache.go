@@ -0,0 +1,33 @@
+package dns
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// noCacheName reports whether qname is at or below a name in
+// performance.no_cache. It is cheap enough for the cache-hit path.
+func (s *Server) noCacheName(qname string) bool {
+	if s.cfg == nil {
+		return false
+	}
+	for _, name := range s.cfg.Performance.NoCache {
+		if dns.IsSubDomain(dns.Fqdn(strings.ToLower(name)), qname) {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheable reports whether answers for qname may go into the answer
+// cache: not when it is in performance.no_cache, nor when its local zone is
+// marked no_cache.
+func (s *Server) cacheable(qname string) bool {
+	qname = dns.Fqdn(strings.ToLower(qname))
+	if s.noCacheName(qname) {
+		return false
+	}
+	z, err := s.findZone(qname)
+	return err != nil || z == nil || !z.NoCache
+}
@@ -0,0 +1,54 @@
+package dns
+
+import (
+	"encoding/hex"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// defaultNodeIDName is the node_id_name default, the name RFC 4892 uses for
+// server identity.
+const defaultNodeIDName = "id.server."
+
+// nodeAnswer answers a TXT query for node_id_name, in class CH or IN, with
+// node_id, and reports whether it did. Without node_id it never answers.
+func (s *Server) nodeAnswer(w dns.ResponseWriter, r *dns.Msg) bool {
+	if s.cfg == nil || s.cfg.NodeID == "" {
+		return false
+	}
+	name := s.cfg.NodeIDName
+	if name == "" {
+		name = defaultNodeIDName
+	}
+	q := r.Question[0]
+	if q.Qtype != dns.TypeTXT || (q.Qclass != dns.ClassCHAOS && q.Qclass != dns.ClassINET) || !strings.EqualFold(q.Name, name) {
+		return false
+	}
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+	m.Answer = []dns.RR{&dns.TXT{
+		Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeTXT, Class: q.Qclass},
+		Txt: []string{s.cfg.NodeID},
+	}}
+	_, udp := w.RemoteAddr().(*net.UDPAddr)
+	s.finishEDNS(r, m, udp)
+	_ = w.WriteMsg(m)
+	return true
+}
+
+// addNSID puts node_id in the NSID option (RFC 5001) of the reply OPT opt
+// when the query OPT q asks for it.
+func (s *Server) addNSID(q, opt *dns.OPT) {
+	if s.cfg == nil || s.cfg.NodeID == "" {
+		return
+	}
+	for _, o := range q.Option {
+		if o.Option() == dns.EDNS0NSID {
+			opt.Option = append(opt.Option, &dns.EDNS0_NSID{Code: dns.EDNS0NSID, Nsid: hex.EncodeToString([]byte(s.cfg.NodeID))})
+			return
+		}
+	}
+}
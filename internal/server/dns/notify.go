@@ -0,0 +1,199 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"namedot/internal/config"
+	dbm "namedot/internal/db"
+)
+
+const (
+	// notifyPoll is how often zone serials are compared when no change
+	// kicked the notifier, catching changes made through the web admin or
+	// by another process sharing the database.
+	notifyPoll = 5 * time.Second
+	// notifyTimeout bounds each NOTIFY attempt, of notifyTries per target.
+	notifyTimeout = 2 * time.Second
+	notifyTries   = 3
+)
+
+// SetSyncTrigger makes a NOTIFY from the master (or replication.notify_from)
+// call sync, on slaves. Without it every NOTIFY is refused.
+func (s *Server) SetSyncTrigger(sync func()) {
+	s.syncTrigger = sync
+}
+
+// RunNotify sends a DNS NOTIFY (RFC 1996) for each enabled zone whose SOA
+// serial changed, or that was added, to the zone's also_notify secondaries
+// and to replication.notify, until ctx is done. Serials are compared after
+// every InvalidateZoneCache and every notifyPoll.
+func (s *Server) RunNotify(ctx context.Context) {
+	ticker := time.NewTicker(notifyPoll)
+	defer ticker.Stop()
+	var serials map[uint]uint32
+	for {
+		next, err := s.notifyChanged(ctx, serials)
+		if err != nil {
+			log.Printf("DNS NOTIFY: %v", err)
+		} else {
+			serials = next
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.notifyKick:
+		}
+	}
+}
+
+// notifyChanged notifies the zones whose serial differs from prev and
+// returns the current serials. A nil prev only records them.
+func (s *Server) notifyChanged(ctx context.Context, prev map[uint]uint32) (map[uint]uint32, error) {
+	var zones []dbm.Zone
+	if err := s.db.Select("id, name, serial, disabled").Find(&zones).Error; err != nil {
+		return nil, err
+	}
+	serials := make(map[uint]uint32, len(zones))
+	for _, z := range zones {
+		serials[z.ID] = z.Serial
+		if old, ok := prev[z.ID]; prev == nil || z.Disabled || (ok && old == z.Serial) {
+			continue
+		}
+		if err := s.notifyZone(ctx, z); err != nil {
+			log.Printf("DNS NOTIFY zone=%s: %v", z.Name, err)
+		}
+	}
+	return serials, nil
+}
+
+// notifyZone sends NOTIFYs for zone in the background: signed with the
+// zone's TSIG key to also_notify, unsigned to replication.notify.
+func (s *Server) notifyZone(ctx context.Context, zone dbm.Zone) error {
+	set, err := dbm.GetZoneSettings(s.db, zone.ID)
+	if err != nil {
+		return err
+	}
+	targets := make(map[string]string) // address -> TSIG key name
+	for _, t := range s.cfg.Replication.Notify {
+		if addr, err := config.NotifyAddr(t); err == nil {
+			targets[addr] = ""
+		}
+	}
+	for _, addr := range set.AlsoNotify {
+		targets[addr] = set.TSIGKey
+	}
+	name := dns.Fqdn(strings.ToLower(zone.Name))
+	for addr, key := range targets {
+		go s.sendNotify(ctx, name, zone.Serial, addr, key)
+	}
+	return nil
+}
+
+// sendNotify sends one NOTIFY, retrying until the target acknowledges it.
+func (s *Server) sendNotify(ctx context.Context, zone string, serial uint32, addr, key string) {
+	m := new(dns.Msg)
+	m.SetNotify(zone)
+	c := &dns.Client{Timeout: notifyTimeout}
+	if key != "" {
+		for _, k := range s.cfg.TSIGKeys {
+			if strings.EqualFold(k.Name, key) {
+				m.SetTsig(dns.Fqdn(strings.ToLower(k.Name)), dns.Fqdn(strings.ToLower(k.Algorithm)), 300, time.Now().Unix())
+				c.TsigSecret = s.tsigSecrets()
+				break
+			}
+		}
+	}
+	var err error
+	for try := 1; try <= notifyTries; try++ {
+		var in *dns.Msg
+		in, _, err = c.ExchangeContext(ctx, m, addr)
+		if err == nil && in.Rcode != dns.RcodeSuccess {
+			err = fmt.Errorf("answered %s", dns.RcodeToString[in.Rcode])
+		}
+		if err == nil {
+			log.Printf("DNS NOTIFY zone=%s serial=%d to=%s", zone, serial, addr)
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+	log.Printf("DNS NOTIFY zone=%s serial=%d to=%s failed after %d tries: %v", zone, serial, addr, notifyTries, err)
+}
+
+// notified answers a NOTIFY. On a slave, one from the master or from
+// replication.notify_from starts a sync; the zone named does not matter as
+// a sync fetches every zone. Anything else is refused.
+func (s *Server) notified(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+	zone := r.Question[0].Name
+	ip, _ := remoteIP(w.RemoteAddr())
+	why := ""
+	switch {
+	case s.syncTrigger == nil:
+		why = "not a slave"
+	case r.IsTsig() != nil && w.TsigStatus() != nil:
+		why = "bad TSIG: " + w.TsigStatus().Error()
+	case !s.notifyAllowed(ip):
+		why = "sender is not the master"
+	}
+	if why != "" {
+		log.Printf("DNS NOTIFY refused zone=%s from=%s: %s", zone, w.RemoteAddr(), why)
+		m.Rcode = dns.RcodeRefused
+		_ = w.WriteMsg(m)
+		return
+	}
+	log.Printf("DNS NOTIFY zone=%s from=%s: syncing from the master", zone, w.RemoteAddr())
+	_ = w.WriteMsg(m)
+	s.syncTrigger()
+}
+
+// notifyAllowed reports whether ip may trigger a sync: it must be in
+// replication.notify_from or, without it, be an address of the master_url
+// host.
+func (s *Server) notifyAllowed(ip netip.Addr) bool {
+	if !ip.IsValid() {
+		return false
+	}
+	if len(s.cfg.Replication.NotifyFrom) > 0 {
+		for _, c := range s.cfg.Replication.NotifyFrom {
+			if p, err := netip.ParsePrefix(c); err == nil && p.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	u, err := url.Parse(s.cfg.Replication.MasterURL)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	if a, err := netip.ParseAddr(host); err == nil {
+		return a.Unmap() == ip
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		log.Printf("DNS NOTIFY: resolve master %s: %v", host, err)
+		return false
+	}
+	for _, a := range addrs {
+		if a.Unmap() == ip {
+			return true
+		}
+	}
+	return false
+}
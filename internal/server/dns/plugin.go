@@ -0,0 +1,115 @@
+package dns
+
+import (
+	"net"
+	"net/netip"
+
+	"github.com/miekg/dns"
+)
+
+// Plugin is a stage of the query pipeline, registered with Use. Besides
+// Name it implements one or more of PreLookupPlugin, PostLookupPlugin and
+// PreResponsePlugin. Plugins run in the order they were registered. Query
+// statistics and anomaly alerts see every query whatever the plugins do.
+type Plugin interface {
+	Name() string
+}
+
+// PreLookupPlugin runs before the cache, hosts, zones, forwarder and zone
+// transfers. A non-nil response answers the query with it: the lookup and
+// the later pre-lookup plugins are skipped, and the query log shows the
+// source "plugin" with the plugin name as the rule.
+type PreLookupPlugin interface {
+	Plugin
+	PreLookup(q *Query) *dns.Msg
+}
+
+// PostLookupPlugin sees the response to every query except zone transfers,
+// whether looked up or answered by a plugin, before it is logged. It may change m in place or return a replacement; nil keeps m.
+type PostLookupPlugin interface {
+	Plugin
+	PostLookup(q *Query, m *dns.Msg) *dns.Msg
+}
+
+// PreResponsePlugin runs right before the response is written to the
+// client, after logging and EDNS handling; changes to m are sent as they
+// are. It does not run for dropped queries or the lookup tool.
+type PreResponsePlugin interface {
+	Plugin
+	PreResponse(q *Query, m *dns.Msg)
+}
+
+// Query is a query on its way through the plugins.
+type Query struct {
+	Msg      *dns.Msg     // the request as received
+	Question dns.Question // its question, name lowercased
+	ClientIP netip.Addr   // ECS address under geoip.use_ecs, else the transport address
+	Remote   net.Addr     // transport address; nil for the lookup tool (TestQuery)
+	Trace    *QueryTrace  // how the response was made; nil before the lookup
+}
+
+// Use adds p to the end of the pipeline. Plugins are registered before
+// Start; the list is not safe to change while queries are served.
+func (s *Server) Use(p Plugin) {
+	s.plugins = append(s.plugins, p)
+}
+
+// Plugins returns the names of the registered plugins in the order they run.
+func (s *Server) Plugins() []string {
+	names := make([]string, 0, len(s.plugins))
+	for _, p := range s.plugins {
+		names = append(names, p.Name())
+	}
+	return names
+}
+
+// preLookup runs the pre-lookup plugins until one answers, and returns its
+// response and name.
+func (s *Server) preLookup(q *Query) (*dns.Msg, string) {
+	for _, p := range s.plugins {
+		if pl, ok := p.(PreLookupPlugin); ok {
+			if m := pl.PreLookup(q); m != nil {
+				m.Id, m.Response = q.Msg.Id, true
+				return m, p.Name()
+			}
+		}
+	}
+	return nil, ""
+}
+
+// postLookup passes m through the post-lookup plugins.
+func (s *Server) postLookup(q *Query, m *dns.Msg) *dns.Msg {
+	for _, p := range s.plugins {
+		if pl, ok := p.(PostLookupPlugin); ok {
+			if nm := pl.PostLookup(q, m); nm != nil {
+				m = nm
+			}
+		}
+	}
+	return m
+}
+
+// preResponse runs the pre-response plugins on the response about to be
+// written.
+func (s *Server) preResponse(q *Query, m *dns.Msg) {
+	for _, p := range s.plugins {
+		if pl, ok := p.(PreResponsePlugin); ok {
+			pl.PreResponse(q, m)
+		}
+	}
+}
+
+// handle answers q through the plugins and the lookup; store and recurse
+// are as for resolve.
+func (s *Server) handle(q *Query, store, recurse bool) (*dns.Msg, QueryTrace) {
+	var tr QueryTrace
+	m, name := s.preLookup(q)
+	if m != nil {
+		tr = QueryTrace{ClientIP: q.ClientIP, Source: "plugin", Rule: name}
+	} else {
+		m, tr = s.answer(q.Msg, q.ClientIP, store, recurse)
+	}
+	q.Trace = &tr
+	m = s.postLookup(q, m)
+	return m, tr
+}
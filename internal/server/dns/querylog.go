@@ -0,0 +1,53 @@
+package dns
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"namedot/internal/querylog"
+)
+
+// ErrQueryLogDisabled is returned by SearchQueryLog unless query_log.enabled
+// is set.
+var ErrQueryLogDisabled = errors.New("query log is disabled (query_log.enabled)")
+
+// SetQueryLog makes every query answered be written to l.
+func (s *Server) SetQueryLog(l *querylog.Log) {
+	s.qlog = l
+}
+
+// logQuery writes how q, from remote, was answered with m to the query log.
+func (s *Server) logQuery(start time.Time, q dns.Question, remote net.Addr, m *dns.Msg, tr QueryTrace) {
+	e := querylog.Entry{
+		Time: start.UTC(), Name: q.Name, Type: dns.TypeToString[q.Qtype], Client: tr.ClientIP.String(),
+		Source: tr.Source, Zone: tr.Zone, Rule: tr.Rule,
+		Country: tr.Geo.Country, Continent: tr.Geo.Continent, ASN: tr.Geo.ASN,
+		Rcode:     dns.RcodeToString[m.Rcode],
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if a, ok := remoteIP(remote); ok && a != tr.ClientIP {
+		e.Remote = a.String()
+	}
+	if tr.Drop {
+		e.Rcode = "DROP"
+	}
+	if s.cfg.QueryLog.LogAnswers() {
+		for _, rr := range m.Answer {
+			e.Answers = append(e.Answers, strings.ReplaceAll(rr.String(), "\t", " "))
+		}
+	}
+	s.qlog.Add(e)
+}
+
+// SearchQueryLog returns the most recent logged queries that match f,
+// newest first.
+func (s *Server) SearchQueryLog(f querylog.Filter) ([]querylog.Entry, error) {
+	if s.qlog == nil {
+		return nil, ErrQueryLogDisabled
+	}
+	return s.qlog.Search(f)
+}
@@ -0,0 +1,63 @@
+package dns
+
+import (
+	"sync"
+	"time"
+)
+
+// rateWindow is the number of one-minute buckets kept by QueryRates.
+const rateWindow = 60
+
+// RateSample counts queries answered during one minute.
+type RateSample struct {
+	Minute    time.Time
+	Queries   uint64
+	CacheHits uint64
+}
+
+// rateCounter is a ring of per-minute counters. The zero value is ready to use.
+type rateCounter struct {
+	mu      sync.Mutex
+	buckets [rateWindow]RateSample
+}
+
+func rateSlot(m time.Time) int {
+	return int(m.Unix() / 60 % rateWindow)
+}
+
+func (rc *rateCounter) add(now time.Time, cacheHit bool) {
+	m := now.Truncate(time.Minute)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	b := &rc.buckets[rateSlot(m)]
+	if !b.Minute.Equal(m) {
+		*b = RateSample{Minute: m}
+	}
+	b.Queries++
+	if cacheHit {
+		b.CacheHits++
+	}
+}
+
+// samples returns the last rateWindow minutes ending with the current one,
+// oldest first. Minutes without queries are returned as zero samples.
+func (rc *rateCounter) samples(now time.Time) []RateSample {
+	cur := now.Truncate(time.Minute)
+	out := make([]RateSample, rateWindow)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	for i := range out {
+		m := cur.Add(-time.Duration(rateWindow-1-i) * time.Minute)
+		if b := rc.buckets[rateSlot(m)]; b.Minute.Equal(m) {
+			out[i] = b
+		} else {
+			out[i] = RateSample{Minute: m}
+		}
+	}
+	return out
+}
+
+// QueryRates returns per-minute query and cache hit counts for the last hour.
+func (s *Server) QueryRates() []RateSample {
+	return s.rates.samples(time.Now())
+}
@@ -0,0 +1,97 @@
+package dns
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"namedot/internal/config"
+)
+
+// rewriteRule maps query names to the name looked up instead.
+type rewriteRule struct {
+	exact  string // fqdn matched as is
+	suffix string // ".suffix." of a "*.suffix" match
+	re     *regexp.Regexp
+	to     string
+}
+
+func newRewriteRules(cfg []config.RewriteRule) ([]rewriteRule, error) {
+	out := make([]rewriteRule, 0, len(cfg))
+	for i, c := range cfg {
+		r := rewriteRule{to: strings.ToLower(strings.TrimSpace(c.To))}
+		switch {
+		case c.Regex != "":
+			re, err := regexp.Compile(c.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("rewrite[%d]: %w", i, err)
+			}
+			r.re = re
+		case strings.HasPrefix(c.Match, "*."):
+			r.suffix = dns.Fqdn(strings.ToLower(c.Match[1:]))
+		default:
+			r.exact = dns.Fqdn(strings.ToLower(c.Match))
+		}
+		if !strings.HasPrefix(r.to, "*.") && r.re == nil {
+			r.to = dns.Fqdn(r.to)
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// apply returns the name to look up instead of the lowercase fqdn name.
+func (r *rewriteRule) apply(name string) (string, bool) {
+	var to string
+	switch {
+	case r.re != nil:
+		n := strings.TrimSuffix(name, ".")
+		m := r.re.FindStringSubmatchIndex(n)
+		if m == nil {
+			return "", false
+		}
+		to = dns.Fqdn(string(r.re.ExpandString(nil, r.to, n, m)))
+	case r.suffix != "":
+		if len(name) <= len(r.suffix) || !strings.HasSuffix(name, r.suffix) {
+			return "", false
+		}
+		to = r.to
+		if strings.HasPrefix(to, "*.") {
+			to = dns.Fqdn(name[:len(name)-len(r.suffix)] + to[1:])
+		}
+	default:
+		if name != r.exact {
+			return "", false
+		}
+		to = r.to
+	}
+	if _, ok := dns.IsDomainName(to); !ok || to == name {
+		return "", false
+	}
+	return to, true
+}
+
+// rewriteName returns the target of the first rule matching name.
+func (s *Server) rewriteName(name string) (string, bool) {
+	for i := range s.rewrites {
+		if to, ok := s.rewrites[i].apply(name); ok {
+			return to, true
+		}
+	}
+	return "", false
+}
+
+// asQueried puts the name of the original question r back into a response
+// resolved for target, so the client sees an answer for what it asked.
+func asQueried(r *dns.Msg, m *dns.Msg, target string) *dns.Msg {
+	out := m.Copy()
+	out.Question = r.Question
+	for _, rr := range out.Answer {
+		if strings.EqualFold(rr.Header().Name, target) {
+			rr.Header().Name = r.Question[0].Name
+		}
+	}
+	return out
+}
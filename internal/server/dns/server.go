@@ -7,37 +7,105 @@ import (
     "net"
     "net/netip"
     "strings"
+    "sync"
     "time"
 
     "github.com/miekg/dns"
     "gorm.io/gorm"
 
+    "namedot/internal/anomaly"
+    "namedot/internal/blocklist"
     "namedot/internal/cache"
     "namedot/internal/config"
     dbm "namedot/internal/db"
+    "namedot/internal/dnstap"
     "namedot/internal/geoip"
+    "namedot/internal/health"
+    "namedot/internal/querylog"
+    "namedot/internal/recursor"
+    "namedot/internal/stats"
 )
 
 type Server struct {
-    cfg       *config.Config
-    db        *gorm.DB
-    udpServer *dns.Server
-    tcpServer *dns.Server
-    resolver  *dns.Client
-    cache     *cache.Cache
-    zoneCache *ZoneCache
-    geo       geoip.Provider
-    geoStop   func()
-    lastRule  string
+    cfg         *config.Config
+    db          *gorm.DB
+    udpServer   *dns.Server
+    tcpServer   *dns.Server
+    listenMu    sync.Mutex // guards the servers and sockets (RestartListeners)
+    packetConn  net.PacketConn // pre-opened sockets (SetListeners)
+    listener    net.Listener
+    resolver    *dns.Client
+    tcpResolver *dns.Client
+    forwardAddr string // fixed upstream address, instead of forwarder port 53 (tests)
+    recursor    *recursor.Resolver
+    recurseACL  []netip.Prefix
+    dns64       *dns64
+    stubs       []stubZone
+    rewrites    []rewriteRule
+    cache       *cache.Cache
+    zoneCache   *ZoneCache
+    hosts       hostTable
+    block       *blocklist.Blocklist
+    geo         geoip.Provider
+    geoStop     func()
+    stats       *stats.Collector
+    anomaly     *anomaly.Detector
+    rates       rateCounter
+    canaries    canaryTable
+    disabled    disabledTable
+    dynamic     dynamicTable
+    slow        *slowLog // nil unless slow_queries.enabled
+    qlog        *querylog.Log // nil unless query_log.enabled
+    tap         *dnstap.Writer // nil unless log.dnstap.enabled
+    health      *health.Checker // nil unless health_checks.enabled
+    plugins     []Plugin        // see Use
+    notifyKick  chan struct{} // wakes RunNotify after a change
+    syncTrigger func()        // starts a sync from the master (slaves)
 }
 
 func NewServer(cfg *config.Config, db *gorm.DB) (*Server, error) {
+    fwdTimeout := time.Duration(cfg.Performance.ForwarderTimeoutSec) * time.Second
     s := &Server{
-        cfg:       cfg,
-        db:        db,
-        resolver:  &dns.Client{Timeout: time.Duration(cfg.Performance.ForwarderTimeoutSec) * time.Second},
-        cache:     cache.New(cfg.Performance.CacheSize),
-        zoneCache: NewZoneCache(5 * time.Minute),
+        cfg:         cfg,
+        db:          db,
+        resolver:    &dns.Client{Timeout: fwdTimeout},
+        tcpResolver: &dns.Client{Net: "tcp", Timeout: fwdTimeout},
+        cache:       cache.New(cfg.Performance.CacheSize),
+        zoneCache:   NewZoneCache(5 * time.Minute),
+        hosts:       hostTable{ttl: 5 * time.Minute},
+        canaries:    canaryTable{ttl: 5 * time.Minute},
+        disabled:    disabledTable{ttl: 5 * time.Minute},
+        notifyKick:  make(chan struct{}, 1),
+    }
+    if cfg.Recursion.Enabled {
+        rec, err := recursor.New(cfg.Recursion, fwdTimeout)
+        if err != nil {
+            return nil, fmt.Errorf("recursion: %w", err)
+        }
+        s.recursor = rec
+        for _, c := range cfg.Recursion.AllowedCIDRs {
+            p, err := netip.ParsePrefix(c)
+            if err != nil {
+                return nil, fmt.Errorf("recursion.allowed_cidrs: %w", err)
+            }
+            s.recurseACL = append(s.recurseACL, p.Masked())
+        }
+    }
+    if cfg.SlowQueries.Enabled {
+        s.slow = newSlowLog(cfg.SlowQueries.Size, time.Duration(cfg.SlowQueries.ThresholdMs)*time.Millisecond)
+    }
+    s.stubs = newStubZones(cfg.StubZones)
+    rw, err := newRewriteRules(cfg.Rewrite)
+    if err != nil {
+        return nil, err
+    }
+    s.rewrites = rw
+    if cfg.DNS64.Enabled {
+        d, err := newDNS64(cfg.DNS64)
+        if err != nil {
+            return nil, err
+        }
+        s.dns64 = d
     }
     // GeoIP provider
     if cfg.GeoIP.Enabled && cfg.GeoIP.MMDBPath != "" {
@@ -60,208 +128,733 @@ func NewServer(cfg *config.Config, db *gorm.DB) (*Server, error) {
     return s, nil
 }
 
-func (s *Server) Start() error {
-    dns.HandleFunc(".", s.serveDNS)
-    s.udpServer = &dns.Server{Addr: s.cfg.Listen, Net: "udp"}
-    s.tcpServer = &dns.Server{Addr: s.cfg.Listen, Net: "tcp"}
+// SetListeners makes Start serve on sockets opened elsewhere, e.g. passed by
+// systemd socket activation, instead of binding listen. Either may be nil.
+func (s *Server) SetListeners(pc net.PacketConn, ln net.Listener) {
+    s.packetConn, s.listener = pc, ln
+}
+
+// Sockets returns the UDP and TCP sockets the running server listens on, for
+// handing them to a new process.
+func (s *Server) Sockets() (net.PacketConn, net.Listener) {
+    s.listenMu.Lock()
+    defer s.listenMu.Unlock()
+    if s.udpServer == nil || s.tcpServer == nil {
+        return nil, nil
+    }
+    return s.udpServer.PacketConn, s.tcpServer.Listener
+}
 
-    go func() {
-        if err := s.udpServer.ListenAndServe(); err != nil {
-            log.Fatalf("failed to start UDP server: %v", err)
+// Start binds the listen address for UDP and TCP, unless sockets were set,
+// and returns once both are served. A bind error is returned.
+func (s *Server) Start() error {
+    s.listenMu.Lock()
+    defer s.listenMu.Unlock()
+    pc, ln := s.packetConn, s.listener
+    if pc == nil {
+        var err error
+        if pc, err = net.ListenPacket("udp", s.cfg.Listen); err != nil {
+            return fmt.Errorf("udp listen: %w", err)
+        }
+    }
+    if ln == nil {
+        var err error
+        if ln, err = net.Listen("tcp", s.cfg.Listen); err != nil {
+            if s.packetConn == nil {
+                pc.Close()
+            }
+            return fmt.Errorf("tcp listen: %w", err)
+        }
+    }
+    udp, tcp, err := s.serve(pc, ln)
+    if err != nil {
+        if s.packetConn == nil {
+            pc.Close()
         }
-    }()
-    go func() {
-        if err := s.tcpServer.ListenAndServe(); err != nil {
-            log.Fatalf("failed to start TCP server: %v", err)
+        if s.listener == nil {
+            ln.Close()
         }
-    }()
+        return err
+    }
+    s.udpServer, s.tcpServer = udp, tcp
     return nil
 }
 
-func (s *Server) Shutdown() error {
-    ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-    defer cancel()
-    if s.udpServer != nil {
-        _ = s.udpServer.ShutdownContext(ctx)
+// serve starts UDP and TCP servers on pc and ln, each with this server as
+// its handler, and returns them once both are serving.
+func (s *Server) serve(pc net.PacketConn, ln net.Listener) (*dns.Server, *dns.Server, error) {
+    started := make(chan error, 4)
+    notify := func() { started <- nil }
+    handler := dns.HandlerFunc(s.serveDNS)
+    udp := &dns.Server{Net: "udp", Handler: handler, TsigSecret: s.tsigSecrets(), PacketConn: pc, NotifyStartedFunc: notify}
+    tcp := &dns.Server{Net: "tcp", Handler: handler, TsigSecret: s.tsigSecrets(), Listener: ln, NotifyStartedFunc: notify}
+
+    for _, srv := range []*dns.Server{udp, tcp} {
+        go func(srv *dns.Server) {
+            if err := srv.ActivateAndServe(); err != nil {
+                err = fmt.Errorf("%s server: %w", srv.Net, err)
+                log.Print(err)
+                started <- err
+            }
+        }(srv)
+    }
+    for range 2 {
+        if err := <-started; err != nil {
+            shutdownServers(udp, tcp)
+            return nil, nil, err
+        }
+    }
+    return udp, tcp, nil
+}
+
+// RestartListeners replaces the UDP and TCP servers with new ones on the same
+// sockets, ending open TCP connections and their goroutines. The sockets are
+// duplicated rather than bound again, so this works after dropping root and
+// with sockets from systemd. The new servers start before the old ones stop,
+// so no query goes unanswered.
+func (s *Server) RestartListeners() error {
+    s.listenMu.Lock()
+    defer s.listenMu.Unlock()
+    if s.udpServer == nil || s.tcpServer == nil {
+        return fmt.Errorf("dns server not running")
+    }
+    udpConn, ok := s.udpServer.PacketConn.(*net.UDPConn)
+    if !ok {
+        return fmt.Errorf("udp socket cannot be duplicated")
     }
-    if s.tcpServer != nil {
-        _ = s.tcpServer.ShutdownContext(ctx)
+    tcpListener, ok := s.tcpServer.Listener.(*net.TCPListener)
+    if !ok {
+        return fmt.Errorf("tcp socket cannot be duplicated")
     }
+    uf, err := udpConn.File()
+    if err != nil {
+        return fmt.Errorf("udp socket: %w", err)
+    }
+    defer uf.Close()
+    tf, err := tcpListener.File()
+    if err != nil {
+        return fmt.Errorf("tcp socket: %w", err)
+    }
+    defer tf.Close()
+    pc, err := net.FilePacketConn(uf)
+    if err != nil {
+        return fmt.Errorf("udp socket: %w", err)
+    }
+    ln, err := net.FileListener(tf)
+    if err != nil {
+        pc.Close()
+        return fmt.Errorf("tcp socket: %w", err)
+    }
+
+    udp, tcp, err := s.serve(pc, ln)
+    if err != nil {
+        pc.Close()
+        ln.Close()
+        return err
+    }
+    oldUDP, oldTCP := s.udpServer, s.tcpServer
+    s.udpServer, s.tcpServer = udp, tcp
+    s.packetConn, s.listener = pc, ln
+    shutdownServers(oldUDP, oldTCP)
+    return nil
+}
+
+// Ping sends an empty query to the UDP listener and waits for the reply,
+// which is given without touching the database. It backs the systemd
+// watchdog.
+func (s *Server) Ping() error {
+    pc, _ := s.Sockets()
+    if pc == nil {
+        return fmt.Errorf("udp server not running")
+    }
+    m := new(dns.Msg)
+    m.Id = dns.Id()
+    c := &dns.Client{Timeout: 2 * time.Second}
+    _, _, err := c.Exchange(m, pc.LocalAddr().String())
+    return err
+}
+
+func (s *Server) Shutdown() error {
+    s.listenMu.Lock()
+    shutdownServers(s.udpServer, s.tcpServer)
+    s.listenMu.Unlock()
     if s.geoStop != nil {
         s.geoStop()
     }
     return nil
 }
 
-// InvalidateZoneCache clears the zone cache, forcing a refresh on next DNS query
+// shutdownServers stops the given servers, giving their queries two seconds
+// to finish. Either may be nil.
+func shutdownServers(servers ...*dns.Server) {
+    ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+    defer cancel()
+    for _, srv := range servers {
+        if srv != nil {
+            _ = srv.ShutdownContext(ctx)
+        }
+    }
+}
+
+// InvalidateZoneCache clears the zone cache (and the hosts and canary
+// tables), forcing a refresh on next DNS query
 func (s *Server) InvalidateZoneCache() {
+    s.hosts.invalidate()
+    s.canaries.invalidate()
+    s.disabled.invalidate()
+    s.dynamic.invalidate()
+    select {
+    case s.notifyKick <- struct{}{}:
+    default:
+    }
     if s.zoneCache != nil {
         s.zoneCache.Invalidate()
+        if s.cfg.DB.HasReplica() {
+            // The replica may not have the change yet; refresh again once it has caught up
+            time.AfterFunc(replicaLagGrace, s.zoneCache.Invalidate)
+        }
     }
 }
 
-func (s *Server) serveDNS(w dns.ResponseWriter, r *dns.Msg) {
-    m := new(dns.Msg)
-    m.SetReply(r)
-    m.Authoritative = true
+// SetBlocklist enables rewriting of blocklisted names before forwarding.
+func (s *Server) SetBlocklist(b *blocklist.Blocklist) {
+    s.block = b
+}
+
+// SetStats enables per-zone and per-client-subnet query counting.
+func (s *Server) SetStats(c *stats.Collector) {
+    s.stats = c
+}
+
+// SetAnomaly enables NXDOMAIN/SERVFAIL spike alerts.
+func (s *Server) SetAnomaly(d *anomaly.Detector) {
+    s.anomaly = d
+}
+
+// countQuery counts every query under the subnet of the client's transport
+// address, and attributes it to the local zone it falls into; queries outside
+// local zones are not counted per zone.
+func (s *Server) countQuery(q dns.Question, addr net.Addr) {
+    if s.stats == nil {
+        return
+    }
+    if ip, ok := remoteIP(addr); ok {
+        s.stats.IncClient(ip)
+    }
+    zone, err := s.findZone(strings.ToLower(dns.Fqdn(q.Name)))
+    if err != nil || zone == nil {
+        return
+    }
+    qtype, ok := dns.TypeToString[q.Qtype]
+    if !ok {
+        qtype = fmt.Sprintf("TYPE%d", q.Qtype)
+    }
+    s.stats.Inc(zone.Name, qtype)
+}
+
+// replicaLagGrace is how long to wait before re-reading the zone list from a read replica.
+const replicaLagGrace = 2 * time.Second
+
+// QueryTrace describes how a query was answered.
+type QueryTrace struct {
+    ClientIP netip.Addr
+    Geo      geoip.Info
+    Source   string // cache | hosts | local | blocked | disabled | stub | forward | recurse | refused | nxdomain | plugin
+    Zone     string // matched local zone, if any
+    Rule     string // geo rule that selected the records (local answers), the blocklist, the stub zone or the plugin
+    Rewrite  string // name looked up instead of the query name, by a rewrite rule
+    TTL      uint32
+    Drop     bool // no reply is sent, under a deny.* or blocklist.action drop policy
+    Timing   Timing
+}
 
+func (s *Server) serveDNS(w dns.ResponseWriter, r *dns.Msg) {
     if len(r.Question) == 0 {
+        m := new(dns.Msg)
+        m.SetReply(r)
+        m.Authoritative = true
         _ = w.WriteMsg(m)
         return
     }
+    if r.Opcode == dns.OpcodeNotify {
+        s.notified(w, r)
+        return
+    }
+    if healthAnswer(w, r) {
+        return
+    }
+    if s.nodeAnswer(w, r) {
+        return
+    }
+    start := time.Now()
     q := r.Question[0]
     // Normalize domain name to lowercase (RFC 1123: DNS names are case-insensitive)
     // This prevents cache evasion via case variations (e.g., Example.COM vs example.com)
     q.Name = strings.ToLower(q.Name)
+    // Counted before the plugins, which may answer the query themselves
+    s.countQuery(q, w.RemoteAddr())
     // Determine client IP (ECS or remote) for geo and cache scoping
     useECS := false
     if s.cfg != nil {
         useECS = s.cfg.GeoIP.UseECS
     }
     cip := clientIPFrom(r, w, useECS)
-    prov := s.geo
-    if prov == nil {
-        prov = geoip.NewNoop()
+    query := &Query{Msg: r, Question: q, ClientIP: cip, Remote: w.RemoteAddr()}
+    if q.Qtype == dns.TypeAXFR || q.Qtype == dns.TypeIXFR {
+        // Plugins may refuse transfers the zone settings allow
+        if m, name := s.preLookup(query); m != nil {
+            log.Printf("DNS XFR plugin=%s zone=%s to=%s rcode=%d", name, q.Name, w.RemoteAddr(), m.Rcode)
+            _ = w.WriteMsg(m)
+            return
+        }
+        s.transfer(w, r)
+        return
+    }
+    m, tr := s.handle(query, true, r.RecursionDesired && s.mayRecurse(w.RemoteAddr()))
+    s.rates.add(time.Now(), tr.Source == "cache")
+    s.observeAnomaly(q, w.RemoteAddr(), m.Rcode, tr.Source)
+    if s.slow != nil {
+        s.slow.add(SlowQuery{
+            Time: start, Name: q.Name, Type: dns.TypeToString[q.Qtype], Client: cip.String(),
+            Source: tr.Source, Zone: tr.Zone, Rule: tr.Rule, Geo: tr.Geo,
+            Rcode: dns.RcodeToString[m.Rcode], Total: time.Since(start), Timing: tr.Timing,
+        })
     }
-    ginfo := prov.Lookup(cip)
+    if s.qlog != nil {
+        s.logQuery(start, q, w.RemoteAddr(), m, tr)
+    }
+
     verbose := false
     if s.cfg != nil {
-        verbose = s.cfg.Log.DNSVerbose
+        verbose = s.cfg.DNSVerbose()
     }
     geoStr := ""
     if verbose {
-        geoStr = fmt.Sprintf(" geo[c=%s,ct=%s,asn=%d]", ginfo.Country, ginfo.Continent, ginfo.ASN)
+        geoStr = fmt.Sprintf(" geo[c=%s,ct=%s,asn=%d]", tr.Geo.Country, tr.Geo.Continent, tr.Geo.ASN)
     }
+    switch tr.Source {
+    case "cache":
+        log.Printf("DNS QUERY cache-hit q=%s type=%s from=%s%s id=%d", q.Name, dns.TypeToString[q.Qtype], w.RemoteAddr(), geoStr, r.Id)
+    case "hosts":
+        log.Printf("DNS QUERY hosts q=%s type=%s from=%s answers=%d ttl=%d id=%d", q.Name, dns.TypeToString[q.Qtype], w.RemoteAddr(), len(m.Answer), tr.TTL, r.Id)
+    case "local":
+        if verbose {
+            log.Printf("DNS QUERY q=%s type=%s from=%s ecs=%s%s rule=%s answers=%d ttl=%d id=%d", q.Name, dns.TypeToString[q.Qtype], w.RemoteAddr(), cip, geoStr, tr.Rule, len(m.Answer), tr.TTL, r.Id)
+        } else {
+            log.Printf("DNS QUERY q=%s type=%s from=%s answers=%d ttl=%d id=%d", q.Name, dns.TypeToString[q.Qtype], w.RemoteAddr(), len(m.Answer), tr.TTL, r.Id)
+        }
+    case "blocked":
+        log.Printf("DNS QUERY blocked q=%s type=%s from=%s list=%s rcode=%d answers=%d id=%d", q.Name, dns.TypeToString[q.Qtype], w.RemoteAddr(), tr.Rule, m.Rcode, len(m.Answer), r.Id)
+    case "stub":
+        log.Printf("DNS QUERY stub q=%s type=%s from=%s zone=%s rcode=%d answers=%d id=%d", q.Name, dns.TypeToString[q.Qtype], w.RemoteAddr(), tr.Rule, m.Rcode, len(m.Answer), r.Id)
+    case "forward":
+        log.Printf("DNS QUERY forward q=%s type=%s from=%s to=%s%s rcode=%d id=%d", q.Name, dns.TypeToString[q.Qtype], w.RemoteAddr(), s.cfg.ForwarderHost(), geoStr, m.Rcode, r.Id)
+    case "recurse":
+        log.Printf("DNS QUERY recurse q=%s type=%s from=%s%s rcode=%d ad=%t answers=%d id=%d", q.Name, dns.TypeToString[q.Qtype], w.RemoteAddr(), geoStr, m.Rcode, m.AuthenticatedData, len(m.Answer), r.Id)
+    case "refused":
+        log.Printf("DNS QUERY refused q=%s type=%s from=%s rcode=%d drop=%t id=%d", q.Name, dns.TypeToString[q.Qtype], w.RemoteAddr(), m.Rcode, tr.Drop, r.Id)
+    case "disabled":
+        log.Printf("DNS QUERY disabled q=%s type=%s from=%s zone=%s rcode=%d drop=%t id=%d", q.Name, dns.TypeToString[q.Qtype], w.RemoteAddr(), tr.Zone, m.Rcode, tr.Drop, r.Id)
+    case "plugin":
+        log.Printf("DNS QUERY plugin q=%s type=%s from=%s plugin=%s rcode=%d answers=%d id=%d", q.Name, dns.TypeToString[q.Qtype], w.RemoteAddr(), tr.Rule, m.Rcode, len(m.Answer), r.Id)
+    default:
+        log.Printf("DNS QUERY nxdomain q=%s type=%s from=%s%s id=%d", q.Name, dns.TypeToString[q.Qtype], w.RemoteAddr(), geoStr, r.Id)
+    }
+    if tr.Drop {
+        if s.tap != nil {
+            s.tapMessages(w, r, nil, start)
+        }
+        return
+    }
+    countResponse(m.Rcode)
+    // Answers fetched over TCP from the forwarder can exceed what a UDP
+    // client accepts; they are cut down with TC set so the client retries on TCP
+    _, udp := w.RemoteAddr().(*net.UDPAddr)
+    s.finishEDNS(r, m, udp)
+    s.preResponse(query, m)
+    _ = w.WriteMsg(m)
+    if s.tap != nil {
+        s.tapMessages(w, r, m, start)
+    }
+}
+
+// TestQuery answers name/qtype as if it came from clientIP, going through the
+// same plugins, cache, geo selection and forwarding as real queries. It is
+// not counted in statistics and does not populate the cache.
+func (s *Server) TestQuery(name string, qtype uint16, clientIP netip.Addr) (*dns.Msg, QueryTrace) {
+    r := new(dns.Msg)
+    r.SetQuestion(dns.Fqdn(strings.ToLower(name)), qtype)
+    return s.handle(&Query{Msg: r, Question: r.Question[0], ClientIP: clientIP}, false, true)
+}
+
+// answer resolves r, or the name a rewrite rule maps it to, and applies
+// DNS64 synthesis to the response.
+func (s *Server) answer(r *dns.Msg, cip netip.Addr, store, recurse bool) (*dns.Msg, QueryTrace) {
+    target, rewritten := s.rewriteName(strings.ToLower(dns.Fqdn(r.Question[0].Name)))
+    orig := r
+    if rewritten {
+        r = r.Copy()
+        r.Question[0].Name = target
+    }
+    m, tr := s.resolve(r, cip, store, recurse)
+    m = s.applyDNS64(r, m, cip, store, recurse)
+    if rewritten {
+        tr.Rewrite = target
+        m = asQueried(orig, m, target)
+    }
+    return m, tr
+}
+
+// resolve builds the response to r for a client at cip: from cache, the
+// hosts table, local zones, the forwarder or recursion (only when recurse
+// is set). Responses are cached only when store is set, and never for
+// names marked no_cache.
+func (s *Server) resolve(r *dns.Msg, cip netip.Addr, store, recurse bool) (*dns.Msg, QueryTrace) {
+    m := new(dns.Msg)
+    m.SetReply(r)
+    m.Authoritative = true
+
+    q := r.Question[0]
+    q.Name = strings.ToLower(q.Name)
+    prov := s.geo
+    if prov == nil {
+        prov = geoip.NewNoop()
+    }
+    geoStart := time.Now()
+    tr := QueryTrace{ClientIP: cip, Geo: prov.Lookup(cip)}
+    tr.Timing.Geo = time.Since(geoStart)
 
     // Cache key
     cacheScope := cip.String()
     if !cip.IsValid() { cacheScope = "" }
     key := fmt.Sprintf("%s|%d|%s", strings.ToLower(q.Name), q.Qtype, cacheScope)
-    if v, ok := s.cache.Get(key); ok {
+    // Names in performance.no_cache skip answers cached before they were
+    // listed; answers from zones marked no_cache only age out
+    if v, age, ok := s.cache.GetWithAge(key); ok && !s.noCacheName(q.Name) {
         if cached, ok2 := v.(*dns.Msg); ok2 {
-            log.Printf("DNS QUERY cache-hit q=%s type=%s from=%s%s id=%d", q.Name, dns.TypeToString[q.Qtype], w.RemoteAddr(), geoStr, r.Id)
+            tr.Source = "cache"
+            if !store {
+                // Test queries only; keep the cache-hit path cheap
+                if z, _ := s.findZone(strings.ToLower(dns.Fqdn(q.Name))); z != nil {
+                    tr.Zone = z.Name
+                }
+            }
             resp := cached.Copy()
             // Update transaction ID and question to match current request
             resp.Id = r.Id
             resp.Question = r.Question
-            _ = w.WriteMsg(resp)
-            return
+            s.decayTTLs(resp, age)
+            return resp, tr
         }
     }
 
+    cacheOK := store && s.cacheable(q.Name)
+
+    // Static host overrides win over zones
+    if answers, ttl, ok := s.lookupHost(q); ok {
+        ttl = s.clampLocal(answers, ttl)
+        tr.Source, tr.TTL = "hosts", ttl
+        m.Answer = answers
+        if cacheOK && ttl > 0 {
+            s.cache.Set(key, m.Copy(), time.Duration(ttl)*time.Second)
+        }
+        return m, tr
+    }
+
+    // Disabled zones are answered under deny.disabled_zones when it is set;
+    // otherwise they are looked past, as if they did not exist
+    if dz := s.disabledZone(q.Name); dz != "" {
+        tr.Source, tr.Zone = "disabled", dz
+        tr.Drop = deny(m, s.cfg.Deny.DisabledZones)
+        return m, tr
+    }
+
     // Resolve locally
-    answers, ttl, err := s.lookup(r, q, cip)
+    dbStart := time.Now()
+    answers, ttl, zone, rule, err := s.lookupTrace(q, cip)
+    tr.Zone, tr.Rule = zone, rule
+    tr.Timing.DB = time.Since(dbStart)
     if err == nil && len(answers) > 0 {
-        if verbose {
-            log.Printf("DNS QUERY q=%s type=%s from=%s ecs=%s%s rule=%s answers=%d ttl=%d id=%d", q.Name, dns.TypeToString[q.Qtype], w.RemoteAddr(), cip, geoStr, s.lastRule, len(answers), ttl, r.Id)
-        } else {
-            log.Printf("DNS QUERY q=%s type=%s from=%s answers=%d ttl=%d id=%d", q.Name, dns.TypeToString[q.Qtype], w.RemoteAddr(), len(answers), ttl, r.Id)
-        }
+        ttl = s.clampLocal(answers, ttl)
+        tr.Source, tr.TTL = "local", ttl
         m.Answer = answers
-        _ = w.WriteMsg(m)
-        if ttl > 0 {
+        if !s.minimal(tr.Zone) {
+            s.fillSections(m, tr.Zone, cip)
+        }
+        tr.Timing.DB = time.Since(dbStart)
+        if cacheOK && ttl > 0 {
             // Store a copy in cache to avoid mutating original
             s.cache.Set(key, m.Copy(), time.Duration(ttl)*time.Second)
         }
-        return
+        return m, tr
+    }
+
+    // A name that exists in a local zone without records of this type, or
+    // only has names below it (an empty non-terminal), gets NODATA rather
+    // than NXDOMAIN or a forwarded answer
+    if tr.Zone != "" {
+        soa, ok := s.nodata(q.Name, cip)
+        tr.Timing.DB = time.Since(dbStart)
+        if ok {
+            tr.Source, tr.Rule = "local", "nodata"
+            ttl := s.cfg.NegativeCacheTTL()
+            if soa != nil {
+                ttl = s.clampLocal([]dns.RR{soa}, min(soa.Hdr.Ttl, soa.Minttl))
+                m.Ns = []dns.RR{soa}
+            }
+            tr.TTL = ttl
+            if cacheOK && ttl > 0 {
+                s.cache.Set(key, m.Copy(), time.Duration(ttl)*time.Second)
+            }
+            return m, tr
+        }
+    }
+
+    // Blocklists rewrite names outside local zones before they are forwarded
+    if tr.Zone == "" {
+        if rule, ok := s.block.Match(q.Name, cip); ok {
+            action := s.block.Respond(m, q, rule)
+            if store {
+                blocklist.Count(rule.Source, action)
+            }
+            tr.Source, tr.Rule = "blocked", rule.Source
+            tr.Drop = action == config.DenyDrop
+            return m, tr
+        }
+    }
+
+    // Stub zones go to their own servers, bypassing forwarder and recursion
+    if sz := s.stubFor(q.Name); sz != nil {
+        tr.Source, tr.Rule = "stub", sz.name
+        upStart := time.Now()
+        in, serr := s.queryStub(sz, q, upstreamECS(sz.ecs, r, cip))
+        tr.Timing.Upstream = time.Since(upStart)
+        if serr != nil {
+            m.Authoritative = false
+            m.Rcode = dns.RcodeServerFailure
+            return m, tr
+        }
+        in.Id = r.Id
+        in.Authoritative = false
+        in.RecursionAvailable = true
+        ttl := s.forwardedTTL(in)
+        tr.TTL = ttl
+        if cacheOK && ttl > 0 {
+            s.cache.Set(key, in.Copy(), time.Duration(ttl)*time.Second)
+        }
+        return in, tr
     }
 
     // Forward on miss
-    if s.cfg.Forwarder != "" {
-        fwd := new(dns.Msg)
-        fwd.SetQuestion(dns.Fqdn(q.Name), q.Qtype)
-        in, _, ferr := s.resolver.Exchange(fwd, net.JoinHostPort(s.cfg.Forwarder, "53"))
+    if s.upstream() != "" {
+        upStart := time.Now()
+        in, ferr := s.forward(q, upstreamECS(s.cfg.ForwarderECS, r, cip))
+        tr.Timing.Upstream = time.Since(upStart)
         if ferr == nil && in != nil {
-            log.Printf("DNS QUERY forward q=%s type=%s from=%s to=%s%s rcode=%d id=%d", q.Name, dns.TypeToString[q.Qtype], w.RemoteAddr(), s.cfg.Forwarder, geoStr, in.Rcode, r.Id)
+            tr.Source = "forward"
             in.Id = r.Id
-            _ = w.WriteMsg(in)
-            // Cache negative responses (NXDOMAIN, NODATA, etc.) to prevent repeated upstream queries
-            // Use a shorter TTL for negative caching (300 seconds = 5 minutes)
-            if in.Rcode != dns.RcodeSuccess {
-                s.cache.Set(key, in.Copy(), 5*time.Minute)
+            // Upstream TTLs are bounded by performance.min_ttl/max_ttl before
+            // caching, so a TTL of 0 or of several days cannot defeat the cache
+            ttl := s.forwardedTTL(in)
+            tr.TTL = ttl
+            if cacheOK && ttl > 0 && !in.Truncated {
+                s.cache.Set(key, in.Copy(), time.Duration(ttl)*time.Second)
             }
-            return
+            return in, tr
         }
     }
 
-    log.Printf("DNS QUERY nxdomain q=%s type=%s from=%s%s id=%d", q.Name, dns.TypeToString[q.Qtype], w.RemoteAddr(), geoStr, r.Id)
+    // Resolve iteratively from the root servers instead of forwarding
+    if s.recursor != nil {
+        m.Authoritative = false
+        m.RecursionAvailable = true
+        if !recurse {
+            tr.Source = "refused"
+            tr.Drop = deny(m, s.cfg.Deny.Recursion)
+            return m, tr
+        }
+        tr.Source = "recurse"
+        upStart := time.Now()
+        in, rerr := s.recursor.Resolve(q.Name, q.Qtype)
+        tr.Timing.Upstream += time.Since(upStart)
+        if rerr != nil {
+            log.Printf("DNS recursion %s %s: %v", q.Name, dns.TypeToString[q.Qtype], rerr)
+            m.Rcode = dns.RcodeServerFailure
+            return m, tr
+        }
+        m.Rcode = in.Rcode
+        m.Answer, m.Ns = in.Answer, in.Ns
+        m.AuthenticatedData = in.AuthenticatedData
+        ttl := s.forwardedTTL(m)
+        tr.TTL = ttl
+        if cacheOK && ttl > 0 {
+            s.cache.Set(key, m.Copy(), time.Duration(ttl)*time.Second)
+        }
+        return m, tr
+    }
+
+    tr.Source = "nxdomain"
     m.Rcode = dns.RcodeNameError
-    _ = w.WriteMsg(m)
     // Cache local negative responses (no zone found) with short TTL to prevent repeated lookups
-    s.cache.Set(key, m.Copy(), 5*time.Minute)
+    if ttl := s.cfg.NegativeCacheTTL(); cacheOK && ttl > 0 {
+        s.cache.Set(key, m.Copy(), time.Duration(ttl)*time.Second)
+    }
+    return m, tr
 }
 
 // lookup resolves a question from DB applying Geo selection.
 func (s *Server) lookup(r *dns.Msg, q dns.Question, clientIP netip.Addr) (answers []dns.RR, ttl uint32, err error) {
+    answers, ttl, _, _, err = s.lookupTrace(q, clientIP)
+    return answers, ttl, err
+}
+
+// lookupTrace is lookup that also reports the matched zone and geo rule.
+func (s *Server) lookupTrace(q dns.Question, clientIP netip.Addr) (answers []dns.RR, ttl uint32, zoneName, rule string, err error) {
     qname := strings.ToLower(dns.Fqdn(q.Name))
     qtype := dns.TypeToString[q.Qtype]
 
-    // Find the best matching zone suffix (using cache)
-    zones := s.zoneCache.Get()
-    if zones == nil {
-        // Cache miss or expired, fetch from database
-        // Important: filter deleted_at IS NULL to exclude soft-deleted zones from cache
-        if err := s.db.Where("deleted_at IS NULL").Order("length(name) desc").Find(&zones).Error; err != nil {
-            return nil, 0, err
-        }
-        // Store in cache for future use
-        s.zoneCache.Set(zones)
-    }
-    var zone *dbm.Zone
-    for i := range zones {
-        name := dns.Fqdn(strings.ToLower(zones[i].Name))
-        if strings.HasSuffix(qname, name) {
-            zone = &zones[i]
-            break
-        }
+    zone, err := s.findZone(qname)
+    if err != nil {
+        return nil, 0, "", "", err
     }
     if zone == nil {
-        return nil, 0, fmt.Errorf("no zone")
+        return nil, 0, "", "", fmt.Errorf("no zone")
     }
+    zoneName = zone.Name
 
-    // Find RRSet by FQDN name and type
-    var set dbm.RRSet
-    err = s.db.Preload("Records").
-        Where("zone_id = ? AND name = ? AND type = ?", zone.ID, strings.ToLower(qname), strings.ToUpper(qtype)).
-        First(&set).Error
+    // Find RRSet by FQDN name and type; clients of a staged canary get its
+    // version of the zone
+    canary := s.canaryFor(zone.ID, clientIP)
+    set, err := s.zoneRRSet(zone.ID, canary, qname, strings.ToUpper(qtype))
     if err != nil {
         // If exact type not found, try CNAME fallback for this name
-        var cnameSet dbm.RRSet
-        if e2 := s.db.Preload("Records").
-            Where("zone_id = ? AND name = ? AND type = ?", zone.ID, strings.ToLower(qname), "CNAME").
-            First(&cnameSet).Error; e2 == nil {
+        if cnameSet, e2 := s.zoneRRSet(zone.ID, canary, qname, "CNAME"); e2 == nil {
             // Return CNAME rrset as the answer; resolvers will chase it
-            for _, rec := range cnameSet.Records {
+            for _, rec := range s.primaryOrBackup(cnameSet.Records) {
                 // Support "@" shorthand in CNAME target to mean zone apex
                 target := rec.Data
                 if strings.TrimSpace(target) == "@" {
                     target = dns.Fqdn(strings.ToLower(zone.Name))
                 }
-                rr, perr := dns.NewRR(fmt.Sprintf("%s %d CNAME %s", qname, cnameSet.TTL, target))
-                if perr == nil { answers = append(answers, rr) }
+                rttl := rec.AnswerTTL(cnameSet.TTL)
+                rr, perr := dns.NewRR(fmt.Sprintf("%s %d CNAME %s", qname, rttl, target))
+                if perr == nil {
+                    if len(answers) == 0 || rttl < ttl {
+                        ttl = rttl
+                    }
+                    answers = append(answers, rr)
+                }
             }
-            return answers, cnameSet.TTL, nil
+            return answers, ttl, zoneName, canaryRule(canary, "cname"), nil
         }
-        return nil, 0, err
+        return nil, 0, zoneName, "", err
     }
 
     // Geo selection
     g := s.geo.Lookup(clientIP)
-    recs, rule := selectGeoRecords(set.Records, clientIP, g)
-    s.lastRule = rule
+    recs, rule := s.selectRecords(set.Records, clientIP, g)
 
+    // Records may override the RRSet TTL (e.g. a short TTL for one region);
+    // the answer is cached for the lowest TTL in it
     for _, rec := range recs {
         // If answering CNAME directly, support "@" shorthand for apex in target
         data := rec.Data
         if strings.EqualFold(qtype, "CNAME") && strings.TrimSpace(data) == "@" {
             data = dns.Fqdn(strings.ToLower(zone.Name))
         }
-        rr, perr := dns.NewRR(fmt.Sprintf("%s %d %s %s", qname, set.TTL, strings.ToUpper(qtype), data))
+        rttl := rec.AnswerTTL(set.TTL)
+        rr, perr := dns.NewRR(fmt.Sprintf("%s %d %s %s", qname, rttl, strings.ToUpper(qtype), data))
         if perr == nil {
+            if len(answers) == 0 || rttl < ttl {
+                ttl = rttl
+            }
             answers = append(answers, rr)
         }
     }
-    return answers, set.TTL, nil
+    if len(answers) == 0 {
+        ttl = set.TTL
+    }
+    return answers, ttl, zoneName, canaryRule(canary, rule), nil
+}
+
+// nodata reports whether qname exists in its local zone, by owning records
+// or as an empty non-terminal (RFC 4592), and returns the zone SOA for the
+// authority section of the NODATA answer. Clients of a staged canary see
+// the names of the canary; the SOA is always the zone's.
+func (s *Server) nodata(qname string, cip netip.Addr) (*dns.SOA, bool) {
+    qname = strings.ToLower(dns.Fqdn(qname))
+    zone, err := s.findZone(qname)
+    if err != nil || zone == nil {
+        return nil, false
+    }
+    if canary := s.canaryFor(zone.ID, cip); canary != nil {
+        if !canaryHasName(canary, qname) {
+            return nil, false
+        }
+    } else {
+        var n int64
+        below := "%." + likeEscaper.Replace(qname)
+        if err := s.db.Model(&dbm.RRSet{}).
+            Where("zone_id = ? AND (name = ? OR name LIKE ? ESCAPE '!')", zone.ID, qname, below).
+            Count(&n).Error; err != nil || n == 0 {
+            return nil, false
+        }
+    }
+    apex := dns.Fqdn(strings.ToLower(zone.Name))
+    var set dbm.RRSet
+    if err := s.db.Preload("Records").Where("zone_id = ? AND type = ?", zone.ID, "SOA").Limit(1).Find(&set).Error; err != nil || len(set.Records) == 0 {
+        return nil, true
+    }
+    rr, err := dns.NewRR(fmt.Sprintf("%s %d SOA %s", apex, set.TTL, set.Records[0].Data))
+    if err != nil {
+        return nil, true
+    }
+    return rr.(*dns.SOA), true
+}
+
+// likeEscaper escapes LIKE wildcards with '!', which works the same on
+// SQLite, Postgres and MySQL.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// findZone returns the best matching zone for qname (using cache), or nil.
+func (s *Server) findZone(qname string) (*dbm.Zone, error) {
+    zones := s.zoneCache.Get()
+    if zones == nil {
+        // Cache miss or expired, fetch from database
+        // Important: filter deleted_at IS NULL to exclude soft-deleted zones from cache
+        // Disabled zones are not served either
+        if err := s.db.Where("deleted_at IS NULL AND disabled = ?", false).Order("length(name) desc").Find(&zones).Error; err != nil {
+            return nil, err
+        }
+        // Store in cache for future use
+        s.zoneCache.Set(zones)
+    }
+    for i := range zones {
+        name := dns.Fqdn(strings.ToLower(zones[i].Name))
+        if strings.HasSuffix(qname, name) {
+            return &zones[i], nil
+        }
+    }
+    return nil, nil
+}
+
+// mayRecurse reports whether the client at addr is in recursion.allowed_cidrs.
+// The transport address is used, never ECS, so the option cannot be spoofed
+// to get recursion.
+func (s *Server) mayRecurse(addr net.Addr) bool {
+    if s.recursor == nil {
+        return false
+    }
+    a, ok := remoteIP(addr)
+    if !ok {
+        return false
+    }
+    for _, p := range s.recurseACL {
+        if p.Contains(a) {
+            return true
+        }
+    }
+    return false
 }
 
 func clientIPFrom(r *dns.Msg, w dns.ResponseWriter, useECS bool) netip.Addr {
@@ -295,6 +888,9 @@ func clientIPFrom(r *dns.Msg, w dns.ResponseWriter, useECS bool) netip.Addr {
 // remapIP maps an IP from one CIDR into another CIDR with the same prefix length.
 // Useful to translate reserved ranges (e.g., 127.0.1.0/24) into TEST-NET for GeoIP lookup.
 
+// selectGeoRecords returns the records of the best geo match for ip and the
+// rule that matched. When records of the match have weights, one of them is
+// picked at random in proportion to its weight, see pickWeighted.
 func selectGeoRecords(recs []dbm.RData, ip netip.Addr, g geoip.Info) ([]dbm.RData, string) {
     if len(recs) == 0 {
         return recs, "none"
@@ -303,14 +899,14 @@ func selectGeoRecords(recs []dbm.RData, ip netip.Addr, g geoip.Info) ([]dbm.RDat
     if !ip.IsValid() {
         out := make([]dbm.RData, 0, len(recs))
         for _, r := range recs {
-            if r.Country == nil && r.Continent == nil && r.ASN == nil && r.Subnet == nil {
+            if r.Country == nil && r.Continent == nil && r.ASN == nil && r.ASNs == nil && r.Subnet == nil {
                 out = append(out, r)
             }
         }
         if len(out) > 0 {
-            return out, "generic"
+            return pickWeighted(out), "generic"
         }
-        return recs, "all"
+        return pickWeighted(recs), "all"
     }
     // Priority: subnet > asn > country > continent > default
     var subnetMatch, asnMatch, countryMatch, continentMatch, generic []dbm.RData
@@ -321,8 +917,8 @@ func selectGeoRecords(recs []dbm.RData, ip netip.Addr, g geoip.Info) ([]dbm.RDat
                 continue
             }
         }
-        if r.ASN != nil {
-            if g.ASN != 0 && *r.ASN == g.ASN {
+        if r.ASN != nil || r.ASNs != nil {
+            if r.MatchesASN(g.ASN) {
                 asnMatch = append(asnMatch, r)
                 continue
             }
@@ -335,24 +931,24 @@ func selectGeoRecords(recs []dbm.RData, ip netip.Addr, g geoip.Info) ([]dbm.RDat
             continentMatch = append(continentMatch, r)
             continue
         }
-        if r.Country == nil && r.Continent == nil && r.ASN == nil && r.Subnet == nil {
+        if r.Country == nil && r.Continent == nil && r.ASN == nil && r.ASNs == nil && r.Subnet == nil {
             generic = append(generic, r)
         }
     }
     if len(subnetMatch) > 0 {
-        return subnetMatch, "subnet"
+        return pickWeighted(subnetMatch), "subnet"
     }
     if len(asnMatch) > 0 {
-        return asnMatch, "asn"
+        return pickWeighted(asnMatch), "asn"
     }
     if len(countryMatch) > 0 {
-        return countryMatch, "country"
+        return pickWeighted(countryMatch), "country"
     }
     if len(continentMatch) > 0 {
-        return continentMatch, "continent"
+        return pickWeighted(continentMatch), "continent"
     }
     if len(generic) > 0 {
-        return generic, "generic"
+        return pickWeighted(generic), "generic"
     }
-    return recs, "all"
+    return pickWeighted(recs), "all"
 }
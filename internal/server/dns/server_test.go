@@ -1,8 +1,18 @@
 package dns
 
 import (
+    "context"
+    "encoding/hex"
+    "errors"
+    "fmt"
     "net"
+    "net/http"
+    "net/http/httptest"
     "net/netip"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync/atomic"
     "testing"
     "time"
 
@@ -10,10 +20,14 @@ import (
     "gorm.io/driver/sqlite"
     "gorm.io/gorm"
 
+    "namedot/internal/blocklist"
     "namedot/internal/cache"
     "namedot/internal/config"
     dbm "namedot/internal/db"
     "namedot/internal/geoip"
+    "namedot/internal/health"
+    "namedot/internal/querylog"
+    "namedot/internal/stats"
 )
 
 func TestSelectGeoRecords(t *testing.T) {
@@ -32,6 +46,87 @@ func TestSelectGeoRecords(t *testing.T) {
     }
 }
 
+func TestSelectGeoRecords_ASNList(t *testing.T) {
+    ip := netip.MustParseAddr("203.0.113.5")
+    recs := []dbm.RData{
+        {Data: "192.0.2.1"},
+        {Data: "192.0.2.2", ASNs: strPtr("3320,64512-65534")},
+        {Data: "192.0.2.3", Country: strPtr("DE")},
+    }
+    for asn, want := range map[int]string{3320: "192.0.2.2", 65000: "192.0.2.2", 65535: "192.0.2.3"} {
+        out, rule := selectGeoRecords(recs, ip, geoip.Info{ASN: asn, Country: "DE"})
+        if len(out) != 1 || out[0].Data != want {
+            t.Fatalf("ASN %d: got %#v (rule %s), want %s", asn, out, rule, want)
+        }
+    }
+}
+
+func TestSelectGeoRecords_Weighted(t *testing.T) {
+    ip := netip.MustParseAddr("203.0.113.5")
+    w := func(n uint32) *uint32 { return &n }
+    recs := []dbm.RData{
+        {Data: "192.0.2.1", Country: strPtr("DE"), Weight: w(80)},
+        {Data: "192.0.2.2", Country: strPtr("DE"), Weight: w(20)},
+        {Data: "192.0.2.3", Country: strPtr("DE"), Weight: w(0)},
+        {Data: "192.0.2.9"},
+    }
+    old := weightRand
+    t.Cleanup(func() { weightRand = old })
+    for n, want := range map[uint64]string{0: "192.0.2.1", 79: "192.0.2.1", 80: "192.0.2.2", 99: "192.0.2.2"} {
+        weightRand = func(total uint64) uint64 {
+            if total != 100 {
+                t.Fatalf("total weight %d, want 100", total)
+            }
+            return n
+        }
+        out, rule := selectGeoRecords(recs, ip, geoip.Info{Country: "DE"})
+        if rule != "country" || len(out) != 1 || out[0].Data != want {
+            t.Fatalf("draw %d: got %#v (rule %s), want %s", n, out, rule, want)
+        }
+    }
+
+    // Other tiers without weights keep all their records
+    out, _ := selectGeoRecords(append(recs, dbm.RData{Data: "192.0.2.10"}), ip, geoip.Info{Country: "FR"})
+    if len(out) != 2 {
+        t.Fatalf("unweighted tier: got %#v", out)
+    }
+    // All weights 0: no record is preferred
+    zero := []dbm.RData{{Data: "192.0.2.1", Weight: w(0)}, {Data: "192.0.2.2", Weight: w(0)}}
+    if out, _ := selectGeoRecords(zero, ip, geoip.Info{}); len(out) != 2 {
+        t.Fatalf("zero weights: got %#v", out)
+    }
+}
+
+func TestSelectRecords_Backup(t *testing.T) {
+    s := &Server{}
+    recs := []dbm.RData{
+        {Data: "192.0.2.1", Country: strPtr("DE")},
+        {Data: "192.0.2.8", Continent: strPtr("NA"), Backup: true},
+        {Data: "192.0.2.9", Backup: true},
+    }
+    ip := netip.MustParseAddr("203.0.113.5")
+    for _, tc := range []struct {
+        geo        geoip.Info
+        want, rule string
+    }{
+        {geoip.Info{Country: "DE", Continent: "EU"}, "192.0.2.1", "country"},
+        {geoip.Info{Country: "FR", Continent: "EU"}, "192.0.2.9", "backup:generic"},
+        {geoip.Info{Country: "US", Continent: "NA"}, "192.0.2.8", "backup:continent"},
+    } {
+        out, rule := s.selectRecords(recs, ip, tc.geo)
+        if len(out) != 1 || out[0].Data != tc.want || rule != tc.rule {
+            t.Errorf("%s: got %#v (rule %s), want %s (%s)", tc.geo.Country, out, rule, tc.want, tc.rule)
+        }
+    }
+    // Only backups: they are served like primaries would be
+    if out, rule := s.selectRecords(recs[1:], ip, geoip.Info{Country: "DE"}); len(out) != 1 || rule != "backup:generic" {
+        t.Errorf("backups only: got %#v (rule %s)", out, rule)
+    }
+    if out := s.primaryOrBackup(recs); len(out) != 1 || out[0].Data != "192.0.2.1" {
+        t.Errorf("primaryOrBackup: got %#v", out)
+    }
+}
+
 func strPtr(s string) *string { return &s }
 
 // cacheWriter verifies that cached response gets current query ID
@@ -67,6 +162,146 @@ func TestCacheResponse_UsesCurrentID(t *testing.T) {
     }
 }
 
+func TestCacheResponse_TTLDecay(t *testing.T) {
+    s := &Server{cache: cache.New(10)}
+    m := new(dns.Msg)
+    m.SetQuestion("www.example.com.", dns.TypeA)
+    for _, r := range []string{"www.example.com. 300 IN A 192.0.2.1", "www.example.com. 300 IN A 192.0.2.2", "example.com. 50 IN NS ns1.example.com."} {
+        rr, _ := dns.NewRR(r)
+        m.Answer = append(m.Answer, rr)
+    }
+    stored := time.Now().Add(-100 * time.Second)
+    s.cache.SetAt("www.example.com.|1|", m, stored, stored.Add(300*time.Second))
+
+    req := new(dns.Msg)
+    req.SetQuestion("www.example.com.", dns.TypeA)
+    w := &replyWriter{}
+    s.serveDNS(w, req)
+    if got := w.reply.Answer; got[0].Header().Ttl != 200 || got[1].Header().Ttl != 200 || got[2].Header().Ttl != 0 {
+        t.Fatalf("decayed TTLs: %v", got)
+    }
+    if m.Answer[0].Header().Ttl != 300 {
+        t.Fatalf("cached message changed: %v", m.Answer[0])
+    }
+
+    // Jitter lowers the TTLs of one answer alike
+    s.cfg = &config.Config{Performance: config.PerformanceConfig{CacheTTLJitter: 50}}
+    for i := 0; i < 20; i++ {
+        w := &replyWriter{}
+        s.serveDNS(w, req)
+        a, b := w.reply.Answer[0].Header().Ttl, w.reply.Answer[1].Header().Ttl
+        if a != b || a < 100 || a > 200 {
+            t.Fatalf("jittered TTLs %d and %d, want one value in 100-200", a, b)
+        }
+    }
+
+    // A restored cache keeps counting down
+    path := filepath.Join(t.TempDir(), "cache.snap")
+    if _, err := s.SaveCache(path); err != nil {
+        t.Fatalf("save: %v", err)
+    }
+    r := &Server{cache: cache.New(10)}
+    if _, err := r.LoadCache(path); err != nil {
+        t.Fatalf("load: %v", err)
+    }
+    if _, age, ok := r.cache.GetWithAge("www.example.com.|1|"); !ok || age < 100*time.Second {
+        t.Fatalf("restored age %v", age)
+    }
+}
+
+func TestNoCache(t *testing.T) {
+    db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+    if err != nil { t.Fatalf("open db: %v", err) }
+    sqlDB, _ := db.DB()
+    sqlDB.SetMaxOpenConns(1)
+    if err := dbm.AutoMigrate(db); err != nil { t.Fatalf("migrate: %v", err) }
+    for _, z := range []dbm.Zone{
+        {Name: "example.com.", RRSets: []dbm.RRSet{
+            {Name: "www.example.com.", Type: "A", TTL: 60, Records: []dbm.RData{{Data: "192.0.2.1"}}},
+            {Name: "a.hc.example.com.", Type: "A", TTL: 60, Records: []dbm.RData{{Data: "192.0.2.2"}}},
+        }},
+        {Name: "dyn.test.", NoCache: true, RRSets: []dbm.RRSet{
+            {Name: "www.dyn.test.", Type: "A", TTL: 60, Records: []dbm.RData{{Data: "192.0.2.3"}}},
+        }},
+    } {
+        if err := db.Create(&z).Error; err != nil { t.Fatalf("create zone: %v", err) }
+    }
+
+    cfg := &config.Config{Performance: config.PerformanceConfig{CacheSize: 10, ForwarderTimeoutSec: 1, NoCache: []string{"HC.example.com"}}}
+    s, err := NewServer(cfg, db)
+    if err != nil { t.Fatalf("new server: %v", err) }
+    for _, tc := range []struct {
+        name   string
+        cached bool
+    }{
+        {"www.example.com.", true},
+        {"a.hc.example.com.", false},
+        {"www.dyn.test.", false},
+    } {
+        req := new(dns.Msg)
+        req.SetQuestion(tc.name, dns.TypeA)
+        s.serveDNS(&cacheWriter{}, req)
+        if _, ok := s.cache.Get(tc.name + "|1|"); ok != tc.cached {
+            t.Errorf("%s: cached %v, want %v", tc.name, ok, tc.cached)
+        }
+    }
+
+    // An answer restored from before the name was listed is not served
+    stale := new(dns.Msg)
+    stale.SetQuestion("a.hc.example.com.", dns.TypeA)
+    rr, _ := dns.NewRR("a.hc.example.com. 60 IN A 198.51.100.1")
+    stale.Answer = []dns.RR{rr}
+    s.cache.Set("a.hc.example.com.|1|", stale, time.Minute)
+    req := new(dns.Msg)
+    req.SetQuestion("a.hc.example.com.", dns.TypeA)
+    w := &replyWriter{}
+    s.serveDNS(w, req)
+    if len(w.reply.Answer) != 1 || w.reply.Answer[0].(*dns.A).A.String() != "192.0.2.2" {
+        t.Fatalf("answer %v, want 192.0.2.2 from the zone", w.reply.Answer)
+    }
+}
+
+func TestQueryLog(t *testing.T) {
+    db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+    if err != nil { t.Fatalf("open db: %v", err) }
+    sqlDB, _ := db.DB()
+    sqlDB.SetMaxOpenConns(1)
+    if err := dbm.AutoMigrate(db); err != nil { t.Fatalf("migrate: %v", err) }
+    z := dbm.Zone{Name: "example.com.", RRSets: []dbm.RRSet{{Name: "www.example.com.", Type: "A", TTL: 60, Records: []dbm.RData{
+        {Data: "192.0.2.1"},
+        {Data: "192.0.2.2", Subnet: strPtr("203.0.113.0/24")},
+    }}}}
+    if err := db.Create(&z).Error; err != nil { t.Fatalf("create zone: %v", err) }
+
+    cfg := &config.Config{Performance: config.PerformanceConfig{ForwarderTimeoutSec: 1}}
+    s, err := NewServer(cfg, db)
+    if err != nil { t.Fatalf("new server: %v", err) }
+    if _, err := s.SearchQueryLog(querylog.Filter{}); err != ErrQueryLogDisabled {
+        t.Fatalf("search without a log: %v", err)
+    }
+    ql, err := querylog.Open(config.QueryLogConfig{Path: filepath.Join(t.TempDir(), "queries.log"), MaxSizeMB: 1, MaxAgeHours: 1, MaxFiles: 1})
+    if err != nil { t.Fatalf("open log: %v", err) }
+    s.SetQueryLog(ql)
+
+    req := new(dns.Msg)
+    req.SetQuestion("www.example.com.", dns.TypeA)
+    req.SetEdns0(1232, false)
+    req.Extra[0].(*dns.OPT).Option = []dns.EDNS0{&dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: 24, Address: net.ParseIP("203.0.113.9").To4()}}
+    s.cfg.GeoIP.UseECS = true
+    s.serveDNS(&cacheWriter{}, req)
+    if err := ql.Close(); err != nil { t.Fatalf("close log: %v", err) }
+
+    got, err := s.SearchQueryLog(querylog.Filter{Name: "example.com"})
+    if err != nil || len(got) != 1 {
+        t.Fatalf("search: %v %+v", err, got)
+    }
+    e := got[0]
+    if e.Name != "www.example.com." || e.Type != "A" || e.Source != "local" || e.Rule != "subnet" || e.Client != "203.0.113.9" ||
+        e.Rcode != "NOERROR" || len(e.Answers) != 1 || !strings.HasSuffix(e.Answers[0], "A 192.0.2.2") {
+        t.Fatalf("entry: %+v", e)
+    }
+}
+
 func TestLookup_CNAME_Fallback(t *testing.T) {
     // Setup in-memory DB and server
     db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
@@ -92,3 +327,1563 @@ func TestLookup_CNAME_Fallback(t *testing.T) {
     if len(ans) == 0 { t.Fatalf("no answers") }
     if ans[0].Header().Rrtype != dns.TypeCNAME { t.Fatalf("want CNAME got %s", dns.TypeToString[ans[0].Header().Rrtype]) }
 }
+
+func TestLookup_RecordTTLOverride(t *testing.T) {
+    db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+    if err != nil { t.Fatalf("open db: %v", err) }
+    if err := db.AutoMigrate(&dbm.Zone{}, &dbm.RRSet{}, &dbm.RData{}); err != nil { t.Fatalf("migrate: %v", err) }
+
+    cfg := &config.Config{Performance: config.PerformanceConfig{CacheSize: 0, ForwarderTimeoutSec: 1}}
+    s, err := NewServer(cfg, db)
+    if err != nil { t.Fatalf("new server: %v", err) }
+
+    short := uint32(30)
+    z := dbm.Zone{Name: "example.com.", RRSets: []dbm.RRSet{
+        {Name: "www.example.com.", Type: "A", TTL: 300, Records: []dbm.RData{
+            {Data: "192.0.2.1"},
+            {Data: "192.0.2.2", Subnet: strPtr("198.51.100.0/24"), TTL: &short},
+        }},
+    }}
+    if err := db.Create(&z).Error; err != nil { t.Fatalf("create zone: %v", err) }
+
+    q := dns.Question{Name: "www.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+    ans, ttl, err := s.lookup(new(dns.Msg), q, netip.MustParseAddr("198.51.100.7"))
+    if err != nil || len(ans) != 1 || ans[0].Header().Ttl != 30 || ttl != 30 {
+        t.Fatalf("override: ttl=%d %v %v", ttl, ans, err)
+    }
+    ans, ttl, err = s.lookup(new(dns.Msg), q, netip.MustParseAddr("203.0.113.7"))
+    if err != nil || len(ans) != 1 || ans[0].Header().Ttl != 300 || ttl != 300 {
+        t.Fatalf("rrset TTL: ttl=%d %v %v", ttl, ans, err)
+    }
+    // Without a client address only the generic record is served
+    if _, ttl, _ = s.lookup(new(dns.Msg), q, netip.Addr{}); ttl != 300 {
+        t.Fatalf("generic ttl=%d", ttl)
+    }
+}
+
+func TestLookup_HealthFailover(t *testing.T) {
+    db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+    if err != nil { t.Fatalf("open db: %v", err) }
+    if err := db.AutoMigrate(&dbm.Zone{}, &dbm.RRSet{}, &dbm.RData{}); err != nil { t.Fatalf("migrate: %v", err) }
+
+    cfg := &config.Config{Performance: config.PerformanceConfig{CacheSize: 0, ForwarderTimeoutSec: 1}}
+    s, err := NewServer(cfg, db)
+    if err != nil { t.Fatalf("new server: %v", err) }
+
+    // A port nothing listens on
+    ln, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil { t.Fatalf("listen: %v", err) }
+    closed := "tcp://" + ln.Addr().String()
+    ln.Close()
+
+    z := dbm.Zone{Name: "example.com.", RRSets: []dbm.RRSet{
+        {Name: "www.example.com.", Type: "A", TTL: 300, Records: []dbm.RData{
+            {Data: "192.0.2.1"},
+            {Data: "192.0.2.2", Subnet: strPtr("198.51.100.0/24"), HealthCheck: &closed},
+        }},
+        {Name: "api.example.com.", Type: "A", TTL: 300, Records: []dbm.RData{
+            {Data: "192.0.2.3", HealthCheck: &closed},
+        }},
+    }}
+    if err := db.Create(&z).Error; err != nil { t.Fatalf("create zone: %v", err) }
+
+    q := dns.Question{Name: "www.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+    client := netip.MustParseAddr("198.51.100.7")
+    answer := func(q dns.Question) string {
+        ans, _, err := s.lookup(new(dns.Msg), q, client)
+        if err != nil || len(ans) != 1 { t.Fatalf("lookup %s: %v %v", q.Name, ans, err) }
+        return ans[0].(*dns.A).A.String()
+    }
+    if got := answer(q); got != "192.0.2.2" { t.Fatalf("before checks: %s", got) }
+
+    h := health.New(config.HealthChecksConfig{Enabled: true, TimeoutMs: 1000, Fall: 1, Rise: 1}, db)
+    s.SetHealth(h)
+    if err := h.CheckAll(context.Background()); err != nil { t.Fatalf("check: %v", err) }
+    // The subnet record is down, so the generic one answers
+    if got := answer(q); got != "192.0.2.1" { t.Fatalf("after failed check: %s", got) }
+    // With no healthy record left, the unhealthy one is still served
+    if got := answer(dns.Question{Name: "api.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}); got != "192.0.2.3" {
+        t.Fatalf("all unhealthy: %s", got)
+    }
+    if st := s.HealthStatuses(); len(st) != 2 || st[0].Healthy {
+        t.Fatalf("statuses: %+v", st)
+    }
+}
+
+func TestLookup_BackupWhenPrimaryDown(t *testing.T) {
+    db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+    if err != nil { t.Fatalf("open db: %v", err) }
+    if err := db.AutoMigrate(&dbm.Zone{}, &dbm.RRSet{}, &dbm.RData{}); err != nil { t.Fatalf("migrate: %v", err) }
+
+    cfg := &config.Config{Performance: config.PerformanceConfig{CacheSize: 0, ForwarderTimeoutSec: 1}}
+    s, err := NewServer(cfg, db)
+    if err != nil { t.Fatalf("new server: %v", err) }
+
+    ln, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil { t.Fatalf("listen: %v", err) }
+    closed := "tcp://" + ln.Addr().String()
+    ln.Close()
+
+    z := dbm.Zone{Name: "example.com.", RRSets: []dbm.RRSet{
+        {Name: "www.example.com.", Type: "A", TTL: 60, Records: []dbm.RData{
+            {Data: "192.0.2.1", HealthCheck: &closed},
+            {Data: "192.0.2.2", HealthCheck: &closed},
+            {Data: "198.51.100.1", Backup: true},
+        }},
+    }}
+    if err := db.Create(&z).Error; err != nil { t.Fatalf("create zone: %v", err) }
+
+    q := dns.Question{Name: "www.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+    ans, _, _, rule, err := s.lookupTrace(q, netip.Addr{})
+    if err != nil || len(ans) != 2 || rule != "generic" {
+        t.Fatalf("primaries up: %v (rule %s) %v", ans, rule, err)
+    }
+
+    h := health.New(config.HealthChecksConfig{Enabled: true, TimeoutMs: 1000, Fall: 1, Rise: 1}, db)
+    s.SetHealth(h)
+    if err := h.CheckAll(context.Background()); err != nil { t.Fatalf("check: %v", err) }
+    ans, _, _, rule, err = s.lookupTrace(q, netip.Addr{})
+    if err != nil || len(ans) != 1 || ans[0].(*dns.A).A.String() != "198.51.100.1" || rule != "backup:generic" {
+        t.Fatalf("primaries down: %v (rule %s) %v", ans, rule, err)
+    }
+}
+
+func TestLookup_DisabledRecords(t *testing.T) {
+    db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+    if err != nil { t.Fatalf("open db: %v", err) }
+    if err := db.AutoMigrate(&dbm.Zone{}, &dbm.RRSet{}, &dbm.RData{}); err != nil { t.Fatalf("migrate: %v", err) }
+
+    cfg := &config.Config{Performance: config.PerformanceConfig{CacheSize: 0, ForwarderTimeoutSec: 1}}
+    s, err := NewServer(cfg, db)
+    if err != nil { t.Fatalf("new server: %v", err) }
+
+    z := dbm.Zone{Name: "example.com.", RRSets: []dbm.RRSet{
+        {Name: "example.com.", Type: "SOA", TTL: 3600, Records: []dbm.RData{{Data: "ns1.example.com. hostmaster.example.com. 1 7200 3600 1209600 300"}}},
+        {Name: "www.example.com.", Type: "A", TTL: 60, Records: []dbm.RData{
+            {Data: "192.0.2.1"},
+            {Data: "192.0.2.2", Disabled: true},
+        }},
+        {Name: "old.example.com.", Type: "A", TTL: 60, Records: []dbm.RData{{Data: "192.0.2.9", Disabled: true}}},
+        {Name: "old.example.com.", Type: "CNAME", TTL: 60, Records: []dbm.RData{{Data: "www.example.com."}}},
+    }}
+    if err := db.Create(&z).Error; err != nil { t.Fatalf("create zone: %v", err) }
+
+    q := dns.Question{Name: "www.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+    ans, _, _, _, err := s.lookupTrace(q, netip.Addr{})
+    if err != nil || len(ans) != 1 || ans[0].(*dns.A).A.String() != "192.0.2.1" {
+        t.Fatalf("www: %v %v", ans, err)
+    }
+    // A set with only disabled records is not there, so the CNAME answers
+    q.Name = "old.example.com."
+    ans, _, _, rule, err := s.lookupTrace(q, netip.Addr{})
+    if err != nil || len(ans) != 1 || rule != "cname" {
+        t.Fatalf("old: %v (rule %s) %v", ans, rule, err)
+    }
+
+    rrs, err := s.zoneRecords(&z)
+    if err != nil { t.Fatalf("zone records: %v", err) }
+    for _, rr := range rrs {
+        if a, ok := rr.(*dns.A); ok && a.A.String() != "192.0.2.1" {
+            t.Fatalf("transfer includes a disabled record: %v", rr)
+        }
+    }
+}
+
+func TestLookup_DynamicRecords(t *testing.T) {
+    var fetches, failing atomic.Int32
+    failing.Store(1)
+    ep := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        fetches.Add(1)
+        if failing.Load() == 1 {
+            http.Error(w, "down", http.StatusBadGateway)
+            return
+        }
+        fmt.Fprint(w, `{"records": [{"data": "192.0.2.50"}, {"data": "192.0.2.51", "disabled": true}]}`)
+    }))
+    defer ep.Close()
+
+    db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+    if err != nil { t.Fatalf("open db: %v", err) }
+    if err := db.AutoMigrate(&dbm.Zone{}, &dbm.RRSet{}, &dbm.RData{}); err != nil { t.Fatalf("migrate: %v", err) }
+    cfg := &config.Config{
+        Performance:    config.PerformanceConfig{CacheSize: 0, ForwarderTimeoutSec: 1},
+        DynamicRecords: config.DynamicRecordsConfig{TimeoutMs: 1000, MaxStaleSec: 300},
+    }
+    s, err := NewServer(cfg, db)
+    if err != nil { t.Fatalf("new server: %v", err) }
+    url := ep.URL + "/pool/web"
+    none := ep.URL + "/pool/none"
+    z := dbm.Zone{Name: "example.com.", RRSets: []dbm.RRSet{
+        {Name: "www.example.com.", Type: "A", TTL: 60, DynamicURL: &url, Records: []dbm.RData{{Data: "192.0.2.1"}}},
+        {Name: "api.example.com.", Type: "A", TTL: 60, DynamicURL: &none},
+    }}
+    if err := db.Create(&z).Error; err != nil { t.Fatalf("create zone: %v", err) }
+
+    lookup := func(name string) string {
+        t.Helper()
+        ans, _, _, _, err := s.lookupTrace(dns.Question{Name: name, Qtype: dns.TypeA, Qclass: dns.ClassINET}, netip.Addr{})
+        if err != nil {
+            return "none"
+        }
+        if len(ans) != 1 {
+            t.Fatalf("%s: %v", name, ans)
+        }
+        return ans[0].(*dns.A).A.String()
+    }
+    // settle waits for the background fetch of url, started by a lookup
+    settle := func(url string) {
+        s.dynamic.mu.Lock()
+        wait := s.dynamic.entry(url).fetching
+        s.dynamic.mu.Unlock()
+        if wait != nil {
+            <-wait
+        }
+    }
+    expire := func(url string) {
+        s.dynamic.mu.Lock()
+        s.dynamic.entry(url).expires = time.Time{}
+        s.dynamic.mu.Unlock()
+    }
+
+    // The endpoint never answered: the stored records serve, or nothing
+    if got := lookup("www.example.com."); got != "192.0.2.1" {
+        t.Fatalf("before the first fetch: %s", got)
+    }
+    settle(url)
+    if got := lookup("api.example.com."); got != "none" {
+        t.Fatalf("api: %s, want no records", got)
+    }
+
+    // Lookups do not wait: the fetched records show once the fetch is done
+    failing.Store(0)
+    expire(url)
+    if got := lookup("www.example.com."); got != "192.0.2.1" {
+        t.Fatalf("while fetching: %s", got)
+    }
+    settle(url)
+    if got := lookup("www.example.com."); got != "192.0.2.50" {
+        t.Fatalf("fetched: %s", got)
+    }
+    n := fetches.Load()
+    if got := lookup("www.example.com."); got != "192.0.2.50" || fetches.Load() != n {
+        t.Fatalf("cached: %s after %d fetches, want %d", got, fetches.Load(), n)
+    }
+    // Without stored records the first lookup waits for the fetch
+    expire(none)
+    if got := lookup("api.example.com."); got != "192.0.2.50" {
+        t.Fatalf("api: %s", got)
+    }
+
+    // A failing endpoint keeps its last records until they are stale
+    failing.Store(1)
+    expire(url)
+    lookup("www.example.com.")
+    settle(url)
+    if got := lookup("www.example.com."); got != "192.0.2.50" {
+        t.Fatalf("stale: %s", got)
+    }
+    s.dynamic.mu.Lock()
+    s.dynamic.entry(url).stale = time.Now()
+    s.dynamic.mu.Unlock()
+    if got := lookup("www.example.com."); got != "192.0.2.1" {
+        t.Fatalf("past max_stale_sec: %s", got)
+    }
+
+    // max_stale_sec: -1 drops them as soon as a fetch fails
+    cfg.DynamicRecords.MaxStaleSec = -1
+    failing.Store(0)
+    expire(url)
+    lookup("www.example.com.")
+    settle(url)
+    failing.Store(1)
+    expire(url)
+    lookup("www.example.com.")
+    settle(url)
+    if got := lookup("www.example.com."); got != "192.0.2.1" {
+        t.Fatalf("max_stale_sec -1: %s", got)
+    }
+}
+
+func TestServeDNS_CountsQueriesPerZone(t *testing.T) {
+    db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+    if err != nil { t.Fatalf("open db: %v", err) }
+    sqlDB, _ := db.DB()
+    sqlDB.SetMaxOpenConns(1)
+    if err := dbm.AutoMigrate(db); err != nil { t.Fatalf("migrate: %v", err) }
+    z := dbm.Zone{Name: "example.com."}
+    if err := db.Create(&z).Error; err != nil { t.Fatalf("create zone: %v", err) }
+
+    cfg := &config.Config{Performance: config.PerformanceConfig{CacheSize: 10, ForwarderTimeoutSec: 1}}
+    s, err := NewServer(cfg, db)
+    if err != nil { t.Fatalf("new server: %v", err) }
+    collector := stats.NewCollector()
+    s.SetStats(collector)
+
+    ask := func(name string, qtype uint16) {
+        req := new(dns.Msg)
+        req.SetQuestion(name, qtype)
+        s.serveDNS(&cacheWriter{}, req)
+    }
+    ask("www.example.com.", dns.TypeA)
+    ask("WWW.example.com.", dns.TypeA) // answered from cache, still counted
+    ask("example.com.", dns.TypeMX)
+    ask("www.other.net.", dns.TypeA) // not a local zone
+
+    if err := collector.Flush(db); err != nil { t.Fatalf("flush: %v", err) }
+    items, err := dbm.QueryStats(db, dbm.QueryStatsFilter{From: time.Now().Add(-time.Hour), To: time.Now().Add(time.Hour)})
+    if err != nil { t.Fatalf("stats: %v", err) }
+    got := map[string]int64{}
+    for _, it := range items {
+        got[it.Zone+" "+it.QType] = it.Queries
+    }
+    if len(got) != 2 || got["example.com. A"] != 2 || got["example.com. MX"] != 1 {
+        t.Fatalf("unexpected counters: %v", got)
+    }
+}
+
+type testPlugin struct {
+    refuse string
+    sent   []*dns.Msg
+}
+
+func (p *testPlugin) Name() string { return "test" }
+
+func (p *testPlugin) PreLookup(q *Query) *dns.Msg {
+    if q.Question.Name != p.refuse {
+        return nil
+    }
+    m := new(dns.Msg)
+    m.SetRcode(q.Msg, dns.RcodeRefused)
+    return m
+}
+
+func (p *testPlugin) PostLookup(q *Query, m *dns.Msg) *dns.Msg {
+    for _, rr := range m.Answer {
+        rr.Header().Ttl = 5
+    }
+    return nil
+}
+
+func (p *testPlugin) PreResponse(q *Query, m *dns.Msg) { p.sent = append(p.sent, m) }
+
+func TestServeDNS_Plugins(t *testing.T) {
+    db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+    if err != nil { t.Fatalf("open db: %v", err) }
+    sqlDB, _ := db.DB()
+    sqlDB.SetMaxOpenConns(1)
+    if err := dbm.AutoMigrate(db); err != nil { t.Fatalf("migrate: %v", err) }
+    z := dbm.Zone{Name: "example.com.", RRSets: []dbm.RRSet{
+        {Name: "www.example.com.", Type: "A", TTL: 60, Records: []dbm.RData{{Data: "192.0.2.1"}}},
+        {Name: "secret.example.com.", Type: "A", TTL: 60, Records: []dbm.RData{{Data: "192.0.2.2"}}},
+    }}
+    if err := db.Create(&z).Error; err != nil { t.Fatalf("create zone: %v", err) }
+
+    cfg := &config.Config{Performance: config.PerformanceConfig{CacheSize: 10, ForwarderTimeoutSec: 1}}
+    s, err := NewServer(cfg, db)
+    if err != nil { t.Fatalf("new server: %v", err) }
+    collector := stats.NewCollector()
+    s.SetStats(collector)
+    p := &testPlugin{refuse: "secret.example.com."}
+    s.Use(p)
+    if got := strings.Join(s.Plugins(), ","); got != "test" {
+        t.Fatalf("plugins: %s", got)
+    }
+
+    ask := func(name string) *dns.Msg {
+        req := new(dns.Msg)
+        req.SetQuestion(name, dns.TypeA)
+        s.serveDNS(&cacheWriter{}, req)
+        m := p.sent[len(p.sent)-1]
+        if m.Id != req.Id {
+            t.Fatalf("%s: id %d, want %d", name, m.Id, req.Id)
+        }
+        return m
+    }
+    if m := ask("www.example.com."); len(m.Answer) != 1 || m.Answer[0].Header().Ttl != 5 {
+        t.Fatalf("www: %v", m)
+    }
+    if m := ask("secret.example.com."); m.Rcode != dns.RcodeRefused || len(m.Answer) != 0 {
+        t.Fatalf("secret: %v", m)
+    }
+
+    // The lookup tool goes through the plugins but is not sent or counted
+    m, tr := s.TestQuery("secret.example.com", dns.TypeA, netip.Addr{})
+    if m.Rcode != dns.RcodeRefused || tr.Source != "plugin" || tr.Rule != "test" || len(p.sent) != 2 {
+        t.Fatalf("test query: rcode %d, trace %+v, %d sent", m.Rcode, tr, len(p.sent))
+    }
+
+    // Queries are counted before the plugins, so refused ones count too
+    if err := collector.Flush(db); err != nil { t.Fatalf("flush: %v", err) }
+    items, err := dbm.QueryStats(db, dbm.QueryStatsFilter{From: time.Now().Add(-time.Hour), To: time.Now().Add(time.Hour)})
+    if err != nil { t.Fatalf("stats: %v", err) }
+    if len(items) != 1 || items[0].Queries != 2 {
+        t.Fatalf("unexpected counters: %+v", items)
+    }
+}
+
+func TestTestQuery_TracesSourceAndRule(t *testing.T) {
+    db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+    if err != nil { t.Fatalf("open db: %v", err) }
+    sqlDB, _ := db.DB()
+    sqlDB.SetMaxOpenConns(1)
+    if err := dbm.AutoMigrate(db); err != nil { t.Fatalf("migrate: %v", err) }
+    z := dbm.Zone{Name: "example.com.", RRSets: []dbm.RRSet{{Name: "www.example.com.", Type: "A", TTL: 60, Records: []dbm.RData{
+        {Data: "192.0.2.1"},
+        {Data: "192.0.2.2", Subnet: strPtr("203.0.113.0/24")},
+    }}}}
+    if err := db.Create(&z).Error; err != nil { t.Fatalf("create zone: %v", err) }
+
+    cfg := &config.Config{Performance: config.PerformanceConfig{CacheSize: 10, ForwarderTimeoutSec: 1}}
+    s, err := NewServer(cfg, db)
+    if err != nil { t.Fatalf("new server: %v", err) }
+
+    m, tr := s.TestQuery("WWW.example.com", dns.TypeA, netip.MustParseAddr("203.0.113.7"))
+    if tr.Source != "local" || tr.Zone != "example.com." || tr.Rule != "subnet" || tr.TTL != 60 {
+        t.Fatalf("unexpected trace: %+v", tr)
+    }
+    if len(m.Answer) != 1 || m.Answer[0].(*dns.A).A.String() != "192.0.2.2" {
+        t.Fatalf("unexpected answer: %v", m.Answer)
+    }
+    if _, tr := s.TestQuery("www.example.com", dns.TypeA, netip.MustParseAddr("198.51.100.1")); tr.Rule != "generic" {
+        t.Fatalf("expected generic rule, got %+v", tr)
+    }
+    // Test queries do not fill the cache; a real query does
+    if _, ok := s.cache.Get("www.example.com.|1|203.0.113.7"); ok {
+        t.Fatal("test query must not populate the cache")
+    }
+    req := new(dns.Msg)
+    req.SetQuestion("www.example.com.", dns.TypeA)
+    s.serveDNS(&cacheWriter{}, req)
+    if _, tr := s.TestQuery("www.example.com", dns.TypeA, netip.Addr{}); tr.Source != "cache" || tr.Zone != "example.com." {
+        t.Fatalf("expected cache hit, got %+v", tr)
+    }
+
+    if _, tr := s.TestQuery("nothing.invalid", dns.TypeA, netip.Addr{}); tr.Source != "nxdomain" {
+        t.Fatalf("expected nxdomain, got %+v", tr)
+    }
+}
+
+func TestRateCounter_Window(t *testing.T) {
+    var rc rateCounter
+    now := time.Date(2024, 1, 1, 12, 30, 10, 0, time.UTC)
+    rc.add(now.Add(-2*time.Hour), false) // falls out of the window, reuses a slot
+    rc.add(now.Add(-5*time.Minute), false)
+    rc.add(now, true)
+    rc.add(now, false)
+
+    got := rc.samples(now)
+    if len(got) != rateWindow {
+        t.Fatalf("expected %d samples, got %d", rateWindow, len(got))
+    }
+    last := got[len(got)-1]
+    if !last.Minute.Equal(now.Truncate(time.Minute)) || last.Queries != 2 || last.CacheHits != 1 {
+        t.Fatalf("unexpected current minute: %+v", last)
+    }
+    if s := got[len(got)-6]; s.Queries != 1 || s.CacheHits != 0 {
+        t.Fatalf("unexpected sample 5 minutes ago: %+v", s)
+    }
+    var total uint64
+    for _, s := range got {
+        total += s.Queries
+    }
+    if total != 3 {
+        t.Fatalf("expected 3 queries in window, got %d", total)
+    }
+}
+
+func TestSlowLog(t *testing.T) {
+    l := newSlowLog(3, 10*time.Millisecond)
+    for i, d := range []time.Duration{5, 20, 40, 30, 10} {
+        l.add(SlowQuery{Name: fmt.Sprintf("q%d.", i), Total: d * time.Millisecond})
+    }
+    // q0 is below the threshold; q1 was pushed out by q4
+    got := l.list()
+    if len(got) != 3 || got[0].Name != "q2." || got[1].Name != "q3." || got[2].Name != "q4." {
+        t.Fatalf("unexpected slow queries: %+v", got)
+    }
+
+    db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+    if err != nil { t.Fatalf("open db: %v", err) }
+    sqlDB, _ := db.DB()
+    sqlDB.SetMaxOpenConns(1)
+    if err := dbm.AutoMigrate(db); err != nil { t.Fatalf("migrate: %v", err) }
+    z := dbm.Zone{Name: "example.com.", RRSets: []dbm.RRSet{{Name: "www.example.com.", Type: "A", TTL: 60, Records: []dbm.RData{{Data: "192.0.2.1"}}}}}
+    if err := db.Create(&z).Error; err != nil { t.Fatalf("create zone: %v", err) }
+
+    cfg := &config.Config{
+        Performance: config.PerformanceConfig{CacheSize: 10, ForwarderTimeoutSec: 1},
+        SlowQueries: config.SlowQueriesConfig{Enabled: true, Size: 10},
+    }
+    s, err := NewServer(cfg, db)
+    if err != nil { t.Fatalf("new server: %v", err) }
+    req := new(dns.Msg)
+    req.SetQuestion("www.example.com.", dns.TypeA)
+    s.serveDNS(&cacheWriter{}, req)
+    got = s.SlowQueries()
+    if len(got) != 1 || got[0].Name != "www.example.com." || got[0].Source != "local" || got[0].Zone != "example.com." ||
+        got[0].Rcode != "NOERROR" || got[0].Timing.DB <= 0 || got[0].Total < got[0].Timing.DB {
+        t.Fatalf("unexpected slow query: %+v", got)
+    }
+}
+
+func TestResolve_HostsOverrideZones(t *testing.T) {
+    db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+    if err != nil { t.Fatalf("open db: %v", err) }
+    sqlDB, _ := db.DB()
+    sqlDB.SetMaxOpenConns(1)
+    if err := dbm.AutoMigrate(db); err != nil { t.Fatalf("migrate: %v", err) }
+    z := dbm.Zone{Name: "example.com.", RRSets: []dbm.RRSet{
+        {Name: "www.example.com.", Type: "A", TTL: 300, Records: []dbm.RData{{Data: "192.0.2.1"}}},
+        {Name: "www.example.com.", Type: "AAAA", TTL: 300, Records: []dbm.RData{{Data: "2001:db8::1"}}},
+        {Name: "www.example.com.", Type: "MX", TTL: 300, Records: []dbm.RData{{Data: "10 mail.example.com."}}},
+    }}
+    if err := db.Create(&z).Error; err != nil { t.Fatalf("create zone: %v", err) }
+    for _, h := range []dbm.Host{{Name: "www.example.com", Address: "10.0.0.5"}, {Name: "lab.internal", Address: "fd00::7", TTL: 30}} {
+        if _, err := dbm.AddHost(db, h); err != nil { t.Fatalf("add host: %v", err) }
+    }
+
+    cfg := &config.Config{DefaultTTL: 120, Performance: config.PerformanceConfig{CacheSize: 10, ForwarderTimeoutSec: 1}}
+    s, err := NewServer(cfg, db)
+    if err != nil { t.Fatalf("new server: %v", err) }
+
+    m, tr := s.TestQuery("www.example.com", dns.TypeA, netip.Addr{})
+    if tr.Source != "hosts" || tr.TTL != 120 || len(m.Answer) != 1 || m.Answer[0].(*dns.A).A.String() != "10.0.0.5" {
+        t.Fatalf("A: %+v %v", tr, m.Answer)
+    }
+    // The zone's AAAA is hidden by the host entry, other types still come from the zone
+    if m, tr := s.TestQuery("www.example.com", dns.TypeAAAA, netip.Addr{}); tr.Source != "hosts" || len(m.Answer) != 0 || m.Rcode != dns.RcodeSuccess {
+        t.Fatalf("AAAA: %+v %v", tr, m.Answer)
+    }
+    if _, tr := s.TestQuery("www.example.com", dns.TypeMX, netip.Addr{}); tr.Source != "local" {
+        t.Fatalf("MX: %+v", tr)
+    }
+    // Names outside any zone work too
+    if m, tr := s.TestQuery("LAB.internal", dns.TypeAAAA, netip.Addr{}); tr.Source != "hosts" || tr.TTL != 30 || len(m.Answer) != 1 {
+        t.Fatalf("lab AAAA: %+v %v", tr, m.Answer)
+    }
+
+    // Changes show up after invalidation
+    if _, err := dbm.DeleteHostsByName(db, "www.example.com"); err != nil { t.Fatalf("delete: %v", err) }
+    s.InvalidateZoneCache()
+    if _, tr := s.TestQuery("www.example.com", dns.TypeA, netip.Addr{}); tr.Source != "local" {
+        t.Fatalf("after delete: %+v", tr)
+    }
+}
+
+func TestResolve_BlocklistBeforeForwarding(t *testing.T) {
+    db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+    if err != nil { t.Fatalf("open db: %v", err) }
+    sqlDB, _ := db.DB()
+    sqlDB.SetMaxOpenConns(1)
+    if err := dbm.AutoMigrate(db); err != nil { t.Fatalf("migrate: %v", err) }
+    z := dbm.Zone{Name: "example.com.", RRSets: []dbm.RRSet{{Name: "ads.example.com.", Type: "A", TTL: 60, Records: []dbm.RData{{Data: "192.0.2.1"}}}}}
+    if err := db.Create(&z).Error; err != nil { t.Fatalf("create zone: %v", err) }
+
+    list := filepath.Join(t.TempDir(), "ads.txt")
+    if err := os.WriteFile(list, []byte("ads.example.com\nads.example.net\n"), 0o644); err != nil { t.Fatal(err) }
+    bl, err := blocklist.New(config.BlocklistConfig{Action: "nxdomain", SinkholeIPv4: "0.0.0.0", SinkholeIPv6: "::", TTL: 60,
+        ExemptCIDRs: []string{"10.0.0.0/8"}, Sources: []config.BlocklistSource{{Name: "ads", Path: list, Format: "domains"}}})
+    if err != nil { t.Fatal(err) }
+    bl.Load()
+
+    cfg := &config.Config{Performance: config.PerformanceConfig{CacheSize: 10, ForwarderTimeoutSec: 1}}
+    s, err := NewServer(cfg, db)
+    if err != nil { t.Fatalf("new server: %v", err) }
+    s.SetBlocklist(bl)
+
+    client := netip.MustParseAddr("192.0.2.50")
+    if m, tr := s.TestQuery("tracker.ads.example.net", dns.TypeA, client); tr.Source != "blocked" || tr.Rule != "ads" || m.Rcode != dns.RcodeNameError {
+        t.Fatalf("want blocked, got %+v rcode %d", tr, m.Rcode)
+    }
+    // Local zones are authoritative and not rewritten
+    if _, tr := s.TestQuery("ads.example.com", dns.TypeA, client); tr.Source != "local" {
+        t.Fatalf("local zone was blocked: %+v", tr)
+    }
+    if _, tr := s.TestQuery("ads.example.net", dns.TypeA, netip.MustParseAddr("10.9.9.9")); tr.Source == "blocked" {
+        t.Fatalf("exempt client was blocked: %+v", tr)
+    }
+}
+
+func TestForwardedTTL_Clamped(t *testing.T) {
+    s := &Server{cfg: &config.Config{Performance: config.PerformanceConfig{MinTTL: 30, MaxTTL: 3600}}}
+    rr := func(s string) dns.RR { r, _ := dns.NewRR(s); return r }
+
+    m := new(dns.Msg)
+    m.Answer = []dns.RR{rr("a.example. 0 IN A 192.0.2.1"), rr("a.example. 604800 IN A 192.0.2.2")}
+    m.SetEdns0(4096, false)
+    if ttl := s.forwardedTTL(m); ttl != 30 {
+        t.Fatalf("positive ttl = %d, want 30", ttl)
+    }
+    if m.Answer[0].Header().Ttl != 30 || m.Answer[1].Header().Ttl != 3600 {
+        t.Fatalf("answer TTLs not clamped: %v", m.Answer)
+    }
+    if opt := m.IsEdns0(); opt == nil || opt.UDPSize() != 4096 {
+        t.Fatalf("OPT record was changed: %v", m.Extra)
+    }
+
+    // Negative answers use the SOA negative TTL, bounded the same way
+    m = new(dns.Msg)
+    m.Rcode = dns.RcodeNameError
+    m.Ns = []dns.RR{rr("example. 86400 IN SOA ns.example. host.example. 1 7200 3600 1209600 86400")}
+    if ttl := s.forwardedTTL(m); ttl != 3600 {
+        t.Fatalf("negative ttl = %d, want 3600", ttl)
+    }
+    m = &dns.Msg{MsgHdr: dns.MsgHdr{Rcode: dns.RcodeServerFailure}}
+    if ttl := s.forwardedTTL(m); ttl != config.DefaultNegativeTTL {
+        t.Fatalf("servfail ttl = %d, want %d", ttl, config.DefaultNegativeTTL)
+    }
+
+    // Without bounds upstream TTLs are kept, and a TTL of 0 is not cached
+    s.cfg.Performance = config.PerformanceConfig{}
+    m = &dns.Msg{Answer: []dns.RR{rr("a.example. 0 IN A 192.0.2.1")}}
+    if ttl := s.forwardedTTL(m); ttl != 0 {
+        t.Fatalf("unbounded ttl = %d, want 0", ttl)
+    }
+}
+
+func TestResolve_ClampLocal(t *testing.T) {
+    db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+    if err != nil { t.Fatalf("open db: %v", err) }
+    sqlDB, _ := db.DB()
+    sqlDB.SetMaxOpenConns(1)
+    if err := dbm.AutoMigrate(db); err != nil { t.Fatalf("migrate: %v", err) }
+    z := dbm.Zone{Name: "example.com.", RRSets: []dbm.RRSet{{Name: "www.example.com.", Type: "A", TTL: 86400, Records: []dbm.RData{{Data: "192.0.2.1"}}}}}
+    if err := db.Create(&z).Error; err != nil { t.Fatalf("create zone: %v", err) }
+
+    cfg := &config.Config{Performance: config.PerformanceConfig{CacheSize: 10, ForwarderTimeoutSec: 1, MaxTTL: 600}}
+    s, err := NewServer(cfg, db)
+    if err != nil { t.Fatalf("new server: %v", err) }
+    if m, tr := s.TestQuery("www.example.com", dns.TypeA, netip.Addr{}); tr.TTL != 86400 || m.Answer[0].Header().Ttl != 86400 {
+        t.Fatalf("local answer clamped without clamp_local: %+v", tr)
+    }
+    cfg.Performance.ClampLocal = true
+    if m, tr := s.TestQuery("www.example.com", dns.TypeA, netip.Addr{}); tr.TTL != 600 || m.Answer[0].Header().Ttl != 600 {
+        t.Fatalf("clamp_local: %+v %v", tr, m.Answer)
+    }
+}
+
+func TestResolve_MinimalResponses(t *testing.T) {
+    db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+    if err != nil { t.Fatalf("open db: %v", err) }
+    sqlDB, _ := db.DB()
+    sqlDB.SetMaxOpenConns(1)
+    if err := dbm.AutoMigrate(db); err != nil { t.Fatalf("migrate: %v", err) }
+    z := dbm.Zone{Name: "example.com.", RRSets: []dbm.RRSet{
+        {Name: "example.com.", Type: "NS", TTL: 3600, Records: []dbm.RData{{Data: "ns1.example.com."}, {Data: "ns.other.net."}}},
+        {Name: "example.com.", Type: "MX", TTL: 3600, Records: []dbm.RData{{Data: "10 mail.example.com."}}},
+        {Name: "ns1.example.com.", Type: "A", TTL: 3600, Records: []dbm.RData{{Data: "192.0.2.53"}}},
+        {Name: "mail.example.com.", Type: "A", TTL: 3600, Records: []dbm.RData{{Data: "192.0.2.25"}}},
+        {Name: "mail.example.com.", Type: "AAAA", TTL: 3600, Records: []dbm.RData{{Data: "2001:db8::25"}}},
+    }}
+    if err := db.Create(&z).Error; err != nil { t.Fatalf("create zone: %v", err) }
+
+    cfg := &config.Config{Performance: config.PerformanceConfig{CacheSize: 10, ForwarderTimeoutSec: 1}}
+    s, err := NewServer(cfg, db)
+    if err != nil { t.Fatalf("new server: %v", err) }
+    if m, _ := s.TestQuery("example.com", dns.TypeMX, netip.Addr{}); len(m.Ns) != 0 || len(m.Extra) != 0 {
+        t.Fatalf("minimal by default: ns=%v extra=%v", m.Ns, m.Extra)
+    }
+
+    full := false
+    cfg.MinimalResponses = &full
+    m, _ := s.TestQuery("example.com", dns.TypeMX, netip.Addr{})
+    if len(m.Ns) != 2 {
+        t.Fatalf("authority: %v", m.Ns)
+    }
+    // Glue for the MX and the in-zone NS; ns.other.net is out of zone
+    if len(m.Extra) != 3 {
+        t.Fatalf("additional: %v", m.Extra)
+    }
+    if m, _ := s.TestQuery("example.com", dns.TypeNS, netip.Addr{}); len(m.Ns) != 0 || len(m.Extra) != 1 {
+        t.Fatalf("NS answer repeated in authority: ns=%v extra=%v", m.Ns, m.Extra)
+    }
+
+    // The zone setting wins over the config
+    minimal := true
+    db.Model(&dbm.Zone{}).Where("id = ?", z.ID).Update("minimal_responses", &minimal)
+    s.InvalidateZoneCache()
+    if m, _ := s.TestQuery("example.com", dns.TypeMX, netip.Addr{}); len(m.Ns) != 0 || len(m.Extra) != 0 {
+        t.Fatalf("zone override ignored: ns=%v extra=%v", m.Ns, m.Extra)
+    }
+}
+
+func TestResolve_Canary(t *testing.T) {
+    db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+    if err != nil { t.Fatalf("open db: %v", err) }
+    sqlDB, _ := db.DB()
+    sqlDB.SetMaxOpenConns(1)
+    if err := dbm.AutoMigrate(db); err != nil { t.Fatalf("migrate: %v", err) }
+    z := dbm.Zone{Name: "example.com.", RRSets: []dbm.RRSet{
+        {Name: "www.example.com.", Type: "A", TTL: 300, Records: []dbm.RData{{Data: "192.0.2.1"}}},
+        {Name: "old.example.com.", Type: "A", TTL: 300, Records: []dbm.RData{{Data: "192.0.2.9"}}},
+    }}
+    if err := db.Create(&z).Error; err != nil { t.Fatalf("create zone: %v", err) }
+    canary := dbm.ZoneCanary{ZoneID: z.ID, CIDRs: []string{"198.51.100.0/24"}, RRSets: []dbm.RRSet{
+        {Name: "www.example.com.", Type: "A", TTL: 60, Records: []dbm.RData{{Data: "192.0.2.2"}}},
+        {Name: "new.example.com.", Type: "TXT", TTL: 60, Records: []dbm.RData{{Data: `"v2"`}}},
+    }}
+    if err := dbm.SaveZoneCanary(db, canary); err != nil { t.Fatalf("save canary: %v", err) }
+
+    cfg := &config.Config{Performance: config.PerformanceConfig{CacheSize: 10, ForwarderTimeoutSec: 1}}
+    s, err := NewServer(cfg, db)
+    if err != nil { t.Fatalf("new server: %v", err) }
+    tester := netip.MustParseAddr("198.51.100.7")
+    other := netip.MustParseAddr("203.0.113.7")
+
+    if m, tr := s.TestQuery("www.example.com", dns.TypeA, tester); len(m.Answer) != 1 || m.Answer[0].(*dns.A).A.String() != "192.0.2.2" || tr.Rule != "canary:generic" {
+        t.Fatalf("canary client: %v %+v", m.Answer, tr)
+    }
+    if m, _ := s.TestQuery("www.example.com", dns.TypeA, other); len(m.Answer) != 1 || m.Answer[0].(*dns.A).A.String() != "192.0.2.1" {
+        t.Fatalf("other client: %v", m.Answer)
+    }
+    // Names removed in the canary are gone for its clients only
+    if m, _ := s.TestQuery("old.example.com", dns.TypeA, tester); len(m.Answer) != 0 {
+        t.Fatalf("removed name answered: %v", m.Answer)
+    }
+    if m, tr := s.TestQuery("new.example.com", dns.TypeA, tester); m.Rcode != dns.RcodeSuccess || tr.Rule != "nodata" {
+        t.Fatalf("canary name without A: rcode=%d %+v", m.Rcode, tr)
+    }
+
+    if err := dbm.DeleteZoneCanary(db, z.ID); err != nil { t.Fatalf("delete canary: %v", err) }
+    s.InvalidateZoneCache()
+    if m, _ := s.TestQuery("www.example.com", dns.TypeA, tester); len(m.Answer) != 1 || m.Answer[0].(*dns.A).A.String() != "192.0.2.1" {
+        t.Fatalf("after revert: %v", m.Answer)
+    }
+}
+
+func TestFinishEDNS(t *testing.T) {
+    s := &Server{cfg: &config.Config{EDNS: config.EDNSConfig{UDPSize: 1232, Padding: true, PaddingBlock: 468}}}
+    reply := func(r *dns.Msg) *dns.Msg {
+        m := new(dns.Msg)
+        m.SetReply(r)
+        for i := 0; i < 100; i++ {
+            rr, _ := dns.NewRR(fmt.Sprintf("big.example. 300 IN A 192.0.2.%d", i))
+            m.Answer = append(m.Answer, rr)
+        }
+        // As forwarded from upstream
+        m.SetEdns0(4096, false)
+        return m
+    }
+
+    r := new(dns.Msg)
+    r.SetQuestion("big.example.", dns.TypeA)
+    r.SetEdns0(4096, false)
+    m := reply(r)
+    s.finishEDNS(r, m, true)
+    if !m.Truncated || m.Len() > 1232 {
+        t.Fatalf("UDP reply not cut to edns.udp_size: tc=%v len=%d", m.Truncated, m.Len())
+    }
+    if opt := m.IsEdns0(); opt == nil || opt.UDPSize() != 1232 {
+        t.Fatalf("OPT: %v", m.Extra)
+    }
+
+    plain := new(dns.Msg)
+    plain.SetQuestion("big.example.", dns.TypeA)
+    m = reply(plain)
+    s.finishEDNS(plain, m, false)
+    if m.IsEdns0() != nil || m.Truncated || len(m.Answer) != 100 {
+        t.Fatalf("reply to a query without EDNS: opt=%v tc=%v answers=%d", m.IsEdns0(), m.Truncated, len(m.Answer))
+    }
+
+    r.IsEdns0().Option = append(r.IsEdns0().Option, &dns.EDNS0_PADDING{})
+    m = reply(r)
+    s.finishEDNS(r, m, false)
+    if m.Len()%468 != 0 {
+        t.Fatalf("TCP reply length %d is not padded to 468", m.Len())
+    }
+    if buf, err := m.Pack(); err != nil || len(buf)%468 != 0 {
+        t.Fatalf("packed length %d: %v", len(buf), err)
+    }
+}
+
+// replyWriter keeps the reply written to it.
+type replyWriter struct {
+    cacheWriter
+    reply *dns.Msg
+}
+
+func (w *replyWriter) WriteMsg(m *dns.Msg) error { w.reply = m; return nil }
+
+func TestNodeIdentity(t *testing.T) {
+    s := &Server{cfg: &config.Config{NodeID: "fra-1", NodeIDName: "id.server."}}
+    for _, class := range []uint16{dns.ClassCHAOS, dns.ClassINET} {
+        r := new(dns.Msg)
+        r.SetQuestion("ID.Server.", dns.TypeTXT)
+        r.Question[0].Qclass = class
+        w := &replyWriter{}
+        if !s.nodeAnswer(w, r) {
+            t.Fatalf("class %d: not answered", class)
+        }
+        if txt, ok := w.reply.Answer[0].(*dns.TXT); !ok || txt.Txt[0] != "fra-1" || txt.Hdr.Class != class {
+            t.Fatalf("class %d: answer %v", class, w.reply.Answer)
+        }
+    }
+    other := new(dns.Msg)
+    other.SetQuestion("id.server.", dns.TypeA)
+    if s.nodeAnswer(&replyWriter{}, other) {
+        t.Fatal("A query answered")
+    }
+
+    // NSID only when the query asks for it
+    r := new(dns.Msg)
+    r.SetQuestion("www.example.", dns.TypeA)
+    r.SetEdns0(1232, false)
+    m := new(dns.Msg)
+    m.SetReply(r)
+    s.finishEDNS(r, m, true)
+    if len(m.IsEdns0().Option) != 0 {
+        t.Fatalf("NSID without asking: %v", m.IsEdns0().Option)
+    }
+    r.IsEdns0().Option = append(r.IsEdns0().Option, &dns.EDNS0_NSID{Code: dns.EDNS0NSID})
+    m = new(dns.Msg)
+    m.SetReply(r)
+    s.finishEDNS(r, m, true)
+    opts := m.IsEdns0().Option
+    if len(opts) != 1 || opts[0].(*dns.EDNS0_NSID).Nsid != hex.EncodeToString([]byte("fra-1")) {
+        t.Fatalf("NSID: %v", opts)
+    }
+
+    s.cfg.NodeID = ""
+    id := new(dns.Msg)
+    id.SetQuestion("id.server.", dns.TypeTXT)
+    if s.nodeAnswer(&replyWriter{}, id) {
+        t.Fatal("answered without node_id")
+    }
+}
+
+// startUpstream runs a UDP DNS server on a random port for forwarding tests.
+func startUpstream(t *testing.T, h dns.HandlerFunc) string {
+    pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+    if err != nil { t.Fatalf("listen: %v", err) }
+    srv := &dns.Server{PacketConn: pc, Handler: h}
+    started := make(chan struct{})
+    srv.NotifyStartedFunc = func() { close(started) }
+    go func() { _ = srv.ActivateAndServe() }()
+    <-started
+    t.Cleanup(func() { _ = srv.Shutdown() })
+    return pc.LocalAddr().String()
+}
+
+func TestForward_0x20(t *testing.T) {
+    seen := make(chan string, 2)
+    var lower atomic.Bool
+    addr := startUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+        seen <- r.Question[0].Name
+        m := new(dns.Msg)
+        m.SetReply(r)
+        if lower.Load() {
+            m.Question[0].Name = strings.ToLower(m.Question[0].Name)
+        }
+        rr, _ := dns.NewRR(r.Question[0].Name + " 300 IN A 192.0.2.9")
+        m.Answer = []dns.RR{rr}
+        _ = w.WriteMsg(m)
+    })
+
+    cfg := &config.Config{Forwarder: "127.0.0.1", Performance: config.PerformanceConfig{CacheSize: 0, ForwarderTimeoutSec: 1, Forwarder0x20: true}}
+    s, err := NewServer(cfg, nil)
+    if err != nil { t.Fatalf("new server: %v", err) }
+    s.forwardAddr = addr
+
+    name := "abcdefghijklmnopqrstuvwxyz.example.net."
+    in, err := s.forward(dns.Question{Name: name, Qtype: dns.TypeA, Qclass: dns.ClassINET}, nil)
+    if err != nil { t.Fatalf("forward: %v", err) }
+    if sent := <-seen; sent == name || !strings.EqualFold(sent, name) {
+        t.Fatalf("name sent as %q, want random case of %q", sent, name)
+    }
+    if in.Question[0].Name != name || in.Answer[0].Header().Name != name {
+        t.Fatalf("case not restored: %v %v", in.Question, in.Answer)
+    }
+
+    // A reply that does not echo the case is dropped
+    lower.Store(true)
+    if _, err := s.forward(dns.Question{Name: name, Qtype: dns.TypeA, Qclass: dns.ClassINET}, nil); err != errQuestionMismatch {
+        t.Fatalf("want mismatch, got %v", err)
+    }
+}
+
+func TestForward_TruncatedRetriesTCP(t *testing.T) {
+    h := func(w dns.ResponseWriter, r *dns.Msg) {
+        m := new(dns.Msg)
+        m.SetReply(r)
+        if _, udp := w.RemoteAddr().(*net.UDPAddr); udp {
+            m.Truncated = true
+        } else {
+            for i := 1; i <= 40; i++ {
+                rr, _ := dns.NewRR(fmt.Sprintf("%s 300 IN A 192.0.2.%d", r.Question[0].Name, i))
+                m.Answer = append(m.Answer, rr)
+            }
+        }
+        _ = w.WriteMsg(m)
+    }
+    addr := startUpstream(t, h)
+    ln, err := net.Listen("tcp", addr)
+    if err != nil { t.Skipf("tcp listen on %s: %v", addr, err) }
+    tsrv := &dns.Server{Listener: ln, Handler: dns.HandlerFunc(h)}
+    go func() { _ = tsrv.ActivateAndServe() }()
+    t.Cleanup(func() { _ = tsrv.Shutdown() })
+
+    cfg := &config.Config{Forwarder: "127.0.0.1", Performance: config.PerformanceConfig{CacheSize: 0, ForwarderTimeoutSec: 1}}
+    s, err := NewServer(cfg, nil)
+    if err != nil { t.Fatalf("new server: %v", err) }
+    s.forwardAddr = addr
+
+    in, err := s.forward(dns.Question{Name: "big.example.net.", Qtype: dns.TypeA, Qclass: dns.ClassINET}, nil)
+    if err != nil { t.Fatalf("forward: %v", err) }
+    if in.Truncated || len(in.Answer) != 40 {
+        t.Fatalf("want full answer over TCP, got tc=%v answers=%d", in.Truncated, len(in.Answer))
+    }
+}
+
+func TestForward_DropsSpoofedReplies(t *testing.T) {
+    addr := startUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+        reply := func(name string) *dns.Msg {
+            m := new(dns.Msg)
+            m.SetReply(r)
+            m.Question[0].Name = name
+            rr, _ := dns.NewRR(name + " 300 IN A 192.0.2.66")
+            m.Answer = []dns.RR{rr}
+            return m
+        }
+        _, _ = w.Write([]byte{0xde, 0xad}) // malformed
+        wrongID := reply(r.Question[0].Name)
+        wrongID.Id = r.Id + 1
+        _ = w.WriteMsg(wrongID)
+        _ = w.WriteMsg(reply("evil.example.net.")) // right ID, other question
+        query := reply(r.Question[0].Name)
+        query.Response = false
+        _ = w.WriteMsg(query)
+        m := reply(r.Question[0].Name)
+        m.Answer[0].(*dns.A).A = net.ParseIP("192.0.2.9")
+        _ = w.WriteMsg(m)
+    })
+
+    cfg := &config.Config{Forwarder: "127.0.0.1", Performance: config.PerformanceConfig{CacheSize: 0, ForwarderTimeoutSec: 1}}
+    s, err := NewServer(cfg, nil)
+    if err != nil { t.Fatalf("new server: %v", err) }
+    s.forwardAddr = addr
+
+    before := map[string]float64{}
+    reasons := []string{"malformed", "id", "question", "not_response"}
+    for _, r := range reasons {
+        before[r] = repliesDropped.Value(r)
+    }
+    in, err := s.forward(dns.Question{Name: "www.example.net.", Qtype: dns.TypeA, Qclass: dns.ClassINET}, nil)
+    if err != nil { t.Fatalf("forward: %v", err) }
+    if len(in.Answer) != 1 || in.Answer[0].(*dns.A).A.String() != "192.0.2.9" {
+        t.Fatalf("want the genuine reply, got %v", in.Answer)
+    }
+    for _, r := range reasons {
+        if got := repliesDropped.Value(r) - before[r]; got != 1 {
+            t.Errorf("dropped %q: %v, want 1", r, got)
+        }
+    }
+
+    // FORMERR may come without the question
+    q := new(dns.Msg)
+    q.SetQuestion("www.example.net.", dns.TypeA)
+    formerr := new(dns.Msg)
+    formerr.SetRcode(q, dns.RcodeFormatError)
+    formerr.Question = nil
+    if reason := replyMismatch(q, formerr); reason != "" {
+        t.Fatalf("FORMERR without question: %q", reason)
+    }
+    formerr.Rcode = dns.RcodeSuccess
+    if reason := replyMismatch(q, formerr); reason != "question" {
+        t.Fatalf("NOERROR without question: %q", reason)
+    }
+}
+
+func TestUpstreamECS(t *testing.T) {
+    query := func(ecs *dns.EDNS0_SUBNET) *dns.Msg {
+        r := new(dns.Msg)
+        r.SetQuestion("www.example.net.", dns.TypeA)
+        if ecs != nil {
+            r.SetEdns0(1232, false)
+            r.IsEdns0().Option = append(r.IsEdns0().Option, ecs)
+        }
+        return r
+    }
+    client := netip.MustParseAddr("203.0.113.77")
+    clientECS := &dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: 32, Address: net.ParseIP("198.51.100.9").To4()}
+
+    if e := upstreamECS(config.ECSConfig{}, query(clientECS), client); e != nil {
+        t.Fatalf("strip by default: %v", e)
+    }
+    if e := upstreamECS(config.ECSConfig{Mode: config.ECSForward}, query(nil), client); e != nil {
+        t.Fatalf("forward without client ECS: %v", e)
+    }
+    if e := upstreamECS(config.ECSConfig{Mode: config.ECSForward}, query(clientECS), client); e == nil || e.SourceNetmask != 24 || e.Address.String() != "198.51.100.0" {
+        t.Fatalf("forward: %v", e)
+    }
+    if e := upstreamECS(config.ECSConfig{Mode: config.ECSInject, SourceV4: 16}, query(nil), client); e == nil || e.SourceNetmask != 16 || e.Address.String() != "203.0.0.0" {
+        t.Fatalf("inject: %v", e)
+    }
+    if e := upstreamECS(config.ECSConfig{Mode: config.ECSInject}, query(nil), netip.MustParseAddr("2001:db8:1:2345::1")); e == nil || e.Family != 2 || e.SourceNetmask != 56 || e.Address.String() != "2001:db8:1:2300::" {
+        t.Fatalf("inject v6: %v", e)
+    }
+    optOut := &dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: 0, Address: net.IPv4zero.To4()}
+    if e := upstreamECS(config.ECSConfig{Mode: config.ECSInject}, query(optOut), client); e == nil || e.SourceNetmask != 0 {
+        t.Fatalf("client opting out of ECS: %v", e)
+    }
+
+    // The option reaches the forwarder
+    got := make(chan *dns.EDNS0_SUBNET, 1)
+    addr := startUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+        var ecs *dns.EDNS0_SUBNET
+        if opt := r.IsEdns0(); opt != nil {
+            for _, o := range opt.Option {
+                if e, ok := o.(*dns.EDNS0_SUBNET); ok {
+                    ecs = e
+                }
+            }
+        }
+        got <- ecs
+        m := new(dns.Msg)
+        m.SetReply(r)
+        _ = w.WriteMsg(m)
+    })
+    cfg := &config.Config{Forwarder: "127.0.0.1", ForwarderECS: config.ECSConfig{Mode: config.ECSInject},
+        Performance: config.PerformanceConfig{CacheSize: 0, ForwarderTimeoutSec: 1}}
+    s, err := NewServer(cfg, nil)
+    if err != nil { t.Fatalf("new server: %v", err) }
+    s.forwardAddr = addr
+    if _, err := s.forward(dns.Question{Name: "www.example.net.", Qtype: dns.TypeA, Qclass: dns.ClassINET}, upstreamECS(cfg.ForwarderECS, query(nil), client)); err != nil {
+        t.Fatalf("forward: %v", err)
+    }
+    if e := <-got; e == nil || e.SourceNetmask != 24 || e.Address.String() != "203.0.113.0" {
+        t.Fatalf("forwarder saw ECS %v", e)
+    }
+}
+
+func TestResolve_RecursionACL(t *testing.T) {
+    db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+    if err != nil { t.Fatalf("open db: %v", err) }
+    if err := dbm.AutoMigrate(db); err != nil { t.Fatalf("migrate: %v", err) }
+    cfg := &config.Config{Performance: config.PerformanceConfig{CacheSize: 10, ForwarderTimeoutSec: 1},
+        Recursion: config.RecursionConfig{Enabled: true, AllowedCIDRs: []string{"10.0.0.0/8", "::1/128"}}}
+    s, err := NewServer(cfg, db)
+    if err != nil { t.Fatalf("new server: %v", err) }
+
+    if !s.mayRecurse(&net.UDPAddr{IP: net.ParseIP("10.1.2.3")}) || !s.mayRecurse(&net.TCPAddr{IP: net.ParseIP("::1")}) {
+        t.Fatal("allowed client refused")
+    }
+    if s.mayRecurse(&net.UDPAddr{IP: net.ParseIP("192.0.2.1")}) {
+        t.Fatal("client outside allowed_cidrs may recurse")
+    }
+
+    r := new(dns.Msg)
+    r.SetQuestion("www.example.net.", dns.TypeA)
+    m, tr := s.resolve(r, netip.MustParseAddr("192.0.2.1"), true, false)
+    if tr.Source != "refused" || m.Rcode != dns.RcodeRefused || !m.RecursionAvailable || m.Authoritative || tr.Drop {
+        t.Fatalf("want REFUSED, got %+v rcode=%d", tr, m.Rcode)
+    }
+
+    cfg.Deny.Recursion = config.DenyNXDomain
+    if m, tr := s.resolve(r, netip.MustParseAddr("192.0.2.1"), true, false); m.Rcode != dns.RcodeNameError || tr.Drop {
+        t.Fatalf("want NXDOMAIN, got %+v rcode=%d", tr, m.Rcode)
+    }
+    cfg.Deny.Recursion = config.DenyDrop
+    if _, tr := s.resolve(r, netip.MustParseAddr("192.0.2.1"), true, false); !tr.Drop {
+        t.Fatalf("want drop, got %+v", tr)
+    }
+}
+
+func TestResolve_DisabledZone(t *testing.T) {
+    db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+    if err != nil { t.Fatalf("open db: %v", err) }
+    sqlDB, _ := db.DB()
+    sqlDB.SetMaxOpenConns(1)
+    if err := dbm.AutoMigrate(db); err != nil { t.Fatalf("migrate: %v", err) }
+    zones := []dbm.Zone{
+        {Name: "off.test.", Disabled: true, RRSets: []dbm.RRSet{
+            {Name: "www.off.test.", Type: "A", TTL: 300, Records: []dbm.RData{{Data: "192.0.2.1"}}},
+        }},
+        {Name: "on.off.test.", RRSets: []dbm.RRSet{
+            {Name: "www.on.off.test.", Type: "A", TTL: 300, Records: []dbm.RData{{Data: "192.0.2.2"}}},
+        }},
+    }
+    for i := range zones {
+        if err := db.Create(&zones[i]).Error; err != nil { t.Fatalf("create zone: %v", err) }
+    }
+    if err := db.Model(&zones[0]).Update("disabled", true).Error; err != nil { t.Fatalf("disable: %v", err) }
+
+    cfg := &config.Config{Performance: config.PerformanceConfig{CacheSize: 10, ForwarderTimeoutSec: 1}}
+    s, err := NewServer(cfg, db)
+    if err != nil { t.Fatalf("new server: %v", err) }
+    client := netip.MustParseAddr("192.0.2.10")
+
+    // Without a policy the zone is looked past
+    if m, tr := s.TestQuery("www.off.test", dns.TypeA, client); tr.Source != "nxdomain" || m.Rcode != dns.RcodeNameError {
+        t.Fatalf("no policy: %+v rcode=%d", tr, m.Rcode)
+    }
+    cfg.Deny.DisabledZones = config.DenyRefused
+    if m, tr := s.TestQuery("www.off.test", dns.TypeA, client); tr.Source != "disabled" || tr.Zone != "off.test." || m.Rcode != dns.RcodeRefused || len(m.Answer) != 0 {
+        t.Fatalf("refused policy: %+v rcode=%d", tr, m.Rcode)
+    }
+    // An enabled zone below the disabled one is still served
+    if m, tr := s.TestQuery("www.on.off.test", dns.TypeA, client); tr.Source != "local" || len(m.Answer) != 1 {
+        t.Fatalf("enabled child zone: %+v %v", tr, m.Answer)
+    }
+    cfg.Deny.DisabledZones = config.DenyDrop
+    if _, tr := s.TestQuery("off.test", dns.TypeSOA, client); tr.Source != "disabled" || !tr.Drop {
+        t.Fatalf("drop policy: %+v", tr)
+    }
+}
+
+func TestEmbedDNS64(t *testing.T) {
+    v4 := netip.MustParseAddr("192.0.2.33")
+    cases := map[string]string{
+        "64:ff9b::/96":  "64:ff9b::c000:221",
+        "2001:db8::/32": "2001:db8:c000:221::",
+        "2001:db8::/56": "2001:db8:0:c0:0:221::",
+        "2001:db8::/64": "2001:db8::c0:2:2100:0",
+    }
+    for p, want := range cases {
+        if got := embed(netip.MustParsePrefix(p), v4); got.String() != want {
+            t.Errorf("%s: got %s, want %s", p, got, want)
+        }
+    }
+}
+
+func TestResolve_DNS64(t *testing.T) {
+    db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+    if err != nil { t.Fatalf("open db: %v", err) }
+    sqlDB, _ := db.DB()
+    sqlDB.SetMaxOpenConns(1)
+    if err := dbm.AutoMigrate(db); err != nil { t.Fatalf("migrate: %v", err) }
+    z := dbm.Zone{Name: "example.com.", RRSets: []dbm.RRSet{
+        {Name: "www.example.com.", Type: "A", TTL: 300, Records: []dbm.RData{{Data: "192.0.2.1"}, {Data: "10.0.0.1"}}},
+        {Name: "v6.example.com.", Type: "A", TTL: 300, Records: []dbm.RData{{Data: "192.0.2.2"}}},
+        {Name: "v6.example.com.", Type: "AAAA", TTL: 300, Records: []dbm.RData{{Data: "2001:db8::2"}}},
+        {Name: "skip.example.com.", Type: "A", TTL: 300, Records: []dbm.RData{{Data: "192.0.2.3"}}},
+    }}
+    if err := db.Create(&z).Error; err != nil { t.Fatalf("create zone: %v", err) }
+
+    cfg := &config.Config{Performance: config.PerformanceConfig{CacheSize: 10, ForwarderTimeoutSec: 1},
+        DNS64: config.DNS64Config{Enabled: true, Prefix: "64:ff9b::/96", ClientCIDRs: []string{"2001:db8:64::/48"},
+            ExcludeIPv4: []string{"10.0.0.0/8"}, ExcludeNames: []string{"skip.example.com"}}}
+    s, err := NewServer(cfg, db)
+    if err != nil { t.Fatalf("new server: %v", err) }
+    client := netip.MustParseAddr("2001:db8:64::1")
+
+    m, _ := s.TestQuery("www.example.com", dns.TypeAAAA, client)
+    if m.Rcode != dns.RcodeSuccess || len(m.Answer) != 1 || m.Answer[0].(*dns.AAAA).AAAA.String() != "64:ff9b::c000:201" {
+        t.Fatalf("want one synthesized AAAA, got %v", m)
+    }
+    if m, _ := s.TestQuery("v6.example.com", dns.TypeAAAA, client); len(m.Answer) != 1 || m.Answer[0].(*dns.AAAA).AAAA.String() != "2001:db8::2" {
+        t.Fatalf("real AAAA replaced: %v", m.Answer)
+    }
+    if m, _ := s.TestQuery("skip.example.com", dns.TypeAAAA, client); len(m.Answer) != 0 {
+        t.Fatalf("excluded name synthesized: %v", m.Answer)
+    }
+    if m, _ := s.TestQuery("www.example.com", dns.TypeAAAA, netip.MustParseAddr("192.0.2.200")); len(m.Answer) != 0 {
+        t.Fatalf("synthesized for a client outside client_cidrs: %v", m.Answer)
+    }
+}
+
+func TestResolve_StubZone(t *testing.T) {
+    db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+    if err != nil { t.Fatalf("open db: %v", err) }
+    if err := dbm.AutoMigrate(db); err != nil { t.Fatalf("migrate: %v", err) }
+    var rd atomic.Bool
+    addr := startUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+        rd.Store(r.RecursionDesired)
+        m := new(dns.Msg)
+        m.SetReply(r)
+        m.Authoritative = true
+        rr, _ := dns.NewRR(r.Question[0].Name + " 300 IN A 10.1.1.1")
+        m.Answer = []dns.RR{rr}
+        _ = w.WriteMsg(m)
+    })
+
+    cfg := &config.Config{Performance: config.PerformanceConfig{CacheSize: 10, ForwarderTimeoutSec: 1},
+        StubZones: []config.StubZone{{Zone: "corp.example", Servers: []string{addr}}, {Zone: "lab.corp.example", Servers: []string{"127.0.0.1:1"}}}}
+    s, err := NewServer(cfg, db)
+    if err != nil { t.Fatalf("new server: %v", err) }
+
+    m, tr := s.TestQuery("db.corp.example", dns.TypeA, netip.Addr{})
+    if tr.Source != "stub" || tr.Rule != "corp.example." || len(m.Answer) != 1 || m.Authoritative || rd.Load() {
+        t.Fatalf("stub answer: %+v %v (rd=%v)", tr, m, rd.Load())
+    }
+    // The deeper stub zone wins; its only server is down
+    if m, tr := s.TestQuery("x.lab.corp.example", dns.TypeA, netip.Addr{}); tr.Rule != "lab.corp.example." || m.Rcode != dns.RcodeServerFailure {
+        t.Fatalf("want SERVFAIL from lab stub, got %+v rcode=%d", tr, m.Rcode)
+    }
+    if _, tr := s.TestQuery("www.example.org", dns.TypeA, netip.Addr{}); tr.Source == "stub" {
+        t.Fatalf("name outside stub zones sent to stub: %+v", tr)
+    }
+}
+
+func TestResolve_EmptyNonTerminal(t *testing.T) {
+    db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+    if err != nil { t.Fatalf("open db: %v", err) }
+    sqlDB, _ := db.DB()
+    sqlDB.SetMaxOpenConns(1)
+    if err := dbm.AutoMigrate(db); err != nil { t.Fatalf("migrate: %v", err) }
+    z := dbm.Zone{Name: "example.com.", RRSets: []dbm.RRSet{
+        {Name: "example.com.", Type: "SOA", TTL: 3600, Records: []dbm.RData{{Data: "ns1.example.com. hostmaster.example.com. 1 7200 3600 1209600 120"}}},
+        {Name: "a.b.example.com.", Type: "A", TTL: 300, Records: []dbm.RData{{Data: "192.0.2.1"}}},
+        {Name: "w.xab.example.com.", Type: "A", TTL: 300, Records: []dbm.RData{{Data: "192.0.2.2"}}},
+    }}
+    if err := db.Create(&z).Error; err != nil { t.Fatalf("create zone: %v", err) }
+
+    s, err := NewServer(&config.Config{Performance: config.PerformanceConfig{CacheSize: 10, ForwarderTimeoutSec: 1}}, db)
+    if err != nil { t.Fatalf("new server: %v", err) }
+
+    for _, name := range []string{"b.example.com", "a.b.example.com"} {
+        m, tr := s.TestQuery(name, dns.TypeAAAA, netip.Addr{})
+        if m.Rcode != dns.RcodeSuccess || len(m.Answer) != 0 || len(m.Ns) != 1 || tr.TTL != 120 {
+            t.Fatalf("%s: want NODATA with SOA, got %+v %v", name, tr, m)
+        }
+    }
+    // LIKE wildcards in names do not match other names
+    for _, name := range []string{"x.example.com", "x_b.example.com", "c.b.example.com"} {
+        if m, _ := s.TestQuery(name, dns.TypeA, netip.Addr{}); m.Rcode != dns.RcodeNameError {
+            t.Fatalf("%s: want NXDOMAIN, got rcode %d", name, m.Rcode)
+        }
+    }
+}
+
+func TestResolve_Rewrite(t *testing.T) {
+    db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+    if err != nil { t.Fatalf("open db: %v", err) }
+    sqlDB, _ := db.DB()
+    sqlDB.SetMaxOpenConns(1)
+    if err := dbm.AutoMigrate(db); err != nil { t.Fatalf("migrate: %v", err) }
+    z := dbm.Zone{Name: "example.com.", RRSets: []dbm.RRSet{
+        {Name: "staging.example.com.", Type: "A", TTL: 300, Records: []dbm.RData{{Data: "192.0.2.1"}}},
+        {Name: "a.lab.example.com.", Type: "A", TTL: 300, Records: []dbm.RData{{Data: "192.0.2.2"}}},
+        {Name: "web.example.com.", Type: "A", TTL: 300, Records: []dbm.RData{{Data: "192.0.2.3"}}},
+    }}
+    if err := db.Create(&z).Error; err != nil { t.Fatalf("create zone: %v", err) }
+
+    cfg := &config.Config{Performance: config.PerformanceConfig{CacheSize: 10, ForwarderTimeoutSec: 1},
+        Rewrite: []config.RewriteRule{
+            {Match: "*.dev.example.com", To: "staging.example.com"},
+            {Match: "*.test.example.com", To: "*.lab.example.com"},
+            {Regex: `^(\w+)-v\d+\.example\.com$`, To: "${1}.example.com"},
+        }}
+    s, err := NewServer(cfg, db)
+    if err != nil { t.Fatalf("new server: %v", err) }
+
+    for name, want := range map[string]string{
+        "x.y.dev.example.com": "192.0.2.1",
+        "a.test.example.com":  "192.0.2.2",
+        "web-v2.example.com":  "192.0.2.3",
+    } {
+        m, tr := s.TestQuery(name, dns.TypeA, netip.Addr{})
+        if len(m.Answer) != 1 || m.Answer[0].Header().Name != name+"." || m.Answer[0].(*dns.A).A.String() != want {
+            t.Fatalf("%s: want %s under the queried name, got %v", name, want, m.Answer)
+        }
+        if m.Question[0].Name != name+"." || tr.Rewrite == "" {
+            t.Fatalf("%s: question %v, trace %+v", name, m.Question, tr)
+        }
+    }
+    // The suffix itself is not below it
+    if m, tr := s.TestQuery("dev.example.com", dns.TypeA, netip.Addr{}); tr.Rewrite != "" || m.Rcode != dns.RcodeNameError {
+        t.Fatalf("dev.example.com rewritten: %+v rcode=%d", tr, m.Rcode)
+    }
+}
+
+func TestTransfer_ACLAndTSIG(t *testing.T) {
+    db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+    if err != nil { t.Fatalf("open db: %v", err) }
+    sqlDB, _ := db.DB()
+    sqlDB.SetMaxOpenConns(1)
+    if err := dbm.AutoMigrate(db); err != nil { t.Fatalf("migrate: %v", err) }
+    z := dbm.Zone{Name: "example.com", RRSets: []dbm.RRSet{
+        {Name: "example.com.", Type: "SOA", TTL: 3600, Records: []dbm.RData{{Data: "ns1.example.com. hostmaster.example.com. 7 7200 3600 1209600 120"}}},
+        {Name: "example.com.", Type: "NS", TTL: 3600, Records: []dbm.RData{{Data: "ns1.example.com."}}},
+        {Name: "www.example.com.", Type: "A", TTL: 300, Records: []dbm.RData{{Data: "192.0.2.1"}, {Data: "192.0.2.1", Country: strPtr("DE")}, {Data: "192.0.2.2"}}},
+    }}
+    if err := db.Create(&z).Error; err != nil { t.Fatalf("create zone: %v", err) }
+
+    secret := "c2VjcmV0LXNlY3JldC1zZWNyZXQ="
+    cfg := &config.Config{Performance: config.PerformanceConfig{CacheSize: 10, ForwarderTimeoutSec: 1},
+        TSIGKeys: []config.TSIGKey{{Name: "xfr-key", Algorithm: "hmac-sha256", Secret: secret}}}
+    s, err := NewServer(cfg, db)
+    if err != nil { t.Fatalf("new server: %v", err) }
+
+    ln, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil { t.Skipf("tcp listen: %v", err) }
+    srv := &dns.Server{Listener: ln, Handler: dns.HandlerFunc(s.serveDNS), TsigSecret: s.tsigSecrets()}
+    go func() { _ = srv.ActivateAndServe() }()
+    t.Cleanup(func() { _ = srv.Shutdown() })
+    addr := ln.Addr().String()
+
+    axfr := func(key bool) ([]dns.RR, error) {
+        m := new(dns.Msg)
+        m.SetAxfr("example.com.")
+        tr := &dns.Transfer{}
+        if key {
+            m.SetTsig("xfr-key.", dns.HmacSHA256, 300, time.Now().Unix())
+            tr.TsigSecret = map[string]string{"xfr-key.": secret}
+        }
+        env, err := tr.In(m, addr)
+        if err != nil { return nil, err }
+        var out []dns.RR
+        for e := range env {
+            if e.Error != nil { return nil, e.Error }
+            out = append(out, e.RR...)
+        }
+        return out, nil
+    }
+
+    // No settings: nobody may transfer
+    if _, err := axfr(false); err == nil {
+        t.Fatal("transfer without settings should be refused")
+    }
+
+    if err := dbm.SaveZoneSettings(db, dbm.ZoneSettings{ZoneID: z.ID, AllowTransfer: []string{"127.0.0.0/8"}}); err != nil {
+        t.Fatalf("save settings: %v", err)
+    }
+    rrs, err := axfr(false)
+    if err != nil { t.Fatalf("axfr: %v", err) }
+    // SOA, NS, two distinct A records, SOA
+    if len(rrs) != 5 || rrs[0].Header().Rrtype != dns.TypeSOA || rrs[4].Header().Rrtype != dns.TypeSOA {
+        t.Fatalf("unexpected transfer: %v", rrs)
+    }
+
+    if err := dbm.SaveZoneSettings(db, dbm.ZoneSettings{ZoneID: z.ID, AllowTransfer: []string{"127.0.0.0/8"}, TSIGKey: "xfr-key"}); err != nil {
+        t.Fatalf("save settings: %v", err)
+    }
+    if _, err := axfr(false); err == nil {
+        t.Fatal("unsigned transfer should be refused when a key is set")
+    }
+    if rrs, err := axfr(true); err != nil || len(rrs) != 5 {
+        t.Fatalf("signed axfr: %v %v", err, rrs)
+    }
+
+    if err := dbm.SaveZoneSettings(db, dbm.ZoneSettings{ZoneID: z.ID, AllowTransfer: []string{"192.0.2.0/24"}}); err != nil {
+        t.Fatalf("save settings: %v", err)
+    }
+    if _, err := axfr(false); err == nil {
+        t.Fatal("client outside allow_transfer should be refused")
+    }
+}
+
+func TestNotify_SendsOnSerialChange(t *testing.T) {
+    db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+    if err != nil { t.Fatalf("open db: %v", err) }
+    sqlDB, _ := db.DB()
+    sqlDB.SetMaxOpenConns(1)
+    if err := dbm.AutoMigrate(db); err != nil { t.Fatalf("migrate: %v", err) }
+    z := dbm.Zone{Name: "example.com", Serial: 7}
+    if err := db.Create(&z).Error; err != nil { t.Fatalf("create zone: %v", err) }
+
+    got := make(chan string, 4)
+    secondary := func(w dns.ResponseWriter, r *dns.Msg) {
+        got <- fmt.Sprintf("%s %s", dns.OpcodeToString[r.Opcode], r.Question[0].Name)
+        m := new(dns.Msg)
+        m.SetReply(r)
+        _ = w.WriteMsg(m)
+    }
+    slave := startUpstream(t, secondary)
+    also := startUpstream(t, secondary)
+    if err := dbm.SaveZoneSettings(db, dbm.ZoneSettings{ZoneID: z.ID, AlsoNotify: []string{also}}); err != nil {
+        t.Fatalf("save settings: %v", err)
+    }
+
+    cfg := &config.Config{Performance: config.PerformanceConfig{CacheSize: 10, ForwarderTimeoutSec: 1},
+        Replication: config.ReplicationConfig{Mode: "master", Notify: []string{slave}}}
+    s, err := NewServer(cfg, db)
+    if err != nil { t.Fatalf("new server: %v", err) }
+
+    // The first check only records the serials
+    serials, err := s.notifyChanged(t.Context(), nil)
+    if err != nil || serials[z.ID] != 7 { t.Fatalf("serials %v: %v", serials, err) }
+    if serials, err = s.notifyChanged(t.Context(), serials); err != nil { t.Fatal(err) }
+    select {
+    case n := <-got:
+        t.Fatalf("unexpected %s without a change", n)
+    case <-time.After(100 * time.Millisecond):
+    }
+
+    if err := db.Model(&z).Update("serial", 8).Error; err != nil { t.Fatal(err) }
+    if _, err := s.notifyChanged(t.Context(), serials); err != nil { t.Fatal(err) }
+    for i := 0; i < 2; i++ {
+        select {
+        case n := <-got:
+            if n != "NOTIFY example.com." { t.Fatalf("got %q", n) }
+        case <-time.After(2 * time.Second):
+            t.Fatalf("only %d of 2 NOTIFYs arrived", i)
+        }
+    }
+}
+
+func TestNotify_TriggersSyncOnSlave(t *testing.T) {
+    cfg := &config.Config{Performance: config.PerformanceConfig{CacheSize: 10, ForwarderTimeoutSec: 1},
+        Replication: config.ReplicationConfig{Mode: "slave", MasterURL: "http://127.0.0.1:8080"}}
+    s, err := NewServer(cfg, nil)
+    if err != nil { t.Fatalf("new server: %v", err) }
+    addr := startUpstream(t, dns.HandlerFunc(s.serveDNS))
+
+    notify := func() int {
+        m := new(dns.Msg)
+        m.SetNotify("example.com.")
+        in, _, err := (&dns.Client{Timeout: time.Second}).Exchange(m, addr)
+        if err != nil { t.Fatalf("notify: %v", err) }
+        return in.Rcode
+    }
+
+    // Without a sync trigger (not a slave) NOTIFYs are refused
+    if rc := notify(); rc != dns.RcodeRefused { t.Fatalf("rcode %s, want REFUSED", dns.RcodeToString[rc]) }
+
+    var synced atomic.Int32
+    s.SetSyncTrigger(func() { synced.Add(1) })
+    if rc := notify(); rc != dns.RcodeSuccess || synced.Load() != 1 {
+        t.Fatalf("from the master: rcode %s, %d syncs", dns.RcodeToString[rc], synced.Load())
+    }
+
+    cfg.Replication.NotifyFrom = []string{"192.0.2.0/24"}
+    if rc := notify(); rc != dns.RcodeRefused || synced.Load() != 1 {
+        t.Fatalf("outside notify_from: rcode %s, %d syncs", dns.RcodeToString[rc], synced.Load())
+    }
+}
+
+func TestCacheFile_SaveAndLoad(t *testing.T) {
+    s := &Server{cache: cache.New(10)}
+    m := new(dns.Msg)
+    m.SetQuestion("www.example.com.", dns.TypeA)
+    rr, _ := dns.NewRR("www.example.com. 300 IN A 192.0.2.1")
+    m.Answer = []dns.RR{rr}
+    s.cache.Set("www.example.com.|1|", m, time.Minute)
+    s.cache.Set("old.example.com.|1|", m.Copy(), -time.Second)
+
+    path := filepath.Join(t.TempDir(), "cache.snap")
+    if n, err := s.SaveCache(path); err != nil || n != 1 {
+        t.Fatalf("save: n=%d err=%v", n, err)
+    }
+
+    r := &Server{cache: cache.New(10)}
+    if n, err := r.LoadCache(path); err != nil || n != 1 {
+        t.Fatalf("load: n=%d err=%v", n, err)
+    }
+    v, ok := r.cache.Get("www.example.com.|1|")
+    got, _ := v.(*dns.Msg)
+    if !ok || got == nil || len(got.Answer) != 1 || got.Answer[0].String() != rr.String() {
+        t.Fatalf("restored entry: %v %v", v, ok)
+    }
+
+    if n, err := r.LoadCache(filepath.Join(t.TempDir(), "missing")); err != nil || n != 0 {
+        t.Fatalf("missing file: n=%d err=%v", n, err)
+    }
+    if err := os.WriteFile(path, []byte("garbage"), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := r.LoadCache(path); err == nil {
+        t.Fatal("expected an error for a corrupt snapshot")
+    }
+}
+
+func TestStart_PreopenedSocketsAndPing(t *testing.T) {
+    pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+    if err != nil { t.Skipf("udp listen: %v", err) }
+    ln, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil { t.Skipf("tcp listen: %v", err) }
+    s := &Server{cfg: &config.Config{}, cache: cache.New(10)}
+    s.SetListeners(pc, ln)
+    if err := s.Start(); err != nil { t.Fatalf("start: %v", err) }
+    t.Cleanup(func() { _ = s.Shutdown() })
+
+    if err := s.Ping(); err != nil {
+        t.Fatalf("ping: %v", err)
+    }
+    if s.udpServer.PacketConn.LocalAddr().String() != pc.LocalAddr().String() {
+        t.Fatalf("server not using the given socket: %s", s.udpServer.PacketConn.LocalAddr())
+    }
+}
+
+func TestStart_InstancesKeepTheirOwnHandler(t *testing.T) {
+    var servers []*Server
+    for _, id := range []string{"fra-1", "ams-1"} {
+        s := &Server{cfg: &config.Config{Listen: "127.0.0.1:0", NodeID: id}, cache: cache.New(10)}
+        if err := s.Start(); err != nil { t.Fatalf("start %s: %v", id, err) }
+        t.Cleanup(func() { _ = s.Shutdown() })
+        servers = append(servers, s)
+    }
+    for _, s := range servers {
+        pc, _ := s.Sockets()
+        m := new(dns.Msg)
+        m.SetQuestion("id.server.", dns.TypeTXT)
+        m.Question[0].Qclass = dns.ClassCHAOS
+        resp, err := dns.Exchange(m, pc.LocalAddr().String())
+        if err != nil { t.Fatalf("%s: %v", s.cfg.NodeID, err) }
+        if len(resp.Answer) != 1 || resp.Answer[0].(*dns.TXT).Txt[0] != s.cfg.NodeID {
+            t.Fatalf("%s answered %v", s.cfg.NodeID, resp.Answer)
+        }
+    }
+}
+
+func TestStart_BindError(t *testing.T) {
+    ln, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil { t.Skipf("tcp listen: %v", err) }
+    defer ln.Close()
+    s := &Server{cfg: &config.Config{Listen: ln.Addr().String()}, cache: cache.New(10)}
+    if err := s.Start(); err == nil {
+        _ = s.Shutdown()
+        t.Fatal("expected a bind error for a port in use")
+    }
+    if pc, _ := s.Sockets(); pc != nil {
+        t.Fatal("server running after a bind error")
+    }
+}
+
+func TestRestartListeners(t *testing.T) {
+    pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+    if err != nil { t.Skipf("udp listen: %v", err) }
+    ln, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil { t.Skipf("tcp listen: %v", err) }
+    s := &Server{cfg: &config.Config{}, cache: cache.New(10)}
+    s.SetListeners(pc, ln)
+    if err := s.Start(); err != nil { t.Fatalf("start: %v", err) }
+    t.Cleanup(func() { _ = s.Shutdown() })
+
+    // An idle TCP connection holds a goroutine until the restart ends it
+    conn, err := net.Dial("tcp", ln.Addr().String())
+    if err != nil { t.Fatalf("dial: %v", err) }
+    defer conn.Close()
+    time.Sleep(50 * time.Millisecond)
+
+    if err := s.RestartListeners(); err != nil {
+        t.Fatalf("restart: %v", err)
+    }
+    _ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+    if _, err := conn.Read(make([]byte, 1)); err == nil || errors.Is(err, os.ErrDeadlineExceeded) {
+        t.Fatalf("old tcp connection not closed: %v", err)
+    }
+    if _, err := s.Probe(); err != nil {
+        t.Fatalf("probe after restart: %v", err)
+    }
+    if got, _ := s.Sockets(); got.LocalAddr().String() != pc.LocalAddr().String() {
+        t.Fatalf("restarted on another socket: %s", got.LocalAddr())
+    }
+}
+
+func TestProbe_HealthZone(t *testing.T) {
+    s := &Server{cfg: &config.Config{}, cache: cache.New(10)}
+    if _, err := s.Probe(); err == nil {
+        t.Fatal("probe of a stopped server should fail")
+    }
+    pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+    if err != nil { t.Skipf("udp listen: %v", err) }
+    ln, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil { t.Skipf("tcp listen: %v", err) }
+    s.SetListeners(pc, ln)
+    if err := s.Start(); err != nil { t.Fatalf("start: %v", err) }
+    t.Cleanup(func() { _ = s.Shutdown() })
+
+    rtts, err := s.Probe()
+    if err != nil {
+        t.Fatalf("probe: %v", err)
+    }
+    if _, ok := rtts["udp"]; !ok {
+        t.Fatalf("no udp round trip: %v", rtts)
+    }
+    if _, ok := rtts["tcp"]; !ok {
+        t.Fatalf("no tcp round trip: %v", rtts)
+    }
+    if got := loopbackAddr(&net.UDPAddr{IP: net.IPv6unspecified, Port: 53}); got != "127.0.0.1:53" {
+        t.Fatalf("wildcard listener dialed as %s", got)
+    }
+}
@@ -0,0 +1,86 @@
+package dns
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"namedot/internal/geoip"
+)
+
+// Timing splits the time spent resolving a query. Whatever is not in one of
+// the parts went to the cache, hosts table, blocklists and building the
+// response.
+type Timing struct {
+	Geo      time.Duration // GeoIP lookup of the client
+	DB       time.Duration // local zone lookups: zone list, rrsets, NODATA and extra sections
+	Upstream time.Duration // forwarder, stub zone servers or recursion
+}
+
+// SlowQuery is a lookup kept by the slow query log.
+type SlowQuery struct {
+	Time   time.Time
+	Name   string
+	Type   string
+	Client string // address the geo decision was made for (ECS or transport)
+	Source string // as in QueryTrace
+	Zone   string
+	Rule   string // geo rule that selected the records
+	Geo    geoip.Info
+	Rcode  string
+	Total  time.Duration
+	Timing Timing
+}
+
+// slowLog is a ring of the most recent lookups that took at least
+// threshold.
+type slowLog struct {
+	threshold time.Duration
+	mu        sync.Mutex
+	ring      []SlowQuery
+	next      int
+	full      bool
+}
+
+func newSlowLog(size int, threshold time.Duration) *slowLog {
+	if size <= 0 {
+		size = 100
+	}
+	return &slowLog{threshold: threshold, ring: make([]SlowQuery, size)}
+}
+
+// add keeps q if it was slow enough, dropping the oldest entry when full.
+func (l *slowLog) add(q SlowQuery) {
+	if q.Total < l.threshold {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ring[l.next] = q
+	l.next = (l.next + 1) % len(l.ring)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// list returns the kept lookups, slowest first.
+func (l *slowLog) list() []SlowQuery {
+	l.mu.Lock()
+	n := l.next
+	if l.full {
+		n = len(l.ring)
+	}
+	out := append([]SlowQuery(nil), l.ring[:n]...)
+	l.mu.Unlock()
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Total > out[j].Total })
+	return out
+}
+
+// SlowQueries returns the slowest recent lookups, slowest first, or nil
+// unless slow_queries.enabled is set.
+func (s *Server) SlowQueries() []SlowQuery {
+	if s.slow == nil {
+		return nil
+	}
+	return s.slow.list()
+}
@@ -0,0 +1,78 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"namedot/internal/config"
+)
+
+// stubZone is a zone whose authoritative servers are queried directly.
+type stubZone struct {
+	name  string
+	addrs []string
+	ecs   config.ECSConfig
+}
+
+// newStubZones normalizes the configured stub zones, deepest first so the
+// most specific zone wins.
+func newStubZones(cfg []config.StubZone) []stubZone {
+	out := make([]stubZone, 0, len(cfg))
+	for _, z := range cfg {
+		sz := stubZone{name: dns.Fqdn(strings.ToLower(z.Zone)), ecs: z.ECS}
+		for _, srv := range z.Servers {
+			if net.ParseIP(srv) != nil {
+				srv = net.JoinHostPort(srv, "53")
+			}
+			sz.addrs = append(sz.addrs, srv)
+		}
+		out = append(out, sz)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return dns.CountLabel(out[i].name) > dns.CountLabel(out[j].name)
+	})
+	return out
+}
+
+// stubFor returns the stub zone that holds name, if any.
+func (s *Server) stubFor(name string) *stubZone {
+	for i := range s.stubs {
+		if dns.IsSubDomain(s.stubs[i].name, name) {
+			return &s.stubs[i]
+		}
+	}
+	return nil
+}
+
+// queryStub asks the servers of z for q in turn, without recursion, until
+// one gives an answer or a negative answer. Truncated replies are retried
+// over TCP. ecs, if not nil, is sent along as the client subnet.
+func (s *Server) queryStub(z *stubZone, q dns.Question, ecs *dns.EDNS0_SUBNET) (*dns.Msg, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(q.Name), q.Qtype)
+	m.RecursionDesired = false
+	s.withECS(m, ecs)
+	err := errors.New("no servers")
+	for _, addr := range z.addrs {
+		in, xerr := exchange(s.resolver, m, addr)
+		if xerr == nil && in.Truncated {
+			in, xerr = exchange(s.tcpResolver, m, addr)
+		}
+		switch {
+		case xerr != nil:
+			err = xerr
+		case in.Rcode != dns.RcodeSuccess && in.Rcode != dns.RcodeNameError:
+			err = fmt.Errorf("%s answered %s", addr, dns.RcodeToString[in.Rcode])
+		default:
+			return in, nil
+		}
+		log.Printf("DNS stub %s: %s: %v", z.name, addr, err)
+	}
+	return nil, err
+}
@@ -0,0 +1,150 @@
+package dns
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	dbm "namedot/internal/db"
+)
+
+// xfrChunk is the number of records sent per AXFR message.
+const xfrChunk = 100
+
+// tsigSecrets maps the configured TSIG key names to their secrets, in the
+// form dns.Server expects.
+func (s *Server) tsigSecrets() map[string]string {
+	if len(s.cfg.TSIGKeys) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(s.cfg.TSIGKeys))
+	for _, k := range s.cfg.TSIGKeys {
+		out[dns.Fqdn(strings.ToLower(k.Name))] = k.Secret
+	}
+	return out
+}
+
+// remoteIP returns the transport address of a client.
+func remoteIP(addr net.Addr) (netip.Addr, bool) {
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		ip = a.IP
+	case *net.TCPAddr:
+		ip = a.IP
+	}
+	a, ok := netip.AddrFromSlice(ip)
+	return a.Unmap(), ok
+}
+
+// transfer answers AXFR, and IXFR with a full transfer, for a local zone
+// when its settings allow the client: the address must be in
+// allow_transfer and, if the zone has a TSIG key, the request must be
+// signed with it. Transfers are only served over TCP.
+func (s *Server) transfer(w dns.ResponseWriter, r *dns.Msg) {
+	q := r.Question[0]
+	name := strings.ToLower(dns.Fqdn(q.Name))
+	refuse := func(why string) {
+		log.Printf("DNS XFR refused zone=%s type=%s from=%s: %s", name, dns.TypeToString[q.Qtype], w.RemoteAddr(), why)
+		m := new(dns.Msg)
+		m.SetReply(r)
+		if deny(m, s.cfg.Deny.Transfer) {
+			return
+		}
+		_ = w.WriteMsg(m)
+	}
+	if _, tcp := w.RemoteAddr().(*net.TCPAddr); !tcp {
+		refuse("not over TCP")
+		return
+	}
+	zone, err := s.findZone(name)
+	if err != nil || zone == nil || dns.Fqdn(strings.ToLower(zone.Name)) != name {
+		refuse("not a local zone")
+		return
+	}
+	set, err := dbm.GetZoneSettings(s.db, zone.ID)
+	if err != nil {
+		refuse(err.Error())
+		return
+	}
+	if ip, ok := remoteIP(w.RemoteAddr()); !ok || !set.AllowsTransfer(ip) {
+		refuse("client not in allow_transfer")
+		return
+	}
+	if set.TSIGKey != "" {
+		t := r.IsTsig()
+		if t == nil || !strings.EqualFold(t.Hdr.Name, dns.Fqdn(set.TSIGKey)) || w.TsigStatus() != nil {
+			refuse("TSIG key " + set.TSIGKey + " required")
+			return
+		}
+	}
+	rrs, err := s.zoneRecords(zone)
+	if err != nil {
+		refuse(err.Error())
+		return
+	}
+
+	ch := make(chan *dns.Envelope)
+	go func() {
+		for len(rrs) > 0 {
+			n := min(len(rrs), xfrChunk)
+			ch <- &dns.Envelope{RR: rrs[:n]}
+			rrs = rrs[n:]
+		}
+		close(ch)
+	}()
+	tr := new(dns.Transfer)
+	if err := tr.Out(w, r, ch); err != nil {
+		log.Printf("DNS XFR zone=%s to=%s: %v", name, w.RemoteAddr(), err)
+	}
+	for range ch {
+		// drain after a write error so the sender can finish
+	}
+	log.Printf("DNS XFR zone=%s type=%s to=%s", name, dns.TypeToString[q.Qtype], w.RemoteAddr())
+	_ = w.Close()
+}
+
+// zoneRecords returns the zone contents in AXFR order: the SOA, every other
+// record, and the SOA again. Geo variants of a record are sent once and
+// disabled records not at all.
+func (s *Server) zoneRecords(zone *dbm.Zone) ([]dns.RR, error) {
+	var sets []dbm.RRSet
+	if err := s.db.Preload("Records", "disabled = ?", false).Where("zone_id = ?", zone.ID).Order("name, type").Find(&sets).Error; err != nil {
+		return nil, err
+	}
+	apex := dns.Fqdn(strings.ToLower(zone.Name))
+	var soa dns.RR
+	var out []dns.RR
+	for _, set := range sets {
+		seen := map[string]bool{}
+		for _, rec := range set.Records {
+			data := strings.TrimSpace(rec.Data)
+			if seen[data] {
+				continue
+			}
+			seen[data] = true
+			if set.Type == "CNAME" && data == "@" {
+				data = apex
+			}
+			rr, err := dns.NewRR(fmt.Sprintf("%s %d %s %s", set.Name, set.TTL, set.Type, data))
+			if err != nil || rr == nil {
+				continue
+			}
+			if set.Type == "SOA" {
+				if soa == nil && set.Name == apex {
+					soa = rr
+				}
+				continue
+			}
+			out = append(out, rr)
+		}
+	}
+	if soa == nil {
+		return nil, fmt.Errorf("zone has no SOA")
+	}
+	return append(append([]dns.RR{soa}, out...), soa), nil
+}
@@ -0,0 +1,88 @@
+package dns
+
+import (
+	"math/rand/v2"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// clampTTL bounds ttl to performance.min_ttl and max_ttl.
+func (s *Server) clampTTL(ttl uint32) uint32 {
+	p := s.cfg.Performance
+	if ttl < p.MinTTL {
+		ttl = p.MinTTL
+	}
+	if p.MaxTTL > 0 && ttl > p.MaxTTL {
+		ttl = p.MaxTTL
+	}
+	return ttl
+}
+
+// clampRRs rewrites the TTL of every record in rrs except OPT.
+func (s *Server) clampRRs(rrs []dns.RR) {
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == dns.TypeOPT {
+			continue
+		}
+		rr.Header().Ttl = s.clampTTL(rr.Header().Ttl)
+	}
+}
+
+// forwardedTTL clamps the record TTLs of the upstream answer m and returns how
+// long it may be cached: the lowest answer TTL for a positive answer, and the
+// SOA negative TTL (RFC 2308) for NXDOMAIN, NODATA and errors.
+func (s *Server) forwardedTTL(m *dns.Msg) uint32 {
+	s.clampRRs(m.Answer)
+	s.clampRRs(m.Ns)
+	s.clampRRs(m.Extra)
+
+	if m.Rcode == dns.RcodeSuccess && len(m.Answer) > 0 {
+		ttl := m.Answer[0].Header().Ttl
+		for _, rr := range m.Answer[1:] {
+			if rr.Header().Ttl < ttl {
+				ttl = rr.Header().Ttl
+			}
+		}
+		return ttl
+	}
+	for _, rr := range m.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return s.clampTTL(min(soa.Hdr.Ttl, soa.Minttl))
+		}
+	}
+	return s.clampTTL(s.cfg.NegativeCacheTTL())
+}
+
+// clampLocal applies the TTL bounds to a local answer when
+// performance.clamp_local is set.
+func (s *Server) clampLocal(answers []dns.RR, ttl uint32) uint32 {
+	if !s.cfg.Performance.ClampLocal {
+		return ttl
+	}
+	s.clampRRs(answers)
+	return s.clampTTL(ttl)
+}
+
+// decayTTLs lowers the TTLs of the cached answer m by its age in the cache,
+// so downstream resolvers see them count down rather than start over. With
+// performance.cache_ttl_jitter they are lowered by up to that percentage
+// more, at random per answer, so the clients of one answer do not all come
+// back in the same second.
+func (s *Server) decayTTLs(m *dns.Msg, age time.Duration) {
+	elapsed := uint32(age / time.Second)
+	jitter := 0.0
+	if s.cfg != nil && s.cfg.Performance.CacheTTLJitter > 0 {
+		jitter = rand.Float64() * float64(s.cfg.Performance.CacheTTLJitter) / 100
+	}
+	for _, rrs := range [][]dns.RR{m.Answer, m.Ns, m.Extra} {
+		for _, rr := range rrs {
+			h := rr.Header()
+			if h.Rrtype == dns.TypeOPT {
+				continue
+			}
+			ttl := h.Ttl - min(h.Ttl, elapsed)
+			h.Ttl = ttl - uint32(float64(ttl)*jitter)
+		}
+	}
+}
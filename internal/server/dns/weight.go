@@ -0,0 +1,44 @@
+package dns
+
+import (
+	"math/rand/v2"
+
+	dbm "namedot/internal/db"
+)
+
+// weightRand returns a random number in [0, n); tests replace it.
+var weightRand = rand.Uint64N
+
+// pickWeighted returns one record of recs, chosen at random in proportion
+// to the weights, when any of them has a weight; records without one count
+// as weight 1 and weight 0 is never chosen. recs is returned as is when
+// none is weighted or all weights are 0.
+func pickWeighted(recs []dbm.RData) []dbm.RData {
+	var total uint64
+	weighted := false
+	for _, r := range recs {
+		if r.Weight != nil {
+			weighted = true
+		}
+		total += recordWeight(r)
+	}
+	if !weighted || total == 0 {
+		return recs
+	}
+	n := weightRand(total)
+	for i, r := range recs {
+		w := recordWeight(r)
+		if n < w {
+			return recs[i : i+1]
+		}
+		n -= w
+	}
+	return recs[len(recs)-1:]
+}
+
+func recordWeight(r dbm.RData) uint64 {
+	if r.Weight == nil {
+		return 1
+	}
+	return uint64(*r.Weight)
+}
@@ -0,0 +1,189 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+	"gorm.io/gorm"
+
+	dbm "namedot/internal/db"
+)
+
+// acmeTTL is the TTL of the TXT RRSets created for DNS-01 challenges.
+const acmeTTL = 60
+
+// challengeRequest is cert-manager's webhook ChallengeRequest
+// (webhook.acme.cert-manager.io/v1alpha1); fields namedot does not use are
+// left out.
+type challengeRequest struct {
+	UID          string `json:"uid"`
+	Action       string `json:"action"` // Present or CleanUp
+	Type         string `json:"type"`   // dns-01
+	DNSName      string `json:"dnsName"`
+	Key          string `json:"key"`
+	ResolvedFQDN string `json:"resolvedFQDN"`
+	ResolvedZone string `json:"resolvedZone"`
+}
+
+type challengeStatus struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+}
+
+type challengeResponse struct {
+	UID     string           `json:"uid"`
+	Success bool             `json:"success"`
+	Status  *challengeStatus `json:"status,omitempty"`
+}
+
+// challengePayload is the envelope cert-manager sends to and expects back
+// from a webhook solver.
+type challengePayload struct {
+	APIVersion string             `json:"apiVersion,omitempty"`
+	Kind       string             `json:"kind,omitempty"`
+	Request    *challengeRequest  `json:"request,omitempty"`
+	Response   *challengeResponse `json:"response,omitempty"`
+}
+
+// acmeChallenge solves DNS-01 challenges for cert-manager: Present adds the
+// key as a TXT record at resolvedFQDN, CleanUp removes that record again.
+// It accepts a ChallengePayload or a bare ChallengeRequest and answers with
+// a ChallengePayload; failures also set the HTTP status.
+func (s *Server) acmeChallenge(c *gin.Context) {
+	var in struct {
+		challengePayload
+		challengeRequest
+	}
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	p := in.challengePayload
+	if p.Request == nil {
+		p.Request = &in.challengeRequest
+	}
+	req := p.Request
+	fail := func(code int, format string, args ...any) {
+		msg := fmt.Sprintf(format, args...)
+		c.JSON(code, challengePayload{APIVersion: p.APIVersion, Kind: p.Kind, Response: &challengeResponse{
+			UID:    req.UID,
+			Status: &challengeStatus{Status: "Failure", Message: msg, Code: code},
+		}})
+	}
+
+	if req.Type != "" && !strings.EqualFold(req.Type, "dns-01") {
+		fail(http.StatusBadRequest, "unsupported challenge type %q", req.Type)
+		return
+	}
+	fqdn := req.ResolvedFQDN
+	if fqdn == "" && req.DNSName != "" {
+		fqdn = "_acme-challenge." + strings.TrimPrefix(req.DNSName, "*.")
+	}
+	fqdn = dns.Fqdn(strings.ToLower(strings.TrimSpace(fqdn)))
+	if _, ok := dns.IsDomainName(fqdn); !ok || fqdn == "." || req.Key == "" || strings.ContainsAny(req.Key, "\" \\") {
+		fail(http.StatusBadRequest, "resolvedFQDN and key are required")
+		return
+	}
+	zone, err := dbm.ZoneForName(s.db, fqdn)
+	if err != nil {
+		fail(http.StatusInternalServerError, "%v", err)
+		return
+	}
+	if zone == nil {
+		fail(http.StatusNotFound, "no zone for %s", fqdn)
+		return
+	}
+	if !zoneAllowed(c, zone.Name) {
+		fail(http.StatusForbidden, "token is not allowed for zone %s", zone.Name)
+		return
+	}
+	if err := dbm.CheckZoneUnlocked(s.db, zone.ID); err != nil {
+		fail(http.StatusLocked, "%v", err)
+		return
+	}
+
+	data := `"` + req.Key + `"`
+	var changed bool
+	switch req.Action {
+	case "Present":
+		changed, err = s.presentChallenge(c, *zone, fqdn, data)
+	case "CleanUp":
+		changed, err = s.cleanUpChallenge(c, *zone, fqdn, data)
+	default:
+		fail(http.StatusBadRequest, "unknown action %q", req.Action)
+		return
+	}
+	if err != nil {
+		fail(http.StatusInternalServerError, "%v", err)
+		return
+	}
+	if changed {
+		dbm.TouchZone(s.db, *zone, s.cfg)
+		// Invalidate DNS cache after zone record change
+		if s.dnsServer != nil {
+			s.dnsServer.InvalidateZoneCache()
+		}
+	}
+	c.JSON(http.StatusOK, challengePayload{APIVersion: p.APIVersion, Kind: p.Kind, Response: &challengeResponse{UID: req.UID, Success: true}})
+}
+
+// presentChallenge adds the TXT record; presenting a key twice is a no-op.
+func (s *Server) presentChallenge(c *gin.Context, zone dbm.Zone, fqdn, data string) (bool, error) {
+	var set dbm.RRSet
+	err := s.dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("zone_id = ? AND name = ? AND type = ?", zone.ID, fqdn, "TXT").Limit(1).Find(&set).Error; err != nil {
+			return err
+		}
+		if set.ID == 0 {
+			set = dbm.RRSet{ZoneID: zone.ID, Name: fqdn, Type: "TXT", TTL: acmeTTL}
+			if err := tx.Create(&set).Error; err != nil {
+				return err
+			}
+		}
+		rec := dbm.RData{RRSetID: set.ID, Data: data}
+		if dbm.HasDuplicateRecord(tx, rec) {
+			set.ID = 0
+			return nil
+		}
+		return tx.Create(&rec).Error
+	})
+	if err != nil || set.ID == 0 {
+		return false, err
+	}
+	s.audit(c, dbm.AuditRecordCreate, zone, set.ID, fmt.Sprintf("acme %s TXT %s", fqdn, data))
+	return true, nil
+}
+
+// cleanUpChallenge removes the TXT record of the key, and the RRSet when it
+// is left empty; other keys for the same name stay.
+func (s *Server) cleanUpChallenge(c *gin.Context, zone dbm.Zone, fqdn, data string) (bool, error) {
+	var set dbm.RRSet
+	if err := s.db.Where("zone_id = ? AND name = ? AND type = ?", zone.ID, fqdn, "TXT").Limit(1).Find(&set).Error; err != nil || set.ID == 0 {
+		return false, err
+	}
+	var removed int64
+	err := s.dbFor(c).Transaction(func(tx *gorm.DB) error {
+		res := tx.Unscoped().Where("rr_set_id = ? AND dedupe_key = ?", set.ID, dbm.RData{Data: data}.Identity()).Delete(&dbm.RData{})
+		if res.Error != nil {
+			return res.Error
+		}
+		removed = res.RowsAffected
+		var left int64
+		if err := tx.Model(&dbm.RData{}).Where("rr_set_id = ?", set.ID).Count(&left).Error; err != nil {
+			return err
+		}
+		if left == 0 {
+			return tx.Unscoped().Delete(&dbm.RRSet{}, set.ID).Error
+		}
+		return nil
+	})
+	if err != nil || removed == 0 {
+		return false, err
+	}
+	s.audit(c, dbm.AuditRecordDelete, zone, set.ID, fmt.Sprintf("acme %s TXT %s", fqdn, data))
+	return true, nil
+}
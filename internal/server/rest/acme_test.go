@@ -0,0 +1,104 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+
+	"namedot/internal/config"
+	"namedot/internal/db"
+)
+
+func TestACME_PresentAndCleanUp(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hash, err := bcrypt.GenerateFromPassword([]byte("certs-token"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("hash: %v", err)
+	}
+	server, gormDB, _ := setupZoneTestServer(t, &config.Config{
+		APIToken:  "maintoken",
+		APITokens: []config.ScopedToken{{Name: "cert-manager", TokenHash: string(hash), Zones: []string{"acme.test"}}},
+	})
+	for _, name := range []string{"acme.test.", "sub.acme.test.", "other.test."} {
+		if err := gormDB.Create(&db.Zone{Name: name}).Error; err != nil {
+			t.Fatalf("create zone: %v", err)
+		}
+	}
+
+	do := func(token, body string) (*httptest.ResponseRecorder, challengePayload) {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/acme/dns01", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		var p challengePayload
+		_ = json.Unmarshal(w.Body.Bytes(), &p)
+		return w, p
+	}
+	payload := func(action, fqdn, key string) string {
+		return `{"apiVersion":"webhook.acme.cert-manager.io/v1alpha1","kind":"ChallengePayload","request":{"uid":"u1","action":"` + action +
+			`","type":"dns-01","dnsName":"acme.test","key":"` + key + `","resolvedFQDN":"` + fqdn + `","resolvedZone":"acme.test."}}`
+	}
+	txt := func(name string) []string {
+		var set db.RRSet
+		gormDB.Preload("Records").Where("name = ? AND type = ?", name, "TXT").Limit(1).Find(&set)
+		var out []string
+		for _, r := range set.Records {
+			out = append(out, r.Data)
+		}
+		return out
+	}
+
+	// A wildcard and an apex certificate ask for two keys at the same name
+	for _, key := range []string{"key-1", "key-2", "key-1"} {
+		w, p := do("certs-token", payload("Present", "_acme-challenge.acme.test.", key))
+		if w.Code != http.StatusOK || p.Response == nil || !p.Response.Success || p.Response.UID != "u1" || p.Kind != "ChallengePayload" {
+			t.Fatalf("present %s: %d %s", key, w.Code, w.Body.String())
+		}
+	}
+	if got := txt("_acme-challenge.acme.test."); len(got) != 2 || got[0] != `"key-1"` || got[1] != `"key-2"` {
+		t.Fatalf("TXT after present: %v", got)
+	}
+
+	// The most specific zone gets the record
+	if w, _ := do("maintoken", `{"action":"Present","key":"key-3","resolvedFQDN":"_acme-challenge.www.sub.acme.test"}`); w.Code != http.StatusOK {
+		t.Fatalf("bare request: %d %s", w.Code, w.Body.String())
+	}
+	var set db.RRSet
+	gormDB.Where("name = ?", "_acme-challenge.www.sub.acme.test.").First(&set)
+	var sub db.Zone
+	gormDB.Where("name = ?", "sub.acme.test.").First(&sub)
+	if set.ZoneID != sub.ID {
+		t.Errorf("record in zone %d, want %d", set.ZoneID, sub.ID)
+	}
+
+	if w, p := do("certs-token", payload("Present", "_acme-challenge.other.test.", "x")); w.Code != http.StatusForbidden || p.Response == nil || p.Response.Success {
+		t.Errorf("other zone: %d %s", w.Code, w.Body.String())
+	}
+	if w, _ := do("maintoken", payload("Present", "_acme-challenge.missing.example.", "x")); w.Code != http.StatusNotFound {
+		t.Errorf("no zone: %d", w.Code)
+	}
+
+	if w, _ := do("certs-token", payload("CleanUp", "_acme-challenge.acme.test.", "key-1")); w.Code != http.StatusOK {
+		t.Fatalf("cleanup: %d %s", w.Code, w.Body.String())
+	}
+	if got := txt("_acme-challenge.acme.test."); len(got) != 1 || got[0] != `"key-2"` {
+		t.Fatalf("TXT after first cleanup: %v", got)
+	}
+	do("certs-token", payload("CleanUp", "_acme-challenge.acme.test.", "key-2"))
+	var n int64
+	gormDB.Model(&db.RRSet{}).Where("name = ?", "_acme-challenge.acme.test.").Count(&n)
+	if n != 0 {
+		t.Errorf("empty TXT rrset left behind")
+	}
+	// Cleaning up twice succeeds
+	if w, p := do("certs-token", payload("CleanUp", "_acme-challenge.acme.test.", "key-2")); w.Code != http.StatusOK || !p.Response.Success {
+		t.Errorf("second cleanup: %d %s", w.Code, w.Body.String())
+	}
+}
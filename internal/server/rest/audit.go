@@ -0,0 +1,25 @@
+package rest
+
+import (
+	"log"
+
+	"github.com/gin-gonic/gin"
+
+	dbm "namedot/internal/db"
+)
+
+// audit records a change made with an API token. Failures are logged only:
+// the change itself has already been made.
+func (s *Server) audit(c *gin.Context, action string, z dbm.Zone, rrsetID uint, summary string) {
+	e := dbm.AuditEntry{
+		Actor:    actor(c),
+		Action:   action,
+		ZoneID:   z.ID,
+		ZoneName: z.Name,
+		RRSetID:  rrsetID,
+		Summary:  summary,
+	}
+	if err := dbm.RecordAudit(s.db, e); err != nil {
+		log.Printf("rest: audit %s: %v", action, err)
+	}
+}
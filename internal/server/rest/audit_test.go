@@ -0,0 +1,65 @@
+package rest
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/config"
+	"namedot/internal/db"
+)
+
+func TestAudit_RecordsAPIChanges(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{APIToken: "testtoken"}
+	server, gormDB, _ := setupZoneTestServer(t, cfg)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer testtoken")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		return w
+	}
+
+	zone := db.Zone{Name: "audit.test."}
+	if err := gormDB.Create(&zone).Error; err != nil {
+		t.Fatalf("create zone: %v", err)
+	}
+	id := strconv.Itoa(int(zone.ID))
+
+	if w := do("POST", "/zones/"+id+"/rrsets", `{"name":"www","type":"A","ttl":300,"records":[{"data":"192.0.2.1"}]}`); w.Code != http.StatusCreated {
+		t.Fatalf("create rrset: %d %s", w.Code, w.Body.String())
+	}
+	var set db.RRSet
+	gormDB.Where("zone_id = ?", zone.ID).First(&set)
+	if w := do("DELETE", "/zones/"+id+"/rrsets/"+strconv.Itoa(int(set.ID)), ""); w.Code != http.StatusNoContent {
+		t.Fatalf("delete rrset: %d", w.Code)
+	}
+	// Failed requests are not recorded
+	if w := do("POST", "/zones/"+id+"/rrsets", `not json`); w.Code != http.StatusBadRequest {
+		t.Fatalf("bad payload: %d", w.Code)
+	}
+
+	entries, total, err := db.AuditLog(gormDB, db.AuditFilter{ZoneID: zone.ID}, 0, 10)
+	if err != nil || total != 2 {
+		t.Fatalf("audit log: %+v, %v", entries, err)
+	}
+	if entries[0].Action != db.AuditRRSetDelete || entries[1].Action != db.AuditRRSetCreate {
+		t.Fatalf("unexpected actions: %s, %s", entries[0].Action, entries[1].Action)
+	}
+	for _, e := range entries {
+		if e.Actor != db.AuditActorAPI || e.RRSetID != set.ID || e.ZoneName != "audit.test." {
+			t.Fatalf("unexpected entry: %+v", e)
+		}
+	}
+	if want := "www.audit.test. A 300 [192.0.2.1]"; entries[1].Summary != want {
+		t.Fatalf("summary = %q, want %q", entries[1].Summary, want)
+	}
+}
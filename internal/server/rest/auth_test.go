@@ -1,8 +1,12 @@
 package rest
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
@@ -297,3 +301,93 @@ func TestAuthMiddleware_CaseInsensitiveBearer(t *testing.T) {
 		})
 	}
 }
+
+func TestAdminMintedToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hash := func(pw string) string {
+		h, err := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.MinCost)
+		if err != nil {
+			t.Fatalf("hash: %v", err)
+		}
+		return string(h)
+	}
+	cfg := &config.Config{APIToken: "testtoken", DefaultTTL: 300, Admin: config.AdminConfig{
+		Enabled: true, Username: "alice", PasswordHash: hash("alice-pass"),
+		Users: []config.AdminUser{{Username: "noc", PasswordHash: hash("noc-pass"), Role: config.RoleViewer}},
+	}}
+	server, gormDB, _ := setupZoneTestServer(t, cfg)
+
+	// mint signs in through the web admin and asks for a token
+	mint := func(user, pw string) (string, *http.Cookie) {
+		t.Helper()
+		form := url.Values{"username": {user}, "password": {pw}}
+		req := httptest.NewRequest("POST", "/admin/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		var session *http.Cookie
+		for _, ck := range w.Result().Cookies() {
+			if ck.Name == "session" {
+				session = ck
+			}
+		}
+		if session == nil {
+			t.Fatalf("login %s: %d", user, w.Code)
+		}
+		req = httptest.NewRequest("GET", "/admin/", nil)
+		req.AddCookie(session)
+		w = httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		m := regexp.MustCompile(`name="csrf-token" content="([^"]+)"`).FindStringSubmatch(w.Body.String())
+		if m == nil {
+			t.Fatalf("no csrf token on the dashboard: %d", w.Code)
+		}
+		req = httptest.NewRequest("POST", "/admin/token", nil)
+		req.AddCookie(session)
+		req.Header.Set("X-CSRF-Token", m[1])
+		req.Header.Set("Origin", "http://example.com")
+		w = httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		var resp struct {
+			Token string `json:"token"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusCreated || resp.Token == "" {
+			t.Fatalf("mint %s: %d %s", user, w.Code, w.Body.String())
+		}
+		return resp.Token, session
+	}
+	api := func(method, path, token, body string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	token, session := mint("alice", "alice-pass")
+	if code := api("POST", "/zones", token, `{"name":"minted.test"}`); code != http.StatusCreated {
+		t.Fatalf("admin token create: %d", code)
+	}
+	var e dbm.AuditEntry
+	gormDB.Where("action = ?", dbm.AuditZoneCreate).First(&e)
+	if e.Actor != "alice" {
+		t.Fatalf("audit actor %q, want alice", e.Actor)
+	}
+
+	viewer, _ := mint("noc", "noc-pass")
+	if code := api("GET", "/zones", viewer, ""); code != http.StatusOK {
+		t.Fatalf("viewer token read: %d", code)
+	}
+	if code := api("POST", "/zones", viewer, `{"name":"viewer.test"}`); code != http.StatusForbidden {
+		t.Fatalf("viewer token write: %d", code)
+	}
+
+	// Logging out revokes the session's tokens
+	req := httptest.NewRequest("GET", "/admin/logout", nil)
+	req.AddCookie(session)
+	server.r.ServeHTTP(httptest.NewRecorder(), req)
+	if code := api("GET", "/zones", token, ""); code != http.StatusUnauthorized {
+		t.Fatalf("token after logout: %d", code)
+	}
+}
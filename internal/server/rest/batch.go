@@ -0,0 +1,199 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+	"gorm.io/gorm"
+
+	dbm "namedot/internal/db"
+	"namedot/internal/server/rest/zoneio"
+)
+
+// maxBatchZones caps the zones of one batch request.
+const maxBatchZones = 1000
+
+// zoneBatchReq creates several zones at once, optionally applying a web UI
+// template (by name or ID) to each.
+type zoneBatchReq struct {
+	Zones        []string `json:"zones"`
+	Template     string   `json:"template"`
+	SkipExisting bool     `json:"skip_existing"` // existing zones are reported as skipped instead of failing the batch
+}
+
+// Batch zone results.
+const (
+	batchCreated  = "created"
+	batchSkipped  = "skipped"     // already exists, with skip_existing
+	batchExists   = "exists"      // already exists, or listed twice
+	batchInvalid  = "invalid"     // not a valid zone name
+	batchInTrash  = "in_trash"    // a deleted zone with the name is in the trash
+	batchDenied   = "forbidden"   // outside the token's zones
+	batchNotTried = "not_created" // valid, but the batch failed
+)
+
+// zoneBatchResult is the outcome for one zone of a batch.
+type zoneBatchResult struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	ID      uint   `json:"id,omitempty"`
+	Serial  uint32 `json:"serial,omitempty"`
+	Records int    `json:"records,omitempty"` // records added by the template
+	Error   string `json:"error,omitempty"`
+}
+
+// zoneBatchResp summarizes a batch. Nothing is created unless every zone
+// could be.
+type zoneBatchResp struct {
+	Created int               `json:"created"`
+	Skipped int               `json:"skipped"`
+	Failed  int               `json:"failed"`
+	Zones   []zoneBatchResult `json:"zones"`
+}
+
+// createZoneBatch creates the listed zones in one transaction: either all of
+// them are created (201) or none, with each problem reported next to its zone
+// (409 for existing or trashed names, 400 for invalid ones, 403 for zones
+// outside the token's scope).
+func (s *Server) createZoneBatch(c *gin.Context) {
+	var req zoneBatchReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	if len(req.Zones) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "zones must not be empty"})
+		return
+	}
+	if len(req.Zones) > maxBatchZones {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d zones per batch", maxBatchZones)})
+		return
+	}
+	var tpl *dbm.Template
+	if req.Template != "" {
+		t, err := s.templateByKey(req.Template)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "template not found"})
+			return
+		}
+		tpl = &t
+	}
+
+	resp := zoneBatchResp{Zones: make([]zoneBatchResult, len(req.Zones))}
+	status := http.StatusConflict
+	fail := func(i int, result string, code int, msg string) {
+		resp.Zones[i].Status, resp.Zones[i].Error = result, msg
+		resp.Failed++
+		// Bad input wins over scope, scope over conflicts
+		if code < status {
+			status = code
+		}
+	}
+	seen := map[string]bool{}
+	for i, raw := range req.Zones {
+		name := zoneio.NormalizeFQDN(raw)
+		resp.Zones[i].Name = name
+		if _, ok := dns.IsDomainName(name); !ok || name == "" || name == "." {
+			fail(i, batchInvalid, http.StatusBadRequest, "invalid zone name")
+			continue
+		}
+		if !zoneAllowed(c, name) {
+			fail(i, batchDenied, http.StatusForbidden, "token is not allowed to manage this zone")
+			continue
+		}
+		if seen[name] {
+			fail(i, batchExists, http.StatusConflict, "listed twice")
+			continue
+		}
+		seen[name] = true
+		if dbm.ZoneNameInTrash(s.db, name) {
+			fail(i, batchInTrash, http.StatusConflict, dbm.ErrZoneNameInTrash.Error())
+			continue
+		}
+		if z, err := s.zoneByKey(name); err == nil {
+			if req.SkipExisting {
+				resp.Zones[i].Status, resp.Zones[i].ID = batchSkipped, z.ID
+				resp.Skipped++
+				continue
+			}
+			fail(i, batchExists, http.StatusConflict, "zone already exists")
+		}
+	}
+	if resp.Failed > 0 {
+		for i := range resp.Zones {
+			if resp.Zones[i].Status == "" {
+				resp.Zones[i].Status = batchNotTried
+			}
+		}
+		resp.Skipped = 0
+		c.JSON(status, resp)
+		return
+	}
+
+	created := make([]dbm.Zone, len(resp.Zones))
+	err := s.dbFor(c).Transaction(func(tx *gorm.DB) error {
+		for i := range resp.Zones {
+			r := &resp.Zones[i]
+			if r.Status == batchSkipped {
+				continue
+			}
+			z := dbm.Zone{Name: r.Name}
+			if err := tx.Create(&z).Error; err != nil {
+				return fmt.Errorf("%s: %w", r.Name, err)
+			}
+			dbm.TouchZone(tx, z, s.cfg)
+			if tpl != nil {
+				changes, err := dbm.ApplyTemplate(tx, *tpl, z)
+				if err != nil {
+					return fmt.Errorf("%s: template %s: %w", r.Name, tpl.Name, err)
+				}
+				for _, ch := range changes {
+					if ch.Op == dbm.TemplateAdd {
+						r.Records++
+					}
+				}
+				if r.Records > 0 {
+					dbm.TouchZone(tx, z, s.cfg)
+				}
+			}
+			if err := tx.First(&z, z.ID).Error; err != nil {
+				return err
+			}
+			created[i] = z
+			r.Status, r.ID, r.Serial = batchCreated, z.ID, z.Serial
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for i, r := range resp.Zones {
+		if r.Status != batchCreated {
+			continue
+		}
+		resp.Created++
+		s.audit(c, dbm.AuditZoneCreate, created[i], 0, created[i].Name+" (batch)")
+		if tpl != nil {
+			s.audit(c, dbm.AuditTemplateApply, created[i], 0, fmt.Sprintf("%s v%d: +%d -0", tpl.Name, tpl.Version, r.Records))
+		}
+	}
+	if s.dnsServer != nil && resp.Created > 0 {
+		s.dnsServer.InvalidateZoneCache()
+	}
+	c.JSON(http.StatusCreated, resp)
+}
+
+// templateByKey loads a template with its records by ID or by name.
+func (s *Server) templateByKey(key string) (dbm.Template, error) {
+	var t dbm.Template
+	q := s.db.Preload("Records")
+	if id, err := strconv.ParseUint(key, 10, 32); err == nil {
+		return t, q.First(&t, id).Error
+	}
+	return t, q.Where("name = ?", strings.TrimSpace(key)).First(&t).Error
+}
@@ -0,0 +1,82 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/config"
+	"namedot/internal/db"
+)
+
+func TestCreateZoneBatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{APIToken: "testtoken", DefaultTTL: 300, SOA: config.SOAConfig{AutoOnMissing: true}}
+	server, gormDB, _ := setupZoneTestServer(t, cfg)
+
+	do := func(body string) (*httptest.ResponseRecorder, zoneBatchResp) {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/zones/batch", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer testtoken")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		var resp zoneBatchResp
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp
+	}
+	zones := func() int64 {
+		var n int64
+		gormDB.Model(&db.Zone{}).Count(&n)
+		return n
+	}
+
+	tpl := db.Template{Name: "parked", Records: []db.TemplateRecord{
+		{Name: "@", Type: "A", TTL: 300, Data: "192.0.2.80"},
+		{Name: "www.{domain}", Type: "CNAME", TTL: 300, Data: "{domain}."},
+	}}
+	if err := gormDB.Create(&tpl).Error; err != nil {
+		t.Fatalf("create template: %v", err)
+	}
+
+	// One bad name keeps the whole batch from being created
+	w, resp := do(`{"zones":["one.test","bad..test","one.test."]}`)
+	if w.Code != http.StatusBadRequest || resp.Failed != 2 || resp.Zones[0].Status != batchNotTried ||
+		resp.Zones[1].Status != batchInvalid || resp.Zones[2].Status != batchExists || zones() != 0 {
+		t.Fatalf("bad batch: %d %s", w.Code, w.Body.String())
+	}
+	if w, _ := do(`{"zones":["one.test"],"template":"missing"}`); w.Code != http.StatusNotFound {
+		t.Fatalf("unknown template: %d", w.Code)
+	}
+
+	w, resp = do(`{"zones":["One.test","two.test"],"template":"parked"}`)
+	if w.Code != http.StatusCreated || resp.Created != 2 || resp.Zones[0].Name != "one.test." || resp.Zones[0].Records != 2 || resp.Zones[0].Serial == 0 {
+		t.Fatalf("create: %d %s", w.Code, w.Body.String())
+	}
+	var www db.RRSet
+	if err := gormDB.Preload("Records").Where("zone_id = ? AND name = ? AND type = ?", resp.Zones[1].ID, "www.two.test.", "CNAME").First(&www).Error; err != nil || www.Records[0].Data != "two.test." {
+		t.Fatalf("template not applied: %v %+v", err, www)
+	}
+	var soa int64
+	gormDB.Model(&db.RRSet{}).Where("zone_id = ? AND type = ?", resp.Zones[0].ID, "SOA").Count(&soa)
+	if soa != 1 {
+		t.Fatal("batch zones should get an SOA")
+	}
+
+	if w, resp := do(`{"zones":["two.test","three.test"]}`); w.Code != http.StatusConflict || resp.Zones[0].Status != batchExists || zones() != 2 {
+		t.Fatalf("existing zone: %d %s", w.Code, w.Body.String())
+	}
+	w, resp = do(`{"zones":["two.test","three.test"],"skip_existing":true}`)
+	if w.Code != http.StatusCreated || resp.Created != 1 || resp.Skipped != 1 || resp.Zones[0].Status != batchSkipped || zones() != 3 {
+		t.Fatalf("skip existing: %d %s", w.Code, w.Body.String())
+	}
+	var n int64
+	gormDB.Model(&db.AuditEntry{}).Where("action = ?", db.AuditZoneCreate).Count(&n)
+	if n != 3 {
+		t.Fatalf("zone.create audit entries: %d", n)
+	}
+}
@@ -0,0 +1,168 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	dbm "namedot/internal/db"
+	"namedot/internal/server/rest/zoneio"
+)
+
+// canaryReq stages a new version of a zone for the clients in CIDRs.
+type canaryReq struct {
+	CIDRs  []string   `json:"cidrs"`
+	RRSets []rrsetReq `json:"rrsets"`
+}
+
+// canaryResp is a staged canary and what promoting it would change.
+type canaryResp struct {
+	*dbm.ZoneCanary
+	Plan *zoneio.ZonePlan `json:"plan"`
+}
+
+// canaryOf loads the zone and its canary, answering the request itself when
+// either is missing.
+func (s *Server) canaryOf(c *gin.Context) (dbm.Zone, *dbm.ZoneCanary, bool) {
+	z, err := s.zoneByKey(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
+		return z, nil, false
+	}
+	canary, err := dbm.GetZoneCanary(s.db, z.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return z, nil, false
+	}
+	if canary == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no canary staged"})
+		return z, nil, false
+	}
+	return z, canary, true
+}
+
+// canaryPlan compares the canary to the current zone contents.
+func (s *Server) canaryPlan(z dbm.Zone, canary *dbm.ZoneCanary) (*zoneio.ZonePlan, error) {
+	if err := s.db.Preload("RRSets.Records").First(&z, z.ID).Error; err != nil {
+		return nil, err
+	}
+	return zoneio.Plan(&z, canary.RRSets), nil
+}
+
+func (s *Server) getCanary(c *gin.Context) {
+	z, canary, ok := s.canaryOf(c)
+	if !ok {
+		return
+	}
+	plan, err := s.canaryPlan(z, canary)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, canaryResp{ZoneCanary: canary, Plan: plan})
+}
+
+// stageCanary stores the desired contents of a zone, in the format of the
+// plan route, as its canary. Clients in cidrs are answered from it right
+// away; everyone else keeps getting the active zone. Staging again replaces
+// the canary.
+func (s *Server) stageCanary(c *gin.Context) {
+	z, err := s.zoneByKey(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
+		return
+	}
+	var req canaryReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	cidrs, err := dbm.NormalizeCanaryCIDRs(req.CIDRs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	desired, err := s.desiredRRSets(z, zonePlanReq{RRSets: req.RRSets})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rrsets := make([]dbm.RRSet, 0, len(desired))
+	for _, rs := range desired {
+		if rs.Type != "SOA" {
+			rrsets = append(rrsets, rs)
+		}
+	}
+	canary := &dbm.ZoneCanary{ZoneID: z.ID, CIDRs: cidrs, BaseSerial: z.Serial, RRSets: rrsets}
+	if err := dbm.SaveZoneCanary(s.db, *canary); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if canary, err = dbm.GetZoneCanary(s.db, z.ID); err != nil || canary == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("reload canary: %v", err)})
+		return
+	}
+	plan, err := s.canaryPlan(z, canary)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.audit(c, dbm.AuditCanaryStage, z, 0, fmt.Sprintf("for [%s]: %d changes against serial %d",
+		strings.Join(cidrs, ", "), len(plan.Changes), z.Serial))
+	if s.dnsServer != nil {
+		s.dnsServer.InvalidateZoneCache()
+	}
+	c.JSON(http.StatusOK, canaryResp{ZoneCanary: canary, Plan: plan})
+}
+
+// promoteCanary makes the canary the active version of the zone for all
+// clients. It is refused with 409 when the zone changed after the canary was
+// staged, so changes made in the meantime are not silently undone; stage
+// the canary again to promote it.
+func (s *Server) promoteCanary(c *gin.Context) {
+	z, canary, ok := s.canaryOf(c)
+	if !ok {
+		return
+	}
+	plan, err := zoneio.ApplyPlan(s.dbFor(c), z.ID, canary.RRSets, &canary.BaseSerial)
+	if errors.Is(err, zoneio.ErrStalePlan) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := dbm.DeleteZoneCanary(s.db, z.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.recordPlan(c, z, plan, dbm.AuditCanaryPromote, "canary promote")
+	if len(plan.Changes) == 0 {
+		s.audit(c, dbm.AuditCanaryPromote, z, 0, "canary promote: no changes")
+		if s.dnsServer != nil {
+			s.dnsServer.InvalidateZoneCache()
+		}
+	}
+	c.JSON(http.StatusOK, plan)
+}
+
+// revertCanary discards the canary; its clients get the active zone again.
+func (s *Server) revertCanary(c *gin.Context) {
+	z, _, ok := s.canaryOf(c)
+	if !ok {
+		return
+	}
+	if err := dbm.DeleteZoneCanary(s.db, z.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.audit(c, dbm.AuditCanaryRevert, z, 0, "canary reverted")
+	if s.dnsServer != nil {
+		s.dnsServer.InvalidateZoneCache()
+	}
+	c.Status(http.StatusNoContent)
+}
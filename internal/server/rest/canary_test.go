@@ -0,0 +1,103 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/config"
+	"namedot/internal/db"
+)
+
+func TestZoneCanary(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{APIToken: "testtoken", DefaultTTL: 300, SOA: config.SOAConfig{AutoOnMissing: true}}
+	server, gormDB, _ := setupZoneTestServer(t, cfg)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer testtoken")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		return w
+	}
+
+	zone := db.Zone{Name: "canary.test.", RRSets: []db.RRSet{
+		{Name: "www.canary.test.", Type: "A", TTL: 300, Records: []db.RData{{Data: "192.0.2.1"}}},
+	}}
+	if err := gormDB.Create(&zone).Error; err != nil {
+		t.Fatalf("create zone: %v", err)
+	}
+	db.TouchZone(gormDB, zone, cfg)
+
+	if w := do("GET", "/zones/canary.test/canary", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("get without canary: %d", w.Code)
+	}
+	desired := `"rrsets":[{"name":"www","type":"A","ttl":60,"records":[{"data":"192.0.2.2"}]}]`
+	if w := do("PUT", "/zones/canary.test/canary", `{"cidrs":["bogus"],`+desired+`}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("bad cidr: %d", w.Code)
+	}
+	if w := do("PUT", "/zones/canary.test/canary", `{`+desired+`}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("no cidrs: %d", w.Code)
+	}
+	w := do("PUT", "/zones/canary.test/canary", `{"cidrs":["198.51.100.7","10.1.2.3/8"],`+desired+`}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("stage: %d %s", w.Code, w.Body.String())
+	}
+	var staged canaryResp
+	if err := json.Unmarshal(w.Body.Bytes(), &staged); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(staged.CIDRs) != 2 || staged.CIDRs[0] != "198.51.100.7/32" || staged.CIDRs[1] != "10.0.0.0/8" {
+		t.Fatalf("cidrs: %v", staged.CIDRs)
+	}
+	if len(staged.Plan.Changes) != 1 || staged.Plan.Changes[0].Action != "update" {
+		t.Fatalf("plan: %+v", staged.Plan)
+	}
+	var www db.RRSet
+	gormDB.Preload("Records").Where("name = ?", "www.canary.test.").First(&www)
+	if www.Records[0].Data != "192.0.2.1" {
+		t.Fatal("staging should not change the zone")
+	}
+
+	// Revert drops the canary and leaves the zone alone
+	if w := do("DELETE", "/zones/canary.test/canary", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("revert: %d", w.Code)
+	}
+	if w := do("POST", "/zones/canary.test/canary/promote", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("promote after revert: %d", w.Code)
+	}
+
+	if w := do("PUT", "/zones/canary.test/canary", `{"cidrs":["198.51.100.0/24"],`+desired+`}`); w.Code != http.StatusOK {
+		t.Fatalf("stage again: %d", w.Code)
+	}
+	// A change made after staging makes the canary stale
+	db.TouchZone(gormDB, zone, cfg)
+	if w := do("POST", "/zones/canary.test/canary/promote", ""); w.Code != http.StatusConflict {
+		t.Fatalf("stale promote: %d %s", w.Code, w.Body.String())
+	}
+	if w := do("PUT", "/zones/canary.test/canary", `{"cidrs":["198.51.100.0/24"],`+desired+`}`); w.Code != http.StatusOK {
+		t.Fatalf("restage: %d", w.Code)
+	}
+	if w := do("POST", "/zones/canary.test/canary/promote", ""); w.Code != http.StatusOK {
+		t.Fatalf("promote: %d %s", w.Code, w.Body.String())
+	}
+	gormDB.Preload("Records").Where("name = ?", "www.canary.test.").First(&www)
+	if www.TTL != 60 || len(www.Records) != 1 || www.Records[0].Data != "192.0.2.2" {
+		t.Fatalf("promoted rrset: %+v", www)
+	}
+	if c, _ := db.GetZoneCanary(gormDB, zone.ID); c != nil {
+		t.Fatal("canary should be gone after promote")
+	}
+	var n int64
+	gormDB.Model(&db.AuditEntry{}).Where("action = ?", db.AuditCanaryPromote).Count(&n)
+	if n != 1 {
+		t.Fatalf("promote audit entries: %d", n)
+	}
+}
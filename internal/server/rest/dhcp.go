@@ -0,0 +1,62 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	dbm "namedot/internal/db"
+	"namedot/internal/dhcp"
+)
+
+// dhcpError answers a failed lease change with the matching status.
+func dhcpError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, dhcp.ErrInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, dhcp.ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, dbm.ErrZoneLocked):
+		c.JSON(http.StatusLocked, gin.H{"error": err.Error()})
+	case errors.Is(err, dhcp.ErrNoZone):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func (s *Server) listLeases(c *gin.Context) {
+	leases, err := s.dhcp.Leases()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, leases)
+}
+
+// registerLease adds or renews a lease; DHCP servers call it on every
+// commit and renewal.
+func (s *Server) registerLease(c *gin.Context) {
+	var req dhcp.Lease
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	lease, err := s.dhcp.Register(req)
+	if err != nil {
+		dhcpError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, lease)
+}
+
+// releaseLease removes the lease of an address on release, decline or
+// expiry reported by the DHCP server.
+func (s *Server) releaseLease(c *gin.Context) {
+	if err := s.dhcp.Release(c.Param("ip")); err != nil {
+		dhcpError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,63 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/config"
+	"namedot/internal/db"
+)
+
+func TestDHCPLeases(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{APIToken: "testtoken", DHCP: config.DHCPConfig{Enabled: true, Zone: "lan.test", TTL: 300}}
+	server, gormDB, mockDNS := setupZoneTestServer(t, cfg)
+	if err := gormDB.Create(&db.Zone{Name: "lan.test."}).Error; err != nil {
+		t.Fatalf("create zone: %v", err)
+	}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer testtoken")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", "/dhcp/leases", `{"hostname":"laptop","ip":"192.0.2.10","mac":"aa:bb:cc:00:11:22","lease_time":3600}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("register: %d %s", w.Code, w.Body.String())
+	}
+	if !mockDNS.invalidateCalled {
+		t.Fatal("cache should be invalidated")
+	}
+	var n int64
+	gormDB.Model(&db.RRSet{}).Where("name = ? AND type = ?", "laptop.lan.test.", "A").Count(&n)
+	if n != 1 {
+		t.Fatal("lease record not created")
+	}
+	if w := do("POST", "/dhcp/leases", `{"hostname":"laptop","ip":"192.0.2.11"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("lease without lease time: %d", w.Code)
+	}
+
+	w = do("GET", "/dhcp/leases", "")
+	var leases []db.DHCPLease
+	if err := json.Unmarshal(w.Body.Bytes(), &leases); err != nil || len(leases) != 1 || leases[0].Hostname != "laptop.lan.test." {
+		t.Fatalf("leases: %s", w.Body.String())
+	}
+
+	if w := do("DELETE", "/dhcp/leases/192.0.2.10", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("release: %d %s", w.Code, w.Body.String())
+	}
+	gormDB.Model(&db.RRSet{}).Where("name = ? AND type = ?", "laptop.lan.test.", "A").Count(&n)
+	if n != 0 {
+		t.Fatal("released lease kept its record")
+	}
+}
@@ -0,0 +1,41 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/geoip"
+	dnssrv "namedot/internal/server/dns"
+)
+
+// geoIPReloader is implemented by DNS servers that answer with GeoIP.
+type geoIPReloader interface {
+	ReloadGeoIP(download bool) (geoip.ReloadResult, error)
+}
+
+// reloadGeoIP reopens the GeoIP databases at once instead of at the next
+// reload interval, downloading them first when downloads are configured
+// unless ?download=false.
+func (s *Server) reloadGeoIP(c *gin.Context) {
+	g, ok := s.dnsServer.(geoIPReloader)
+	if !ok || !s.cfg.GeoIP.Enabled {
+		c.JSON(http.StatusNotFound, gin.H{"error": "GeoIP is disabled (geoip.enabled)"})
+		return
+	}
+	res, err := g.ReloadGeoIP(c.Query("download") != "false")
+	if errors.Is(err, dnssrv.ErrGeoIPNotLoaded) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error() + "; restart to load them"})
+		return
+	}
+	if err != nil {
+		h := gin.H{"error": err.Error()}
+		if res.DownloadError != "" {
+			h["download_error"] = res.DownloadError
+		}
+		c.JSON(http.StatusInternalServerError, h)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
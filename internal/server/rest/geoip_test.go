@@ -0,0 +1,66 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/config"
+	"namedot/internal/geoip"
+	dnssrv "namedot/internal/server/dns"
+)
+
+// geoDNS is a DNS server that records GeoIP reloads.
+type geoDNS struct {
+	mockDNSServer
+	err       error
+	downloads []bool
+}
+
+func (g *geoDNS) ReloadGeoIP(download bool) (geoip.ReloadResult, error) {
+	g.downloads = append(g.downloads, download)
+	if g.err != nil {
+		return geoip.ReloadResult{}, g.err
+	}
+	built := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	return geoip.ReloadResult{Downloaded: download, Databases: map[string]time.Time{"country_v4": built}}, nil
+}
+
+func TestReloadGeoIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	post := func(cfg *config.Config, dns DNSServer, path string) *httptest.ResponseRecorder {
+		server := NewServer(cfg, setupTestDB(t), dns)
+		req := httptest.NewRequest("POST", path, nil)
+		req.Header.Set("Authorization", "Bearer testtoken")
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		return w
+	}
+	enabled := &config.Config{APIToken: "testtoken", GeoIP: config.GeoIPConfig{Enabled: true}}
+
+	if w := post(&config.Config{APIToken: "testtoken"}, &geoDNS{}, "/admin/geoip/reload"); w.Code != http.StatusNotFound {
+		t.Fatalf("disabled: %d %s", w.Code, w.Body.String())
+	}
+
+	dns := &geoDNS{}
+	w := post(enabled, dns, "/admin/geoip/reload")
+	var res geoip.ReloadResult
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("reload: %d %s", w.Code, w.Body.String())
+	}
+	if !res.Downloaded || res.Databases["country_v4"].Year() != 2026 {
+		t.Fatalf("unexpected result: %s", w.Body.String())
+	}
+	post(enabled, dns, "/admin/geoip/reload?download=false")
+	if len(dns.downloads) != 2 || !dns.downloads[0] || dns.downloads[1] {
+		t.Fatalf("download flags: %v", dns.downloads)
+	}
+
+	if w := post(enabled, &geoDNS{err: dnssrv.ErrGeoIPNotLoaded}, "/admin/geoip/reload"); w.Code != http.StatusConflict {
+		t.Fatalf("not loaded: %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,48 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/config"
+)
+
+// probingDNS is a DNS server whose listener probe gives a fixed result.
+type probingDNS struct {
+	mockDNSServer
+	err error
+}
+
+func (p *probingDNS) Probe() (map[string]time.Duration, error) {
+	if p.err != nil {
+		return map[string]time.Duration{"udp": time.Millisecond}, p.err
+	}
+	return map[string]time.Duration{"udp": time.Millisecond, "tcp": 2 * time.Millisecond}, nil
+}
+
+func TestHealthDNS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	get := func(dnsServer DNSServer) *httptest.ResponseRecorder {
+		server := NewServer(&config.Config{APIToken: "testtoken"}, setupTestDB(t), dnsServer)
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, httptest.NewRequest("GET", "/health/dns", nil))
+		return w
+	}
+
+	if w := get(&probingDNS{}); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"tcp_ms":2`) {
+		t.Fatalf("healthy: %d %s", w.Code, w.Body.String())
+	}
+	w := get(&probingDNS{err: errors.New("tcp: i/o timeout")})
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "i/o timeout") {
+		t.Fatalf("wedged: %d %s", w.Code, w.Body.String())
+	}
+	if w := get(&mockDNSServer{}); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("without probe: %d", w.Code)
+	}
+}
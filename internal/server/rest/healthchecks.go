@@ -0,0 +1,47 @@
+package rest
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/health"
+	"namedot/internal/server/rest/zoneio"
+)
+
+// healthStatusLister is implemented by DNS servers that run health checks.
+type healthStatusLister interface {
+	HealthStatuses() []health.Status
+}
+
+// listHealthChecks returns the health of the records with a health check.
+// Query params: zone, and state=healthy|unhealthy. Tokens limited to zones
+// see the records of their zones only.
+func (s *Server) listHealthChecks(c *gin.Context) {
+	l, ok := s.dnsServer.(healthStatusLister)
+	if !ok || !s.cfg.HealthChecks.Enabled {
+		c.JSON(http.StatusNotFound, gin.H{"error": "health checks are disabled (health_checks.enabled)"})
+		return
+	}
+	state := strings.ToLower(c.Query("state"))
+	if state != "" && state != "healthy" && state != "unhealthy" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "state must be healthy or unhealthy"})
+		return
+	}
+	zone := ""
+	if z := strings.TrimSpace(c.Query("zone")); z != "" {
+		zone = zoneio.NormalizeFQDN(z)
+	}
+	out := []health.Status{}
+	for _, st := range l.HealthStatuses() {
+		if !zoneAllowed(c, st.Zone) || (zone != "" && zoneio.NormalizeFQDN(st.Zone) != zone) {
+			continue
+		}
+		if state != "" && st.Healthy != (state == "healthy") {
+			continue
+		}
+		out = append(out, st)
+	}
+	c.JSON(http.StatusOK, out)
+}
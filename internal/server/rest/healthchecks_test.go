@@ -0,0 +1,82 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+
+	"namedot/internal/config"
+	"namedot/internal/health"
+)
+
+// healthDNS is a DNS server with fixed health check results.
+type healthDNS struct {
+	mockDNSServer
+}
+
+func (d *healthDNS) HealthStatuses() []health.Status {
+	return []health.Status{
+		{RecordID: 1, Zone: "app.test.", Name: "www.app.test.", Type: "A", Data: "192.0.2.1", Check: "tcp://:443", Healthy: true},
+		{RecordID: 2, Zone: "app.test.", Name: "www.app.test.", Type: "A", Data: "192.0.2.2", Check: "tcp://:443", Error: "connection refused"},
+		{RecordID: 3, Zone: "other.test.", Name: "other.test.", Type: "A", Data: "192.0.2.3", Check: "icmp", Healthy: true},
+	}
+}
+
+func TestListHealthChecks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hash, err := bcrypt.GenerateFromPassword([]byte("team-token"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("hash: %v", err)
+	}
+	get := func(cfg *config.Config, token, query string) (int, []health.Status) {
+		t.Helper()
+		server := NewServer(cfg, setupTestDB(t), &healthDNS{})
+		req := httptest.NewRequest("GET", "/health-checks"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		var got []health.Status
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decode: %v %s", err, w.Body.String())
+			}
+		}
+		return w.Code, got
+	}
+
+	if code, _ := get(&config.Config{APIToken: "testtoken"}, "testtoken", ""); code != http.StatusNotFound {
+		t.Fatalf("disabled: %d", code)
+	}
+	cfg := &config.Config{
+		APIToken:     "testtoken",
+		APITokens:    []config.ScopedToken{{Name: "apps", TokenHash: string(hash), Zones: []string{"app.test"}}},
+		HealthChecks: config.HealthChecksConfig{Enabled: true},
+	}
+	for _, tc := range []struct {
+		token, query string
+		want         []uint
+	}{
+		{"testtoken", "", []uint{1, 2, 3}},
+		{"testtoken", "?zone=app.test", []uint{1, 2}},
+		{"testtoken", "?state=unhealthy", []uint{2}},
+		{"testtoken", "?state=healthy&zone=other.test.", []uint{3}},
+		{"team-token", "", []uint{1, 2}},
+	} {
+		code, got := get(cfg, tc.token, tc.query)
+		if code != http.StatusOK || len(got) != len(tc.want) {
+			t.Fatalf("%s %s: %d %+v", tc.token, tc.query, code, got)
+		}
+		for i, id := range tc.want {
+			if got[i].RecordID != id {
+				t.Fatalf("%s %s: got %+v, want ids %v", tc.token, tc.query, got, tc.want)
+			}
+		}
+	}
+	if code, _ := get(cfg, "testtoken", "?state=down"); code != http.StatusBadRequest {
+		t.Fatalf("bad state: %d", code)
+	}
+}
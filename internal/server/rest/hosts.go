@@ -0,0 +1,122 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	dbm "namedot/internal/db"
+)
+
+type hostReq struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	TTL     uint32 `json:"ttl"`
+}
+
+func hostSummary(h dbm.Host) string {
+	return fmt.Sprintf("%s %s %s", h.Name, h.Type(), h.Address)
+}
+
+func (s *Server) listHosts(c *gin.Context) {
+	hosts, err := dbm.ListHosts(s.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, hosts)
+}
+
+// checkHostTTL applies record_ttl to an explicit host TTL; zero means
+// default_ttl, which the config already keeps within the limits.
+func (s *Server) checkHostTTL(ttl uint32) error {
+	if ttl == 0 {
+		return nil
+	}
+	return s.cfg.RecordTTL.Check(ttl)
+}
+
+// createHost adds a static host override; posting an existing name/address
+// pair updates its TTL.
+func (s *Server) createHost(c *gin.Context) {
+	var req hostReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	if err := s.checkHostTTL(req.TTL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h, err := dbm.AddHost(s.db, dbm.Host{Name: req.Name, Address: req.Address, TTL: req.TTL})
+	if errors.Is(err, dbm.ErrInvalidHost) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.audit(c, dbm.AuditHostCreate, dbm.Zone{}, 0, hostSummary(h))
+	s.invalidateHosts()
+	c.JSON(http.StatusCreated, h)
+}
+
+func (s *Server) updateHost(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var req hostReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	if err := s.checkHostTTL(req.TTL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h, err := dbm.UpdateHost(s.db, dbm.Host{ID: uint(id), Name: req.Name, Address: req.Address, TTL: req.TTL})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	case errors.Is(err, dbm.ErrInvalidHost):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		// Most likely the name/address pair exists already
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	s.audit(c, dbm.AuditHostUpdate, dbm.Zone{}, 0, hostSummary(h))
+	s.invalidateHosts()
+	c.JSON(http.StatusOK, h)
+}
+
+func (s *Server) deleteHost(c *gin.Context) {
+	var h dbm.Host
+	if err := s.db.First(&h, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	if err := s.db.Delete(&h).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.audit(c, dbm.AuditHostDelete, dbm.Zone{}, 0, hostSummary(h))
+	s.invalidateHosts()
+	c.Status(http.StatusNoContent)
+}
+
+// invalidateHosts makes the DNS server reload the hosts table.
+func (s *Server) invalidateHosts() {
+	if s.dnsServer != nil {
+		s.dnsServer.InvalidateZoneCache()
+	}
+}
@@ -0,0 +1,75 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/config"
+	"namedot/internal/db"
+)
+
+func TestHosts_CRUD(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{APIToken: "testtoken"}
+	server, gormDB, mockDNS := setupZoneTestServer(t, cfg)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer testtoken")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", "/hosts", `{"name":"Lab.Example.COM","address":"192.0.2.10","ttl":60}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body.String())
+	}
+	var h db.Host
+	_ = json.Unmarshal(w.Body.Bytes(), &h)
+	if h.Name != "lab.example.com." || h.Address != "192.0.2.10" || !mockDNS.invalidateCalled {
+		t.Fatalf("unexpected host %+v (invalidated %v)", h, mockDNS.invalidateCalled)
+	}
+	if w := do("POST", "/hosts", `{"name":"lab.example.com","address":"2001:db8::10"}`); w.Code != http.StatusCreated {
+		t.Fatalf("create v6: %d %s", w.Code, w.Body.String())
+	}
+	for _, body := range []string{`{"name":"x.test","address":"not-an-ip"}`, `{"name":"","address":"192.0.2.1"}`, `nope`} {
+		if w := do("POST", "/hosts", body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: want 400, got %d", body, w.Code)
+		}
+	}
+
+	id := strconv.Itoa(int(h.ID))
+	if w := do("PUT", "/hosts/"+id, `{"name":"lab.example.com","address":"192.0.2.11","ttl":30}`); w.Code != http.StatusOK {
+		t.Fatalf("update: %d %s", w.Code, w.Body.String())
+	}
+	if w := do("PUT", "/hosts/999", `{"name":"a.test","address":"192.0.2.1"}`); w.Code != http.StatusNotFound {
+		t.Fatalf("update missing: %d", w.Code)
+	}
+
+	var hosts []db.Host
+	_ = json.Unmarshal(do("GET", "/hosts", "").Body.Bytes(), &hosts)
+	if len(hosts) != 2 || hosts[0].Address != "192.0.2.11" || hosts[0].TTL != 30 || hosts[1].Type() != "AAAA" {
+		t.Fatalf("unexpected list: %+v", hosts)
+	}
+
+	if w := do("DELETE", "/hosts/"+id, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("delete: %d", w.Code)
+	}
+	if w := do("DELETE", "/hosts/"+id, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("delete again: %d", w.Code)
+	}
+
+	entries, total, _ := db.AuditLog(gormDB, db.AuditFilter{}, 0, 10)
+	if total != 4 || entries[0].Action != db.AuditHostDelete || entries[0].Summary != "lab.example.com. A 192.0.2.11" {
+		t.Fatalf("unexpected audit log: %+v", entries)
+	}
+}
@@ -0,0 +1,21 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	dbm "namedot/internal/db"
+)
+
+// integrityReport lists orphaned rows, RRSets outside their zone, CNAME
+// conflicts and zones without an apex SOA or NS. It only reads; orphans are
+// removed by `namedot db vacuum` or db.maintenance_sec.
+func (s *Server) integrityReport(c *gin.Context) {
+	r, err := dbm.CheckIntegrity(s.reader())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
@@ -0,0 +1,63 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/config"
+	"namedot/internal/db"
+)
+
+func TestIntegrityReport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server, gormDB, _ := setupZoneTestServer(t, &config.Config{APIToken: "testtoken"})
+	zone := db.Zone{Name: "bare.test.", RRSets: []db.RRSet{
+		{Name: "www.bare.test.", Type: "CNAME", TTL: 300, Records: []db.RData{{Data: "bare.test."}}},
+		{Name: "www.bare.test.", Type: "A", TTL: 300, Records: []db.RData{{Data: "192.0.2.1"}}},
+	}}
+	if err := gormDB.Create(&zone).Error; err != nil {
+		t.Fatalf("create zone: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/reports/integrity", nil)
+	req.Header.Set("Authorization", "Bearer testtoken")
+	w := httptest.NewRecorder()
+	server.r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var r db.IntegrityReport
+	if err := json.Unmarshal(w.Body.Bytes(), &r); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if r.Problems != 2 || len(r.CNAMEConflicts) != 1 || len(r.MissingApex) != 1 || len(r.MissingApex[0].Missing) != 2 {
+		t.Fatalf("report: %s", w.Body.String())
+	}
+}
+
+func TestMetaGeo(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server, _, _ := setupZoneTestServer(t, &config.Config{APIToken: "testtoken"})
+
+	req := httptest.NewRequest("GET", "/meta/geo", nil)
+	req.Header.Set("Authorization", "Bearer testtoken")
+	w := httptest.NewRecorder()
+	server.r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var r struct {
+		Countries  []struct{ Code, Name string } `json:"countries"`
+		Continents []struct{ Code, Name string } `json:"continents"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &r); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(r.Continents) != 7 || len(r.Countries) < 249 || r.Countries[0].Code != "AD" || r.Countries[0].Name != "Andorra" {
+		t.Fatalf("meta: %+v", r.Continents)
+	}
+}
@@ -0,0 +1,87 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	dbm "namedot/internal/db"
+)
+
+type lockReq struct {
+	Holder string `json:"holder"` // default: api
+	Reason string `json:"reason"`
+}
+
+// unlockedZone refuses changes to a zone locked for maintenance with 423.
+// Bad or unknown zone IDs and names are left to the handler.
+func (s *Server) unlockedZone(c *gin.Context) {
+	z, err := s.zoneByKey(c.Param("id"))
+	if err != nil {
+		c.Next()
+		return
+	}
+	if err := dbm.CheckZoneUnlocked(s.db, z.ID); errors.Is(err, dbm.ErrZoneLocked) {
+		c.AbortWithStatusJSON(http.StatusLocked, gin.H{"error": err.Error()})
+		return
+	}
+	c.Next()
+}
+
+// lockZone blocks changes to a zone through the API and the web admin until
+// it is unlocked. Locking again with the same holder updates the reason.
+func (s *Server) lockZone(c *gin.Context) {
+	var req lockReq
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+			return
+		}
+	}
+	if req.Holder == "" {
+		req.Holder = actor(c)
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	z, err := dbm.LockZone(s.db, uint(id), req.Holder, req.Reason)
+	switch {
+	case errors.Is(err, dbm.ErrZoneLocked):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.audit(c, dbm.AuditZoneLock, z, 0, z.LockedBy+": "+z.LockReason)
+	c.JSON(http.StatusOK, z)
+}
+
+func (s *Server) unlockZone(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	z, err := dbm.UnlockZone(s.db, uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if z.Locked() {
+		s.audit(c, dbm.AuditZoneUnlock, z, 0, "held by "+z.LockedBy)
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,70 @@
+package rest
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/config"
+	"namedot/internal/db"
+)
+
+func TestZoneLock_BlocksChanges(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server, gormDB, _ := setupZoneTestServer(t, &config.Config{APIToken: "testtoken"})
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer testtoken")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		return w
+	}
+
+	zone := db.Zone{Name: "lock.test."}
+	if err := gormDB.Create(&zone).Error; err != nil {
+		t.Fatalf("create zone: %v", err)
+	}
+	base := "/zones/" + strconv.Itoa(int(zone.ID))
+	rrset := `{"name":"www","type":"A","ttl":300,"records":[{"data":"192.0.2.1"}]}`
+
+	w := do("POST", base+"/lock", `{"holder":"alice","reason":"migration"}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"locked_by":"alice"`) {
+		t.Fatalf("lock: %d %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", base+"/lock", `{"holder":"bob"}`); w.Code != http.StatusConflict {
+		t.Fatalf("lock held by another holder: expected 409, got %d", w.Code)
+	}
+
+	for _, req := range []struct{ method, path, body string }{
+		{"POST", base + "/rrsets", rrset},
+		{"PUT", base + "/soa", `{"primary":"ns1.lock.test.","hostmaster":"h.lock.test."}`},
+		{"POST", base + "/import?format=bind", "www 300 IN A 192.0.2.1\n"},
+		{"DELETE", base, ""},
+	} {
+		w := do(req.method, req.path, req.body)
+		if w.Code != http.StatusLocked || !strings.Contains(w.Body.String(), "alice: migration") {
+			t.Fatalf("%s %s on locked zone: %d %s", req.method, req.path, w.Code, w.Body.String())
+		}
+	}
+	if w := do("GET", base+"/rrsets", ""); w.Code != http.StatusOK {
+		t.Fatalf("reads should work on locked zones, got %d", w.Code)
+	}
+
+	if w := do("DELETE", base+"/lock", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("unlock: expected 204, got %d", w.Code)
+	}
+	if w := do("POST", base+"/rrsets", rrset); w.Code != http.StatusCreated {
+		t.Fatalf("create after unlock: %d %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/zones/999/lock", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("lock missing zone: expected 404, got %d", w.Code)
+	}
+}
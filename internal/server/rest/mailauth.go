@@ -0,0 +1,86 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	dbm "namedot/internal/db"
+	"namedot/internal/mailauth"
+)
+
+type mailAuthReq struct {
+	mailauth.Request
+	TTL uint32 `json:"ttl"` // TTL of TXT RRSets that do not exist yet
+}
+
+type mailAuthResp struct {
+	mailauth.Result
+	Applied bool `json:"applied"`
+}
+
+// previewMailAuth builds the SPF, DKIM and DMARC records of a zone without
+// storing them.
+func (s *Server) previewMailAuth(c *gin.Context) {
+	s.mailAuth(c, false)
+}
+
+// applyMailAuth builds the records and stores them, replacing the SPF
+// record at the apex and the TXT records of the DKIM selector and _dmarc.
+func (s *Server) applyMailAuth(c *gin.Context) {
+	s.mailAuth(c, true)
+}
+
+func (s *Server) mailAuth(c *gin.Context, apply bool) {
+	var z dbm.Zone
+	if err := s.db.First(&z, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
+		return
+	}
+	var req mailAuthReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	res, err := mailauth.Build(c.Request.Context(), z.Name, req.Request, net.DefaultResolver)
+	if errors.Is(err, mailauth.ErrInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	out := mailAuthResp{Result: res}
+	if apply {
+		ttl := req.TTL
+		if ttl == 0 {
+			ttl = s.cfg.RecordDefaultTTL()
+		}
+		if err := s.cfg.RecordTTL.Check(ttl); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if out.Applied, err = mailauth.Apply(s.dbFor(c), z, res.Records, ttl); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if out.Applied {
+			names := make([]string, 0, len(res.Records))
+			for _, r := range res.Records {
+				names = append(names, r.Name)
+			}
+			s.audit(c, dbm.AuditMailAuth, z, 0, fmt.Sprintf("TXT %s", strings.Join(names, " ")))
+			dbm.TouchZone(s.db, z, s.cfg)
+			// Invalidate DNS cache after zone record change
+			if s.dnsServer != nil {
+				s.dnsServer.InvalidateZoneCache()
+			}
+		}
+	}
+	c.JSON(http.StatusOK, out)
+}
@@ -0,0 +1,73 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/config"
+	"namedot/internal/db"
+)
+
+func TestMailAuth_PreviewAndApply(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{APIToken: "testtoken", DefaultTTL: 600}
+	server, gormDB, _ := setupZoneTestServer(t, cfg)
+
+	do := func(path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest("POST", path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer testtoken")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		return w
+	}
+
+	zone := db.Zone{Name: "mailauth.test.", RRSets: []db.RRSet{{Name: "mailauth.test.", Type: "TXT", TTL: 300, Records: []db.RData{{Data: `"v=spf1 -all"`}}}}}
+	if err := gormDB.Create(&zone).Error; err != nil {
+		t.Fatalf("create zone: %v", err)
+	}
+	base := "/zones/" + strconv.Itoa(int(zone.ID)) + "/mailauth"
+	body := `{"spf":{"mx":true,"ip4":["192.0.2.10"]},"dmarc":{"policy":"reject","rua":["dmarc@mailauth.test"]}}`
+
+	w := do(base+"/preview", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("preview: %d %s", w.Code, w.Body.String())
+	}
+	var resp mailAuthResp
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Records) != 2 || resp.Records[0].Data != `"v=spf1 mx ip4:192.0.2.10 -all"` || resp.Lookups != 1 || resp.Applied {
+		t.Fatalf("preview: %+v", resp)
+	}
+	var n int64
+	gormDB.Model(&db.RRSet{}).Where("zone_id = ?", zone.ID).Count(&n)
+	if n != 1 {
+		t.Fatalf("preview stored records: %d rrsets", n)
+	}
+
+	if w := do(base+"/preview", `{"dmarc":{"policy":"block"}}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid policy: %d", w.Code)
+	}
+
+	w = do(base, body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("apply: %d %s", w.Code, w.Body.String())
+	}
+	var apex db.RRSet
+	gormDB.Preload("Records").Where("zone_id = ? AND name = ? AND type = ?", zone.ID, "mailauth.test.", "TXT").First(&apex)
+	if len(apex.Records) != 1 || apex.Records[0].Data != `"v=spf1 mx ip4:192.0.2.10 -all"` {
+		t.Fatalf("apex TXT: %+v", apex.Records)
+	}
+	var dmarc db.RRSet
+	if err := gormDB.Where("zone_id = ? AND name = ?", zone.ID, "_dmarc.mailauth.test.").First(&dmarc).Error; err != nil || dmarc.TTL != 600 {
+		t.Fatalf("dmarc rrset: %+v %v", dmarc, err)
+	}
+}
@@ -0,0 +1,15 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/geoip"
+)
+
+// metaGeo lists the country and continent codes accepted by the geo
+// selectors of records, for autocomplete in UIs.
+func (s *Server) metaGeo(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"countries": geoip.Countries, "continents": geoip.Continents})
+}
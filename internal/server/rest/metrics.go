@@ -0,0 +1,65 @@
+package rest
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/metrics"
+)
+
+// metricsHandler serves the metrics registry in the Prometheus text format.
+func (s *Server) metricsHandler(c *gin.Context) {
+	var b bytes.Buffer
+	if err := metrics.Default.WriteText(&b); err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", b.Bytes())
+}
+
+// metricsRules serves the alerting rules bundled with the metrics as a
+// Prometheus rule file.
+func (s *Server) metricsRules(c *gin.Context) {
+	var b bytes.Buffer
+	if err := metrics.Default.WriteRules(&b); err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.Data(http.StatusOK, "application/yaml; charset=utf-8", b.Bytes())
+}
+
+// sdTarget is one entry of the Prometheus HTTP service discovery format.
+type sdTarget struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// metricsTargets lists the instances to scrape for Prometheus http_sd_configs:
+// this one, as the scraper reached it, and on a master the slaves that pulled
+// /sync/export recently. Slaves are assumed to serve metrics on the same port.
+func (s *Server) metricsTargets(c *gin.Context) {
+	self := c.Request.Host
+	if self == "" {
+		self = s.cfg.RESTListen
+	}
+	role := s.cfg.Replication.Mode
+	if role == "" {
+		role = "standalone"
+	}
+	out := []sdTarget{{Targets: []string{self}, Labels: map[string]string{"role": role}}}
+	_, port, err := net.SplitHostPort(self)
+	if err != nil {
+		_, port, _ = net.SplitHostPort(s.cfg.RESTListen)
+	}
+	for _, sl := range s.slaves.Slaves() {
+		labels := map[string]string{"role": "slave"}
+		if sl.Name != "" {
+			labels["name"] = sl.Name
+		}
+		out = append(out, sdTarget{Targets: []string{net.JoinHostPort(sl.Addr, port)}, Labels: labels})
+	}
+	c.JSON(http.StatusOK, out)
+}
@@ -0,0 +1,60 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/config"
+	"namedot/internal/metrics"
+)
+
+var testMetric = metrics.NewCounter("namedot_test_rest_total", "Counter for the /metrics test.")
+
+func TestMetricsEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	testMetric.Inc()
+
+	server, _, _ := setupZoneTestServer(t, &config.Config{APIToken: "testtoken", Metrics: config.MetricsConfig{Enabled: true}})
+	w := httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "namedot_test_rest_total 1\n") ||
+		!strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("metrics: %d %q\n%s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+
+	// The bundled rules, e.g. the one shipped with the replication metrics
+	w = httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics/rules", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "alert: NamedotReplicationStale") ||
+		!strings.Contains(w.Body.String(), "namedot_replication_last_success_timestamp_seconds") {
+		t.Fatalf("rules: %d\n%s", w.Code, w.Body.String())
+	}
+
+	server.cfg.Replication.Mode = "master"
+	server.slaves.Seen("192.0.2.7", "ns2", 3)
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/metrics/targets", nil)
+	req.Host = "ns1.example.test:8080"
+	server.r.ServeHTTP(w, req)
+	var targets []sdTarget
+	if err := json.Unmarshal(w.Body.Bytes(), &targets); err != nil || len(targets) != 2 ||
+		targets[0].Targets[0] != "ns1.example.test:8080" || targets[0].Labels["role"] != "master" ||
+		targets[1].Targets[0] != "192.0.2.7:8080" || targets[1].Labels["name"] != "ns2" {
+		t.Fatalf("targets: %d %s", w.Code, w.Body.String())
+	}
+
+	// Not served unless enabled
+	server, _, _ = setupZoneTestServer(t, &config.Config{APIToken: "testtoken"})
+	for _, path := range []string{"/metrics", "/metrics/rules", "/metrics/targets"} {
+		w = httptest.NewRecorder()
+		server.r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("disabled %s: %d", path, w.Code)
+		}
+	}
+}
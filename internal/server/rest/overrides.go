@@ -0,0 +1,67 @@
+package rest
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/config"
+	dbm "namedot/internal/db"
+)
+
+// effectiveSettings are the runtime-tunable settings in use: the overrides
+// where set, the config file otherwise.
+type effectiveSettings struct {
+	DefaultTTL  uint32 `json:"default_ttl"`
+	NegativeTTL uint32 `json:"negative_ttl"`
+	DNSVerbose  bool   `json:"dns_verbose"`
+	Forwarder   string `json:"forwarder"`
+}
+
+type settingsResp struct {
+	Overrides config.Overrides  `json:"overrides"`
+	Effective effectiveSettings `json:"effective"`
+}
+
+func (s *Server) settingsResp() settingsResp {
+	return settingsResp{
+		Overrides: s.cfg.Overrides(),
+		Effective: effectiveSettings{
+			DefaultTTL:  s.cfg.RecordDefaultTTL(),
+			NegativeTTL: s.cfg.NegativeCacheTTL(),
+			DNSVerbose:  s.cfg.DNSVerbose(),
+			Forwarder:   s.cfg.ForwarderHost(),
+		},
+	}
+}
+
+func (s *Server) getSettings(c *gin.Context) {
+	c.JSON(http.StatusOK, s.settingsResp())
+}
+
+// putSettings replaces the runtime overrides and applies them at once;
+// fields left out fall back to the config file. Slaves take them over with
+// the next sync.
+func (s *Server) putSettings(c *gin.Context) {
+	var req config.Overrides
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	if req.Forwarder != nil {
+		f := strings.TrimSpace(*req.Forwarder)
+		req.Forwarder = &f
+	}
+	if err := s.cfg.CheckOverrides(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := dbm.SaveOverrides(s.db, req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.cfg.SetOverrides(req)
+	s.audit(c, dbm.AuditConfigUpdate, dbm.Zone{}, 0, req.String())
+	c.JSON(http.StatusOK, s.settingsResp())
+}
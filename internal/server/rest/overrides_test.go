@@ -0,0 +1,95 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/config"
+	"namedot/internal/db"
+)
+
+func TestRuntimeSettings(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{APIToken: "testtoken", DefaultTTL: 300, Forwarder: "192.0.2.53",
+		RecordTTL: config.RecordTTLConfig{Max: 3600}}
+	server, gormDB, _ := setupZoneTestServer(t, cfg)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer testtoken")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/settings", `{"default_ttl":86400}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("ttl above record_ttl.max: %d", w.Code)
+	}
+	if w := do("PUT", "/settings", `{"forwarder":"bad host"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("bad forwarder: %d", w.Code)
+	}
+	w := do("PUT", "/settings", `{"default_ttl":600,"negative_ttl":30,"forwarder":""}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("put: %d %s", w.Code, w.Body.String())
+	}
+	var resp settingsResp
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Effective != (effectiveSettings{DefaultTTL: 600, NegativeTTL: 30, Forwarder: ""}) || resp.Overrides.DNSVerbose != nil {
+		t.Fatalf("effective: %+v", resp)
+	}
+
+	// Applied without a restart: records written without a TTL get the new default
+	zone := db.Zone{Name: "settings.test."}
+	if err := gormDB.Create(&zone).Error; err != nil {
+		t.Fatalf("create zone: %v", err)
+	}
+	if w := do("POST", fmt.Sprintf("/zones/%d/rrsets", zone.ID), `{"name":"www","type":"A","records":[{"data":"192.0.2.1"}]}`); w.Code != http.StatusCreated {
+		t.Fatalf("create rrset: %d %s", w.Code, w.Body.String())
+	}
+	var rrset db.RRSet
+	gormDB.Where("name = ?", "www.settings.test.").First(&rrset)
+	if rrset.TTL != 600 {
+		t.Fatalf("rrset ttl %d, want the overridden 600", rrset.TTL)
+	}
+
+	// The overrides go to slaves with the zones
+	w = do("GET", "/sync/export", "")
+	var data SyncData
+	if err := json.Unmarshal(w.Body.Bytes(), &data); err != nil || data.Settings == nil || *data.Settings.DefaultTTL != 600 {
+		t.Fatalf("export settings: %v %s", err, w.Body.String())
+	}
+	slaveCfg := &config.Config{APIToken: "testtoken", DefaultTTL: 300}
+	slave, slaveDB, _ := setupZoneTestServer(t, slaveCfg)
+	body, _ := json.Marshal(data)
+	req := httptest.NewRequest("POST", "/sync/import", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer testtoken")
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	slave.r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || slaveCfg.RecordDefaultTTL() != 600 || slaveCfg.NegativeCacheTTL() != 30 {
+		t.Fatalf("slave import: %d %s", rec.Code, rec.Body.String())
+	}
+	if o, err := db.LoadOverrides(slaveDB); err != nil || o.Forwarder == nil || *o.Forwarder != "" {
+		t.Fatalf("slave stored settings: %+v %v", o, err)
+	}
+
+	// An empty body drops the overrides again
+	if w := do("PUT", "/settings", `{}`); w.Code != http.StatusOK || cfg.RecordDefaultTTL() != 300 || cfg.ForwarderHost() != "192.0.2.53" {
+		t.Fatalf("reset: %d %s", w.Code, w.Body.String())
+	}
+	var n int64
+	gormDB.Model(&db.AuditEntry{}).Where("action = ?", db.AuditConfigUpdate).Count(&n)
+	if n != 2 {
+		t.Fatalf("config.update audit entries: %d", n)
+	}
+}
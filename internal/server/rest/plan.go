@@ -0,0 +1,178 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+
+	dbm "namedot/internal/db"
+	"namedot/internal/server/rest/zoneio"
+)
+
+// zonePlanReq is the desired contents of a zone for the plan and apply
+// routes used by declarative tools such as octoDNS.
+type zonePlanReq struct {
+	Serial *uint32    `json:"serial"` // apply only: refuse with 409 unless the zone still has this serial
+	RRSets []rrsetReq `json:"rrsets"`
+}
+
+// desiredRRSets validates and normalizes the rrsets of a plan request. Names
+// may be relative to the zone ("" or "@" for the apex) or absolute.
+func (s *Server) desiredRRSets(z dbm.Zone, req zonePlanReq) ([]dbm.RRSet, error) {
+	out := make([]dbm.RRSet, 0, len(req.RRSets))
+	seen := map[string]bool{}
+	for _, r := range req.RRSets {
+		name := ownerName(r.Name, z.Name)
+		if !dns.IsSubDomain(z.Name, name) {
+			return nil, fmt.Errorf("%s is outside zone %s", name, z.Name)
+		}
+		rtype := strings.ToUpper(strings.TrimSpace(r.Type))
+		if _, known := dns.StringToType[rtype]; !known {
+			return nil, fmt.Errorf("%s: unknown record type %q", name, r.Type)
+		}
+		if seen[name+" "+rtype] {
+			return nil, fmt.Errorf("%s %s is listed twice", name, rtype)
+		}
+		seen[name+" "+rtype] = true
+		recs := r.recordsNormalized()
+		if len(recs) == 0 {
+			return nil, fmt.Errorf("%s %s has no records", name, rtype)
+		}
+		if rtype == "CNAME" {
+			for i := range recs {
+				if recs[i].Data == "@" {
+					recs[i].Data = fqdn("@", z.Name)
+				}
+			}
+		}
+		ttl := r.TTL
+		if ttl == 0 {
+			ttl = s.cfg.RecordDefaultTTL()
+		}
+		set := dbm.RRSet{ZoneID: z.ID, Name: name, Type: rtype, TTL: ttl, Comment: r.Comment, DynamicURL: r.dynamicURL(), Records: recs}
+		if err := dbm.CheckRRSetTTL(s.cfg.RecordTTL, set); err != nil {
+			return nil, err
+		}
+		if err := dbm.CheckRecordSelectors(set); err != nil {
+			return nil, err
+		}
+		out = append(out, set)
+	}
+	return out, nil
+}
+
+// bindPlan loads the zone and the desired rrsets of a plan or apply request,
+// answering the request itself on errors.
+func (s *Server) bindPlan(c *gin.Context) (dbm.Zone, zonePlanReq, []dbm.RRSet, bool) {
+	var req zonePlanReq
+	z, err := s.zoneByKey(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
+		return z, req, nil, false
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return z, req, nil, false
+	}
+	desired, err := s.desiredRRSets(z, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return z, req, nil, false
+	}
+	return z, req, desired, true
+}
+
+// planZone returns the changes that applying the desired rrsets would make,
+// without making them.
+func (s *Server) planZone(c *gin.Context) {
+	z, _, desired, ok := s.bindPlan(c)
+	if !ok {
+		return
+	}
+	if err := s.db.Preload("RRSets.Records").First(&z, z.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, zoneio.Plan(&z, desired))
+}
+
+// applyZone replaces the zone contents, except the SOA, with the desired
+// rrsets in one transaction and returns the changes made.
+func (s *Server) applyZone(c *gin.Context) {
+	z, req, desired, ok := s.bindPlan(c)
+	if !ok {
+		return
+	}
+	plan, err := zoneio.ApplyPlan(s.dbFor(c), z.ID, desired, req.Serial)
+	if errors.Is(err, zoneio.ErrStalePlan) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.recordPlan(c, z, plan, dbm.AuditZoneImport, "plan apply")
+	c.JSON(http.StatusOK, plan)
+}
+
+// zoneReplaceResp is the outcome of replacing a zone's contents.
+type zoneReplaceResp struct {
+	Serial    uint32              `json:"serial"` // serial after the replace
+	Changes   []zoneio.PlanChange `json:"changes"`
+	Unchanged int                 `json:"unchanged"`
+}
+
+// replaceZone answers PUT /zones/{id}/rrsets: the zone ends up holding
+// exactly the rrsets in the body, except the SOA, with the changes and the
+// serial bump made in one transaction. Unlike apply, a client never sees the
+// new contents under the old serial.
+func (s *Server) replaceZone(c *gin.Context) {
+	z, req, desired, ok := s.bindPlan(c)
+	if !ok {
+		return
+	}
+	plan, serial, err := zoneio.ReplaceZone(s.dbFor(c), z.ID, desired, req.Serial, s.cfg)
+	if errors.Is(err, zoneio.ErrStalePlan) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(plan.Changes) > 0 {
+		s.audit(c, dbm.AuditZoneImport, z, 0, planSummary("replace", plan))
+		if s.dnsServer != nil {
+			s.dnsServer.InvalidateZoneCache()
+		}
+	}
+	c.JSON(http.StatusOK, zoneReplaceResp{Serial: serial, Changes: plan.Changes, Unchanged: plan.Unchanged})
+}
+
+// recordPlan bumps the serial, audits and reloads a zone after a plan made
+// changes to it.
+func (s *Server) recordPlan(c *gin.Context, z dbm.Zone, plan *zoneio.ZonePlan, action, what string) {
+	if len(plan.Changes) == 0 {
+		return
+	}
+	dbm.TouchZone(s.db, z, s.cfg)
+	s.audit(c, action, z, 0, planSummary(what, plan))
+	if s.dnsServer != nil {
+		s.dnsServer.InvalidateZoneCache()
+	}
+}
+
+// planSummary counts the changes of a plan for the audit log.
+func planSummary(what string, plan *zoneio.ZonePlan) string {
+	counts := map[string]int{}
+	for _, ch := range plan.Changes {
+		counts[ch.Action]++
+	}
+	return fmt.Sprintf("%s: %d created, %d updated, %d deleted",
+		what, counts[zoneio.PlanCreate], counts[zoneio.PlanUpdate], counts[zoneio.PlanDelete])
+}
@@ -0,0 +1,112 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/config"
+	"namedot/internal/db"
+	"namedot/internal/server/rest/zoneio"
+)
+
+func TestZonePlanAndApply(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{APIToken: "testtoken", DefaultTTL: 300, SOA: config.SOAConfig{AutoOnMissing: true}}
+	server, gormDB, _ := setupZoneTestServer(t, cfg)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer testtoken")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		return w
+	}
+
+	zone := db.Zone{Name: "plan.test.", RRSets: []db.RRSet{
+		{Name: "www.plan.test.", Type: "A", TTL: 300, Records: []db.RData{{Data: "192.0.2.1"}}},
+		{Name: "old.plan.test.", Type: "A", TTL: 300, Records: []db.RData{{Data: "192.0.2.9"}}},
+		{Name: "mail.plan.test.", Type: "A", TTL: 300, Comment: "keep", Records: []db.RData{{Data: "192.0.2.5"}}},
+	}}
+	if err := gormDB.Create(&zone).Error; err != nil {
+		t.Fatalf("create zone: %v", err)
+	}
+	db.TouchZone(gormDB, zone, cfg)
+	gormDB.First(&zone, zone.ID)
+	var mail db.RRSet
+	gormDB.Preload("Records").Where("name = ?", "mail.plan.test.").First(&mail)
+
+	desired := `"rrsets":[
+		{"name":"www","type":"A","ttl":300,"records":[{"data":"192.0.2.2","country":"de"}]},
+		{"name":"mail","type":"a","records":[{"data":"192.0.2.5"}]},
+		{"name":"","type":"MX","ttl":600,"records":[{"data":"10 mail.plan.test."}]}]`
+
+	w := do("POST", "/zones/plan.test/plan", "{"+desired+"}")
+	if w.Code != http.StatusOK {
+		t.Fatalf("plan: %d %s", w.Code, w.Body.String())
+	}
+	var plan zoneio.ZonePlan
+	if err := json.Unmarshal(w.Body.Bytes(), &plan); err != nil {
+		t.Fatalf("decode plan: %v", err)
+	}
+	got := map[string]string{}
+	for _, ch := range plan.Changes {
+		got[ch.Name+" "+ch.Type] = ch.Action
+	}
+	want := map[string]string{"www.plan.test. A": "update", "old.plan.test. A": "delete", "plan.test. MX": "create"}
+	if fmt.Sprint(got) != fmt.Sprint(want) || plan.Unchanged != 1 || plan.Serial != zone.Serial {
+		t.Fatalf("plan: %+v", plan)
+	}
+	var n int64
+	gormDB.Model(&db.RRSet{}).Where("zone_id = ? AND name = ?", zone.ID, "old.plan.test.").Count(&n)
+	if n != 1 {
+		t.Fatal("plan should not change the zone")
+	}
+
+	if w := do("POST", "/zones/plan.test/apply", fmt.Sprintf(`{"serial":%d,%s}`, zone.Serial+1, desired)); w.Code != http.StatusConflict {
+		t.Fatalf("stale serial: %d %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/zones/plan.test/apply", `{"rrsets":[{"name":"www.other.test.","type":"A","records":[{"data":"192.0.2.1"}]}]}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("out-of-zone rrset: %d", w.Code)
+	}
+	w = do("POST", "/zones/plan.test/apply", fmt.Sprintf(`{"serial":%d,%s}`, zone.Serial, desired))
+	if w.Code != http.StatusOK {
+		t.Fatalf("apply: %d %s", w.Code, w.Body.String())
+	}
+
+	var sets []db.RRSet
+	gormDB.Preload("Records").Where("zone_id = ?", zone.ID).Order("name, type").Find(&sets)
+	byKey := map[string]db.RRSet{}
+	for _, rs := range sets {
+		byKey[rs.Name+" "+rs.Type] = rs
+	}
+	if _, ok := byKey["old.plan.test. A"]; ok {
+		t.Fatal("old rrset should be deleted")
+	}
+	if _, ok := byKey["plan.test. SOA"]; !ok {
+		t.Fatal("SOA should be kept")
+	}
+	if www := byKey["www.plan.test. A"]; len(www.Records) != 1 || www.Records[0].Country == nil || *www.Records[0].Country != "DE" {
+		t.Fatalf("www: %+v", www)
+	}
+	if m := byKey["mail.plan.test. A"]; m.ID != mail.ID || m.Records[0].ID != mail.Records[0].ID || m.Comment != "keep" {
+		t.Fatalf("unchanged rrset was rewritten: %+v", m)
+	}
+	if mx := byKey["plan.test. MX"]; mx.TTL != 600 {
+		t.Fatalf("mx: %+v", mx)
+	}
+
+	w = do("POST", "/zones/plan.test/plan", "{"+desired+"}")
+	plan = zoneio.ZonePlan{}
+	_ = json.Unmarshal(w.Body.Bytes(), &plan)
+	if len(plan.Changes) != 0 || plan.Unchanged != 3 {
+		t.Fatalf("plan after apply: %+v", plan)
+	}
+}
@@ -0,0 +1,112 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/querylog"
+	dnssrv "namedot/internal/server/dns"
+)
+
+// maxQueryLogLimit bounds the entries one search returns.
+const maxQueryLogLimit = 10000
+
+// queryLogSearcher is implemented by DNS servers that keep a query log.
+type queryLogSearcher interface {
+	SearchQueryLog(f querylog.Filter) ([]querylog.Entry, error)
+}
+
+// searchQueryLog returns the most recent logged DNS queries, newest first.
+// Query params: qname (the name and names below it), qtype, client (address
+// or CIDR), source, zone, rcode, from/to (RFC3339), limit (default 100) and
+// format=json|jsonl, jsonl being a download with one entry per line.
+func (s *Server) searchQueryLog(c *gin.Context) {
+	l, ok := s.dnsServer.(queryLogSearcher)
+	if !ok || !s.cfg.QueryLog.Enabled {
+		c.JSON(http.StatusNotFound, gin.H{"error": dnssrv.ErrQueryLogDisabled.Error()})
+		return
+	}
+	format := strings.ToLower(c.DefaultQuery("format", "json"))
+	if format != "json" && format != "jsonl" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported format"})
+		return
+	}
+	f := querylog.Filter{
+		Name:   strings.TrimSpace(c.Query("qname")),
+		Type:   strings.TrimSpace(c.Query("qtype")),
+		Source: strings.ToLower(strings.TrimSpace(c.Query("source"))),
+		Zone:   strings.TrimSpace(c.Query("zone")),
+		Rcode:  strings.TrimSpace(c.Query("rcode")),
+	}
+	if v := c.Query("client"); v != "" {
+		p, err := parseClient(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid client: expected an IP address or CIDR"})
+			return
+		}
+		f.Client = p
+	}
+	for _, t := range []struct {
+		param string
+		dst   *time.Time
+	}{{"from", &f.Since}, {"to", &f.Until}} {
+		if v := c.Query(t.param); v != "" {
+			at, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + t.param + ": expected RFC3339"})
+				return
+			}
+			*t.dst = at
+		}
+	}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxQueryLogLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit: expected 1-" + strconv.Itoa(maxQueryLogLimit)})
+			return
+		}
+		f.Limit = n
+	}
+	entries, err := l.SearchQueryLog(f)
+	if errors.Is(err, dnssrv.ErrQueryLogDisabled) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if format == "jsonl" {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		for _, e := range entries {
+			_ = enc.Encode(e)
+		}
+		c.Header("Content-Disposition", `attachment; filename="query-log.jsonl"`)
+		c.Data(http.StatusOK, "application/x-ndjson", buf.Bytes())
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+// parseClient parses an IP address or a CIDR into a prefix.
+func parseClient(v string) (netip.Prefix, error) {
+	if strings.Contains(v, "/") {
+		p, err := netip.ParsePrefix(v)
+		return p.Masked(), err
+	}
+	a, err := netip.ParseAddr(v)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	a = a.Unmap()
+	return netip.PrefixFrom(a, a.BitLen()), nil
+}
@@ -0,0 +1,76 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/config"
+	"namedot/internal/querylog"
+)
+
+// queryLogDNS is a DNS server with a fixed query log that keeps the last
+// filter searched with.
+type queryLogDNS struct {
+	mockDNSServer
+	filter querylog.Filter
+}
+
+func (d *queryLogDNS) SearchQueryLog(f querylog.Filter) ([]querylog.Entry, error) {
+	d.filter = f
+	return []querylog.Entry{
+		{Name: "www.example.com.", Type: "A", Client: "192.0.2.1", Source: "local", Rule: "country=DE", Rcode: "NOERROR", Answers: []string{"www.example.com. 60 IN A 192.0.2.10"}},
+		{Name: "www.example.com.", Type: "A", Client: "192.0.2.2", Source: "cache", Rcode: "NOERROR"},
+	}, nil
+}
+
+func TestSearchQueryLog(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dns := &queryLogDNS{}
+	get := func(cfg *config.Config, query string) *httptest.ResponseRecorder {
+		server := NewServer(cfg, setupTestDB(t), dns)
+		req := httptest.NewRequest("GET", "/debug/query-log"+query, nil)
+		req.Header.Set("Authorization", "Bearer testtoken")
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := get(&config.Config{APIToken: "testtoken"}, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("disabled: %d %s", w.Code, w.Body.String())
+	}
+	cfg := &config.Config{APIToken: "testtoken", QueryLog: config.QueryLogConfig{Enabled: true, Path: "unused"}}
+	w := get(cfg, "?qname=example.com&qtype=a&client=192.0.2.0/24&from=2026-10-01T00:00:00Z&limit=5")
+	var got []querylog.Entry
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || w.Code != http.StatusOK || len(got) != 2 {
+		t.Fatalf("search: %d %s", w.Code, w.Body.String())
+	}
+	if f := dns.filter; f.Name != "example.com" || f.Type != "a" || f.Client != netip.MustParsePrefix("192.0.2.0/24") ||
+		f.Since.IsZero() || !f.Until.IsZero() || f.Limit != 5 {
+		t.Fatalf("filter: %+v", f)
+	}
+	if got[0].Rule != "country=DE" || len(got[0].Answers) != 1 {
+		t.Fatalf("entry: %+v", got[0])
+	}
+	if w := get(cfg, "?client=192.0.2.1"); w.Code != http.StatusOK || dns.filter.Client != netip.MustParsePrefix("192.0.2.1/32") {
+		t.Fatalf("single client: %d %+v", w.Code, dns.filter)
+	}
+
+	// Export as JSON lines
+	w = get(cfg, "?format=jsonl")
+	if w.Code != http.StatusOK || strings.Count(w.Body.String(), "\n") != 2 ||
+		!strings.Contains(w.Header().Get("Content-Disposition"), "query-log.jsonl") {
+		t.Fatalf("jsonl: %d %q\n%s", w.Code, w.Header().Get("Content-Disposition"), w.Body.String())
+	}
+
+	for _, q := range []string{"?client=nope", "?from=yesterday", "?limit=0", "?limit=100000", "?format=csv"} {
+		if w := get(cfg, q); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", q, w.Code)
+		}
+	}
+}
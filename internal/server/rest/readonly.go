@@ -0,0 +1,101 @@
+package rest
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readOnlyState is the runtime read-only switch. It is not persisted: a
+// restart always comes up writable.
+type readOnlyState struct {
+	mu     sync.RWMutex
+	on     bool
+	reason string
+	since  time.Time
+}
+
+type readOnlyReq struct {
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason"`
+}
+
+type readOnlyResp struct {
+	Enabled bool       `json:"enabled"`
+	Reason  string     `json:"reason,omitempty"`
+	Since   *time.Time `json:"since,omitempty"`
+}
+
+// SetReadOnly switches the server in or out of read-only mode. While it is
+// on, the API and the web admin refuse every change with 503 and DNS keeps
+// answering from the database as usual.
+func (s *Server) SetReadOnly(on bool, reason string) {
+	s.ro.mu.Lock()
+	defer s.ro.mu.Unlock()
+	switch {
+	case on && !s.ro.on:
+		s.ro.since = time.Now()
+		log.Printf("Read-only mode enabled: %s", reason)
+	case !on && s.ro.on:
+		log.Printf("Read-only mode disabled")
+	}
+	if !on {
+		reason = ""
+	}
+	s.ro.on, s.ro.reason = on, reason
+}
+
+// ReadOnly reports whether the server is in read-only mode, and why.
+func (s *Server) ReadOnly() (bool, string) {
+	s.ro.mu.RLock()
+	defer s.ro.mu.RUnlock()
+	return s.ro.on, s.ro.reason
+}
+
+func (s *Server) readOnlyStatus() readOnlyResp {
+	s.ro.mu.RLock()
+	defer s.ro.mu.RUnlock()
+	resp := readOnlyResp{Enabled: s.ro.on, Reason: s.ro.reason}
+	if s.ro.on {
+		since := s.ro.since
+		resp.Since = &since
+	}
+	return resp
+}
+
+// writable refuses every request but GET and HEAD with 503 while the server
+// is read-only. Slave syncs arrive through /sync/import and wait as well.
+func (s *Server) writable(c *gin.Context) {
+	if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+		c.Next()
+		return
+	}
+	if on, reason := s.ReadOnly(); on {
+		msg := "server is in read-only mode"
+		if reason != "" {
+			msg += ": " + reason
+		}
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": msg})
+		return
+	}
+	c.Next()
+}
+
+func (s *Server) getReadOnly(c *gin.Context) {
+	c.JSON(http.StatusOK, s.readOnlyStatus())
+}
+
+// setReadOnly is the API toggle; it is reachable while read-only so the mode
+// can be left again.
+func (s *Server) setReadOnly(c *gin.Context) {
+	var req readOnlyReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	s.SetReadOnly(req.Enabled, req.Reason)
+	c.JSON(http.StatusOK, s.readOnlyStatus())
+}
@@ -0,0 +1,62 @@
+package rest
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/config"
+)
+
+func TestReadOnly_RejectsWrites(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server, _, _ := setupZoneTestServer(t, &config.Config{APIToken: "testtoken"})
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer testtoken")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PUT", "/readonly", `{"enabled":true,"reason":"db failover"}`); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"since"`) {
+		t.Fatalf("enable: %d %s", w.Code, w.Body.String())
+	}
+	for _, req := range []struct{ method, path, body string }{
+		{"POST", "/zones", `{"name":"ro.test"}`},
+		{"POST", "/hosts", `{"name":"h","ip":"192.0.2.1"}`},
+		{"POST", "/sync/import", `{}`},
+	} {
+		w := do(req.method, req.path, req.body)
+		if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "read-only mode: db failover") {
+			t.Fatalf("%s %s while read-only: %d %s", req.method, req.path, w.Code, w.Body.String())
+		}
+	}
+	if w := do("GET", "/zones", ""); w.Code != http.StatusOK {
+		t.Fatalf("reads should work while read-only, got %d", w.Code)
+	}
+	if w := do("GET", "/health", ""); !strings.Contains(w.Body.String(), `"read_only":true`) {
+		t.Fatalf("health: %s", w.Body.String())
+	}
+	req := httptest.NewRequest("PUT", "/readonly", bytes.NewBufferString(`{"enabled":false}`))
+	w := httptest.NewRecorder()
+	server.r.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("toggle without token: expected 401, got %d", w.Code)
+	}
+
+	server.SetReadOnly(false, "")
+	if w := do("GET", "/readonly", ""); strings.TrimSpace(w.Body.String()) != `{"enabled":false}` {
+		t.Fatalf("status after disable: %s", w.Body.String())
+	}
+	if w := do("POST", "/zones", `{"name":"ro.test"}`); w.Code != http.StatusCreated {
+		t.Fatalf("create after disable: %d %s", w.Code, w.Body.String())
+	}
+}
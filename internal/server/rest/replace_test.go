@@ -0,0 +1,81 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/config"
+	"namedot/internal/db"
+)
+
+func TestReplaceZone(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{APIToken: "testtoken", DefaultTTL: 300, SOA: config.SOAConfig{AutoOnMissing: true}}
+	server, gormDB, _ := setupZoneTestServer(t, cfg)
+
+	do := func(body string) (*httptest.ResponseRecorder, zoneReplaceResp) {
+		t.Helper()
+		req := httptest.NewRequest("PUT", "/zones/replace.test/rrsets", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer testtoken")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		var resp zoneReplaceResp
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp
+	}
+
+	zone := db.Zone{Name: "replace.test.", RRSets: []db.RRSet{
+		{Name: "www.replace.test.", Type: "A", TTL: 300, Records: []db.RData{{Data: "192.0.2.1"}}},
+		{Name: "old.replace.test.", Type: "A", TTL: 300, Records: []db.RData{{Data: "192.0.2.9"}}},
+	}}
+	if err := gormDB.Create(&zone).Error; err != nil {
+		t.Fatalf("create zone: %v", err)
+	}
+	db.TouchZone(gormDB, zone, cfg)
+	gormDB.First(&zone, zone.ID)
+
+	desired := `"rrsets":[
+		{"name":"www","type":"A","ttl":300,"records":[{"data":"192.0.2.2"}]},
+		{"name":"@","type":"MX","ttl":600,"records":[{"data":"10 mail.replace.test."}]}]`
+	if w, _ := do(`{"rrsets":[{"name":"x.other.test.","type":"A","records":[{"data":"192.0.2.1"}]}]}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("outside zone: %d", w.Code)
+	}
+	if w, _ := do(fmt.Sprintf(`{"serial":%d,%s}`, zone.Serial+1, desired)); w.Code != http.StatusConflict {
+		t.Fatalf("stale serial: %d", w.Code)
+	}
+
+	w, resp := do(fmt.Sprintf(`{"serial":%d,%s}`, zone.Serial, desired))
+	if w.Code != http.StatusOK || len(resp.Changes) != 3 {
+		t.Fatalf("replace: %d %s", w.Code, w.Body.String())
+	}
+	var after db.Zone
+	gormDB.Preload("RRSets.Records").First(&after, zone.ID)
+	if resp.Serial == zone.Serial || after.Serial != resp.Serial {
+		t.Fatalf("serial: before %d, response %d, stored %d", zone.Serial, resp.Serial, after.Serial)
+	}
+	types := map[string]string{}
+	for _, rs := range after.RRSets {
+		types[rs.Name+" "+rs.Type] = rs.Records[0].Data
+	}
+	if len(types) != 3 || types["www.replace.test. A"] != "192.0.2.2" || types["replace.test. MX"] == "" || types["replace.test. SOA"] == "" {
+		t.Fatalf("zone contents: %v", types)
+	}
+
+	// Sending the same contents again changes nothing, not even the serial
+	w, resp = do(`{` + desired + `}`)
+	if w.Code != http.StatusOK || len(resp.Changes) != 0 || resp.Unchanged != 2 || resp.Serial != after.Serial {
+		t.Fatalf("repeat: %d %s", w.Code, w.Body.String())
+	}
+	var n int64
+	gormDB.Model(&db.AuditEntry{}).Where("action = ?", db.AuditZoneImport).Count(&n)
+	if n != 1 {
+		t.Fatalf("zone.import audit entries: %d", n)
+	}
+}
@@ -12,6 +12,7 @@ import (
 
 	"namedot/internal/config"
 	dbm "namedot/internal/db"
+	"namedot/internal/replication"
 )
 
 func stringPtr(s string) *string {
@@ -33,6 +34,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 		&dbm.RData{},
 		&dbm.Template{},
 		&dbm.TemplateRecord{},
+		&dbm.Setting{},
 	); err != nil {
 		t.Fatalf("failed to migrate db: %v", err)
 	}
@@ -282,6 +284,50 @@ func TestSyncImport(t *testing.T) {
 			wantStatus:  http.StatusOK,
 			description: "Should create new zone with records",
 		},
+		{
+			name: "import disabled zone and record",
+			setupExisting: func(db *gorm.DB) {
+				db.Create(&dbm.Zone{Name: "paused.com."})
+			},
+			importData: SyncData{
+				Zones: []dbm.Zone{
+					{
+						Name:     "paused.com",
+						Disabled: true,
+						RRSets: []dbm.RRSet{
+							{
+								Name: "@",
+								Type: "A",
+								TTL:  300,
+								Records: []dbm.RData{
+									{Data: "192.168.1.1"},
+									{Data: "192.168.1.2", Disabled: true},
+								},
+							},
+						},
+					},
+				},
+			},
+			verify: func(t *testing.T, db *gorm.DB) {
+				var zone dbm.Zone
+				if err := db.Preload("RRSets.Records").Where("name = ?", "paused.com.").First(&zone).Error; err != nil {
+					t.Fatalf("load zone: %v", err)
+				}
+				if !zone.Disabled {
+					t.Error("zone disabled on the master should be disabled on the slave")
+				}
+				if len(zone.RRSets) != 1 || len(zone.RRSets[0].Records) != 2 {
+					t.Fatalf("unexpected rrsets: %+v", zone.RRSets)
+				}
+				for _, r := range zone.RRSets[0].Records {
+					if r.Disabled != (r.Data == "192.168.1.2") {
+						t.Errorf("record %s: disabled %v", r.Data, r.Disabled)
+					}
+				}
+			},
+			wantStatus:  http.StatusOK,
+			description: "Should carry the disabled flags of zones and records",
+		},
 		{
 			name: "import conflicting zone - replaces old records",
 			setupExisting: func(db *gorm.DB) {
@@ -590,3 +636,23 @@ func TestSyncImport(t *testing.T) {
 	}
 }
 
+
+func TestSyncExport_TracksSlaves(t *testing.T) {
+	db := setupTestDB(t)
+	db.Create(&dbm.Zone{Name: "test.com."})
+	server := NewServer(&config.Config{}, db, &mockDNSServer{})
+
+	req := httptest.NewRequest("GET", "/sync/export", nil)
+	req.RemoteAddr = "192.0.2.53:40000"
+	req.Header.Set(replication.SlaveHeader, "ns2.example.net")
+	w := httptest.NewRecorder()
+	server.r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	slaves := server.slaves.Slaves()
+	if len(slaves) != 1 || slaves[0].Name != "ns2.example.net" || slaves[0].Addr != "192.0.2.53" || slaves[0].Zones != 1 {
+		t.Fatalf("unexpected slaves: %+v", slaves)
+	}
+}
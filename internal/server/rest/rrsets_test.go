@@ -73,9 +73,72 @@ func TestCreateRRSet(t *testing.T) {
 				if len(rr.Records) != 1 {
 					t.Errorf("Expected 1 record, got %d", len(rr.Records))
 				}
+				if rr.Source != "api" || len(rr.Records) == 1 && rr.Records[0].Source != "api" {
+					t.Errorf("Expected source 'api', got %q", rr.Source)
+				}
 			},
 			description: "Should create A record with FQDN",
 		},
+		{
+			name:           "ASN list selector",
+			zoneID:         "1",
+			payload:        `{"name":"isp","type":"A","ttl":300,"records":[{"data":"192.0.2.6","asns":"as64512-65534, 3320"}]}`,
+			expectedStatus: http.StatusCreated,
+			validateResult: func(t *testing.T, rr *db.RRSet) {
+				if len(rr.Records) != 1 || rr.Records[0].ASNs == nil || *rr.Records[0].ASNs != "3320,64512-65534" {
+					t.Errorf("Expected normalized ASN list, got %+v", rr.Records)
+				}
+			},
+			description: "Should store ASN lists and ranges in canonical form",
+		},
+		{
+			name:           "invalid ASN range",
+			zoneID:         "1",
+			payload:        `{"name":"isp2","type":"A","ttl":300,"records":[{"data":"192.0.2.6","asns":"65534-64512"}]}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "isp2.test.com. A 192.0.2.6: ASN range 65534-64512 is reversed",
+			description:    "Should reject reversed ASN ranges",
+		},
+		{
+			name:           "dynamic records",
+			zoneID:         "1",
+			payload:        `{"name":"lb","type":"A","ttl":30,"dynamic_url":" http://lb.internal:8080/pool/web ","records":[]}`,
+			expectedStatus: http.StatusCreated,
+			validateResult: func(t *testing.T, rr *db.RRSet) {
+				if rr.DynamicURL == nil || *rr.DynamicURL != "http://lb.internal:8080/pool/web" || len(rr.Records) != 0 {
+					t.Errorf("Expected a dynamic set without stored records, got %v %+v", rr.DynamicURL, rr.Records)
+				}
+			},
+			description: "Should store the dynamic URL; stored records are optional",
+		},
+		{
+			name:           "invalid dynamic URL",
+			zoneID:         "1",
+			payload:        `{"name":"lb2","type":"A","ttl":30,"dynamic_url":"lb.internal/pool"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  `lb2.test.com. A: invalid dynamic URL "lb.internal/pool": use http(s)://host/path`,
+			description:    "Should reject dynamic URLs that are not http(s)",
+		},
+		{
+			name:           "unknown country code",
+			zoneID:         "1",
+			payload:        `{"name":"uk","type":"A","ttl":300,"records":[{"data":"192.0.2.7","country":"UK"}]}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  `uk.test.com. A 192.0.2.7: unknown country code "UK", use "GB"`,
+			description:    "Should reject country codes that no geo lookup returns",
+		},
+		{
+			name:           "duplicate records collapsed",
+			zoneID:         "1",
+			payload:        `{"name":"dup","type":"A","ttl":300,"records":[{"data":"192.0.2.5"},{"data":" 192.0.2.5 "},{"data":"192.0.2.5","country":"de"}]}`,
+			expectedStatus: http.StatusCreated,
+			validateResult: func(t *testing.T, rr *db.RRSet) {
+				if len(rr.Records) != 2 {
+					t.Errorf("Expected 2 records (geo variant kept), got %d", len(rr.Records))
+				}
+			},
+			description: "Should drop identical records but keep ones with different geo selectors",
+		},
 		{
 			name:           "create AAAA record",
 			zoneID:         "1",
@@ -660,3 +723,44 @@ func TestRRSetOperations_WithoutAuthentication(t *testing.T) {
 		})
 	}
 }
+
+func TestRRSetTTLLimits(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server, _, zoneID := setupRRSetTestServer(t)
+	server.cfg.RecordTTL = config.RecordTTLConfig{Min: 60, Max: 86400}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer testtoken")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		return w
+	}
+	base := "/zones/" + strconv.Itoa(int(zoneID)) + "/rrsets"
+
+	for _, tc := range []struct{ body, msg string }{
+		{`{"name":"www","type":"A","ttl":1,"records":[{"data":"192.0.2.1"}]}`, "ttl 1 is below record_ttl.min (60)"},
+		{`{"name":"www","type":"A","ttl":2592000,"records":[{"data":"192.0.2.1"}]}`, "ttl 2592000 is above record_ttl.max (86400)"},
+		{`{"name":"www","type":"A","ttl":300,"records":[{"data":"192.0.2.1","ttl":5}]}`, "ttl 5 is below record_ttl.min (60)"},
+	} {
+		w := do("POST", base, tc.body)
+		var resp map[string]string
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		if w.Code != http.StatusBadRequest || !bytes.Contains([]byte(resp["error"]), []byte(tc.msg)) {
+			t.Fatalf("%s: got %d %s", tc.body, w.Code, w.Body.String())
+		}
+	}
+
+	// Omitted TTLs take default_ttl, which is within the limits
+	w := do("POST", base, `{"name":"www","type":"A","records":[{"data":"192.0.2.1"}]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body.String())
+	}
+	var set db.RRSet
+	_ = json.Unmarshal(w.Body.Bytes(), &set)
+	if w := do("PUT", base+"/"+strconv.Itoa(int(set.ID)), `{"name":"www","type":"A","ttl":10,"records":[{"data":"192.0.2.1"}]}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("update below min: %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,163 @@
+package rest
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"namedot/internal/config"
+	dbm "namedot/internal/db"
+	"namedot/internal/server/rest/zoneio"
+)
+
+// scopeKey holds the *config.ScopedToken of a request made with a token
+// from api_tokens; requests with the main token have none.
+const scopeKey = "tokenScope"
+
+// userKey holds the admin user name of a request made with a token minted
+// at /admin/token.
+const userKey = "tokenUser"
+
+// authenticate returns whether token is accepted and, for api_tokens
+// entries, the token's scope. With no token configured at all every request
+// is accepted.
+func (s *Server) authenticate(token string) (*config.ScopedToken, bool) {
+	if ok, rotated := s.creds.Check(dbm.CredentialAPIToken, "", token); rotated {
+		// A rotated token replaces api_token and api_token_hash
+		if ok {
+			return nil, true
+		}
+	} else if s.cfg.APITokenHash != "" {
+		// Try hashed token first (recommended)
+		if bcrypt.CompareHashAndPassword([]byte(s.cfg.APITokenHash), []byte(token)) == nil {
+			return nil, true
+		}
+	} else if s.cfg.APIToken != "" {
+		// Fallback to plain text comparison (deprecated)
+		if token == s.cfg.APIToken {
+			return nil, true
+		}
+	} else if len(s.cfg.APITokens) == 0 {
+		// No authentication configured, allow all
+		return nil, true
+	}
+	if len(s.cfg.APITokens) == 0 || token == "" {
+		return nil, false
+	}
+	// bcrypt is slow on purpose; remember which entry a token matched
+	sum := sha256.Sum256([]byte(token))
+	if i, ok := s.scopedTokens.Load(sum); ok {
+		return &s.cfg.APITokens[i.(int)], true
+	}
+	for i := range s.cfg.APITokens {
+		if bcrypt.CompareHashAndPassword([]byte(s.cfg.APITokens[i].TokenHash), []byte(token)) == nil {
+			s.scopedTokens.Store(sum, i)
+			return &s.cfg.APITokens[i], true
+		}
+	}
+	return nil, false
+}
+
+// auth rejects requests without a valid token and records the scope of
+// zone-limited tokens for zoneScope. Tokens minted in the web admin act as
+// their user: full access for admins, reads only for viewers.
+func (s *Server) auth(c *gin.Context) {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if t, ok := s.webAdmin.LookupAPIToken(token); ok {
+		if t.ReadOnly() && c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "token is read-only"})
+			return
+		}
+		c.Set(userKey, t.Username)
+		c.Next()
+		return
+	}
+	scope, ok := s.authenticate(token)
+	if !ok {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	if scope != nil {
+		c.Set(scopeKey, scope)
+	}
+	c.Next()
+}
+
+// tokenScope returns the scope of the request's token, nil for full access.
+func tokenScope(c *gin.Context) *config.ScopedToken {
+	if v, ok := c.Get(scopeKey); ok {
+		return v.(*config.ScopedToken)
+	}
+	return nil
+}
+
+// zoneAllowed reports whether the request's token may manage zone name.
+func zoneAllowed(c *gin.Context, name string) bool {
+	scope := tokenScope(c)
+	return scope == nil || scope.AllowsZone(name)
+}
+
+// actor is the audit log actor of the request's token: the admin user for
+// minted tokens, so their changes show up as the user's own.
+func actor(c *gin.Context) string {
+	if user := c.GetString(userKey); user != "" {
+		return user
+	}
+	if scope := tokenScope(c); scope != nil {
+		return dbm.AuditActorAPI + ":" + scope.Name
+	}
+	return dbm.AuditActorAPI
+}
+
+func forbidZone(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "token is not allowed to manage this zone"})
+}
+
+// zoneScope keeps zone-limited tokens to their zones: routes under
+// /zones/:id (an ID or a zone name) answer 403 for other zones, /zones,
+// /zones/batch and /acme/dns01 check the zone in their handlers, /dhcp
+// needs the dhcp zone, and everything else (hosts, trash, stats,
+// replication, read-only mode) needs the main token.
+func (s *Server) zoneScope(c *gin.Context) {
+	if tokenScope(c) == nil {
+		c.Next()
+		return
+	}
+	path := c.FullPath()
+	switch {
+	case path == "/zones", path == "/zones/batch", path == "/acme/dns01", path == "/health-checks":
+	case strings.HasPrefix(path, "/dhcp/"):
+		if !zoneAllowed(c, zoneio.NormalizeFQDN(s.cfg.DHCP.Zone)) {
+			forbidZone(c)
+			return
+		}
+	case strings.HasPrefix(path, "/zones/:id"):
+		// zones addressed by name are checked even when they do not exist
+		// yet, so a PUT cannot create a zone outside the token's scope
+		name := zoneio.NormalizeFQDN(c.Param("id"))
+		if z, err := s.zoneByKey(c.Param("id")); err == nil {
+			name = z.Name
+		} else if _, err := strconv.ParseUint(c.Param("id"), 10, 32); err == nil {
+			break
+		}
+		if !zoneAllowed(c, name) {
+			forbidZone(c)
+			return
+		}
+	default:
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "token is limited to zones"})
+		return
+	}
+	c.Next()
+}
+
+// dbFor returns the database for the changes of a request, stamping the
+// RRSets and records it writes with the caller as their source.
+func (s *Server) dbFor(c *gin.Context) *gorm.DB {
+	return dbm.WithSource(s.db, actor(c))
+}
@@ -0,0 +1,97 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+
+	"namedot/internal/config"
+	"namedot/internal/db"
+)
+
+func TestScopedToken_LimitedToZones(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hash, err := bcrypt.GenerateFromPassword([]byte("team-token"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("hash: %v", err)
+	}
+	server, gormDB, _ := setupZoneTestServer(t, &config.Config{
+		APIToken:  "maintoken",
+		APITokens: []config.ScopedToken{{Name: "apps", TokenHash: string(hash), Zones: []string{"app.test", "*.apps.test"}}},
+	})
+
+	do := func(token, method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		return w
+	}
+
+	own := db.Zone{Name: "app.test."}
+	other := db.Zone{Name: "other.test."}
+	for _, z := range []*db.Zone{&own, &other} {
+		if err := gormDB.Create(z).Error; err != nil {
+			t.Fatalf("create zone: %v", err)
+		}
+	}
+	ownPath := "/zones/" + strconv.Itoa(int(own.ID))
+	otherPath := "/zones/" + strconv.Itoa(int(other.ID))
+	rrset := `{"name":"www","type":"A","ttl":300,"records":[{"data":"192.0.2.1"}]}`
+
+	if w := do("team-token", "POST", ownPath+"/rrsets", rrset); w.Code != http.StatusCreated {
+		t.Fatalf("rrset in own zone: %d %s", w.Code, w.Body.String())
+	}
+	var sets []db.RRSet
+	if err := json.Unmarshal(do("team-token", "GET", ownPath+"/rrsets", "").Body.Bytes(), &sets); err != nil || len(sets) != 1 {
+		t.Fatalf("list rrsets: %v %+v", err, sets)
+	}
+	if sets[0].Source != "api:apps" || sets[0].Records[0].Source != "api:apps" {
+		t.Fatalf("source %q/%q, want api:apps", sets[0].Source, sets[0].Records[0].Source)
+	}
+	for _, req := range []struct{ method, path, body string }{
+		{"POST", otherPath + "/rrsets", rrset},
+		{"GET", otherPath, ""},
+		{"DELETE", otherPath, ""},
+		{"GET", "/zones?name=other.test", ""},
+		{"POST", "/zones", `{"name":"evil.test"}`},
+		{"PUT", "/zones/evil.test", ""},
+		{"PUT", "/zones/other.test/rrsets/www/A", `{"records":[{"data":"192.0.2.1"}]}`},
+		{"GET", "/hosts", ""},
+		{"GET", "/sync/export", ""},
+		{"PUT", "/readonly", `{"enabled":true}`},
+	} {
+		if w := do("team-token", req.method, req.path, req.body); w.Code != http.StatusForbidden {
+			t.Fatalf("%s %s with scoped token: expected 403, got %d %s", req.method, req.path, w.Code, w.Body.String())
+		}
+	}
+	if w := do("team-token", "POST", "/zones", `{"name":"x.apps.test"}`); w.Code != http.StatusCreated {
+		t.Fatalf("create zone matching pattern: %d %s", w.Code, w.Body.String())
+	}
+
+	w := do("team-token", "GET", "/zones", "")
+	var zones []db.Zone
+	if err := json.Unmarshal(w.Body.Bytes(), &zones); err != nil || len(zones) != 2 {
+		t.Fatalf("zone list should hold the two allowed zones: %s", w.Body.String())
+	}
+	if w := do("maintoken", "GET", otherPath, ""); w.Code != http.StatusOK {
+		t.Fatalf("main token: %d", w.Code)
+	}
+	if w := do("wrong", "GET", "/zones", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("unknown token: %d", w.Code)
+	}
+
+	var actors []string
+	gormDB.Model(&db.AuditEntry{}).Distinct().Pluck("actor", &actors)
+	if len(actors) != 1 || actors[0] != "api:apps" {
+		t.Fatalf("changes should be audited as api:apps, got %v", actors)
+	}
+}
@@ -6,18 +6,22 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 
 	"namedot/internal/config"
 	dbm "namedot/internal/db"
+	"namedot/internal/dhcp"
+	"namedot/internal/replication"
 	"namedot/internal/server/rest/zoneio"
 	"namedot/internal/web"
+	"namedot/internal/zoneexpiry"
 )
 
 // DNSServer interface for cache invalidation
@@ -26,12 +30,20 @@ type DNSServer interface {
 }
 
 type Server struct {
-	cfg        *config.Config
-	db         *gorm.DB
-	r          *gin.Engine
-	httpServer *http.Server
-	tlsStopCh  chan struct{}
-	dnsServer  DNSServer
+	cfg          *config.Config
+	db           *gorm.DB
+	readDB       *gorm.DB // optional read replica for exports
+	r            *gin.Engine
+	httpServer   *http.Server
+	listener     net.Listener // pre-opened socket (SetListener)
+	tlsStopCh    chan struct{}
+	dnsServer    DNSServer
+	webAdmin     *web.Server
+	slaves       *replication.SlaveTracker
+	ro           readOnlyState
+	dhcp         *dhcp.Registrar // nil unless dhcp.enabled
+	scopedTokens sync.Map        // sha256 of a verified token -> index in cfg.APITokens
+	creds        *dbm.CredentialCache
 }
 
 func NewServer(cfg *config.Config, db *gorm.DB, dnsServer DNSServer) *Server {
@@ -54,64 +66,127 @@ func NewServer(cfg *config.Config, db *gorm.DB, dnsServer DNSServer) *Server {
 		r.Use(ipACLMiddleware(cfg.AllowedCIDRs))
 	}
 
-	s := &Server{cfg: cfg, db: db, r: r, dnsServer: dnsServer}
+	s := &Server{cfg: cfg, db: db, r: r, dnsServer: dnsServer, slaves: replication.NewSlaveTracker(),
+		creds: dbm.NewCredentialCache(db, credentialCacheTTL)}
+	if cfg.DHCP.Enabled {
+		s.dhcp = dhcp.New(cfg, db, dnsServer)
+	}
 
 	// Public endpoints (no auth)
 	r.GET("/health", s.health)
+	r.GET("/health/dns", s.healthDNS)
+	if cfg.Metrics.Enabled {
+		r.GET("/metrics", s.metricsHandler)
+		r.GET("/metrics/rules", s.metricsRules)
+		r.GET("/metrics/targets", s.metricsTargets)
+	}
 
 	// Web Admin UI
 	webAdmin, err := web.NewServer(cfg, db)
 	if err != nil {
 		log.Printf("Web admin initialization error: %v", err)
 	} else if webAdmin != nil {
+		if t, ok := dnsServer.(web.DNSTester); ok {
+			webAdmin.SetDNSTester(t)
+		}
+		if q, ok := dnsServer.(web.QueryRater); ok {
+			webAdmin.SetQueryRater(q)
+		}
+		if h, ok := dnsServer.(web.HealthLister); ok {
+			webAdmin.SetHealthLister(h)
+		}
+		if ci, ok := dnsServer.(web.CacheInvalidator); ok {
+			webAdmin.SetCacheInvalidator(ci)
+		}
+		webAdmin.SetSlaveLister(s.slaves)
+		webAdmin.SetReadOnlyChecker(s)
 		webAdmin.RegisterRoutes(r)
+		s.webAdmin = webAdmin
 		log.Printf("Web admin panel enabled at /admin")
 	}
 
-	auth := func(c *gin.Context) {
-		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
-
-		// Check if token is valid using either hash or plain text
-		authenticated := false
-
-		// Try hashed token first (recommended)
-		if s.cfg.APITokenHash != "" {
-			if err := bcrypt.CompareHashAndPassword([]byte(s.cfg.APITokenHash), []byte(token)); err == nil {
-				authenticated = true
-			}
-		} else if s.cfg.APIToken != "" {
-			// Fallback to plain text comparison (deprecated)
-			if token == s.cfg.APIToken {
-				authenticated = true
-			}
-		} else {
-			// No authentication configured, allow all
-			authenticated = true
-		}
-
-		if !authenticated {
-			c.AbortWithStatus(http.StatusUnauthorized)
-			return
-		}
-		c.Next()
-	}
+	// The toggle stays outside the read-only check
+	r.GET("/readonly", s.auth, s.zoneScope, s.getReadOnly)
+	r.PUT("/readonly", s.auth, s.zoneScope, s.setReadOnly)
+	r.GET("/meta/geo", s.auth, s.metaGeo)
+	// Reloading GeoIP changes no data, so it works in read-only mode too
+	r.POST("/admin/geoip/reload", s.auth, s.zoneScope, s.reloadGeoIP)
 
 	api := r.Group("/")
-	api.Use(auth)
+	api.Use(s.auth, s.zoneScope, s.writable)
 	{
 		api.POST("/zones", s.createZone)
+		api.POST("/zones/batch", s.createZoneBatch)
 		api.GET("/zones", s.listZones)
 		api.GET("/zones/:id", s.getZone)
-		api.DELETE("/zones/:id", s.deleteZone)
+		api.PUT("/zones/:id", s.unlockedZone, s.upsertZone)
+		api.PATCH("/zones/:id", s.unlockedZone, s.patchZone)
+		api.DELETE("/zones/:id", s.unlockedZone, s.deleteZone)
+
+		api.POST("/zones/:id/lock", s.lockZone)
+		api.DELETE("/zones/:id/lock", s.unlockZone)
 
-		api.POST("/zones/:id/rrsets", s.createRRSet)
-		api.PUT("/zones/:id/rrsets/:rid", s.updateRRSet)
-		api.PATCH("/zones/:id/rrsets/:rid", s.patchRRSet)
-		api.DELETE("/zones/:id/rrsets/:rid", s.deleteRRSet)
+		api.POST("/zones/:id/rrsets", s.unlockedZone, s.createRRSet)
+		api.PUT("/zones/:id/rrsets/:rid", s.unlockedZone, s.updateRRSet)
+		api.PATCH("/zones/:id/rrsets/:rid", s.unlockedZone, s.patchRRSet)
+		api.DELETE("/zones/:id/rrsets/:rid", s.unlockedZone, s.deleteRRSet)
 		api.GET("/zones/:id/rrsets", s.listRRSets)
+		api.PUT("/zones/:id/rrsets", s.unlockedZone, s.replaceZone)
+		api.GET("/zones/:id/rrsets/:rid/:type", s.getRRSetByName)
+		api.PUT("/zones/:id/rrsets/:rid/:type", s.unlockedZone, s.upsertRRSet)
+		api.DELETE("/zones/:id/rrsets/:rid/:type", s.unlockedZone, s.deleteRRSetByName)
+
+		api.GET("/zones/:id/soa", s.getSOA)
+		api.PUT("/zones/:id/soa", s.unlockedZone, s.updateSOA)
+		api.POST("/zones/:id/soa/reset", s.unlockedZone, s.resetSOA)
+
+		api.GET("/zones/:id/settings", s.getZoneSettings)
+		api.PUT("/zones/:id/settings", s.unlockedZone, s.updateZoneSettings)
+
+		api.POST("/zones/:id/mailauth/preview", s.previewMailAuth)
+		api.POST("/zones/:id/mailauth", s.unlockedZone, s.applyMailAuth)
+
+		api.POST("/zones/:id/plan", s.planZone)
+		api.POST("/zones/:id/apply", s.unlockedZone, s.applyZone)
+
+		api.GET("/zones/:id/canary", s.getCanary)
+		api.PUT("/zones/:id/canary", s.unlockedZone, s.stageCanary)
+		api.POST("/zones/:id/canary/promote", s.unlockedZone, s.promoteCanary)
+		api.DELETE("/zones/:id/canary", s.unlockedZone, s.revertCanary)
 
 		api.GET("/zones/:id/export", s.exportZone)
-		api.POST("/zones/:id/import", s.importZone)
+		api.GET("/zones/:id/stats", s.zoneStats)
+		api.POST("/zones/:id/import", s.unlockedZone, s.importZone)
+
+		api.POST("/acme/dns01", s.acmeChallenge)
+
+		if s.dhcp != nil {
+			api.GET("/dhcp/leases", s.listLeases)
+			api.POST("/dhcp/leases", s.registerLease)
+			api.DELETE("/dhcp/leases/:ip", s.releaseLease)
+		}
+
+		api.GET("/trash", s.listTrash)
+		api.POST("/trash/:id/restore", s.restoreTrash)
+		api.DELETE("/trash/:id", s.purgeTrash)
+
+		api.GET("/hosts", s.listHosts)
+		api.POST("/hosts", s.createHost)
+		api.PUT("/hosts/:id", s.updateHost)
+		api.DELETE("/hosts/:id", s.deleteHost)
+
+		api.POST("/token/rotate", s.rotateToken)
+
+		api.GET("/settings", s.getSettings)
+		api.PUT("/settings", s.putSettings)
+
+		api.GET("/stats/queries", s.queryStats)
+		api.GET("/stats/clients", s.clientStats)
+
+		api.GET("/debug/slow-queries", s.slowQueries)
+		api.GET("/debug/query-log", s.searchQueryLog)
+		api.GET("/health-checks", s.listHealthChecks)
+		api.GET("/reports/integrity", s.integrityReport)
 
 		// Replication endpoints
 		api.GET("/sync/export", s.syncExport)
@@ -120,7 +195,35 @@ func NewServer(cfg *config.Config, db *gorm.DB, dnsServer DNSServer) *Server {
 	return s
 }
 
+// SetListener makes Start serve on a socket opened elsewhere, e.g. passed by
+// systemd socket activation, instead of binding rest_listen.
+func (s *Server) SetListener(ln net.Listener) {
+	s.listener = ln
+}
+
+// Listener returns the socket the API is served on, nil before Listen.
+func (s *Server) Listener() net.Listener {
+	return s.listener
+}
+
+// Listen binds rest_listen unless a socket was set with SetListener, so the
+// port is open before privileges are dropped. Start calls it when needed.
+func (s *Server) Listen() error {
+	if s.listener != nil {
+		return nil
+	}
+	ln, err := net.Listen("tcp", s.cfg.RESTListen)
+	if err != nil {
+		return err
+	}
+	s.listener = ln
+	return nil
+}
+
 func (s *Server) Start() error {
+	if err := s.Listen(); err != nil {
+		return err
+	}
 	s.httpServer = &http.Server{
 		Addr:    s.cfg.RESTListen,
 		Handler: s.r,
@@ -148,11 +251,11 @@ func (s *Server) Start() error {
 			log.Printf("Starting REST API with HTTPS on %s (cert reload disabled)", s.cfg.RESTListen)
 		}
 
-		return s.httpServer.ListenAndServeTLS("", "")
+		return s.httpServer.ServeTLS(s.listener, "", "")
 	}
 
 	log.Printf("Starting REST API with HTTP on %s", s.cfg.RESTListen)
-	return s.httpServer.ListenAndServe()
+	return s.httpServer.Serve(s.listener)
 }
 
 func (s *Server) Shutdown(ctx context.Context) error {
@@ -189,6 +292,9 @@ func (s *Server) health(c *gin.Context) {
 		"status": status,
 		"db":     dbStatus,
 	}
+	if on, _ := s.ReadOnly(); on {
+		response["read_only"] = true
+	}
 
 	if status == "ok" {
 		c.JSON(http.StatusOK, response)
@@ -197,8 +303,49 @@ func (s *Server) health(c *gin.Context) {
 	}
 }
 
+// dnsProber is implemented by DNS servers that can query their own
+// listeners.
+type dnsProber interface {
+	Probe() (map[string]time.Duration, error)
+}
+
+// healthDNS sends a loopback query through the DNS listeners, so load
+// balancers notice a wedged DNS socket while HTTP still answers.
+func (s *Server) healthDNS(c *gin.Context) {
+	p, ok := s.dnsServer.(dnsProber)
+	if !ok {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "down", "error": "dns server cannot be probed"})
+		return
+	}
+	rtts, err := p.Probe()
+	response := gin.H{"status": "ok"}
+	for net, rtt := range rtts {
+		response[net+"_ms"] = float64(rtt.Microseconds()) / 1000
+	}
+	if err != nil {
+		response["status"], response["error"] = "down", err.Error()
+		c.JSON(http.StatusServiceUnavailable, response)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
 type zoneReq struct {
-	Name string `json:"name"`
+	Name         string     `json:"name"`
+	ExpireAt     *time.Time `json:"expire_at"`
+	InactiveDays int        `json:"inactive_days"`
+	ExpireAction string     `json:"expire_action"`
+}
+
+// validExpiry checks the per-zone expiry settings shared by create and patch.
+func validExpiry(inactiveDays int, action string) error {
+	if inactiveDays < 0 {
+		return fmt.Errorf("inactive_days must be >= 0")
+	}
+	if action != "" && action != zoneexpiry.ActionDisable && action != zoneexpiry.ActionTrash {
+		return fmt.Errorf("expire_action must be 'disable' or 'trash'")
+	}
+	return nil
 }
 
 func (s *Server) createZone(c *gin.Context) {
@@ -207,18 +354,32 @@ func (s *Server) createZone(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
 		return
 	}
+	if err := validExpiry(req.InactiveDays, req.ExpireAction); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	// Normalize zone name: lowercase and ensure trailing dot (FQDN)
 	name := strings.ToLower(strings.TrimSpace(req.Name))
 	if !strings.HasSuffix(name, ".") {
 		name += "."
 	}
-	z := dbm.Zone{Name: name}
-	if err := s.db.Create(&z).Error; err != nil {
+	if !zoneAllowed(c, name) {
+		forbidZone(c)
+		return
+	}
+	if dbm.ZoneNameInTrash(s.db, name) {
+		c.JSON(http.StatusConflict, gin.H{"error": dbm.ErrZoneNameInTrash.Error()})
+		return
+	}
+	z := dbm.Zone{Name: name, ExpireAt: req.ExpireAt, InactiveDays: req.InactiveDays, ExpireAction: req.ExpireAction}
+	if err := s.dbFor(c).Create(&z).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 	// Ensure SOA exists right after zone creation when auto is enabled
-	dbm.BumpSOASerialAuto(s.db, z, s.cfg.SOA.AutoOnMissing, s.cfg.SOA.Primary, s.cfg.SOA.Hostmaster)
+	dbm.TouchZone(s.db, z, s.cfg)
+	_ = s.db.First(&z, z.ID).Error // pick up the serial
+	s.audit(c, dbm.AuditZoneCreate, z, 0, z.Name)
 	// Invalidate DNS zone cache
 	if s.dnsServer != nil {
 		s.dnsServer.InvalidateZoneCache()
@@ -234,6 +395,10 @@ func (s *Server) listZones(c *gin.Context) {
 		if !strings.HasSuffix(name, ".") {
 			name += "."
 		}
+		if !zoneAllowed(c, name) {
+			forbidZone(c)
+			return
+		}
 
 		var z dbm.Zone
 		if err := s.db.Preload("RRSets.Records").Where("name = ?", name).First(&z).Error; err != nil {
@@ -250,36 +415,117 @@ func (s *Server) listZones(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if scope := tokenScope(c); scope != nil {
+		allowed := zs[:0]
+		for _, z := range zs {
+			if scope.AllowsZone(z.Name) {
+				allowed = append(allowed, z)
+			}
+		}
+		zs = allowed
+	}
 	c.JSON(http.StatusOK, zs)
 }
 
 func (s *Server) getZone(c *gin.Context) {
-	var z dbm.Zone
-	if err := s.db.Preload("RRSets").First(&z, c.Param("id")).Error; err != nil {
+	z, err := s.zoneByKey(c.Param("id"))
+	if err == nil {
+		err = s.db.Preload("RRSets").First(&z, z.ID).Error
+	}
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
 		return
 	}
 	c.JSON(http.StatusOK, z)
 }
 
-func (s *Server) deleteZone(c *gin.Context) {
-	var z dbm.Zone
-	if err := s.db.First(&z, c.Param("id")).Error; err != nil {
+// zonePatchReq updates zone settings; omitted fields are left unchanged and
+// "expire_at": null clears the expiry date.
+type zonePatchReq struct {
+	Disabled     *bool           `json:"disabled"`
+	ExpireAt     json.RawMessage `json:"expire_at"`
+	InactiveDays *int            `json:"inactive_days"`
+	ExpireAction *string         `json:"expire_action"`
+	// minimal_responses: true/false, or null to follow the config again
+	MinimalResponses json.RawMessage `json:"minimal_responses"`
+	NoCache          *bool           `json:"no_cache"`
+}
+
+func (s *Server) patchZone(c *gin.Context) {
+	z, err := s.zoneByKey(c.Param("id"))
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
 		return
 	}
-	if err := s.db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Where("zone_id = ?", z.ID).Delete(&dbm.RRSet{}).Error; err != nil {
-			return err
+	var req zonePatchReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	updates := map[string]interface{}{}
+	if req.Disabled != nil {
+		updates["disabled"] = *req.Disabled
+	}
+	if len(req.ExpireAt) > 0 {
+		var at *time.Time
+		if err := json.Unmarshal(req.ExpireAt, &at); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid expire_at: expected RFC3339 or null"})
+			return
 		}
-		if err := tx.Delete(&z).Error; err != nil {
-			return err
+		updates["expire_at"] = at
+	}
+	if len(req.MinimalResponses) > 0 {
+		var minimal *bool
+		if err := json.Unmarshal(req.MinimalResponses, &minimal); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid minimal_responses: expected true, false or null"})
+			return
 		}
-		return nil
-	}); err != nil {
+		updates["minimal_responses"] = minimal
+	}
+	if req.NoCache != nil {
+		updates["no_cache"] = *req.NoCache
+	}
+	days, action := z.InactiveDays, z.ExpireAction
+	if req.InactiveDays != nil {
+		days = *req.InactiveDays
+		updates["inactive_days"] = days
+	}
+	if req.ExpireAction != nil {
+		action = strings.ToLower(strings.TrimSpace(*req.ExpireAction))
+		updates["expire_action"] = action
+	}
+	if err := validExpiry(days, action); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(updates) > 0 {
+		if err := s.db.Model(&z).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		// Invalidate DNS zone cache (disabled zones are not served)
+		if s.dnsServer != nil {
+			s.dnsServer.InvalidateZoneCache()
+		}
+	}
+	_ = s.db.First(&z, z.ID).Error
+	if len(updates) > 0 {
+		s.audit(c, dbm.AuditZoneUpdate, z, 0, fmt.Sprint(updates))
+	}
+	c.JSON(http.StatusOK, z)
+}
+
+func (s *Server) deleteZone(c *gin.Context) {
+	z, err := s.zoneByKey(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	if err := dbm.TrashZone(s.db, z.ID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	s.audit(c, dbm.AuditZoneDelete, z, 0, z.Name)
 	// Invalidate DNS zone cache
 	if s.dnsServer != nil {
 		s.dnsServer.InvalidateZoneCache()
@@ -288,10 +534,12 @@ func (s *Server) deleteZone(c *gin.Context) {
 }
 
 type rrsetReq struct {
-	Name    string      `json:"name"`
-	Type    string      `json:"type"`
-	TTL     uint32      `json:"ttl"`
-	Records []dbm.RData `json:"records"`
+	Name       string      `json:"name"`
+	Type       string      `json:"type"`
+	TTL        uint32      `json:"ttl"`
+	Comment    string      `json:"comment"`
+	DynamicURL *string     `json:"dynamic_url"`
+	Records    []dbm.RData `json:"records"`
 }
 
 func fqdn(name, zone string) string {
@@ -341,14 +589,24 @@ func (s *Server) createRRSet(c *gin.Context) {
 	}
 
 	set := dbm.RRSet{
-		ZoneID:  z.ID,
-		Name:    name,
-		Type:    recordType,
-		TTL:     req.TTL,
-		Records: req.recordsNormalized(),
+		ZoneID:     z.ID,
+		Name:       name,
+		Type:       recordType,
+		TTL:        req.TTL,
+		Comment:    req.Comment,
+		DynamicURL: req.dynamicURL(),
+		Records:    req.recordsNormalized(),
+	}
+	if set.TTL == 0 && s.cfg.RecordDefaultTTL() > 0 {
+		set.TTL = s.cfg.RecordDefaultTTL()
+	}
+	if err := dbm.CheckRRSetTTL(s.cfg.RecordTTL, set); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-	if set.TTL == 0 && s.cfg.DefaultTTL > 0 {
-		set.TTL = s.cfg.DefaultTTL
+	if err := dbm.CheckRecordSelectors(set); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 	// Expand CNAME "@" shorthand in record data to apex FQDN before save
 	if strings.EqualFold(set.Type, "CNAME") {
@@ -358,11 +616,12 @@ func (s *Server) createRRSet(c *gin.Context) {
 			}
 		}
 	}
-	if err := s.db.Create(&set).Error; err != nil {
+	if err := s.dbFor(c).Create(&set).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	dbm.BumpSOASerialAuto(s.db, z, s.cfg.SOA.AutoOnMissing, s.cfg.SOA.Primary, s.cfg.SOA.Hostmaster)
+	s.audit(c, dbm.AuditRRSetCreate, z, set.ID, rrsetSummary(set))
+	dbm.TouchZone(s.db, z, s.cfg)
 	// Invalidate DNS cache after zone record change
 	if s.dnsServer != nil {
 		s.dnsServer.InvalidateZoneCache()
@@ -389,12 +648,23 @@ func (s *Server) updateRRSet(c *gin.Context) {
 	set.Name = strings.ToLower(fqdn(req.Name, z.Name))
 	set.Type = strings.ToUpper(req.Type)
 	set.TTL = req.TTL
-	if set.TTL == 0 && s.cfg.DefaultTTL > 0 {
-		set.TTL = s.cfg.DefaultTTL
+	set.Comment = req.Comment
+	set.DynamicURL = req.dynamicURL()
+	if set.TTL == 0 && s.cfg.RecordDefaultTTL() > 0 {
+		set.TTL = s.cfg.RecordDefaultTTL()
+	}
+	check := dbm.RRSet{Name: set.Name, Type: set.Type, TTL: set.TTL, DynamicURL: set.DynamicURL, Records: req.recordsNormalized()}
+	if err := dbm.CheckRRSetTTL(s.cfg.RecordTTL, check); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := dbm.CheckRecordSelectors(check); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 	// replace records
-	if err := s.db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Where("rr_set_id = ?", set.ID).Delete(&dbm.RData{}).Error; err != nil {
+	if err := s.dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("rr_set_id = ?", set.ID).Delete(&dbm.RData{}).Error; err != nil {
 			return err
 		}
 		set.Records = req.recordsNormalized()
@@ -410,7 +680,8 @@ func (s *Server) updateRRSet(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	dbm.BumpSOASerialAuto(s.db, z, s.cfg.SOA.AutoOnMissing, s.cfg.SOA.Primary, s.cfg.SOA.Hostmaster)
+	s.audit(c, dbm.AuditRRSetUpdate, z, set.ID, rrsetSummary(set))
+	dbm.TouchZone(s.db, z, s.cfg)
 	// Invalidate DNS cache after zone record change
 	if s.dnsServer != nil {
 		s.dnsServer.InvalidateZoneCache()
@@ -426,10 +697,16 @@ func (s *Server) deleteRRSet(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
 		return
 	}
-	if err := s.db.Delete(&dbm.RRSet{}, "zone_id = ? AND id = ?", z.ID, c.Param("rid")).Error; err != nil {
+	var set dbm.RRSet
+	found := s.db.Where("zone_id = ? AND id = ?", z.ID, c.Param("rid")).First(&set).Error == nil
+	// Hard delete: the records go with the RRSet via ON DELETE CASCADE
+	if err := s.db.Unscoped().Delete(&dbm.RRSet{}, "zone_id = ? AND id = ?", z.ID, c.Param("rid")).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if found {
+		s.audit(c, dbm.AuditRRSetDelete, z, set.ID, set.Name+" "+set.Type)
+	}
 	dbm.BumpSOASerial(s.db, z.ID)
 	// Invalidate DNS cache after zone record change
 	if s.dnsServer != nil {
@@ -439,18 +716,41 @@ func (s *Server) deleteRRSet(c *gin.Context) {
 }
 
 func (s *Server) listRRSets(c *gin.Context) {
+	z, err := s.zoneByKey(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
+		return
+	}
 	var sets []dbm.RRSet
-	if err := s.db.Preload("Records").Where("zone_id = ?", c.Param("id")).Find(&sets).Error; err != nil {
+	if err := s.db.Preload("Records").Where("zone_id = ?", z.ID).Find(&sets).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, sets)
 }
 
+// SetReadDB routes export queries to a read replica.
+func (s *Server) SetReadDB(db *gorm.DB) {
+	s.readDB = db
+}
+
+// SetReplicator shows the slave sync status in the web admin, if enabled.
+func (s *Server) SetReplicator(r web.Replicator) {
+	s.webAdmin.SetReplicator(r)
+}
+
+// reader returns the read replica if configured, otherwise the primary DB.
+func (s *Server) reader() *gorm.DB {
+	if s.readDB != nil {
+		return s.readDB
+	}
+	return s.db
+}
+
 func (s *Server) exportZone(c *gin.Context) {
 	format := strings.ToLower(c.DefaultQuery("format", "json"))
 	var z dbm.Zone
-	if err := s.db.Preload("RRSets.Records").First(&z, c.Param("id")).Error; err != nil {
+	if err := s.reader().Preload("RRSets.Records").First(&z, c.Param("id")).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
 		return
 	}
@@ -478,50 +778,44 @@ func (s *Server) importZone(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
 		return
 	}
+	var rep *zoneio.ImportReport
 	switch format {
 	case "json":
-		var raw any
-		dec := json.NewDecoder(c.Request.Body)
-		dec.UseNumber()
-		if err := dec.Decode(&raw); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
-			return
-		}
-		cleaned := stripTimestamps(raw)
-		buf, err := json.Marshal(cleaned)
+		in, err := zoneio.DecodeJSON(c.Request.Body)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
-			return
-		}
-		var in dbm.Zone
-		if err := json.Unmarshal(buf, &in); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		if err := zoneio.ImportJSON(s.db, &z, &in, mode, s.cfg.DefaultTTL); err != nil {
+		if rep, err = zoneio.ImportJSON(dbm.WithSource(s.db, dbm.SourceImport(actor(c))), &z, in, mode, s.cfg.RecordDefaultTTL(), s.cfg.RecordTTL); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		dbm.BumpSOASerialAuto(s.db, z, s.cfg.SOA.AutoOnMissing, s.cfg.SOA.Primary, s.cfg.SOA.Hostmaster)
-		// Invalidate DNS cache after zone import
-		if s.dnsServer != nil {
-			s.dnsServer.InvalidateZoneCache()
-		}
-		c.Status(http.StatusNoContent)
 	case "bind":
-		if err := zoneio.ImportBIND(s.db, &z, c.Request.Body, mode, s.cfg.DefaultTTL); err != nil {
+		var err error
+		if rep, err = zoneio.ImportBIND(dbm.WithSource(s.db, dbm.SourceImport(actor(c))), &z, c.Request.Body, mode, s.cfg.RecordDefaultTTL(), s.cfg.RecordTTL); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		dbm.BumpSOASerialAuto(s.db, z, s.cfg.SOA.AutoOnMissing, s.cfg.SOA.Primary, s.cfg.SOA.Hostmaster)
-		// Invalidate DNS cache after zone import
-		if s.dnsServer != nil {
-			s.dnsServer.InvalidateZoneCache()
-		}
-		c.Status(http.StatusNoContent)
 	default:
 		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported format"})
+		return
 	}
+	dbm.TouchZone(s.db, z, s.cfg)
+	s.audit(c, dbm.AuditZoneImport, z, 0, fmt.Sprintf("%s %s: %d created, %d updated, %d skipped", format, mode, rep.Created, rep.Updated, rep.Skipped))
+	// Invalidate DNS cache after zone import
+	if s.dnsServer != nil {
+		s.dnsServer.InvalidateZoneCache()
+	}
+	c.JSON(http.StatusOK, rep)
+}
+
+// rrsetSummary describes a set and its records for the audit log.
+func rrsetSummary(set dbm.RRSet) string {
+	data := make([]string, 0, len(set.Records))
+	for _, r := range set.Records {
+		data = append(data, r.Data)
+	}
+	return fmt.Sprintf("%s %s %d [%s]", set.Name, set.Type, set.TTL, strings.Join(data, ", "))
 }
 
 func (r rrsetReq) recordsNormalized() []dbm.RData {
@@ -531,10 +825,31 @@ func (r rrsetReq) recordsNormalized() []dbm.RData {
 		rr.Country = normalizePtr(x.Country)
 		rr.Continent = normalizePtr(x.Continent)
 		rr.ASN = x.ASN
+		rr.ASNs = normalizePtr(x.ASNs)
 		rr.Subnet = normalizePtr(x.Subnet)
+		rr.TTL = x.TTL
+		rr.Weight = x.Weight
+		rr.Backup = x.Backup
+		rr.Disabled = x.Disabled
+		if x.HealthCheck != nil {
+			if hc := strings.TrimSpace(*x.HealthCheck); hc != "" {
+				rr.HealthCheck = &hc
+			}
+		}
 		out = append(out, rr)
 	}
-	return out
+	return dbm.DedupeRecords(out)
+}
+
+// dynamicURL is the dynamic URL of the request, nil when empty.
+func (r rrsetReq) dynamicURL() *string {
+	if r.DynamicURL == nil {
+		return nil
+	}
+	if u := strings.TrimSpace(*r.DynamicURL); u != "" {
+		return &u
+	}
+	return nil
 }
 
 func normalizePtr[T ~string](p *T) *string {
@@ -550,39 +865,17 @@ func normalizePtr[T ~string](p *T) *string {
 }
 
 // stripTimestamps removes created/updated/deleted fields from imported JSON payloads.
-func stripTimestamps(v any) any {
-	switch t := v.(type) {
-	case map[string]any:
-		out := make(map[string]any, len(t))
-		for k, val := range t {
-			lk := strings.ToLower(k)
-			if lk == "created_at" || lk == "updated_at" || lk == "deleted_at" {
-				continue
-			}
-			out[k] = stripTimestamps(val)
-		}
-		return out
-	case []any:
-		out := make([]any, len(t))
-		for i, val := range t {
-			out[i] = stripTimestamps(val)
-		}
-		return out
-	default:
-		return v
-	}
-}
-
 // Sync structures for replication
 type SyncData struct {
-	Zones     []dbm.Zone     `json:"zones"`
-	Templates []dbm.Template `json:"templates"`
+	Zones     []dbm.Zone        `json:"zones"`
+	Templates []dbm.Template    `json:"templates"`
+	Settings  *config.Overrides `json:"settings,omitempty"` // nil from masters without runtime settings
 }
 
 // syncExport returns all zones and templates for replication
 func (s *Server) syncExport(c *gin.Context) {
 	var zones []dbm.Zone
-	if err := s.db.Preload("RRSets.Records").Find(&zones).Error; err != nil {
+	if err := s.reader().Preload("RRSets.Records").Find(&zones).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -596,17 +889,34 @@ func (s *Server) syncExport(c *gin.Context) {
 	}
 
 	var templates []dbm.Template
-	if err := s.db.Preload("Records").Find(&templates).Error; err != nil {
+	if err := s.reader().Preload("Records").Find(&templates).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	settings, err := dbm.LoadOverrides(s.reader())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.slaves.Seen(c.ClientIP(), c.GetHeader(replication.SlaveHeader), len(zones))
 	c.JSON(http.StatusOK, SyncData{
 		Zones:     zones,
 		Templates: templates,
+		Settings:  &settings,
 	})
 }
 
+// replicatedSource keeps the source the master stamped on synced data;
+// data without one is marked as replicated.
+func replicatedSource(src string) string {
+	if src == "" {
+		return dbm.SourceReplication
+	}
+	return src
+}
+
 // syncImport imports all zones and templates from master
 func (s *Server) syncImport(c *gin.Context) {
 	var data SyncData
@@ -614,6 +924,13 @@ func (s *Server) syncImport(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
 		return
 	}
+	if data.Settings != nil {
+		if err := s.cfg.CheckOverrides(*data.Settings); err != nil {
+			// Keep the zones in sync even if this server cannot take the settings
+			log.Printf("sync: settings from master not applied: %v", err)
+			data.Settings = nil
+		}
+	}
 
 	err := s.db.Transaction(func(tx *gorm.DB) error {
 		// Import zones
@@ -627,7 +944,8 @@ func (s *Server) syncImport(c *gin.Context) {
 			if err == gorm.ErrRecordNotFound {
 				// Create new zone
 				newZone := dbm.Zone{
-					Name: zoneName,
+					Name:     zoneName,
+					Disabled: zone.Disabled,
 				}
 				if err := tx.Create(&newZone).Error; err != nil {
 					return fmt.Errorf("create zone %s: %w", zone.Name, err)
@@ -635,6 +953,11 @@ func (s *Server) syncImport(c *gin.Context) {
 				existingZone = newZone
 			} else if err != nil {
 				return fmt.Errorf("check zone %s: %w", zone.Name, err)
+			} else if existingZone.Disabled != zone.Disabled {
+				// Zones disabled on the master are not served here either
+				if err := tx.Model(&existingZone).Update("disabled", zone.Disabled).Error; err != nil {
+					return fmt.Errorf("update zone %s: %w", zone.Name, err)
+				}
 			}
 
 			// Delete old rrsets and their records for this zone (hard delete, not soft delete)
@@ -657,20 +980,25 @@ func (s *Server) syncImport(c *gin.Context) {
 			// Create new rrsets
 			for _, rrset := range zone.RRSets {
 				newRRSet := dbm.RRSet{
-					ZoneID:  existingZone.ID,
-					Name:    zoneio.NormalizeFQDN(rrset.Name),
-					Type:    strings.ToUpper(rrset.Type),
-					TTL:     rrset.TTL,
-					Records: rrset.Records,
+					ZoneID:     existingZone.ID,
+					Name:       zoneio.NormalizeFQDN(rrset.Name),
+					Type:       strings.ToUpper(rrset.Type),
+					TTL:        rrset.TTL,
+					Comment:    rrset.Comment,
+					Source:     replicatedSource(rrset.Source),
+					DynamicURL: rrset.DynamicURL,
+					Records:    dbm.DedupeRecords(rrset.Records),
 				}
 				// Clear IDs to avoid conflicts
 				for i := range newRRSet.Records {
 					newRRSet.Records[i].ID = 0
+					newRRSet.Records[i].Source = replicatedSource(newRRSet.Records[i].Source)
 				}
 				if err := tx.Create(&newRRSet).Error; err != nil {
 					return fmt.Errorf("create rrset %s/%s: %w", zone.Name, rrset.Name, err)
 				}
 			}
+			dbm.SyncZoneSerial(tx, existingZone.ID)
 		}
 
 		// Import templates
@@ -714,6 +1042,7 @@ func (s *Server) syncImport(c *gin.Context) {
 					Country:    rec.Country,
 					Continent:  rec.Continent,
 					ASN:        rec.ASN,
+					ASNs:       rec.ASNs,
 					Subnet:     rec.Subnet,
 				}
 				if err := tx.Create(&newRec).Error; err != nil {
@@ -722,6 +1051,11 @@ func (s *Server) syncImport(c *gin.Context) {
 			}
 		}
 
+		if data.Settings != nil {
+			if err := dbm.SaveOverrides(tx, *data.Settings); err != nil {
+				return fmt.Errorf("save settings: %w", err)
+			}
+		}
 		return nil
 	})
 
@@ -729,6 +1063,9 @@ func (s *Server) syncImport(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if data.Settings != nil {
+		s.cfg.SetOverrides(*data.Settings)
+	}
 
 	// Invalidate DNS cache after sync import
 	if s.dnsServer != nil {
@@ -0,0 +1,70 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	dbm "namedot/internal/db"
+)
+
+type zoneSettingsReq struct {
+	AllowTransfer []string `json:"allow_transfer"`
+	AlsoNotify    []string `json:"also_notify"`
+	TSIGKey       string   `json:"tsig_key"`
+}
+
+func (s *Server) getZoneSettings(c *gin.Context) {
+	var z dbm.Zone
+	if err := s.db.First(&z, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
+		return
+	}
+	set, err := dbm.GetZoneSettings(s.db, z.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, set)
+}
+
+// updateZoneSettings replaces the transfer policy of a zone. The TSIG key
+// must be one of tsig_keys in the config.
+func (s *Server) updateZoneSettings(c *gin.Context) {
+	var z dbm.Zone
+	if err := s.db.First(&z, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
+		return
+	}
+	var req zoneSettingsReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	set, err := dbm.NormalizeZoneSettings(dbm.ZoneSettings{
+		ZoneID:        z.ID,
+		AllowTransfer: req.AllowTransfer,
+		AlsoNotify:    req.AlsoNotify,
+		TSIGKey:       req.TSIGKey,
+	})
+	if errors.Is(err, dbm.ErrInvalidSettings) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if set.TSIGKey != "" {
+		if _, ok := s.cfg.FindTSIGKey(set.TSIGKey); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown tsig key %q", set.TSIGKey)})
+			return
+		}
+	}
+	if err := dbm.SaveZoneSettings(s.db, set); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.audit(c, dbm.AuditSettingsUpdate, z, 0, fmt.Sprintf("allow_transfer [%s] also_notify [%s] tsig_key %q",
+		strings.Join(set.AllowTransfer, ", "), strings.Join(set.AlsoNotify, ", "), set.TSIGKey))
+	c.JSON(http.StatusOK, set)
+}
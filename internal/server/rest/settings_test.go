@@ -0,0 +1,84 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/config"
+	"namedot/internal/db"
+)
+
+func TestZoneSettings_GetUpdate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{APIToken: "testtoken", TSIGKeys: []config.TSIGKey{{Name: "xfr-key", Algorithm: "hmac-sha256", Secret: "c2VjcmV0"}}}
+	server, gormDB, _ := setupZoneTestServer(t, cfg)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer testtoken")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		return w
+	}
+	decode := func(w *httptest.ResponseRecorder) db.ZoneSettings {
+		t.Helper()
+		var set db.ZoneSettings
+		if err := json.Unmarshal(w.Body.Bytes(), &set); err != nil {
+			t.Fatalf("decode settings: %v: %s", err, w.Body.String())
+		}
+		return set
+	}
+
+	zone := db.Zone{Name: "settings.test."}
+	if err := gormDB.Create(&zone).Error; err != nil {
+		t.Fatalf("create zone: %v", err)
+	}
+	base := "/zones/" + strconv.Itoa(int(zone.ID)) + "/settings"
+
+	w := do("GET", base, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("get settings: expected 200, got %d", w.Code)
+	}
+	if set := decode(w); len(set.AllowTransfer) != 0 || set.TSIGKey != "" {
+		t.Fatalf("expected empty settings, got %+v", set)
+	}
+
+	w = do("PUT", base, `{"allow_transfer":["192.0.2.7","10.1.2.3/8"],"also_notify":["192.0.2.7","[2001:db8::1]:5353"],"tsig_key":"XFR-KEY."}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("put settings: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	set := decode(w)
+	if len(set.AllowTransfer) != 2 || set.AllowTransfer[0] != "192.0.2.7/32" || set.AllowTransfer[1] != "10.0.0.0/8" {
+		t.Fatalf("unexpected allow_transfer: %v", set.AllowTransfer)
+	}
+	if len(set.AlsoNotify) != 2 || set.AlsoNotify[0] != "192.0.2.7:53" || set.AlsoNotify[1] != "[2001:db8::1]:5353" {
+		t.Fatalf("unexpected also_notify: %v", set.AlsoNotify)
+	}
+	if set.TSIGKey != "xfr-key" {
+		t.Fatalf("unexpected tsig_key: %q", set.TSIGKey)
+	}
+	if got := decode(do("GET", base, "")); len(got.AllowTransfer) != 2 || got.TSIGKey != "xfr-key" {
+		t.Fatalf("settings not stored: %+v", got)
+	}
+
+	for _, body := range []string{
+		`{"allow_transfer":["not-a-cidr"]}`,
+		`{"also_notify":["ns1.example.com"]}`,
+		`{"tsig_key":"missing"}`,
+	} {
+		if w := do("PUT", base, body); w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", body, w.Code)
+		}
+	}
+	if w := do("GET", "/zones/999/settings", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("missing zone: expected 404, got %d", w.Code)
+	}
+}
@@ -0,0 +1,59 @@
+package rest
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	dnssrv "namedot/internal/server/dns"
+)
+
+// slowQueryLister is implemented by DNS servers that keep a slow query log.
+type slowQueryLister interface {
+	SlowQueries() []dnssrv.SlowQuery
+}
+
+type slowQueryResp struct {
+	Time       time.Time `json:"time"`
+	Name       string    `json:"qname"`
+	Type       string    `json:"qtype"`
+	Client     string    `json:"client"`
+	Source     string    `json:"source"`
+	Zone       string    `json:"zone,omitempty"`
+	Rule       string    `json:"rule,omitempty"`
+	Country    string    `json:"country,omitempty"`
+	Continent  string    `json:"continent,omitempty"`
+	ASN        int       `json:"asn,omitempty"`
+	Rcode      string    `json:"rcode"`
+	TotalMs    float64   `json:"total_ms"`
+	GeoMs      float64   `json:"geo_ms"`
+	DBMs       float64   `json:"db_ms"`
+	UpstreamMs float64   `json:"upstream_ms"`
+}
+
+// slowQueries lists the slowest recent DNS lookups, slowest first, with the
+// time spent in GeoIP, the database and upstream servers.
+func (s *Server) slowQueries(c *gin.Context) {
+	l, ok := s.dnsServer.(slowQueryLister)
+	if !ok || !s.cfg.SlowQueries.Enabled {
+		c.JSON(http.StatusNotFound, gin.H{"error": "slow query log is disabled (slow_queries.enabled)"})
+		return
+	}
+	out := []slowQueryResp{}
+	for _, q := range l.SlowQueries() {
+		out = append(out, slowQueryResp{
+			Time: q.Time.UTC(), Name: q.Name, Type: q.Type, Client: q.Client,
+			Source: q.Source, Zone: q.Zone, Rule: q.Rule,
+			Country: q.Geo.Country, Continent: q.Geo.Continent, ASN: q.Geo.ASN,
+			Rcode: q.Rcode, TotalMs: ms(q.Total), GeoMs: ms(q.Timing.Geo),
+			DBMs: ms(q.Timing.DB), UpstreamMs: ms(q.Timing.Upstream),
+		})
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// ms renders d in milliseconds with microsecond precision.
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,54 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/config"
+	"namedot/internal/geoip"
+	dnssrv "namedot/internal/server/dns"
+)
+
+// slowDNS is a DNS server with a fixed slow query log.
+type slowDNS struct {
+	mockDNSServer
+}
+
+func (slowDNS) SlowQueries() []dnssrv.SlowQuery {
+	return []dnssrv.SlowQuery{{
+		Name: "www.example.com.", Type: "A", Source: "forward", Rcode: "NOERROR",
+		Geo:    geoip.Info{Country: "DE", ASN: 3320},
+		Total:  120 * time.Millisecond,
+		Timing: dnssrv.Timing{Geo: 50 * time.Microsecond, Upstream: 110 * time.Millisecond},
+	}}
+}
+
+func TestSlowQueries(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	get := func(cfg *config.Config) *httptest.ResponseRecorder {
+		server := NewServer(cfg, setupTestDB(t), &slowDNS{})
+		req := httptest.NewRequest("GET", "/debug/slow-queries", nil)
+		req.Header.Set("Authorization", "Bearer testtoken")
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := get(&config.Config{APIToken: "testtoken"}); w.Code != http.StatusNotFound {
+		t.Fatalf("disabled: %d %s", w.Code, w.Body.String())
+	}
+	w := get(&config.Config{APIToken: "testtoken", SlowQueries: config.SlowQueriesConfig{Enabled: true}})
+	var got []slowQueryResp
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || w.Code != http.StatusOK || len(got) != 1 {
+		t.Fatalf("enabled: %d %s", w.Code, w.Body.String())
+	}
+	if q := got[0]; q.Name != "www.example.com." || q.Country != "DE" || q.ASN != 3320 ||
+		q.TotalMs != 120 || q.GeoMs != 0.05 || q.UpstreamMs != 110 || q.DBMs != 0 {
+		t.Fatalf("unexpected entry: %+v", q)
+	}
+}
@@ -0,0 +1,73 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	dbm "namedot/internal/db"
+)
+
+func (s *Server) getSOA(c *gin.Context) {
+	var z dbm.Zone
+	if err := s.db.First(&z, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
+		return
+	}
+	soa, err := dbm.GetSOA(s.db, z.ID)
+	if errors.Is(err, dbm.ErrNoSOA) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, soa)
+}
+
+// updateSOA replaces the SOA fields of a zone. The serial in the payload is
+// ignored; the stored serial is incremented.
+func (s *Server) updateSOA(c *gin.Context) {
+	var z dbm.Zone
+	if err := s.db.First(&z, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
+		return
+	}
+	var req dbm.SOA
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	s.storeSOA(c, z, req)
+}
+
+// resetSOA replaces the SOA of a zone with the defaults from config.
+func (s *Server) resetSOA(c *gin.Context) {
+	var z dbm.Zone
+	if err := s.db.First(&z, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
+		return
+	}
+	s.storeSOA(c, z, dbm.DefaultSOA(z.Name, s.cfg.SOA.Primary, s.cfg.SOA.Hostmaster))
+}
+
+func (s *Server) storeSOA(c *gin.Context, z dbm.Zone, soa dbm.SOA) {
+	soa, err := dbm.SetSOA(s.dbFor(c), z, soa)
+	if errors.Is(err, dbm.ErrInvalidSOA) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.audit(c, dbm.AuditSOAUpdate, z, 0, fmt.Sprintf("%s %s serial %d", soa.Primary, soa.Hostmaster, soa.Serial))
+	// Invalidate DNS cache after zone record change
+	if s.dnsServer != nil {
+		s.dnsServer.InvalidateZoneCache()
+	}
+	c.JSON(http.StatusOK, soa)
+}
@@ -0,0 +1,76 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/config"
+	"namedot/internal/db"
+)
+
+func TestSOA_GetUpdateReset(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{APIToken: "testtoken", SOA: config.SOAConfig{Primary: "ns1.{zone}", Hostmaster: "dns.{zone}"}}
+	server, gormDB, _ := setupZoneTestServer(t, cfg)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer testtoken")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		return w
+	}
+	decode := func(w *httptest.ResponseRecorder) db.SOA {
+		t.Helper()
+		var soa db.SOA
+		if err := json.Unmarshal(w.Body.Bytes(), &soa); err != nil {
+			t.Fatalf("decode SOA: %v: %s", err, w.Body.String())
+		}
+		return soa
+	}
+
+	zone := db.Zone{Name: "soa.test."}
+	if err := gormDB.Create(&zone).Error; err != nil {
+		t.Fatalf("create zone: %v", err)
+	}
+	base := "/zones/" + strconv.Itoa(int(zone.ID)) + "/soa"
+
+	if w := do("GET", base, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("get missing SOA: expected 404, got %d", w.Code)
+	}
+
+	w := do("PUT", base, `{"primary":"ns.{zone}","hostmaster":"admin.soa.test.","refresh":3600,"retry":600,"expire":86400,"minimum":60,"ttl":1800}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("put SOA: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	put := decode(w)
+	if put.Primary != "ns.soa.test." || put.Minimum != 60 || put.TTL != 1800 || put.Serial == 0 {
+		t.Fatalf("unexpected SOA after put: %+v", put)
+	}
+
+	w = do("GET", base, "")
+	if w.Code != http.StatusOK || decode(w) != put {
+		t.Fatalf("get SOA: %d %s", w.Code, w.Body.String())
+	}
+
+	if w := do("PUT", base, `{"primary":"ns.{zone}","hostmaster":"admin.soa.test.","refresh":0,"retry":600,"expire":86400,"minimum":60,"ttl":1800}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("put invalid SOA: expected 400, got %d", w.Code)
+	}
+
+	w = do("POST", base+"/reset", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("reset SOA: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	reset := decode(w)
+	if reset.Primary != "ns1.soa.test." || reset.Hostmaster != "dns.soa.test." || reset.Refresh != db.DefaultSOARefresh || reset.Serial != put.Serial+1 {
+		t.Fatalf("unexpected SOA after reset: %+v", reset)
+	}
+}
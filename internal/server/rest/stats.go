@@ -0,0 +1,194 @@
+package rest
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	dbm "namedot/internal/db"
+	"namedot/internal/server/rest/zoneio"
+	"namedot/internal/stats"
+)
+
+type queryStatsResp struct {
+	From  time.Time       `json:"from"`
+	To    time.Time       `json:"to"`
+	Total int64           `json:"total"`
+	Items []dbm.QueryStat `json:"items"`
+}
+
+// statsRange parses the from/to query params (RFC3339, default last 24h),
+// answering 400 itself when they are invalid.
+func statsRange(c *gin.Context) (from, to time.Time, ok bool) {
+	to = time.Now().UTC()
+	if v := c.Query("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to: expected RFC3339"})
+			return from, to, false
+		}
+		to = t.UTC()
+	}
+	from = to.Add(-24 * time.Hour)
+	if v := c.Query("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from: expected RFC3339"})
+			return from, to, false
+		}
+		from = t.UTC()
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return from, to, false
+	}
+	return from, to, true
+}
+
+// queryStats returns aggregated DNS query counters (hourly resolution).
+// Query params: zone, qtype, from/to (RFC3339, default last 24h), group=hour.
+func (s *Server) queryStats(c *gin.Context) {
+	from, to, ok := statsRange(c)
+	if !ok {
+		return
+	}
+	group := c.Query("group")
+	if group != "" && group != "hour" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group must be 'hour'"})
+		return
+	}
+
+	f := dbm.QueryStatsFilter{
+		QType:  strings.ToUpper(strings.TrimSpace(c.Query("qtype"))),
+		From:   from.Truncate(time.Hour),
+		To:     to,
+		ByHour: group == "hour",
+	}
+	if z := c.Query("zone"); z != "" {
+		f.Zone = zoneio.NormalizeFQDN(z)
+	}
+	items, err := dbm.QueryStats(s.reader(), f)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	resp := queryStatsResp{From: f.From, To: to, Items: items}
+	for _, it := range items {
+		resp.Total += it.Queries
+	}
+	if resp.Items == nil {
+		resp.Items = []dbm.QueryStat{}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// clientStatsLimit is the default number of subnets in /stats/clients.
+const clientStatsLimit = 20
+
+type clientStatsResp struct {
+	From  time.Time        `json:"from"`
+	To    time.Time        `json:"to"`
+	Total int64            `json:"total"`
+	Items []dbm.ClientStat `json:"items"`
+}
+
+// clientStats returns the busiest client subnets (/24 for IPv4, /48 for
+// IPv6). Query params: from/to (RFC3339, default last 24h), limit (default
+// 20, 0 = all). Total counts the queries of all subnets in the range.
+func (s *Server) clientStats(c *gin.Context) {
+	from, to, ok := statsRange(c)
+	if !ok {
+		return
+	}
+	limit := clientStatsLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+		limit = n
+	}
+	from = from.Truncate(time.Hour)
+	items, err := dbm.ClientStats(s.reader(), from, to, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	total, err := dbm.ClientStatsTotal(s.reader(), from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if items == nil {
+		items = []dbm.ClientStat{}
+	}
+	c.JSON(http.StatusOK, clientStatsResp{From: from, To: to, Total: total, Items: items})
+}
+
+type zoneStatsResp struct {
+	Zone  string            `json:"zone"`
+	From  time.Time         `json:"from"`
+	To    time.Time         `json:"to"`
+	Group string            `json:"group"`
+	Total int64             `json:"total"`
+	Items []stats.ReportRow `json:"items"`
+}
+
+// zoneStats returns the usage report of a zone: its queries by period and
+// type. Query params: month (YYYY-MM) or from/to (RFC3339), default the
+// previous calendar month; group=hour|day|month (default day);
+// format=json|csv.
+func (s *Server) zoneStats(c *gin.Context) {
+	var z dbm.Zone
+	if err := s.reader().First(&z, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
+		return
+	}
+	group := c.DefaultQuery("group", stats.GroupDay)
+	if !stats.ValidGroup(group) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group must be 'hour', 'day' or 'month'"})
+		return
+	}
+	format := strings.ToLower(c.DefaultQuery("format", "json"))
+	if format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported format"})
+		return
+	}
+	var from, to time.Time
+	if c.Query("from") != "" || c.Query("to") != "" {
+		var ok bool
+		if from, to, ok = statsRange(c); !ok {
+			return
+		}
+	} else {
+		var err error
+		if from, to, err = stats.MonthRange(c.Query("month"), time.Now()); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	rows, err := stats.ZoneReport(s.reader(), z.Name, from, to, group)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if format == "csv" {
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.csv"`,
+			strings.TrimSuffix(z.Name, "."), from.Format("2006-01-02")))
+		var buf bytes.Buffer
+		_ = stats.WriteCSV(&buf, z.Name, rows)
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+		return
+	}
+	resp := zoneStatsResp{Zone: z.Name, From: from, To: to, Group: group, Items: rows}
+	for _, r := range rows {
+		resp.Total += r.Queries
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,165 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/config"
+	"namedot/internal/db"
+)
+
+func TestQueryStats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{APIToken: "testtoken"}
+	server, gormDB, _ := setupZoneTestServer(t, cfg)
+
+	now := time.Now().UTC()
+	if err := db.AddQueryCounts(gormDB, now, []db.QueryCount{
+		{Zone: "example.com.", QType: "A", Queries: 7},
+		{Zone: "example.com.", QType: "MX", Queries: 2},
+		{Zone: "example.org.", QType: "A", Queries: 1},
+	}); err != nil {
+		t.Fatalf("seed stats: %v", err)
+	}
+	if err := db.AddQueryCounts(gormDB, now.Add(-time.Hour), []db.QueryCount{{Zone: "example.com.", QType: "A", Queries: 3}}); err != nil {
+		t.Fatalf("seed stats: %v", err)
+	}
+
+	get := func(query string) (int, queryStatsResp) {
+		req := httptest.NewRequest(http.MethodGet, "/stats/queries"+query, nil)
+		req.Header.Set("Authorization", "Bearer testtoken")
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		var resp queryStatsResp
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	code, resp := get("")
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if resp.Total != 13 || len(resp.Items) != 3 {
+		t.Fatalf("unexpected totals: %+v", resp)
+	}
+	if resp.Items[0].Zone != "example.com." || resp.Items[0].QType != "A" || resp.Items[0].Queries != 10 {
+		t.Errorf("expected busiest pair first, got %+v", resp.Items[0])
+	}
+
+	_, resp = get("?zone=EXAMPLE.com&qtype=a&group=hour")
+	if len(resp.Items) != 2 || resp.Total != 10 {
+		t.Errorf("expected 2 hourly buckets for example.com A, got %+v", resp.Items)
+	}
+
+	if code, _ := get("?from=yesterday"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid from, got %d", code)
+	}
+	if code, _ := get("?group=day"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for unsupported group, got %d", code)
+	}
+}
+
+func TestClientStats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server, gormDB, _ := setupZoneTestServer(t, &config.Config{APIToken: "testtoken"})
+
+	now := time.Now().UTC()
+	if err := db.AddClientCounts(gormDB, now, []db.ClientCount{
+		{Subnet: "192.0.2.0/24", Queries: 5},
+		{Subnet: "2001:db8::/48", Queries: 9},
+		{Subnet: "198.51.100.0/24", Queries: 1},
+	}); err != nil {
+		t.Fatalf("seed stats: %v", err)
+	}
+	if err := db.AddClientCounts(gormDB, now.Add(-time.Hour), []db.ClientCount{{Subnet: "192.0.2.0/24", Queries: 6}}); err != nil {
+		t.Fatalf("seed stats: %v", err)
+	}
+
+	get := func(query string) (int, clientStatsResp) {
+		req := httptest.NewRequest(http.MethodGet, "/stats/clients"+query, nil)
+		req.Header.Set("Authorization", "Bearer testtoken")
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		var resp clientStatsResp
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	code, resp := get("")
+	if code != http.StatusOK || resp.Total != 21 || len(resp.Items) != 3 {
+		t.Fatalf("unexpected response %d: %+v", code, resp)
+	}
+	if resp.Items[0].Subnet != "192.0.2.0/24" || resp.Items[0].Queries != 11 {
+		t.Errorf("expected busiest subnet first, got %+v", resp.Items[0])
+	}
+
+	_, resp = get("?limit=1")
+	if len(resp.Items) != 1 || resp.Total != 21 {
+		t.Errorf("limit should cut the items but not the total, got %+v", resp)
+	}
+	if code, _ := get("?limit=-1"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for negative limit, got %d", code)
+	}
+}
+
+func TestZoneStats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{APIToken: "testtoken"}
+	server, gormDB, _ := setupZoneTestServer(t, cfg)
+
+	z := db.Zone{Name: "example.com."}
+	if err := gormDB.Create(&z).Error; err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2026, 9, 14, 10, 0, 0, 0, time.UTC)
+	for _, h := range []time.Time{day, day.Add(2 * time.Hour), day.AddDate(0, 0, 1)} {
+		if err := db.AddQueryCounts(gormDB, h, []db.QueryCount{{Zone: "example.com.", QType: "A", Queries: 5}, {Zone: "example.org.", QType: "A", Queries: 1}}); err != nil {
+			t.Fatalf("seed stats: %v", err)
+		}
+	}
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/zones/%d/stats%s", z.ID, query), nil)
+		req.Header.Set("Authorization", "Bearer testtoken")
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("?month=2026-09")
+	var resp zoneStatsResp
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("json: %d %s", w.Code, w.Body.String())
+	}
+	if resp.Zone != "example.com." || resp.Group != "day" || resp.Total != 15 || len(resp.Items) != 2 || resp.Items[0].Queries != 10 {
+		t.Fatalf("unexpected report: %+v", resp)
+	}
+
+	w = get("?month=2026-09&group=month&format=csv")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("csv: %d %v", w.Code, w.Header())
+	}
+	if w.Body.String() != "period,zone,qtype,queries\n2026-09,example.com.,A,15\n" {
+		t.Fatalf("csv body: %q", w.Body.String())
+	}
+
+	for _, q := range []string{"?group=week", "?month=september", "?format=xml"} {
+		if w := get(q); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", q, w.Code)
+		}
+	}
+	req := httptest.NewRequest(http.MethodGet, "/zones/999/stats", nil)
+	req.Header.Set("Authorization", "Bearer testtoken")
+	w = httptest.NewRecorder()
+	server.r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown zone: expected 404, got %d", w.Code)
+	}
+}
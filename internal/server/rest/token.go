@@ -0,0 +1,66 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	dbm "namedot/internal/db"
+)
+
+// credentialCacheTTL bounds how long a token rotated by another process,
+// e.g. "namedot token rotate", takes to be accepted.
+const credentialCacheTTL = 30 * time.Second
+
+type rotateTokenReq struct {
+	GraceSec *int `json:"grace_sec"` // how long the old token keeps working (default: 24h)
+}
+
+type rotateTokenResp struct {
+	Token         string    `json:"token"`
+	OldValidUntil time.Time `json:"old_valid_until"`
+}
+
+// rotateToken answers POST /token/rotate: it replaces the main API token
+// with a new random one, returned only in this response, and keeps the old
+// one valid for the grace period so clients and slaves can switch over.
+func (s *Server) rotateToken(c *gin.Context) {
+	var req rotateTokenReq
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+			return
+		}
+	}
+	grace := dbm.DefaultCredentialGrace
+	if req.GraceSec != nil {
+		if *req.GraceSec < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "grace_sec must be >= 0"})
+			return
+		}
+		grace = time.Duration(*req.GraceSec) * time.Second
+	}
+	configHash, err := dbm.APITokenHash(s.cfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	token, err := dbm.NewSecret(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	cred, err := dbm.RotateCredential(s.db, dbm.CredentialAPIToken, "", token, configHash, grace)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.creds.Invalidate()
+	until := cred.CreatedAt.Add(grace).UTC()
+	s.audit(c, dbm.AuditCredentialRotate, dbm.Zone{}, 0, fmt.Sprintf("api token; old valid until %s", until.Format(time.RFC3339)))
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, rotateTokenResp{Token: token, OldValidUntil: until})
+}
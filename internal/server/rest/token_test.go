@@ -0,0 +1,61 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/config"
+	"namedot/internal/db"
+)
+
+func TestRotateToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server, gormDB, _ := setupZoneTestServer(t, &config.Config{APIToken: "testtoken"})
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("POST", "/token/rotate", "testtoken", `{"grace_sec":-1}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("negative grace: %d", w.Code)
+	}
+	w := do("POST", "/token/rotate", "testtoken", `{"grace_sec":3600}`)
+	var resp rotateTokenResp
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusCreated || resp.Token == "" ||
+		w.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("rotate: %d %s", w.Code, w.Body.String())
+	}
+	for _, token := range []string{"testtoken", resp.Token} {
+		if w := do("GET", "/zones", token, ""); w.Code != http.StatusOK {
+			t.Fatalf("token %q during grace: %d", token, w.Code)
+		}
+	}
+
+	// Rotating again without grace retires both earlier tokens
+	w = do("POST", "/token/rotate", resp.Token, `{"grace_sec":0}`)
+	var next rotateTokenResp
+	if err := json.Unmarshal(w.Body.Bytes(), &next); err != nil || w.Code != http.StatusCreated {
+		t.Fatalf("second rotate: %d %s", w.Code, w.Body.String())
+	}
+	for token, want := range map[string]int{"testtoken": http.StatusUnauthorized, resp.Token: http.StatusUnauthorized, next.Token: http.StatusOK} {
+		if w := do("GET", "/zones", token, ""); w.Code != want {
+			t.Fatalf("token %q: %d, want %d", token, w.Code, want)
+		}
+	}
+
+	var n int64
+	gormDB.Model(&db.AuditEntry{}).Where("action = ?", db.AuditCredentialRotate).Count(&n)
+	if n != 2 {
+		t.Fatalf("credential.rotate audit entries: %d", n)
+	}
+}
@@ -0,0 +1,77 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	dbm "namedot/internal/db"
+)
+
+type trashItem struct {
+	dbm.TrashEntry
+	PurgeAt time.Time `json:"purge_at"`
+}
+
+// listTrash returns deleted zones that can still be restored
+func (s *Server) listTrash(c *gin.Context) {
+	entries, err := dbm.ListTrash(s.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	retention := time.Duration(s.cfg.TrashRetentionDays) * 24 * time.Hour
+	items := make([]trashItem, 0, len(entries))
+	for _, e := range entries {
+		items = append(items, trashItem{TrashEntry: e, PurgeAt: e.DeletedAt.Add(retention)})
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+func (s *Server) restoreTrash(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	z, err := dbm.RestoreZone(s.db, uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found in trash"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	// Secondaries may have dropped the zone; make sure they pick it up again
+	dbm.TouchZone(s.db, *z, s.cfg)
+	s.audit(c, dbm.AuditZoneRestore, *z, 0, z.Name)
+	if s.dnsServer != nil {
+		s.dnsServer.InvalidateZoneCache()
+	}
+	c.JSON(http.StatusOK, z)
+}
+
+func (s *Server) purgeTrash(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var z dbm.Zone
+	s.db.Unscoped().First(&z, id)
+	if err := dbm.PurgeZone(s.db, uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found in trash"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.audit(c, dbm.AuditZonePurge, z, 0, z.Name)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,90 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/config"
+	"namedot/internal/db"
+)
+
+func TestTrash_DeleteRestorePurge(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{APIToken: "testtoken", TrashRetentionDays: 30}
+	server, gormDB, mockDNS := setupZoneTestServer(t, cfg)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer testtoken")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		return w
+	}
+
+	zone := db.Zone{Name: "trash.test.", RRSets: []db.RRSet{{Name: "www.trash.test.", Type: "A", TTL: 300, Records: []db.RData{{Data: "192.0.2.1"}}}}}
+	if err := gormDB.Create(&zone).Error; err != nil {
+		t.Fatalf("create zone: %v", err)
+	}
+	id := strconv.Itoa(int(zone.ID))
+
+	if w := do("DELETE", "/zones/"+id, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("delete: expected 204, got %d", w.Code)
+	}
+
+	w := do("GET", "/trash", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("list trash: expected 200, got %d", w.Code)
+	}
+	var items []trashItem
+	if err := json.Unmarshal(w.Body.Bytes(), &items); err != nil {
+		t.Fatalf("decode trash: %v", err)
+	}
+	if len(items) != 1 || items[0].Name != "trash.test." || items[0].RRSets != 1 {
+		t.Fatalf("unexpected trash: %+v", items)
+	}
+	if items[0].PurgeAt.Sub(items[0].DeletedAt).Hours() != 30*24 {
+		t.Fatalf("unexpected purge_at: %+v", items[0])
+	}
+
+	// Name is held by the trashed zone
+	if w := do("POST", "/zones", `{"name":"trash.test"}`); w.Code != http.StatusConflict {
+		t.Fatalf("create over trashed name: expected 409, got %d", w.Code)
+	}
+
+	mockDNS.invalidateCalled = false
+	if w := do("POST", "/trash/"+id+"/restore", ""); w.Code != http.StatusOK {
+		t.Fatalf("restore: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if !mockDNS.invalidateCalled {
+		t.Fatalf("restore should invalidate DNS cache")
+	}
+	var count int64
+	gormDB.Model(&db.RRSet{}).Where("zone_id = ? AND name = ?", zone.ID, "www.trash.test.").Count(&count)
+	if count != 1 {
+		t.Fatalf("rrset not restored")
+	}
+
+	if w := do("POST", "/trash/"+id+"/restore", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("restore active zone: expected 404, got %d", w.Code)
+	}
+
+	do("DELETE", "/zones/"+id, "")
+	if w := do("DELETE", "/trash/"+id, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("purge: expected 204, got %d", w.Code)
+	}
+	gormDB.Unscoped().Model(&db.Zone{}).Where("id = ?", zone.ID).Count(&count)
+	if count != 0 {
+		t.Fatalf("zone should be gone after purge")
+	}
+	if w := do("POST", "/zones", `{"name":"trash.test"}`); w.Code != http.StatusCreated {
+		t.Fatalf("create after purge: expected 201, got %d", w.Code)
+	}
+}
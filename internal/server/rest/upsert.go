@@ -0,0 +1,317 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+	"gorm.io/gorm"
+
+	dbm "namedot/internal/db"
+	"namedot/internal/server/rest/zoneio"
+)
+
+// The declarative routes address zones by name and rrsets by owner name and
+// type, so tools such as a Terraform provider can PUT the desired state
+// without looking up IDs first. Repeating a PUT changes nothing, and the IDs
+// of zones, rrsets and unchanged records stay the same across updates.
+
+// zoneByKey loads a zone by the :id of a zone route, which is either a
+// numeric zone ID or a zone name.
+func (s *Server) zoneByKey(key string) (dbm.Zone, error) {
+	var z dbm.Zone
+	if id, err := strconv.ParseUint(key, 10, 32); err == nil {
+		return z, s.db.First(&z, id).Error
+	}
+	return z, s.db.Where("name = ?", zoneio.NormalizeFQDN(key)).First(&z).Error
+}
+
+// ownerName turns the owner name of a declarative rrset route into an FQDN:
+// "@" is the apex, names with a trailing dot are absolute and anything else
+// is relative to the zone.
+func ownerName(name, zone string) string {
+	n := strings.ToLower(strings.TrimSpace(name))
+	if strings.HasSuffix(n, ".") && n != "." {
+		return n
+	}
+	return fqdn(n, zone)
+}
+
+// zonePutReq is the desired state of a zone. Omitted fields are reset to
+// their defaults.
+type zonePutReq struct {
+	Disabled     bool       `json:"disabled"`
+	ExpireAt     *time.Time `json:"expire_at"`
+	InactiveDays int        `json:"inactive_days"`
+	ExpireAction string     `json:"expire_action"`
+}
+
+// upsertZone creates the zone named in the path, or updates its settings,
+// answering 201 and 200 respectively.
+func (s *Server) upsertZone(c *gin.Context) {
+	key := c.Param("id")
+	if _, err := strconv.ParseUint(key, 10, 32); err == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "PUT /zones/{name} takes a zone name, not an ID"})
+		return
+	}
+	name := zoneio.NormalizeFQDN(key)
+	if _, ok := dns.IsDomainName(name); !ok || name == "." {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid zone name"})
+		return
+	}
+	var req zonePutReq
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+			return
+		}
+	}
+	req.ExpireAction = strings.ToLower(strings.TrimSpace(req.ExpireAction))
+	if err := validExpiry(req.InactiveDays, req.ExpireAction); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !zoneAllowed(c, name) {
+		forbidZone(c)
+		return
+	}
+
+	z, err := s.zoneByKey(name)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if dbm.ZoneNameInTrash(s.db, name) {
+			c.JSON(http.StatusConflict, gin.H{"error": dbm.ErrZoneNameInTrash.Error()})
+			return
+		}
+		z = dbm.Zone{Name: name, Disabled: req.Disabled, ExpireAt: req.ExpireAt, InactiveDays: req.InactiveDays, ExpireAction: req.ExpireAction}
+		if err := s.dbFor(c).Create(&z).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		dbm.TouchZone(s.db, z, s.cfg)
+		_ = s.db.First(&z, z.ID).Error // pick up the serial
+		s.audit(c, dbm.AuditZoneCreate, z, 0, z.Name)
+		if s.dnsServer != nil {
+			s.dnsServer.InvalidateZoneCache()
+		}
+		c.JSON(http.StatusCreated, z)
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if z.Disabled != req.Disabled {
+		updates["disabled"] = req.Disabled
+	}
+	if !sameTime(z.ExpireAt, req.ExpireAt) {
+		updates["expire_at"] = req.ExpireAt
+	}
+	if z.InactiveDays != req.InactiveDays {
+		updates["inactive_days"] = req.InactiveDays
+	}
+	if z.ExpireAction != req.ExpireAction {
+		updates["expire_action"] = req.ExpireAction
+	}
+	if len(updates) > 0 {
+		if err := s.db.Model(&z).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		_ = s.db.First(&z, z.ID).Error
+		s.audit(c, dbm.AuditZoneUpdate, z, 0, fmt.Sprint(updates))
+		if s.dnsServer != nil {
+			s.dnsServer.InvalidateZoneCache()
+		}
+	}
+	c.JSON(http.StatusOK, z)
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Equal(*b)
+}
+
+// rrsetPutReq is the desired state of an rrset whose name and type are
+// given by the path.
+type rrsetPutReq struct {
+	TTL     uint32      `json:"ttl"`
+	Comment string      `json:"comment"`
+	Records []dbm.RData `json:"records"`
+}
+
+// rrsetByName resolves the zone, owner name and type of a declarative rrset
+// route, answering the request itself when they are invalid.
+func (s *Server) rrsetByName(c *gin.Context) (z dbm.Zone, name, rtype string, ok bool) {
+	z, err := s.zoneByKey(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "zone not found"})
+		return z, "", "", false
+	}
+	rtype = strings.ToUpper(c.Param("type"))
+	if _, known := dns.StringToType[rtype]; !known {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown record type " + c.Param("type")})
+		return z, "", "", false
+	}
+	name = ownerName(c.Param("rid"), z.Name)
+	if !dns.IsSubDomain(z.Name, name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": name + " is outside zone " + z.Name})
+		return z, "", "", false
+	}
+	return z, name, rtype, true
+}
+
+func (s *Server) getRRSetByName(c *gin.Context) {
+	z, name, rtype, ok := s.rrsetByName(c)
+	if !ok {
+		return
+	}
+	var set dbm.RRSet
+	if err := s.db.Preload("Records").Where("zone_id = ? AND name = ? AND type = ?", z.ID, name, rtype).First(&set).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "rrset not found"})
+		return
+	}
+	c.JSON(http.StatusOK, set)
+}
+
+// upsertRRSet makes the rrset named in the path hold exactly the given
+// records. Records already present keep their IDs; when nothing differs the
+// zone serial is left alone.
+func (s *Server) upsertRRSet(c *gin.Context) {
+	z, name, rtype, ok := s.rrsetByName(c)
+	if !ok {
+		return
+	}
+	var req rrsetPutReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	if len(req.Records) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "records must not be empty"})
+		return
+	}
+	want := rrsetReq{Records: req.Records}.recordsNormalized()
+	if rtype == "CNAME" {
+		for i := range want {
+			if want[i].Data == "@" {
+				want[i].Data = fqdn("@", z.Name)
+			}
+		}
+	}
+	if req.TTL == 0 && s.cfg.RecordDefaultTTL() > 0 {
+		req.TTL = s.cfg.RecordDefaultTTL()
+	}
+	check := dbm.RRSet{Name: name, Type: rtype, TTL: req.TTL, Records: want}
+	if err := dbm.CheckRRSetTTL(s.cfg.RecordTTL, check); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := dbm.CheckRecordSelectors(check); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var set dbm.RRSet
+	created, changed := false, false
+	err := s.dbFor(c).Transaction(func(tx *gorm.DB) error {
+		err := tx.Preload("Records").Where("zone_id = ? AND name = ? AND type = ?", z.ID, name, rtype).First(&set).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			set = dbm.RRSet{ZoneID: z.ID, Name: name, Type: rtype, TTL: req.TTL, Comment: req.Comment, Records: want}
+			created, changed = true, true
+			return tx.Create(&set).Error
+		}
+		if err != nil {
+			return err
+		}
+		if set.TTL != req.TTL || set.Comment != req.Comment {
+			set.TTL, set.Comment = req.TTL, req.Comment
+			if err := tx.Model(&dbm.RRSet{}).Where("id = ?", set.ID).Updates(map[string]interface{}{"ttl": set.TTL, "comment": set.Comment}).Error; err != nil {
+				return err
+			}
+			changed = true
+		}
+		have := make(map[string]dbm.RData, len(set.Records))
+		for _, rec := range set.Records {
+			have[rec.Identity()] = rec
+		}
+		records := make([]dbm.RData, 0, len(want))
+		for _, rec := range want {
+			id := rec.Identity()
+			if old, ok := have[id]; ok {
+				records = append(records, old)
+				delete(have, id)
+				continue
+			}
+			rec.RRSetID = set.ID
+			if err := tx.Create(&rec).Error; err != nil {
+				return err
+			}
+			records = append(records, rec)
+			changed = true
+		}
+		for _, old := range have {
+			if err := tx.Unscoped().Delete(&dbm.RData{}, old.ID).Error; err != nil {
+				return err
+			}
+			changed = true
+		}
+		set.Records = records
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		s.audit(c, dbm.AuditRRSetCreate, z, set.ID, rrsetSummary(set))
+	} else if changed {
+		s.audit(c, dbm.AuditRRSetUpdate, z, set.ID, rrsetSummary(set))
+	}
+	if changed {
+		dbm.TouchZone(s.db, z, s.cfg)
+		if s.dnsServer != nil {
+			s.dnsServer.InvalidateZoneCache()
+		}
+	}
+	c.JSON(status, set)
+}
+
+// deleteRRSetByName removes the rrset named in the path. Deleting an rrset
+// that does not exist succeeds.
+func (s *Server) deleteRRSetByName(c *gin.Context) {
+	z, name, rtype, ok := s.rrsetByName(c)
+	if !ok {
+		return
+	}
+	var set dbm.RRSet
+	if err := s.db.Where("zone_id = ? AND name = ? AND type = ?", z.ID, name, rtype).First(&set).Error; err != nil {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	if err := s.dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("rr_set_id = ?", set.ID).Delete(&dbm.RData{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&dbm.RRSet{}, set.ID).Error
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.audit(c, dbm.AuditRRSetDelete, z, set.ID, set.Name+" "+set.Type)
+	dbm.BumpSOASerial(s.db, z.ID)
+	if s.dnsServer != nil {
+		s.dnsServer.InvalidateZoneCache()
+	}
+	c.Status(http.StatusNoContent)
+}
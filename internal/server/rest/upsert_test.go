@@ -0,0 +1,120 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/config"
+	"namedot/internal/db"
+)
+
+func TestUpsertByName_Idempotent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{APIToken: "testtoken", DefaultTTL: 300, SOA: config.SOAConfig{AutoOnMissing: true}}
+	server, gormDB, _ := setupZoneTestServer(t, cfg)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer testtoken")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		return w
+	}
+	decode := func(w *httptest.ResponseRecorder, v any) {
+		t.Helper()
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("decode %s: %v", w.Body.String(), err)
+		}
+	}
+
+	w := do("PUT", "/zones/Upsert.Test", "")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create zone: %d %s", w.Code, w.Body.String())
+	}
+	var zone db.Zone
+	decode(w, &zone)
+	if zone.Name != "upsert.test." {
+		t.Fatalf("zone name: %q", zone.Name)
+	}
+	w = do("PUT", "/zones/upsert.test.", "")
+	var again db.Zone
+	decode(w, &again)
+	if w.Code != http.StatusOK || again.ID != zone.ID || again.Serial != zone.Serial {
+		t.Fatalf("repeated zone PUT: %d %+v", w.Code, again)
+	}
+	if w := do("PUT", "/zones/upsert.test", `{"disabled":true}`); w.Code != http.StatusOK {
+		t.Fatalf("update zone: %d %s", w.Code, w.Body.String())
+	}
+	gormDB.First(&again, zone.ID)
+	if !again.Disabled {
+		t.Fatal("PUT should disable the zone")
+	}
+	if w := do("PUT", "/zones/12", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("PUT by ID: %d", w.Code)
+	}
+
+	body := `{"ttl":120,"records":[{"data":"192.0.2.1"},{"data":"192.0.2.2"}]}`
+	w = do("PUT", "/zones/upsert.test/rrsets/www/a", body)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create rrset: %d %s", w.Code, w.Body.String())
+	}
+	var set db.RRSet
+	decode(w, &set)
+	if set.Name != "www.upsert.test." || set.Type != "A" || len(set.Records) != 2 {
+		t.Fatalf("rrset: %+v", set)
+	}
+	gormDB.First(&zone, zone.ID)
+
+	w = do("PUT", "/zones/upsert.test/rrsets/www.upsert.test./A", body)
+	var same db.RRSet
+	decode(w, &same)
+	if w.Code != http.StatusOK || same.ID != set.ID || same.Records[0].ID != set.Records[0].ID {
+		t.Fatalf("repeated rrset PUT: %d %+v", w.Code, same)
+	}
+	gormDB.First(&again, zone.ID)
+	if again.Serial != zone.Serial {
+		t.Fatalf("unchanged PUT bumped the serial: %d -> %d", zone.Serial, again.Serial)
+	}
+
+	w = do("PUT", "/zones/upsert.test/rrsets/www/A", `{"ttl":120,"records":[{"data":"192.0.2.1"},{"data":"192.0.2.3"}]}`)
+	var changed db.RRSet
+	decode(w, &changed)
+	if w.Code != http.StatusOK || changed.ID != set.ID || len(changed.Records) != 2 || changed.Records[0].ID != set.Records[0].ID || changed.Records[1].Data != "192.0.2.3" {
+		t.Fatalf("changed rrset PUT: %d %+v", w.Code, changed)
+	}
+	var n int64
+	gormDB.Model(&db.RData{}).Where("rr_set_id = ?", set.ID).Count(&n)
+	if n != 2 {
+		t.Fatalf("stored records: %d", n)
+	}
+
+	w = do("GET", "/zones/upsert.test/rrsets/www/A", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("get rrset by name: %d", w.Code)
+	}
+	if w := do("GET", "/zones/upsert.test", ""); w.Code != http.StatusOK {
+		t.Fatalf("get zone by name: %d", w.Code)
+	}
+	for _, path := range []string{"/zones/upsert.test/rrsets/www/BOGUS", "/zones/upsert.test/rrsets/www.other.test./A"} {
+		if w := do("PUT", path, body); w.Code != http.StatusBadRequest {
+			t.Fatalf("PUT %s: %d", path, w.Code)
+		}
+	}
+
+	if w := do("DELETE", "/zones/upsert.test/rrsets/www/A", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("delete rrset: %d", w.Code)
+	}
+	if w := do("GET", "/zones/upsert.test/rrsets/www/A", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("deleted rrset: %d", w.Code)
+	}
+	if w := do("DELETE", "/zones/upsert.test/rrsets/www/A", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("delete missing rrset: %d", w.Code)
+	}
+}
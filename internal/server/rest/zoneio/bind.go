@@ -1,25 +1,43 @@
 package zoneio
 
 import (
+    "bufio"
     "fmt"
     "io"
+    "strconv"
     "strings"
 
     "github.com/miekg/dns"
     "gorm.io/gorm"
 
+    "namedot/internal/config"
     dbm "namedot/internal/db"
 )
 
-// ToBind serializes a zone to a simplistic BIND-like zonefile.
+// dynamicComment starts the comment ToBind writes for the dynamic URL of an
+// rrset and ImportBIND reads back.
+const dynamicComment = "; dynamic:"
+
+// ToBind serializes a zone to a simplistic BIND-like zonefile. Disabled
+// records are written as comments, so importing the file leaves them out.
+// The URL of a dynamic rrset is written as a comment too, which ImportBIND
+// restores.
 func ToBind(z *dbm.Zone) string {
     var b strings.Builder
     b.WriteString("$ORIGIN ")
     b.WriteString(strings.TrimSuffix(z.Name, "."))
     b.WriteString(".\n")
     for _, rs := range z.RRSets {
+        if rs.DynamicURL != nil {
+            // The records below answer until the endpoint first does, and
+            // again once its records are stale
+            fmt.Fprintf(&b, "%s %s %d %s %s\n", dynamicComment, dns.Fqdn(rs.Name), rs.TTL, strings.ToUpper(rs.Type), *rs.DynamicURL)
+        }
         for _, r := range rs.Records {
-            line := fmt.Sprintf("%s %d IN %s %s\n", strings.TrimSuffix(rs.Name, "."), rs.TTL, strings.ToUpper(rs.Type), r.Data)
+            line := fmt.Sprintf("%s %d IN %s %s\n", dns.Fqdn(rs.Name), r.AnswerTTL(rs.TTL), strings.ToUpper(rs.Type), r.Data)
+            if r.Disabled {
+                line = "; disabled: " + line
+            }
             b.WriteString(line)
         }
     }
@@ -28,36 +46,121 @@ func ToBind(z *dbm.Zone) string {
 
 // ImportBIND parses BIND zone text and merges into zone according to mode.
 // mode: upsert | replace
-func ImportBIND(db *gorm.DB, zone *dbm.Zone, r io.Reader, mode string, defaultTTL uint32) error {
-    origin := dns.Fqdn(zone.Name)
-    zp := dns.NewZoneParser(r, origin, "import")
+// Entries that fail to parse are skipped and reported with their line;
+// records outside the zone are rejected, and rrsets with TTLs outside
+// limits are skipped with a warning. A "; dynamic: NAME TTL TYPE URL"
+// comment, as ToBind writes it, gives the rrset its dynamic URL.
+func ImportBIND(db *gorm.DB, zone *dbm.Zone, r io.Reader, mode string, defaultTTL uint32, limits config.RecordTTLConfig) (*ImportReport, error) {
+    rep := newReport()
+    entries, err := splitBIND(r)
+    if err != nil {
+        return nil, err
+    }
 
-    // accumulate rrsets grouped by name+type
+    // accumulate rrsets grouped by name+type, in file order
     type key struct{ name, typ string }
-    rrsets := map[key]*dbm.RRSet{}
-
-    for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
-        if err := zp.Err(); err != nil { return err }
-        if rr == nil { continue }
-        hdr := rr.Header()
-        name := strings.ToLower(dns.Fqdn(hdr.Name))
-        typ := strings.ToUpper(dns.TypeToString[hdr.Rrtype])
-        k := key{name: name, typ: typ}
-        rs := rrsets[k]
-        if rs == nil {
-            ttl := hdr.Ttl
-            if ttl == 0 && defaultTTL > 0 {
-                ttl = defaultTTL
+    index := map[key]int{}
+    var sets []dbm.RRSet
+    var dynamic []dbm.RRSet // from dynamic comments, in file order
+
+    origin := dns.Fqdn(strings.ToLower(zone.Name))
+    ttl := ""          // $TTL value, or the last record's TTL without one
+    directive := false // ttl came from $TTL
+    owner := ""        // owner of the last record, for lines starting blank
+    for _, e := range entries {
+        fields := strings.Fields(e.text)
+        if e.dynamic {
+            set, err := dynamicSet(fields, origin)
+            if err != nil {
+                rep.warn(e.line, "%v", err)
+                continue
+            }
+            dynamic = append(dynamic, set)
+            continue
+        }
+        switch strings.ToUpper(fields[0]) {
+        case "$ORIGIN":
+            name, ok := originName(fields, origin)
+            if !ok {
+                rep.warn(e.line, "bad $ORIGIN")
+                continue
+            }
+            origin = name
+            continue
+        case "$TTL":
+            zp := dns.NewZoneParser(strings.NewReader(e.text), origin, "")
+            zp.Next()
+            if err := zp.Err(); err != nil {
+                rep.warn(e.line, "%s", parseMessage(err))
+                continue
+            }
+            ttl, directive = strings.SplitN(fields[1], ";", 2)[0], true
+            continue
+        case "$INCLUDE":
+            rep.warn(e.line, "$INCLUDE is not supported")
+            continue
+        }
+
+        text := e.text
+        if (text[0] == ' ' || text[0] == '\t') && owner != "" {
+            text = owner + text
+        }
+        if ttl != "" {
+            text = "$TTL " + ttl + "\n" + text
+        }
+        zp := dns.NewZoneParser(strings.NewReader(text), origin, "")
+        var rrs []dns.RR
+        for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+            rrs = append(rrs, rr)
+        }
+        if err := zp.Err(); err != nil {
+            rep.warn(e.line, "%s", parseMessage(err))
+            rep.Skipped++
+            continue
+        }
+        for _, rr := range rrs {
+            hdr := rr.Header()
+            name := strings.ToLower(dns.Fqdn(hdr.Name))
+            typ := strings.ToUpper(dns.TypeToString[hdr.Rrtype])
+            k := key{name: name, typ: typ}
+            i, ok := index[k]
+            if !ok {
+                ttl := hdr.Ttl
+                if ttl == 0 && defaultTTL > 0 {
+                    ttl = defaultTTL
+                }
+                i = len(sets)
+                index[k] = i
+                sets = append(sets, dbm.RRSet{ZoneID: zone.ID, Name: name, Type: typ, TTL: ttl})
+            }
+            // keep the first TTL if already set
+            sets[i].Records = append(sets[i].Records, dbm.RData{Data: rdataFromRR(rr)})
+        }
+        if n := len(rrs); n > 0 {
+            owner = rrs[n-1].Header().Name
+            if !directive {
+                ttl = strconv.FormatUint(uint64(rrs[n-1].Header().Ttl), 10)
             }
-            rs = &dbm.RRSet{ZoneID: zone.ID, Name: name, Type: typ, TTL: ttl}
-            rrsets[k] = rs
         }
-        data := rdataFromRR(rr)
-        rs.Records = append(rs.Records, dbm.RData{Data: data})
-        // keep the first TTL if already set
     }
+    for _, d := range dynamic {
+        k := key{name: d.Name, typ: d.Type}
+        if i, ok := index[k]; ok {
+            sets[i].DynamicURL = d.DynamicURL
+            continue
+        }
+        // A dynamic rrset without stored records
+        d.ZoneID = zone.ID
+        index[k] = len(sets)
+        sets = append(sets, d)
+    }
+    // Repeated lines in the zone file would otherwise become duplicate
+    // answers, and targets differing by case duplicate records
+    sets = rep.normalize(sets)
+    sets = rep.inZone(zone.Name, sets)
+    sets = rep.withinTTL(limits, sets)
 
-    return db.Transaction(func(tx *gorm.DB) error {
+    err = db.Transaction(func(tx *gorm.DB) error {
         if strings.ToLower(mode) == "replace" {
             var rrsetIDs []uint
             if err := tx.Model(&dbm.RRSet{}).Where("zone_id = ?", zone.ID).Pluck("id", &rrsetIDs).Error; err != nil {
@@ -72,26 +175,177 @@ func ImportBIND(db *gorm.DB, zone *dbm.Zone, r io.Reader, mode string, defaultTT
                 return err
             }
         }
-        for _, rs := range rrsets {
+        for i := range sets {
+            rs := &sets[i]
             var existing dbm.RRSet
-            _ = tx.Where("zone_id = ? AND name = ? AND type = ?", zone.ID, rs.Name, rs.Type).Limit(1).Find(&existing).Error
+            _ = tx.Preload("Records").Where("zone_id = ? AND name = ? AND type = ?", zone.ID, rs.Name, rs.Type).Limit(1).Find(&existing).Error
             if existing.ID != 0 {
+                if existing.TTL == rs.TTL && sameDynamicURL(existing, *rs) && sameRecords(existing.Records, rs.Records) {
+                    rep.Skipped += len(rs.Records)
+                    continue
+                }
                 if err := tx.Unscoped().Where("rr_set_id = ?", existing.ID).Delete(&dbm.RData{}).Error; err != nil {
                     return err
                 }
                 existing.TTL = rs.TTL
+                existing.DynamicURL = rs.DynamicURL
                 existing.Records = rs.Records
                 if err := tx.Save(&existing).Error; err != nil {
                     return err
                 }
+                rep.Updated += len(rs.Records)
             } else {
                 if err := tx.Create(rs).Error; err != nil {
                     return err
                 }
+                rep.Created += len(rs.Records)
             }
         }
+        dbm.SyncZoneSerial(tx, zone.ID)
         return nil
     })
+    if err != nil {
+        return nil, err
+    }
+    return rep, nil
+}
+
+// bindEntry is one record or directive of a zone file and the line it
+// starts on. Records spanning lines in parentheses are joined.
+type bindEntry struct {
+    line    int
+    text    string
+    dynamic bool // text is a dynamic comment without its prefix
+}
+
+// splitBIND breaks zone text into entries, dropping blank and comment lines
+// other than dynamic comments.
+func splitBIND(r io.Reader) ([]bindEntry, error) {
+    sc := bufio.NewScanner(r)
+    sc.Buffer(make([]byte, 64*1024), 1<<20)
+    var out []bindEntry
+    var cur strings.Builder
+    start, depth, n := 0, 0, 0
+    content := false
+    for sc.Scan() {
+        n++
+        line := sc.Text()
+        if rest, ok := strings.CutPrefix(strings.TrimSpace(line), dynamicComment); ok && depth == 0 {
+            out = append(out, bindEntry{line: n, text: rest, dynamic: true})
+            continue
+        }
+        if depth == 0 {
+            start, content = n, false
+            cur.Reset()
+        } else {
+            cur.WriteByte('\n')
+        }
+        cur.WriteString(line)
+        delta, text := scanLine(line)
+        depth += delta
+        content = content || text
+        if depth <= 0 {
+            depth = 0
+            if content {
+                out = append(out, bindEntry{line: start, text: cur.String()})
+            }
+        }
+    }
+    if depth > 0 && content {
+        out = append(out, bindEntry{line: start, text: cur.String()})
+    }
+    return out, sc.Err()
+}
+
+// scanLine returns how a line changes the parenthesis depth, ignoring
+// quoted text and comments, and whether it holds anything but a comment.
+func scanLine(line string) (delta int, content bool) {
+    quoted := false
+    for i := 0; i < len(line); i++ {
+        c := line[i]
+        switch {
+        case quoted && c == '\\':
+            i++
+        case c == '"':
+            quoted = !quoted
+        case quoted:
+        case c == ';':
+            return delta, content
+        case c == '(':
+            delta++
+        case c == ')':
+            delta--
+        }
+        if c != ' ' && c != '\t' && c != '(' && c != ')' {
+            content = true
+        }
+    }
+    return delta, content
+}
+
+// dynamicSet parses the fields of a dynamic comment, NAME TTL TYPE URL,
+// into an rrset without records.
+func dynamicSet(fields []string, origin string) (dbm.RRSet, error) {
+    if len(fields) != 4 {
+        return dbm.RRSet{}, fmt.Errorf("bad dynamic comment: want NAME TTL TYPE URL")
+    }
+    name, ok := origin, fields[0] == "@"
+    if !ok {
+        name, ok = absoluteName(fields[0], origin)
+    }
+    if !ok {
+        return dbm.RRSet{}, fmt.Errorf("bad dynamic comment: invalid name %q", fields[0])
+    }
+    ttl, err := strconv.ParseUint(fields[1], 10, 32)
+    if err != nil {
+        return dbm.RRSet{}, fmt.Errorf("bad dynamic comment: invalid TTL %q", fields[1])
+    }
+    typ := strings.ToUpper(fields[2])
+    if _, ok := dns.StringToType[typ]; !ok {
+        return dbm.RRSet{}, fmt.Errorf("bad dynamic comment: unknown type %q", fields[2])
+    }
+    url := fields[3]
+    set := dbm.RRSet{Name: name, Type: typ, TTL: uint32(ttl), DynamicURL: &url}
+    if err := dbm.CheckDynamicURL(set); err != nil {
+        return dbm.RRSet{}, err
+    }
+    return set, nil
+}
+
+// originName resolves the name of an $ORIGIN directive against the current
+// origin.
+func originName(fields []string, cur string) (string, bool) {
+    if len(fields) < 2 || strings.HasPrefix(fields[1], ";") {
+        return "", false
+    }
+    return absoluteName(fields[1], cur)
+}
+
+// absoluteName lowercases name and resolves it against the origin cur
+// unless it ends with a dot.
+func absoluteName(name, cur string) (string, bool) {
+    name = strings.ToLower(name)
+    if !dns.IsFqdn(name) {
+        if cur == "." {
+            name += "."
+        } else {
+            name += "." + cur
+        }
+    }
+    if _, ok := dns.IsDomainName(name); !ok {
+        return "", false
+    }
+    return name, true
+}
+
+// parseMessage drops the position from a parser error; it refers to the
+// entry, not to the file.
+func parseMessage(err error) string {
+    msg := strings.TrimPrefix(err.Error(), "dns: ")
+    if i := strings.Index(msg, " at line: "); i >= 0 {
+        msg = msg[:i]
+    }
+    return msg
 }
 
 func rdataFromRR(rr dns.RR) string {
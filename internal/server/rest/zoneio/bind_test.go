@@ -7,6 +7,7 @@ import (
     "gorm.io/driver/sqlite"
     "gorm.io/gorm"
 
+    "namedot/internal/config"
     dbm "namedot/internal/db"
 )
 
@@ -30,7 +31,7 @@ www 300 IN A 192.0.2.1
 www 300 IN A 192.0.2.2
 `
 
-    if err := ImportBIND(db, &z, strings.NewReader(zoneTxt), "replace", 300); err != nil {
+    if _, err := ImportBIND(db, &z, strings.NewReader(zoneTxt), "replace", 300, config.RecordTTLConfig{}); err != nil {
         t.Fatalf("import bind: %v", err)
     }
 
@@ -51,9 +52,58 @@ www 300 IN A 192.0.2.2
     // Export back to BIND and check contains lines
     z2 := dbm.Zone{ID: z.ID, Name: z.Name, RRSets: sets}
     out := ToBind(&z2)
-    if !strings.Contains(out, "www.example.com 300 IN A 192.0.2.1") {
+    if !strings.Contains(out, "www.example.com. 300 IN A 192.0.2.1") {
         t.Fatalf("export missing A record: %s", out)
     }
+
+    // Disabled records are exported as comments
+    a.Records[1].Disabled = true
+    out = ToBind(&z2)
+    if !strings.Contains(out, "\n; disabled: www.example.com. 300 IN A 192.0.2.2\n") {
+        t.Fatalf("disabled record not commented out: %s", out)
+    }
+}
+
+func TestToBind_ImportBIND_RoundTrip(t *testing.T) {
+    db := newTestDB(t)
+    z := dbm.Zone{Name: "roundtrip.test"}
+    if err := db.Create(&z).Error; err != nil { t.Fatalf("create zone: %v", err) }
+    pool, empty := "http://lb.internal/pool/web", "https://lb.internal/pool/api"
+    src := dbm.Zone{Name: z.Name, RRSets: []dbm.RRSet{
+        {Name: "roundtrip.test.", Type: "A", TTL: 300, Records: []dbm.RData{{Data: "192.0.2.1"}}},
+        {Name: "web.roundtrip.test.", Type: "A", TTL: 30, DynamicURL: &pool, Records: []dbm.RData{{Data: "192.0.2.10"}}},
+        {Name: "api.roundtrip.test.", Type: "AAAA", TTL: 60, DynamicURL: &empty},
+    }}
+    txt := ToBind(&src)
+    rep, err := ImportBIND(db, &z, strings.NewReader(txt), "replace", 300, config.RecordTTLConfig{})
+    if err != nil { t.Fatalf("import bind: %v", err) }
+    if len(rep.Warnings) != 0 { t.Fatalf("warnings: %v\n%s", rep.Warnings, txt) }
+
+    var sets []dbm.RRSet
+    if err := db.Preload("Records").Where("zone_id = ?", z.ID).Find(&sets).Error; err != nil {
+        t.Fatalf("load rrsets: %v", err)
+    }
+    got := map[string]dbm.RRSet{}
+    for _, rs := range sets {
+        got[rs.Name+" "+rs.Type] = rs
+    }
+    if len(got) != len(src.RRSets) { t.Fatalf("rrsets after round trip: %v\n%s", got, txt) }
+    for _, want := range src.RRSets {
+        rs, ok := got[want.Name+" "+want.Type]
+        if !ok { t.Fatalf("%s %s missing after round trip:\n%s", want.Name, want.Type, txt) }
+        if rs.TTL != want.TTL || !sameDynamicURL(rs, want) || !sameRecords(rs.Records, want.Records) {
+            t.Fatalf("%s %s: got %+v, want %+v", want.Name, want.Type, rs, want)
+        }
+    }
+
+    // Importing the export again changes nothing
+    rep, err = ImportBIND(db, &z, strings.NewReader(txt), "upsert", 300, config.RecordTTLConfig{})
+    if err != nil { t.Fatalf("re-import: %v", err) }
+    if rep.Created != 0 || rep.Updated != 0 { t.Fatalf("re-import changed records: %+v", rep) }
+
+    rep, err = ImportBIND(db, &z, strings.NewReader("; dynamic: web 30 A ftp://lb.internal/\n"), "upsert", 300, config.RecordTTLConfig{})
+    if err != nil { t.Fatalf("import bad url: %v", err) }
+    if len(rep.Warnings) != 1 { t.Fatalf("expected a warning for a bad dynamic URL, got %v", rep.Warnings) }
 }
 
 func TestImportJSON_DefaultTTL(t *testing.T) {
@@ -61,12 +111,12 @@ func TestImportJSON_DefaultTTL(t *testing.T) {
     z := dbm.Zone{Name: "example2.com"}
     if err := db.Create(&z).Error; err != nil { t.Fatalf("create zone: %v", err) }
 
-    src := dbm.Zone{RRSets: []dbm.RRSet{{Name: "www.example.com.", Type: "A", TTL: 0, Records: []dbm.RData{{Data: "192.0.2.5"}}}}}
-    if err := ImportJSON(db, &z, &src, "replace", 1234); err != nil {
+    src := dbm.Zone{RRSets: []dbm.RRSet{{Name: "www.example2.com.", Type: "A", TTL: 0, Records: []dbm.RData{{Data: "192.0.2.5"}}}}}
+    if _, err := ImportJSON(db, &z, &src, "replace", 1234, config.RecordTTLConfig{}); err != nil {
         t.Fatalf("import json: %v", err)
     }
     var set dbm.RRSet
-    if err := db.Where("zone_id = ? AND name = ? AND type = ?", z.ID, "www.example.com.", "A").First(&set).Error; err != nil {
+    if err := db.Where("zone_id = ? AND name = ? AND type = ?", z.ID, "www.example2.com.", "A").First(&set).Error; err != nil {
         t.Fatalf("load set: %v", err)
     }
     if set.TTL != 1234 { t.Fatalf("expected ttl 1234, got %d", set.TTL) }
@@ -77,12 +127,12 @@ func TestImportJSON_NoDefaultTTL_KeepsZeroTTL(t *testing.T) {
     z := dbm.Zone{Name: "example3.com"}
     if err := db.Create(&z).Error; err != nil { t.Fatalf("create zone: %v", err) }
 
-    src := dbm.Zone{RRSets: []dbm.RRSet{{Name: "api.example.com.", Type: "A", TTL: 0, Records: []dbm.RData{{Data: "192.0.2.6"}}}}}
-    if err := ImportJSON(db, &z, &src, "replace", 0); err != nil {
+    src := dbm.Zone{RRSets: []dbm.RRSet{{Name: "api.example3.com.", Type: "A", TTL: 0, Records: []dbm.RData{{Data: "192.0.2.6"}}}}}
+    if _, err := ImportJSON(db, &z, &src, "replace", 0, config.RecordTTLConfig{}); err != nil {
         t.Fatalf("import json: %v", err)
     }
     var set dbm.RRSet
-    if err := db.Where("zone_id = ? AND name = ? AND type = ?", z.ID, "api.example.com.", "A").First(&set).Error; err != nil {
+    if err := db.Where("zone_id = ? AND name = ? AND type = ?", z.ID, "api.example3.com.", "A").First(&set).Error; err != nil {
         t.Fatalf("load set: %v", err)
     }
     if set.TTL != 0 { t.Fatalf("expected ttl 0 to be preserved, got %d", set.TTL) }
@@ -99,7 +149,7 @@ func TestImportJSON_Replace_RemovesMissingRRSet(t *testing.T) {
         {Name: "example4.com.", Type: "A", TTL: 300, Records: []dbm.RData{{Data: "192.0.2.10"}}},
         {Name: "example4.com.", Type: "MX", TTL: 300, Records: []dbm.RData{{Data: "mail.example4.com."}}},
     }}
-    if err := ImportJSON(db, &z, &initial, "replace", 0); err != nil {
+    if _, err := ImportJSON(db, &z, &initial, "replace", 0, config.RecordTTLConfig{}); err != nil {
         t.Fatalf("seed import: %v", err)
     }
 
@@ -107,7 +157,7 @@ func TestImportJSON_Replace_RemovesMissingRRSet(t *testing.T) {
     updated := dbm.Zone{RRSets: []dbm.RRSet{
         {Name: "example4.com.", Type: "A", TTL: 300, Records: []dbm.RData{{Data: "192.0.2.20"}}},
     }}
-    if err := ImportJSON(db, &z, &updated, "replace", 0); err != nil {
+    if _, err := ImportJSON(db, &z, &updated, "replace", 0, config.RecordTTLConfig{}); err != nil {
         t.Fatalf("import replace: %v", err)
     }
 
@@ -122,3 +172,109 @@ func TestImportJSON_Replace_RemovesMissingRRSet(t *testing.T) {
         t.Fatalf("expected only A rrset, got %s", sets[0].Type)
     }
 }
+
+func TestImportBIND_Report(t *testing.T) {
+    db := newTestDB(t)
+    z := dbm.Zone{Name: "report.test"}
+    if err := db.Create(&z).Error; err != nil { t.Fatalf("create zone: %v", err) }
+
+    zoneTxt := `$ORIGIN report.test.
+$TTL 600
+@ IN SOA ns1 hostmaster (
+        2025010101 ; serial
+        7200 3600 1209600 300 )
+www IN A 192.0.2.1
+    IN A 192.0.2.2
+www IN A 192.0.2.1
+bad IN A not-an-ip
+other.example. IN A 192.0.2.9
+$INCLUDE other.zone
+mail IN MX 10 www
+`
+    rep, err := ImportBIND(db, &z, strings.NewReader(zoneTxt), "upsert", 300, config.RecordTTLConfig{})
+    if err != nil { t.Fatalf("import bind: %v", err) }
+    // SOA + 2 A + MX created; duplicate, bad line and out-of-zone skipped
+    if rep.Created != 4 || rep.Updated != 0 || rep.Skipped != 3 {
+        t.Fatalf("unexpected counts: %+v", rep)
+    }
+    if len(rep.Warnings) != 2 || rep.Warnings[0].Line != 9 || rep.Warnings[1].Line != 11 {
+        t.Fatalf("unexpected warnings: %+v", rep.Warnings)
+    }
+    if len(rep.Rejected) != 1 || rep.Rejected[0] != "other.example." {
+        t.Fatalf("unexpected rejected names: %v", rep.Rejected)
+    }
+    if err := rep.Err(); err == nil || !strings.HasPrefix(err.Error(), "line 9: ") {
+        t.Fatalf("expected line 9 error, got %v", err)
+    }
+
+    var a dbm.RRSet
+    if err := db.Preload("Records").Where("zone_id = ? AND name = ? AND type = ?", z.ID, "www.report.test.", "A").First(&a).Error; err != nil {
+        t.Fatalf("load A: %v", err)
+    }
+    if len(a.Records) != 2 || a.TTL != 600 { t.Fatalf("unexpected A rrset: %+v", a) }
+
+    // Importing again changes nothing; a new address rewrites the set
+    rep, err = ImportBIND(db, &z, strings.NewReader("$ORIGIN report.test.\nwww 600 IN A 192.0.2.1\nwww 600 IN A 192.0.2.2\nmail 600 IN MX 10 mail2\n"), "upsert", 300, config.RecordTTLConfig{})
+    if err != nil { t.Fatalf("reimport: %v", err) }
+    if rep.Created != 0 || rep.Updated != 1 || rep.Skipped != 2 || len(rep.Warnings) != 0 {
+        t.Fatalf("unexpected reimport counts: %+v", rep)
+    }
+}
+
+func TestImport_TTLLimits(t *testing.T) {
+    db := newTestDB(t)
+    z := dbm.Zone{Name: "limits.test."}
+    if err := db.Create(&z).Error; err != nil { t.Fatalf("create zone: %v", err) }
+    limits := config.RecordTTLConfig{Min: 60, Max: 86400}
+
+    rep, err := ImportBIND(db, &z, strings.NewReader("$ORIGIN limits.test.\nwww 300 IN A 192.0.2.1\nfast 1 IN A 192.0.2.2\nslow 2592000 IN A 192.0.2.3\n"), "upsert", 300, limits)
+    if err != nil { t.Fatalf("import bind: %v", err) }
+    if rep.Created != 1 || rep.Skipped != 2 || len(rep.Warnings) != 2 {
+        t.Fatalf("unexpected report: %+v", rep)
+    }
+    if err := rep.Err(); err == nil || !strings.Contains(err.Error(), "fast.limits.test. A: ttl 1 is below record_ttl.min (60)") {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    // A per-record override counts as well
+    long := uint32(604800)
+    src := dbm.Zone{RRSets: []dbm.RRSet{
+        {Name: "txt.limits.test.", Type: "TXT", TTL: 300, Records: []dbm.RData{{Data: `"x"`, TTL: &long}}},
+        {Name: "ok.limits.test.", Type: "A", Records: []dbm.RData{{Data: "192.0.2.4"}}},
+    }}
+    rep, err = ImportJSON(db, &z, &src, "upsert", 300, limits)
+    if err != nil { t.Fatalf("import json: %v", err) }
+    if rep.Created != 1 || len(rep.Warnings) != 1 || !strings.Contains(rep.Warnings[0].Message, "above record_ttl.max") {
+        t.Fatalf("unexpected report: %+v", rep)
+    }
+}
+
+func TestImport_MergesCaseDuplicates(t *testing.T) {
+    db := newTestDB(t)
+    z := dbm.Zone{Name: "dupes.test."}
+    if err := db.Create(&z).Error; err != nil { t.Fatalf("create zone: %v", err) }
+
+    src := dbm.Zone{RRSets: []dbm.RRSet{
+        {Name: "WWW.dupes.test", Type: "a", TTL: 300, Records: []dbm.RData{{Data: "192.0.2.1"}}},
+        {Name: "www.Dupes.Test.", Type: "A", TTL: 60, Records: []dbm.RData{{Data: "192.0.2.1 "}, {Data: "192.0.2.2"}}},
+    }}
+    rep, err := ImportJSON(db, &z, &src, "upsert", 0, config.RecordTTLConfig{})
+    if err != nil { t.Fatalf("import json: %v", err) }
+    var sets []dbm.RRSet
+    db.Preload("Records").Where("zone_id = ?", z.ID).Find(&sets)
+    if len(sets) != 1 || sets[0].Name != "www.dupes.test." || sets[0].TTL != 300 || len(sets[0].Records) != 2 {
+        t.Fatalf("json rrsets: %+v", sets)
+    }
+    if rep.Created != 2 || rep.Skipped != 1 { t.Fatalf("json report: %+v", rep) }
+
+    zoneText := "$ORIGIN dupes.test.\n$TTL 300\nalias IN CNAME Target.dupes.test.\nALIAS IN CNAME target.DUPES.test.\n"
+    rep, err = ImportBIND(db, &z, strings.NewReader(zoneText), "upsert", 0, config.RecordTTLConfig{})
+    if err != nil { t.Fatalf("import bind: %v", err) }
+    var alias dbm.RRSet
+    if err := db.Preload("Records").Where("zone_id = ? AND name = ? AND type = ?", z.ID, "alias.dupes.test.", "CNAME").First(&alias).Error; err != nil {
+        t.Fatalf("load alias: %v", err)
+    }
+    if len(alias.Records) != 1 || alias.Records[0].Data != "target.dupes.test." || rep.Skipped != 1 {
+        t.Fatalf("bind alias: %+v report %+v", alias, rep)
+    }
+}
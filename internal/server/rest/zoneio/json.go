@@ -1,10 +1,14 @@
 package zoneio
 
 import (
+    "encoding/json"
+    "errors"
+    "io"
     "strings"
 
     "gorm.io/gorm"
 
+    "namedot/internal/config"
     dbm "namedot/internal/db"
 )
 
@@ -17,10 +21,70 @@ func NormalizeFQDN(name string) string {
     return n
 }
 
+// ErrInvalidJSON is returned by DecodeJSON for input that is not a zone export.
+var ErrInvalidJSON = errors.New("invalid json")
+
+// DecodeJSON reads a zone in the /zones/{id}/export JSON format. Timestamps
+// are dropped so exports from another server can be imported as is.
+func DecodeJSON(r io.Reader) (*dbm.Zone, error) {
+    var raw any
+    dec := json.NewDecoder(r)
+    dec.UseNumber()
+    if err := dec.Decode(&raw); err != nil {
+        return nil, ErrInvalidJSON
+    }
+    buf, err := json.Marshal(stripTimestamps(raw))
+    if err != nil {
+        return nil, ErrInvalidJSON
+    }
+    var z dbm.Zone
+    if err := json.Unmarshal(buf, &z); err != nil {
+        return nil, ErrInvalidJSON
+    }
+    return &z, nil
+}
+
+func stripTimestamps(v any) any {
+    switch t := v.(type) {
+    case map[string]any:
+        out := make(map[string]any, len(t))
+        for k, val := range t {
+            lk := strings.ToLower(k)
+            if lk == "created_at" || lk == "updated_at" || lk == "deleted_at" {
+                continue
+            }
+            out[k] = stripTimestamps(val)
+        }
+        return out
+    case []any:
+        out := make([]any, len(t))
+        for i, val := range t {
+            out[i] = stripTimestamps(val)
+        }
+        return out
+    default:
+        return v
+    }
+}
+
 // ImportJSON imports RRsets from src into dst zone.
 // mode: upsert | replace
-func ImportJSON(db *gorm.DB, dst *dbm.Zone, src *dbm.Zone, mode string, defaultTTL uint32) error {
-    return db.Transaction(func(tx *gorm.DB) error {
+// RRsets differing only by name case are merged and repeated records
+// collapsed before anything is written.
+// RRsets outside dst are rejected, and those with TTLs outside limits or an
+// invalid geo selector are skipped with a warning.
+func ImportJSON(db *gorm.DB, dst *dbm.Zone, src *dbm.Zone, mode string, defaultTTL uint32, limits config.RecordTTLConfig) (*ImportReport, error) {
+    rep := newReport()
+    sets := rep.normalize(src.RRSets)
+    for i := range sets {
+        if sets[i].TTL == 0 && defaultTTL > 0 {
+            sets[i].TTL = defaultTTL
+        }
+    }
+    sets = rep.inZone(dst.Name, sets)
+    sets = rep.withinTTL(limits, sets)
+    sets = rep.validGeo(sets)
+    err := db.Transaction(func(tx *gorm.DB) error {
         if mode == "replace" {
             var rrsetIDs []uint
             if err := tx.Model(&dbm.RRSet{}).Where("zone_id = ?", dst.ID).Pluck("id", &rrsetIDs).Error; err != nil {
@@ -35,38 +99,49 @@ func ImportJSON(db *gorm.DB, dst *dbm.Zone, src *dbm.Zone, mode string, defaultT
                 return err
             }
         }
-        for _, rs := range src.RRSets {
+        for _, rs := range sets {
             rs.ID = 0                     // ignore incoming rrset ID
             rs.ZoneID = dst.ID
-            rs.Name = NormalizeFQDN(rs.Name)
             rs.Type = strings.ToUpper(rs.Type)
-            if rs.TTL == 0 && defaultTTL > 0 {
-                rs.TTL = defaultTTL
-            }
             // drop record IDs so GORM inserts fresh rows
+            rs.Records = append([]dbm.RData(nil), rs.Records...)
             for i := range rs.Records {
                 rs.Records[i].ID = 0
                 rs.Records[i].RRSetID = 0
             }
+            rep.dedupe(&rs)
 
             // Upsert by name+type
             var existing dbm.RRSet
-            if err := tx.Where("zone_id = ? AND name = ? AND type = ?", dst.ID, rs.Name, rs.Type).First(&existing).Error; err == nil {
+            if err := tx.Preload("Records").Where("zone_id = ? AND name = ? AND type = ?", dst.ID, rs.Name, rs.Type).First(&existing).Error; err == nil {
+                if existing.TTL == rs.TTL && existing.Comment == rs.Comment && sameDynamicURL(existing, rs) && sameRecords(existing.Records, rs.Records) {
+                    rep.Skipped += len(rs.Records)
+                    continue
+                }
                 // replace records
                 if err := tx.Unscoped().Where("rr_set_id = ?", existing.ID).Delete(&dbm.RData{}).Error; err != nil {
                     return err
                 }
                 existing.TTL = rs.TTL
+                existing.Comment = rs.Comment
+                existing.DynamicURL = rs.DynamicURL
                 existing.Records = rs.Records
                 if err := tx.Save(&existing).Error; err != nil {
                     return err
                 }
+                rep.Updated += len(rs.Records)
             } else {
                 if err := tx.Create(&rs).Error; err != nil {
                     return err
                 }
+                rep.Created += len(rs.Records)
             }
         }
+        dbm.SyncZoneSerial(tx, dst.ID)
         return nil
     })
+    if err != nil {
+        return nil, err
+    }
+    return rep, nil
 }
@@ -0,0 +1,186 @@
+package zoneio
+
+import (
+    "errors"
+    "fmt"
+    "sort"
+
+    "gorm.io/gorm"
+
+    "namedot/internal/config"
+    dbm "namedot/internal/db"
+)
+
+// Plan actions.
+const (
+    PlanCreate = "create"
+    PlanUpdate = "update"
+    PlanDelete = "delete"
+)
+
+// ErrStalePlan is returned by ApplyPlan when the zone serial is no longer
+// the one the plan was made against.
+var ErrStalePlan = errors.New("zone changed since the plan was made")
+
+// PlanChange is one rrset a plan creates, updates or deletes. Before is the
+// current rrset (update, delete), After the desired one (create, update).
+type PlanChange struct {
+    Action string     `json:"action"`
+    Name   string     `json:"name"`
+    Type   string     `json:"type"`
+    Before *dbm.RRSet `json:"before,omitempty"`
+    After  *dbm.RRSet `json:"after,omitempty"`
+}
+
+// ZonePlan is the difference between a zone and its desired contents.
+type ZonePlan struct {
+    Serial    uint32       `json:"serial"`    // zone serial the plan was made against
+    Changes   []PlanChange `json:"changes"`
+    Unchanged int          `json:"unchanged"` // rrsets that are already as desired
+}
+
+// Plan compares the rrsets of zone, with records preloaded, to the desired
+// ones, which must have FQDN names inside the zone and upper-case types.
+// SOA rrsets on either side are ignored since the server maintains the SOA;
+// an empty desired comment keeps the current one.
+func Plan(zone *dbm.Zone, desired []dbm.RRSet) *ZonePlan {
+    plan := &ZonePlan{Serial: zone.Serial, Changes: []PlanChange{}}
+    current := map[string]*dbm.RRSet{}
+    for i := range zone.RRSets {
+        rs := &zone.RRSets[i]
+        if rs.Type != "SOA" {
+            current[rs.Name+" "+rs.Type] = rs
+        }
+    }
+    for i := range desired {
+        want := &desired[i]
+        if want.Type == "SOA" {
+            continue
+        }
+        key := want.Name + " " + want.Type
+        have, ok := current[key]
+        delete(current, key)
+        if !ok {
+            plan.Changes = append(plan.Changes, PlanChange{Action: PlanCreate, Name: want.Name, Type: want.Type, After: want})
+            continue
+        }
+        if want.Comment == "" {
+            want.Comment = have.Comment
+        }
+        if want.DynamicURL == nil {
+            want.DynamicURL = have.DynamicURL
+        }
+        if have.TTL == want.TTL && have.Comment == want.Comment && sameDynamicURL(*have, *want) && sameRecords(have.Records, want.Records) {
+            plan.Unchanged++
+            continue
+        }
+        plan.Changes = append(plan.Changes, PlanChange{Action: PlanUpdate, Name: want.Name, Type: want.Type, Before: have, After: want})
+    }
+    for _, have := range current {
+        plan.Changes = append(plan.Changes, PlanChange{Action: PlanDelete, Name: have.Name, Type: have.Type, Before: have})
+    }
+    sort.SliceStable(plan.Changes, func(i, j int) bool {
+        a, b := plan.Changes[i], plan.Changes[j]
+        if a.Name != b.Name {
+            return a.Name < b.Name
+        }
+        return a.Type < b.Type
+    })
+    return plan
+}
+
+// ApplyPlan makes the zone hold exactly the desired rrsets in one
+// transaction and returns the plan it carried out. With serial set, the zone
+// must still have that serial or ErrStalePlan is returned and nothing
+// changes. Unchanged rrsets and their records keep their IDs.
+func ApplyPlan(db *gorm.DB, zoneID uint, desired []dbm.RRSet, serial *uint32) (*ZonePlan, error) {
+    var plan *ZonePlan
+    err := db.Transaction(func(tx *gorm.DB) error {
+        var err error
+        plan, _, err = applyPlan(tx, zoneID, desired, serial)
+        return err
+    })
+    if err != nil {
+        return nil, err
+    }
+    return plan, nil
+}
+
+// ReplaceZone is ApplyPlan with the serial bump made in the same
+// transaction, so the new contents appear together with their serial. It
+// returns the plan and the zone serial after it, which is unchanged when the
+// zone already held the desired rrsets.
+func ReplaceZone(db *gorm.DB, zoneID uint, desired []dbm.RRSet, serial *uint32, cfg *config.Config) (*ZonePlan, uint32, error) {
+    var plan *ZonePlan
+    var zone dbm.Zone
+    err := db.Transaction(func(tx *gorm.DB) error {
+        var err error
+        plan, zone, err = applyPlan(tx, zoneID, desired, serial)
+        if err != nil || len(plan.Changes) == 0 {
+            return err
+        }
+        dbm.TouchZone(tx, zone, cfg)
+        return tx.First(&zone, zoneID).Error
+    })
+    if err != nil {
+        return nil, 0, err
+    }
+    return plan, zone.Serial, nil
+}
+
+// applyPlan carries out the plan for the desired rrsets inside tx and
+// returns it with the zone as it was before.
+func applyPlan(tx *gorm.DB, zoneID uint, desired []dbm.RRSet, serial *uint32) (*ZonePlan, dbm.Zone, error) {
+    var zone dbm.Zone
+    if err := tx.Preload("RRSets.Records").First(&zone, zoneID).Error; err != nil {
+        return nil, zone, err
+    }
+    if serial != nil && *serial != zone.Serial {
+        return nil, zone, fmt.Errorf("%w: serial is %d, not %d", ErrStalePlan, zone.Serial, *serial)
+    }
+    plan := Plan(&zone, desired)
+    for _, ch := range plan.Changes {
+        if ch.Before != nil {
+            if err := tx.Unscoped().Where("rr_set_id = ?", ch.Before.ID).Delete(&dbm.RData{}).Error; err != nil {
+                return nil, zone, err
+            }
+        }
+        switch ch.Action {
+        case PlanCreate:
+            rs := *ch.After
+            rs.ID, rs.ZoneID = 0, zone.ID
+            rs.Records = freshRecords(rs.Records)
+            if err := tx.Create(&rs).Error; err != nil {
+                return nil, zone, err
+            }
+        case PlanUpdate:
+            if err := tx.Model(&dbm.RRSet{}).Where("id = ?", ch.Before.ID).Updates(map[string]interface{}{"ttl": ch.After.TTL, "comment": ch.After.Comment, "dynamic_url": ch.After.DynamicURL}).Error; err != nil {
+                return nil, zone, err
+            }
+            recs := freshRecords(ch.After.Records)
+            for i := range recs {
+                recs[i].RRSetID = ch.Before.ID
+            }
+            if len(recs) > 0 {
+                if err := tx.Create(&recs).Error; err != nil {
+                    return nil, zone, err
+                }
+            }
+        case PlanDelete:
+            if err := tx.Unscoped().Delete(&dbm.RRSet{}, ch.Before.ID).Error; err != nil {
+                return nil, zone, err
+            }
+        }
+    }
+    return plan, zone, nil
+}
+
+// freshRecords copies recs without IDs so GORM inserts new rows.
+func freshRecords(recs []dbm.RData) []dbm.RData {
+    out := make([]dbm.RData, len(recs))
+    for i, r := range recs {
+        r.ID, r.RRSetID = 0, 0
+        out[i] = r
+    }
+    return out
+}
@@ -0,0 +1,167 @@
+package zoneio
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+
+    "github.com/miekg/dns"
+
+    "namedot/internal/config"
+    dbm "namedot/internal/db"
+)
+
+// ImportReport describes what an import did, counted in records.
+type ImportReport struct {
+    Created  int             `json:"created"`  // records of rrsets that did not exist
+    Updated  int             `json:"updated"`  // records of rrsets that were rewritten
+    Skipped  int             `json:"skipped"`  // unparsable, duplicate, unchanged or out-of-zone records
+    Warnings []ImportWarning `json:"warnings"` // lines that could not be imported
+    Rejected []string        `json:"rejected"` // owner names outside the zone
+}
+
+// ImportWarning is a problem with one entry of the imported file. Line is
+// zero for formats without lines.
+type ImportWarning struct {
+    Line    int    `json:"line,omitempty"`
+    Message string `json:"message"`
+}
+
+func newReport() *ImportReport {
+    return &ImportReport{Warnings: []ImportWarning{}, Rejected: []string{}}
+}
+
+// Err returns the first warning as an error, or nil. Callers that must not
+// apply a partial import check it inside their transaction.
+func (r *ImportReport) Err() error {
+    if len(r.Warnings) == 0 {
+        return nil
+    }
+    w := r.Warnings[0]
+    if w.Line > 0 {
+        return fmt.Errorf("line %d: %s", w.Line, w.Message)
+    }
+    return fmt.Errorf("%s", w.Message)
+}
+
+func (r *ImportReport) warn(line int, format string, args ...any) {
+    r.Warnings = append(r.Warnings, ImportWarning{Line: line, Message: fmt.Sprintf(format, args...)})
+}
+
+// inZone drops the rrsets whose names are outside zone, noting them as
+// rejected and their records as skipped.
+func (r *ImportReport) inZone(zone string, sets []dbm.RRSet) []dbm.RRSet {
+    origin := dns.Fqdn(strings.ToLower(zone))
+    seen := map[string]bool{}
+    out := sets[:0]
+    for _, rs := range sets {
+        if rs.Name != "" && dns.IsSubDomain(origin, rs.Name) {
+            out = append(out, rs)
+            continue
+        }
+        r.Skipped += len(rs.Records)
+        if !seen[rs.Name] {
+            seen[rs.Name] = true
+            r.Rejected = append(r.Rejected, rs.Name)
+        }
+    }
+    sort.Strings(r.Rejected)
+    return out
+}
+
+// withinTTL drops the rrsets whose TTLs are outside limits (record_ttl),
+// warning about each and counting their records as skipped.
+func (r *ImportReport) withinTTL(limits config.RecordTTLConfig, sets []dbm.RRSet) []dbm.RRSet {
+    out := sets[:0]
+    for _, rs := range sets {
+        if err := dbm.CheckRRSetTTL(limits, rs); err != nil {
+            r.warn(0, "%v", err)
+            r.Skipped += len(rs.Records)
+            continue
+        }
+        out = append(out, rs)
+    }
+    return out
+}
+
+// validGeo drops the rrsets with an invalid geo selector (country,
+// continent or ASN list), warning about each and counting their records as
+// skipped.
+func (r *ImportReport) validGeo(sets []dbm.RRSet) []dbm.RRSet {
+    out := sets[:0]
+    for _, rs := range sets {
+        if err := dbm.CheckRecordSelectors(rs); err != nil {
+            r.warn(0, "%v", err)
+            r.Skipped += len(rs.Records)
+            continue
+        }
+        out = append(out, rs)
+    }
+    return out
+}
+
+// normalize lowercases names, merges rrsets that then share a name and
+// type and collapses identical records, counting the dropped ones as
+// skipped.
+func (r *ImportReport) normalize(sets []dbm.RRSet) []dbm.RRSet {
+    out, dropped := dbm.NormalizeRRSets(sets)
+    r.Skipped += dropped
+    return out
+}
+
+// dedupe drops repeated records from rs, counting them as skipped.
+func (r *ImportReport) dedupe(rs *dbm.RRSet) {
+    n := len(rs.Records)
+    rs.Records = dbm.DedupeRecords(rs.Records)
+    r.Skipped += n - len(rs.Records)
+}
+
+// sameRecords reports whether a and b hold the same records in any order.
+func sameRecords(a, b []dbm.RData) bool {
+    if len(a) != len(b) {
+        return false
+    }
+    ids := make(map[string]int, len(a))
+    for _, rec := range a {
+        ids[recordKey(rec)]++
+    }
+    for _, rec := range b {
+        id := recordKey(rec)
+        if ids[id] == 0 {
+            return false
+        }
+        ids[id]--
+    }
+    return true
+}
+
+// recordKey is the identity of a record plus its TTL override, weight,
+// health check and backup and disabled flags, so a change to any of them
+// counts as a change.
+func recordKey(rec dbm.RData) string {
+    key := rec.Identity()
+    if rec.TTL != nil {
+        key = fmt.Sprintf("%s/%d", key, *rec.TTL)
+    }
+    if rec.Weight != nil {
+        key = fmt.Sprintf("%s/w%d", key, *rec.Weight)
+    }
+    if rec.HealthCheck != nil {
+        key += "/" + *rec.HealthCheck
+    }
+    if rec.Backup {
+        key += "/backup"
+    }
+    if rec.Disabled {
+        key += "/disabled"
+    }
+    return key
+}
+
+// sameDynamicURL reports whether a and b have the same dynamic URL, or none.
+func sameDynamicURL(a, b dbm.RRSet) bool {
+    if a.DynamicURL == nil || b.DynamicURL == nil {
+        return a.DynamicURL == b.DynamicURL
+    }
+    return *a.DynamicURL == *b.DynamicURL
+}
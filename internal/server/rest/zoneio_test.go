@@ -255,17 +255,17 @@ func TestImportZone_JSON(t *testing.T) {
 			mode: "upsert",
 			existingData: false,
 			importPayload: `{
-				"name":"import.test",
+				"name":"export.test",
 				"rrsets":[
 					{
-						"name":"www.import.test.",
+						"name":"www.export.test.",
 						"type":"A",
 						"ttl":300,
 						"records":[{"data":"192.0.2.1"}]
 					}
 				]
 			}`,
-			expectedStatus: http.StatusNoContent,
+			expectedStatus: http.StatusOK,
 			validateResult: func(t *testing.T, db *gorm.DB, zoneID uint) {
 				var rrsets []RRSet
 				if err := db.Preload("Records").Where("zone_id = ?", zoneID).Find(&rrsets).Error; err != nil {
@@ -282,17 +282,17 @@ func TestImportZone_JSON(t *testing.T) {
 			mode: "upsert",
 			existingData: true,
 			importPayload: `{
-				"name":"import.test",
+				"name":"export.test",
 				"rrsets":[
 					{
-						"name":"new.import.test.",
+						"name":"new.export.test.",
 						"type":"A",
 						"ttl":300,
 						"records":[{"data":"192.0.2.2"}]
 					}
 				]
 			}`,
-			expectedStatus: http.StatusNoContent,
+			expectedStatus: http.StatusOK,
 			validateResult: func(t *testing.T, db *gorm.DB, zoneID uint) {
 				var rrsets []RRSet
 				if err := db.Preload("Records").Where("zone_id = ?", zoneID).Find(&rrsets).Error; err != nil {
@@ -301,7 +301,7 @@ func TestImportZone_JSON(t *testing.T) {
 				// Should have the new record
 				found := false
 				for _, rr := range rrsets {
-					if rr.Name == "new.import.test." {
+					if rr.Name == "new.export.test." {
 						found = true
 						break
 					}
@@ -317,10 +317,10 @@ func TestImportZone_JSON(t *testing.T) {
 			mode: "upsert",
 			existingData: false,
 			importPayload: `{
-				"name":"import.test",
+				"name":"export.test",
 				"rrsets":[
 					{
-						"name":"geo.import.test.",
+						"name":"geo.export.test.",
 						"type":"A",
 						"ttl":300,
 						"records":[
@@ -330,10 +330,10 @@ func TestImportZone_JSON(t *testing.T) {
 					}
 				]
 			}`,
-			expectedStatus: http.StatusNoContent,
+			expectedStatus: http.StatusOK,
 			validateResult: func(t *testing.T, db *gorm.DB, zoneID uint) {
 				var rrsets []RRSet
-				if err := db.Preload("Records").Where("zone_id = ? AND name = ?", zoneID, "geo.import.test.").Find(&rrsets).Error; err != nil {
+				if err := db.Preload("Records").Where("zone_id = ? AND name = ?", zoneID, "geo.export.test.").Find(&rrsets).Error; err != nil {
 					t.Fatalf("Failed to load rrsets: %v", err)
 				}
 				if len(rrsets) == 0 {
@@ -362,7 +362,7 @@ func TestImportZone_JSON(t *testing.T) {
 			if tt.existingData {
 				rrset := RRSet{
 					ZoneID: zoneID,
-					Name:   "old.import.test.",
+					Name:   "old.export.test.",
 					Type:   "A",
 					TTL:    300,
 					Records: []RData{
@@ -421,8 +421,19 @@ www A   192.0.2.1
 
 	server.r.ServeHTTP(w, req)
 
-	if w.Code != http.StatusNoContent {
-		t.Errorf("Expected status %d, got %d\nBody: %s", http.StatusNoContent, w.Code, w.Body.String())
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d\nBody: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var report struct {
+		Created  int   `json:"created"`
+		Skipped  int   `json:"skipped"`
+		Warnings []any `json:"warnings"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to decode report: %v", err)
+	}
+	if report.Created != 4 || report.Skipped != 0 || len(report.Warnings) != 0 {
+		t.Errorf("Unexpected import report: %s", w.Body.String())
 	}
 
 	// Verify imported records
@@ -540,3 +551,49 @@ func TestZoneIO_WithoutAuthentication(t *testing.T) {
 		})
 	}
 }
+
+func TestExportZone_UsesReadReplica(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server, _, zoneID := setupZoneIOTestServer(t)
+
+	replica, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open replica: %v", err)
+	}
+	if err := dbm.AutoMigrate(replica); err != nil {
+		t.Fatalf("migrate replica: %v", err)
+	}
+	if err := replica.Create(&Zone{ID: zoneID, Name: "replica.test."}).Error; err != nil {
+		t.Fatalf("create replica zone: %v", err)
+	}
+	server.SetReadDB(replica)
+
+	for _, path := range []string{"/zones/" + strconv.Itoa(int(zoneID)) + "/export", "/sync/export"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer testtoken")
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", path, w.Code, w.Body.String())
+		}
+		if !strings.Contains(w.Body.String(), "replica.test.") || strings.Contains(w.Body.String(), "export.test") {
+			t.Fatalf("%s: expected data from replica, got %s", path, w.Body.String())
+		}
+	}
+
+	// Writes still go to the primary
+	body := bytes.NewBufferString(`{"name":"new.test"}`)
+	req := httptest.NewRequest("POST", "/zones", body)
+	req.Header.Set("Authorization", "Bearer testtoken")
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	server.r.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create zone: expected 201, got %d", w.Code)
+	}
+	var count int64
+	replica.Model(&dbm.Zone{}).Where("name = ?", "new.test.").Count(&count)
+	if count != 0 {
+		t.Fatal("write should not reach the replica")
+	}
+}
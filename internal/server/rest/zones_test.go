@@ -639,3 +639,70 @@ func TestZoneOperations_WithoutAuthentication(t *testing.T) {
 func itoa(u uint) string {
 	return strconv.FormatUint(uint64(u), 10)
 }
+
+func TestPatchZone(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{APIToken: "testtoken"}
+	server, gormDB, mockDNS := setupZoneTestServer(t, cfg)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer testtoken")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", "/zones", `{"name":"temp.test","inactive_days":7,"expire_action":"trash"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var zone db.Zone
+	if err := json.Unmarshal(w.Body.Bytes(), &zone); err != nil {
+		t.Fatalf("decode zone: %v", err)
+	}
+	if zone.InactiveDays != 7 || zone.ExpireAction != "trash" {
+		t.Fatalf("expiry not stored on create: %+v", zone)
+	}
+	id := strconv.Itoa(int(zone.ID))
+
+	if w := do("POST", "/zones", `{"name":"bad.test","expire_action":"delete"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("create with invalid action: expected 400, got %d", w.Code)
+	}
+
+	mockDNS.invalidateCalled = false
+	w = do("PATCH", "/zones/"+id, `{"disabled":true,"expire_at":"2030-01-02T03:04:05Z"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("patch: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if !mockDNS.invalidateCalled {
+		t.Error("Expected DNS cache invalidation after patch")
+	}
+	var stored db.Zone
+	gormDB.First(&stored, zone.ID)
+	if !stored.Disabled || stored.ExpireAt == nil || stored.InactiveDays != 7 {
+		t.Fatalf("unexpected zone after patch: %+v", stored)
+	}
+
+	// null clears the date, omitted fields stay unchanged
+	if w := do("PATCH", "/zones/"+id, `{"expire_at":null,"disabled":false,"no_cache":true}`); w.Code != http.StatusOK {
+		t.Fatalf("patch: expected 200, got %d", w.Code)
+	}
+	stored = db.Zone{}
+	gormDB.First(&stored, zone.ID)
+	if stored.Disabled || stored.ExpireAt != nil || stored.ExpireAction != "trash" || !stored.NoCache {
+		t.Fatalf("unexpected zone after clearing: %+v", stored)
+	}
+
+	if w := do("PATCH", "/zones/"+id, `{"inactive_days":-1}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("negative inactive_days: expected 400, got %d", w.Code)
+	}
+	if w := do("PATCH", "/zones/"+id, `{"expire_at":"tomorrow"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid expire_at: expected 400, got %d", w.Code)
+	}
+	if w := do("PATCH", "/zones/9999", `{"disabled":true}`); w.Code != http.StatusNotFound {
+		t.Fatalf("unknown zone: expected 404, got %d", w.Code)
+	}
+}
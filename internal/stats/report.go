@@ -0,0 +1,105 @@
+package stats
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+
+	dbm "namedot/internal/db"
+)
+
+// Report periods.
+const (
+	GroupHour  = "hour"
+	GroupDay   = "day"
+	GroupMonth = "month"
+)
+
+// ReportRow is the number of queries for one type of a zone in one period.
+type ReportRow struct {
+	Period  string `json:"period"` // 2006-01-02T15Z, 2006-01-02 or 2006-01, in UTC
+	QType   string `json:"qtype"`
+	Queries int64  `json:"queries"`
+}
+
+// ValidGroup reports whether g is a report period.
+func ValidGroup(g string) bool {
+	return g == GroupHour || g == GroupDay || g == GroupMonth
+}
+
+// ZoneReport returns the queries of zone in [from, to) by period and type,
+// in time order. Hours come from the hourly counters, which are kept for
+// stats.retention_days; days and months from the daily ones, kept for
+// stats.daily_retention_days and counted in whole UTC days.
+func ZoneReport(db *gorm.DB, zone string, from, to time.Time, group string) ([]ReportRow, error) {
+	out := []ReportRow{}
+	if group == GroupHour {
+		items, err := dbm.QueryStats(db, dbm.QueryStatsFilter{Zone: zone, From: from.Truncate(time.Hour), To: to, ByHour: true})
+		if err != nil {
+			return nil, err
+		}
+		for _, it := range items {
+			out = append(out, ReportRow{Period: it.Hour.UTC().Format("2006-01-02T15Z"), QType: it.QType, Queries: it.Queries})
+		}
+		return out, nil
+	}
+	days, err := dbm.DailyQueryStats(db, zone, from.UTC().Truncate(24*time.Hour), to)
+	if err != nil {
+		return nil, err
+	}
+	layout := "2006-01-02"
+	if group == GroupMonth {
+		layout = "2006-01"
+	}
+	index := make(map[[2]string]int)
+	for _, d := range days {
+		k := [2]string{d.Day.UTC().Format(layout), d.QType}
+		if i, ok := index[k]; ok {
+			out[i].Queries += d.Queries
+			continue
+		}
+		index[k] = len(out)
+		out = append(out, ReportRow{Period: k[0], QType: d.QType, Queries: d.Queries})
+	}
+	if group == GroupMonth {
+		// Days come ordered by day, then type; put the types of a month in order
+		sort.Slice(out, func(i, j int) bool {
+			if out[i].Period != out[j].Period {
+				return out[i].Period < out[j].Period
+			}
+			return out[i].QType < out[j].QType
+		})
+	}
+	return out, nil
+}
+
+// MonthRange returns the UTC calendar month s ("2006-01") as [from, to), or
+// the month before now when s is empty.
+func MonthRange(s string, now time.Time) (from, to time.Time, err error) {
+	if s == "" {
+		now = now.UTC()
+		to = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return to.AddDate(0, -1, 0), to, nil
+	}
+	from, err = time.Parse("2006-01", s)
+	if err != nil {
+		return from, to, fmt.Errorf("invalid month %q: expected YYYY-MM", s)
+	}
+	return from, from.AddDate(0, 1, 0), nil
+}
+
+// WriteCSV writes rows as "period,zone,qtype,queries" lines after a header.
+func WriteCSV(w io.Writer, zone string, rows []ReportRow) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"period", "zone", "qtype", "queries"})
+	for _, r := range rows {
+		_ = cw.Write([]string{r.Period, zone, r.QType, strconv.FormatInt(r.Queries, 10)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,168 @@
+// Package stats counts DNS queries in memory and periodically adds the
+// counters to the query_stats and client_stats tables, so the hot path never
+// touches the database.
+package stats
+
+import (
+	"context"
+	"log"
+	"net/netip"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	dbm "namedot/internal/db"
+)
+
+type key struct {
+	zone  string
+	qtype string
+}
+
+// maxClientSubnets bounds the client subnets kept between two flushes;
+// queries from further subnets are counted under OtherSubnets.
+const maxClientSubnets = 10000
+
+// OtherSubnets collects the queries of subnets beyond maxClientSubnets.
+const OtherSubnets = "other"
+
+// Collector accumulates per-zone/per-type and per-client-subnet query
+// counters between flushes.
+type Collector struct {
+	mu      sync.Mutex
+	counts  map[key]int64
+	clients map[string]int64
+	now     func() time.Time
+}
+
+func NewCollector() *Collector {
+	return &Collector{counts: make(map[key]int64), clients: make(map[string]int64), now: time.Now}
+}
+
+// Inc counts one query. Safe for concurrent use.
+func (c *Collector) Inc(zone, qtype string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.counts[key{zone, qtype}]++
+	c.mu.Unlock()
+}
+
+// IncClient counts one query from addr under its /24 (IPv4) or /48 (IPv6)
+// subnet. Safe for concurrent use.
+func (c *Collector) IncClient(addr netip.Addr) {
+	if c == nil || !addr.IsValid() {
+		return
+	}
+	sub := Subnet(addr)
+	c.mu.Lock()
+	if _, ok := c.clients[sub]; !ok && len(c.clients) >= maxClientSubnets {
+		sub = OtherSubnets
+	}
+	c.clients[sub]++
+	c.mu.Unlock()
+}
+
+// Subnet returns the /24 (IPv4) or /48 (IPv6) prefix addr is counted under.
+func Subnet(addr netip.Addr) string {
+	addr = addr.Unmap()
+	bits := 48
+	if addr.Is4() {
+		bits = 24
+	}
+	p, _ := addr.Prefix(bits)
+	return p.String()
+}
+
+func (c *Collector) take() (map[key]int64, map[string]int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts, clients := c.counts, c.clients
+	c.counts = make(map[key]int64, len(counts))
+	c.clients = make(map[string]int64, len(clients))
+	return counts, clients
+}
+
+func (c *Collector) restore(counts map[key]int64, clients map[string]int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, n := range counts {
+		c.counts[k] += n
+	}
+	for k, n := range clients {
+		c.clients[k] += n
+	}
+}
+
+// Flush writes the accumulated counters into the current hour's rows.
+// On failure the counters are kept for the next flush.
+func (c *Collector) Flush(db *gorm.DB) error {
+	counts, clients := c.take()
+	if len(counts) == 0 && len(clients) == 0 {
+		return nil
+	}
+	rows := make([]dbm.QueryCount, 0, len(counts))
+	for k, n := range counts {
+		rows = append(rows, dbm.QueryCount{Zone: k.zone, QType: k.qtype, Queries: n})
+	}
+	crows := make([]dbm.ClientCount, 0, len(clients))
+	for sub, n := range clients {
+		crows = append(crows, dbm.ClientCount{Subnet: sub, Queries: n})
+	}
+	now := c.now()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := dbm.AddQueryCounts(tx, now, rows); err != nil {
+			return err
+		}
+		return dbm.AddClientCounts(tx, now, crows)
+	})
+	if err != nil {
+		c.restore(counts, clients)
+		return err
+	}
+	return nil
+}
+
+// Run flushes every interval and purges hourly rows older than retention and
+// daily ones older than dailyRetention (0 = keep forever) until ctx is done,
+// then flushes one last time.
+func (c *Collector) Run(ctx context.Context, db *gorm.DB, interval, retention, dailyRetention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastPurge := time.Time{}
+	for {
+		select {
+		case <-ctx.Done():
+			if err := c.Flush(db); err != nil {
+				log.Printf("stats: final flush: %v", err)
+			}
+			return
+		case <-ticker.C:
+			if err := c.Flush(db); err != nil {
+				log.Printf("stats: flush: %v", err)
+			}
+			if time.Since(lastPurge) > time.Hour {
+				lastPurge = time.Now()
+				purge(db, lastPurge, retention, dailyRetention)
+			}
+		}
+	}
+}
+
+func purge(db *gorm.DB, now time.Time, retention, dailyRetention time.Duration) {
+	if retention > 0 {
+		if _, err := dbm.PurgeQueryStats(db, now.Add(-retention)); err != nil {
+			log.Printf("stats: purge: %v", err)
+		}
+		if _, err := dbm.PurgeClientStats(db, now.Add(-retention)); err != nil {
+			log.Printf("stats: purge clients: %v", err)
+		}
+	}
+	if dailyRetention > 0 {
+		if _, err := dbm.PurgeDailyQueryStats(db, now.Add(-dailyRetention)); err != nil {
+			log.Printf("stats: purge daily: %v", err)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package stats
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	dbm "namedot/internal/db"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := dbm.AutoMigrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+func TestCollector_FlushAccumulates(t *testing.T) {
+	db := newTestDB(t)
+	hour := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	c := NewCollector()
+	c.now = func() time.Time { return hour.Add(15 * time.Minute) }
+
+	c.Inc("example.com.", "A")
+	c.Inc("example.com.", "A")
+	c.Inc("example.com.", "MX")
+	if err := c.Flush(db); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	// Same hour: counters are added to the existing rows
+	c.Inc("example.com.", "A")
+	c.Inc("example.org.", "AAAA")
+	if err := c.Flush(db); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	// Nothing pending: no-op
+	if err := c.Flush(db); err != nil {
+		t.Fatalf("empty flush: %v", err)
+	}
+
+	var rows int64
+	db.Model(&dbm.QueryStat{}).Count(&rows)
+	if rows != 3 {
+		t.Fatalf("expected 3 hourly rows, got %d", rows)
+	}
+
+	items, err := dbm.QueryStats(db, dbm.QueryStatsFilter{From: hour, To: hour.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("query stats: %v", err)
+	}
+	if len(items) != 3 || items[0].Zone != "example.com." || items[0].QType != "A" || items[0].Queries != 3 {
+		t.Fatalf("unexpected stats (busiest first): %+v", items)
+	}
+
+	items, _ = dbm.QueryStats(db, dbm.QueryStatsFilter{Zone: "example.org.", From: hour, To: hour.Add(time.Hour)})
+	if len(items) != 1 || items[0].Queries != 1 {
+		t.Fatalf("unexpected zone filter result: %+v", items)
+	}
+}
+
+func TestCollector_KeepsCountsWhenFlushFails(t *testing.T) {
+	db := newTestDB(t)
+	c := NewCollector()
+	c.Inc("example.com.", "A")
+
+	sqlDB, _ := db.DB()
+	sqlDB.Close()
+	if err := c.Flush(db); err == nil {
+		t.Fatal("expected flush to fail on closed database")
+	}
+	if counts, _ := c.take(); counts[key{"example.com.", "A"}] != 1 {
+		t.Fatalf("expected counter to be kept for the next flush, got %v", counts)
+	}
+}
+
+func TestPurgeQueryStats(t *testing.T) {
+	db := newTestDB(t)
+	old := time.Now().Add(-100 * 24 * time.Hour)
+	if err := dbm.AddQueryCounts(db, old, []dbm.QueryCount{{Zone: "example.com.", QType: "A", Queries: 5}}); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if err := dbm.AddQueryCounts(db, time.Now(), []dbm.QueryCount{{Zone: "example.com.", QType: "A", Queries: 1}}); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	n, err := dbm.PurgeQueryStats(db, time.Now().Add(-90*24*time.Hour))
+	if err != nil || n != 1 {
+		t.Fatalf("expected 1 purged row, got %d (%v)", n, err)
+	}
+}
+
+func TestCollector_ClientSubnets(t *testing.T) {
+	db := newTestDB(t)
+	hour := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	c := NewCollector()
+	c.now = func() time.Time { return hour }
+
+	c.IncClient(netip.MustParseAddr("192.0.2.10"))
+	c.IncClient(netip.MustParseAddr("::ffff:192.0.2.200"))
+	c.IncClient(netip.MustParseAddr("2001:db8:1:2::53"))
+	if err := c.Flush(db); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	items, err := dbm.ClientStats(db, hour, hour.Add(time.Hour), 0)
+	if err != nil {
+		t.Fatalf("client stats: %v", err)
+	}
+	if len(items) != 2 || items[0].Subnet != "192.0.2.0/24" || items[0].Queries != 2 || items[1].Subnet != "2001:db8:1::/48" {
+		t.Fatalf("unexpected subnets: %+v", items)
+	}
+
+	for i := 0; i < maxClientSubnets+5; i++ {
+		c.IncClient(netip.AddrFrom4([4]byte{byte(i >> 16), byte(i >> 8), byte(i), 1}))
+	}
+	_, clients := c.take()
+	if len(clients) != maxClientSubnets+1 || clients[OtherSubnets] == 0 {
+		t.Fatalf("expected %d subnets plus %q, got %d", maxClientSubnets, OtherSubnets, len(clients))
+	}
+}
+
+func TestZoneReport(t *testing.T) {
+	db := newTestDB(t)
+	sep := time.Date(2026, 9, 30, 22, 0, 0, 0, time.UTC)
+	for _, h := range []time.Time{sep, sep.Add(time.Hour), sep.Add(3 * time.Hour)} {
+		if err := dbm.AddQueryCounts(db, h, []dbm.QueryCount{
+			{Zone: "example.com.", QType: "A", Queries: 2},
+			{Zone: "example.com.", QType: "AAAA", Queries: 1},
+			{Zone: "example.org.", QType: "A", Queries: 9},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	from, to, err := MonthRange("", time.Date(2026, 10, 16, 12, 0, 0, 0, time.Local))
+	if err != nil || !from.Equal(time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)) || !to.Equal(time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("previous month: %v %v %v", from, to, err)
+	}
+	if _, _, err := MonthRange("2026-13", time.Now()); err == nil {
+		t.Fatal("expected an error for month 13")
+	}
+
+	rows, err := ZoneReport(db, "example.com.", from, to, GroupDay)
+	if err != nil || len(rows) != 2 || rows[0] != (ReportRow{"2026-09-30", "A", 4}) || rows[1] != (ReportRow{"2026-09-30", "AAAA", 2}) {
+		t.Fatalf("september by day: %+v %v", rows, err)
+	}
+	rows, _ = ZoneReport(db, "example.com.", from, to.AddDate(0, 1, 0), GroupMonth)
+	want := []ReportRow{{"2026-09", "A", 4}, {"2026-09", "AAAA", 2}, {"2026-10", "A", 2}, {"2026-10", "AAAA", 1}}
+	if fmt.Sprint(rows) != fmt.Sprint(want) {
+		t.Fatalf("by month: %+v", rows)
+	}
+	rows, _ = ZoneReport(db, "example.com.", sep, sep.Add(2*time.Hour), GroupHour)
+	if len(rows) != 4 || rows[0].Period != "2026-09-30T22Z" {
+		t.Fatalf("by hour: %+v", rows)
+	}
+
+	var buf strings.Builder
+	if err := WriteCSV(&buf, "example.com.", rows[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "period,zone,qtype,queries\n2026-09-30T22Z,example.com.,A,2\n" {
+		t.Fatalf("csv: %q", buf.String())
+	}
+}
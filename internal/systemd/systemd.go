@@ -0,0 +1,107 @@
+// Package systemd implements the parts of the systemd service protocol
+// namedot uses without linking libsystemd: socket activation (sd_listen_fds)
+// and readiness and watchdog notifications (sd_notify).
+package systemd
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd.
+const listenFDsStart = 3
+
+// Socket is one socket passed by systemd. Name is its FileDescriptorName=.
+type Socket struct {
+	Name string
+	File *os.File
+}
+
+// Listeners returns the sockets passed to this process by socket activation,
+// or nil when it was started without. The environment variables are cleared
+// so child processes do not inherit them.
+func Listeners() []Socket {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	out := make([]Socket, 0, n)
+	for i := 0; i < n; i++ {
+		fd := listenFDsStart + i
+		syscall.CloseOnExec(fd)
+		name := "unknown"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		out = append(out, Socket{Name: name, File: os.NewFile(uintptr(fd), name)})
+	}
+	return out
+}
+
+// Notify sends state (e.g. "READY=1") to the service manager. It does
+// nothing when NOTIFY_SOCKET is unset, i.e. outside a Type=notify service.
+func Notify(state string) error {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return nil
+	}
+	if addr[0] == '@' {
+		addr = "\x00" + addr[1:] // abstract namespace
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// WatchdogInterval returns WatchdogSec= of the service, or 0 when the
+// watchdog is off or meant for another process.
+func WatchdogInterval() time.Duration {
+	if p := os.Getenv("WATCHDOG_PID"); p != "" {
+		if pid, err := strconv.Atoi(p); err != nil || pid != os.Getpid() {
+			return 0
+		}
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// RunWatchdog sends WATCHDOG=1 at half the watchdog interval until ctx is
+// done. A ping is skipped while healthy returns an error, so systemd restarts
+// a service that stays unhealthy for a whole interval.
+func RunWatchdog(ctx context.Context, interval time.Duration, healthy func() error) {
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if healthy != nil && healthy() != nil {
+				continue
+			}
+			_ = Notify("WATCHDOG=1")
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// Package watchdog checks the goroutine count and heap size of the process
+// and logs, and optionally restarts the DNS listeners, when one passes its
+// limit: an early warning for leaks under sustained load.
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime"
+	"strings"
+	"time"
+
+	"namedot/internal/config"
+	"namedot/internal/metrics"
+)
+
+var (
+	exceededTotal = metrics.NewCounter("namedot_watchdog_exceeded_total",
+		"Watchdog checks that found a limit passed, by resource.", "resource")
+	restartsTotal = metrics.NewCounter("namedot_watchdog_listener_restarts_total",
+		"DNS listener restarts by the watchdog, by result.", "result")
+)
+
+func init() {
+	metrics.NewGaugeFunc("namedot_goroutines", "Goroutines of the process.",
+		func() float64 { return float64(runtime.NumGoroutine()) })
+	metrics.NewGaugeFunc("namedot_heap_bytes", "Heap in use: bytes of allocated objects.",
+		func() float64 { return float64(heapBytes()) })
+	metrics.AddAlert(metrics.Alert{
+		Name:     "NamedotWatchdogLimitExceeded",
+		Expr:     fmt.Sprintf("increase(%s[15m]) > 0", exceededTotal.Name()),
+		Severity: "warning",
+		Summary:  "{{ $labels.instance }} passed its watchdog {{ $labels.resource }} limit",
+		Metrics:  []string{exceededTotal.Name()},
+	})
+}
+
+// Resources the limits apply to.
+const (
+	ResourceGoroutines = "goroutines"
+	ResourceHeap       = "heap"
+)
+
+// heapBytes returns the bytes of allocated heap objects. ReadMemStats stops
+// the world briefly, which is fine at the check and scrape intervals.
+func heapBytes() uint64 {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return ms.HeapAlloc
+}
+
+// Watchdog compares the process against the configured limits.
+type Watchdog struct {
+	cfg     config.WatchdogConfig
+	restart func() error // restarts the listeners; nil to only log
+	now     func() time.Time
+
+	goroutines func() int
+	heap       func() uint64
+
+	last time.Time // last action, for the cooldown
+}
+
+// New returns a watchdog for cfg. restart is called when a limit is passed
+// and restart_listeners is set.
+func New(cfg config.WatchdogConfig, restart func() error) *Watchdog {
+	return &Watchdog{
+		cfg:        cfg,
+		restart:    restart,
+		now:        time.Now,
+		goroutines: runtime.NumGoroutine,
+		heap:       heapBytes,
+	}
+}
+
+// Run checks every interval_sec until ctx is done.
+func (w *Watchdog) Run(ctx context.Context) {
+	t := time.NewTicker(time.Duration(w.cfg.IntervalSec) * time.Second)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			w.Check()
+		}
+	}
+}
+
+// Check compares the goroutine count and heap with the limits and acts on
+// those passed, at most once per cooldown_sec. It returns the resources
+// over their limit.
+func (w *Watchdog) Check() []string {
+	var over []string
+	var details []string
+	if limit := w.cfg.MaxGoroutines; limit > 0 {
+		if n := w.goroutines(); n > limit {
+			over = append(over, ResourceGoroutines)
+			details = append(details, fmt.Sprintf("%d goroutines, limit %d", n, limit))
+		}
+	}
+	if limit := w.cfg.MaxHeapMB; limit > 0 {
+		if n := w.heap(); n > uint64(limit)<<20 {
+			over = append(over, ResourceHeap)
+			details = append(details, fmt.Sprintf("heap %d MB, limit %d MB", n>>20, limit))
+		}
+	}
+	for _, r := range over {
+		exceededTotal.Inc(r)
+	}
+	if len(over) == 0 {
+		return nil
+	}
+	now := w.now()
+	if !w.last.IsZero() && now.Sub(w.last) < time.Duration(w.cfg.CooldownSec)*time.Second {
+		return over
+	}
+	w.last = now
+	log.Printf("watchdog: %s", strings.Join(details, "; "))
+	if !w.cfg.RestartListeners || w.restart == nil {
+		return over
+	}
+	if err := w.restart(); err != nil {
+		restartsTotal.Inc("error")
+		log.Printf("watchdog: restart listeners: %v", err)
+		return over
+	}
+	restartsTotal.Inc("ok")
+	log.Printf("watchdog: restarted the DNS listeners")
+	return over
+}
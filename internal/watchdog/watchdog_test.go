@@ -0,0 +1,53 @@
+package watchdog
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"namedot/internal/config"
+)
+
+func TestCheck(t *testing.T) {
+	restarts := 0
+	var restartErr error
+	w := New(config.WatchdogConfig{MaxGoroutines: 100, MaxHeapMB: 64, RestartListeners: true, CooldownSec: 300},
+		func() error { restarts++; return restartErr })
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	w.now = func() time.Time { return now }
+	goroutines, heap := 50, uint64(10<<20)
+	w.goroutines = func() int { return goroutines }
+	w.heap = func() uint64 { return heap }
+
+	if over := w.Check(); over != nil || restarts != 0 {
+		t.Fatalf("under the limits: %v, %d restarts", over, restarts)
+	}
+	before := exceededTotal.Value(ResourceGoroutines)
+	goroutines = 101
+	if over := w.Check(); len(over) != 1 || over[0] != ResourceGoroutines || restarts != 1 {
+		t.Fatalf("goroutines over: %v, %d restarts", over, restarts)
+	}
+	// Within the cooldown the excess is counted but not acted on
+	heap = 65 << 20
+	now = now.Add(time.Minute)
+	if over := w.Check(); len(over) != 2 || restarts != 1 {
+		t.Fatalf("within cooldown: %v, %d restarts", over, restarts)
+	}
+	if got := exceededTotal.Value(ResourceGoroutines); got != before+2 {
+		t.Fatalf("exceeded counter %v, want %v", got, before+2)
+	}
+	failed := restartsTotal.Value("error")
+	restartErr = errors.New("boom")
+	now = now.Add(5 * time.Minute)
+	w.Check()
+	if restarts != 2 || restartsTotal.Value("error") != failed+1 {
+		t.Fatalf("failed restart: %d restarts, %v errors", restarts, restartsTotal.Value("error"))
+	}
+
+	// Without restart_listeners the watchdog only logs
+	w.cfg.RestartListeners = false
+	now = now.Add(time.Hour)
+	if over := w.Check(); len(over) != 2 || restarts != 2 {
+		t.Fatalf("log only: %v, %d restarts", over, restarts)
+	}
+}
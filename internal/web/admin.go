@@ -14,20 +14,32 @@ import (
 	"gorm.io/gorm"
 
 	"namedot/internal/config"
+	"namedot/internal/db"
 )
 
-//go:embed templates/*.html
+//go:embed templates/*.html templates/fragments/*.html
 var templatesFS embed.FS
 
 type Server struct {
-	cfg      *config.Config
-	db       *gorm.DB
-	tmpl     *template.Template
-	sessions map[string]*Session // sessionID -> Session
+	cfg          *config.Config
+	db           *gorm.DB
+	tmpl         *template.Template
+	sessions     map[string]*Session // sessionID -> Session
+	tokens       apiTokens           // REST API tokens minted at /admin/token
+	dnsTester    DNSTester
+	queryRater   QueryRater
+	replicator   Replicator
+	slaveLister  SlaveLister
+	healthLister HealthLister
+	cache        CacheInvalidator
+	creds        *db.CredentialCache // rotated admin passwords
+
+	readOnlyChecker ReadOnlyChecker
 }
 
 type Session struct {
 	Username  string
+	Role      string // config.RoleAdmin or config.RoleViewer
 	CreatedAt time.Time
 	ExpiresAt time.Time
 	CSRFToken string
@@ -38,11 +50,7 @@ func NewServer(cfg *config.Config, db *gorm.DB) (*Server, error) {
         return nil, nil
     }
 
-    funcMap := template.FuncMap{
-        // Usage in templates: {{ t .Lang "Key" }}
-        "t": func(lang, key string) string { return tr(lang, key) },
-    }
-    tmpl, err := template.New("root").Funcs(funcMap).ParseFS(templatesFS, "templates/*.html")
+    tmpl, err := template.New("root").Funcs(templateFuncs).ParseFS(templatesFS, "templates/*.html", "templates/fragments/*.html")
     if err != nil {
         return nil, err
     }
@@ -52,6 +60,7 @@ func NewServer(cfg *config.Config, db *gorm.DB) (*Server, error) {
 		db:       db,
 		tmpl:     tmpl,
 		sessions: make(map[string]*Session),
+		creds:    newCredentialCache(db),
 	}, nil
 }
 
@@ -65,9 +74,13 @@ func (s *Server) RegisterRoutes(r *gin.Engine) {
     r.POST("/admin/login", s.loginSubmit)
     r.GET("/admin/lang/:code", s.setLang)
 
+	// Viewers mint read-only tokens, so this stays outside the viewer and
+	// maintenance checks of the group
+	r.POST("/admin/token", s.authMiddleware(), s.csrfMiddleware(), s.mintAPIToken)
+
 	// Protected routes
 	admin := r.Group("/admin")
-	admin.Use(s.authMiddleware())
+	admin.Use(s.authMiddleware(), s.viewerMiddleware(), s.maintenanceMiddleware(), s.zoneLockMiddleware())
 	{
 		admin.GET("/", s.dashboard)
 		admin.GET("/logout", s.logout)
@@ -77,14 +90,57 @@ func (s *Server) RegisterRoutes(r *gin.Engine) {
 		admin.GET("/zones/new", s.newZoneForm)
 		admin.POST("/zones", s.csrfMiddleware(), s.createZone)
 		admin.DELETE("/zones/delete/:id", s.csrfMiddleware(), s.deleteZone)
+		admin.POST("/zones/:id/toggle", s.csrfMiddleware(), s.toggleZone)
+
+		// Trash
+		admin.GET("/trash", s.listTrash)
+		admin.POST("/trash/:id/restore", s.csrfMiddleware(), s.restoreTrash)
+		admin.DELETE("/trash/:id", s.csrfMiddleware(), s.purgeTrash)
+
+		// Query statistics
+		admin.GET("/overview", s.overview)
+		admin.GET("/stats", s.listStats)
+		admin.GET("/lookup", s.lookup)
+		admin.GET("/replication", s.replicationStatus)
+		admin.POST("/replication/sync", s.csrfMiddleware(), s.syncNow)
+		admin.GET("/health-checks", s.healthChecks)
+		admin.GET("/audit", s.listAudit)
+		admin.GET("/settings", s.settingsForm)
+		admin.PUT("/settings", s.csrfMiddleware(), s.updateSettings)
 
 		// Records
 		admin.GET("/zones/:id/records", s.listRecords)
 		admin.GET("/zones/:id/records/new", s.newRecordForm)
 		admin.POST("/zones/:id/records", s.csrfMiddleware(), s.createRecord)
+		admin.GET("/zones/:id/records/bulk", s.bulkRecordForm)
+		admin.POST("/zones/:id/records/bulk", s.csrfMiddleware(), s.createBulkRecords)
 		admin.GET("/records/:id/edit", s.editRecordForm)
 		admin.PUT("/records/:id", s.csrfMiddleware(), s.updateRecord)
+		admin.GET("/records/:id/row", s.inlineRecordRow)
+		admin.GET("/records/:id/inline", s.inlineRecordForm)
+		admin.PUT("/records/:id/inline", s.csrfMiddleware(), s.updateRecordInline)
 		admin.DELETE("/records/:id", s.csrfMiddleware(), s.deleteRecord)
+		admin.POST("/records/:id/toggle", s.csrfMiddleware(), s.toggleRecord)
+		admin.PUT("/rrsets/:id/ttl", s.csrfMiddleware(), s.updateRRSetTTL)
+		admin.DELETE("/rrsets/:id", s.csrfMiddleware(), s.deleteRRSet)
+		admin.GET("/zones/:id/export", s.exportZone)
+		admin.GET("/zones/:id/stats.csv", s.exportZoneStats)
+		admin.GET("/zones/:id/import", s.importZoneForm)
+		admin.POST("/zones/:id/import", s.csrfMiddleware(), s.importZone)
+		admin.GET("/zones/:id/soa", s.soaForm)
+		admin.PUT("/zones/:id/soa", s.csrfMiddleware(), s.updateSOA)
+		admin.POST("/zones/:id/soa/reset", s.csrfMiddleware(), s.resetSOA)
+		admin.GET("/zones/:id/clone", s.cloneZoneForm)
+		admin.POST("/zones/:id/clone", s.csrfMiddleware(), s.cloneZone)
+		admin.GET("/zones/:id/template", s.zoneTemplateForm)
+		admin.POST("/zones/:id/template", s.csrfMiddleware(), s.saveZoneTemplate)
+		admin.GET("/zones/:id/json", s.zoneJSONForm)
+		admin.POST("/zones/:id/json/preview", s.csrfMiddleware(), s.previewZoneJSON)
+		admin.POST("/zones/:id/json", s.csrfMiddleware(), s.applyZoneJSON)
+		admin.GET("/zones/:id/dnssec", s.dnssecStatus)
+		admin.GET("/zones/:id/mailauth", s.mailAuthForm)
+		admin.POST("/zones/:id/mailauth/preview", s.csrfMiddleware(), s.previewMailAuth)
+		admin.POST("/zones/:id/mailauth", s.csrfMiddleware(), s.applyMailAuth)
 
 		// Templates
 		admin.GET("/templates", s.listTemplates)
@@ -99,6 +155,7 @@ func (s *Server) RegisterRoutes(r *gin.Engine) {
 		admin.DELETE("/templates/records/:id", s.csrfMiddleware(), s.deleteTemplateRecord)
 		admin.GET("/templates/:id/apply", s.applyTemplateForm)
 		admin.POST("/templates/:id/apply", s.csrfMiddleware(), s.applyTemplate)
+		admin.POST("/templates/:id/reapply", s.csrfMiddleware(), s.reapplyTemplate)
 	}
 }
 
@@ -120,16 +177,36 @@ func (s *Server) authMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		c.Set("session_id", cookie)
 		c.Set("username", session.Username)
+		c.Set("role", session.Role)
 		c.Set("csrf_token", session.CSRFToken)
 		c.Next()
 	}
 }
 
+// viewerMiddleware rejects everything but GET for read-only users. The
+// templates hide the edit controls for them (.ReadOnly), this makes sure the
+// routes behind those controls stay closed as well.
+func (s *Server) viewerMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.readOnly(c) && c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			s.renderError(c, http.StatusForbidden, s.tr(c, "Read-only access: changes are not allowed"))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// readOnly reports whether the signed-in user has the viewer role.
+func (s *Server) readOnly(c *gin.Context) bool {
+	return c.GetString("role") == config.RoleViewer
+}
+
 // Login handlers
 func (s *Server) loginPage(c *gin.Context) {
-    c.Header("Content-Type", "text/html; charset=utf-8")
-    s.tmpl.ExecuteTemplate(c.Writer, "login.html", gin.H{ "Lang": s.getLang(c) })
+    s.render(c, http.StatusOK, "login.html", nil)
 }
 
 func (s *Server) loginSubmit(c *gin.Context) {
@@ -137,17 +214,18 @@ func (s *Server) loginSubmit(c *gin.Context) {
 	password := c.PostForm("password")
 
 	// Validate credentials
-    if username != s.cfg.Admin.Username {
+    user, ok := s.cfg.Admin.User(username)
+    if !ok {
         c.Header("HX-Retarget", "#error")
         c.Header("HX-Reswap", "innerHTML")
-        c.String(http.StatusUnauthorized, `<div class="error">`+s.tr(c, "Invalid username or password")+`</div>`)
+        s.renderError(c, http.StatusUnauthorized, s.tr(c, "Invalid username or password"))
         return
     }
 
-    if err := bcrypt.CompareHashAndPassword([]byte(s.cfg.Admin.PasswordHash), []byte(password)); err != nil {
+    if !s.checkPassword(user, password) {
         c.Header("HX-Retarget", "#error")
         c.Header("HX-Reswap", "innerHTML")
-        c.String(http.StatusUnauthorized, `<div class="error">`+s.tr(c, "Invalid username or password")+`</div>`)
+        s.renderError(c, http.StatusUnauthorized, s.tr(c, "Invalid username or password"))
         return
     }
 
@@ -156,6 +234,7 @@ func (s *Server) loginSubmit(c *gin.Context) {
 	csrfToken := s.generateSessionID()
 	s.sessions[sessionID] = &Session{
 		Username:  username,
+		Role:      user.Role,
 		CreatedAt: time.Now(),
 		ExpiresAt: time.Now().Add(24 * time.Hour),
 		CSRFToken: csrfToken,
@@ -169,6 +248,7 @@ func (s *Server) loginSubmit(c *gin.Context) {
 func (s *Server) logout(c *gin.Context) {
 	cookie, _ := c.Cookie("session")
 	delete(s.sessions, cookie)
+	s.revokeAPITokens(cookie)
 	s.setSecureCookie(c, "session", "", -1, "/admin")
 	c.Redirect(http.StatusFound, "/admin/login")
 }
@@ -176,10 +256,8 @@ func (s *Server) logout(c *gin.Context) {
 func (s *Server) dashboard(c *gin.Context) {
     username, _ := c.Get("username")
     csrfToken, _ := c.Get("csrf_token")
-    c.Header("Content-Type", "text/html; charset=utf-8")
-    s.tmpl.ExecuteTemplate(c.Writer, "dashboard.html", gin.H{
+    s.render(c, http.StatusOK, "dashboard.html", gin.H{
         "Username": username,
-        "Lang": s.getLang(c),
         "CSRFToken": csrfToken,
     })
 }
@@ -194,22 +272,15 @@ func (s *Server) generateSessionID() string {
 
 // i18n helpers
 func (s *Server) getLang(c *gin.Context) string {
-    if v, err := c.Cookie("lang"); err == nil {
-        if v == "ru" || v == "en" { return v }
-    }
-    // simple accept-language sniff
-    if al := c.GetHeader("Accept-Language"); al != "" {
-        if len(al) >= 2 {
-            p := al[:2]
-            if p == "ru" { return "ru" }
-        }
+    if v, err := c.Cookie("lang"); err == nil && hasLang(v) {
+        return v
     }
-    return "en"
+    return matchAcceptLanguage(c.GetHeader("Accept-Language"))
 }
 
 func (s *Server) setLang(c *gin.Context) {
     code := c.Param("code")
-    if code != "en" && code != "ru" { code = "en" }
+    if !hasLang(code) { code = defaultLang }
     // 365 days
     s.setSecureCookie(c, "lang", code, 365*24*3600, "/")
     ref := c.Request.Referer()
@@ -0,0 +1,119 @@
+package web
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/config"
+)
+
+// Lifetime of API tokens minted at /admin/token: the default and the
+// longest a caller may ask for. A token never outlives its session.
+const (
+	defaultAPITokenTTL = 15 * time.Minute
+	maxAPITokenTTL     = time.Hour
+)
+
+// APIToken is a short-lived REST API token minted by a signed-in user. It
+// carries the user's name and role: the REST API records changes made with
+// it under the user's name and a viewer's token may only read.
+type APIToken struct {
+	Username  string
+	Role      string
+	ExpiresAt time.Time
+	session   string
+}
+
+// apiTokens holds the minted tokens by the sha256 of the token.
+type apiTokens struct {
+	mu     sync.Mutex
+	tokens map[[32]byte]APIToken
+}
+
+type apiTokenResp struct {
+	Token     string    `json:"token"`
+	Role      string    `json:"role"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// mintAPIToken answers POST /admin/token with a new token for the session
+// user. The optional ttl form value is in seconds.
+func (s *Server) mintAPIToken(c *gin.Context) {
+	session := s.sessions[c.GetString("session_id")]
+	if session == nil {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	ttl := defaultAPITokenTTL
+	if v := c.PostForm("ttl"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ttl must be a positive number of seconds"})
+			return
+		}
+		ttl = min(time.Duration(n)*time.Second, maxAPITokenTTL)
+	}
+	expires := time.Now().Add(ttl)
+	if expires.After(session.ExpiresAt) {
+		expires = session.ExpiresAt
+	}
+
+	token := s.generateSessionID()
+	t := APIToken{Username: session.Username, Role: session.Role, ExpiresAt: expires, session: c.GetString("session_id")}
+	s.tokens.mu.Lock()
+	if s.tokens.tokens == nil {
+		s.tokens.tokens = make(map[[32]byte]APIToken)
+	}
+	now := time.Now()
+	for k, old := range s.tokens.tokens {
+		if now.After(old.ExpiresAt) {
+			delete(s.tokens.tokens, k)
+		}
+	}
+	s.tokens.tokens[sha256.Sum256([]byte(token))] = t
+	s.tokens.mu.Unlock()
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, apiTokenResp{Token: token, Role: t.Role, ExpiresAt: t.ExpiresAt.UTC()})
+}
+
+// LookupAPIToken returns the minted token, while it is valid and its
+// session is still signed in.
+func (s *Server) LookupAPIToken(token string) (APIToken, bool) {
+	if s == nil || token == "" {
+		return APIToken{}, false
+	}
+	sum := sha256.Sum256([]byte(token))
+	s.tokens.mu.Lock()
+	defer s.tokens.mu.Unlock()
+	t, ok := s.tokens.tokens[sum]
+	if !ok {
+		return APIToken{}, false
+	}
+	if time.Now().After(t.ExpiresAt) {
+		delete(s.tokens.tokens, sum)
+		return APIToken{}, false
+	}
+	return t, true
+}
+
+// ReadOnly reports whether the token may only read.
+func (t APIToken) ReadOnly() bool {
+	return t.Role == config.RoleViewer
+}
+
+// revokeAPITokens drops the tokens minted in a session, on logout.
+func (s *Server) revokeAPITokens(session string) {
+	s.tokens.mu.Lock()
+	defer s.tokens.mu.Unlock()
+	for k, t := range s.tokens.tokens {
+		if t.session == session {
+			delete(s.tokens.tokens, k)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package web
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strings"
+    "testing"
+    "time"
+
+    "namedot/internal/config"
+)
+
+func TestMintAPIToken(t *testing.T) {
+    s, r := newTestWeb(t)
+    sid := "token-session"
+    expires := time.Now().Add(30 * time.Minute)
+    s.sessions[sid] = &Session{Username: "noc", Role: config.RoleViewer, CreatedAt: time.Now(), ExpiresAt: expires, CSRFToken: "csrf"}
+
+    mint := func(ttl string) (*httptest.ResponseRecorder, apiTokenResp) {
+        form := url.Values{}
+        if ttl != "" {
+            form.Set("ttl", ttl)
+        }
+        req := httptest.NewRequest("POST", "/admin/token", strings.NewReader(form.Encode()))
+        req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+        req.AddCookie(&http.Cookie{Name: "session", Value: sid, Path: "/admin"})
+        req.Header.Set("X-CSRF-Token", "csrf")
+        req.Header.Set("Origin", "http://example.com")
+        w := httptest.NewRecorder()
+        r.ServeHTTP(w, req)
+        var resp apiTokenResp
+        _ = json.Unmarshal(w.Body.Bytes(), &resp)
+        return w, resp
+    }
+
+    w, resp := mint("")
+    if w.Code != http.StatusCreated || resp.Role != config.RoleViewer {
+        t.Fatalf("mint: %d %s", w.Code, w.Body.String())
+    }
+    if d := time.Until(resp.ExpiresAt); d > defaultAPITokenTTL || d < defaultAPITokenTTL-time.Minute {
+        t.Fatalf("default lifetime: %v", d)
+    }
+    tok, ok := s.LookupAPIToken(resp.Token)
+    if !ok || tok.Username != "noc" || !tok.ReadOnly() {
+        t.Fatalf("lookup: %+v %v", tok, ok)
+    }
+    // A token never outlives its session
+    if _, resp := mint("86400"); !resp.ExpiresAt.Equal(expires.UTC()) {
+        t.Fatalf("lifetime past the session: %v", resp.ExpiresAt)
+    }
+    if w, _ := mint("soon"); w.Code != http.StatusBadRequest {
+        t.Fatalf("bad ttl: %d", w.Code)
+    }
+    if _, ok := s.LookupAPIToken("made-up"); ok {
+        t.Fatal("unknown token accepted")
+    }
+}
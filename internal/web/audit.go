@@ -0,0 +1,107 @@
+package web
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"namedot/internal/db"
+)
+
+// audit records a change by the signed-in user. Failures are logged only:
+// the change itself has already been made.
+func (s *Server) audit(c *gin.Context, action string, zone db.Zone, rrsetID uint, summary string) {
+	e := db.AuditEntry{
+		Actor:    c.GetString("username"),
+		Action:   action,
+		ZoneID:   zone.ID,
+		ZoneName: zone.Name,
+		RRSetID:  rrsetID,
+		Summary:  summary,
+	}
+	if err := db.RecordAudit(s.db, e); err != nil {
+		log.Printf("web: audit %s: %v", action, err)
+	}
+}
+
+// recordSummary describes a record for the audit log.
+func recordSummary(rrset db.RRSet, data string) string {
+	return fmt.Sprintf("%s %s %s", rrset.Name, rrset.Type, data)
+}
+
+// listAudit shows the audit log with filters by zone, user, action and date
+// range. rrset_id (from the history link of a record set) narrows it down
+// to one set.
+func (s *Server) listAudit(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	perPage := 50
+
+	zone := strings.ToLower(strings.TrimSpace(c.Query("zone")))
+	if zone != "" && !strings.HasSuffix(zone, ".") {
+		zone += "."
+	}
+	f := db.AuditFilter{
+		ZoneName: zone,
+		Actor:    strings.TrimSpace(c.Query("actor")),
+		Action:   c.Query("action"),
+	}
+	if id, err := strconv.ParseUint(c.Query("rrset_id"), 10, 32); err == nil {
+		f.RRSetID = uint(id)
+	}
+	from, to := c.Query("from"), c.Query("to")
+	if t, err := time.Parse("2006-01-02", from); err == nil {
+		f.From = t
+	}
+	if t, err := time.Parse("2006-01-02", to); err == nil {
+		// The end date is inclusive in the form
+		f.To = t.AddDate(0, 0, 1)
+	}
+
+	entries, total, err := db.AuditLog(s.db, f, (page-1)*perPage, perPage)
+	if err != nil {
+		s.renderError(c, http.StatusInternalServerError, s.trf(c, "Error loading audit log: %s", err.Error()))
+		return
+	}
+	actors, _ := db.AuditActors(s.db)
+
+	q := url.Values{}
+	for k, v := range map[string]string{"zone": zone, "actor": f.Actor, "action": f.Action, "from": from, "to": to} {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	if f.RRSetID != 0 {
+		q.Set("rrset_id", strconv.Itoa(int(f.RRSetID)))
+	}
+	pages := newPagination("/admin/audit?"+q.Encode(), page, perPage, total)
+	pages.Target = "#audit-list"
+
+	s.render(c, http.StatusOK, "audit_list", gin.H{
+		"Entries": entries,
+		"Zone":    zone,
+		"Actor":   f.Actor,
+		"Action":  f.Action,
+		"From":    from,
+		"To":      to,
+		"RRSetID": f.RRSetID,
+		"Actors":  actors,
+		"Actions": db.AuditActions,
+		"Pages":   pages,
+	})
+}
+
+// dbFor returns the database for the changes of a request, stamping the
+// RRSets and records it writes with the signed-in user as their source.
+func (s *Server) dbFor(c *gin.Context) *gorm.DB {
+	return db.WithSource(s.db, db.SourceWeb(c.GetString("username")))
+}
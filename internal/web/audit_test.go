@@ -0,0 +1,89 @@
+package web
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+
+    dbm "namedot/internal/db"
+)
+
+func TestAuditLogViewer(t *testing.T) {
+    s, r := newTestWeb(t)
+    sid := "audit-session"
+    s.sessions[sid] = &Session{Username: "admin", CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour), CSRFToken: "csrf"}
+
+    zone := dbm.Zone{Name: "web-audit.test."}
+    if err := s.db.Create(&zone).Error; err != nil {
+        t.Fatalf("create zone: %v", err)
+    }
+    defer func() {
+        dbm.TrashZone(s.db, zone.ID)
+        dbm.PurgeZone(s.db, zone.ID)
+        s.db.Where("zone_name = ?", zone.Name).Delete(&dbm.AuditEntry{})
+    }()
+    zoneID := strconv.Itoa(int(zone.ID))
+
+    do := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+        var req *http.Request
+        if form != nil {
+            req = httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+            req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+        } else {
+            req = httptest.NewRequest(method, path, nil)
+        }
+        req.AddCookie(&http.Cookie{Name: "session", Value: sid, Path: "/admin"})
+        req.AddCookie(&http.Cookie{Name: "lang", Value: "en", Path: "/"})
+        req.Header.Set("X-CSRF-Token", "csrf")
+        req.Header.Set("Origin", "http://example.com")
+        w := httptest.NewRecorder()
+        r.ServeHTTP(w, req)
+        return w
+    }
+
+    w := do("POST", "/admin/zones/"+zoneID+"/records", url.Values{"name": {"www"}, "type": {"A"}, "ttl": {"300"}, "data": {"192.0.2.10"}})
+    if w.Code != http.StatusOK {
+        t.Fatalf("create record: %d %s", w.Code, w.Body.String())
+    }
+    // An invalid record is not created and not recorded
+    do("POST", "/admin/zones/"+zoneID+"/records", url.Values{"name": {"www"}, "type": {"A"}, "data": {"not-an-ip"}})
+
+    var set dbm.RRSet
+    if err := s.db.Where("zone_id = ? AND type = ?", zone.ID, "A").First(&set).Error; err != nil {
+        t.Fatalf("rrset: %v", err)
+    }
+    setID := strconv.Itoa(int(set.ID))
+    w = do("PUT", "/admin/rrsets/"+setID+"/ttl", url.Values{"ttl": {"600"}})
+    if w.Code != http.StatusOK {
+        t.Fatalf("set ttl: %d %s", w.Code, w.Body.String())
+    }
+
+    // The records table links to the history of each set
+    if body := w.Body.String(); !strings.Contains(body, "/admin/audit?rrset_id="+setID) {
+        t.Fatalf("history link missing: %s", body)
+    }
+
+    w = do("GET", "/admin/audit?rrset_id="+setID, nil)
+    body := w.Body.String()
+    if w.Code != http.StatusOK || !strings.Contains(body, "record.create</code>") || !strings.Contains(body, "rrset.update</code>") ||
+        !strings.Contains(body, "www.web-audit.test. A 192.0.2.10") || !strings.Contains(body, "TTL 300 -&gt; 600") {
+        t.Fatalf("set history: %d %s", w.Code, body)
+    }
+    if strings.Count(body, "<td>admin</td>") != 2 {
+        t.Fatalf("expected 2 entries by admin: %s", body)
+    }
+
+    w = do("GET", "/admin/audit?zone=web-audit.test&action=rrset.update", nil)
+    if body := w.Body.String(); strings.Contains(body, "record.create</code>") || !strings.Contains(body, "rrset.update</code>") {
+        t.Fatalf("action filter: %s", body)
+    }
+
+    w = do("GET", "/admin/audit?zone=web-audit.test&from=2000-01-01&to=2000-01-31", nil)
+    if body := w.Body.String(); !strings.Contains(body, "No changes recorded") {
+        t.Fatalf("date filter: %s", body)
+    }
+}
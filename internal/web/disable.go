@@ -0,0 +1,74 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/db"
+)
+
+// CacheInvalidator drops cached DNS answers and zones; it is implemented
+// by the DNS server.
+type CacheInvalidator interface {
+	InvalidateZoneCache()
+}
+
+// SetCacheInvalidator makes zones and records enabled or disabled in the
+// admin take effect in DNS right away rather than when the cache expires.
+func (s *Server) SetCacheInvalidator(ci CacheInvalidator) {
+	if s != nil {
+		s.cache = ci
+	}
+}
+
+// invalidateCache drops the DNS caches after a change that must not wait
+// for them to expire.
+func (s *Server) invalidateCache() {
+	if s.cache != nil {
+		s.cache.InvalidateZoneCache()
+	}
+}
+
+// enabledLabel is the audit summary of enabling or disabling something.
+func enabledLabel(disabled bool) string {
+	if disabled {
+		return "disabled"
+	}
+	return "enabled"
+}
+
+// toggleZone disables a served zone or enables a disabled one and returns
+// its row of the zones table.
+func (s *Server) toggleZone(c *gin.Context) {
+	zone, ok := s.loadZone(c)
+	if !ok {
+		return
+	}
+	zone.Disabled = !zone.Disabled
+	if err := s.db.Model(&zone).Update("disabled", zone.Disabled).Error; err != nil {
+		s.renderError(c, http.StatusInternalServerError, s.trf(c, "Error updating zone: %s", err.Error()))
+		return
+	}
+	s.audit(c, db.AuditZoneUpdate, zone, 0, zone.Name+" "+enabledLabel(zone.Disabled))
+	s.invalidateCache()
+	s.render(c, http.StatusOK, "zone_row", gin.H{"Row": zoneRow{Zone: zone, Records: s.zoneRecordCount(zone.ID)}})
+}
+
+// toggleRecord disables a record or enables a disabled one and returns its
+// row of the records table.
+func (s *Server) toggleRecord(c *gin.Context) {
+	record, rrset, zone, ok := s.loadRecordRow(c)
+	if !ok {
+		return
+	}
+	record.Disabled = !record.Disabled
+	if err := s.dbFor(c).Model(&record).Update("disabled", record.Disabled).Error; err != nil {
+		c.String(http.StatusInternalServerError, s.trf(c, "Error updating record: %s", err.Error()))
+		return
+	}
+	s.audit(c, db.AuditRecordUpdate, zone, rrset.ID, recordSummary(rrset, record.Data)+" "+enabledLabel(record.Disabled))
+	db.TouchZone(s.db, zone, s.cfg)
+	s.invalidateCache()
+	s.renderRecordRow(c, rrset, record, c.Request.URL.RawQuery)
+}
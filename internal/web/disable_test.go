@@ -0,0 +1,74 @@
+package web
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+
+    dbm "namedot/internal/db"
+)
+
+type countingInvalidator struct{ n int }
+
+func (ci *countingInvalidator) InvalidateZoneCache() { ci.n++ }
+
+func TestToggle_ZoneAndRecord(t *testing.T) {
+    s, r := newTestWeb(t)
+    ci := &countingInvalidator{}
+    s.SetCacheInvalidator(ci)
+    sid := "toggle-session"
+    s.sessions[sid] = &Session{Username: "admin", CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour), CSRFToken: "csrf"}
+
+    zone := dbm.Zone{Name: "web-toggle.test.", RRSets: []dbm.RRSet{
+        {Name: "www.web-toggle.test.", Type: "A", TTL: 60, Records: []dbm.RData{{Data: "192.0.2.1"}}},
+    }}
+    if err := s.db.Create(&zone).Error; err != nil {
+        t.Fatalf("create zone: %v", err)
+    }
+    // Leave the shared in-memory DB clean for other tests
+    defer func() {
+        dbm.TrashZone(s.db, zone.ID)
+        dbm.PurgeZone(s.db, zone.ID)
+    }()
+    rec := zone.RRSets[0].Records[0]
+
+    do := func(path string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest("POST", path, nil)
+        req.AddCookie(&http.Cookie{Name: "session", Value: sid, Path: "/admin"})
+        req.AddCookie(&http.Cookie{Name: "lang", Value: "en", Path: "/"})
+        req.Header.Set("X-CSRF-Token", "csrf")
+        req.Header.Set("Origin", "http://example.com")
+        w := httptest.NewRecorder()
+        r.ServeHTTP(w, req)
+        return w
+    }
+
+    w := do("/admin/zones/" + strconv.Itoa(int(zone.ID)) + "/toggle")
+    if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "(disabled)") || !strings.Contains(w.Body.String(), "Enable") {
+        t.Fatalf("disable zone: %d %s", w.Code, w.Body.String())
+    }
+    s.db.First(&zone, zone.ID)
+    if !zone.Disabled {
+        t.Fatal("zone not disabled")
+    }
+
+    w = do("/admin/records/" + strconv.Itoa(int(rec.ID)) + "/toggle")
+    if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "not served") {
+        t.Fatalf("disable record: %d %s", w.Code, w.Body.String())
+    }
+    s.db.First(&rec, rec.ID)
+    if !rec.Disabled {
+        t.Fatal("record not disabled")
+    }
+
+    do("/admin/records/" + strconv.Itoa(int(rec.ID)) + "/toggle")
+    do("/admin/zones/" + strconv.Itoa(int(zone.ID)) + "/toggle")
+    s.db.First(&zone, zone.ID)
+    s.db.First(&rec, rec.ID)
+    if zone.Disabled || rec.Disabled || ci.n != 4 {
+        t.Fatalf("after enabling again: zone %v, record %v, %d invalidations", zone.Disabled, rec.Disabled, ci.n)
+    }
+}
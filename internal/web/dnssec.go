@@ -0,0 +1,128 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+
+	"namedot/internal/db"
+)
+
+// sigExpiryWarning is how long before expiry a signature is flagged.
+const sigExpiryWarning = 7 * 24 * time.Hour
+
+// dnssecKey is one DNSKEY of a zone with the DS records for the registrar.
+type dnssecKey struct {
+	KeyTag    uint16
+	Algorithm string
+	KSK       bool // SEP flag set
+	Record    string
+	DS        []string
+	Error     string // the stored data does not parse
+}
+
+// dnssecSig is one RRSIG of a zone and how close it is to expiry.
+type dnssecSig struct {
+	Name       string
+	Covered    string
+	KeyTag     uint16
+	Expiration time.Time
+	Expired    bool
+	Expiring   bool
+}
+
+// dnssecStatus shows the DNSSEC records stored in a zone. namedot does not
+// sign zones itself: keys and signatures are made with external tools and
+// imported, so there is nothing to roll here, only to inspect.
+func (s *Server) dnssecStatus(c *gin.Context) {
+	zone, ok := s.loadZoneRecords(c)
+	if !ok {
+		return
+	}
+	keys, sigs := zoneDNSSEC(&zone, time.Now())
+	expiring := 0
+	for _, sig := range sigs {
+		if sig.Expired || sig.Expiring {
+			expiring++
+		}
+	}
+	s.render(c, http.StatusOK, "dnssec_status", gin.H{
+		"Zone":     zone,
+		"Keys":     keys,
+		"Sigs":     sigs,
+		"Signed":   len(keys) > 0 && len(sigs) > 0,
+		"Expiring": expiring,
+	})
+}
+
+// zoneDNSSEC collects the apex DNSKEYs and all RRSIGs of z. Signatures are
+// sorted by expiry, soonest first.
+func zoneDNSSEC(z *db.Zone, now time.Time) ([]dnssecKey, []dnssecSig) {
+	var keys []dnssecKey
+	var sigs []dnssecSig
+	for _, rs := range z.RRSets {
+		switch {
+		case rs.Type == "DNSKEY" && rs.Name == z.Name:
+			for _, r := range rs.Records {
+				keys = append(keys, parseDNSKEY(rs, r.Data))
+			}
+		case rs.Type == "RRSIG":
+			for _, r := range rs.Records {
+				rr, err := dns.NewRR(rs.Name + " 0 IN RRSIG " + r.Data)
+				sig, ok := rr.(*dns.RRSIG)
+				if err != nil || !ok {
+					continue
+				}
+				exp := time.Unix(int64(sig.Expiration), 0).UTC()
+				sigs = append(sigs, dnssecSig{
+					Name:       rs.Name,
+					Covered:    dns.TypeToString[sig.TypeCovered],
+					KeyTag:     sig.KeyTag,
+					Expiration: exp,
+					Expired:    !now.Before(exp),
+					Expiring:   now.Before(exp) && exp.Sub(now) < sigExpiryWarning,
+				})
+			}
+		}
+	}
+	sort.SliceStable(sigs, func(i, j int) bool { return sigs[i].Expiration.Before(sigs[j].Expiration) })
+	return keys, sigs
+}
+
+// parseDNSKEY describes a stored DNSKEY. DS records (SHA-256 and SHA-384)
+// are only derived for keys with the SEP flag, the ones a registrar needs.
+func parseDNSKEY(rs db.RRSet, data string) dnssecKey {
+	rr, err := dns.NewRR(fmt.Sprintf("%s %d IN DNSKEY %s", rs.Name, rs.TTL, data))
+	key, ok := rr.(*dns.DNSKEY)
+	if err != nil || !ok {
+		msg := "invalid DNSKEY"
+		if err != nil {
+			msg = err.Error()
+		}
+		return dnssecKey{Record: data, Error: msg}
+	}
+	k := dnssecKey{
+		KeyTag:    key.KeyTag(),
+		Algorithm: dns.AlgorithmToString[key.Algorithm],
+		KSK:       key.Flags&dns.SEP != 0,
+		Record:    key.String(),
+	}
+	if k.Algorithm == "" {
+		k.Algorithm = strconv.Itoa(int(key.Algorithm))
+	}
+	if k.KSK {
+		for _, h := range []uint8{dns.SHA256, dns.SHA384} {
+			if ds := key.ToDS(h); ds != nil {
+				k.DS = append(k.DS, strings.ReplaceAll(ds.String(), "\t", " "))
+			}
+		}
+	}
+	k.Record = strings.ReplaceAll(k.Record, "\t", " ")
+	return k
+}
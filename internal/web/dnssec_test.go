@@ -0,0 +1,91 @@
+package web
+
+import (
+    "crypto"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/miekg/dns"
+
+    dbm "namedot/internal/db"
+)
+
+func TestDNSSECStatus(t *testing.T) {
+    s, r := newTestWeb(t)
+    sid := "dnssec-session"
+    s.sessions[sid] = &Session{Username: "admin", CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour), CSRFToken: "csrf"}
+
+    ksk := &dns.DNSKEY{Hdr: dns.RR_Header{Name: "web-dnssec.test.", Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+        Flags: 257, Protocol: 3, Algorithm: dns.ECDSAP256SHA256}
+    zsk := &dns.DNSKEY{Hdr: ksk.Hdr, Flags: 256, Protocol: 3, Algorithm: dns.ECDSAP256SHA256}
+    priv, err := zsk.Generate(256)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := ksk.Generate(256); err != nil {
+        t.Fatal(err)
+    }
+    rdata := func(rr dns.RR) string {
+        return strings.TrimPrefix(rr.String(), rr.Header().String())
+    }
+    sign := func(exp time.Time, rrs ...dns.RR) string {
+        sig := &dns.RRSIG{KeyTag: zsk.KeyTag(), SignerName: zsk.Hdr.Name, Algorithm: zsk.Algorithm,
+            Inception: uint32(time.Now().Add(-time.Hour).Unix()), Expiration: uint32(exp.Unix())}
+        if err := sig.Sign(priv.(crypto.Signer), rrs); err != nil {
+            t.Fatal(err)
+        }
+        return rdata(sig)
+    }
+    a, _ := dns.NewRR("www.web-dnssec.test. 300 IN A 192.0.2.1")
+
+    zone := dbm.Zone{Name: "web-dnssec.test.", RRSets: []dbm.RRSet{
+        {Name: "web-dnssec.test.", Type: "DNSKEY", TTL: 3600, Records: []dbm.RData{{Data: rdata(ksk)}, {Data: rdata(zsk)}}},
+        {Name: "www.web-dnssec.test.", Type: "A", TTL: 300, Records: []dbm.RData{{Data: "192.0.2.1"}}},
+        {Name: "www.web-dnssec.test.", Type: "RRSIG", TTL: 300, Records: []dbm.RData{{Data: sign(time.Now().Add(48*time.Hour), a)}}},
+        {Name: "web-dnssec.test.", Type: "RRSIG", TTL: 3600, Records: []dbm.RData{{Data: sign(time.Now().Add(30*24*time.Hour), ksk, zsk)}}},
+    }}
+    if err := s.db.Create(&zone).Error; err != nil {
+        t.Fatalf("create zone: %v", err)
+    }
+    defer func() {
+        dbm.TrashZone(s.db, zone.ID)
+        dbm.PurgeZone(s.db, zone.ID)
+    }()
+
+    req := httptest.NewRequest("GET", "/admin/zones/"+strconv.Itoa(int(zone.ID))+"/dnssec", nil)
+    req.AddCookie(&http.Cookie{Name: "session", Value: sid, Path: "/admin"})
+    req.AddCookie(&http.Cookie{Name: "lang", Value: "en", Path: "/"})
+    w := httptest.NewRecorder()
+    r.ServeHTTP(w, req)
+    body := w.Body.String()
+    if w.Code != http.StatusOK {
+        t.Fatalf("status %d: %s", w.Code, body)
+    }
+
+    ds := strings.ReplaceAll(ksk.ToDS(dns.SHA256).String(), "\t", " ")
+    for _, want := range []string{"Signed", "2 key(s), 2 signature(s)", ds, strconv.Itoa(int(zsk.KeyTag())),
+        "1 signature(s) expired or expiring within 7 days", "expires soon", "Not a key-signing key"} {
+        if !strings.Contains(body, want) {
+            t.Errorf("missing %q in:\n%s", want, body)
+        }
+    }
+    // Only the KSK gets DS records
+    if strings.Contains(body, strings.ReplaceAll(zsk.ToDS(dns.SHA256).String(), "\t", " ")) {
+        t.Errorf("DS shown for the ZSK")
+    }
+}
+
+func TestZoneDNSSEC_Unsigned(t *testing.T) {
+    zone := &dbm.Zone{Name: "plain.test.", RRSets: []dbm.RRSet{
+        {Name: "plain.test.", Type: "DNSKEY", Records: []dbm.RData{{Data: "not a key"}}},
+        {Name: "plain.test.", Type: "A", Records: []dbm.RData{{Data: "192.0.2.1"}}},
+    }}
+    keys, sigs := zoneDNSSEC(zone, time.Now())
+    if len(keys) != 1 || keys[0].Error == "" || len(sigs) != 0 {
+        t.Fatalf("keys %+v sigs %+v", keys, sigs)
+    }
+}
@@ -0,0 +1,79 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/health"
+)
+
+// HealthLister reports the state of the records with a health check.
+type HealthLister interface {
+	HealthStatuses() []health.Status
+}
+
+// SetHealthLister enables the health checks tab.
+func (s *Server) SetHealthLister(l HealthLister) {
+	if s != nil {
+		s.healthLister = l
+	}
+}
+
+// healthView is one row of the health checks table.
+type healthView struct {
+	Zone      string
+	Name      string
+	Type      string
+	Data      string
+	Check     string
+	Healthy   bool
+	Since     string
+	LastCheck string
+	Latency   string
+	Error     string
+}
+
+// healthChecks lists the checked records, unhealthy ones first.
+func (s *Server) healthChecks(c *gin.Context) {
+	if s.healthLister == nil || !s.cfg.HealthChecks.Enabled {
+		s.render(c, http.StatusOK, "health_checks", gin.H{"Disabled": true})
+		return
+	}
+	when := func(t time.Time) string {
+		if t.IsZero() {
+			return s.tr(c, "never")
+		}
+		return fmt.Sprintf("%s (%s)", t.Local().Format("2006-01-02 15:04:05"), s.age(c, time.Since(t)))
+	}
+	var unhealthy, healthy []healthView
+	for _, st := range s.healthLister.HealthStatuses() {
+		v := healthView{
+			Zone:      st.Zone,
+			Name:      st.Name,
+			Type:      st.Type,
+			Data:      st.Data,
+			Check:     st.Check,
+			Healthy:   st.Healthy,
+			Since:     when(st.Since),
+			LastCheck: when(st.LastCheck),
+			Error:     st.Error,
+		}
+		if !st.LastCheck.IsZero() {
+			v.Latency = fmt.Sprintf("%.1f ms", st.LatencyMs)
+		}
+		if st.Healthy {
+			healthy = append(healthy, v)
+		} else {
+			unhealthy = append(unhealthy, v)
+		}
+	}
+	s.render(c, http.StatusOK, "health_checks", gin.H{
+		"Checks":    append(unhealthy, healthy...),
+		"Unhealthy": len(unhealthy),
+		"Healthy":   len(healthy),
+		"Interval":  (time.Duration(s.cfg.HealthChecks.IntervalSec) * time.Second).String(),
+	})
+}
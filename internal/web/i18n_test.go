@@ -3,6 +3,7 @@ package web
 import (
     "net/http"
     "net/http/httptest"
+    "regexp"
     "strings"
     "testing"
     "time"
@@ -19,7 +20,7 @@ func newTestDB(t *testing.T) *gorm.DB {
     t.Helper()
     db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
     if err != nil { t.Fatalf("open db: %v", err) }
-    if err := db.AutoMigrate(&dbm.Zone{}, &dbm.RRSet{}, &dbm.RData{}, &dbm.Template{}, &dbm.TemplateRecord{}); err != nil {
+    if err := db.AutoMigrate(&dbm.Zone{}, &dbm.RRSet{}, &dbm.RData{}, &dbm.Template{}, &dbm.TemplateRecord{}, &dbm.TemplateApplication{}, &dbm.AuditEntry{}, &dbm.Setting{}); err != nil {
         t.Fatalf("migrate: %v", err)
     }
     return db
@@ -100,3 +101,64 @@ func TestZonesList_LocalizedEmptyStateRU(t *testing.T) {
     }
 }
 
+
+func TestLocales_MatchEnglishCatalog(t *testing.T) {
+    verbs := regexp.MustCompile(`%[sd]`)
+    en := translations["en"]
+    for code, catalog := range translations {
+        for key, v := range catalog {
+            if _, ok := en[key]; !ok {
+                t.Errorf("%s: key %q is not in the English catalog", code, key)
+            }
+            if strings.Join(verbs.FindAllString(key, -1), "") != strings.Join(verbs.FindAllString(v, -1), "") {
+                t.Errorf("%s: %q changes the format verbs: %q", code, key, v)
+            }
+        }
+    }
+    // The shipped catalogs are complete
+    for _, code := range []string{"ru", "de", "es", "fr"} {
+        catalog, ok := translations[code]
+        if !ok {
+            t.Fatalf("no %s catalog", code)
+        }
+        for key := range en {
+            if _, ok := catalog[key]; !ok {
+                t.Errorf("%s: missing translation for %q", code, key)
+            }
+        }
+    }
+}
+
+func TestLanguageSelection(t *testing.T) {
+    _, r := newTestWeb(t)
+
+    req := httptest.NewRequest("GET", "/admin/login", nil)
+    req.Header.Set("Accept-Language", "xx-XX, de-CH;q=0.9, en;q=0.5")
+    w := httptest.NewRecorder()
+    r.ServeHTTP(w, req)
+    body := w.Body.String()
+    if !strings.Contains(body, `lang="de"`) || !strings.Contains(body, "Anmelden") {
+        t.Fatalf("login not localized to DE: %s", body)
+    }
+    if !strings.Contains(body, `<option value="fr">Français</option>`) || !strings.Contains(body, `<option value="de" selected>Deutsch</option>`) {
+        t.Fatalf("language selector missing: %s", body)
+    }
+
+    for code, want := range map[string]string{"fr": "fr", "es": "es", "xx": "en"} {
+        req = httptest.NewRequest("GET", "/admin/lang/"+code, nil)
+        w = httptest.NewRecorder()
+        r.ServeHTTP(w, req)
+        if w.Code != http.StatusFound || !strings.Contains(w.Header().Get("Set-Cookie"), "lang="+want) {
+            t.Fatalf("lang %s: %d %q", code, w.Code, w.Header().Get("Set-Cookie"))
+        }
+    }
+
+    req = httptest.NewRequest("GET", "/admin/login", nil)
+    req.AddCookie(&http.Cookie{Name: "lang", Value: "es", Path: "/"})
+    req.Header.Set("Accept-Language", "de")
+    w = httptest.NewRecorder()
+    r.ServeHTTP(w, req)
+    if body := w.Body.String(); !strings.Contains(body, `lang="es"`) || !strings.Contains(body, "Iniciar sesión") {
+        t.Fatalf("cookie should win over Accept-Language: %s", body)
+    }
+}
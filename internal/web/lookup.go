@@ -0,0 +1,97 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+
+	dnssrv "namedot/internal/server/dns"
+)
+
+// DNSTester runs a query through the DNS server's real lookup path.
+type DNSTester interface {
+	TestQuery(name string, qtype uint16, clientIP netip.Addr) (*dns.Msg, dnssrv.QueryTrace)
+}
+
+// SetDNSTester enables the Test Query tab.
+func (s *Server) SetDNSTester(t DNSTester) {
+	if s != nil {
+		s.dnsTester = t
+	}
+}
+
+// lookup answers a test query as seen by a client at client_ip and shows
+// where the answer came from and which geo rule selected the records.
+func (s *Server) lookup(c *gin.Context) {
+	fail := func(msg string) {
+		s.render(c, http.StatusOK, "lookup_result", gin.H{"Error": msg})
+	}
+	if s.dnsTester == nil {
+		fail(s.tr(c, "DNS server is not available"))
+		return
+	}
+	name := strings.TrimSpace(c.Query("name"))
+	if name == "" {
+		fail(s.tr(c, "Name is required"))
+		return
+	}
+	qtype, ok := dns.StringToType[strings.ToUpper(strings.TrimSpace(c.DefaultQuery("type", "A")))]
+	if !ok {
+		fail(s.tr(c, "Unknown record type"))
+		return
+	}
+	var ip netip.Addr
+	if v := strings.TrimSpace(c.Query("client_ip")); v != "" {
+		a, err := netip.ParseAddr(v)
+		if err != nil {
+			fail(s.tr(c, "Invalid client IP"))
+			return
+		}
+		ip = a
+	}
+
+	m, tr := s.dnsTester.TestQuery(name, qtype, ip)
+
+	source := map[string]string{
+		"cache":    s.tr(c, "Cache"),
+		"hosts":    s.tr(c, "Hosts table"),
+		"blocked":  s.tr(c, "Blocklist"),
+		"local":    s.tr(c, "Local zone"),
+		"disabled": s.tr(c, "Disabled zone"),
+		"stub":     s.tr(c, "Stub zone"),
+		"forward":  s.tr(c, "Forwarder"),
+		"recurse":  s.tr(c, "Recursion"),
+		"refused":  s.tr(c, "Refused (REFUSED)"),
+		"nxdomain": s.tr(c, "No answer (NXDOMAIN)"),
+		"plugin":   s.tr(c, "Plugin"),
+	}[tr.Source]
+	clientIP := ""
+	if tr.ClientIP.IsValid() {
+		clientIP = tr.ClientIP.String()
+	}
+	asn := ""
+	if tr.Geo.ASN != 0 {
+		asn = fmt.Sprintf("%d", tr.Geo.ASN)
+	}
+	answers := make([]string, 0, len(m.Answer))
+	for _, rr := range m.Answer {
+		answers = append(answers, rr.String())
+	}
+
+	s.render(c, http.StatusOK, "lookup_result", gin.H{
+		"Rcode":     dns.RcodeToString[m.Rcode],
+		"Source":    source,
+		"Zone":      tr.Zone,
+		"Rule":      tr.Rule,
+		"Rewrite":   tr.Rewrite,
+		"ClientIP":  clientIP,
+		"Country":   tr.Geo.Country,
+		"Continent": tr.Geo.Continent,
+		"ASN":       asn,
+		"Answers":   answers,
+	})
+}
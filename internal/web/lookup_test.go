@@ -0,0 +1,66 @@
+package web
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/netip"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/miekg/dns"
+
+    dnssrv "namedot/internal/server/dns"
+)
+
+type fakeTester struct {
+    name   string
+    qtype  uint16
+    client netip.Addr
+}
+
+func (f *fakeTester) TestQuery(name string, qtype uint16, clientIP netip.Addr) (*dns.Msg, dnssrv.QueryTrace) {
+    f.name, f.qtype, f.client = name, qtype, clientIP
+    m := new(dns.Msg)
+    rr, _ := dns.NewRR("www.example.com. 60 IN A 192.0.2.2")
+    m.Answer = []dns.RR{rr}
+    return m, dnssrv.QueryTrace{ClientIP: clientIP, Source: "local", Zone: "example.com.", Rule: "subnet", TTL: 60}
+}
+
+func TestLookupTester(t *testing.T) {
+    s, r := newTestWeb(t)
+    sid := "lookup-session"
+    s.sessions[sid] = &Session{Username: "admin", CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour), CSRFToken: "csrf"}
+
+    get := func(path string) string {
+        req := httptest.NewRequest("GET", path, nil)
+        req.AddCookie(&http.Cookie{Name: "session", Value: sid, Path: "/admin"})
+        req.AddCookie(&http.Cookie{Name: "lang", Value: "en", Path: "/"})
+        w := httptest.NewRecorder()
+        r.ServeHTTP(w, req)
+        if w.Code != http.StatusOK {
+            t.Fatalf("%s: status %d", path, w.Code)
+        }
+        return w.Body.String()
+    }
+
+    if body := get("/admin/lookup?name=www.example.com"); !strings.Contains(body, "DNS server is not available") {
+        t.Fatalf("expected unavailable message, got %s", body)
+    }
+
+    ft := &fakeTester{}
+    s.SetDNSTester(ft)
+    body := get("/admin/lookup?name=www.example.com&type=a&client_ip=203.0.113.7")
+    if ft.name != "www.example.com" || ft.qtype != dns.TypeA || ft.client.String() != "203.0.113.7" {
+        t.Fatalf("tester called with %+v", ft)
+    }
+    for _, want := range []string{"Local zone", "subnet", "example.com.", "192.0.2.2", "NOERROR"} {
+        if !strings.Contains(body, want) {
+            t.Errorf("result should contain %q: %s", want, body)
+        }
+    }
+
+    if body := get("/admin/lookup?name=www.example.com&client_ip=nope"); !strings.Contains(body, "Invalid client IP") {
+        t.Fatalf("expected IP error, got %s", body)
+    }
+}
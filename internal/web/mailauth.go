@@ -0,0 +1,132 @@
+package web
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/db"
+	"namedot/internal/mailauth"
+)
+
+// mailAuthForm opens the SPF/DKIM/DMARC builder of a zone.
+func (s *Server) mailAuthForm(c *gin.Context) {
+	zone, ok := s.loadZone(c)
+	if !ok {
+		return
+	}
+	s.render(c, http.StatusOK, "mailauth_form", gin.H{"Zone": zone, "Form": mailAuthFields{SPF: true, All: "-all", DMARC: true, Policy: "none"}})
+}
+
+// mailAuthFields are the builder's form values, kept to refill the form.
+type mailAuthFields struct {
+	SPF, MX, A                   bool
+	IP4, IP6, Include, All       string
+	DKIM, Testing                bool
+	Selector, KeyType, PublicKey string
+	DMARC                        bool
+	Policy, SubdomainPolicy, Pct string
+	RUA, RUF, ADKIM, ASPF        string
+}
+
+func (s *Server) mailAuthFields(c *gin.Context) mailAuthFields {
+	on := func(k string) bool { return c.PostForm(k) != "" }
+	return mailAuthFields{
+		SPF: on("spf"), MX: on("mx"), A: on("a"),
+		IP4: c.PostForm("ip4"), IP6: c.PostForm("ip6"), Include: c.PostForm("include"), All: c.PostForm("all"),
+		DKIM: on("dkim"), Testing: on("testing"),
+		Selector: c.PostForm("selector"), KeyType: c.PostForm("key_type"), PublicKey: c.PostForm("public_key"),
+		DMARC:  on("dmarc"),
+		Policy: c.PostForm("policy"), SubdomainPolicy: c.PostForm("sp"), Pct: c.PostForm("pct"),
+		RUA: c.PostForm("rua"), RUF: c.PostForm("ruf"), ADKIM: c.PostForm("adkim"), ASPF: c.PostForm("aspf"),
+	}
+}
+
+// request turns the form into a builder request; lists are separated by
+// commas or whitespace.
+func (f mailAuthFields) request() (mailauth.Request, error) {
+	list := func(v string) []string {
+		return strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' || r == '\n' || r == '\r' || r == '\t' })
+	}
+	var req mailauth.Request
+	if f.SPF {
+		req.SPF = &mailauth.SPF{MX: f.MX, A: f.A, IP4: list(f.IP4), IP6: list(f.IP6), Include: list(f.Include), All: f.All}
+	}
+	if f.DKIM {
+		req.DKIM = &mailauth.DKIM{Selector: f.Selector, KeyType: f.KeyType, PublicKey: f.PublicKey, Testing: f.Testing}
+	}
+	if f.DMARC {
+		req.DMARC = &mailauth.DMARC{Policy: f.Policy, SubdomainPolicy: f.SubdomainPolicy, RUA: list(f.RUA), RUF: list(f.RUF), ADKIM: f.ADKIM, ASPF: f.ASPF}
+		if p := strings.TrimSpace(f.Pct); p != "" {
+			n, err := strconv.Atoi(p)
+			if err != nil {
+				return req, fmt.Errorf("%w: dmarc percent %q", mailauth.ErrInvalid, p)
+			}
+			req.DMARC.Percent = &n
+		}
+	}
+	return req, nil
+}
+
+// buildMailAuth builds the records from the posted form, rendering the form
+// with the error when the input is invalid.
+func (s *Server) buildMailAuth(c *gin.Context, zone db.Zone, f mailAuthFields) (mailauth.Result, bool) {
+	req, err := f.request()
+	var res mailauth.Result
+	if err == nil {
+		res, err = mailauth.Build(c.Request.Context(), zone.Name, req, net.DefaultResolver)
+	}
+	if err != nil {
+		s.render(c, http.StatusOK, "mailauth_form", gin.H{"Zone": zone, "Form": f, "Error": err.Error()})
+		return res, false
+	}
+	return res, true
+}
+
+// previewMailAuth shows the records the builder makes, with warnings.
+func (s *Server) previewMailAuth(c *gin.Context) {
+	zone, ok := s.loadZone(c)
+	if !ok {
+		return
+	}
+	f := s.mailAuthFields(c)
+	res, ok := s.buildMailAuth(c, zone, f)
+	if !ok {
+		return
+	}
+	s.render(c, http.StatusOK, "mailauth_form", gin.H{"Zone": zone, "Form": f, "Result": res, "Previewed": true})
+}
+
+// applyMailAuth stores the built records and returns to the zone's records.
+func (s *Server) applyMailAuth(c *gin.Context) {
+	zone, ok := s.loadZone(c)
+	if !ok {
+		return
+	}
+	f := s.mailAuthFields(c)
+	res, ok := s.buildMailAuth(c, zone, f)
+	if !ok {
+		return
+	}
+	changed, err := mailauth.Apply(s.dbFor(c), zone, res.Records, s.cfg.RecordDefaultTTL())
+	if err != nil {
+		s.render(c, http.StatusOK, "mailauth_form", gin.H{"Zone": zone, "Form": f, "Error": err.Error()})
+		return
+	}
+	if changed {
+		names := make([]string, 0, len(res.Records))
+		for _, r := range res.Records {
+			names = append(names, r.Name)
+		}
+		db.TouchZone(s.db, zone, s.cfg)
+		s.audit(c, db.AuditMailAuth, zone, 0, "TXT "+strings.Join(names, " "))
+	}
+
+	c.Header("HX-Retarget", "#zones-list")
+	c.Header("HX-Reswap", "innerHTML")
+	s.listRecords(c)
+}
@@ -0,0 +1,62 @@
+package web
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+
+    dbm "namedot/internal/db"
+)
+
+func TestMailAuth_PreviewAndApply(t *testing.T) {
+    s, r := newTestWeb(t)
+    sid := "mailauth-session"
+    s.sessions[sid] = &Session{Username: "admin", CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour), CSRFToken: "csrf"}
+
+    zone := dbm.Zone{Name: "web-mailauth.test."}
+    if err := s.db.Create(&zone).Error; err != nil {
+        t.Fatalf("create zone: %v", err)
+    }
+    defer func() {
+        dbm.TrashZone(s.db, zone.ID)
+        dbm.PurgeZone(s.db, zone.ID)
+    }()
+    base := "/admin/zones/" + strconv.Itoa(int(zone.ID)) + "/mailauth"
+
+    post := func(path string, form url.Values) *httptest.ResponseRecorder {
+        req := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+        req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+        req.AddCookie(&http.Cookie{Name: "session", Value: sid, Path: "/admin"})
+        req.AddCookie(&http.Cookie{Name: "lang", Value: "en", Path: "/"})
+        req.Header.Set("X-CSRF-Token", "csrf")
+        req.Header.Set("Origin", "http://example.com")
+        w := httptest.NewRecorder()
+        r.ServeHTTP(w, req)
+        return w
+    }
+    form := url.Values{"spf": {"1"}, "mx": {"1"}, "ip4": {"192.0.2.10, 192.0.2.11"}, "all": {"~all"}, "dmarc": {"1"}, "policy": {"none"}}
+
+    w := post(base+"/preview", form)
+    body := w.Body.String()
+    if w.Code != http.StatusOK || !strings.Contains(body, "v=spf1 mx ip4:192.0.2.10 ip4:192.0.2.11 ~all") || !strings.Contains(body, "v=DMARC1; p=none") || !strings.Contains(body, "you will get no reports") {
+        t.Fatalf("preview: %d %s", w.Code, body)
+    }
+
+    bad := url.Values{"spf": {"1"}, "ip4": {"2001:db8::1"}}
+    if body := post(base+"/preview", bad).Body.String(); !strings.Contains(body, "wrong address family") {
+        t.Fatalf("invalid input: %s", body)
+    }
+
+    if w := post(base, form); w.Code != http.StatusOK || w.Header().Get("HX-Retarget") != "#zones-list" {
+        t.Fatalf("apply: %d %s", w.Code, w.Body.String())
+    }
+    var n int64
+    s.db.Model(&dbm.RRSet{}).Where("zone_id = ? AND type = ?", zone.ID, "TXT").Count(&n)
+    if n != 2 {
+        t.Fatalf("expected SPF and DMARC TXT rrsets, got %d", n)
+    }
+}
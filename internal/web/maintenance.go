@@ -0,0 +1,50 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReadOnlyChecker reports whether the whole server is in read-only mode
+// (PUT /readonly in the REST API or SIGUSR1), and why.
+type ReadOnlyChecker interface {
+	ReadOnly() (bool, string)
+}
+
+// SetReadOnlyChecker makes the admin panel follow the server read-only mode.
+func (s *Server) SetReadOnlyChecker(r ReadOnlyChecker) {
+	if s != nil {
+		s.readOnlyChecker = r
+	}
+}
+
+// serverReadOnly reports whether the server is in read-only mode.
+func (s *Server) serverReadOnly() (bool, string) {
+	if s.readOnlyChecker == nil {
+		return false, ""
+	}
+	return s.readOnlyChecker.ReadOnly()
+}
+
+// maintenanceMiddleware refuses every change while the server is read-only.
+// Unlike the viewer role this applies to admins too.
+func (s *Server) maintenanceMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+		on, reason := s.serverReadOnly()
+		if !on {
+			c.Next()
+			return
+		}
+		msg := s.tr(c, "Server is in read-only mode")
+		if reason != "" {
+			msg = s.trf(c, "Server is in read-only mode: %s", reason)
+		}
+		s.renderError(c, http.StatusServiceUnavailable, msg)
+		c.Abort()
+	}
+}
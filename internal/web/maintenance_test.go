@@ -0,0 +1,39 @@
+package web
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+)
+
+type fakeReadOnly struct{ reason string }
+
+func (f fakeReadOnly) ReadOnly() (bool, string) { return true, f.reason }
+
+func TestMaintenance_BlocksAdminChanges(t *testing.T) {
+    s, r := newTestWeb(t)
+    sid := "ro-session"
+    s.sessions[sid] = &Session{Username: "admin", CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour), CSRFToken: "csrf"}
+    s.SetReadOnlyChecker(fakeReadOnly{reason: "db failover"})
+
+    do := func(method, path string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(method, path, nil)
+        req.AddCookie(&http.Cookie{Name: "session", Value: sid, Path: "/admin"})
+        req.AddCookie(&http.Cookie{Name: "lang", Value: "en", Path: "/"})
+        req.Header.Set("X-CSRF-Token", "csrf")
+        req.Header.Set("Origin", "http://example.com")
+        w := httptest.NewRecorder()
+        r.ServeHTTP(w, req)
+        return w
+    }
+
+    w := do("POST", "/admin/zones")
+    if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "Server is in read-only mode: db failover") {
+        t.Fatalf("POST while read-only: %d %s", w.Code, w.Body.String())
+    }
+    if w := do("GET", "/admin/zones"); w.Code != http.StatusOK {
+        t.Fatalf("GET while read-only: %d", w.Code)
+    }
+}
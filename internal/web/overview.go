@@ -0,0 +1,224 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/db"
+	"namedot/internal/geoip"
+	dnssrv "namedot/internal/server/dns"
+)
+
+// overviewRecentChanges is the number of recently changed records shown.
+const overviewRecentChanges = 10
+
+// QueryRater reports per-minute DNS query counts for the overview sparklines.
+type QueryRater interface {
+	QueryRates() []dnssrv.RateSample
+}
+
+// SetQueryRater enables the QPS and cache hit rate charts.
+func (s *Server) SetQueryRater(q QueryRater) {
+	if s != nil {
+		s.queryRater = q
+	}
+}
+
+// recentChange is a record row joined with its RRSet and zone.
+type recentChange struct {
+	Zone      string
+	Name      string
+	Type      string
+	Data      string
+	UpdatedAt time.Time
+}
+
+// overviewCard is one of the counters at the top of the overview.
+type overviewCard struct {
+	Title string
+	Value string
+	Note  string
+	Spark *sparklineData
+}
+
+// replicationInfo is the replication row of the overview.
+type replicationInfo struct {
+	Text   string
+	Detail string
+	Error  string
+}
+
+// overview renders the landing page: counts, query rates, replication,
+// GeoIP and database state, and the most recently changed records.
+func (s *Server) overview(c *gin.Context) {
+	var zones, disabled, rrsets, records int64
+	s.db.Model(&db.Zone{}).Count(&zones)
+	s.db.Model(&db.Zone{}).Where("disabled = ?", true).Count(&disabled)
+	s.db.Model(&db.RRSet{}).Count(&rrsets)
+	s.db.Model(&db.RData{}).
+		Joins("JOIN rr_sets ON rr_sets.id = r_data.rr_set_id AND rr_sets.deleted_at IS NULL").
+		Count(&records)
+
+	zonesNote := ""
+	if disabled > 0 {
+		zonesNote = s.trf(c, "%d disabled", disabled)
+	}
+	cards := []overviewCard{
+		{Title: s.tr(c, "Zones"), Value: fmt.Sprintf("%d", zones), Note: zonesNote},
+		{Title: s.tr(c, "RRSets"), Value: fmt.Sprintf("%d", rrsets)},
+		{Title: s.tr(c, "Records"), Value: fmt.Sprintf("%d", records)},
+	}
+
+	if s.queryRater != nil {
+		samples := s.queryRater.QueryRates()
+		qps := make([]float64, 0, len(samples))
+		hitRate := make([]float64, 0, len(samples))
+		var queries, hits uint64
+		for _, r := range samples {
+			qps = append(qps, float64(r.Queries)/60)
+			rate := 0.0
+			if r.Queries > 0 {
+				rate = float64(r.CacheHits) / float64(r.Queries) * 100
+			}
+			hitRate = append(hitRate, rate)
+			queries += r.Queries
+			hits += r.CacheHits
+		}
+		// The current minute is still filling up; show the last complete one
+		current := 0.0
+		if len(qps) > 1 {
+			current = qps[len(qps)-2]
+		}
+		overall := 0.0
+		if queries > 0 {
+			overall = float64(hits) / float64(queries) * 100
+		}
+		cards = append(cards,
+			overviewCard{Title: s.tr(c, "Queries per second"), Value: fmt.Sprintf("%.1f", current), Spark: sparkline(qps, "#667eea")},
+			overviewCard{Title: s.tr(c, "Cache hit rate (1h)"), Value: fmt.Sprintf("%.0f%%", overall), Spark: sparkline(hitRate, "#38a169")},
+		)
+	}
+
+	geo := s.tr(c, "Disabled")
+	if s.cfg.GeoIP.Enabled {
+		if mt, err := geoip.ModTime(s.cfg.GeoIP.MMDBPath); err != nil {
+			geo = err.Error()
+		} else {
+			geo = s.trf(c, "updated %s (%s)", mt.Format("2006-01-02 15:04"), s.age(c, time.Since(mt)))
+		}
+	}
+	dbInfo := s.cfg.DB.Driver
+	if size, err := db.Size(s.db); err == nil {
+		dbInfo += ", " + formatBytes(size)
+	}
+
+	// Recent changes
+	var changes []recentChange
+	s.db.Model(&db.RData{}).
+		Select("zones.name AS zone, rr_sets.name AS name, rr_sets.type AS type, r_data.data AS data, r_data.updated_at AS updated_at").
+		Joins("JOIN rr_sets ON rr_sets.id = r_data.rr_set_id AND rr_sets.deleted_at IS NULL").
+		Joins("JOIN zones ON zones.id = rr_sets.zone_id AND zones.deleted_at IS NULL").
+		Order("r_data.updated_at desc").
+		Limit(overviewRecentChanges).
+		Scan(&changes)
+
+	s.render(c, http.StatusOK, "overview", gin.H{
+		"Cards":       cards,
+		"Replication": s.replicationSummary(c),
+		"GeoIP":       geo,
+		"Database":    dbInfo,
+		"Changes":     changes,
+	})
+}
+
+// replicationSummary describes the replication role and, on a slave, the
+// outcome of the last sync.
+func (s *Server) replicationSummary(c *gin.Context) replicationInfo {
+	switch s.cfg.Replication.Mode {
+	case "master":
+		n := 0
+		if s.slaveLister != nil {
+			n = len(s.slaveLister.Slaves())
+		}
+		return replicationInfo{Text: s.trf(c, "Master, %d slave(s) seen", n)}
+	case "slave":
+		info := replicationInfo{Text: s.trf(c, "Slave of %s", s.cfg.Replication.MasterURL)}
+		if s.replicator == nil {
+			return info
+		}
+		st := s.replicator.Status()
+		switch {
+		case st.LastAttempt.IsZero():
+			info.Detail = s.tr(c, "Not synced yet")
+		case st.LastSuccess.IsZero():
+			info.Detail = s.tr(c, "Never synced successfully")
+		default:
+			info.Detail = s.trf(c, "Last sync %s, %d zones", s.age(c, time.Since(st.LastSuccess)), st.Zones)
+		}
+		info.Error = st.LastError
+		return info
+	default:
+		return replicationInfo{Text: s.tr(c, "Standalone")}
+	}
+}
+
+// age formats d as a coarse "N units ago".
+func (s *Server) age(c *gin.Context, d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return s.tr(c, "just now")
+	case d < time.Hour:
+		return s.trf(c, "%d min ago", int(d/time.Minute))
+	case d < 48*time.Hour:
+		return s.trf(c, "%d h ago", int(d/time.Hour))
+	default:
+		return s.trf(c, "%d days ago", int(d/(24*time.Hour)))
+	}
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// sparklineData is a polyline for the inline SVG chart of an overview card.
+type sparklineData struct {
+	Points string
+	Color  string
+}
+
+// sparkline scales values to the maximum for a small inline SVG chart. It
+// returns nil if there are too few values to draw a line.
+func sparkline(values []float64, color string) *sparklineData {
+	const w, h = 200.0, 32.0
+	if len(values) < 2 {
+		return nil
+	}
+	max := 0.0
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	points := make([]string, len(values))
+	for i, v := range values {
+		y := h - 1
+		if max > 0 {
+			y = h - 1 - v/max*(h-2)
+		}
+		points[i] = fmt.Sprintf("%.1f,%.1f", float64(i)*w/float64(len(values)-1), y)
+	}
+	return &sparklineData{Points: strings.Join(points, " "), Color: color}
+}
@@ -0,0 +1,74 @@
+package web
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    dbm "namedot/internal/db"
+    "namedot/internal/replication"
+    dnssrv "namedot/internal/server/dns"
+)
+
+type fakeRater struct{}
+
+func (fakeRater) QueryRates() []dnssrv.RateSample {
+    now := time.Now().Truncate(time.Minute)
+    return []dnssrv.RateSample{
+        {Minute: now.Add(-2 * time.Minute), Queries: 60, CacheHits: 30},
+        {Minute: now.Add(-time.Minute), Queries: 120, CacheHits: 90},
+        {Minute: now, Queries: 10},
+    }
+}
+
+func TestOverview(t *testing.T) {
+    s, r := newTestWeb(t)
+    sid := "overview-session"
+    s.sessions[sid] = &Session{Username: "admin", CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour), CSRFToken: "csrf"}
+
+    zone := dbm.Zone{Name: "overview.test.", RRSets: []dbm.RRSet{{Name: "www.overview.test.", Type: "A", TTL: 300, Records: []dbm.RData{{Data: "192.0.2.77"}}}}}
+    if err := s.db.Create(&zone).Error; err != nil {
+        t.Fatalf("create zone: %v", err)
+    }
+    defer func() {
+        dbm.TrashZone(s.db, zone.ID)
+        dbm.PurgeZone(s.db, zone.ID)
+    }()
+
+    get := func() string {
+        req := httptest.NewRequest("GET", "/admin/overview", nil)
+        req.AddCookie(&http.Cookie{Name: "session", Value: sid, Path: "/admin"})
+        req.AddCookie(&http.Cookie{Name: "lang", Value: "en", Path: "/"})
+        w := httptest.NewRecorder()
+        r.ServeHTTP(w, req)
+        if w.Code != http.StatusOK {
+            t.Fatalf("overview: %d %s", w.Code, w.Body.String())
+        }
+        return w.Body.String()
+    }
+
+    body := get()
+    if !strings.Contains(body, "www.overview.test.") || !strings.Contains(body, "192.0.2.77") {
+        t.Fatalf("recent changes missing: %s", body)
+    }
+    if !strings.Contains(body, "Standalone") || strings.Contains(body, "Queries per second") {
+        t.Fatalf("unexpected overview without DNS rates: %s", body)
+    }
+
+    s.SetQueryRater(fakeRater{})
+    s.cfg.Replication.Mode = "slave"
+    s.cfg.Replication.MasterURL = "http://master:8080"
+    defer func() { s.cfg.Replication.Mode, s.cfg.Replication.MasterURL = "", "" }()
+    s.SetReplicator(&fakeReplicator{st: replication.Status{LastAttempt: time.Now(), LastSuccess: time.Now().Add(-time.Hour), LastError: "master returned status 503", Zones: 4}})
+    defer func() { s.queryRater, s.replicator = nil, nil }()
+
+    body = get()
+    // The last complete minute had 120 queries (2.0/s); 120 of 190 were cache hits
+    for _, want := range []string{"Queries per second", "2.0", "63%", "<svg", "Slave of http://master:8080", "4 zones", "master returned status 503"} {
+        if !strings.Contains(body, want) {
+            t.Fatalf("overview missing %q: %s", want, body)
+        }
+    }
+}
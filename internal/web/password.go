@@ -0,0 +1,31 @@
+package web
+
+import (
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"namedot/internal/config"
+	"namedot/internal/db"
+)
+
+// credentialCacheTTL bounds how long a password rotated by "namedot
+// password rotate" takes to be accepted.
+const credentialCacheTTL = 30 * time.Second
+
+func newCredentialCache(gdb *gorm.DB) *db.CredentialCache {
+	if gdb == nil {
+		return nil
+	}
+	return db.NewCredentialCache(gdb, credentialCacheTTL)
+}
+
+// checkPassword reports whether password is the user's: a rotated password
+// replaces the password_hash from the config file.
+func (s *Server) checkPassword(user config.AdminUser, password string) bool {
+	if ok, rotated := s.creds.Check(db.CredentialAdminPassword, user.Username, password); rotated {
+		return ok
+	}
+	return bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) == nil
+}
@@ -0,0 +1,60 @@
+package web
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strings"
+    "testing"
+    "time"
+
+    "golang.org/x/crypto/bcrypt"
+
+    "namedot/internal/config"
+    dbm "namedot/internal/db"
+)
+
+func TestLogin_RotatedPassword(t *testing.T) {
+    s, r := newTestWeb(t)
+    if err := s.db.AutoMigrate(&dbm.Credential{}); err != nil {
+        t.Fatalf("migrate: %v", err)
+    }
+    hash, err := bcrypt.GenerateFromPassword([]byte("config-pass"), bcrypt.MinCost)
+    if err != nil {
+        t.Fatalf("hash: %v", err)
+    }
+    s.cfg.Admin.Users = []config.AdminUser{{Username: "ops", PasswordHash: string(hash)}}
+    defer s.db.Where("subject = ?", "ops").Delete(&dbm.Credential{})
+
+    login := func(password string) int {
+        form := url.Values{"username": {"ops"}, "password": {password}}
+        req := httptest.NewRequest("POST", "/admin/login", strings.NewReader(form.Encode()))
+        req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+        w := httptest.NewRecorder()
+        r.ServeHTTP(w, req)
+        return w.Code
+    }
+
+    if code := login("config-pass"); code != http.StatusOK {
+        t.Fatalf("config password: %d", code)
+    }
+    if _, err := dbm.RotateCredential(s.db, dbm.CredentialAdminPassword, "ops", "rotated-pass", string(hash), 0); err != nil {
+        t.Fatalf("rotate: %v", err)
+    }
+    s.creds.Invalidate()
+    if code := login("config-pass"); code != http.StatusUnauthorized {
+        t.Fatalf("rotated-out password: %d", code)
+    }
+    if code := login("rotated-pass"); code != http.StatusOK {
+        t.Fatalf("rotated password: %d", code)
+    }
+
+    // The grace period keeps the previous password working
+    if _, err := dbm.RotateCredential(s.db, dbm.CredentialAdminPassword, "ops", "third-pass", "", time.Hour); err != nil {
+        t.Fatalf("rotate: %v", err)
+    }
+    s.creds.Invalidate()
+    if login("rotated-pass") != http.StatusOK || login("third-pass") != http.StatusOK {
+        t.Fatal("both passwords should work during the grace period")
+    }
+}
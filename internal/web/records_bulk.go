@@ -0,0 +1,205 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+	"gorm.io/gorm"
+
+	"namedot/internal/db"
+)
+
+// maxBulkLines caps one bulk paste so a stray file does not lock the DB.
+const maxBulkLines = 5000
+
+// bulkRecord is one parsed "name type ttl data" line.
+type bulkRecord struct {
+	Line int
+	Name string
+	Type string
+	TTL  uint32
+	Data string
+}
+
+// bulkLineError reports why a line of the bulk form was rejected.
+type bulkLineError struct {
+	Line int
+	Text string
+	Err  string
+}
+
+// parseBulkRecords parses "name type ttl data" lines relative to zone
+// ("name ttl type data" as in zone files works too). Blank
+// lines and lines starting with ';' or '#' are skipped. Each record is checked
+// with the DNS parser, so bad data is reported before anything is written.
+func parseBulkRecords(text, zone string) ([]bulkRecord, []bulkLineError) {
+	var recs []bulkRecord
+	var errs []bulkLineError
+	for i, raw := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line := strings.TrimSpace(raw)
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fail := func(msg string) {
+			errs = append(errs, bulkLineError{Line: i + 1, Text: line, Err: msg})
+		}
+		head, data := cutFields(line, 3)
+		if len(head) < 3 || data == "" {
+			fail("expected: name type ttl data")
+			continue
+		}
+		typStr, ttlStr := head[1], head[2]
+		// Also accept zone file order (name ttl type data)
+		if _, err := strconv.ParseUint(typStr, 10, 32); err == nil {
+			if _, ok := dns.StringToType[strings.ToUpper(ttlStr)]; ok {
+				typStr, ttlStr = ttlStr, typStr
+			}
+		}
+		typ := strings.ToUpper(typStr)
+		if _, ok := dns.StringToType[typ]; !ok {
+			fail(fmt.Sprintf("unknown type %q", typStr))
+			continue
+		}
+		ttl, err := strconv.ParseUint(ttlStr, 10, 32)
+		if err != nil {
+			fail(fmt.Sprintf("invalid ttl %q", ttlStr))
+			continue
+		}
+		name := toFQDN(head[0], zone)
+		switch typ {
+		case "CNAME":
+			if data == "@" {
+				data = toFQDN("@", zone)
+			}
+		case "MX":
+			data = combineMXData(data, 10, zone)
+		}
+		if err := validateRecord(name, typ, uint32(ttl), data); err != nil {
+			fail(err.Error())
+			continue
+		}
+		recs = append(recs, bulkRecord{Line: i + 1, Name: name, Type: typ, TTL: uint32(ttl), Data: data})
+	}
+	return recs, errs
+}
+
+// validateRecord checks that data is valid for typ using the DNS parser.
+func validateRecord(name, typ string, ttl uint32, data string) error {
+	_, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", name, ttl, typ, data))
+	return err
+}
+
+// cutFields splits off the first n whitespace-separated fields and returns
+// them with the untouched rest of the line (record data may contain spaces).
+func cutFields(line string, n int) ([]string, string) {
+	var fields []string
+	rest := strings.TrimSpace(line)
+	for len(fields) < n && rest != "" {
+		end := strings.IndexAny(rest, " \t")
+		if end < 0 {
+			fields = append(fields, rest)
+			rest = ""
+			break
+		}
+		fields = append(fields, rest[:end])
+		rest = strings.TrimSpace(rest[end:])
+	}
+	return fields, rest
+}
+
+func (s *Server) bulkRecordForm(c *gin.Context) {
+	s.renderBulkForm(c, c.Param("id"), "", nil)
+}
+
+func (s *Server) renderBulkForm(c *gin.Context, zoneID, text string, errs []bulkLineError) {
+	rejected := 0
+	for _, e := range errs {
+		if e.Line > 0 {
+			rejected++
+		}
+	}
+	s.render(c, http.StatusOK, "bulk_form", gin.H{
+		"ZoneID":   zoneID,
+		"Text":     text,
+		"Errors":   errs,
+		"Rejected": rejected,
+	})
+}
+
+// createBulkRecords adds all pasted records in one transaction, or none if
+// any line is invalid. Records that already exist are skipped.
+func (s *Server) createBulkRecords(c *gin.Context) {
+	zoneID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.String(http.StatusBadRequest, s.tr(c, "Invalid zone ID"))
+		return
+	}
+	var zone db.Zone
+	if err := s.db.First(&zone, zoneID).Error; err != nil {
+		c.String(http.StatusNotFound, s.tr(c, "Zone not found"))
+		return
+	}
+
+	text := c.PostForm("records")
+	recs, errs := parseBulkRecords(text, zone.Name)
+	for _, r := range recs {
+		if msg := s.ttlLimitError(c, r.TTL); msg != "" {
+			errs = append(errs, bulkLineError{Line: r.Line, Err: msg})
+		}
+	}
+	if len(errs) == 0 && len(recs) == 0 {
+		errs = []bulkLineError{{Err: s.tr(c, "No records to add")}}
+	}
+	if len(recs) > maxBulkLines {
+		errs = append(errs, bulkLineError{Line: recs[maxBulkLines].Line, Err: s.trf(c, "At most %d records per paste", maxBulkLines)})
+	}
+	if len(errs) > 0 {
+		s.renderBulkForm(c, c.Param("id"), text, errs)
+		return
+	}
+
+	added := 0
+	err = s.dbFor(c).Transaction(func(tx *gorm.DB) error {
+		sets := map[string]*db.RRSet{}
+		for _, r := range recs {
+			key := r.Name + " " + r.Type
+			rrset := sets[key]
+			if rrset == nil {
+				rrset = &db.RRSet{}
+				if err := tx.Where("zone_id = ? AND name = ? AND type = ?", zone.ID, r.Name, r.Type).First(rrset).Error; err != nil {
+					*rrset = db.RRSet{ZoneID: zone.ID, Name: r.Name, Type: r.Type, TTL: r.TTL}
+					if err := tx.Create(rrset).Error; err != nil {
+						return err
+					}
+				}
+				sets[key] = rrset
+			}
+			record := db.RData{RRSetID: rrset.ID, Data: r.Data}
+			if db.HasDuplicateRecord(tx, record) {
+				continue
+			}
+			if err := tx.Create(&record).Error; err != nil {
+				return err
+			}
+			added++
+		}
+		return nil
+	})
+	if err != nil {
+		s.renderBulkForm(c, c.Param("id"), text, []bulkLineError{{Err: err.Error()}})
+		return
+	}
+	s.audit(c, db.AuditRecordCreate, zone, 0, fmt.Sprintf("bulk add: %d record(s)", added))
+
+	// Ensure SOA exists/updated after change
+	db.TouchZone(s.db, zone, s.cfg)
+
+	// Replace the whole records view, not just the form
+	c.Header("HX-Retarget", "#zones-list")
+	c.Header("HX-Reswap", "innerHTML")
+	s.listRecords(c)
+}
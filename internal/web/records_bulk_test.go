@@ -0,0 +1,105 @@
+package web
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+
+    dbm "namedot/internal/db"
+)
+
+func TestParseBulkRecords(t *testing.T) {
+    text := "www A 300 192.0.2.1\n" +
+        "; comment\n" +
+        "\n" +
+        "@ mx 3600 mail\n" +
+        "@ 300 TXT \"v=spf1  -all\"\n" +
+        "bad A 300 999.1.1.1\n" +
+        "short A\n" +
+        "x NOPE 300 data\n" +
+        "y A abc 192.0.2.2\n"
+    recs, errs := parseBulkRecords(text, "example.com.")
+
+    if len(recs) != 3 {
+        t.Fatalf("expected 3 records, got %+v", recs)
+    }
+    if recs[0].Name != "www.example.com." || recs[0].Type != "A" || recs[0].TTL != 300 || recs[0].Data != "192.0.2.1" {
+        t.Errorf("unexpected A record: %+v", recs[0])
+    }
+    if recs[1].Name != "example.com." || recs[1].Type != "MX" || recs[1].Data != "10 mail" || recs[1].Line != 4 {
+        t.Errorf("unexpected MX record: %+v", recs[1])
+    }
+    if recs[2].Data != `"v=spf1  -all"` {
+        t.Errorf("TXT data must be kept verbatim, got %q", recs[2].Data)
+    }
+
+    wantLines := []int{6, 7, 8, 9}
+    if len(errs) != len(wantLines) {
+        t.Fatalf("expected %d errors, got %+v", len(wantLines), errs)
+    }
+    for i, e := range errs {
+        if e.Line != wantLines[i] || e.Err == "" {
+            t.Errorf("error %d: %+v, want line %d", i, e, wantLines[i])
+        }
+    }
+}
+
+func TestBulkAddRecords(t *testing.T) {
+    s, r := newTestWeb(t)
+    sid := "bulk-session"
+    s.sessions[sid] = &Session{Username: "admin", CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour), CSRFToken: "csrf"}
+
+    zone := dbm.Zone{Name: "web-bulk.test."}
+    if err := s.db.Create(&zone).Error; err != nil {
+        t.Fatalf("create zone: %v", err)
+    }
+    id := strconv.Itoa(int(zone.ID))
+    // Leave the shared in-memory DB clean for other tests
+    defer func() {
+        dbm.TrashZone(s.db, zone.ID)
+        dbm.PurgeZone(s.db, zone.ID)
+    }()
+
+    post := func(text string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest("POST", "/admin/zones/"+id+"/records/bulk", strings.NewReader(url.Values{"records": {text}}.Encode()))
+        req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+        req.AddCookie(&http.Cookie{Name: "session", Value: sid, Path: "/admin"})
+        req.AddCookie(&http.Cookie{Name: "lang", Value: "en", Path: "/"})
+        req.Header.Set("X-CSRF-Token", "csrf")
+        req.Header.Set("Origin", "http://example.com")
+        w := httptest.NewRecorder()
+        r.ServeHTTP(w, req)
+        return w
+    }
+    countRecords := func() int64 {
+        var n int64
+        s.db.Model(&dbm.RData{}).Joins("JOIN rr_sets ON rr_sets.id = r_data.rr_set_id").Where("rr_sets.zone_id = ?", zone.ID).Count(&n)
+        return n
+    }
+
+    // One bad line rejects the whole paste
+    w := post("www A 300 192.0.2.1\nwww A 300 nope\n")
+    if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Line 2") || w.Header().Get("HX-Retarget") != "" {
+        t.Fatalf("expected inline error for line 2: %d %s", w.Code, w.Body.String())
+    }
+    if n := countRecords(); n != 0 {
+        t.Fatalf("rejected paste wrote %d records", n)
+    }
+
+    w = post("www A 300 192.0.2.1\nwww A 300 192.0.2.2\nwww A 300 192.0.2.1\n@ MX 300 10 mail\n")
+    if w.Code != http.StatusOK || w.Header().Get("HX-Retarget") != "#zones-list" {
+        t.Fatalf("bulk add: %d %s", w.Code, w.Body.String())
+    }
+    if n := countRecords(); n != 3 {
+        t.Fatalf("expected 3 records (duplicate skipped), got %d", n)
+    }
+    var sets int64
+    s.db.Model(&dbm.RRSet{}).Where("zone_id = ?", zone.ID).Count(&sets)
+    if sets != 2 {
+        t.Fatalf("expected 2 rrsets, got %d", sets)
+    }
+}
@@ -0,0 +1,139 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/db"
+)
+
+// loadRecordRow loads a record with its RRSet and zone for the inline editor.
+func (s *Server) loadRecordRow(c *gin.Context) (db.RData, db.RRSet, db.Zone, bool) {
+	var record db.RData
+	var rrset db.RRSet
+	var zone db.Zone
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.String(http.StatusBadRequest, s.tr(c, "Invalid record ID"))
+		return record, rrset, zone, false
+	}
+	if err := s.db.First(&record, id).Error; err != nil {
+		c.String(http.StatusNotFound, s.tr(c, "Record not found"))
+		return record, rrset, zone, false
+	}
+	if err := s.db.First(&rrset, record.RRSetID).Error; err != nil {
+		c.String(http.StatusNotFound, s.tr(c, "RRSet not found"))
+		return record, rrset, zone, false
+	}
+	if err := s.db.First(&zone, rrset.ZoneID).Error; err != nil {
+		c.String(http.StatusNotFound, s.tr(c, "Zone not found"))
+		return record, rrset, zone, false
+	}
+	return record, rrset, zone, true
+}
+
+// inlineRecordRow returns the display row of a record (used by Cancel).
+func (s *Server) inlineRecordRow(c *gin.Context) {
+	record, rrset, _, ok := s.loadRecordRow(c)
+	if !ok {
+		return
+	}
+	s.renderRecordRow(c, rrset, record, c.Request.URL.RawQuery)
+}
+
+func (s *Server) inlineRecordForm(c *gin.Context) {
+	record, rrset, _, ok := s.loadRecordRow(c)
+	if !ok {
+		return
+	}
+	s.renderInlineForm(c, rrset, record, strconv.Itoa(int(rrset.TTL)), record.Data, "")
+}
+
+// renderInlineForm renders the row as a small form for TTL and Data.
+func (s *Server) renderInlineForm(c *gin.Context, rrset db.RRSet, record db.RData, ttl, data, errMsg string) {
+	s.render(c, http.StatusOK, "record_inline_form", gin.H{
+		"Row":       s.recordView(c, rrset, record),
+		"TTL":       ttl,
+		"Data":      data,
+		"Error":     errMsg,
+		"ListQuery": c.Request.URL.RawQuery,
+	})
+}
+
+// updateRecordInline saves TTL and Data from the inline editor. Errors are
+// shown in the row. TTL belongs to the RRSet, so if it changed for a set with
+// other records the whole list is reloaded to show the new TTL everywhere.
+func (s *Server) updateRecordInline(c *gin.Context) {
+	record, rrset, zone, ok := s.loadRecordRow(c)
+	if !ok {
+		return
+	}
+	ttlStr := strings.TrimSpace(c.PostForm("ttl"))
+	data := strings.TrimSpace(c.PostForm("data"))
+	fail := func(msg string) {
+		s.renderInlineForm(c, rrset, record, ttlStr, data, msg)
+	}
+
+	ttl, err := strconv.ParseUint(ttlStr, 10, 32)
+	if err != nil || ttl == 0 {
+		fail(s.tr(c, "TTL must be a positive number"))
+		return
+	}
+	if msg := s.ttlLimitError(c, uint32(ttl)); msg != "" {
+		fail(msg)
+		return
+	}
+	if data == "" {
+		fail(s.tr(c, "Data is required"))
+		return
+	}
+	if strings.EqualFold(rrset.Type, "CNAME") && data == "@" {
+		data = toFQDN("@", zone.Name)
+	}
+	if strings.EqualFold(rrset.Type, "MX") {
+		data = combineMXData(data, 10, zone.Name)
+	}
+	if err := validateRecord(rrset.Name, rrset.Type, uint32(ttl), data); err != nil {
+		fail(err.Error())
+		return
+	}
+
+	record.Data = data
+	if db.HasDuplicateRecord(s.db, record) {
+		fail(s.tr(c, "This record already exists"))
+		return
+	}
+	if err := s.dbFor(c).Save(&record).Error; err != nil {
+		fail(s.trf(c, "Error updating record: %s", err.Error()))
+		return
+	}
+	ttlChanged := uint32(ttl) != rrset.TTL
+	if ttlChanged {
+		if err := s.db.Model(&rrset).Update("ttl", uint32(ttl)).Error; err != nil {
+			fail(s.trf(c, "Error updating TTL: %s", err.Error()))
+			return
+		}
+	}
+	s.audit(c, db.AuditRecordUpdate, zone, rrset.ID, recordSummary(rrset, record.Data))
+
+	// Ensure SOA exists/updated after change
+	db.TouchZone(s.db, zone, s.cfg)
+
+	var siblings int64
+	s.db.Model(&db.RData{}).Where("rr_set_id = ?", rrset.ID).Count(&siblings)
+	if ttlChanged && siblings > 1 {
+		for i := range c.Params {
+			if c.Params[i].Key == "id" {
+				c.Params[i].Value = strconv.Itoa(int(zone.ID))
+			}
+		}
+		c.Header("HX-Retarget", "#zones-list")
+		c.Header("HX-Reswap", "innerHTML")
+		s.listRecords(c)
+		return
+	}
+	s.renderRecordRow(c, rrset, record, c.Request.URL.RawQuery)
+}
@@ -0,0 +1,84 @@
+package web
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+
+    dbm "namedot/internal/db"
+)
+
+func TestInlineRecordEdit(t *testing.T) {
+    s, r := newTestWeb(t)
+    sid := "inline-session"
+    s.sessions[sid] = &Session{Username: "admin", CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour), CSRFToken: "csrf"}
+
+    zone := dbm.Zone{Name: "web-inline.test.", RRSets: []dbm.RRSet{
+        {Name: "www.web-inline.test.", Type: "A", TTL: 300, Records: []dbm.RData{{Data: "192.0.2.1"}}},
+        {Name: "multi.web-inline.test.", Type: "A", TTL: 300, Records: []dbm.RData{{Data: "192.0.2.10"}, {Data: "192.0.2.11"}}},
+    }}
+    if err := s.db.Create(&zone).Error; err != nil {
+        t.Fatalf("create zone: %v", err)
+    }
+    // Leave the shared in-memory DB clean for other tests
+    defer func() {
+        dbm.TrashZone(s.db, zone.ID)
+        dbm.PurgeZone(s.db, zone.ID)
+    }()
+    single := zone.RRSets[0].Records[0]
+    multi := zone.RRSets[1].Records[0]
+
+    do := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+        var req *http.Request
+        if form != nil {
+            req = httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+            req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+        } else {
+            req = httptest.NewRequest(method, path, nil)
+        }
+        req.AddCookie(&http.Cookie{Name: "session", Value: sid, Path: "/admin"})
+        req.AddCookie(&http.Cookie{Name: "lang", Value: "en", Path: "/"})
+        req.Header.Set("X-CSRF-Token", "csrf")
+        req.Header.Set("Origin", "http://example.com")
+        w := httptest.NewRecorder()
+        r.ServeHTTP(w, req)
+        return w
+    }
+    path := "/admin/records/" + strconv.Itoa(int(single.ID)) + "/inline?page=1"
+
+    w := do("GET", path, nil)
+    if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `name="data" value="192.0.2.1"`) || !strings.Contains(w.Body.String(), "hx-put") {
+        t.Fatalf("inline form: %d %s", w.Code, w.Body.String())
+    }
+
+    // Invalid data keeps the editor open with the error
+    w = do("PUT", path, url.Values{"ttl": {"600"}, "data": {"not-an-ip"}})
+    if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "hx-put") || !strings.Contains(w.Body.String(), `class="error"`) {
+        t.Fatalf("expected inline error: %d %s", w.Code, w.Body.String())
+    }
+
+    w = do("PUT", path, url.Values{"ttl": {"600"}, "data": {"192.0.2.2"}})
+    if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "hx-put") || !strings.Contains(w.Body.String(), "192.0.2.2") {
+        t.Fatalf("inline save: %d %s", w.Code, w.Body.String())
+    }
+    if w.Header().Get("HX-Retarget") != "" {
+        t.Fatal("single-record RRSet should only swap the row")
+    }
+    var rec dbm.RData
+    s.db.First(&rec, single.ID)
+    var set dbm.RRSet
+    s.db.First(&set, rec.RRSetID)
+    if rec.Data != "192.0.2.2" || set.TTL != 600 {
+        t.Fatalf("not saved: data %q ttl %d", rec.Data, set.TTL)
+    }
+
+    // TTL change on a shared RRSet reloads the list
+    w = do("PUT", "/admin/records/"+strconv.Itoa(int(multi.ID))+"/inline", url.Values{"ttl": {"900"}, "data": {"192.0.2.10"}})
+    if w.Code != http.StatusOK || w.Header().Get("HX-Retarget") != "#zones-list" || !strings.Contains(w.Body.String(), "Records for web-inline.test.") {
+        t.Fatalf("shared TTL change: %d %q %s", w.Code, w.Header().Get("HX-Retarget"), w.Body.String())
+    }
+}
@@ -0,0 +1,71 @@
+package web
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+
+    dbm "namedot/internal/db"
+)
+
+func TestDeleteRecord_ThenAddAgain(t *testing.T) {
+    s, r := newTestWeb(t)
+    sid := "delete-record-session"
+    s.sessions[sid] = &Session{Username: "admin", CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour), CSRFToken: "csrf"}
+
+    zone := dbm.Zone{Name: "web-readd.test."}
+    if err := s.db.Create(&zone).Error; err != nil {
+        t.Fatalf("create zone: %v", err)
+    }
+    // Leave the shared in-memory DB clean for other tests
+    defer func() {
+        dbm.TrashZone(s.db, zone.ID)
+        dbm.PurgeZone(s.db, zone.ID)
+    }()
+    zoneID := strconv.Itoa(int(zone.ID))
+
+    do := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+        var req *http.Request
+        if form != nil {
+            req = httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+            req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+        } else {
+            req = httptest.NewRequest(method, path, nil)
+        }
+        req.AddCookie(&http.Cookie{Name: "session", Value: sid, Path: "/admin"})
+        req.AddCookie(&http.Cookie{Name: "lang", Value: "en", Path: "/"})
+        req.Header.Set("X-CSRF-Token", "csrf")
+        req.Header.Set("Origin", "http://example.com")
+        w := httptest.NewRecorder()
+        r.ServeHTTP(w, req)
+        return w
+    }
+    add := func() {
+        t.Helper()
+        w := do("POST", "/admin/zones/"+zoneID+"/records", url.Values{"name": {"www"}, "type": {"A"}, "ttl": {"300"}, "data": {"192.0.2.10"}})
+        // Form errors come back with the form and status 200
+        if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "Error creating record") {
+            t.Fatalf("add record: %d %s", w.Code, w.Body.String())
+        }
+    }
+
+    add()
+    var rec dbm.RData
+    if err := s.db.Joins("JOIN rr_sets ON rr_sets.id = r_data.rr_set_id").Where("rr_sets.zone_id = ?", zone.ID).First(&rec).Error; err != nil {
+        t.Fatalf("record: %v", err)
+    }
+    if w := do("DELETE", "/admin/records/"+strconv.Itoa(int(rec.ID)), nil); w.Code != http.StatusOK {
+        t.Fatalf("delete record: %d %s", w.Code, w.Body.String())
+    }
+    // The deleted row must not block the same record in the unique index
+    add()
+    var n int64
+    s.db.Model(&dbm.RData{}).Where("data = ? AND rr_set_id = ?", "192.0.2.10", rec.RRSetID).Count(&n)
+    if n != 1 {
+        t.Fatalf("expected 1 stored record, got %d", n)
+    }
+}
@@ -0,0 +1,264 @@
+package web
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/db"
+	"namedot/internal/geoip"
+)
+
+// recordInput is the raw input of the new/edit record form.
+type recordInput struct {
+	Name       string
+	Type       string
+	TTL        string
+	Data       string
+	MXPriority string
+	Country    string
+	Continent  string
+	ASN        string
+	Subnet     string
+	Weight     string
+	Check      string // health check
+	Backup     bool
+}
+
+func recordInputFromForm(c *gin.Context) recordInput {
+	return recordInput{
+		Name:       strings.TrimSpace(c.PostForm("name")),
+		Type:       strings.ToUpper(strings.TrimSpace(c.PostForm("type"))),
+		TTL:        strings.TrimSpace(c.PostForm("ttl")),
+		Data:       strings.TrimSpace(c.PostForm("data")),
+		MXPriority: strings.TrimSpace(c.PostForm("mx_priority")),
+		Country:    strings.ToUpper(strings.TrimSpace(c.PostForm("country"))),
+		Continent:  strings.ToUpper(strings.TrimSpace(c.PostForm("continent"))),
+		ASN:        strings.TrimSpace(c.PostForm("asn")),
+		Subnet:     strings.TrimSpace(c.PostForm("subnet")),
+		Weight:     strings.TrimSpace(c.PostForm("weight")),
+		Check:      strings.TrimSpace(c.PostForm("health_check")),
+		Backup:     c.PostForm("backup") != "",
+	}
+}
+
+func (in recordInput) formData() gin.H {
+	return gin.H{
+		"Name":       in.Name,
+		"Type":       in.Type,
+		"TTL":        in.TTL,
+		"Data":       in.Data,
+		"MXPriority": in.MXPriority,
+		"Country":    in.Country,
+		"Continent":  in.Continent,
+		"ASN":        in.ASN,
+		"Subnet":     in.Subnet,
+		"Weight":     in.Weight,
+		"Check":      in.Check,
+		"Backup":     in.Backup,
+	}
+}
+
+// recordTypeOption is one entry of the type select of the record form. The
+// browser applies Pattern and Placeholder to the data field; the server
+// checks the same rules in validateRecordInput.
+type recordTypeOption struct {
+	Value       string
+	Label       string
+	Placeholder string
+	Pattern     string
+	Hint        string
+}
+
+const (
+	ipv4Pattern     = `((25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\.){3}(25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)`
+	ipv6Pattern     = `[0-9A-Fa-f:.]*:[0-9A-Fa-f:.]*`
+	hostnamePattern = `@|[A-Za-z0-9_]([A-Za-z0-9_\-]*[A-Za-z0-9_])?(\.[A-Za-z0-9_]([A-Za-z0-9_\-]*[A-Za-z0-9_])?)*\.?`
+)
+
+var recordTypeOptions = []recordTypeOption{
+	{Value: "A", Label: "A - IPv4 Address", Placeholder: "192.0.2.1", Pattern: ipv4Pattern, Hint: "Enter a valid IPv4 address"},
+	{Value: "AAAA", Label: "AAAA - IPv6 Address", Placeholder: "2001:db8::1", Pattern: ipv6Pattern, Hint: "Enter a valid IPv6 address"},
+	{Value: "CNAME", Label: "CNAME - Canonical Name", Placeholder: "target.example.com.", Pattern: hostnamePattern, Hint: "Enter a valid hostname"},
+	{Value: "MX", Label: "MX - Mail Exchange", Placeholder: "mail.example.com.", Pattern: `(\d+\s+)?(` + hostnamePattern + `)`, Hint: "Enter a valid hostname"},
+	{Value: "TXT", Label: "TXT - Text Record", Placeholder: `"v=spf1 -all"`},
+	{Value: "NS", Label: "NS - Name Server", Placeholder: "ns1.example.com.", Pattern: hostnamePattern, Hint: "Enter a valid hostname"},
+	{Value: "SRV", Label: "SRV - Service Record", Placeholder: "10 5 5060 sip.example.com.", Pattern: `\d+\s+\d+\s+\d+\s+\S+`, Hint: "Priority, weight, port and target"},
+	{Value: "PTR", Label: "PTR - Pointer Record", Placeholder: "host.example.com.", Pattern: hostnamePattern, Hint: "Enter a valid hostname"},
+	{Value: "CAA", Label: "CAA - Certificate Authority", Placeholder: `0 issue "letsencrypt.org"`, Pattern: `\d+\s+\S+\s+.+`, Hint: "Flags, tag and value"},
+	{Value: "SOA", Label: "SOA - Start of Authority", Placeholder: "ns1.example.com. hostmaster.example.com. 1 7200 3600 1209600 300"},
+}
+
+func recordTypeHint(typ string) recordTypeOption {
+	for _, opt := range recordTypeOptions {
+		if opt.Value == typ {
+			return opt
+		}
+	}
+	return recordTypeOption{Value: typ}
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+// isHostname reports whether h is a host name made of letters, digits,
+// hyphens and underscores, with or without the trailing dot.
+func isHostname(h string) bool {
+	h = strings.TrimSuffix(h, ".")
+	if h == "" || len(h) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(h, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// validateRecordInput checks the record form for zoneName and returns a
+// translated message per form field; an empty map means the input is valid.
+func (s *Server) validateRecordInput(c *gin.Context, in recordInput, zoneName string) map[string]string {
+	errs := map[string]string{}
+
+	if in.Name == "" {
+		errs["name"] = s.tr(c, "This field is required")
+	} else {
+		fqdn := toFQDN(in.Name, zoneName)
+		zone := strings.ToLower(strings.TrimSuffix(zoneName, "."))
+		if !isHostname(strings.TrimPrefix(fqdn, "*.")) {
+			errs["name"] = s.tr(c, "Name is not a valid domain name")
+		} else if fqdn != zone+"." && !strings.HasSuffix(fqdn, "."+zone+".") {
+			errs["name"] = s.trf(c, "Name must be inside the zone %s", zoneName)
+		}
+	}
+
+	ttl := uint64(300)
+	if in.TTL != "" {
+		n, err := strconv.ParseUint(in.TTL, 10, 32)
+		if err != nil || n == 0 {
+			errs["ttl"] = s.tr(c, "TTL must be a positive number")
+		} else {
+			ttl = n
+		}
+	}
+	if msg := s.ttlLimitError(c, uint32(ttl)); msg != "" && errs["ttl"] == "" {
+		errs["ttl"] = msg
+	}
+
+	if !contains(recordTypeValues(), in.Type) {
+		errs["type"] = s.tr(c, "Unknown record type")
+	}
+
+	switch data := in.Data; {
+	case data == "":
+		errs["data"] = s.tr(c, "This field is required")
+	case errs["type"] != "":
+	case in.Type == "A":
+		if ip := net.ParseIP(data); ip == nil || ip.To4() == nil {
+			errs["data"] = s.tr(c, "Enter a valid IPv4 address")
+		}
+	case in.Type == "AAAA":
+		if ip := net.ParseIP(data); ip == nil || ip.To4() != nil {
+			errs["data"] = s.tr(c, "Enter a valid IPv6 address")
+		}
+	case in.Type == "CNAME" || in.Type == "NS" || in.Type == "PTR":
+		if data != "@" && !isHostname(data) {
+			errs["data"] = s.tr(c, "Enter a valid hostname")
+		}
+	case in.Type == "MX":
+		if _, target := splitMXData(data); target != "@" && !isHostname(target) {
+			errs["data"] = s.tr(c, "Enter a valid hostname")
+		}
+	default:
+		if err := validateRecord(toFQDN(in.Name, zoneName), in.Type, uint32(ttl), data); err != nil {
+			errs["data"] = err.Error()
+		}
+	}
+
+	if in.Type == "MX" && in.MXPriority != "" {
+		if p, err := strconv.Atoi(in.MXPriority); err != nil || p < 0 || p > 65535 {
+			errs["mx_priority"] = s.tr(c, "MX priority must be between 0 and 65535")
+		}
+	}
+	if in.Country != "" && geoip.CheckCountry(in.Country) != nil {
+		errs["country"] = s.tr(c, "Use a two-letter ISO 3166 country code")
+	}
+	if in.Continent != "" && geoip.CheckContinent(in.Continent) != nil {
+		errs["continent"] = s.tr(c, "Unknown continent code")
+	}
+	if in.ASN != "" {
+		if _, err := db.NormalizeASNs(in.ASN); err != nil {
+			errs["asn"] = s.tr(c, "Enter ASNs or ranges, e.g. 3320, 64512-65534")
+		}
+	}
+	if in.Subnet != "" {
+		if _, _, err := net.ParseCIDR(in.Subnet); err != nil {
+			errs["subnet"] = s.tr(c, "Enter a subnet in CIDR notation, e.g. 10.0.0.0/8")
+		}
+	}
+	if in.Weight != "" {
+		if _, err := strconv.ParseUint(in.Weight, 10, 32); err != nil {
+			errs["weight"] = s.tr(c, "Weight must be a whole number of 0 or more")
+		}
+	}
+	if in.Check != "" {
+		if hc, err := db.ParseHealthCheck(in.Check); err != nil {
+			errs["health_check"] = s.tr(c, "Enter a check like tcp://:443, http://:8080/healthz or icmp")
+		} else if _, err := hc.Target(in.Type, in.Data); err != nil && errs["data"] == "" {
+			errs["health_check"] = s.tr(c, "A check without a host needs an A or AAAA record")
+		}
+	}
+	return errs
+}
+
+// ttlLimitError returns the translated message for a TTL outside
+// record_ttl, or "" when ttl is within it.
+func (s *Server) ttlLimitError(c *gin.Context, ttl uint32) string {
+	limits := s.cfg.RecordTTL
+	switch {
+	case ttl < limits.Min:
+		return s.trf(c, "TTL must be at least %d seconds", limits.Min)
+	case limits.Max > 0 && ttl > limits.Max:
+		return s.trf(c, "TTL must be at most %d seconds", limits.Max)
+	}
+	return ""
+}
+
+func recordTypeValues() []string {
+	values := make([]string, 0, len(recordTypeOptions))
+	for _, opt := range recordTypeOptions {
+		values = append(values, opt.Value)
+	}
+	return values
+}
+
+// renderRecordForm renders the new/edit record form. With errors the form
+// replaces itself instead of the records list, keeping the user's input.
+func (s *Server) renderRecordForm(c *gin.Context, data gin.H, errs map[string]string) {
+	typ, _ := data["Type"].(string)
+	data["Types"] = recordTypeOptions
+	data["Continents"] = geoip.Continents
+	data["Countries"] = geoip.Countries
+	data["DataHint"] = recordTypeHint(typ)
+	data["Errors"] = errs
+	if len(errs) > 0 {
+		c.Header("HX-Retarget", "#record-form")
+		c.Header("HX-Reswap", "outerHTML")
+	}
+	s.render(c, http.StatusOK, "record_form", data)
+}
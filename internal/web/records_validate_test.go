@@ -0,0 +1,123 @@
+package web
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+
+    "namedot/internal/config"
+    dbm "namedot/internal/db"
+)
+
+func TestRecordFormValidation(t *testing.T) {
+    s, r := newTestWeb(t)
+    sid := "validate-session"
+    s.sessions[sid] = &Session{Username: "admin", CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour), CSRFToken: "csrf"}
+
+    zone := dbm.Zone{Name: "web-validate.test."}
+    if err := s.db.Create(&zone).Error; err != nil {
+        t.Fatalf("create zone: %v", err)
+    }
+    defer func() {
+        dbm.TrashZone(s.db, zone.ID)
+        dbm.PurgeZone(s.db, zone.ID)
+    }()
+    zoneID := strconv.Itoa(int(zone.ID))
+    s.cfg.RecordTTL = config.RecordTTLConfig{Max: 86400}
+
+    do := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+        req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+        req.AddCookie(&http.Cookie{Name: "session", Value: sid, Path: "/admin"})
+        req.AddCookie(&http.Cookie{Name: "lang", Value: "en", Path: "/"})
+        req.Header.Set("X-CSRF-Token", "csrf")
+        req.Header.Set("Origin", "http://example.com")
+        w := httptest.NewRecorder()
+        r.ServeHTTP(w, req)
+        return w
+    }
+
+    cases := []struct {
+        form  url.Values
+        field string
+        msg   string
+    }{
+        {url.Values{"name": {"www"}, "type": {"A"}, "ttl": {"300"}, "data": {"2001:db8::1"}}, "data", "Enter a valid IPv4 address"},
+        {url.Values{"name": {"www"}, "type": {"AAAA"}, "ttl": {"300"}, "data": {"192.0.2.1"}}, "data", "Enter a valid IPv6 address"},
+        {url.Values{"name": {"www"}, "type": {"CNAME"}, "ttl": {"300"}, "data": {"not a host"}}, "data", "Enter a valid hostname"},
+        {url.Values{"name": {"@"}, "type": {"MX"}, "ttl": {"300"}, "data": {"-mail"}, "mx_priority": {"10"}}, "data", "Enter a valid hostname"},
+        {url.Values{"name": {"www"}, "type": {"A"}, "ttl": {"0"}, "data": {"192.0.2.1"}}, "ttl", "TTL must be a positive number"},
+        {url.Values{"name": {"www"}, "type": {"A"}, "ttl": {"2592000"}, "data": {"192.0.2.1"}}, "ttl", "TTL must be at most 86400 seconds"},
+        {url.Values{"name": {"www.other.test."}, "type": {"A"}, "ttl": {"300"}, "data": {"192.0.2.1"}}, "name", "Name must be inside the zone web-validate.test."},
+        {url.Values{"name": {"www"}, "type": {"A"}, "ttl": {"300"}, "data": {"192.0.2.1"}, "country": {"XX"}}, "country", "Use a two-letter ISO 3166 country code"},
+        {url.Values{"name": {"www"}, "type": {"A"}, "ttl": {"300"}, "data": {"192.0.2.1"}, "continent": {"EA"}}, "continent", "Unknown continent code"},
+        {url.Values{"name": {"www"}, "type": {"A"}, "ttl": {"300"}, "data": {"192.0.2.1"}, "subnet": {"10.0.0.0"}}, "subnet", "Enter a subnet in CIDR notation"},
+        {url.Values{"name": {"www"}, "type": {"A"}, "ttl": {"300"}, "data": {"192.0.2.1"}, "weight": {"-1"}}, "weight", "Weight must be a whole number of 0 or more"},
+    }
+    for _, tc := range cases {
+        w := do("POST", "/admin/zones/"+zoneID+"/records", tc.form)
+        body := w.Body.String()
+        if w.Code != http.StatusOK || w.Header().Get("HX-Retarget") != "#record-form" {
+            t.Fatalf("%s: invalid input should re-render the form: %d %q", tc.field, w.Code, w.Header().Get("HX-Retarget"))
+        }
+        if !strings.Contains(body, `class="field-error"`) || !strings.Contains(body, tc.msg) {
+            t.Fatalf("%s: expected %q next to the field: %s", tc.field, tc.msg, body)
+        }
+        if !strings.Contains(body, `value="`+tc.form.Get("data")+`"`) {
+            t.Fatalf("%s: submitted data should be kept: %s", tc.field, body)
+        }
+    }
+    var count int64
+    s.db.Model(&dbm.RRSet{}).Where("zone_id = ?", zone.ID).Count(&count)
+    if count != 0 {
+        t.Fatalf("invalid input created %d RRSets", count)
+    }
+
+    w := do("POST", "/admin/zones/"+zoneID+"/records", url.Values{"name": {"www"}, "type": {"A"}, "ttl": {"300"}, "data": {"192.0.2.1"}, "country": {"de"}, "subnet": {"10.0.0.0/8"}})
+    if w.Code != http.StatusOK || w.Header().Get("HX-Retarget") != "" || !strings.Contains(w.Body.String(), "Records for web-validate.test.") {
+        t.Fatalf("valid record should reload the list: %d %s", w.Code, w.Body.String())
+    }
+    var rec dbm.RData
+    if err := s.db.Joins("JOIN rr_sets ON rr_sets.id = r_data.rr_set_id").Where("rr_sets.zone_id = ?", zone.ID).First(&rec).Error; err != nil {
+        t.Fatalf("record not created: %v", err)
+    }
+    if rec.Country == nil || *rec.Country != "DE" {
+        t.Fatalf("country should be stored upper-case: %v", rec.Country)
+    }
+
+    // Edit keeps the record on invalid input and reloads this zone's list on success
+    recID := strconv.Itoa(int(rec.ID))
+    w = do("PUT", "/admin/records/"+recID, url.Values{"ttl": {"300"}, "data": {"192.0.2.300"}})
+    if w.Header().Get("HX-Retarget") != "#record-form" || !strings.Contains(w.Body.String(), "Enter a valid IPv4 address") {
+        t.Fatalf("invalid edit should show the field error: %s", w.Body.String())
+    }
+    w = do("PUT", "/admin/records/"+recID, url.Values{"ttl": {"600"}, "data": {"192.0.2.2"}})
+    if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Records for web-validate.test.") {
+        t.Fatalf("valid edit should reload the list: %d %s", w.Code, w.Body.String())
+    }
+    s.db.First(&rec, rec.ID)
+    if rec.Data != "192.0.2.2" {
+        t.Fatalf("data = %q, want 192.0.2.2", rec.Data)
+    }
+}
+
+func TestIsHostname(t *testing.T) {
+    for h, want := range map[string]bool{
+        "mail":              true,
+        "mail.example.com.": true,
+        "_sip._tcp.example": true,
+        "-bad.example.":     false,
+        "bad-.example.":     false,
+        "two words":         false,
+        "a..b":              false,
+        "":                  false,
+    } {
+        if got := isHostname(h); got != want {
+            t.Errorf("isHostname(%q) = %v, want %v", h, got, want)
+        }
+    }
+}
@@ -0,0 +1,131 @@
+package web
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// templateFuncs are available in all admin templates.
+var templateFuncs = template.FuncMap{
+	// Usage in templates: {{ t .Lang "Key" }}
+	"t": func(lang, key string) string { return tr(lang, key) },
+	// Usage in templates: {{ tf .Lang "Page %d of %d" .Page .Total }}
+	"tf": func(lang, key string, a ...any) string { return trf(lang, key, a...) },
+	// languages lists the languages with a catalog for the language selector
+	"languages": func() []language { return languages },
+	// dict builds the data for a nested template: {{ template "x" (dict "Lang" $.Lang "Row" .) }}
+	"dict": func(kv ...any) (map[string]any, error) {
+		if len(kv)%2 != 0 {
+			return nil, errors.New("dict: odd number of arguments")
+		}
+		m := make(map[string]any, len(kv)/2)
+		for i := 0; i < len(kv); i += 2 {
+			k, ok := kv[i].(string)
+			if !ok {
+				return nil, errors.New("dict: keys must be strings")
+			}
+			m[k] = kv[i+1]
+		}
+		return m, nil
+	},
+}
+
+// render executes the named template into a buffer, so a template error
+// results in a clean 500 instead of a half-written fragment. The request
+// language is passed to the template as .Lang, and .ReadOnly tells the
+// templates to leave out edit controls for viewers and while the server is
+// read-only.
+func (s *Server) render(c *gin.Context, status int, name string, data gin.H) {
+	if data == nil {
+		data = gin.H{}
+	}
+	data["Lang"] = s.getLang(c)
+	serverRO, _ := s.serverReadOnly()
+	data["ReadOnly"] = s.readOnly(c) || serverRO
+	var buf bytes.Buffer
+	if err := s.tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+		log.Printf("web: render %s: %v", name, err)
+		c.String(http.StatusInternalServerError, s.tr(c, "Error rendering page"))
+		return
+	}
+	c.Data(status, "text/html; charset=utf-8", buf.Bytes())
+}
+
+// renderError renders msg in the shared error box.
+func (s *Server) renderError(c *gin.Context, status int, msg string) {
+	s.render(c, status, "error", gin.H{"Error": msg})
+}
+
+// pageLink is one entry of the pagination bar: a page number or a gap.
+type pageLink struct {
+	N       int
+	Current bool
+	Gap     bool
+}
+
+// pagination is the data for the "pagination" partial. URL is the list URL
+// with its filters; the page number is appended as &page=N.
+type pagination struct {
+	URL        string
+	Target     string // element the pages are loaded into, #zones-list by default
+	Page       int
+	TotalPages int
+	Total      int64
+	Prev, Next int
+	Links      []pageLink
+}
+
+// newPagination shows the first and last page and two pages around the
+// current one, with gaps in between.
+func newPagination(url string, page, perPage int, total int64) pagination {
+	p := pagination{
+		URL:        url,
+		Page:       page,
+		TotalPages: int((total + int64(perPage) - 1) / int64(perPage)),
+		Total:      total,
+		Prev:       page - 1,
+		Next:       page + 1,
+	}
+	for i := 1; i <= p.TotalPages; i++ {
+		switch {
+		case i == page:
+			p.Links = append(p.Links, pageLink{N: i, Current: true})
+		case i == 1 || i == p.TotalPages || (i >= page-2 && i <= page+2):
+			p.Links = append(p.Links, pageLink{N: i})
+		case i == page-3 || i == page+3:
+			p.Links = append(p.Links, pageLink{Gap: true})
+		}
+	}
+	return p
+}
+
+// geoLabel describes the GeoIP selector of a record for the tables.
+func (s *Server) geoLabel(c *gin.Context, country, continent *string, asn *int, asns, subnet *string) string {
+	switch {
+	case country != nil && *country != "":
+		return s.trf(c, "Country: %s", *country)
+	case continent != nil && *continent != "":
+		return s.trf(c, "Continent: %s", *continent)
+	case asn != nil && *asn != 0:
+		return s.trf(c, "ASN: %d", *asn)
+	case asns != nil && *asns != "":
+		return s.trf(c, "ASNs: %s", *asns)
+	case subnet != nil && *subnet != "":
+		return s.trf(c, "Subnet: %s", *subnet)
+	}
+	return s.tr(c, "Default")
+}
+
+// deref returns the value of p, or the zero value if p is nil.
+func deref[T any](p *T) T {
+	var zero T
+	if p == nil {
+		return zero
+	}
+	return *p
+}
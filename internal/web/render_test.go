@@ -0,0 +1,80 @@
+package web
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+
+    dbm "namedot/internal/db"
+)
+
+func TestRender_EscapesRecordData(t *testing.T) {
+    s, r := newTestWeb(t)
+    sid := "render-session"
+    s.sessions[sid] = &Session{Username: "admin", CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour), CSRFToken: "csrf"}
+
+    zone := dbm.Zone{Name: "web-render.test."}
+    if err := s.db.Create(&zone).Error; err != nil {
+        t.Fatalf("create zone: %v", err)
+    }
+    defer func() {
+        dbm.TrashZone(s.db, zone.ID)
+        dbm.PurgeZone(s.db, zone.ID)
+    }()
+    rrset := dbm.RRSet{ZoneID: zone.ID, Name: "web-render.test.", Type: "TXT", TTL: 300}
+    if err := s.db.Create(&rrset).Error; err != nil {
+        t.Fatalf("create rrset: %v", err)
+    }
+    if err := s.db.Create(&dbm.RData{RRSetID: rrset.ID, Data: `"<script>alert(1)</script>"`}).Error; err != nil {
+        t.Fatalf("create record: %v", err)
+    }
+
+    req := httptest.NewRequest("GET", "/admin/zones/"+strconv.Itoa(int(zone.ID))+"/records?search=%22%3E%3Cb%3E", nil)
+    req.AddCookie(&http.Cookie{Name: "session", Value: sid, Path: "/admin"})
+    req.AddCookie(&http.Cookie{Name: "lang", Value: "en", Path: "/"})
+    w := httptest.NewRecorder()
+    r.ServeHTTP(w, req)
+
+    body := w.Body.String()
+    if w.Code != http.StatusOK {
+        t.Fatalf("records: status %d: %s", w.Code, body)
+    }
+    if strings.Contains(body, "<script>alert") || strings.Contains(body, `"><b>`) {
+        t.Fatalf("user data must be escaped: %s", body)
+    }
+    if !strings.Contains(body, `value="&#34;&gt;&lt;b&gt;"`) {
+        t.Fatalf("search value should be kept escaped: %s", body)
+    }
+
+    req = httptest.NewRequest("GET", "/admin/zones/"+strconv.Itoa(int(zone.ID))+"/records", nil)
+    req.AddCookie(&http.Cookie{Name: "session", Value: sid, Path: "/admin"})
+    w = httptest.NewRecorder()
+    r.ServeHTTP(w, req)
+    if body := w.Body.String(); !strings.Contains(body, "&lt;script&gt;alert(1)&lt;/script&gt;") {
+        t.Fatalf("record data should be shown escaped: %s", body)
+    }
+}
+
+func TestNewPagination(t *testing.T) {
+    p := newPagination("/admin/zones?search=", 5, 10, 95)
+    if p.TotalPages != 10 || p.Prev != 4 || p.Next != 6 {
+        t.Fatalf("unexpected pagination: %+v", p)
+    }
+    var got []string
+    for _, l := range p.Links {
+        switch {
+        case l.Gap:
+            got = append(got, "...")
+        case l.Current:
+            got = append(got, "["+strconv.Itoa(l.N)+"]")
+        default:
+            got = append(got, strconv.Itoa(l.N))
+        }
+    }
+    if want := "1 ... 3 4 [5] 6 7 ... 10"; strings.Join(got, " ") != want {
+        t.Fatalf("links = %q, want %q", strings.Join(got, " "), want)
+    }
+}
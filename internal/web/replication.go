@@ -0,0 +1,129 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/replication"
+)
+
+// syncNowTimeout bounds a manual sync started from the admin panel.
+const syncNowTimeout = 60 * time.Second
+
+// Replicator exposes the slave sync client to the admin panel.
+type Replicator interface {
+	Status() replication.Status
+	SyncOnce(ctx context.Context) error
+}
+
+// SlaveLister reports the slaves that pulled data from this master.
+type SlaveLister interface {
+	Slaves() []replication.Slave
+}
+
+// SetReplicator enables the slave sync status and the "Sync now" button.
+func (s *Server) SetReplicator(r Replicator) {
+	if s != nil {
+		s.replicator = r
+	}
+}
+
+// SetSlaveLister enables the list of slaves on a master.
+func (s *Server) SetSlaveLister(l SlaveLister) {
+	if s != nil {
+		s.slaveLister = l
+	}
+}
+
+func (s *Server) replicationStatus(c *gin.Context) {
+	s.renderReplication(c, "", false)
+}
+
+// syncNow runs one sync from the master and shows the refreshed status.
+func (s *Server) syncNow(c *gin.Context) {
+	if s.cfg.Replication.Mode != "slave" || s.replicator == nil {
+		s.renderReplication(c, s.tr(c, "Sync is only available on a slave"), true)
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), syncNowTimeout)
+	defer cancel()
+	if err := s.replicator.SyncOnce(ctx); err != nil {
+		s.renderReplication(c, s.trf(c, "Sync failed: %s", err.Error()), true)
+		return
+	}
+	s.renderReplication(c, s.tr(c, "Sync completed"), false)
+}
+
+// slaveView is one row of the slaves table on a master.
+type slaveView struct {
+	Name     string
+	Addr     string
+	LastSeen string
+	Zones    int
+}
+
+// syncView is the sync state of a slave.
+type syncView struct {
+	LastAttempt string
+	LastSuccess string
+	NotSynced   bool
+	LastError   string
+	Lag         string
+	Stale       bool
+	Zones       int
+	Templates   int
+}
+
+// renderReplication shows the replication role with, on a master, the slaves
+// that pulled data and, on a slave, the last sync result and lag.
+func (s *Server) renderReplication(c *gin.Context, msg string, isErr bool) {
+	when := func(t time.Time) string {
+		if t.IsZero() {
+			return s.tr(c, "never")
+		}
+		return fmt.Sprintf("%s (%s)", t.Local().Format("2006-01-02 15:04:05"), s.age(c, time.Since(t)))
+	}
+	interval := time.Duration(s.cfg.Replication.SyncIntervalSec) * time.Second
+	data := gin.H{
+		"Mode":      s.cfg.Replication.Mode,
+		"Message":   msg,
+		"IsError":   isErr,
+		"MasterURL": s.cfg.Replication.MasterURL,
+		"Interval":  interval.String(),
+	}
+
+	switch s.cfg.Replication.Mode {
+	case "master":
+		var slaves []slaveView
+		if s.slaveLister != nil {
+			for _, sl := range s.slaveLister.Slaves() {
+				slaves = append(slaves, slaveView{Name: sl.Name, Addr: sl.Addr, LastSeen: when(sl.LastSeen), Zones: sl.Zones})
+			}
+		}
+		data["Slaves"] = slaves
+	case "slave":
+		if s.replicator != nil {
+			st := s.replicator.Status()
+			v := &syncView{
+				LastAttempt: when(st.LastAttempt),
+				LastSuccess: when(st.LastSuccess),
+				NotSynced:   st.LastAttempt.IsZero(),
+				LastError:   st.LastError,
+				Zones:       st.Zones,
+				Templates:   st.Templates,
+			}
+			if !st.LastSuccess.IsZero() {
+				d := time.Since(st.LastSuccess).Truncate(time.Second)
+				v.Lag = d.String()
+				// Data older than two sync intervals means syncs are failing or stuck
+				v.Stale = interval > 0 && d > 2*interval
+			}
+			data["Status"] = v
+		}
+	}
+	s.render(c, http.StatusOK, "replication", data)
+}
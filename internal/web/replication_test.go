@@ -0,0 +1,92 @@
+package web
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "namedot/internal/replication"
+)
+
+type fakeReplicator struct {
+    st    replication.Status
+    err   error
+    syncs int
+}
+
+func (f *fakeReplicator) Status() replication.Status { return f.st }
+
+func (f *fakeReplicator) SyncOnce(ctx context.Context) error {
+    f.syncs++
+    f.st.LastAttempt = time.Now()
+    if f.err != nil {
+        f.st.LastError = f.err.Error()
+        return f.err
+    }
+    f.st.LastError, f.st.LastSuccess, f.st.Zones = "", f.st.LastAttempt, 7
+    return nil
+}
+
+func TestReplicationPage(t *testing.T) {
+    s, r := newTestWeb(t)
+    sid := "replication-session"
+    s.sessions[sid] = &Session{Username: "admin", CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour), CSRFToken: "csrf"}
+    defer func() {
+        s.cfg.Replication.Mode, s.cfg.Replication.MasterURL = "", ""
+        s.replicator, s.slaveLister = nil, nil
+    }()
+
+    do := func(method, path string) string {
+        req := httptest.NewRequest(method, path, nil)
+        req.AddCookie(&http.Cookie{Name: "session", Value: sid, Path: "/admin"})
+        req.AddCookie(&http.Cookie{Name: "lang", Value: "en", Path: "/"})
+        req.Header.Set("X-CSRF-Token", "csrf")
+        req.Header.Set("Origin", "http://example.com")
+        w := httptest.NewRecorder()
+        r.ServeHTTP(w, req)
+        if w.Code != http.StatusOK {
+            t.Fatalf("%s %s: %d %s", method, path, w.Code, w.Body.String())
+        }
+        return w.Body.String()
+    }
+
+    if body := do("GET", "/admin/replication"); !strings.Contains(body, "Replication is not configured") {
+        t.Fatalf("standalone: %s", body)
+    }
+
+    // Master lists the slaves that pulled data
+    s.cfg.Replication.Mode = "master"
+    tracker := replication.NewSlaveTracker()
+    tracker.Seen("192.0.2.53", "ns2.example.net", 12)
+    s.SetSlaveLister(tracker)
+    body := do("GET", "/admin/replication")
+    if !strings.Contains(body, "ns2.example.net") || !strings.Contains(body, "192.0.2.53") || !strings.Contains(body, "<td>12</td>") {
+        t.Fatalf("master: %s", body)
+    }
+    if body := do("POST", "/admin/replication/sync"); !strings.Contains(body, "only available on a slave") {
+        t.Fatalf("sync on master: %s", body)
+    }
+
+    // Slave shows the last result and can sync on demand
+    s.cfg.Replication.Mode = "slave"
+    s.cfg.Replication.MasterURL = "http://master:8080"
+    fr := &fakeReplicator{err: errors.New("master returned status 503")}
+    s.SetReplicator(fr)
+    body = do("GET", "/admin/replication")
+    if !strings.Contains(body, "http://master:8080") || !strings.Contains(body, "Not synced yet") || !strings.Contains(body, "Sync now") {
+        t.Fatalf("slave: %s", body)
+    }
+    body = do("POST", "/admin/replication/sync")
+    if fr.syncs != 1 || !strings.Contains(body, "Sync failed: master returned status 503") {
+        t.Fatalf("failed sync: %d %s", fr.syncs, body)
+    }
+    fr.err = nil
+    body = do("POST", "/admin/replication/sync")
+    if fr.syncs != 2 || !strings.Contains(body, "Sync completed") || !strings.Contains(body, "<td>7</td>") {
+        t.Fatalf("sync: %d %s", fr.syncs, body)
+    }
+}
@@ -0,0 +1,92 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"namedot/internal/db"
+)
+
+// loadRRSet loads the RRSet in the :id param together with its zone.
+func (s *Server) loadRRSet(c *gin.Context) (db.RRSet, db.Zone, bool) {
+	var rrset db.RRSet
+	var zone db.Zone
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.String(http.StatusBadRequest, s.tr(c, "Invalid RRSet ID"))
+		return rrset, zone, false
+	}
+	if err := s.db.First(&rrset, id).Error; err != nil {
+		c.String(http.StatusNotFound, s.tr(c, "RRSet not found"))
+		return rrset, zone, false
+	}
+	if err := s.db.First(&zone, rrset.ZoneID).Error; err != nil {
+		c.String(http.StatusNotFound, s.tr(c, "Zone not found"))
+		return rrset, zone, false
+	}
+	return rrset, zone, true
+}
+
+// updateRRSetTTL changes the TTL of all records of a set and reloads the
+// records list (the query string keeps its page and filters).
+func (s *Server) updateRRSetTTL(c *gin.Context) {
+	rrset, zone, ok := s.loadRRSet(c)
+	if !ok {
+		return
+	}
+	ttl, err := strconv.ParseUint(strings.TrimSpace(c.PostForm("ttl")), 10, 32)
+	if err != nil || ttl == 0 {
+		c.String(http.StatusBadRequest, s.tr(c, "TTL must be a positive number"))
+		return
+	}
+	if msg := s.ttlLimitError(c, uint32(ttl)); msg != "" {
+		c.String(http.StatusBadRequest, msg)
+		return
+	}
+	if old := rrset.TTL; uint32(ttl) != old {
+		if err := s.db.Model(&rrset).Update("ttl", uint32(ttl)).Error; err != nil {
+			c.String(http.StatusInternalServerError, s.trf(c, "Error updating TTL: %s", err.Error()))
+			return
+		}
+		// Ensure SOA exists/updated after change
+		db.TouchZone(s.db, zone, s.cfg)
+		s.audit(c, db.AuditRRSetUpdate, zone, rrset.ID, fmt.Sprintf("%s %s TTL %d -> %d", rrset.Name, rrset.Type, old, ttl))
+	}
+
+	for i := range c.Params {
+		if c.Params[i].Key == "id" {
+			c.Params[i].Value = strconv.Itoa(int(zone.ID))
+		}
+	}
+	s.listRecords(c)
+}
+
+// deleteRRSet removes a whole set with all its geo variants.
+func (s *Server) deleteRRSet(c *gin.Context) {
+	rrset, zone, ok := s.loadRRSet(c)
+	if !ok {
+		return
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Records are removed explicitly so this does not depend on foreign keys being enforced
+		if err := tx.Unscoped().Where("rr_set_id = ?", rrset.ID).Delete(&db.RData{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&db.RRSet{}, rrset.ID).Error
+	})
+	if err != nil {
+		c.String(http.StatusInternalServerError, s.tr(c, "Error deleting record set"))
+		return
+	}
+
+	// Ensure SOA exists/updated after change
+	db.TouchZone(s.db, zone, s.cfg)
+	s.audit(c, db.AuditRRSetDelete, zone, rrset.ID, rrset.Name+" "+rrset.Type)
+
+	c.Status(http.StatusOK)
+}
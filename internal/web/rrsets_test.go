@@ -0,0 +1,87 @@
+package web
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+
+    dbm "namedot/internal/db"
+)
+
+func TestRRSetGroupingAndActions(t *testing.T) {
+    s, r := newTestWeb(t)
+    sid := "rrset-session"
+    s.sessions[sid] = &Session{Username: "admin", CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour), CSRFToken: "csrf"}
+
+    de, us := "DE", "US"
+    zone := dbm.Zone{Name: "web-rrset.test.", RRSets: []dbm.RRSet{
+        {Name: "www.web-rrset.test.", Type: "A", TTL: 300, Records: []dbm.RData{
+            {Data: "192.0.2.1"}, {Data: "192.0.2.2", Country: &de}, {Data: "192.0.2.3", Country: &us},
+        }},
+        {Name: "mail.web-rrset.test.", Type: "A", TTL: 300, Records: []dbm.RData{{Data: "192.0.2.9"}}},
+    }}
+    if err := s.db.Create(&zone).Error; err != nil {
+        t.Fatalf("create zone: %v", err)
+    }
+    // Leave the shared in-memory DB clean for other tests
+    defer func() {
+        dbm.TrashZone(s.db, zone.ID)
+        dbm.PurgeZone(s.db, zone.ID)
+    }()
+    set := zone.RRSets[0]
+    setID := strconv.Itoa(int(set.ID))
+
+    do := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+        var req *http.Request
+        if form != nil {
+            req = httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+            req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+        } else {
+            req = httptest.NewRequest(method, path, nil)
+        }
+        req.AddCookie(&http.Cookie{Name: "session", Value: sid, Path: "/admin"})
+        req.AddCookie(&http.Cookie{Name: "lang", Value: "en", Path: "/"})
+        req.Header.Set("X-CSRF-Token", "csrf")
+        req.Header.Set("Origin", "http://example.com")
+        w := httptest.NewRecorder()
+        r.ServeHTTP(w, req)
+        return w
+    }
+
+    // One header per RRSet, one row per geo variant
+    w := do("GET", "/admin/zones/"+strconv.Itoa(int(zone.ID))+"/records", nil)
+    body := w.Body.String()
+    if w.Code != http.StatusOK || strings.Count(body, `class="rrset-head"`) != 2 || strings.Count(body, `class="rrset-record"`) != 4 {
+        t.Fatalf("records should be grouped by RRSet: %d %s", w.Code, body)
+    }
+    if !strings.Contains(body, `id="rrset-`+setID+`"`) || !strings.Contains(body, "3 record(s)") || !strings.Contains(body, "Country: DE") {
+        t.Fatalf("RRSet section should list its geo variants: %s", body)
+    }
+
+    if w := do("PUT", "/admin/rrsets/"+setID+"/ttl?page=1", url.Values{"ttl": {"0"}}); w.Code != http.StatusBadRequest {
+        t.Fatalf("invalid TTL: status %d", w.Code)
+    }
+    w = do("PUT", "/admin/rrsets/"+setID+"/ttl?page=1", url.Values{"ttl": {"900"}})
+    if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Records for web-rrset.test.") {
+        t.Fatalf("TTL change should reload the list: %d %s", w.Code, w.Body.String())
+    }
+    var got dbm.RRSet
+    s.db.First(&got, set.ID)
+    if got.TTL != 900 {
+        t.Fatalf("TTL = %d, want 900", got.TTL)
+    }
+
+    if w := do("DELETE", "/admin/rrsets/"+setID, nil); w.Code != http.StatusOK {
+        t.Fatalf("delete set: status %d", w.Code)
+    }
+    var sets, records int64
+    s.db.Unscoped().Model(&dbm.RRSet{}).Where("id = ?", set.ID).Count(&sets)
+    s.db.Unscoped().Model(&dbm.RData{}).Where("rr_set_id = ?", set.ID).Count(&records)
+    if sets != 0 || records != 0 {
+        t.Fatalf("set should be deleted with its records: %d sets, %d records left", sets, records)
+    }
+}
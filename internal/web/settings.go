@@ -0,0 +1,102 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/config"
+	"namedot/internal/db"
+)
+
+// forwarderNone is typed into the forwarder field to stop forwarding.
+const forwarderNone = "none"
+
+// settingsForm shows the runtime settings: the override, if any, next to the
+// value from the config file.
+func (s *Server) settingsForm(c *gin.Context) {
+	s.renderSettings(c, s.cfg.Overrides(), "", "")
+}
+
+// updateSettings saves the runtime overrides. A blank field falls back to
+// the config file.
+func (s *Server) updateSettings(c *gin.Context) {
+	var o config.Overrides
+	var errMsg string
+	num := func(field string) *uint32 {
+		v := strings.TrimSpace(c.PostForm(field))
+		if v == "" {
+			return nil
+		}
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			errMsg = s.trf(c, "%s must be a number", field)
+			return nil
+		}
+		u := uint32(n)
+		return &u
+	}
+	o.DefaultTTL = num("default_ttl")
+	o.NegativeTTL = num("negative_ttl")
+	switch c.PostForm("dns_verbose") {
+	case "on":
+		on := true
+		o.DNSVerbose = &on
+	case "off":
+		off := false
+		o.DNSVerbose = &off
+	}
+	if f := strings.TrimSpace(c.PostForm("forwarder")); f != "" {
+		if strings.EqualFold(f, forwarderNone) {
+			f = ""
+		}
+		o.Forwarder = &f
+	}
+	if errMsg == "" {
+		if err := s.cfg.CheckOverrides(o); err != nil {
+			errMsg = err.Error()
+		}
+	}
+	if errMsg == "" {
+		if err := db.SaveOverrides(s.db, o); err != nil {
+			errMsg = err.Error()
+		}
+	}
+	if errMsg != "" {
+		s.renderSettings(c, o, errMsg, "")
+		return
+	}
+	s.cfg.SetOverrides(o)
+	s.audit(c, db.AuditConfigUpdate, db.Zone{}, 0, o.String())
+	s.renderSettings(c, o, "", s.tr(c, "Settings saved"))
+}
+
+func (s *Server) renderSettings(c *gin.Context, o config.Overrides, errMsg, msg string) {
+	data := gin.H{
+		"Error":          errMsg,
+		"Message":        msg,
+		"FileDefaultTTL": s.cfg.DefaultTTL,
+		"FileNegTTL":     config.DefaultNegativeTTL,
+		"FileVerbose":    s.cfg.Log.DNSVerbose,
+		"FileForwarder":  s.cfg.Forwarder,
+		"Verbose":        "",
+	}
+	if o.DefaultTTL != nil {
+		data["DefaultTTL"] = *o.DefaultTTL
+	}
+	if o.NegativeTTL != nil {
+		data["NegativeTTL"] = *o.NegativeTTL
+	}
+	if o.DNSVerbose != nil {
+		data["Verbose"] = map[bool]string{true: "on", false: "off"}[*o.DNSVerbose]
+	}
+	if o.Forwarder != nil {
+		data["Forwarder"] = *o.Forwarder
+		if *o.Forwarder == "" {
+			data["Forwarder"] = forwarderNone
+		}
+	}
+	s.render(c, http.StatusOK, "settings", data)
+}
@@ -0,0 +1,48 @@
+package web
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strings"
+    "testing"
+    "time"
+
+    dbm "namedot/internal/db"
+)
+
+func TestSettingsForm(t *testing.T) {
+    s, r := newTestWeb(t)
+    s.cfg.DefaultTTL = 300
+    defer s.db.Where("1 = 1").Delete(&dbm.Setting{})
+    sid := "settings-session"
+    s.sessions[sid] = &Session{Username: "admin", CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour), CSRFToken: "csrf"}
+
+    put := func(form url.Values) *httptest.ResponseRecorder {
+        req := httptest.NewRequest("PUT", "/admin/settings", strings.NewReader(form.Encode()))
+        req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+        req.AddCookie(&http.Cookie{Name: "session", Value: sid, Path: "/admin"})
+        req.AddCookie(&http.Cookie{Name: "lang", Value: "en", Path: "/"})
+        req.Header.Set("X-CSRF-Token", "csrf")
+        req.Header.Set("Origin", "http://example.com")
+        w := httptest.NewRecorder()
+        r.ServeHTTP(w, req)
+        return w
+    }
+
+    w := put(url.Values{"default_ttl": {"soon"}})
+    if !strings.Contains(w.Body.String(), "default_ttl must be a number") || s.cfg.RecordDefaultTTL() != 300 {
+        t.Fatalf("bad ttl accepted: %s", w.Body.String())
+    }
+    w = put(url.Values{"default_ttl": {"900"}, "dns_verbose": {"on"}, "forwarder": {"none"}})
+    if !strings.Contains(w.Body.String(), "Settings saved") {
+        t.Fatalf("save: %d %s", w.Code, w.Body.String())
+    }
+    if s.cfg.RecordDefaultTTL() != 900 || !s.cfg.DNSVerbose() || s.cfg.ForwarderHost() != "" {
+        t.Fatalf("not applied: %+v", s.cfg.Overrides())
+    }
+    o, err := dbm.LoadOverrides(s.db)
+    if err != nil || o.DefaultTTL == nil || *o.DefaultTTL != 900 || o.NegativeTTL != nil || o.Forwarder == nil || *o.Forwarder != "" {
+        t.Fatalf("stored: %+v %v", o, err)
+    }
+}
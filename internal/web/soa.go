@@ -0,0 +1,99 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/db"
+)
+
+// soaTimer is one numeric field of the SOA form.
+type soaTimer struct {
+	Name  string
+	Label string
+	Value uint32
+}
+
+// soaForm shows the SOA of a zone as separate fields. A zone without SOA
+// gets the config defaults prefilled.
+func (s *Server) soaForm(c *gin.Context) {
+	zone, ok := s.loadZone(c)
+	if !ok {
+		return
+	}
+	soa, err := db.GetSOA(s.db, zone.ID)
+	missing := errors.Is(err, db.ErrNoSOA)
+	switch {
+	case missing:
+		soa = db.DefaultSOA(zone.Name, s.cfg.SOA.Primary, s.cfg.SOA.Hostmaster)
+	case err != nil:
+		s.renderSOAForm(c, zone, soa, false, err.Error(), "")
+		return
+	}
+	s.renderSOAForm(c, zone, soa, missing, "", "")
+}
+
+func (s *Server) updateSOA(c *gin.Context) {
+	zone, ok := s.loadZone(c)
+	if !ok {
+		return
+	}
+	num := func(name string) uint32 {
+		n, _ := strconv.ParseUint(strings.TrimSpace(c.PostForm(name)), 10, 32)
+		return uint32(n)
+	}
+	soa := db.SOA{
+		Primary:    strings.TrimSpace(c.PostForm("primary")),
+		Hostmaster: strings.TrimSpace(c.PostForm("hostmaster")),
+		Refresh:    num("refresh"),
+		Retry:      num("retry"),
+		Expire:     num("expire"),
+		Minimum:    num("minimum"),
+		TTL:        num("ttl"),
+	}
+	s.storeSOA(c, zone, soa)
+}
+
+// resetSOA replaces the SOA with the defaults from config.
+func (s *Server) resetSOA(c *gin.Context) {
+	zone, ok := s.loadZone(c)
+	if !ok {
+		return
+	}
+	s.storeSOA(c, zone, db.DefaultSOA(zone.Name, s.cfg.SOA.Primary, s.cfg.SOA.Hostmaster))
+}
+
+// storeSOA saves the SOA and shows the form again with the result; on a
+// validation error the submitted values are kept.
+func (s *Server) storeSOA(c *gin.Context, zone db.Zone, soa db.SOA) {
+	saved, err := db.SetSOA(s.dbFor(c), zone, soa)
+	if err != nil {
+		_, getErr := db.GetSOA(s.db, zone.ID)
+		s.renderSOAForm(c, zone, soa, errors.Is(getErr, db.ErrNoSOA), err.Error(), "")
+		return
+	}
+	s.audit(c, db.AuditSOAUpdate, zone, 0, fmt.Sprintf("%s %s serial %d", saved.Primary, saved.Hostmaster, saved.Serial))
+	s.renderSOAForm(c, zone, saved, false, "", s.tr(c, "SOA saved"))
+}
+
+func (s *Server) renderSOAForm(c *gin.Context, zone db.Zone, soa db.SOA, missing bool, errMsg, msg string) {
+	s.render(c, http.StatusOK, "soa_form", gin.H{
+		"Zone":    zone,
+		"SOA":     soa,
+		"Missing": missing,
+		"Error":   errMsg,
+		"Message": msg,
+		"Timers": []soaTimer{
+			{Name: "refresh", Label: "Refresh (seconds)", Value: soa.Refresh},
+			{Name: "retry", Label: "Retry (seconds)", Value: soa.Retry},
+			{Name: "expire", Label: "Expire (seconds)", Value: soa.Expire},
+			{Name: "minimum", Label: "Minimum / negative TTL (seconds)", Value: soa.Minimum},
+			{Name: "ttl", Label: "TTL (seconds)", Value: soa.TTL},
+		},
+	})
+}
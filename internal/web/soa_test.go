@@ -0,0 +1,84 @@
+package web
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+
+    dbm "namedot/internal/db"
+)
+
+func TestSOAEditor(t *testing.T) {
+    s, r := newTestWeb(t)
+    sid := "soa-session"
+    s.sessions[sid] = &Session{Username: "admin", CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour), CSRFToken: "csrf"}
+
+    zone := dbm.Zone{Name: "web-soa.test."}
+    if err := s.db.Create(&zone).Error; err != nil {
+        t.Fatalf("create zone: %v", err)
+    }
+    defer func() {
+        dbm.TrashZone(s.db, zone.ID)
+        dbm.PurgeZone(s.db, zone.ID)
+    }()
+    base := "/admin/zones/" + strconv.Itoa(int(zone.ID)) + "/soa"
+
+    do := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+        var req *http.Request
+        if form != nil {
+            req = httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+            req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+        } else {
+            req = httptest.NewRequest(method, path, nil)
+        }
+        req.AddCookie(&http.Cookie{Name: "session", Value: sid, Path: "/admin"})
+        req.AddCookie(&http.Cookie{Name: "lang", Value: "en", Path: "/"})
+        req.Header.Set("X-CSRF-Token", "csrf")
+        req.Header.Set("Origin", "http://example.com")
+        w := httptest.NewRecorder()
+        r.ServeHTTP(w, req)
+        return w
+    }
+
+    // No SOA yet: the form is prefilled with defaults
+    w := do("GET", base, nil)
+    if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "no SOA record yet") || !strings.Contains(w.Body.String(), `name="refresh" value="7200"`) {
+        t.Fatalf("form without SOA: %d %s", w.Code, w.Body.String())
+    }
+
+    form := url.Values{
+        "primary": {"ns1.web-soa.test."}, "hostmaster": {"admin.web-soa.test."},
+        "refresh": {"600"}, "retry": {"300"}, "expire": {"86400"}, "minimum": {"60"}, "ttl": {"1800"},
+    }
+    w = do("PUT", base, form)
+    if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "SOA saved") {
+        t.Fatalf("save SOA: %d %s", w.Code, w.Body.String())
+    }
+    soa, err := dbm.GetSOA(s.db, zone.ID)
+    if err != nil || soa.Refresh != 600 || soa.Hostmaster != "admin.web-soa.test." || soa.TTL != 1800 {
+        t.Fatalf("stored SOA = %+v, %v", soa, err)
+    }
+
+    // Invalid values keep the submitted form and report the error
+    form.Set("retry", "0")
+    w = do("PUT", base, form)
+    if body := w.Body.String(); w.Code != http.StatusOK || strings.Contains(body, "SOA saved") || !strings.Contains(body, `name="retry" value="0"`) {
+        t.Fatalf("invalid SOA should be rejected: %d %s", w.Code, body)
+    }
+    if got, _ := dbm.GetSOA(s.db, zone.ID); got.Retry != 300 {
+        t.Fatalf("rejected update changed retry to %d", got.Retry)
+    }
+
+    w = do("POST", base+"/reset", nil)
+    if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "SOA saved") {
+        t.Fatalf("reset SOA: %d %s", w.Code, w.Body.String())
+    }
+    reset, _ := dbm.GetSOA(s.db, zone.ID)
+    if reset.Refresh != dbm.DefaultSOARefresh || reset.Serial <= soa.Serial {
+        t.Fatalf("reset SOA = %+v (previous serial %d)", reset, soa.Serial)
+    }
+}
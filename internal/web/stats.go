@@ -0,0 +1,68 @@
+package web
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/db"
+	"namedot/internal/stats"
+)
+
+// statsTopN limits the dashboard table to the busiest zone/type pairs.
+const statsTopN = 50
+
+func (s *Server) listStats(c *gin.Context) {
+	if !s.cfg.Stats.Enabled {
+		s.render(c, http.StatusOK, "stats_list", gin.H{"Enabled": false})
+		return
+	}
+	now := time.Now().UTC()
+	items, err := db.QueryStats(s.db, db.QueryStatsFilter{From: now.Add(-24 * time.Hour).Truncate(time.Hour), To: now})
+	if err != nil {
+		c.String(http.StatusInternalServerError, s.tr(c, "Error loading statistics"))
+		return
+	}
+	var total int64
+	for _, it := range items {
+		total += it.Queries
+	}
+	if len(items) > statsTopN {
+		items = items[:statsTopN]
+	}
+	s.render(c, http.StatusOK, "stats_list", gin.H{
+		"Enabled": true,
+		"Total":   total,
+		"Items":   items,
+	})
+}
+
+// exportZoneStats downloads the usage report of a zone as CSV: by day
+// (group=day|month|hour) for month (YYYY-MM, default the previous month).
+func (s *Server) exportZoneStats(c *gin.Context) {
+	var zone db.Zone
+	if err := s.db.First(&zone, c.Param("id")).Error; err != nil {
+		c.String(http.StatusNotFound, s.tr(c, "Zone not found"))
+		return
+	}
+	group := c.DefaultQuery("group", stats.GroupDay)
+	from, to, err := stats.MonthRange(c.Query("month"), time.Now())
+	if err != nil || !stats.ValidGroup(group) {
+		c.String(http.StatusBadRequest, s.tr(c, "Invalid report period"))
+		return
+	}
+	rows, err := stats.ZoneReport(s.db, zone.Name, from, to, group)
+	if err != nil {
+		c.String(http.StatusInternalServerError, s.tr(c, "Error loading statistics"))
+		return
+	}
+	var buf bytes.Buffer
+	_ = stats.WriteCSV(&buf, zone.Name, rows)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.csv"`,
+		strings.TrimSuffix(zone.Name, "."), from.Format("2006-01")))
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
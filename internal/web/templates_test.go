@@ -0,0 +1,79 @@
+package web
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+
+    dbm "namedot/internal/db"
+)
+
+func TestTemplates_ReapplyOutdatedZones(t *testing.T) {
+    s, r := newTestWeb(t)
+    sid := "tpl-session"
+    s.sessions[sid] = &Session{Username: "admin", CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour), CSRFToken: "csrf"}
+
+    zone := dbm.Zone{Name: "web-tpl.test."}
+    if err := s.db.Create(&zone).Error; err != nil {
+        t.Fatalf("create zone: %v", err)
+    }
+    defer func() {
+        dbm.TrashZone(s.db, zone.ID)
+        dbm.PurgeZone(s.db, zone.ID)
+    }()
+    tpl := dbm.Template{Name: "web-tpl", Records: []dbm.TemplateRecord{{Name: "{domain}", Type: "TXT", TTL: 300, Data: `"v=spf1 mx -all"`}}}
+    if err := s.db.Create(&tpl).Error; err != nil {
+        t.Fatalf("create template: %v", err)
+    }
+    defer s.db.Unscoped().Select("Records").Delete(&tpl)
+    defer s.db.Where("template_id = ?", tpl.ID).Delete(&dbm.TemplateApplication{})
+    tplID := strconv.Itoa(int(tpl.ID))
+
+    do := func(method, path string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(method, path, nil)
+        req.AddCookie(&http.Cookie{Name: "session", Value: sid, Path: "/admin"})
+        req.AddCookie(&http.Cookie{Name: "lang", Value: "en", Path: "/"})
+        req.Header.Set("X-CSRF-Token", "csrf")
+        req.Header.Set("Origin", "http://example.com")
+        w := httptest.NewRecorder()
+        r.ServeHTTP(w, req)
+        return w
+    }
+
+    if w := do("POST", "/admin/templates/"+tplID+"/apply?zone_id="+strconv.Itoa(int(zone.ID))); w.Code != http.StatusOK {
+        t.Fatalf("apply: %d %s", w.Code, w.Body.String())
+    }
+
+    // Replacing the SPF record makes the zone outdated
+    var old dbm.TemplateRecord
+    s.db.Where("template_id = ?", tpl.ID).First(&old)
+    if w := do("DELETE", "/admin/templates/records/"+strconv.Itoa(int(old.ID))); w.Code != http.StatusOK {
+        t.Fatalf("delete template record: %d", w.Code)
+    }
+    s.db.Create(&dbm.TemplateRecord{TemplateID: tpl.ID, Name: "{domain}", Type: "TXT", TTL: 300, Data: `"v=spf1 mx include:_spf.example.net -all"`})
+    dbm.BumpTemplateVersion(s.db, tpl.ID)
+
+    w := do("GET", "/admin/templates/"+tplID+"/view")
+    if body := w.Body.String(); !strings.Contains(body, "web-tpl.test.") || !strings.Contains(body, "outdated") || !strings.Contains(body, "Re-apply to outdated zones") {
+        t.Fatalf("template view: %s", body)
+    }
+    w = do("GET", "/admin/templates/"+tplID+"/apply?zone_id="+strconv.Itoa(int(zone.ID))+"&from=template")
+    if body := w.Body.String(); !strings.Contains(body, "1 records will be added, 1 removed.") {
+        t.Fatalf("diff: %s", body)
+    }
+
+    w = do("POST", "/admin/templates/"+tplID+"/reapply")
+    if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Re-applied to 1 zones") {
+        t.Fatalf("reapply: %d %s", w.Code, w.Body.String())
+    }
+    var txt dbm.RRSet
+    if err := s.db.Preload("Records").Where("zone_id = ? AND type = ?", zone.ID, "TXT").First(&txt).Error; err != nil {
+        t.Fatalf("load TXT: %v", err)
+    }
+    if len(txt.Records) != 1 || !strings.Contains(txt.Records[0].Data, "include:_spf.example.net") {
+        t.Fatalf("TXT after reapply: %+v", txt.Records)
+    }
+}
@@ -0,0 +1,60 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/db"
+)
+
+func (s *Server) listTrash(c *gin.Context) {
+	entries, err := db.ListTrash(s.db)
+	if err != nil {
+		c.String(http.StatusInternalServerError, s.tr(c, "Error loading trash"))
+		return
+	}
+	s.render(c, http.StatusOK, "trash_list", gin.H{
+		"Entries":       entries,
+		"RetentionDays": s.cfg.TrashRetentionDays,
+		"Retention":     time.Duration(s.cfg.TrashRetentionDays) * 24 * time.Hour,
+	})
+}
+
+func (s *Server) restoreTrash(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	zone, err := db.RestoreZone(s.db, uint(id))
+	if err != nil {
+		s.renderError(c, http.StatusConflict, fmt.Sprintf(s.tr(c, "Error restoring zone: %s"), err.Error()))
+		return
+	}
+	db.TouchZone(s.db, *zone, s.cfg)
+	s.audit(c, db.AuditZoneRestore, *zone, 0, zone.Name)
+
+	// Refresh the zones tab as well
+	c.Header("HX-Trigger", "zones-changed")
+	s.listTrash(c)
+}
+
+func (s *Server) purgeTrash(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	var zone db.Zone
+	s.db.Unscoped().First(&zone, id)
+	if err := db.PurgeZone(s.db, uint(id)); err != nil {
+		c.String(http.StatusInternalServerError, s.tr(c, "Error purging zone"))
+		return
+	}
+	s.audit(c, db.AuditZonePurge, zone, 0, zone.Name)
+	s.listTrash(c)
+}
@@ -0,0 +1,58 @@
+package web
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+
+    dbm "namedot/internal/db"
+)
+
+func TestTrash_DeleteAndRestoreZone(t *testing.T) {
+    s, r := newTestWeb(t)
+    s.cfg.TrashRetentionDays = 30
+    sid := "trash-session"
+    s.sessions[sid] = &Session{Username: "admin", CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour), CSRFToken: "csrf"}
+
+    zone := dbm.Zone{Name: "web-trash.test."}
+    if err := s.db.Create(&zone).Error; err != nil {
+        t.Fatalf("create zone: %v", err)
+    }
+    id := strconv.Itoa(int(zone.ID))
+    // Leave the shared in-memory DB clean for other tests
+    defer dbm.PurgeZone(s.db, zone.ID)
+
+    do := func(method, path string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(method, path, nil)
+        req.AddCookie(&http.Cookie{Name: "session", Value: sid, Path: "/admin"})
+        req.AddCookie(&http.Cookie{Name: "lang", Value: "en", Path: "/"})
+        req.Header.Set("X-CSRF-Token", "csrf")
+        req.Header.Set("Origin", "http://example.com")
+        w := httptest.NewRecorder()
+        r.ServeHTTP(w, req)
+        return w
+    }
+
+    if w := do("DELETE", "/admin/zones/delete/"+id); w.Code != http.StatusOK || w.Header().Get("HX-Trigger") != "trash-changed" {
+        t.Fatalf("delete: status %d, trigger %q", w.Code, w.Header().Get("HX-Trigger"))
+    }
+
+    w := do("GET", "/admin/trash")
+    if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "web-trash.test.") {
+        t.Fatalf("trash list should show deleted zone: %d %s", w.Code, w.Body.String())
+    }
+
+    w = do("POST", "/admin/trash/"+id+"/restore")
+    if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "web-trash.test.") {
+        t.Fatalf("restore: %d %s", w.Code, w.Body.String())
+    }
+    var count int64
+    s.db.Model(&dbm.Zone{}).Where("id = ?", zone.ID).Count(&count)
+    if count != 1 {
+        t.Fatalf("zone should be active after restore")
+    }
+    do("DELETE", "/admin/zones/delete/"+id)
+}
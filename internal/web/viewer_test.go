@@ -0,0 +1,94 @@
+package web
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strconv"
+    "strings"
+    "testing"
+
+    "golang.org/x/crypto/bcrypt"
+
+    "namedot/internal/config"
+    dbm "namedot/internal/db"
+)
+
+func TestViewerRole(t *testing.T) {
+    s, r := newTestWeb(t)
+    hash, err := bcrypt.GenerateFromPassword([]byte("noc-pass"), bcrypt.MinCost)
+    if err != nil {
+        t.Fatalf("hash: %v", err)
+    }
+    s.cfg.Admin.Users = []config.AdminUser{{Username: "noc", PasswordHash: string(hash), Role: config.RoleViewer}}
+
+    zone := dbm.Zone{Name: "web-viewer.test.", RRSets: []dbm.RRSet{
+        {Name: "www.web-viewer.test.", Type: "A", TTL: 300, Records: []dbm.RData{{Data: "192.0.2.1"}}},
+    }}
+    if err := s.db.Create(&zone).Error; err != nil {
+        t.Fatalf("create zone: %v", err)
+    }
+    defer func() {
+        dbm.TrashZone(s.db, zone.ID)
+        dbm.PurgeZone(s.db, zone.ID)
+    }()
+    recordID := strconv.Itoa(int(zone.RRSets[0].Records[0].ID))
+
+    // Log in as the viewer
+    form := url.Values{"username": {"noc"}, "password": {"noc-pass"}}
+    req := httptest.NewRequest("POST", "/admin/login", strings.NewReader(form.Encode()))
+    req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+    w := httptest.NewRecorder()
+    r.ServeHTTP(w, req)
+    var sid string
+    for _, ck := range w.Result().Cookies() {
+        if ck.Name == "session" {
+            sid = ck.Value
+        }
+    }
+    if sid == "" || s.sessions[sid].Role != config.RoleViewer {
+        t.Fatalf("viewer login failed: %d %s", w.Code, w.Body.String())
+    }
+    csrf := s.sessions[sid].CSRFToken
+
+    do := func(method, path string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(method, path, nil)
+        req.AddCookie(&http.Cookie{Name: "session", Value: sid, Path: "/admin"})
+        req.AddCookie(&http.Cookie{Name: "lang", Value: "en", Path: "/"})
+        req.Header.Set("X-CSRF-Token", csrf)
+        req.Header.Set("Origin", "http://example.com")
+        w := httptest.NewRecorder()
+        r.ServeHTTP(w, req)
+        return w
+    }
+
+    // Pages render without edit controls
+    w = do("GET", "/admin/zones/"+strconv.Itoa(int(zone.ID))+"/records")
+    body := w.Body.String()
+    if w.Code != http.StatusOK || !strings.Contains(body, "192.0.2.1") {
+        t.Fatalf("records list: %d %s", w.Code, body)
+    }
+    for _, ctl := range []string{"hx-delete", "hx-put", "+ Add Record", "/inline"} {
+        if strings.Contains(body, ctl) {
+            t.Errorf("viewer records list contains %q", ctl)
+        }
+    }
+    w = do("GET", "/admin/")
+    if body := w.Body.String(); !strings.Contains(body, "read-only") || strings.Contains(body, "+ New Zone") {
+        t.Errorf("viewer dashboard: %s", body)
+    }
+
+    // Mutating routes are rejected even with a valid CSRF token
+    w = do("DELETE", "/admin/records/"+recordID)
+    if w.Code != http.StatusForbidden {
+        t.Fatalf("viewer delete: status %d, want 403", w.Code)
+    }
+    var count int64
+    s.db.Model(&dbm.RData{}).Where("id = ?", recordID).Count(&count)
+    if count != 1 {
+        t.Fatalf("record deleted by viewer")
+    }
+    if w = do("POST", "/admin/replication/sync"); w.Code != http.StatusForbidden {
+        t.Fatalf("viewer sync: status %d, want 403", w.Code)
+    }
+}
@@ -0,0 +1,159 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"namedot/internal/db"
+	"namedot/internal/server/rest/zoneio"
+)
+
+// maxImportSize limits uploaded and pasted zone files.
+const maxImportSize = 10 << 20
+
+// exportZone downloads the zone in the same formats as GET /zones/{id}/export.
+func (s *Server) exportZone(c *gin.Context) {
+	zoneID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.String(http.StatusBadRequest, s.tr(c, "Invalid zone ID"))
+		return
+	}
+	var zone db.Zone
+	if err := s.db.Preload("RRSets.Records").First(&zone, zoneID).Error; err != nil {
+		c.String(http.StatusNotFound, s.tr(c, "Zone not found"))
+		return
+	}
+	base := strings.TrimSuffix(zone.Name, ".")
+	switch strings.ToLower(c.DefaultQuery("format", "bind")) {
+	case "bind":
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zone"`, base))
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(zoneio.ToBind(&zone)))
+	case "json":
+		body, err := json.MarshalIndent(zone, "", "  ")
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, base))
+		c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+	default:
+		c.String(http.StatusBadRequest, s.tr(c, "Unsupported format"))
+	}
+}
+
+func (s *Server) importZoneForm(c *gin.Context) {
+	s.renderImportForm(c, c.Param("id"), "bind", "upsert", "", "")
+}
+
+// renderImportForm shows the upload/paste form, keeping the submitted values
+// and the validation error (if any) so the user can fix the input in place.
+func (s *Server) renderImportForm(c *gin.Context, zoneID, format, mode, content, errMsg string) {
+	s.render(c, http.StatusOK, "import_form", gin.H{
+		"ZoneID":  zoneID,
+		"Format":  format,
+		"Mode":    mode,
+		"Content": content,
+		"Error":   errMsg,
+	})
+}
+
+// importZone runs the same import as POST /zones/{id}/import. Errors are
+// rendered inside the form; on success the records list is refreshed.
+func (s *Server) importZone(c *gin.Context) {
+	zoneID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.String(http.StatusBadRequest, s.tr(c, "Invalid zone ID"))
+		return
+	}
+	var zone db.Zone
+	if err := s.db.First(&zone, zoneID).Error; err != nil {
+		c.String(http.StatusNotFound, s.tr(c, "Zone not found"))
+		return
+	}
+
+	format := strings.ToLower(c.DefaultPostForm("format", "bind"))
+	mode := strings.ToLower(c.DefaultPostForm("mode", "upsert"))
+	content := c.PostForm("zonefile")
+	fail := func(msg string) {
+		s.renderImportForm(c, c.Param("id"), format, mode, content, msg)
+	}
+	source := db.SourceImport(db.SourceWeb(c.GetString("username")))
+
+	if fh, err := c.FormFile("file"); err == nil && fh.Size > 0 {
+		if fh.Size > maxImportSize {
+			fail(s.tr(c, "File is too large"))
+			return
+		}
+		f, err := fh.Open()
+		if err != nil {
+			fail(err.Error())
+			return
+		}
+		source = db.SourceImport(filepath.Base(fh.Filename))
+		buf, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			fail(err.Error())
+			return
+		}
+		content = string(buf)
+	}
+	if strings.TrimSpace(content) == "" {
+		fail(s.tr(c, "Choose a file or paste the zone file"))
+		return
+	}
+	if len(content) > maxImportSize {
+		fail(s.tr(c, "File is too large"))
+		return
+	}
+	if mode != "upsert" && mode != "replace" {
+		fail(s.tr(c, "Unsupported mode"))
+		return
+	}
+
+	switch format {
+	case "bind":
+		// Refuse the whole file if any line is bad, as the form shows one error
+		err = db.WithSource(s.db, source).Transaction(func(tx *gorm.DB) error {
+			rep, err := zoneio.ImportBIND(tx, &zone, strings.NewReader(content), mode, s.cfg.RecordDefaultTTL(), s.cfg.RecordTTL)
+			if err != nil {
+				return err
+			}
+			return rep.Err()
+		})
+	case "json":
+		var in *db.Zone
+		if in, err = zoneio.DecodeJSON(strings.NewReader(content)); err == nil {
+			// Like BIND, refuse the whole file if any record set is skipped
+			err = db.WithSource(s.db, source).Transaction(func(tx *gorm.DB) error {
+				rep, err := zoneio.ImportJSON(tx, &zone, in, mode, s.cfg.RecordDefaultTTL(), s.cfg.RecordTTL)
+				if err != nil {
+					return err
+				}
+				return rep.Err()
+			})
+		}
+	default:
+		fail(s.tr(c, "Unsupported format"))
+		return
+	}
+	if err != nil {
+		fail(s.trf(c, "Import failed: %s", err.Error()))
+		return
+	}
+	db.TouchZone(s.db, zone, s.cfg)
+	s.audit(c, db.AuditZoneImport, zone, 0, format+" "+mode)
+
+	// Replace the whole records view, not just the form
+	c.Header("HX-Retarget", "#zones-list")
+	c.Header("HX-Reswap", "innerHTML")
+	s.listRecords(c)
+}
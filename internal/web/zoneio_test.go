@@ -0,0 +1,90 @@
+package web
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+
+    dbm "namedot/internal/db"
+)
+
+func TestZoneImportExport(t *testing.T) {
+    s, r := newTestWeb(t)
+    sid := "zoneio-session"
+    s.sessions[sid] = &Session{Username: "admin", CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour), CSRFToken: "csrf"}
+
+    zone := dbm.Zone{Name: "web-io.test."}
+    if err := s.db.Create(&zone).Error; err != nil {
+        t.Fatalf("create zone: %v", err)
+    }
+    id := strconv.Itoa(int(zone.ID))
+    // Leave the shared in-memory DB clean for other tests
+    defer func() {
+        dbm.TrashZone(s.db, zone.ID)
+        dbm.PurgeZone(s.db, zone.ID)
+    }()
+
+    do := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+        var req *http.Request
+        if form != nil {
+            req = httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+            req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+        } else {
+            req = httptest.NewRequest(method, path, nil)
+        }
+        req.AddCookie(&http.Cookie{Name: "session", Value: sid, Path: "/admin"})
+        req.AddCookie(&http.Cookie{Name: "lang", Value: "en", Path: "/"})
+        req.Header.Set("X-CSRF-Token", "csrf")
+        req.Header.Set("Origin", "http://example.com")
+        w := httptest.NewRecorder()
+        r.ServeHTTP(w, req)
+        return w
+    }
+
+    // Parse errors are shown inside the form and nothing is written
+    w := do("POST", "/admin/zones/"+id+"/import", url.Values{"format": {"bind"}, "zonefile": {"www 300 IN A not-an-ip"}})
+    body := w.Body.String()
+    if w.Code != http.StatusOK || !strings.Contains(body, "Import failed") || !strings.Contains(body, "not-an-ip") {
+        t.Fatalf("expected inline error, got %d %s", w.Code, body)
+    }
+    if w.Header().Get("HX-Retarget") != "" {
+        t.Fatal("failed import must not replace the records view")
+    }
+    var count int64
+    s.db.Model(&dbm.RRSet{}).Where("zone_id = ?", zone.ID).Count(&count)
+    if count != 0 {
+        t.Fatalf("failed import wrote %d rrsets", count)
+    }
+
+    w = do("POST", "/admin/zones/"+id+"/import", url.Values{"format": {"bind"}, "zonefile": {"www 300 IN A 192.0.2.10\nmail 600 IN A 192.0.2.20\n"}})
+    if w.Code != http.StatusOK || w.Header().Get("HX-Retarget") != "#zones-list" || !strings.Contains(w.Body.String(), "192.0.2.10") {
+        t.Fatalf("import: %d %q %s", w.Code, w.Header().Get("HX-Retarget"), w.Body.String())
+    }
+
+    w = do("GET", "/admin/zones/"+id+"/export?format=bind", nil)
+    if w.Code != http.StatusOK || !strings.Contains(w.Header().Get("Content-Disposition"), `filename="web-io.test.zone"`) {
+        t.Fatalf("export bind: %d %q", w.Code, w.Header().Get("Content-Disposition"))
+    }
+    if !strings.Contains(w.Body.String(), "mail.web-io.test. 600 IN A 192.0.2.20") {
+        t.Fatalf("export bind body: %s", w.Body.String())
+    }
+
+    w = do("GET", "/admin/zones/"+id+"/export?format=json", nil)
+    if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"www.web-io.test."`) {
+        t.Fatalf("export json: %d %s", w.Code, w.Body.String())
+    }
+
+    // The JSON export can be pasted back in
+    w = do("POST", "/admin/zones/"+id+"/import", url.Values{"format": {"json"}, "mode": {"replace"}, "zonefile": {w.Body.String()}})
+    if w.Code != http.StatusOK || w.Header().Get("HX-Retarget") != "#zones-list" {
+        t.Fatalf("json import: %d %s", w.Code, w.Body.String())
+    }
+    s.db.Model(&dbm.RRSet{}).Where("zone_id = ?", zone.ID).Count(&count)
+    if count != 2 {
+        t.Fatalf("expected 2 rrsets after json round trip, got %d", count)
+    }
+}
@@ -0,0 +1,69 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/db"
+)
+
+// zoneLockMiddleware refuses changes to zones locked for maintenance
+// (POST /zones/{id}/lock in the REST API), including template apply.
+func (s *Server) zoneLockMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+		zoneID, ok := s.requestZoneID(c)
+		if !ok {
+			c.Next()
+			return
+		}
+		var zone db.Zone
+		if err := s.db.Select("id", "locked_by", "lock_reason", "locked_at").Where("id = ?", zoneID).Limit(1).Find(&zone).Error; err != nil || !zone.Locked() {
+			c.Next()
+			return
+		}
+		msg := s.trf(c, "Zone is locked by %s", zone.LockedBy)
+		if zone.LockReason != "" {
+			msg = s.trf(c, "Zone is locked by %s: %s", zone.LockedBy, zone.LockReason)
+		}
+		s.renderError(c, http.StatusLocked, msg)
+		c.Abort()
+	}
+}
+
+// requestZoneID returns the zone a changing admin route works on. Routes
+// that do not change a zone report false.
+func (s *Server) requestZoneID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	switch c.FullPath() {
+	case "/admin/zones/delete/:id", "/admin/zones/:id/records", "/admin/zones/:id/records/bulk",
+		"/admin/zones/:id/import", "/admin/zones/:id/soa", "/admin/zones/:id/soa/reset", "/admin/zones/:id/json",
+		"/admin/zones/:id/mailauth", "/admin/zones/:id/toggle":
+		return uint(id), true
+	case "/admin/records/:id", "/admin/records/:id/inline", "/admin/records/:id/toggle":
+		var record db.RData
+		if err := s.db.First(&record, id).Error; err != nil {
+			return 0, false
+		}
+		id = uint64(record.RRSetID)
+		fallthrough
+	case "/admin/rrsets/:id", "/admin/rrsets/:id/ttl":
+		var rrset db.RRSet
+		if err := s.db.First(&rrset, id).Error; err != nil {
+			return 0, false
+		}
+		return rrset.ZoneID, true
+	case "/admin/templates/:id/apply":
+		zoneID, err := strconv.ParseUint(c.Query("zone_id"), 10, 32)
+		return uint(zoneID), err == nil
+	}
+	return 0, false
+}
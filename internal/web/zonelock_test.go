@@ -0,0 +1,72 @@
+package web
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+
+    dbm "namedot/internal/db"
+)
+
+func TestZoneLock_BlocksAdminChanges(t *testing.T) {
+    s, r := newTestWeb(t)
+    sid := "lock-session"
+    s.sessions[sid] = &Session{Username: "admin", CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour), CSRFToken: "csrf"}
+
+    zone := dbm.Zone{Name: "web-lock.test.", RRSets: []dbm.RRSet{
+        {Name: "www.web-lock.test.", Type: "A", TTL: 300, Records: []dbm.RData{{Data: "192.0.2.1"}}},
+    }}
+    if err := s.db.Create(&zone).Error; err != nil {
+        t.Fatalf("create zone: %v", err)
+    }
+    defer func() {
+        dbm.UnlockZone(s.db, zone.ID)
+        dbm.TrashZone(s.db, zone.ID)
+        dbm.PurgeZone(s.db, zone.ID)
+    }()
+    tpl := dbm.Template{Name: "web-lock", Records: []dbm.TemplateRecord{{Name: "mail.{domain}", Type: "A", TTL: 300, Data: "192.0.2.25"}}}
+    if err := s.db.Create(&tpl).Error; err != nil {
+        t.Fatalf("create template: %v", err)
+    }
+    defer s.db.Unscoped().Select("Records").Delete(&tpl)
+    if _, err := dbm.LockZone(s.db, zone.ID, "alice", "migration"); err != nil {
+        t.Fatalf("lock: %v", err)
+    }
+    zoneID := strconv.Itoa(int(zone.ID))
+
+    do := func(method, path string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(method, path, nil)
+        req.AddCookie(&http.Cookie{Name: "session", Value: sid, Path: "/admin"})
+        req.AddCookie(&http.Cookie{Name: "lang", Value: "en", Path: "/"})
+        req.Header.Set("X-CSRF-Token", "csrf")
+        req.Header.Set("Origin", "http://example.com")
+        w := httptest.NewRecorder()
+        r.ServeHTTP(w, req)
+        return w
+    }
+
+    for _, path := range []string{
+        "/admin/records/" + strconv.Itoa(int(zone.RRSets[0].Records[0].ID)),
+        "/admin/rrsets/" + strconv.Itoa(int(zone.RRSets[0].ID)),
+        "/admin/zones/delete/" + zoneID,
+    } {
+        w := do("DELETE", path)
+        if w.Code != http.StatusLocked || !strings.Contains(w.Body.String(), "Zone is locked by alice: migration") {
+            t.Fatalf("DELETE %s: %d %s", path, w.Code, w.Body.String())
+        }
+    }
+    if w := do("POST", "/admin/templates/"+strconv.Itoa(int(tpl.ID))+"/apply?zone_id="+zoneID); w.Code != http.StatusLocked {
+        t.Fatalf("template apply on locked zone: %d", w.Code)
+    }
+    var n int64
+    s.db.Model(&dbm.RRSet{}).Where("zone_id = ?", zone.ID).Count(&n)
+    if n != 1 {
+        t.Fatalf("locked zone was changed: %d rrsets", n)
+    }
+    if w := do("GET", "/admin/zones/"+zoneID+"/records"); w.Code != http.StatusOK {
+        t.Fatalf("records list of locked zone: %d", w.Code)
+    }
+}
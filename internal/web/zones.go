@@ -1,7 +1,6 @@
 package web
 
 import (
-    "fmt"
     "net/http"
     "net/url"
     "strconv"
@@ -66,133 +65,43 @@ func (s *Server) listZones(c *gin.Context) {
 		return
 	}
 
-	// Calculate pagination
-	totalPages := int((total + int64(perPage) - 1) / int64(perPage))
-
-	// Build search form
-	searchForm := fmt.Sprintf(`
-	<div style="margin-bottom: 1rem;">
-		<form hx-get="/admin/zones" hx-target="#zones-list" hx-swap="innerHTML" style="display: flex; gap: 0.5rem;">
-			<input type="text" name="search" placeholder="`+s.tr(c, "Search zones (domain, URL, or name)...")+`" value="%s"
-				style="flex: 1; padding: 0.5rem; border: 1px solid #cbd5e0; border-radius: 4px;">
-			<button type="submit" class="btn">`+s.tr(c, "Search")+`</button>
-			<button type="button" class="btn" style="background: #718096;"
-				hx-get="/admin/zones" hx-target="#zones-list" hx-swap="innerHTML">
-				`+s.tr(c, "Clear")+`
-			</button>
-		</form>
-	</div>`, search)
-
-	html := searchForm + `<table>
-        <thead>
-            <tr>
-                <th>` + s.tr(c, "Zone Name") + `</th>
-                <th>` + s.tr(c, "Records") + `</th>
-                <th>` + s.tr(c, "Actions") + `</th>
-            </tr>
-        </thead>
-        <tbody>`
-
-	if len(zones) == 0 {
-		if search != "" {
-			html += `<tr><td colspan="3" class="empty-state">` + s.tr(c, "No zones found matching your search") + `</td></tr>`
-		} else {
-			html += `<tr><td colspan="3" class="empty-state">` + s.tr(c, "No zones found. Create your first zone!") + `</td></tr>`
-		}
-	} else {
-		for _, zone := range zones {
-			// Load the zone with preloaded RRSets and Records
-			var zoneWithRecords db.Zone
-			s.db.Preload("RRSets.Records").First(&zoneWithRecords, zone.ID)
-
-			// Count total RData records across all RRSets
-			recordCount := 0
-			for _, rrset := range zoneWithRecords.RRSets {
-				recordCount += len(rrset.Records)
-			}
-
-			html += fmt.Sprintf(`
-            <tr>
-                <td><strong>%s</strong></td>
-                <td>%d `+s.tr(c, "Records")+`</td>
-                <td class="actions">
-                    <button class="btn btn-sm" hx-get="/admin/zones/%d/records" hx-target="#zones-list" hx-swap="innerHTML">
-                        %s
-                    </button>
-                    <button class="btn btn-sm btn-danger"
-                        hx-delete="/admin/zones/delete/%d"
-                        hx-confirm="%s"
-                        hx-target="closest tr"
-                        hx-swap="outerHTML">
-                        %s
-                    </button>
-                </td>
-            </tr>`, zone.Name, recordCount, zone.ID, s.tr(c, "View Records"), zone.ID, s.trf(c, "Delete zone %s?", zone.Name), s.tr(c, "Delete"))
-		}
+	listURL := "/admin/zones?search=" + url.QueryEscape(search)
+	rows := make([]zoneRow, 0, len(zones))
+	for _, zone := range zones {
+		rows = append(rows, zoneRow{Zone: zone, Records: s.zoneRecordCount(zone.ID)})
 	}
 
-	html += `</tbody></table>`
-
-	// Add pagination if needed
-	if totalPages > 1 {
-		html += `<div style="display: flex; justify-content: center; gap: 0.5rem; margin-top: 1rem; flex-wrap: wrap;">`
-
-		// Previous button
-		if page > 1 {
-			html += fmt.Sprintf(`<button class="btn btn-sm" hx-get="/admin/zones?page=%d&search=%s" hx-target="#zones-list" hx-swap="innerHTML">« `+s.tr(c, "Prev")+`</button>`, page-1, url.QueryEscape(search))
-		}
-
-		// Page numbers
-		for i := 1; i <= totalPages; i++ {
-			if i == page {
-				html += fmt.Sprintf(`<button class="btn btn-sm" style="background: #667eea; color: white;">%d</button>`, i)
-			} else if i == 1 || i == totalPages || (i >= page-2 && i <= page+2) {
-				html += fmt.Sprintf(`<button class="btn btn-sm" hx-get="/admin/zones?page=%d&search=%s" hx-target="#zones-list" hx-swap="innerHTML">%d</button>`, i, url.QueryEscape(search), i)
-			} else if i == page-3 || i == page+3 {
-				html += `<span style="padding: 0.25rem 0.5rem;">...</span>`
-			}
-		}
-
-		// Next button
-		if page < totalPages {
-			html += fmt.Sprintf(`<button class="btn btn-sm" hx-get="/admin/zones?page=%d&search=%s" hx-target="#zones-list" hx-swap="innerHTML">`+s.tr(c, "Next")+` »</button>`, page+1, url.QueryEscape(search))
-		}
-
-		html += `</div>`
-		html += fmt.Sprintf(`<div style="text-align: center; margin-top: 0.5rem; color: #718096; font-size: 0.875rem;">`+s.tr(c, "Page %d of %d")+` (%d `+s.tr(c, "total")+`)</div>`, page, totalPages, total)
-	}
+	s.render(c, http.StatusOK, "zones_list", gin.H{
+		"Search": search,
+		"Zones":  rows,
+		"Pages":  newPagination(listURL, page, perPage, total),
+	})
+}
+
+// zoneRow is a zone in the zones table with its record count.
+type zoneRow struct {
+	Zone    db.Zone
+	Records int64
+}
 
-	c.Header("Content-Type", "text/html; charset=utf-8")
-	c.String(http.StatusOK, html)
+// zoneRecordCount returns the number of records in a zone.
+func (s *Server) zoneRecordCount(zoneID uint) int64 {
+	var count int64
+	s.db.Model(&db.RData{}).
+		Joins("JOIN rr_sets ON rr_sets.id = r_data.rr_set_id AND rr_sets.deleted_at IS NULL").
+		Where("rr_sets.zone_id = ?", zoneID).
+		Count(&count)
+	return count
 }
 
 func (s *Server) newZoneForm(c *gin.Context) {
-    html := `
-    <div style="background: #f7fafc; padding: 1rem; border-radius: 4px; margin-bottom: 1rem;">
-        <h3>` + s.tr(c, "Create New Zone") + `</h3>
-        <form hx-post="/admin/zones" hx-target="#zones-list" hx-swap="innerHTML" style="display: flex; gap: 1rem; align-items: end; margin-top: 1rem;">
-            <div style="flex: 1;">
-                <label>` + s.tr(c, "Zone Name") + `</label>
-                <input type="text" name="name" placeholder="example.com" required
-                    style="width: 100%; padding: 0.5rem; border: 1px solid #cbd5e0; border-radius: 4px;">
-            </div>
-            <button type="submit" class="btn">` + s.tr(c, "Create") + `</button>
-            <button type="button" class="btn" style="background: #718096;"
-                hx-get="/admin/zones" hx-target="#zones-list" hx-swap="innerHTML">
-                ` + s.tr(c, "Cancel") + `
-            </button>
-        </form>
-    </div>
-    <div hx-get="/admin/zones" hx-trigger="load" hx-swap="innerHTML"></div>
-    `
-	c.Header("Content-Type", "text/html; charset=utf-8")
-	c.String(http.StatusOK, html)
+	s.render(c, http.StatusOK, "zone_new_form", nil)
 }
 
 func (s *Server) createZone(c *gin.Context) {
 	name := c.PostForm("name")
     if name == "" {
-        c.String(http.StatusBadRequest, `<div class="error">`+s.tr(c, "Zone name is required")+`</div>`)
+        s.renderError(c, http.StatusBadRequest, s.tr(c, "Zone name is required"))
         return
     }
 
@@ -202,11 +111,19 @@ func (s *Server) createZone(c *gin.Context) {
 		name += "."
 	}
 
+    if db.ZoneNameInTrash(s.db, name) {
+        s.renderError(c, http.StatusConflict, s.tr(c, "A deleted zone with this name is in the trash. Restore or purge it first."))
+        return
+    }
+
 	zone := db.Zone{Name: name}
-    if err := s.db.Create(&zone).Error; err != nil {
-        c.String(http.StatusInternalServerError, fmt.Sprintf(`<div class="error">`+s.tr(c, "Error creating zone: %s")+`</div>`, err.Error()))
+    if err := s.dbFor(c).Create(&zone).Error; err != nil {
+        s.renderError(c, http.StatusInternalServerError, s.trf(c, "Error creating zone: %s", err.Error()))
         return
     }
+	// Create SOA/NS right away when auto is enabled
+	db.TouchZone(s.db, zone, s.cfg)
+	s.audit(c, db.AuditZoneCreate, zone, 0, zone.Name)
 
 	// Return updated zones list
 	s.listZones(c)
@@ -219,11 +136,15 @@ func (s *Server) deleteZone(c *gin.Context) {
         return
     }
 
-    if err := s.db.Delete(&db.Zone{}, id).Error; err != nil {
+    var zone db.Zone
+    s.db.First(&zone, id)
+    if err := db.TrashZone(s.db, uint(id)); err != nil {
         c.String(http.StatusInternalServerError, s.tr(c, "Error deleting zone"))
         return
     }
+    s.audit(c, db.AuditZoneDelete, zone, 0, zone.Name)
 
+    c.Header("HX-Trigger", "trash-changed")
     c.Status(http.StatusOK)
 }
 
@@ -236,3 +157,18 @@ func (s *Server) updateZone(c *gin.Context) {
 	// Placeholder for update functionality
 	c.Status(http.StatusOK)
 }
+
+// loadZone loads the zone named by the "id" parameter or writes the error.
+func (s *Server) loadZone(c *gin.Context) (db.Zone, bool) {
+	var zone db.Zone
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.String(http.StatusBadRequest, s.tr(c, "Invalid zone ID"))
+		return zone, false
+	}
+	if err := s.db.First(&zone, id).Error; err != nil {
+		c.String(http.StatusNotFound, s.tr(c, "Zone not found"))
+		return zone, false
+	}
+	return zone, true
+}
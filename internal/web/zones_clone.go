@@ -0,0 +1,104 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/db"
+)
+
+func (s *Server) cloneZoneForm(c *gin.Context) {
+	zone, ok := s.loadZone(c)
+	if !ok {
+		return
+	}
+	s.render(c, http.StatusOK, "zone_clone_form", gin.H{"Zone": zone})
+}
+
+// cloneZone copies the zone under a new name and opens the records of the
+// copy; errors are shown in the clone form.
+func (s *Server) cloneZone(c *gin.Context) {
+	zone, ok := s.loadZone(c)
+	if !ok {
+		return
+	}
+	name := strings.TrimSpace(c.PostForm("name"))
+	fail := func(msg string) {
+		s.render(c, http.StatusOK, "zone_clone_form", gin.H{"Zone": zone, "Name": name, "Error": msg})
+	}
+	if name == "" {
+		fail(s.tr(c, "Zone name is required"))
+		return
+	}
+
+	clone, err := db.CloneZone(s.dbFor(c), zone.ID, name)
+	switch {
+	case errors.Is(err, db.ErrZoneNameInTrash):
+		fail(s.tr(c, "A deleted zone with this name is in the trash. Restore or purge it first."))
+		return
+	case err != nil:
+		fail(s.trf(c, "Error cloning zone: %s", err.Error()))
+		return
+	}
+
+	s.audit(c, db.AuditZoneClone, *clone, 0, "from "+zone.Name)
+
+	c.Header("HX-Retarget", "#zones-list")
+	c.Header("HX-Reswap", "innerHTML")
+	for i := range c.Params {
+		if c.Params[i].Key == "id" {
+			c.Params[i].Value = strconv.Itoa(int(clone.ID))
+		}
+	}
+	s.listRecords(c)
+}
+
+func (s *Server) zoneTemplateForm(c *gin.Context) {
+	zone, ok := s.loadZone(c)
+	if !ok {
+		return
+	}
+	s.render(c, http.StatusOK, "zone_template_form", gin.H{
+		"Zone": zone,
+		"Name": strings.TrimSuffix(zone.Name, "."),
+	})
+}
+
+// saveZoneTemplate stores the zone's records as a new template.
+func (s *Server) saveZoneTemplate(c *gin.Context) {
+	zone, ok := s.loadZone(c)
+	if !ok {
+		return
+	}
+	name := strings.TrimSpace(c.PostForm("name"))
+	description := strings.TrimSpace(c.PostForm("description"))
+	if name == "" {
+		s.render(c, http.StatusOK, "zone_template_form", gin.H{
+			"Zone": zone, "Name": name, "Description": description,
+			"Error": s.tr(c, "Template name is required"),
+		})
+		return
+	}
+
+	tpl, err := db.ZoneToTemplate(s.db, zone.ID, name, description)
+	if err != nil {
+		s.render(c, http.StatusOK, "zone_template_form", gin.H{
+			"Zone": zone, "Name": name, "Description": description,
+			"Error": s.trf(c, "Error creating template: %s", err.Error()),
+		})
+		return
+	}
+
+	s.audit(c, db.AuditTemplateCreate, zone, 0, tpl.Name)
+
+	c.Header("HX-Trigger", "templates-changed")
+	s.render(c, http.StatusOK, "zone_template_form", gin.H{
+		"Zone":    zone,
+		"Saved":   true,
+		"Message": s.trf(c, "Template %s created with %d record(s)", tpl.Name, len(tpl.Records)),
+	})
+}
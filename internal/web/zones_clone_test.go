@@ -0,0 +1,85 @@
+package web
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+
+    dbm "namedot/internal/db"
+)
+
+func TestCloneZoneAndSaveAsTemplate(t *testing.T) {
+    s, r := newTestWeb(t)
+    sid := "clone-session"
+    s.sessions[sid] = &Session{Username: "admin", CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour), CSRFToken: "csrf"}
+
+    zone := dbm.Zone{Name: "web-clone.test.", RRSets: []dbm.RRSet{
+        {Name: "www.web-clone.test.", Type: "CNAME", TTL: 300, Records: []dbm.RData{{Data: "web-clone.test."}}},
+        {Name: "web-clone.test.", Type: "A", TTL: 300, Records: []dbm.RData{{Data: "192.0.2.1"}}},
+    }}
+    if err := s.db.Create(&zone).Error; err != nil {
+        t.Fatalf("create zone: %v", err)
+    }
+    defer func() {
+        dbm.TrashZone(s.db, zone.ID)
+        dbm.PurgeZone(s.db, zone.ID)
+    }()
+    base := "/admin/zones/" + strconv.Itoa(int(zone.ID))
+
+    do := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+        req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+        req.AddCookie(&http.Cookie{Name: "session", Value: sid, Path: "/admin"})
+        req.AddCookie(&http.Cookie{Name: "lang", Value: "en", Path: "/"})
+        req.Header.Set("X-CSRF-Token", "csrf")
+        req.Header.Set("Origin", "http://example.com")
+        w := httptest.NewRecorder()
+        r.ServeHTTP(w, req)
+        return w
+    }
+
+    w := do("POST", base+"/clone", url.Values{"name": {"web-clone.test"}})
+    if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "already exists") {
+        t.Fatalf("cloning onto an existing name should show an error: %d %s", w.Code, w.Body.String())
+    }
+
+    w = do("POST", base+"/clone", url.Values{"name": {"web-clone-copy.test"}})
+    if w.Code != http.StatusOK || w.Header().Get("HX-Retarget") != "#zones-list" || !strings.Contains(w.Body.String(), "Records for web-clone-copy.test.") {
+        t.Fatalf("clone should open the records of the copy: %d %s", w.Code, w.Body.String())
+    }
+    var clone dbm.Zone
+    if err := s.db.Preload("RRSets.Records").Where("name = ?", "web-clone-copy.test.").First(&clone).Error; err != nil {
+        t.Fatalf("clone not created: %v", err)
+    }
+    defer func() {
+        dbm.TrashZone(s.db, clone.ID)
+        dbm.PurgeZone(s.db, clone.ID)
+    }()
+    for _, rr := range clone.RRSets {
+        if rr.Type == "CNAME" && (rr.Name != "www.web-clone-copy.test." || rr.Records[0].Data != "web-clone-copy.test.") {
+            t.Fatalf("CNAME not rewritten: %+v", rr)
+        }
+    }
+
+    w = do("POST", base+"/template", url.Values{"name": {"From web-clone"}})
+    if w.Code != http.StatusOK || w.Header().Get("HX-Trigger") != "templates-changed" || !strings.Contains(w.Body.String(), "Template From web-clone created with 2 record(s)") {
+        t.Fatalf("save as template: %d %s", w.Code, w.Body.String())
+    }
+    var tpl dbm.Template
+    if err := s.db.Preload("Records").Where("name = ?", "From web-clone").First(&tpl).Error; err != nil {
+        t.Fatalf("template not created: %v", err)
+    }
+    defer func() {
+        s.db.Unscoped().Where("template_id = ?", tpl.ID).Delete(&dbm.TemplateRecord{})
+        s.db.Unscoped().Delete(&tpl)
+    }()
+    for _, rec := range tpl.Records {
+        if rec.Type == "CNAME" && (rec.Name != "www.{domain}" || rec.Data != "{domain}.") {
+            t.Fatalf("template record not generalized: %+v", rec)
+        }
+    }
+}
@@ -0,0 +1,253 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"namedot/internal/db"
+	"namedot/internal/server/rest/zoneio"
+)
+
+// zoneJSONForm opens the zone in the JSON export format for editing.
+func (s *Server) zoneJSONForm(c *gin.Context) {
+	zone, ok := s.loadZoneRecords(c)
+	if !ok {
+		return
+	}
+	body, err := json.MarshalIndent(zone, "", "  ")
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.render(c, http.StatusOK, "zone_json_form", gin.H{"Zone": zone, "Content": string(body)})
+}
+
+// previewZoneJSON validates the edited JSON and shows the changes it would
+// make, with a form to apply them.
+func (s *Server) previewZoneJSON(c *gin.Context) {
+	zone, ok := s.loadZoneRecords(c)
+	if !ok {
+		return
+	}
+	content := c.PostForm("content")
+	next, err := s.parseZoneJSON(c, zone, content)
+	if err != nil {
+		s.render(c, http.StatusOK, "zone_json_form", gin.H{"Zone": zone, "Content": content, "Error": err.Error()})
+		return
+	}
+	s.renderZoneJSONPreview(c, zone, next, content, "")
+}
+
+// applyZoneJSON replaces the records of the zone with the previewed JSON,
+// through the same import as the import form in replace mode. It refuses to
+// apply when the zone has changed since the preview.
+func (s *Server) applyZoneJSON(c *gin.Context) {
+	zone, ok := s.loadZoneRecords(c)
+	if !ok {
+		return
+	}
+	content := c.PostForm("content")
+	next, err := s.parseZoneJSON(c, zone, content)
+	if err != nil {
+		s.render(c, http.StatusOK, "zone_json_form", gin.H{"Zone": zone, "Content": content, "Error": err.Error()})
+		return
+	}
+	if c.PostForm("base") != zoneFingerprint(&zone) {
+		s.renderZoneJSONPreview(c, zone, next, content, s.tr(c, "The zone has changed since the preview. Review the changes again."))
+		return
+	}
+	diff := diffZones(&zone, next)
+	if _, err := zoneio.ImportJSON(s.dbFor(c), &zone, next, "replace", s.cfg.RecordDefaultTTL(), s.cfg.RecordTTL); err != nil {
+		s.render(c, http.StatusOK, "zone_json_form", gin.H{"Zone": zone, "Content": content, "Error": s.trf(c, "Import failed: %s", err.Error())})
+		return
+	}
+	db.TouchZone(s.db, zone, s.cfg)
+	s.audit(c, db.AuditZoneImport, zone, 0, fmt.Sprintf("json editor: %d added, %d removed", len(diff.Added), len(diff.Removed)))
+
+	c.Header("HX-Retarget", "#zones-list")
+	c.Header("HX-Reswap", "innerHTML")
+	s.listRecords(c)
+}
+
+func (s *Server) renderZoneJSONPreview(c *gin.Context, zone db.Zone, next *db.Zone, content, errMsg string) {
+	s.render(c, http.StatusOK, "zone_json_form", gin.H{
+		"Zone":      zone,
+		"Content":   content,
+		"Error":     errMsg,
+		"Previewed": true,
+		"Diff":      diffZones(&zone, next),
+		"Base":      zoneFingerprint(&zone),
+	})
+}
+
+// loadZoneRecords is loadZone with the RRSets and records preloaded.
+func (s *Server) loadZoneRecords(c *gin.Context) (db.Zone, bool) {
+	var zone db.Zone
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.String(http.StatusBadRequest, s.tr(c, "Invalid zone ID"))
+		return zone, false
+	}
+	if err := s.db.Preload("RRSets.Records").First(&zone, id).Error; err != nil {
+		c.String(http.StatusNotFound, s.tr(c, "Zone not found"))
+		return zone, false
+	}
+	return zone, true
+}
+
+// parseZoneJSON decodes and checks the edited zone. The result is
+// normalized the way ImportJSON stores it, so the preview shows what will
+// end up in the database.
+func (s *Server) parseZoneJSON(c *gin.Context, zone db.Zone, content string) (*db.Zone, error) {
+	if len(content) > maxImportSize {
+		return nil, errors.New(s.tr(c, "File is too large"))
+	}
+	next, err := zoneio.DecodeJSON(strings.NewReader(content))
+	if err != nil {
+		return nil, errors.New(s.tr(c, "Invalid JSON: expected a zone in the export format"))
+	}
+	if next.Name != "" && zoneio.NormalizeFQDN(next.Name) != zone.Name {
+		return nil, errors.New(s.trf(c, "The JSON is for zone %s, not %s", next.Name, zone.Name))
+	}
+	next.Name = zone.Name
+
+	apex := strings.TrimSuffix(zone.Name, ".")
+	seen := map[string]bool{}
+	for i := range next.RRSets {
+		rs := &next.RRSets[i]
+		rs.Name = zoneio.NormalizeFQDN(rs.Name)
+		rs.Type = strings.ToUpper(strings.TrimSpace(rs.Type))
+		if rs.TTL == 0 && s.cfg.RecordDefaultTTL() > 0 {
+			rs.TTL = s.cfg.RecordDefaultTTL()
+		}
+		if rs.Name != zone.Name && !strings.HasSuffix(rs.Name, "."+apex+".") {
+			return nil, errors.New(s.trf(c, "Name %s is outside the zone", rs.Name))
+		}
+		if !contains(recordTypeValues(), rs.Type) {
+			return nil, errors.New(s.trf(c, "%s: unknown record type %s", rs.Name, rs.Type))
+		}
+		key := rs.Name + " " + rs.Type
+		if seen[key] {
+			return nil, errors.New(s.trf(c, "Duplicate record set %s", key))
+		}
+		seen[key] = true
+		if msg := s.ttlLimitError(c, rs.TTL); msg != "" {
+			return nil, fmt.Errorf("%s: %s", key, msg)
+		}
+		for _, r := range rs.Records {
+			if err := validateRecord(rs.Name, rs.Type, rs.TTL, r.Data); err != nil {
+				return nil, fmt.Errorf("%s: %v", key, err)
+			}
+			if r.TTL != nil {
+				if msg := s.ttlLimitError(c, *r.TTL); msg != "" {
+					return nil, fmt.Errorf("%s: %s", key, msg)
+				}
+			}
+		}
+		if err := db.CheckRecordSelectors(*rs); err != nil {
+			return nil, err
+		}
+		rs.Records = db.DedupeRecords(rs.Records)
+	}
+	return next, nil
+}
+
+// zoneDiff compares two zones line by line: one line per record (with its
+// TTL and GeoIP selectors) and one per set comment.
+type zoneDiff struct {
+	Added     []string
+	Removed   []string
+	Unchanged int
+}
+
+func diffZones(cur, next *db.Zone) zoneDiff {
+	count := map[string]int{}
+	for _, l := range zoneLines(cur) {
+		count[l]++
+	}
+	var d zoneDiff
+	for _, l := range zoneLines(next) {
+		if count[l] > 0 {
+			count[l]--
+			d.Unchanged++
+			continue
+		}
+		d.Added = append(d.Added, l)
+	}
+	for _, l := range zoneLines(cur) {
+		if count[l] > 0 {
+			count[l]--
+			d.Removed = append(d.Removed, l)
+		}
+	}
+	return d
+}
+
+func zoneLines(z *db.Zone) []string {
+	var lines []string
+	for _, rs := range z.RRSets {
+		if rs.Comment != "" {
+			lines = append(lines, fmt.Sprintf("; %s %s %q", rs.Name, rs.Type, rs.Comment))
+		}
+		if rs.DynamicURL != nil {
+			lines = append(lines, fmt.Sprintf("; %s %s dynamic %s", rs.Name, rs.Type, *rs.DynamicURL))
+		}
+		for _, r := range rs.Records {
+			lines = append(lines, fmt.Sprintf("%s %d %s %s%s", rs.Name, r.AnswerTTL(rs.TTL), rs.Type, r.Data, geoSuffix(r)))
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// geoSuffix shows the GeoIP selectors of a record in a diff line.
+func geoSuffix(r db.RData) string {
+	var parts []string
+	if v := deref(r.Country); v != "" {
+		parts = append(parts, "country="+v)
+	}
+	if v := deref(r.Continent); v != "" {
+		parts = append(parts, "continent="+v)
+	}
+	if v := deref(r.ASN); v != 0 {
+		parts = append(parts, "asn="+strconv.Itoa(v))
+	}
+	if v := deref(r.ASNs); v != "" {
+		parts = append(parts, "asns="+v)
+	}
+	if v := deref(r.Subnet); v != "" {
+		parts = append(parts, "subnet="+v)
+	}
+	if r.Weight != nil {
+		parts = append(parts, "weight="+strconv.FormatUint(uint64(*r.Weight), 10))
+	}
+	if v := deref(r.HealthCheck); v != "" {
+		parts = append(parts, "check="+v)
+	}
+	if r.Backup {
+		parts = append(parts, "backup")
+	}
+	if r.Disabled {
+		parts = append(parts, "disabled")
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " [" + strings.Join(parts, " ") + "]"
+}
+
+// zoneFingerprint identifies the records of a zone, so applying a preview
+// can tell whether the zone was changed in the meantime.
+func zoneFingerprint(z *db.Zone) string {
+	sum := sha256.Sum256([]byte(strings.Join(zoneLines(z), "\n")))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,107 @@
+package web
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "regexp"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+
+    dbm "namedot/internal/db"
+)
+
+func TestZoneJSONEditor(t *testing.T) {
+    s, r := newTestWeb(t)
+    sid := "json-session"
+    s.sessions[sid] = &Session{Username: "admin", CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour), CSRFToken: "csrf"}
+
+    zone := dbm.Zone{Name: "web-json.test.", RRSets: []dbm.RRSet{
+        {Name: "www.web-json.test.", Type: "A", TTL: 300, Records: []dbm.RData{{Data: "192.0.2.1"}}},
+        {Name: "old.web-json.test.", Type: "A", TTL: 300, Records: []dbm.RData{{Data: "192.0.2.9"}}},
+    }}
+    if err := s.db.Create(&zone).Error; err != nil {
+        t.Fatalf("create zone: %v", err)
+    }
+    defer func() {
+        dbm.TrashZone(s.db, zone.ID)
+        dbm.PurgeZone(s.db, zone.ID)
+    }()
+    base := "/admin/zones/" + strconv.Itoa(int(zone.ID)) + "/json"
+
+    do := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+        var req *http.Request
+        if form != nil {
+            req = httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+            req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+        } else {
+            req = httptest.NewRequest(method, path, nil)
+        }
+        req.AddCookie(&http.Cookie{Name: "session", Value: sid, Path: "/admin"})
+        req.AddCookie(&http.Cookie{Name: "lang", Value: "en", Path: "/"})
+        req.Header.Set("X-CSRF-Token", "csrf")
+        req.Header.Set("Origin", "http://example.com")
+        w := httptest.NewRecorder()
+        r.ServeHTTP(w, req)
+        return w
+    }
+
+    w := do("GET", base, nil)
+    if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "192.0.2.1") {
+        t.Fatalf("editor: %d %s", w.Code, w.Body.String())
+    }
+
+    edited := `{"name": "web-json.test.", "rrsets": [
+        {"name": "www.web-json.test.", "type": "A", "ttl": 300, "records": [{"data": "192.0.2.1"}]},
+        {"name": "new.web-json.test.", "type": "AAAA", "ttl": 600, "records": [{"data": "2001:db8::1", "country": "DE"}]}
+    ]}`
+
+    // Invalid input is reported in the editor and keeps the text
+    for in, want := range map[string]string{
+        `{"rrsets": [`: "Invalid JSON",
+        `{"name": "other.test.", "rrsets": []}`: "for zone other.test.",
+        `{"rrsets": [{"name": "www.elsewhere.test.", "type": "A", "records": [{"data": "192.0.2.1"}]}]}`: "outside the zone",
+        `{"rrsets": [{"name": "www.web-json.test.", "type": "A", "records": [{"data": "not-an-ip"}]}]}`: "www.web-json.test. A",
+        `{"rrsets": [{"name": "a.web-json.test.", "type": "A", "records": []}, {"name": "a.web-json.test.", "type": "a", "records": []}]}`: "Duplicate record set",
+    } {
+        w = do("POST", base+"/preview", url.Values{"content": {in}})
+        if body := w.Body.String(); !strings.Contains(body, want) || strings.Contains(body, "Apply changes") {
+            t.Errorf("preview %s: want %q in %s", in, want, body)
+        }
+    }
+
+    w = do("POST", base+"/preview", url.Values{"content": {edited}})
+    body := w.Body.String()
+    if !strings.Contains(body, "1 added, 1 removed, 1 unchanged") ||
+        !strings.Contains(body, "- old.web-json.test. 300 A 192.0.2.9") ||
+        !strings.Contains(body, "+ new.web-json.test. 600 AAAA 2001:db8::1 [country=DE]") {
+        t.Fatalf("preview: %s", body)
+    }
+    m := regexp.MustCompile(`name="base" value="([0-9a-f]+)"`).FindStringSubmatch(body)
+    if m == nil {
+        t.Fatalf("no base in preview: %s", body)
+    }
+
+    // A stale preview is not applied
+    w = do("POST", base, url.Values{"content": {edited}, "base": {"stale"}})
+    if !strings.Contains(w.Body.String(), "changed since the preview") {
+        t.Fatalf("stale apply: %s", w.Body.String())
+    }
+    var count int64
+    s.db.Model(&dbm.RRSet{}).Where("zone_id = ? AND name = ?", zone.ID, "old.web-json.test.").Count(&count)
+    if count != 1 {
+        t.Fatalf("stale preview was applied")
+    }
+
+    w = do("POST", base, url.Values{"content": {edited}, "base": {m[1]}})
+    if w.Code != http.StatusOK || w.Header().Get("HX-Retarget") != "#zones-list" || !strings.Contains(w.Body.String(), "2001:db8::1") {
+        t.Fatalf("apply: %d %s", w.Code, w.Body.String())
+    }
+    var sets []dbm.RRSet
+    s.db.Preload("Records").Where("zone_id = ?", zone.ID).Order("name").Find(&sets)
+    if len(sets) != 2 || sets[0].Name != "new.web-json.test." || sets[0].TTL != 600 || deref(sets[0].Records[0].Country) != "DE" || sets[1].Name != "www.web-json.test." {
+        t.Fatalf("records after apply: %+v", sets)
+    }
+}
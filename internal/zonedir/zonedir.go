@@ -0,0 +1,264 @@
+// Package zonedir keeps the database in sync with a directory of BIND zone
+// files, so zones can be managed GitOps-style. Files are authoritative: each
+// changed file replaces the contents of its zone.
+package zonedir
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"gorm.io/gorm"
+
+	"namedot/internal/config"
+	dbm "namedot/internal/db"
+	"namedot/internal/server/rest/zoneio"
+)
+
+// ManagedBy is stored in Zone.ManagedBy for zones owned by the zone directory.
+const ManagedBy = "zone_dir"
+
+// CacheInvalidator is implemented by the DNS server.
+type CacheInvalidator interface {
+	InvalidateZoneCache()
+}
+
+// SyncResult summarizes one synchronization pass.
+type SyncResult struct {
+	Updated []string
+	Removed []string
+	Errors  map[string]error // keyed by file name
+}
+
+// Changed reports whether the pass modified the database.
+func (r SyncResult) Changed() bool {
+	return len(r.Updated) > 0 || len(r.Removed) > 0
+}
+
+// Syncer loads zone files from a directory into the database.
+type Syncer struct {
+	cfg   *config.Config
+	db    *gorm.DB
+	cache CacheInvalidator
+
+	mu     sync.Mutex
+	hashes map[string][32]byte // zone name -> hash of last imported file
+}
+
+// NewSyncer creates a zone directory syncer. cache may be nil.
+func NewSyncer(cfg *config.Config, db *gorm.DB, cache CacheInvalidator) *Syncer {
+	return &Syncer{cfg: cfg, db: db, cache: cache, hashes: map[string][32]byte{}}
+}
+
+// SetCacheInvalidator sets the cache to invalidate after changes.
+func (s *Syncer) SetCacheInvalidator(cache CacheInvalidator) {
+	s.mu.Lock()
+	s.cache = cache
+	s.mu.Unlock()
+}
+
+// ZoneNameFromFile derives the zone name from a file name: "example.com",
+// "example.com.zone", "example.com.db" and "db.example.com" all map to
+// "example.com.". It returns "" for files that should be ignored.
+func ZoneNameFromFile(name string) string {
+	if name == "" || strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~") ||
+		strings.HasSuffix(name, ".swp") || strings.HasSuffix(name, ".tmp") {
+		return ""
+	}
+	n := strings.ToLower(name)
+	n = strings.TrimSuffix(n, ".zone")
+	n = strings.TrimSuffix(n, ".db")
+	n = strings.TrimPrefix(n, "db.")
+	if n == "" {
+		return ""
+	}
+	return zoneio.NormalizeFQDN(n)
+}
+
+// Sync performs a full pass over the directory. Unchanged files are skipped.
+func (s *Syncer) Sync() SyncResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := SyncResult{Errors: map[string]error{}}
+	entries, err := os.ReadDir(s.cfg.ZoneDir.Path)
+	if err != nil {
+		res.Errors[s.cfg.ZoneDir.Path] = err
+		return res
+	}
+
+	present := map[string]bool{}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		zoneName := ZoneNameFromFile(e.Name())
+		if zoneName == "" {
+			continue
+		}
+		if present[zoneName] {
+			res.Errors[e.Name()] = fmt.Errorf("zone %s is defined by more than one file", zoneName)
+			continue
+		}
+		present[zoneName] = true
+
+		content, err := os.ReadFile(filepath.Join(s.cfg.ZoneDir.Path, e.Name()))
+		if err != nil {
+			res.Errors[e.Name()] = err
+			continue
+		}
+		sum := sha256.Sum256(content)
+		if prev, ok := s.hashes[zoneName]; ok && prev == sum {
+			continue
+		}
+		if err := s.importZone(zoneName, e.Name(), content); err != nil {
+			res.Errors[e.Name()] = err
+			continue
+		}
+		s.hashes[zoneName] = sum
+		res.Updated = append(res.Updated, zoneName)
+	}
+
+	if s.cfg.ZoneDir.Prune {
+		var managed []dbm.Zone
+		if err := s.db.Where("managed_by = ?", ManagedBy).Find(&managed).Error; err != nil {
+			res.Errors[s.cfg.ZoneDir.Path] = err
+		}
+		for _, z := range managed {
+			if present[z.Name] {
+				continue
+			}
+			if err := deleteZone(s.db, &z); err != nil {
+				res.Errors[z.Name] = err
+				continue
+			}
+			delete(s.hashes, z.Name)
+			res.Removed = append(res.Removed, z.Name)
+		}
+	}
+
+	if res.Changed() && s.cache != nil {
+		s.cache.InvalidateZoneCache()
+	}
+	return res
+}
+
+// importZone replaces the zone contents with the parsed file. A file that
+// fails to parse leaves the previously loaded data untouched.
+func (s *Syncer) importZone(name, file string, content []byte) error {
+	return dbm.WithSource(s.db, dbm.SourceZoneDir(file)).Transaction(func(tx *gorm.DB) error {
+		var z dbm.Zone
+		if err := tx.Unscoped().Where("name = ?", name).Limit(1).Find(&z).Error; err != nil {
+			return err
+		}
+		if z.ID == 0 {
+			z = dbm.Zone{Name: name, ManagedBy: ManagedBy}
+			if err := tx.Create(&z).Error; err != nil {
+				return fmt.Errorf("create zone: %w", err)
+			}
+		} else if z.DeletedAt.Valid || z.ManagedBy != ManagedBy {
+			if err := tx.Unscoped().Model(&z).Updates(map[string]interface{}{"deleted_at": nil, "managed_by": ManagedBy}).Error; err != nil {
+				return err
+			}
+		}
+		rep, err := zoneio.ImportBIND(tx, &z, bytes.NewReader(content), "replace", s.cfg.RecordDefaultTTL(), s.cfg.RecordTTL)
+		if err != nil {
+			return err
+		}
+		return rep.Err()
+	})
+}
+
+func deleteZone(db *gorm.DB, z *dbm.Zone) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var ids []uint
+		if err := tx.Unscoped().Model(&dbm.RRSet{}).Where("zone_id = ?", z.ID).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) > 0 {
+			if err := tx.Unscoped().Where("rr_set_id IN ?", ids).Delete(&dbm.RData{}).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Unscoped().Where("zone_id = ?", z.ID).Delete(&dbm.RRSet{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("zone_id = ?", z.ID).Delete(&dbm.ZoneSettings{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("zone_id = ?", z.ID).Delete(&dbm.ZoneCanary{}).Error; err != nil {
+			return err
+		}
+		// Hard delete so the name can be recreated when the file comes back.
+		return tx.Unscoped().Delete(z).Error
+	})
+}
+
+// Log writes the outcome of a sync pass to the standard logger.
+func (r SyncResult) Log() {
+	for _, z := range r.Updated {
+		log.Printf("zone_dir: loaded %s", z)
+	}
+	for _, z := range r.Removed {
+		log.Printf("zone_dir: removed %s (file deleted)", z)
+	}
+	for f, err := range r.Errors {
+		log.Printf("zone_dir: %s: %v", f, err)
+	}
+}
+
+// Run re-syncs whenever files in the directory change (and every rescan_sec,
+// if set) until ctx is cancelled. Call Sync first to load zones at startup.
+func (s *Syncer) Run(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("create watcher: %w", err)
+	}
+	defer watcher.Close()
+	if err := watcher.Add(s.cfg.ZoneDir.Path); err != nil {
+		return fmt.Errorf("watch %s: %w", s.cfg.ZoneDir.Path, err)
+	}
+
+	debounce := time.Duration(s.cfg.ZoneDir.DebounceMs) * time.Millisecond
+	var pending <-chan time.Time
+	var rescan <-chan time.Time
+	if s.cfg.ZoneDir.RescanSec > 0 {
+		ticker := time.NewTicker(time.Duration(s.cfg.ZoneDir.RescanSec) * time.Second)
+		defer ticker.Stop()
+		rescan = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if ZoneNameFromFile(filepath.Base(ev.Name)) == "" {
+				continue
+			}
+			// Editors and git checkouts produce bursts of events; sync once they settle.
+			pending = time.After(debounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Printf("zone_dir: watcher error: %v", err)
+		case <-pending:
+			pending = nil
+			s.Sync().Log()
+		case <-rescan:
+			s.Sync().Log()
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package zonedir
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"namedot/internal/config"
+	dbm "namedot/internal/db"
+)
+
+type countingCache struct{ n int }
+
+func (c *countingCache) InvalidateZoneCache() { c.n++ }
+
+func newTestSyncer(t *testing.T, prune bool) (*Syncer, *gorm.DB, string, *countingCache) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	// A single connection keeps every goroutine on the same in-memory database
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := dbm.AutoMigrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	dir := t.TempDir()
+	cfg := &config.Config{DefaultTTL: 300, ZoneDir: config.ZoneDirConfig{Enabled: true, Path: dir, Prune: prune}}
+	cache := &countingCache{}
+	return NewSyncer(cfg, db, cache), db, dir, cache
+}
+
+func writeZone(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+func recordData(t *testing.T, db *gorm.DB, zone, name, typ string) []string {
+	t.Helper()
+	var z dbm.Zone
+	if err := db.Where("name = ?", zone).First(&z).Error; err != nil {
+		t.Fatalf("zone %s not found: %v", zone, err)
+	}
+	var rs dbm.RRSet
+	if err := db.Preload("Records").Where("zone_id = ? AND name = ? AND type = ?", z.ID, name, typ).Limit(1).Find(&rs).Error; err != nil {
+		t.Fatalf("load rrset: %v", err)
+	}
+	var out []string
+	for _, r := range rs.Records {
+		out = append(out, r.Data)
+	}
+	return out
+}
+
+const exampleZone = `$TTL 600
+@ IN SOA ns1.example.com. hostmaster.example.com. 2025010101 7200 3600 1209600 300
+@ IN NS ns1.example.com.
+www IN A 192.0.2.1
+`
+
+func TestZoneNameFromFile(t *testing.T) {
+	tests := map[string]string{
+		"example.com":      "example.com.",
+		"Example.COM.zone": "example.com.",
+		"example.com.db":   "example.com.",
+		"db.example.com":   "example.com.",
+		".hidden":          "",
+		"example.com~":     "",
+		"example.com.swp":  "",
+	}
+	for in, want := range tests {
+		if got := ZoneNameFromFile(in); got != want {
+			t.Errorf("ZoneNameFromFile(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSync_LoadUpdateAndPrune(t *testing.T) {
+	s, db, dir, cache := newTestSyncer(t, true)
+	path := filepath.Join(dir, "example.com.zone")
+	writeZone(t, path, exampleZone)
+
+	res := s.Sync()
+	if len(res.Errors) != 0 || len(res.Updated) != 1 || res.Updated[0] != "example.com." {
+		t.Fatalf("initial sync: %+v", res)
+	}
+	if got := recordData(t, db, "example.com.", "www.example.com.", "A"); len(got) != 1 || got[0] != "192.0.2.1" {
+		t.Fatalf("unexpected www A: %v", got)
+	}
+	if cache.n != 1 {
+		t.Fatalf("expected cache invalidation, got %d", cache.n)
+	}
+
+	// Unchanged file is not re-imported
+	if res := s.Sync(); res.Changed() {
+		t.Fatalf("expected no changes, got %+v", res)
+	}
+
+	// Edited file replaces zone contents
+	writeZone(t, path, exampleZone[:len(exampleZone)-len("www IN A 192.0.2.1\n")]+"api IN A 192.0.2.5\n")
+	if res := s.Sync(); len(res.Updated) != 1 {
+		t.Fatalf("expected update, got %+v", res)
+	}
+	if got := recordData(t, db, "example.com.", "www.example.com.", "A"); len(got) != 0 {
+		t.Fatalf("www should be gone after replace, got %v", got)
+	}
+	if got := recordData(t, db, "example.com.", "api.example.com.", "A"); len(got) != 1 {
+		t.Fatalf("api A missing: %v", got)
+	}
+
+	// Broken file keeps the last good data
+	writeZone(t, path, "www IN A not-an-ip\n")
+	if res := s.Sync(); len(res.Errors) != 1 || res.Changed() {
+		t.Fatalf("expected parse error, got %+v", res)
+	}
+	if got := recordData(t, db, "example.com.", "api.example.com.", "A"); len(got) != 1 {
+		t.Fatalf("last good data should be kept: %v", got)
+	}
+
+	// Removed file prunes the zone, unmanaged zones are untouched
+	if err := db.Create(&dbm.Zone{Name: "manual.example."}).Error; err != nil {
+		t.Fatalf("create manual zone: %v", err)
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if res := s.Sync(); len(res.Removed) != 1 || res.Removed[0] != "example.com." {
+		t.Fatalf("expected prune, got %+v", res)
+	}
+	var names []string
+	db.Model(&dbm.Zone{}).Pluck("name", &names)
+	if len(names) != 1 || names[0] != "manual.example." {
+		t.Fatalf("unexpected zones after prune: %v", names)
+	}
+
+	// File re-added recreates the zone
+	writeZone(t, path, exampleZone)
+	if res := s.Sync(); len(res.Updated) != 1 || len(res.Errors) != 0 {
+		t.Fatalf("expected re-create, got %+v", res)
+	}
+}
+
+func TestSync_NoPrune(t *testing.T) {
+	s, db, dir, _ := newTestSyncer(t, false)
+	path := filepath.Join(dir, "example.com")
+	writeZone(t, path, exampleZone)
+	s.Sync()
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if res := s.Sync(); res.Changed() {
+		t.Fatalf("expected no changes without prune, got %+v", res)
+	}
+	var count int64
+	db.Model(&dbm.Zone{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("zone should be kept without prune, got %d zones", count)
+	}
+}
+
+func TestRun_WatchesDirectory(t *testing.T) {
+	s, db, dir, _ := newTestSyncer(t, true)
+	s.cfg.ZoneDir.DebounceMs = 10
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := s.Run(ctx); err != nil {
+			t.Errorf("run: %v", err)
+		}
+	}()
+
+	// Give the watcher a moment to register the directory
+	time.Sleep(50 * time.Millisecond)
+	writeZone(t, filepath.Join(dir, "example.com.zone"), exampleZone)
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		var count int64
+		db.Model(&dbm.Zone{}).Where("name = ?", "example.com.").Count(&count)
+		if count == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("zone was not loaded after file creation")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	cancel()
+	<-done
+}
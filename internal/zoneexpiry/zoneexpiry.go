@@ -0,0 +1,191 @@
+// Package zoneexpiry disables or trashes zones that reached their expire_at
+// date or saw no queries or changes for inactive_days, e.g. temporary test
+// zones handed out by providers.
+package zoneexpiry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+
+	"namedot/internal/config"
+	dbm "namedot/internal/db"
+)
+
+const (
+	ActionDisable = "disable"
+	ActionTrash   = "trash"
+)
+
+// CacheInvalidator is implemented by the DNS server.
+type CacheInvalidator interface {
+	InvalidateZoneCache()
+}
+
+// Event describes one expired zone; it is logged and sent to expiry.webhook_url.
+type Event struct {
+	Event  string    `json:"event"`
+	ZoneID uint      `json:"zone_id"`
+	Zone   string    `json:"zone"`
+	Action string    `json:"action"`
+	Reason string    `json:"reason"`
+	At     time.Time `json:"at"`
+}
+
+// Checker applies the expiry policy.
+type Checker struct {
+	cfg    *config.Config
+	db     *gorm.DB
+	cache  CacheInvalidator
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewChecker creates an expiry checker. cache may be nil.
+func NewChecker(cfg *config.Config, db *gorm.DB, cache CacheInvalidator) *Checker {
+	return &Checker{
+		cfg:    cfg,
+		db:     db,
+		cache:  cache,
+		client: &http.Client{Timeout: 10 * time.Second},
+		now:    time.Now,
+	}
+}
+
+// Check expires due zones once and returns what was done.
+func (c *Checker) Check() ([]Event, error) {
+	var zones []dbm.Zone
+	if err := c.db.Where("disabled = ? AND (expire_at IS NOT NULL OR inactive_days > 0)", false).Find(&zones).Error; err != nil {
+		return nil, err
+	}
+	now := c.now()
+	var events []Event
+	for _, z := range zones {
+		reason, err := c.expired(z, now)
+		if err != nil {
+			log.Printf("zone expiry: %s: %v", z.Name, err)
+			continue
+		}
+		if reason == "" {
+			continue
+		}
+		action := z.ExpireAction
+		if action == "" {
+			action = c.cfg.Expiry.DefaultAction
+		}
+		if err := c.apply(z, action); err != nil {
+			log.Printf("zone expiry: %s: %s: %v", z.Name, action, err)
+			continue
+		}
+		events = append(events, Event{Event: "zone_expired", ZoneID: z.ID, Zone: z.Name, Action: action, Reason: reason, At: now.UTC()})
+	}
+	if len(events) > 0 && c.cache != nil {
+		c.cache.InvalidateZoneCache()
+	}
+	for _, e := range events {
+		log.Printf("zone expiry: %s %s (%s)", e.Zone, e.Action, e.Reason)
+		c.notify(e)
+	}
+	return events, nil
+}
+
+// expired returns why z is due, or "" if it is not.
+func (c *Checker) expired(z dbm.Zone, now time.Time) (string, error) {
+	if z.ExpireAt != nil && !now.Before(*z.ExpireAt) {
+		return "expire_at " + z.ExpireAt.UTC().Format(time.RFC3339) + " reached", nil
+	}
+	if z.InactiveDays > 0 {
+		last, err := LastActivity(c.db, z)
+		if err != nil {
+			return "", err
+		}
+		if now.Sub(last) >= time.Duration(z.InactiveDays)*24*time.Hour {
+			return fmt.Sprintf("inactive for %d days", z.InactiveDays), nil
+		}
+	}
+	return "", nil
+}
+
+// LastActivity is the latest of the zone's own changes, its RRSet changes and
+// the last hour it was queried (when query statistics are enabled).
+func LastActivity(db *gorm.DB, z dbm.Zone) (time.Time, error) {
+	last := z.UpdatedAt
+	if z.CreatedAt.After(last) {
+		last = z.CreatedAt
+	}
+	var sets []dbm.RRSet
+	if err := db.Select("updated_at").Where("zone_id = ?", z.ID).Order("updated_at desc").Limit(1).Find(&sets).Error; err != nil {
+		return last, err
+	}
+	if len(sets) > 0 && sets[0].UpdatedAt.After(last) {
+		last = sets[0].UpdatedAt
+	}
+	var stats []dbm.QueryStat
+	if err := db.Select("hour").Where("zone = ?", z.Name).Order("hour desc").Limit(1).Find(&stats).Error; err != nil {
+		return last, err
+	}
+	if len(stats) > 0 {
+		// Counters are hourly; the zone may have been queried until the end of the hour
+		if end := stats[0].Hour.Add(time.Hour); end.After(last) {
+			last = end
+		}
+	}
+	return last, nil
+}
+
+// apply disables or trashes z. The expiry settings are cleared so a zone that
+// is re-enabled or restored does not expire again right away.
+func (c *Checker) apply(z dbm.Zone, action string) error {
+	reset := map[string]interface{}{"expire_at": nil, "inactive_days": 0}
+	switch action {
+	case ActionTrash:
+		if err := c.db.Model(&dbm.Zone{}).Where("id = ?", z.ID).Updates(reset).Error; err != nil {
+			return err
+		}
+		return dbm.TrashZone(c.db, z.ID)
+	case ActionDisable:
+		reset["disabled"] = true
+		return c.db.Model(&dbm.Zone{}).Where("id = ?", z.ID).Updates(reset).Error
+	default:
+		return fmt.Errorf("unknown expire action %q", action)
+	}
+}
+
+func (c *Checker) notify(e Event) {
+	url := c.cfg.Expiry.WebhookURL
+	if url == "" {
+		return
+	}
+	body, _ := json.Marshal(e)
+	resp, err := c.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("zone expiry: webhook: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("zone expiry: webhook: %s returned %s", url, resp.Status)
+	}
+}
+
+// Run checks every expiry.check_sec until ctx is done.
+func (c *Checker) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(c.cfg.Expiry.CheckSec) * time.Second)
+	defer ticker.Stop()
+	for {
+		if _, err := c.Check(); err != nil {
+			log.Printf("zone expiry: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package zoneexpiry
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"namedot/internal/config"
+	dbm "namedot/internal/db"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := dbm.AutoMigrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+type countingCache struct{ n int }
+
+func (c *countingCache) InvalidateZoneCache() { c.n++ }
+
+func newTestChecker(db *gorm.DB, cache CacheInvalidator, now time.Time) *Checker {
+	cfg := &config.Config{Expiry: config.ExpiryConfig{CheckSec: 60, DefaultAction: ActionDisable}}
+	c := NewChecker(cfg, db, cache)
+	c.now = func() time.Time { return now }
+	return c
+}
+
+func TestCheck_ExpireAtDisables(t *testing.T) {
+	db := newTestDB(t)
+	now := time.Now().UTC()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Hour)
+	due := dbm.Zone{Name: "due.test.", ExpireAt: &past}
+	later := dbm.Zone{Name: "later.test.", ExpireAt: &future}
+	plain := dbm.Zone{Name: "plain.test."}
+	for _, z := range []*dbm.Zone{&due, &later, &plain} {
+		if err := db.Create(z).Error; err != nil {
+			t.Fatalf("create zone: %v", err)
+		}
+	}
+
+	cache := &countingCache{}
+	events, err := newTestChecker(db, cache, now).Check()
+	if err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if len(events) != 1 || events[0].Zone != "due.test." || events[0].Action != ActionDisable {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+	if cache.n != 1 {
+		t.Fatalf("expected one cache invalidation, got %d", cache.n)
+	}
+
+	var got dbm.Zone
+	db.First(&got, due.ID)
+	if !got.Disabled || got.ExpireAt != nil {
+		t.Fatalf("expected disabled zone with cleared expire_at, got %+v", got)
+	}
+	var other dbm.Zone
+	db.First(&other, later.ID)
+	if other.Disabled {
+		t.Fatal("zone expiring in the future must stay enabled")
+	}
+
+	// A second run finds nothing to do
+	events, err = newTestChecker(db, cache, now).Check()
+	if err != nil || len(events) != 0 {
+		t.Fatalf("expected no events, got %+v (%v)", events, err)
+	}
+}
+
+func TestCheck_InactiveTrashes(t *testing.T) {
+	db := newTestDB(t)
+	z := dbm.Zone{Name: "idle.test.", InactiveDays: 7, ExpireAction: ActionTrash}
+	if err := db.Create(&z).Error; err != nil {
+		t.Fatalf("create zone: %v", err)
+	}
+	created := z.CreatedAt
+
+	// Recent queries keep the zone alive
+	hour := created.Add(10 * 24 * time.Hour).UTC().Truncate(time.Hour)
+	if err := dbm.AddQueryCounts(db, hour, []dbm.QueryCount{{Zone: z.Name, QType: "A", Queries: 1}}); err != nil {
+		t.Fatalf("add counts: %v", err)
+	}
+	events, err := newTestChecker(db, nil, created.Add(12*24*time.Hour)).Check()
+	if err != nil || len(events) != 0 {
+		t.Fatalf("expected no events, got %+v (%v)", events, err)
+	}
+
+	events, err = newTestChecker(db, nil, created.Add(20*24*time.Hour)).Check()
+	if err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if len(events) != 1 || events[0].Action != ActionTrash {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+	var got dbm.Zone
+	if err := db.Unscoped().First(&got, z.ID).Error; err != nil {
+		t.Fatalf("load zone: %v", err)
+	}
+	if !got.DeletedAt.Valid || got.InactiveDays != 0 {
+		t.Fatalf("expected trashed zone with cleared inactive_days, got %+v", got)
+	}
+}
+
+func TestCheck_Webhook(t *testing.T) {
+	received := make(chan Event, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e Event
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			t.Errorf("decode webhook body: %v", err)
+		}
+		received <- e
+	}))
+	defer srv.Close()
+
+	db := newTestDB(t)
+	past := time.Now().Add(-time.Hour)
+	if err := db.Create(&dbm.Zone{Name: "hook.test.", ExpireAt: &past}).Error; err != nil {
+		t.Fatalf("create zone: %v", err)
+	}
+	c := newTestChecker(db, nil, time.Now())
+	c.cfg.Expiry.WebhookURL = srv.URL
+	if _, err := c.Check(); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	select {
+	case e := <-received:
+		if e.Event != "zone_expired" || e.Zone != "hook.test." || e.Action != ActionDisable {
+			t.Fatalf("unexpected webhook payload: %+v", e)
+		}
+	default:
+		t.Fatal("webhook was not called")
+	}
+}
@@ -0,0 +1,34 @@
+// Package config is the namedot configuration for programs that embed
+// namedot (see package namedot). Build a Config with Parse or Load, which
+// apply the defaults and validate it like the namedot binary does; a Config
+// written as a literal gets neither.
+package config
+
+import (
+	internal "namedot/internal/config"
+)
+
+// The configuration and the sections most often set from code. The other
+// sections are reached through the fields of Config.
+type (
+	Config             = internal.Config
+	DBConfig           = internal.DBConfig
+	GeoIPConfig        = internal.GeoIPConfig
+	AdminConfig        = internal.AdminConfig
+	ReplicationConfig  = internal.ReplicationConfig
+	PerformanceConfig  = internal.PerformanceConfig
+	SOAConfig          = internal.SOAConfig
+	HealthChecksConfig = internal.HealthChecksConfig
+	ScopedToken        = internal.ScopedToken
+	Overrides          = internal.Overrides
+)
+
+// Load reads, completes and validates the YAML config file at path.
+func Load(path string) (*Config, error) {
+	return internal.Load(path)
+}
+
+// Parse reads a YAML config, completing and validating it like Load.
+func Parse(b []byte) (*Config, error) {
+	return internal.Parse(b)
+}
@@ -0,0 +1,58 @@
+// Package dnsserver is the namedot DNS server for programs that embed it
+// on its own, next to their own REST API or none.
+package dnsserver
+
+import (
+	"net"
+
+	"gorm.io/gorm"
+
+	"namedot/internal/config"
+	dnssrv "namedot/internal/server/dns"
+)
+
+// Server answers DNS queries from the zones in the database.
+type Server = dnssrv.Server
+
+// Plugin and the hook interfaces let a program add stages to the query
+// pipeline; see Server.Use.
+type (
+	Plugin            = dnssrv.Plugin
+	PreLookupPlugin   = dnssrv.PreLookupPlugin
+	PostLookupPlugin  = dnssrv.PostLookupPlugin
+	PreResponsePlugin = dnssrv.PreResponsePlugin
+	Query             = dnssrv.Query
+	QueryTrace        = dnssrv.QueryTrace
+)
+
+// Option changes a Server made by New.
+type Option func(*Server)
+
+// WithListeners makes Start serve UDP on pc and TCP on ln instead of binding
+// the listen address, e.g. on ports picked by the system in tests. Either
+// may be nil to bind that one as usual.
+func WithListeners(pc net.PacketConn, ln net.Listener) Option {
+	return func(s *Server) { s.SetListeners(pc, ln) }
+}
+
+// WithPlugins registers plugins in the order given.
+func WithPlugins(p ...Plugin) Option {
+	return func(s *Server) {
+		for _, pl := range p {
+			s.Use(pl)
+		}
+	}
+}
+
+// New returns a DNS server of the zones in db. Nothing is bound until
+// Start.
+func New(cfg *config.Config, db *gorm.DB, opts ...Option) (*Server, error) {
+	s, err := dnssrv.NewServer(cfg, db)
+	if err != nil {
+		return nil, err
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
+}
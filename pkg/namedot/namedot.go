@@ -0,0 +1,313 @@
+// Package namedot runs a complete namedot server inside another program:
+// the database, the DNS server, the REST API and admin panel, and the
+// background workers the config enables. The namedot binary is built on it.
+//
+//	cfg, err := config.Parse(yamlBytes)
+//	srv, err := namedot.New(cfg)
+//	err = srv.Listen()
+//	go srv.Serve(ctx)
+//	...
+//	err = srv.Shutdown(shutdownCtx)
+//
+// Process-wide concerns stay with the caller: signals, systemd
+// notifications, socket handoff, dropping privileges (between Listen and
+// Serve) and the log prefix of node_id.
+package namedot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+
+	"gorm.io/gorm"
+
+	"namedot/internal/anomaly"
+	"namedot/internal/blocklist"
+	"namedot/internal/db"
+	"namedot/internal/discovery"
+	"namedot/internal/dnstap"
+	"namedot/internal/health"
+	"namedot/internal/querylog"
+	"namedot/internal/replication"
+	"namedot/internal/stats"
+	"namedot/internal/zonedir"
+	"namedot/pkg/config"
+	"namedot/pkg/dnsserver"
+	"namedot/pkg/restserver"
+	"namedot/pkg/store"
+)
+
+// Option changes how New builds a Server.
+type Option func(*options)
+
+type options struct {
+	db, readDB *gorm.DB
+	udp        net.PacketConn
+	tcp, rest  net.Listener
+	version    string
+	plugins    []dnsserver.Plugin
+}
+
+// WithDB uses db instead of opening the database of the config. Its tables
+// are still created or upgraded.
+func WithDB(db *gorm.DB) Option {
+	return func(o *options) { o.db = db }
+}
+
+// WithReadDB sends DNS lookups and exports to db instead of the read
+// replica of the config, or the main database without one.
+func WithReadDB(db *gorm.DB) Option {
+	return func(o *options) { o.readDB = db }
+}
+
+// WithDNSListeners serves DNS on udp and tcp instead of binding the listen
+// address; either may be nil.
+func WithDNSListeners(udp net.PacketConn, tcp net.Listener) Option {
+	return func(o *options) { o.udp, o.tcp = udp, tcp }
+}
+
+// WithRESTListener serves the REST API on ln instead of binding rest_listen.
+func WithRESTListener(ln net.Listener) Option {
+	return func(o *options) { o.rest = ln }
+}
+
+// WithDNSPlugins adds plugins to the DNS query pipeline, in the order given.
+func WithDNSPlugins(p ...dnsserver.Plugin) Option {
+	return func(o *options) { o.plugins = append(o.plugins, p...) }
+}
+
+// WithVersion is the version reported in dnstap frames (default "dev").
+func WithVersion(v string) Option {
+	return func(o *options) { o.version = v }
+}
+
+// Server is a namedot instance.
+type Server struct {
+	cfg    *config.Config
+	db     *gorm.DB
+	readDB *gorm.DB
+	dns    *dnsserver.Server
+	rest   *restserver.Server
+
+	zoneSyncer *zonedir.Syncer
+	blocklist  *blocklist.Blocklist
+	queryLog   *querylog.Log
+	tap        *dnstap.Writer
+	health     *health.Checker
+	stats      *stats.Collector
+	syncClient *replication.SyncClient
+	discovery  *discovery.Syncer
+
+	cancel context.CancelFunc
+}
+
+// New opens the database, applies the runtime settings stored in it, loads
+// zone_dir and builds the servers, without binding any socket.
+func New(cfg *config.Config, opts ...Option) (*Server, error) {
+	o := options{version: "dev"}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	s := &Server{cfg: cfg, db: o.db, readDB: o.readDB}
+	var err error
+	if s.db == nil {
+		if s.db, err = store.Open(cfg); err != nil {
+			return nil, fmt.Errorf("open db: %w", err)
+		}
+	} else if err := db.AutoMigrate(s.db); err != nil {
+		return nil, fmt.Errorf("migrate db: %w", err)
+	}
+	if s.readDB == nil {
+		if s.readDB, err = store.OpenReplica(cfg); err != nil {
+			return nil, fmt.Errorf("open replica db: %w", err)
+		}
+		if s.readDB != nil {
+			log.Printf("Using read replica for DNS lookups and exports")
+		} else {
+			s.readDB = s.db
+		}
+	}
+
+	// Runtime settings saved through the API or admin override the file
+	if ov, err := db.LoadOverrides(s.db); err != nil {
+		log.Printf("load settings: %v", err)
+	} else if err := cfg.CheckOverrides(ov); err != nil {
+		log.Printf("settings not applied: %v", err)
+	} else {
+		cfg.SetOverrides(ov)
+		if ov != (config.Overrides{}) {
+			log.Printf("Runtime settings: %s", ov)
+		}
+	}
+
+	// Load zone files before serving so the directory is authoritative from the start
+	if cfg.ZoneDir.Enabled {
+		s.zoneSyncer = zonedir.NewSyncer(cfg, s.db, nil)
+		s.zoneSyncer.Sync().Log()
+	}
+
+	// Ensure SOA exists/updated on startup when auto is enabled
+	store.EnsureSOA(s.db, cfg)
+
+	if s.dns, err = dnsserver.New(cfg, s.readDB); err != nil {
+		return nil, fmt.Errorf("dns server: %w", err)
+	}
+	if o.udp != nil || o.tcp != nil {
+		s.dns.SetListeners(o.udp, o.tcp)
+	}
+	if cfg.Performance.CacheFile != "" {
+		if n, err := s.dns.LoadCache(cfg.Performance.CacheFile); err != nil {
+			log.Printf("answer cache: %v", err)
+		} else if n > 0 {
+			log.Printf("Answer cache: restored %d entries from %s", n, cfg.Performance.CacheFile)
+		}
+	}
+	if err := s.setupDNS(o.version); err != nil {
+		return nil, err
+	}
+	for _, p := range o.plugins {
+		s.dns.Use(p)
+	}
+
+	s.rest = restserver.New(cfg, s.db, s.dns)
+	if o.rest != nil {
+		s.rest.SetListener(o.rest)
+	}
+	if s.readDB != s.db {
+		s.rest.SetReadDB(s.readDB)
+	}
+	if cfg.Replication.Mode == "slave" {
+		s.syncClient = replication.NewSyncClient(cfg, s.db)
+		s.rest.SetReplicator(s.syncClient)
+		s.dns.SetSyncTrigger(s.syncClient.Trigger)
+	}
+
+	// Discovered services are published by the master, which owns the zone
+	if cfg.Replication.Mode != "slave" && cfg.Discovery.Enabled {
+		if s.discovery, err = discovery.New(cfg, s.db, s.dns); err != nil {
+			return nil, fmt.Errorf("discovery: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// setupDNS attaches the optional parts of the DNS server the config enables.
+func (s *Server) setupDNS(version string) error {
+	cfg := s.cfg
+	if cfg.Blocklist.Enabled {
+		bl, err := blocklist.New(cfg.Blocklist)
+		if err != nil {
+			return fmt.Errorf("blocklist: %w", err)
+		}
+		bl.Load()
+		s.blocklist = bl
+		s.dns.SetBlocklist(bl)
+		log.Printf("Blocklist enabled: %s, %d rules", bl.Describe(), bl.Len())
+	}
+
+	if cfg.Anomaly.Enabled {
+		s.dns.SetAnomaly(anomaly.New(cfg.Anomaly))
+		log.Printf("Anomaly alerts enabled: window %ds", cfg.Anomaly.WindowSec)
+	}
+
+	if cfg.QueryLog.Enabled {
+		ql, err := querylog.Open(cfg.QueryLog)
+		if err != nil {
+			return err
+		}
+		s.queryLog = ql
+		s.dns.SetQueryLog(ql)
+		log.Printf("Query log enabled: %s", cfg.QueryLog.Path)
+	}
+
+	if cfg.Log.Dnstap.Enabled {
+		identity := cfg.Log.Dnstap.Identity
+		if identity == "" {
+			identity = cfg.NodeID
+		}
+		if identity == "" {
+			identity, _ = os.Hostname()
+		}
+		s.tap = dnstap.New(cfg.Log.Dnstap.Socket, identity, "namedot "+version)
+		s.dns.SetDnstap(s.tap)
+		log.Printf("dnstap enabled: %s", cfg.Log.Dnstap.Socket)
+	}
+
+	if cfg.HealthChecks.Enabled {
+		s.health = health.New(cfg.HealthChecks, s.db)
+		s.dns.SetHealth(s.health)
+	}
+
+	if cfg.Stats.Enabled {
+		s.stats = stats.NewCollector()
+		s.dns.SetStats(s.stats)
+	}
+	return nil
+}
+
+// Config returns the config the server runs with.
+func (s *Server) Config() *config.Config { return s.cfg }
+
+// DB returns the main database.
+func (s *Server) DB() *gorm.DB { return s.db }
+
+// DNS returns the DNS server.
+func (s *Server) DNS() *dnsserver.Server { return s.dns }
+
+// REST returns the REST API server.
+func (s *Server) REST() *restserver.Server { return s.rest }
+
+// Listen starts the DNS server and binds the REST API, so every port is
+// open before the caller drops privileges. A port that cannot be bound is
+// returned as an error.
+func (s *Server) Listen() error {
+	if err := s.dns.Start(); err != nil {
+		return fmt.Errorf("dns start: %w", err)
+	}
+	if err := s.rest.Listen(); err != nil {
+		return fmt.Errorf("rest listen: %w", err)
+	}
+	return nil
+}
+
+// Serve starts the background workers and serves the REST API until
+// Shutdown, when it returns http.ErrServerClosed. The workers stop when ctx
+// is done or at Shutdown.
+func (s *Server) Serve(ctx context.Context) error {
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.startWorkers(ctx)
+	return s.rest.Start()
+}
+
+// Shutdown stops the servers and workers, waiting for in-flight API requests
+// until ctx is done, and saves the answer cache, query statistics and logs.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	err := s.rest.Shutdown(ctx)
+	_ = s.dns.Shutdown()
+	if s.cfg.Performance.CacheFile != "" {
+		if n, err := s.dns.SaveCache(s.cfg.Performance.CacheFile); err != nil {
+			log.Printf("answer cache: save: %v", err)
+		} else {
+			log.Printf("Answer cache: saved %d entries to %s", n, s.cfg.Performance.CacheFile)
+		}
+	}
+	if s.tap != nil {
+		s.tap.Close()
+	}
+	if s.queryLog != nil {
+		if err := s.queryLog.Close(); err != nil {
+			log.Printf("query log: close: %v", err)
+		}
+	}
+	if s.stats != nil {
+		if err := s.stats.Flush(s.db); err != nil {
+			log.Printf("stats: final flush: %v", err)
+		}
+	}
+	return err
+}
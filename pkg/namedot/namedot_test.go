@@ -0,0 +1,93 @@
+package namedot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"namedot/pkg/config"
+)
+
+func TestServer_Embedded(t *testing.T) {
+	// The listen addresses are never bound: the server gets its sockets
+	dsn := filepath.Join(t.TempDir(), "namedot.db")
+	cfg, err := config.Parse([]byte(fmt.Sprintf(`
+listen: 127.0.0.1:5353
+rest_listen: 127.0.0.1:8080
+api_token: testtoken
+db:
+  driver: sqlite
+  dsn: %s
+`, dsn)))
+	if err != nil {
+		t.Fatalf("parse config: %v", err)
+	}
+
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen tcp: %v", err)
+	}
+	rest, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen rest: %v", err)
+	}
+
+	srv, err := New(cfg, WithDNSListeners(udp, tcp), WithRESTListener(rest))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if err := srv.Listen(); err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(context.Background()) }()
+
+	api := "http://" + rest.Addr().String()
+	post := func(path, body string) {
+		t.Helper()
+		req, _ := http.NewRequest("POST", api+path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer testtoken")
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST %s: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+			t.Fatalf("POST %s: %d", path, resp.StatusCode)
+		}
+	}
+	post("/zones", `{"name":"embed.test"}`)
+	post("/zones/1/rrsets", `{"name":"www","type":"A","ttl":60,"records":[{"data":"192.0.2.10"}]}`)
+
+	m := new(dns.Msg)
+	m.SetQuestion("www.embed.test.", dns.TypeA)
+	in, _, err := new(dns.Client).Exchange(m, udp.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(in.Answer) != 1 || in.Answer[0].(*dns.A).A.String() != "192.0.2.10" {
+		t.Fatalf("answer: %v", in.Answer)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		t.Fatalf("serve: %v", err)
+	}
+}
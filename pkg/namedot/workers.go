@@ -0,0 +1,135 @@
+package namedot
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"namedot/internal/db"
+	"namedot/internal/dhcp"
+	"namedot/internal/notify"
+	"namedot/internal/publish"
+	"namedot/internal/watchdog"
+	"namedot/internal/zoneexpiry"
+)
+
+// startWorkers starts the background work the config enables; it runs until
+// ctx is done.
+func (s *Server) startWorkers(ctx context.Context) {
+	cfg := s.cfg
+	if cfg.Watchdog.Enabled {
+		go watchdog.New(cfg.Watchdog, s.dns.RestartListeners).Run(ctx)
+		log.Printf("Watchdog enabled: max_goroutines=%d max_heap_mb=%d restart_listeners=%v",
+			cfg.Watchdog.MaxGoroutines, cfg.Watchdog.MaxHeapMB, cfg.Watchdog.RestartListeners)
+	}
+
+	if s.blocklist != nil {
+		go s.blocklist.Run(ctx)
+	}
+
+	if s.zoneSyncer != nil {
+		s.zoneSyncer.SetCacheInvalidator(s.dns)
+		go func() {
+			if err := s.zoneSyncer.Run(ctx); err != nil {
+				log.Printf("zone_dir: %v", err)
+			}
+		}()
+		log.Printf("Zone directory mode enabled: watching %s", cfg.ZoneDir.Path)
+	}
+
+	go s.dns.RunNotify(ctx)
+	if s.health != nil {
+		// Started once run_as has dropped privileges, like the other workers
+		go s.health.Run(ctx)
+		log.Printf("Health checks enabled: every %ds", cfg.HealthChecks.IntervalSec)
+	}
+	go purgeTrashPeriodically(ctx, s.db, time.Duration(cfg.TrashRetentionDays)*24*time.Hour)
+	if cfg.DB.MaintenanceSec > 0 {
+		go runMaintenancePeriodically(ctx, s.db, time.Duration(cfg.DB.MaintenanceSec)*time.Second)
+	}
+	if s.stats != nil {
+		go s.stats.Run(ctx, s.db,
+			time.Duration(cfg.Stats.FlushSec)*time.Second,
+			time.Duration(cfg.Stats.RetentionDays)*24*time.Hour,
+			time.Duration(cfg.Stats.DailyRetentionDays)*24*time.Hour)
+	}
+
+	// Zone expiry is applied on the master; slaves receive the result via sync
+	if cfg.Replication.Mode != "slave" && cfg.Expiry.CheckSec > 0 {
+		go zoneexpiry.NewChecker(cfg, s.db, s.dns).Run(ctx)
+	}
+	// Expired DHCP leases are likewise removed on the master only
+	if cfg.Replication.Mode != "slave" && cfg.DHCP.Enabled {
+		go dhcp.New(cfg, s.db, s.dns).Run(ctx)
+		log.Printf("DHCP lease registration enabled: zone %s", cfg.DHCP.Zone)
+	}
+	if s.discovery != nil {
+		go s.discovery.Run(ctx)
+		log.Printf("Service discovery enabled: %s into zone %s every %ds", cfg.Discovery.Provider, cfg.Discovery.Zone, cfg.Discovery.IntervalSec)
+	}
+	// Zones are pushed to cloud providers from the master only
+	if cfg.Replication.Mode != "slave" && cfg.Publish.Enabled {
+		go publish.New(cfg.Publish, s.db).Run(ctx)
+		log.Printf("Zone publishing enabled: %d target(s), checked every %ds", len(cfg.Publish.Targets), cfg.Publish.IntervalSec)
+	}
+	if cfg.Notifications.Enabled {
+		go notify.New(cfg.Notifications, s.db).Run(ctx)
+		log.Printf("Change notifications enabled: %d subscription(s), every %ds", len(cfg.Notifications.Subscriptions), cfg.Notifications.IntervalSec)
+	}
+
+	// Start replication sync worker for slave mode
+	if s.syncClient != nil {
+		go func() {
+			// Wait a bit for REST server to start
+			time.Sleep(2 * time.Second)
+			s.syncClient.StartPeriodicSync(ctx)
+		}()
+		log.Printf("Slave mode enabled: syncing from %s every %d seconds",
+			cfg.Replication.MasterURL, cfg.Replication.SyncIntervalSec)
+	} else if cfg.Replication.Mode == "master" {
+		log.Println("Master mode enabled: ready to serve replication data")
+	}
+}
+
+// purgeTrashPeriodically removes deleted zones whose retention period has expired.
+func purgeTrashPeriodically(ctx context.Context, gormDB *gorm.DB, retention time.Duration) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		if n, err := db.PurgeExpiredTrash(gormDB, retention); err != nil {
+			log.Printf("trash purge: %v", err)
+		} else if n > 0 {
+			log.Printf("trash purge: removed %d expired zone(s)", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runMaintenancePeriodically cleans up orphaned rows and vacuums the database.
+func runMaintenancePeriodically(ctx context.Context, gormDB *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			st, err := db.CleanupOrphans(gormDB)
+			if err != nil {
+				log.Printf("db maintenance: cleanup: %v", err)
+				continue
+			}
+			if err := db.Vacuum(gormDB); err != nil {
+				log.Printf("db maintenance: vacuum: %v", err)
+				continue
+			}
+			log.Printf("db maintenance: removed %d orphaned row(s), vacuum done", st.Total())
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// Package restserver is the namedot REST API and admin panel for programs
+// that embed them.
+package restserver
+
+import (
+	"net"
+
+	"gorm.io/gorm"
+
+	"namedot/internal/config"
+	restsrv "namedot/internal/server/rest"
+)
+
+// Server serves the REST API and, when admin.enabled, the admin panel.
+type Server = restsrv.Server
+
+// DNSServer is what the API needs of the DNS server: dropping cached
+// answers after a change. A *dnsserver.Server also enables the endpoints
+// that read its state, such as /health/dns and /debug/query-log.
+type DNSServer = restsrv.DNSServer
+
+// Option changes a Server made by New.
+type Option func(*Server)
+
+// WithListener makes Start serve on ln instead of binding rest_listen.
+func WithListener(ln net.Listener) Option {
+	return func(s *Server) { s.SetListener(ln) }
+}
+
+// WithReadDB sends exports and other reads to a replica of the database.
+func WithReadDB(db *gorm.DB) Option {
+	return func(s *Server) { s.SetReadDB(db) }
+}
+
+// New returns the API of the zones in db. It binds nothing until Listen or
+// Start.
+func New(cfg *config.Config, db *gorm.DB, dns DNSServer, opts ...Option) *Server {
+	s := restsrv.NewServer(cfg, db, dns)
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
@@ -0,0 +1,57 @@
+// Package store opens the namedot database and exposes its models, for
+// programs that embed namedot or seed zones in tests.
+package store
+
+import (
+	"log"
+
+	"gorm.io/gorm"
+
+	"namedot/internal/config"
+	"namedot/internal/db"
+)
+
+// Zones, their RRSets and the records of an RRSet.
+type (
+	Zone  = db.Zone
+	RRSet = db.RRSet
+	RData = db.RData
+)
+
+// Open connects to the database of cfg (retrying for db.connect_retry_sec)
+// and creates or upgrades its tables.
+func Open(cfg *config.Config) (*gorm.DB, error) {
+	gdb, err := db.OpenWithDebug(cfg.DB, cfg.Log.SQLDebug)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.AutoMigrate(gdb); err != nil {
+		return nil, err
+	}
+	return gdb, nil
+}
+
+// OpenReplica connects to the read replica of cfg, or returns nil when
+// none is configured.
+func OpenReplica(cfg *config.Config) (*gorm.DB, error) {
+	if !cfg.DB.HasReplica() {
+		return nil, nil
+	}
+	return db.OpenWithDebug(cfg.DB.Replica(), cfg.Log.SQLDebug)
+}
+
+// EnsureSOA creates or updates the SOA (and apex NS) of every zone when
+// soa.auto_on_missing or ns.auto_on_missing is set.
+func EnsureSOA(gdb *gorm.DB, cfg *config.Config) {
+	if !(cfg.SOA.AutoOnMissing || cfg.AutoSOAOnMissing || cfg.NS.AutoOnMissing) {
+		return
+	}
+	var zones []db.Zone
+	if err := gdb.Find(&zones).Error; err != nil {
+		log.Printf("SOA ensure: failed to load zones: %v", err)
+		return
+	}
+	for _, z := range zones {
+		db.TouchZone(gdb, z, cfg)
+	}
+}